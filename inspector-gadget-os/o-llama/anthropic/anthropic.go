@@ -0,0 +1,686 @@
+// anthropic package provides middleware for partial compatibility with the Anthropic Messages API
+package anthropic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	stopReasonEndTurn   = "end_turn"
+	stopReasonMaxTokens = "max_tokens"
+	stopReasonToolUse   = "tool_use"
+)
+
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type ErrorResponse struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
+}
+
+// Content is a list of content blocks, which requests may also send as a
+// plain string
+type Content []ContentBlock
+
+func (c *Content) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = Content{{Type: "text", Text: s}}
+		return nil
+	}
+
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return errors.New("content must be a string or a list of content blocks")
+	}
+
+	*c = blocks
+	return nil
+}
+
+type ContentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image
+	Source *ImageSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string  `json:"tool_use_id,omitempty"`
+	Content   Content `json:"content,omitempty"`
+	IsError   bool    `json:"is_error,omitempty"`
+
+	// thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// MarshalJSON writes only the fields of the block's type, including empty
+// ones that clients expect, such as the text of a block that is starting
+func (b ContentBlock) MarshalJSON() ([]byte, error) {
+	switch b.Type {
+	case "text":
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}{b.Type, b.Text})
+	case "thinking":
+		return json.Marshal(struct {
+			Type      string `json:"type"`
+			Thinking  string `json:"thinking"`
+			Signature string `json:"signature,omitempty"`
+		}{b.Type, b.Thinking, b.Signature})
+	case "tool_use":
+		input := b.Input
+		if len(input) == 0 {
+			input = json.RawMessage(`{}`)
+		}
+
+		return json.Marshal(struct {
+			Type  string          `json:"type"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		}{b.Type, b.ID, b.Name, input})
+	default:
+		type block ContentBlock
+		return json.Marshal(block(b))
+	}
+}
+
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type Message struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type Thinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+type MessagesRequest struct {
+	Model         string      `json:"model"`
+	Messages      []Message   `json:"messages"`
+	System        Content     `json:"system,omitempty"`
+	MaxTokens     int         `json:"max_tokens"`
+	StopSequences []string    `json:"stop_sequences,omitempty"`
+	Stream        bool        `json:"stream,omitempty"`
+	Temperature   *float64    `json:"temperature,omitempty"`
+	TopP          *float64    `json:"top_p,omitempty"`
+	TopK          *int        `json:"top_k,omitempty"`
+	Tools         []Tool      `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice `json:"tool_choice,omitempty"`
+	Thinking      *Thinking   `json:"thinking,omitempty"`
+}
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type MessagesResponse struct {
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Model        string         `json:"model"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   *string        `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Usage        Usage          `json:"usage"`
+}
+
+type MessageStartEvent struct {
+	Type    string           `json:"type"`
+	Message MessagesResponse `json:"message"`
+}
+
+type ContentBlockStartEvent struct {
+	Type         string       `json:"type"`
+	Index        int          `json:"index"`
+	ContentBlock ContentBlock `json:"content_block"`
+}
+
+type Delta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+}
+
+type ContentBlockDeltaEvent struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+	Delta Delta  `json:"delta"`
+}
+
+type ContentBlockStopEvent struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+}
+
+type MessageDelta struct {
+	StopReason   string  `json:"stop_reason"`
+	StopSequence *string `json:"stop_sequence"`
+}
+
+type MessageDeltaEvent struct {
+	Type  string       `json:"type"`
+	Delta MessageDelta `json:"delta"`
+	Usage Usage        `json:"usage"`
+}
+
+type MessageStopEvent struct {
+	Type string `json:"type"`
+}
+
+func NewError(code int, message string) ErrorResponse {
+	var etype string
+	switch code {
+	case http.StatusBadRequest:
+		etype = "invalid_request_error"
+	case http.StatusUnauthorized:
+		etype = "authentication_error"
+	case http.StatusForbidden:
+		etype = "permission_error"
+	case http.StatusNotFound:
+		etype = "not_found_error"
+	case http.StatusTooManyRequests:
+		etype = "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		etype = "overloaded_error"
+	default:
+		etype = "api_error"
+	}
+
+	return ErrorResponse{Type: "error", Error: Error{Type: etype, Message: message}}
+}
+
+func randomID(prefix string) string {
+	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, 24)
+	for i := range b {
+		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+	}
+	return prefix + string(b)
+}
+
+func fromImageSource(source *ImageSource) (api.ImageData, error) {
+	if source == nil || source.Type != "base64" {
+		return nil, errors.New("only base64 image sources are supported")
+	}
+
+	switch source.MediaType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return nil, fmt.Errorf("unsupported image media type %q", source.MediaType)
+	}
+
+	img, err := base64.StdEncoding.DecodeString(source.Data)
+	if err != nil {
+		return nil, errors.New("invalid image data")
+	}
+
+	return img, nil
+}
+
+// textContent joins the text blocks of a tool result or system prompt
+func textContent(content Content) (string, error) {
+	var texts []string
+	for _, block := range content {
+		if block.Type != "text" {
+			return "", fmt.Errorf("unsupported content block type %q", block.Type)
+		}
+		texts = append(texts, block.Text)
+	}
+
+	return strings.Join(texts, "\n\n"), nil
+}
+
+func fromMessagesRequest(r MessagesRequest) (*api.ChatRequest, error) {
+	if r.MaxTokens <= 0 {
+		return nil, errors.New("max_tokens: must be greater than 0")
+	}
+
+	var messages []api.Message
+
+	if len(r.System) > 0 {
+		system, err := textContent(r.System)
+		if err != nil {
+			return nil, fmt.Errorf("system: %w", err)
+		}
+		messages = append(messages, api.Message{Role: "system", Content: system})
+	}
+
+	// tool results refer to calls by id, which ollama doesn't track, so
+	// the names of called tools are remembered here
+	toolNames := make(map[string]string)
+
+	for _, msg := range r.Messages {
+		role := strings.ToLower(msg.Role)
+		if role != "user" && role != "assistant" {
+			return nil, fmt.Errorf("invalid message role %q", msg.Role)
+		}
+
+		m := api.Message{Role: role}
+		var texts []string
+
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "text":
+				texts = append(texts, block.Text)
+			case "image":
+				img, err := fromImageSource(block.Source)
+				if err != nil {
+					return nil, err
+				}
+				m.Images = append(m.Images, img)
+			case "thinking", "redacted_thinking":
+				m.Thinking += block.Thinking
+			case "tool_use":
+				var args api.ToolCallFunctionArguments
+				if len(block.Input) > 0 {
+					if err := json.Unmarshal(block.Input, &args); err != nil {
+						return nil, errors.New("invalid tool_use input")
+					}
+				}
+
+				toolNames[block.ID] = block.Name
+				m.ToolCalls = append(m.ToolCalls, api.ToolCall{Function: api.ToolCallFunction{Name: block.Name, Arguments: args}})
+			case "tool_result":
+				content, err := textContent(block.Content)
+				if err != nil {
+					return nil, fmt.Errorf("tool_result: %w", err)
+				}
+
+				if block.IsError {
+					content = "Error: " + content
+				}
+
+				messages = append(messages, api.Message{Role: "tool", Content: content, ToolName: toolNames[block.ToolUseID]})
+			default:
+				return nil, fmt.Errorf("unsupported content block type %q", block.Type)
+			}
+		}
+
+		m.Content = strings.Join(texts, "\n\n")
+		if m.Content != "" || m.Thinking != "" || len(m.Images) > 0 || len(m.ToolCalls) > 0 {
+			messages = append(messages, m)
+		}
+	}
+
+	options := map[string]any{
+		"num_predict": r.MaxTokens,
+	}
+
+	if len(r.StopSequences) > 0 {
+		options["stop"] = r.StopSequences
+	}
+
+	if r.Temperature != nil {
+		options["temperature"] = *r.Temperature
+	}
+
+	if r.TopP != nil {
+		options["top_p"] = *r.TopP
+	}
+
+	if r.TopK != nil {
+		options["top_k"] = *r.TopK
+	}
+
+	var tools []api.Tool
+	if r.ToolChoice == nil || r.ToolChoice.Type != "none" {
+		for _, t := range r.Tools {
+			tool := api.Tool{Type: "function"}
+			tool.Function.Name = t.Name
+			tool.Function.Description = t.Description
+			if len(t.InputSchema) > 0 {
+				if err := json.Unmarshal(t.InputSchema, &tool.Function.Parameters); err != nil {
+					return nil, fmt.Errorf("invalid input_schema for tool %q", t.Name)
+				}
+			}
+			tools = append(tools, tool)
+		}
+	}
+
+	var think *api.ThinkValue
+	if r.Thinking != nil {
+		think = &api.ThinkValue{Value: r.Thinking.Type == "enabled"}
+	}
+
+	return &api.ChatRequest{
+		Model:    r.Model,
+		Messages: messages,
+		Options:  options,
+		Stream:   &r.Stream,
+		Tools:    tools,
+		Think:    think,
+	}, nil
+}
+
+func stopReason(r api.ChatResponse, toolUse bool) string {
+	switch {
+	case toolUse:
+		return stopReasonToolUse
+	case r.DoneReason == "length":
+		return stopReasonMaxTokens
+	default:
+		return stopReasonEndTurn
+	}
+}
+
+func toToolUse(tc api.ToolCall) ContentBlock {
+	input, err := json.Marshal(tc.Function.Arguments)
+	if err != nil || string(input) == "null" {
+		input = json.RawMessage(`{}`)
+	}
+
+	return ContentBlock{Type: "tool_use", ID: randomID("toolu_"), Name: tc.Function.Name, Input: input}
+}
+
+func toMessagesResponse(id, model string, r api.ChatResponse) MessagesResponse {
+	content := []ContentBlock{}
+	if r.Message.Thinking != "" {
+		content = append(content, ContentBlock{Type: "thinking", Thinking: r.Message.Thinking})
+	}
+
+	if r.Message.Content != "" {
+		content = append(content, ContentBlock{Type: "text", Text: r.Message.Content})
+	}
+
+	for _, tc := range r.Message.ToolCalls {
+		content = append(content, toToolUse(tc))
+	}
+
+	reason := stopReason(r, len(r.Message.ToolCalls) > 0)
+	return MessagesResponse{
+		ID:         id,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      model,
+		Content:    content,
+		StopReason: &reason,
+		Usage: Usage{
+			InputTokens:  r.PromptEvalCount,
+			OutputTokens: r.EvalCount,
+		},
+	}
+}
+
+type BaseWriter struct {
+	gin.ResponseWriter
+}
+
+// MessagesWriter translates chat responses into a message or, when
+// streaming, into the events that build one up block by block
+type MessagesWriter struct {
+	stream bool
+	id     string
+	model  string
+
+	// started is set once message_start has been sent
+	started bool
+
+	// block is the type of the content block being streamed, if any, and
+	// index is the index of the next block
+	block   string
+	index   int
+	toolUse bool
+
+	BaseWriter
+}
+
+func (w *BaseWriter) writeError(data []byte) (int, error) {
+	var serr api.StatusError
+	err := json.Unmarshal(data, &serr)
+	if err != nil {
+		return 0, err
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w.ResponseWriter).Encode(NewError(w.ResponseWriter.Status(), serr.Error()))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *MessagesWriter) event(name string, v any) error {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", name, d)
+	return err
+}
+
+// startBlock stops the current content block and starts a new one, unless
+// a block of the same type is already being streamed
+func (w *MessagesWriter) startBlock(block ContentBlock) error {
+	if w.block == block.Type && block.Type != "tool_use" {
+		return nil
+	}
+
+	if err := w.stopBlock(); err != nil {
+		return err
+	}
+
+	w.block = block.Type
+	return w.event("content_block_start", ContentBlockStartEvent{Type: "content_block_start", Index: w.index, ContentBlock: block})
+}
+
+func (w *MessagesWriter) stopBlock() error {
+	if w.block == "" {
+		return nil
+	}
+
+	err := w.event("content_block_stop", ContentBlockStopEvent{Type: "content_block_stop", Index: w.index})
+	w.block = ""
+	w.index++
+	return err
+}
+
+func (w *MessagesWriter) delta(delta Delta) error {
+	return w.event("content_block_delta", ContentBlockDeltaEvent{Type: "content_block_delta", Index: w.index, Delta: delta})
+}
+
+func (w *MessagesWriter) writeEvents(r api.ChatResponse) error {
+	if !w.started {
+		w.started = true
+		if err := w.event("message_start", MessageStartEvent{
+			Type: "message_start",
+			Message: MessagesResponse{
+				ID:      w.id,
+				Type:    "message",
+				Role:    "assistant",
+				Model:   w.model,
+				Content: []ContentBlock{},
+			},
+		}); err != nil {
+			return err
+		}
+	}
+
+	if r.Message.Thinking != "" {
+		if err := w.startBlock(ContentBlock{Type: "thinking"}); err != nil {
+			return err
+		}
+		if err := w.delta(Delta{Type: "thinking_delta", Thinking: r.Message.Thinking}); err != nil {
+			return err
+		}
+	}
+
+	if r.Message.Content != "" {
+		if err := w.startBlock(ContentBlock{Type: "text"}); err != nil {
+			return err
+		}
+		if err := w.delta(Delta{Type: "text_delta", Text: r.Message.Content}); err != nil {
+			return err
+		}
+	}
+
+	for _, tc := range r.Message.ToolCalls {
+		block := toToolUse(tc)
+		input := block.Input
+		block.Input = nil
+
+		w.toolUse = true
+		if err := w.startBlock(block); err != nil {
+			return err
+		}
+		if err := w.delta(Delta{Type: "input_json_delta", PartialJSON: string(input)}); err != nil {
+			return err
+		}
+	}
+
+	if r.Done {
+		if err := w.stopBlock(); err != nil {
+			return err
+		}
+
+		if err := w.event("message_delta", MessageDeltaEvent{
+			Type:  "message_delta",
+			Delta: MessageDelta{StopReason: stopReason(r, w.toolUse)},
+			Usage: Usage{InputTokens: r.PromptEvalCount, OutputTokens: r.EvalCount},
+		}); err != nil {
+			return err
+		}
+
+		return w.event("message_stop", MessageStopEvent{Type: "message_stop"})
+	}
+
+	return nil
+}
+
+func (w *MessagesWriter) writeResponse(data []byte) (int, error) {
+	var chatResponse struct {
+		api.ChatResponse
+
+		// Error is set when the chat handler fails after it has started
+		// streaming
+		Error string `json:"error"`
+	}
+	err := json.Unmarshal(data, &chatResponse)
+	if err != nil {
+		return 0, err
+	}
+
+	if w.stream {
+		w.ResponseWriter.Header().Set("Content-Type", "text/event-stream")
+
+		if chatResponse.Error != "" {
+			err = w.event("error", NewError(http.StatusInternalServerError, chatResponse.Error))
+		} else {
+			err = w.writeEvents(chatResponse.ChatResponse)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		return len(data), nil
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	if chatResponse.Error != "" {
+		err = json.NewEncoder(w.ResponseWriter).Encode(NewError(http.StatusInternalServerError, chatResponse.Error))
+	} else {
+		err = json.NewEncoder(w.ResponseWriter).Encode(toMessagesResponse(w.id, w.model, chatResponse.ChatResponse))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *MessagesWriter) Write(data []byte) (int, error) {
+	code := w.ResponseWriter.Status()
+	if code != http.StatusOK {
+		return w.writeError(data)
+	}
+
+	return w.writeResponse(data)
+}
+
+func MessagesMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req MessagesRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if len(req.Messages) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "messages: at least one message is required"))
+			return
+		}
+
+		chatReq, err := fromMessagesRequest(req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(chatReq); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(&b)
+
+		w := &MessagesWriter{
+			BaseWriter: BaseWriter{ResponseWriter: c.Writer},
+			stream:     req.Stream,
+			id:         randomID("msg_"),
+			model:      req.Model,
+		}
+
+		c.Writer = w
+
+		c.Next()
+	}
+}
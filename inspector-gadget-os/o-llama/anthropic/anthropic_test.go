@@ -0,0 +1,696 @@
+package anthropic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+const image = `iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNk+A8AAQUBAScY42YAAAAASUVORK5CYII=`
+
+var (
+	False = false
+	True  = true
+)
+
+func captureRequestMiddleware(capturedRequest any) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bodyBytes, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		err := json.Unmarshal(bodyBytes, capturedRequest)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, "failed to unmarshal request")
+		}
+		c.Next()
+	}
+}
+
+func TestMessagesMiddleware(t *testing.T) {
+	type testCase struct {
+		name string
+		body string
+		req  api.ChatRequest
+		err  ErrorResponse
+	}
+
+	var capturedRequest *api.ChatRequest
+
+	imageData, _ := base64.StdEncoding.DecodeString(image)
+
+	weatherTool := api.Tool{Type: "function"}
+	weatherTool.Function.Name = "get_weather"
+	weatherTool.Function.Description = "Get the current weather"
+	weatherTool.Function.Parameters.Type = "object"
+	weatherTool.Function.Parameters.Required = []string{"location"}
+	weatherTool.Function.Parameters.Properties = map[string]api.ToolProperty{
+		"location": {
+			Type:        api.PropertyType{"string"},
+			Description: "The city and state",
+		},
+	}
+
+	testCases := []testCase{
+		{
+			name: "messages handler",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 1024,
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"num_predict": 1024.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "messages handler with system prompt and options",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 256,
+				"system": [{"type": "text", "text": "You are helpful."}],
+				"messages": [
+					{"role": "user", "content": [{"type": "text", "text": "Hello"}]}
+				],
+				"stop_sequences": ["\n\nHuman:"],
+				"temperature": 0.5,
+				"top_p": 0.9,
+				"top_k": 40,
+				"stream": true
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "system",
+						Content: "You are helpful.",
+					},
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"num_predict": 256.0,
+					"stop":        []any{"\n\nHuman:"},
+					"temperature": 0.5,
+					"top_p":       0.9,
+					"top_k":       40.0,
+				},
+				Stream: &True,
+			},
+		},
+		{
+			name: "messages handler with image content",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 1024,
+				"messages": [
+					{
+						"role": "user",
+						"content": [
+							{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "` + image + `"}},
+							{"type": "text", "text": "What is in this image?"}
+						]
+					}
+				]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "What is in this image?",
+						Images:  []api.ImageData{imageData},
+					},
+				},
+				Options: map[string]any{
+					"num_predict": 1024.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "messages handler with tools",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 1024,
+				"messages": [
+					{"role": "user", "content": "What's the weather like in Paris?"}
+				],
+				"tools": [{
+					"name": "get_weather",
+					"description": "Get the current weather",
+					"input_schema": {
+						"type": "object",
+						"required": ["location"],
+						"properties": {
+							"location": {"type": "string", "description": "The city and state"}
+						}
+					}
+				}]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "What's the weather like in Paris?",
+					},
+				},
+				Tools: []api.Tool{weatherTool},
+				Options: map[string]any{
+					"num_predict": 1024.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "messages handler with tool choice none",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 1024,
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				],
+				"tools": [{"name": "get_weather", "input_schema": {"type": "object"}}],
+				"tool_choice": {"type": "none"}
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"num_predict": 1024.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "messages handler with tool use and results",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 1024,
+				"messages": [
+					{"role": "user", "content": "What's the weather like in Paris?"},
+					{
+						"role": "assistant",
+						"content": [
+							{"type": "thinking", "thinking": "I should check the weather.", "signature": "abc"},
+							{"type": "text", "text": "Let me check."},
+							{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"location": "Paris, France"}}
+						]
+					},
+					{
+						"role": "user",
+						"content": [
+							{"type": "tool_result", "tool_use_id": "toolu_1", "content": "22°C and sunny"}
+						]
+					}
+				]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "What's the weather like in Paris?",
+					},
+					{
+						Role:     "assistant",
+						Content:  "Let me check.",
+						Thinking: "I should check the weather.",
+						ToolCalls: []api.ToolCall{
+							{
+								Function: api.ToolCallFunction{
+									Name: "get_weather",
+									Arguments: api.ToolCallFunctionArguments{
+										"location": "Paris, France",
+									},
+								},
+							},
+						},
+					},
+					{
+						Role:     "tool",
+						Content:  "22°C and sunny",
+						ToolName: "get_weather",
+					},
+				},
+				Options: map[string]any{
+					"num_predict": 1024.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "messages handler with failed tool result",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 1024,
+				"messages": [
+					{
+						"role": "assistant",
+						"content": [{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {}}]
+					},
+					{
+						"role": "user",
+						"content": [
+							{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "timed out"}], "is_error": true},
+							{"type": "text", "text": "Try again"}
+						]
+					}
+				]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role: "assistant",
+						ToolCalls: []api.ToolCall{
+							{
+								Function: api.ToolCallFunction{
+									Name:      "get_weather",
+									Arguments: api.ToolCallFunctionArguments{},
+								},
+							},
+						},
+					},
+					{
+						Role:     "tool",
+						Content:  "Error: timed out",
+						ToolName: "get_weather",
+					},
+					{
+						Role:    "user",
+						Content: "Try again",
+					},
+				},
+				Options: map[string]any{
+					"num_predict": 1024.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "messages handler with thinking",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 2048,
+				"thinking": {"type": "enabled", "budget_tokens": 1024},
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"num_predict": 2048.0,
+				},
+				Stream: &False,
+				Think:  &api.ThinkValue{Value: true},
+			},
+		},
+		{
+			name: "messages handler without max tokens",
+			body: `{
+				"model": "test-model",
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				]
+			}`,
+			err: ErrorResponse{
+				Type: "error",
+				Error: Error{
+					Type:    "invalid_request_error",
+					Message: "max_tokens: must be greater than 0",
+				},
+			},
+		},
+		{
+			name: "messages handler with invalid role",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 1024,
+				"messages": [
+					{"role": "system", "content": "Hello"}
+				]
+			}`,
+			err: ErrorResponse{
+				Type: "error",
+				Error: Error{
+					Type:    "invalid_request_error",
+					Message: `invalid message role "system"`,
+				},
+			},
+		},
+		{
+			name: "messages handler with unsupported image source",
+			body: `{
+				"model": "test-model",
+				"max_tokens": 1024,
+				"messages": [
+					{"role": "user", "content": [{"type": "image", "source": {"type": "url", "url": "https://example.com/image.png"}}]}
+				]
+			}`,
+			err: ErrorResponse{
+				Type: "error",
+				Error: Error{
+					Type:    "invalid_request_error",
+					Message: "only base64 image sources are supported",
+				},
+			},
+		},
+	}
+
+	endpoint := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MessagesMiddleware(), captureRequestMiddleware(&capturedRequest))
+	router.Handle(http.MethodPost, "/v1/messages", endpoint)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			defer func() { capturedRequest = nil }()
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			var errResp ErrorResponse
+			if resp.Code != http.StatusOK {
+				if err := json.Unmarshal(resp.Body.Bytes(), &errResp); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tc.err, errResp); diff != "" {
+					t.Fatalf("errors did not match for %s:\n%s", tc.name, diff)
+				}
+				return
+			}
+			if diff := cmp.Diff(&tc.req, capturedRequest); diff != "" {
+				t.Fatalf("requests did not match: %+v", diff)
+			}
+		})
+	}
+}
+
+func TestMessagesResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MessagesMiddleware())
+	router.Handle(http.MethodPost, "/v1/messages", func(c *gin.Context) {
+		c.JSON(http.StatusOK, api.ChatResponse{
+			Model: "test-model",
+			Message: api.Message{
+				Role:     "assistant",
+				Content:  "Let me check.",
+				Thinking: "The user wants the weather.",
+				ToolCalls: []api.ToolCall{
+					{
+						Function: api.ToolCallFunction{
+							Name:      "get_weather",
+							Arguments: api.ToolCallFunctionArguments{"location": "Paris"},
+						},
+					},
+				},
+			},
+			Done:       true,
+			DoneReason: "stop",
+			Metrics: api.Metrics{
+				PromptEvalCount: 12,
+				EvalCount:       34,
+			},
+		})
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{
+		"model": "test-model",
+		"max_tokens": 1024,
+		"messages": [{"role": "user", "content": "What's the weather like in Paris?"}]
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var msg MessagesResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(msg.ID, "msg_") {
+		t.Errorf("expected id to start with msg_, got %q", msg.ID)
+	}
+
+	if len(msg.Content) != 3 || !strings.HasPrefix(msg.Content[2].ID, "toolu_") {
+		t.Fatalf("unexpected content: %+v", msg.Content)
+	}
+
+	toolUse := msg.Content[2].ID
+	stopReason := "tool_use"
+	want := MessagesResponse{
+		ID:    msg.ID,
+		Type:  "message",
+		Role:  "assistant",
+		Model: "test-model",
+		Content: []ContentBlock{
+			{Type: "thinking", Thinking: "The user wants the weather."},
+			{Type: "text", Text: "Let me check."},
+			{Type: "tool_use", ID: toolUse, Name: "get_weather", Input: json.RawMessage(`{"location":"Paris"}`)},
+		},
+		StopReason: &stopReason,
+		Usage:      Usage{InputTokens: 12, OutputTokens: 34},
+	}
+
+	if diff := cmp.Diff(want, msg); diff != "" {
+		t.Errorf("response did not match (-want +got):\n%s", diff)
+	}
+}
+
+func TestMessagesStream(t *testing.T) {
+	chunks := []api.ChatResponse{
+		{Message: api.Message{Role: "assistant", Thinking: "Hmm"}},
+		{Message: api.Message{Role: "assistant", Thinking: "..."}},
+		{Message: api.Message{Role: "assistant", Content: "Hello"}},
+		{Message: api.Message{Role: "assistant", Content: " there"}},
+		{
+			Message:    api.Message{Role: "assistant"},
+			Done:       true,
+			DoneReason: "length",
+			Metrics:    api.Metrics{PromptEvalCount: 5, EvalCount: 4},
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MessagesMiddleware())
+	router.Handle(http.MethodPost, "/v1/messages", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		for _, chunk := range chunks {
+			b, _ := json.Marshal(chunk)
+			c.Writer.Write(b)
+		}
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{
+		"model": "test-model",
+		"max_tokens": 4,
+		"stream": true,
+		"messages": [{"role": "user", "content": "Hello"}]
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if ct := resp.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected content type text/event-stream, got %q", ct)
+	}
+
+	type event struct {
+		Name string
+		Data map[string]any
+	}
+
+	var events []event
+	for _, raw := range strings.Split(strings.TrimSpace(resp.Body.String()), "\n\n") {
+		name, data, ok := strings.Cut(raw, "\n")
+		if !ok || !strings.HasPrefix(name, "event: ") || !strings.HasPrefix(data, "data: ") {
+			t.Fatalf("malformed event %q", raw)
+		}
+
+		var e event
+		e.Name = strings.TrimPrefix(name, "event: ")
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &e.Data); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Data["type"] != e.Name {
+			t.Errorf("event %q has type %v", e.Name, e.Data["type"])
+		}
+
+		// message_start is checked separately since the id is random
+		if e.Name == "message_start" {
+			message := e.Data["message"].(map[string]any)
+			if message["model"] != "test-model" || message["role"] != "assistant" {
+				t.Errorf("unexpected message_start: %v", e.Data)
+			}
+			e.Data = nil
+		}
+
+		events = append(events, e)
+	}
+
+	want := []event{
+		{Name: "message_start"},
+		{Name: "content_block_start", Data: map[string]any{"type": "content_block_start", "index": 0.0, "content_block": map[string]any{"type": "thinking", "thinking": ""}}},
+		{Name: "content_block_delta", Data: map[string]any{"type": "content_block_delta", "index": 0.0, "delta": map[string]any{"type": "thinking_delta", "thinking": "Hmm"}}},
+		{Name: "content_block_delta", Data: map[string]any{"type": "content_block_delta", "index": 0.0, "delta": map[string]any{"type": "thinking_delta", "thinking": "..."}}},
+		{Name: "content_block_stop", Data: map[string]any{"type": "content_block_stop", "index": 0.0}},
+		{Name: "content_block_start", Data: map[string]any{"type": "content_block_start", "index": 1.0, "content_block": map[string]any{"type": "text", "text": ""}}},
+		{Name: "content_block_delta", Data: map[string]any{"type": "content_block_delta", "index": 1.0, "delta": map[string]any{"type": "text_delta", "text": "Hello"}}},
+		{Name: "content_block_delta", Data: map[string]any{"type": "content_block_delta", "index": 1.0, "delta": map[string]any{"type": "text_delta", "text": " there"}}},
+		{Name: "content_block_stop", Data: map[string]any{"type": "content_block_stop", "index": 1.0}},
+		{Name: "message_delta", Data: map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "max_tokens", "stop_sequence": nil}, "usage": map[string]any{"input_tokens": 5.0, "output_tokens": 4.0}}},
+		{Name: "message_stop", Data: map[string]any{"type": "message_stop"}},
+	}
+
+	if diff := cmp.Diff(want, events); diff != "" {
+		t.Errorf("events did not match (-want +got):\n%s", diff)
+	}
+}
+
+func TestMessagesStreamToolUse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MessagesMiddleware())
+	router.Handle(http.MethodPost, "/v1/messages", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		for _, chunk := range []api.ChatResponse{
+			{Message: api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{Function: api.ToolCallFunction{Name: "get_weather", Arguments: api.ToolCallFunctionArguments{"location": "Paris"}}}}}},
+			{Message: api.Message{Role: "assistant"}, Done: true, DoneReason: "stop"},
+		} {
+			b, _ := json.Marshal(chunk)
+			c.Writer.Write(b)
+		}
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{
+		"model": "test-model",
+		"max_tokens": 1024,
+		"stream": true,
+		"messages": [{"role": "user", "content": "What's the weather like in Paris?"}]
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	body := resp.Body.String()
+	for _, want := range []string{
+		`"content_block":{"type":"tool_use","id":"toolu_`,
+		`"name":"get_weather","input":{}}`,
+		`"delta":{"type":"input_json_delta","partial_json":"{\"location\":\"Paris\"}"}`,
+		`"stop_reason":"tool_use"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected stream to contain %s, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMessagesErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MessagesMiddleware())
+	router.Handle(http.MethodPost, "/v1/messages", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model \"missing\" not found, try pulling it first"})
+	})
+	router.Handle(http.MethodPost, "/v1/messages/stream", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		c.Writer.Write([]byte(`{"error":"an error was encountered while running the model"}`))
+	})
+
+	t.Run("status", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{
+			"model": "missing",
+			"max_tokens": 1024,
+			"messages": [{"role": "user", "content": "Hello"}]
+		}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %d", resp.Code)
+		}
+
+		var errResp ErrorResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &errResp); err != nil {
+			t.Fatal(err)
+		}
+
+		want := ErrorResponse{Type: "error", Error: Error{Type: "not_found_error", Message: `model "missing" not found, try pulling it first`}}
+		if diff := cmp.Diff(want, errResp); diff != "" {
+			t.Errorf("errors did not match (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("mid-stream", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/messages/stream", strings.NewReader(`{
+			"model": "test-model",
+			"max_tokens": 1024,
+			"stream": true,
+			"messages": [{"role": "user", "content": "Hello"}]
+		}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		want := "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"api_error\",\"message\":\"an error was encountered while running the model\"}}\n\n"
+		if resp.Body.String() != want {
+			t.Errorf("expected %q, got %q", want, resp.Body.String())
+		}
+	})
+}
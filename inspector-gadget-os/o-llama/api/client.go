@@ -87,35 +87,20 @@ func getAuthorizationToken(ctx context.Context, challenge string) (string, error
 	return token, nil
 }
 
-func (c *Client) do(ctx context.Context, method, path string, reqData, respData any) error {
-	var reqBody io.Reader
-	var data []byte
-	var err error
-
-	switch reqData := reqData.(type) {
-	case io.Reader:
-		// reqData is already an io.Reader
-		reqBody = reqData
-	case nil:
-		// noop
-	default:
-		data, err = json.Marshal(reqData)
-		if err != nil {
-			return err
-		}
-
-		reqBody = bytes.NewReader(data)
-	}
-
+// newRequest returns a request to the server, signed if authentication is
+// enabled
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader, accept string) (*http.Request, error) {
 	requestURL := c.base.JoinPath(path)
 
 	var token string
 	if envconfig.UseAuth() || c.base.Hostname() == "ollama.com" {
 		now := strconv.FormatInt(time.Now().Unix(), 10)
 		chal := fmt.Sprintf("%s,%s?ts=%s", method, path, now)
+
+		var err error
 		token, err = getAuthorizationToken(ctx, chal)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		q := requestURL.Query()
@@ -123,19 +108,47 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 		requestURL.RawQuery = q.Encode()
 	}
 
-	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), reqBody)
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Accept", accept)
 	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
 
 	if token != "" {
 		request.Header.Set("Authorization", token)
 	}
 
+	return request, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, reqData, respData any) error {
+	var reqBody io.Reader
+	var data []byte
+	var err error
+
+	switch reqData := reqData.(type) {
+	case io.Reader:
+		// reqData is already an io.Reader
+		reqBody = reqData
+	case nil:
+		// noop
+	default:
+		data, err = json.Marshal(reqData)
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(data)
+	}
+
+	request, err := c.newRequest(ctx, method, path, reqBody, "application/json")
+	if err != nil {
+		return err
+	}
+
 	respObj, err := c.http.Do(request)
 	if err != nil {
 		return err
@@ -163,7 +176,11 @@ const maxBufferSize = 512 * format.KiloByte
 
 func (c *Client) stream(ctx context.Context, method, path string, data any, fn func([]byte) error) error {
 	var buf io.Reader
-	if data != nil {
+	switch data := data.(type) {
+	case io.Reader:
+		buf = data
+	case nil:
+	default:
 		bts, err := json.Marshal(data)
 		if err != nil {
 			return err
@@ -172,36 +189,11 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 		buf = bytes.NewBuffer(bts)
 	}
 
-	requestURL := c.base.JoinPath(path)
-
-	var token string
-	if envconfig.UseAuth() || c.base.Hostname() == "ollama.com" {
-		var err error
-		now := strconv.FormatInt(time.Now().Unix(), 10)
-		chal := fmt.Sprintf("%s,%s?ts=%s", method, path, now)
-		token, err = getAuthorizationToken(ctx, chal)
-		if err != nil {
-			return err
-		}
-
-		q := requestURL.Query()
-		q.Set("ts", now)
-		requestURL.RawQuery = q.Encode()
-	}
-
-	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), buf)
+	request, err := c.newRequest(ctx, method, path, buf, "application/x-ndjson")
 	if err != nil {
 		return err
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Accept", "application/x-ndjson")
-	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
-
-	if token != "" {
-		request.Header.Set("Authorization", token)
-	}
-
 	response, err := c.http.Do(request)
 	if err != nil {
 		return err
@@ -300,6 +292,57 @@ func (c *Client) Pull(ctx context.Context, req *PullRequest, fn PullProgressFunc
 	})
 }
 
+// Export writes a bundle of the models in req to w, as a tar archive that
+// [Client.Import] can add to a server without access to a registry.
+func (c *Client) Export(ctx context.Context, req *ExportRequest, w io.Writer) error {
+	bts, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	request, err := c.newRequest(ctx, http.MethodPost, "/api/export", bytes.NewReader(bts), "application/x-tar")
+	if err != nil {
+		return err
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		return checkError(response, body)
+	}
+
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+// ImportProgressFunc is a function that [Client.Import] invokes when progress
+// is made.
+// It's similar to other progress function types like [PullProgressFunc].
+type ImportProgressFunc func(ProgressResponse) error
+
+// Import adds the models in a bundle created by [Client.Export]. Layers the
+// server already has are skipped. fn is called each time progress is made on
+// the request and can be used to display a progress bar, etc.
+func (c *Client) Import(ctx context.Context, r io.Reader, fn ImportProgressFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/import", r, func(bts []byte) error {
+		var resp ProgressResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
 // PushProgressFunc is a function that [Client.Push] invokes when progress is
 // made.
 // It's similar to other progress function types like [PullProgressFunc].
@@ -339,6 +382,21 @@ func (c *Client) Create(ctx context.Context, req *CreateRequest, fn CreateProgre
 	})
 }
 
+// Imatrix computes an importance matrix for a model by running it over a
+// calibration text. The matrix is stored as a blob, whose digest is in the
+// final response, to be used with [CreateRequest.Imatrix]. fn is called
+// with the progress of the computation.
+func (c *Client) Imatrix(ctx context.Context, req *ImatrixRequest, fn CreateProgressFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/imatrix", req, func(bts []byte) error {
+		var resp ProgressResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
 // List lists models that are available locally.
 func (c *Client) List(ctx context.Context) (*ListResponse, error) {
 	var lr ListResponse
@@ -348,6 +406,25 @@ func (c *Client) List(ctx context.Context) (*ListResponse, error) {
 	return &lr, nil
 }
 
+// Storage reports the disk usage of the model store.
+func (c *Client) Storage(ctx context.Context) (*StorageResponse, error) {
+	var resp StorageResponse
+	if err := c.do(ctx, http.MethodGet, "/api/storage", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GC removes files from the model store that aren't part of any model. It
+// fails if a pull, create or import is in progress.
+func (c *Client) GC(ctx context.Context, req *GCRequest) (*GCResponse, error) {
+	var resp GCResponse
+	if err := c.do(ctx, http.MethodPost, "/api/gc", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // ListRunning lists running models.
 func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
 	var lr ProcessResponse
@@ -410,6 +487,98 @@ func (c *Client) Embeddings(ctx context.Context, req *EmbeddingRequest) (*Embedd
 	return &resp, nil
 }
 
+// CreateBatch submits a batch of requests to be run in the background.
+// Results are available from /api/batches/{id}/results once requests
+// complete.
+func (c *Client) CreateBatch(ctx context.Context, req *CreateBatchRequest) (*Batch, error) {
+	var resp Batch
+	if err := c.do(ctx, http.MethodPost, "/api/batches", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Batch returns the status of a batch.
+func (c *Client) Batch(ctx context.Context, id string) (*Batch, error) {
+	var resp Batch
+	if err := c.do(ctx, http.MethodGet, "/api/batches/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListBatches lists batches, most recent first.
+func (c *Client) ListBatches(ctx context.Context) (*ListBatchesResponse, error) {
+	var resp ListBatchesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/batches", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelBatch stops a batch. Results of requests that have already completed
+// are kept.
+func (c *Client) CancelBatch(ctx context.Context, id string) (*Batch, error) {
+	var resp Batch
+	if err := c.do(ctx, http.MethodPost, "/api/batches/"+url.PathEscape(id)+"/cancel", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateCollection creates an empty collection of documents.
+func (c *Client) CreateCollection(ctx context.Context, req *CreateCollectionRequest) (*Collection, error) {
+	var resp Collection
+	if err := c.do(ctx, http.MethodPost, "/api/collections", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListCollections lists collections by name.
+func (c *Client) ListCollections(ctx context.Context) (*ListCollectionsResponse, error) {
+	var resp ListCollectionsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/collections", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteCollection deletes a collection and its documents.
+func (c *Client) DeleteCollection(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/collections/"+url.PathEscape(name), nil, nil)
+}
+
+// UpsertDocuments adds documents to a collection, replacing those with the
+// same IDs.
+func (c *Client) UpsertDocuments(ctx context.Context, name string, req *UpsertDocumentsRequest) (*Collection, error) {
+	var resp Collection
+	if err := c.do(ctx, http.MethodPost, "/api/collections/"+url.PathEscape(name)+"/documents", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteDocuments removes documents from a collection. IDs which aren't in
+// the collection are ignored.
+func (c *Client) DeleteDocuments(ctx context.Context, name string, req *DeleteDocumentsRequest) (*Collection, error) {
+	var resp Collection
+	if err := c.do(ctx, http.MethodDelete, "/api/collections/"+url.PathEscape(name)+"/documents", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Query returns the documents of a collection most similar to a text or
+// embedding.
+func (c *Client) Query(ctx context.Context, name string, req *QueryRequest) (*QueryResponse, error) {
+	var resp QueryResponse
+	if err := c.do(ctx, http.MethodPost, "/api/collections/"+url.PathEscape(name)+"/query", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // CreateBlob creates a blob from a file on the server. digest is the
 // expected SHA256 digest of the file, and r represents the file.
 func (c *Client) CreateBlob(ctx context.Context, digest string, r io.Reader) error {
@@ -90,6 +90,17 @@ type GenerateRequest struct {
 	// (request that thinking _not_ be used) and unset (use the old behavior
 	// before this option was introduced)
 	Think *ThinkValue `json:"think,omitempty"`
+
+	// Logprobs requests the log probability of each generated token.
+	Logprobs bool `json:"logprobs,omitempty"`
+
+	// TopLogprobs is the number of most likely alternatives, up to
+	// [MaxTopLogprobs], to return with each token. It implies Logprobs.
+	TopLogprobs int `json:"top_logprobs,omitempty"`
+
+	// Priority is the scheduling class of the request: [PriorityInteractive],
+	// the default, [PriorityBatch] or [PriorityBackground].
+	Priority string `json:"priority,omitempty"`
 }
 
 // ChatRequest describes a request sent by [Client.Chat].
@@ -120,6 +131,37 @@ type ChatRequest struct {
 	// responding. Can be a boolean (true/false) or a string ("high", "medium", "low")
 	// for supported models.
 	Think *ThinkValue `json:"think,omitempty"`
+
+	// Logprobs and TopLogprobs are as in [GenerateRequest].
+	Logprobs    bool `json:"logprobs,omitempty"`
+	TopLogprobs int  `json:"top_logprobs,omitempty"`
+
+	// Priority is as in [GenerateRequest].
+	Priority string `json:"priority,omitempty"`
+}
+
+// Scheduling priorities. Queued requests are served strictly by priority, and
+// round robin between users within a priority.
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+	PriorityBackground  = "background"
+)
+
+// MaxTopLogprobs is the largest number of alternatives returned per token.
+const MaxTopLogprobs = 20
+
+// TokenLogprob is the log probability of a single token.
+type TokenLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+}
+
+// Logprob describes a generated token, its log probability and, when
+// requested, the most likely alternatives at that position.
+type Logprob struct {
+	TokenLogprob
+	TopLogprobs []TokenLogprob `json:"top_logprobs,omitempty"`
 }
 
 type Tools []Tool
@@ -305,6 +347,10 @@ type ChatResponse struct {
 
 	Done bool `json:"done"`
 
+	// Logprobs holds the log probabilities of the tokens in this chunk when
+	// requested with [ChatRequest.Logprobs].
+	Logprobs []Logprob `json:"logprobs,omitempty"`
+
 	Metrics
 }
 
@@ -315,6 +361,11 @@ type Metrics struct {
 	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
 	EvalCount          int           `json:"eval_count,omitempty"`
 	EvalDuration       time.Duration `json:"eval_duration,omitempty"`
+
+	// DraftCount and DraftAcceptedCount report how many tokens a draft
+	// model proposed and how many of them were accepted
+	DraftCount         int `json:"draft_count,omitempty"`
+	DraftAcceptedCount int `json:"draft_accepted_count,omitempty"`
 }
 
 // Options specified in [GenerateRequest].  If you add a new option here, also
@@ -335,6 +386,11 @@ type Options struct {
 	RepeatPenalty    float32  `json:"repeat_penalty,omitempty"`
 	PresencePenalty  float32  `json:"presence_penalty,omitempty"`
 	FrequencyPenalty float32  `json:"frequency_penalty,omitempty"`
+	DRYMultiplier    float32  `json:"dry_multiplier,omitempty"`
+	DRYBase          float32  `json:"dry_base,omitempty"`
+	DRYAllowedLength int      `json:"dry_allowed_length,omitempty"`
+	DRYPenaltyLastN  int      `json:"dry_penalty_last_n,omitempty"`
+	NumDraft         int      `json:"num_draft,omitempty"`
 	Stop             []string `json:"stop,omitempty"`
 }
 
@@ -346,6 +402,14 @@ type Runner struct {
 	MainGPU   int   `json:"main_gpu,omitempty"`
 	UseMMap   *bool `json:"use_mmap,omitempty"`
 	NumThread int   `json:"num_thread,omitempty"`
+
+	// DraftModel names a smaller model with the same vocabulary that is
+	// loaded alongside this one to propose tokens for speculative decoding
+	DraftModel string `json:"draft_model,omitempty"`
+
+	// ImportanceMatrix is set by the server for runners that compute
+	// importance matrices rather than serve requests
+	ImportanceMatrix bool `json:"-"`
 }
 
 // EmbedRequest is the request passed to [Client.Embed].
@@ -364,6 +428,10 @@ type EmbedRequest struct {
 
 	// Options lists model-specific options.
 	Options map[string]any `json:"options"`
+
+	// Priority is the scheduling class of the request, as in
+	// [GenerateRequest]. Embeddings default to [PriorityBatch].
+	Priority string `json:"priority,omitempty"`
 }
 
 // EmbedResponse is the response from [Client.Embed].
@@ -390,6 +458,9 @@ type EmbeddingRequest struct {
 
 	// Options lists model-specific options.
 	Options map[string]any `json:"options"`
+
+	// Priority is as in [EmbedRequest].
+	Priority string `json:"priority,omitempty"`
 }
 
 // EmbeddingResponse is the response from [Client.Embeddings].
@@ -397,6 +468,35 @@ type EmbeddingResponse struct {
 	Embedding []float64 `json:"embedding"`
 }
 
+// ImatrixRequest is the request passed to [Client.Imatrix].
+type ImatrixRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Text is the calibration text the model is run over.
+	Text string `json:"text"`
+
+	// Dataset names the calibration text in the matrix.
+	Dataset string `json:"dataset,omitempty"`
+
+	// ChunkSize is the number of tokens in each chunk of the text. Chunks
+	// are processed independently, each starting with an empty context.
+	// Defaults to 512.
+	ChunkSize int `json:"chunk_size,omitempty"`
+
+	// Chunks limits the number of chunks processed, if positive.
+	Chunks int `json:"chunks,omitempty"`
+
+	Stream *bool `json:"stream,omitempty"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]any `json:"options"`
+}
+
 // CreateRequest is the request passed to [Client.Create].
 type CreateRequest struct {
 	Model    string `json:"model"`
@@ -412,6 +512,18 @@ type CreateRequest struct {
 	Parameters map[string]any    `json:"parameters,omitempty"`
 	Messages   []Message         `json:"messages,omitempty"`
 
+	// Tools are offered to the model in chat requests that don't specify
+	// any tools of their own
+	Tools []Tool `json:"tools,omitempty"`
+
+	// Imatrix is the digest of an importance matrix blob used to guide
+	// quantization
+	Imatrix string `json:"imatrix,omitempty"`
+
+	// DryRun reports the quantization of each tensor and the estimated size
+	// of the model without creating it
+	DryRun bool `json:"dry_run,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 	// Deprecated: use Quantize instead
@@ -455,6 +567,24 @@ type ShowResponse struct {
 	Tensors       []Tensor           `json:"tensors,omitempty"`
 	Capabilities  []model.Capability `json:"capabilities,omitempty"`
 	ModifiedAt    time.Time          `json:"modified_at,omitempty"`
+	Provenance    *Provenance        `json:"provenance,omitempty"`
+}
+
+// Provenance describes who signed a model's manifest.
+type Provenance struct {
+	// Signers are the SHA256 fingerprints of the keys that signed the
+	// manifest.
+	Signers []string `json:"signers,omitempty"`
+
+	// Trusted is true if any signer is in the server's trust store.
+	Trusted bool `json:"trusted"`
+
+	// Policy is the server's policy for models that aren't signed by a
+	// trusted key: "warn", "enforce" or "off".
+	Policy string `json:"policy"`
+
+	// Error describes why the manifest failed verification, if it did.
+	Error string `json:"error,omitempty"`
 }
 
 // CopyRequest is the request passed to [Client.Copy].
@@ -482,6 +612,32 @@ type ProgressResponse struct {
 	Digest    string `json:"digest,omitempty"`
 	Total     int64  `json:"total,omitempty"`
 	Completed int64  `json:"completed,omitempty"`
+
+	// Quantization is the plan of a dry run of [Client.Create]
+	Quantization *QuantizationPlan `json:"quantization,omitempty"`
+}
+
+// QuantizationPlan describes how a model would be quantized.
+type QuantizationPlan struct {
+	Type string `json:"type"`
+
+	// Size is the estimated size of the quantized weights in bytes
+	Size    int64                `json:"size"`
+	Tensors []QuantizationTensor `json:"tensors"`
+}
+
+// QuantizationTensor is the type a tensor would be quantized to.
+type QuantizationTensor struct {
+	Name  string   `json:"name"`
+	Shape []uint64 `json:"shape"`
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Size  int64    `json:"size"`
+}
+
+// ExportRequest is the request passed to [Client.Export].
+type ExportRequest struct {
+	Models []string `json:"models"`
 }
 
 // PushRequest is the request passed to [Client.Push].
@@ -504,6 +660,78 @@ type ListResponse struct {
 // ProcessResponse is the response from [Client.Process].
 type ProcessResponse struct {
 	Models []ProcessModelResponse `json:"models"`
+	Queues []QueueStatus          `json:"queues,omitempty"`
+}
+
+// QueueStatus describes the requests waiting to be scheduled at a priority
+// in [ProcessResponse].
+type QueueStatus struct {
+	Priority string `json:"priority"`
+	Depth    int    `json:"depth"`
+	MaxDepth int    `json:"max_depth"`
+
+	// Users is the number of distinct users with queued requests.
+	Users int `json:"users"`
+
+	// OldestWait is how long the oldest queued request has been waiting and
+	// AverageWait is the recent average time requests waited to be scheduled.
+	OldestWait  time.Duration `json:"oldest_wait"`
+	AverageWait time.Duration `json:"average_wait"`
+}
+
+// StorageResponse is the response from [Client.Storage]. It describes what
+// is using the disk space of the model store.
+type StorageResponse struct {
+	Models []StorageModel `json:"models"`
+
+	// Files are files in the model store which aren't part of any model:
+	// orphaned blobs, partial downloads and KV cache snapshots of models
+	// that no longer exist. [Client.GC] removes them.
+	Files []StorageFile `json:"files,omitempty"`
+
+	// Snapshots is the size of all KV cache snapshots and Size the size of
+	// the whole model store, in bytes
+	Snapshots int64 `json:"snapshots"`
+	Size      int64 `json:"size"`
+}
+
+// StorageModel is the disk usage of a model in [StorageResponse]. Blobs
+// used by other models too are counted as shared.
+type StorageModel struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Unique int64  `json:"unique"`
+	Shared int64  `json:"shared"`
+
+	// Snapshots is the size of the model's KV cache snapshots
+	Snapshots int64 `json:"snapshots,omitempty"`
+}
+
+// Kinds of [StorageFile]
+const (
+	StorageOrphaned = "orphaned"
+	StoragePartial  = "partial"
+	StorageSnapshot = "snapshot"
+)
+
+// StorageFile is a file in the model store which isn't part of a model.
+// Kind is one of StorageOrphaned, StoragePartial or StorageSnapshot.
+type StorageFile struct {
+	Kind   string `json:"kind"`
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// GCRequest is the request passed to [Client.GC].
+type GCRequest struct {
+	// DryRun lists the files that would be removed without removing them
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// GCResponse is the response from [Client.GC].
+type GCResponse struct {
+	Files []StorageFile `json:"files"`
+	Size  int64         `json:"size"`
 }
 
 // ListModelResponse is a single model description in [ListResponse].
@@ -532,6 +760,211 @@ type TokenResponse struct {
 	Token string `json:"token"`
 }
 
+// BatchItem is a single request of a batch. Each line of a batch input file
+// is a BatchItem.
+type BatchItem struct {
+	// CustomID identifies the request's result and must be unique within the
+	// batch.
+	CustomID string `json:"custom_id"`
+
+	// Method is the HTTP method of the request, which must be POST.
+	Method string `json:"method,omitempty"`
+
+	// URL is the path of the endpoint, such as /api/chat or
+	// /v1/chat/completions.
+	URL string `json:"url"`
+
+	// Body is the request, as it would be sent to the endpoint. Streaming is
+	// always disabled.
+	Body json.RawMessage `json:"body"`
+}
+
+// CreateBatchRequest is the request passed to [Client.CreateBatch].
+type CreateBatchRequest struct {
+	Requests []BatchItem       `json:"requests"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Batch statuses
+const (
+	BatchValidating = "validating"
+	BatchInProgress = "in_progress"
+	BatchFinalizing = "finalizing"
+	BatchCompleted  = "completed"
+	BatchFailed     = "failed"
+	BatchCancelling = "cancelling"
+	BatchCancelled  = "cancelled"
+)
+
+// Batch describes a batch of requests that is run in the background.
+type Batch struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+
+	// Endpoint is set when every request of the batch must be made to the
+	// same endpoint.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// InputFileID, OutputFileID and ErrorFileID identify the files holding
+	// the requests of the batch, the results of successful requests and the
+	// results of failed requests.
+	InputFileID  string `json:"input_file_id"`
+	OutputFileID string `json:"output_file_id"`
+	ErrorFileID  string `json:"error_file_id"`
+
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+
+	// Errors is why the batch failed, when its status is [BatchFailed].
+	Errors []BatchError `json:"errors,omitempty"`
+
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	CompletionWindow string            `json:"completion_window,omitempty"`
+
+	CreatedAt    time.Time `json:"created_at"`
+	StartedAt    time.Time `json:"started_at,omitzero"`
+	FinalizingAt time.Time `json:"finalizing_at,omitzero"`
+	CompletedAt  time.Time `json:"completed_at,omitzero"`
+	FailedAt     time.Time `json:"failed_at,omitzero"`
+	CancellingAt time.Time `json:"cancelling_at,omitzero"`
+	CancelledAt  time.Time `json:"cancelled_at,omitzero"`
+}
+
+// BatchRequestCounts counts the requests of a [Batch].
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// BatchError describes a failed batch or request.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Line is the line of the input file that the error is about, if any.
+	Line int `json:"line,omitempty"`
+}
+
+// ListBatchesResponse is the response from [Client.ListBatches].
+type ListBatchesResponse struct {
+	Batches []Batch `json:"batches"`
+}
+
+// BatchResult is the result of a single request of a batch. Each line of a
+// batch's output and error files is a BatchResult.
+type BatchResult struct {
+	ID       string               `json:"id"`
+	CustomID string               `json:"custom_id"`
+	Response *BatchResultResponse `json:"response"`
+	Error    *BatchError          `json:"error"`
+}
+
+// BatchResultResponse is the response to a request of a batch.
+type BatchResultResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// Collection metrics
+const (
+	MetricCosine = "cosine"
+	MetricDot    = "dot"
+)
+
+// CreateCollectionRequest is the request passed to [Client.CreateCollection].
+type CreateCollectionRequest struct {
+	Name string `json:"name"`
+
+	// Model is the embedding model used for documents and queries which are
+	// given as text rather than embeddings.
+	Model string `json:"model,omitempty"`
+
+	// Metric is how documents are scored against queries, [MetricCosine] or
+	// [MetricDot]. It defaults to [MetricCosine].
+	Metric string `json:"metric,omitempty"`
+}
+
+// Collection describes a collection of documents which can be searched by
+// the similarity of their embeddings.
+type Collection struct {
+	Name   string `json:"name"`
+	Model  string `json:"model,omitempty"`
+	Metric string `json:"metric"`
+
+	// Dimensions is the length of the embeddings of the collection, set by
+	// the first document added.
+	Dimensions int `json:"dimensions,omitempty"`
+	Documents  int `json:"documents"`
+
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// ListCollectionsResponse is the response from [Client.ListCollections].
+type ListCollectionsResponse struct {
+	Collections []Collection `json:"collections"`
+}
+
+// Document is a document of a collection.
+type Document struct {
+	ID       string         `json:"id"`
+	Text     string         `json:"text,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+
+	// Embedding is computed from Text with the model of the collection if
+	// it isn't given.
+	Embedding []float32 `json:"embedding,omitempty"`
+}
+
+// UpsertDocumentsRequest is the request passed to [Client.UpsertDocuments].
+type UpsertDocumentsRequest struct {
+	// Documents are added to the collection, replacing documents with the
+	// same ID.
+	Documents []Document `json:"documents"`
+
+	// KeepAlive and Priority apply to embedding documents, as in
+	// [EmbedRequest].
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+	Priority  string    `json:"priority,omitempty"`
+}
+
+// DeleteDocumentsRequest is the request passed to [Client.DeleteDocuments].
+type DeleteDocumentsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// QueryRequest is the request passed to [Client.Query].
+type QueryRequest struct {
+	// Text is embedded with the model of the collection, unless Embedding
+	// is given.
+	Text      string    `json:"text,omitempty"`
+	Embedding []float32 `json:"embedding,omitempty"`
+
+	// K is the number of documents returned, 10 if unset.
+	K int `json:"k,omitempty"`
+
+	// Filter, if set, only matches documents with each of its keys set to
+	// the same value in their metadata.
+	Filter map[string]any `json:"filter,omitempty"`
+
+	// KeepAlive and Priority apply to embedding Text, as in [EmbedRequest].
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+	Priority  string    `json:"priority,omitempty"`
+}
+
+// QueryResult is a document matching a query, without its embedding.
+type QueryResult struct {
+	Document
+	Score float32 `json:"score"`
+}
+
+// QueryResponse is the response from [Client.Query], with the most similar
+// documents first.
+type QueryResponse struct {
+	Results []QueryResult `json:"results"`
+}
+
 // GenerateResponse is the response passed into [GenerateResponseFunc].
 type GenerateResponse struct {
 	// Model is the model name that generated the response.
@@ -557,6 +990,10 @@ type GenerateResponse struct {
 	// can be sent in the next request to keep a conversational memory.
 	Context []int `json:"context,omitempty"`
 
+	// Logprobs holds the log probabilities of the tokens in this chunk when
+	// requested with [GenerateRequest.Logprobs].
+	Logprobs []Logprob `json:"logprobs,omitempty"`
+
 	Metrics
 
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
@@ -605,6 +1042,11 @@ func (m *Metrics) Summary() {
 		fmt.Fprintf(os.Stderr, "eval duration:        %s\n", m.EvalDuration)
 		fmt.Fprintf(os.Stderr, "eval rate:            %.2f tokens/s\n", float64(m.EvalCount)/m.EvalDuration.Seconds())
 	}
+
+	if m.DraftCount > 0 {
+		fmt.Fprintf(os.Stderr, "draft tokens:         %d token(s)\n", m.DraftCount)
+		fmt.Fprintf(os.Stderr, "draft acceptance:     %.2f%%\n", 100*float64(m.DraftAcceptedCount)/float64(m.DraftCount))
+	}
 }
 
 func (opts *Options) FromMap(m map[string]any) error {
@@ -716,6 +1158,11 @@ func DefaultOptions() Options {
 		RepeatPenalty:    1.1,
 		PresencePenalty:  0.0,
 		FrequencyPenalty: 0.0,
+		DRYMultiplier:    0.0,
+		DRYBase:          1.75,
+		DRYAllowedLength: 2,
+		DRYPenaltyLastN:  -1,
+		NumDraft:         8,
 		Seed:             -1,
 
 		Runner: Runner{
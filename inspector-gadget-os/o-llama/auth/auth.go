@@ -90,3 +90,33 @@ func Sign(ctx context.Context, bts []byte) (string, error) {
 	// signature is <pubkey>:<signature>
 	return fmt.Sprintf("%s:%s", bytes.TrimSpace(parts[1]), base64.StdEncoding.EncodeToString(signedData.Blob)), nil
 }
+
+// Verify checks that signature, as returned by [Sign], is a valid signature of
+// bts and returns the public key that made it.
+func Verify(bts []byte, signature string) (ssh.PublicKey, error) {
+	key, sig, ok := strings.Cut(signature, ":")
+	if !ok {
+		return nil, errors.New("malformed signature")
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	publicKey, err := ssh.ParsePublicKey(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	if err := publicKey.Verify(bts, &ssh.Signature{Format: publicKey.Type(), Blob: blob}); err != nil {
+		return nil, err
+	}
+
+	return publicKey, nil
+}
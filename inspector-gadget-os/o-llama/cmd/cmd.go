@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -132,11 +133,30 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		req.Quantize = quantize
 	}
 
+	req.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	imatrixFile, _ := cmd.Flags().GetString("imatrix")
+
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
 	}
 
+	if strings.HasPrefix(imatrixFile, "sha256:") {
+		// computed by ollama imatrix and already a blob
+		req.Imatrix = imatrixFile
+	} else if imatrixFile != "" {
+		digest, err := fileDigest(imatrixFile)
+		if err != nil {
+			return err
+		}
+
+		if _, err := createBlob(cmd, client, imatrixFile, digest, p); err != nil {
+			return err
+		}
+
+		req.Imatrix = digest
+	}
+
 	var g errgroup.Group
 	g.SetLimit(max(runtime.GOMAXPROCS(0)-1, 1))
 
@@ -175,8 +195,13 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 	req.Files = files.Items()
 	req.Adapters = adapters.Items()
 
+	var plan *api.QuantizationPlan
 	bars := make(map[string]*progress.Bar)
 	fn := func(resp api.ProgressResponse) error {
+		if resp.Quantization != nil {
+			plan = resp.Quantization
+		}
+
 		if resp.Digest != "" {
 			bar, ok := bars[resp.Digest]
 			if !ok {
@@ -208,9 +233,53 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if plan != nil {
+		p.StopAndClear()
+		showQuantizationPlan(plan, os.Stdout)
+	}
+
 	return nil
 }
 
+// showQuantizationPlan shows the types tensors would be quantized to by a dry
+// run of create
+func showQuantizationPlan(plan *api.QuantizationPlan, w io.Writer) {
+	fmt.Fprintln(w, " ", "Quantization")
+	table := tablewriter.NewWriter(w)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.SetAutoWrapText(false)
+	for _, t := range plan.Tensors {
+		shape := make([]string, len(t.Shape))
+		for i, dim := range t.Shape {
+			shape[i] = strconv.FormatUint(dim, 10)
+		}
+		table.Append([]string{"", t.Name, "[" + strings.Join(shape, " ") + "]", t.From, t.To, format.HumanBytes(t.Size)})
+	}
+	table.Render()
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "  %s: estimated size %s\n", plan.Type, format.HumanBytes(plan.Size))
+}
+
+// fileDigest returns the digest of the file at path, as used for blobs
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
 func createBlob(cmd *cobra.Command, client *api.Client, path string, digest string, p *progress.Progress) (string, error) {
 	realPath, err := filepath.EvalSymlinks(path)
 	if err != nil {
@@ -614,6 +683,88 @@ func ListRunningHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func StorageHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	storage, err := client.Storage(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, m := range storage.Models {
+		data = append(data, []string{m.Name, format.HumanBytes(m.Size), format.HumanBytes(m.Unique), format.HumanBytes(m.Shared), format.HumanBytes(m.Snapshots)})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "SIZE", "UNIQUE", "SHARED", "SNAPSHOTS"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	var reclaimable int64
+	for _, kind := range []string{api.StorageOrphaned, api.StoragePartial, api.StorageSnapshot} {
+		var count int
+		var size int64
+		for _, f := range storage.Files {
+			if f.Kind == kind {
+				count++
+				size += f.Size
+			}
+		}
+
+		if count > 0 {
+			fmt.Printf("%d %s files using %s\n", count, kind, format.HumanBytes(size))
+			reclaimable += size
+		}
+	}
+
+	fmt.Printf("kv cache snapshots: %s\n", format.HumanBytes(storage.Snapshots))
+	fmt.Printf("total: %s\n", format.HumanBytes(storage.Size))
+	if reclaimable > 0 {
+		fmt.Printf("run 'ollama gc' to reclaim %s\n", format.HumanBytes(reclaimable))
+	}
+
+	return nil
+}
+
+func GCHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.GC(cmd.Context(), &api.GCRequest{DryRun: dryRun})
+	if err != nil {
+		return err
+	}
+
+	action := "removed"
+	if dryRun {
+		action = "would remove"
+	}
+
+	for _, f := range resp.Files {
+		fmt.Printf("%s %s %s (%s)\n", action, f.Kind, f.Digest, format.HumanBytes(f.Size))
+	}
+
+	fmt.Printf("%s %d files, %s\n", action, len(resp.Files), format.HumanBytes(resp.Size))
+	return nil
+}
+
 func DeleteHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -852,6 +1003,25 @@ func showInfo(resp *api.ShowResponse, verbose bool, w io.Writer) error {
 		})
 	}
 
+	if resp.Provenance != nil {
+		tableRender("Provenance", func() (rows [][]string) {
+			p := resp.Provenance
+			switch {
+			case p.Error != "":
+				rows = append(rows, []string{"", "signature", "invalid: " + p.Error})
+			case len(p.Signers) == 0:
+				rows = append(rows, []string{"", "signature", "unsigned"})
+			default:
+				for _, signer := range p.Signers {
+					rows = append(rows, []string{"", "signed by", signer})
+				}
+				rows = append(rows, []string{"", "trusted", strconv.FormatBool(p.Trusted)})
+			}
+			rows = append(rows, []string{"", "policy", p.Policy})
+			return
+		})
+	}
+
 	head := func(s string, n int) (rows [][]string) {
 		scanner := bufio.NewScanner(strings.NewReader(s))
 		count := 0
@@ -975,6 +1145,117 @@ func PullHandler(cmd *cobra.Command, args []string) error {
 	return client.Pull(cmd.Context(), &request, fn)
 }
 
+func ExportHandler(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	if output == "" || output == "-" {
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			return errors.New("refusing to write a bundle to a terminal; use --output to name a file")
+		}
+
+		output = "-"
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	request := api.ExportRequest{Models: args}
+	if output == "-" {
+		return client.Export(cmd.Context(), &request, os.Stdout)
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	spinner := progress.NewSpinner(fmt.Sprintf("exporting %s", strings.Join(args, ", ")))
+	p.Add("", spinner)
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := client.Export(cmd.Context(), &request, f); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	spinner.Stop()
+	return nil
+}
+
+func ImportHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		if err := importBundle(cmd.Context(), client, arg); err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+	}
+
+	return nil
+}
+
+func importBundle(ctx context.Context, client *api.Client, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	bars := make(map[string]*progress.Bar)
+
+	var status string
+	var spinner *progress.Spinner
+
+	fn := func(resp api.ProgressResponse) error {
+		if resp.Digest != "" {
+			if spinner != nil {
+				spinner.Stop()
+			}
+
+			bar, ok := bars[resp.Digest]
+			if !ok {
+				name := strings.TrimPrefix(resp.Digest, "sha256:")
+				bar = progress.NewBar(fmt.Sprintf("importing %s:", name[:min(12, len(name))]), resp.Total, resp.Completed)
+				bars[resp.Digest] = bar
+				p.Add(resp.Digest, bar)
+			}
+
+			bar.Set(resp.Completed)
+		} else if status != resp.Status {
+			if spinner != nil {
+				spinner.Stop()
+			}
+
+			status = resp.Status
+			spinner = progress.NewSpinner(status)
+			p.Add(status, spinner)
+		}
+
+		return nil
+	}
+
+	return client.Import(ctx, f, fn)
+}
+
 type generateContextKey string
 
 type runOptions struct {
@@ -1477,6 +1758,8 @@ func NewCLI() *cobra.Command {
 
 	createCmd.Flags().StringP("file", "f", "", "Name of the Modelfile (default \"Modelfile\")")
 	createCmd.Flags().StringP("quantize", "q", "", "Quantize model to this level (e.g. q4_K_M)")
+	createCmd.Flags().String("imatrix", "", "Importance matrix file or digest to guide quantization (see ollama imatrix)")
+	createCmd.Flags().Bool("dry-run", false, "Show how the model would be quantized without creating it")
 
 	showCmd := &cobra.Command{
 		Use:     "show MODEL",
@@ -1560,6 +1843,96 @@ func NewCLI() *cobra.Command {
 		PreRunE: checkServerHeartbeat,
 		RunE:    ListRunningHandler,
 	}
+
+	duCmd := &cobra.Command{
+		Use:     "du",
+		Short:   "Show disk usage of models",
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    StorageHandler,
+	}
+
+	gcCmd := &cobra.Command{
+		Use:     "gc",
+		Short:   "Remove files not used by any model",
+		Long:    "Remove blobs not used by any model, abandoned partial downloads and KV cache snapshots of models that no longer exist.",
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    GCHandler,
+	}
+
+	gcCmd.Flags().Bool("dry-run", false, "List the files that would be removed without removing them")
+
+	exportCmd := &cobra.Command{
+		Use:     "export MODEL [MODEL...]",
+		Short:   "Export models to a bundle for offline machines",
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ExportHandler,
+	}
+
+	exportCmd.Flags().StringP("output", "o", "", "Write the bundle to a file")
+
+	importCmd := &cobra.Command{
+		Use:     "import FILE [FILE...]",
+		Short:   "Import models from a bundle",
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ImportHandler,
+	}
+
+	ggufCmd := &cobra.Command{
+		Use:   "gguf",
+		Short: "Inspect and edit GGUF files",
+	}
+
+	ggufInspectCmd := &cobra.Command{
+		Use:   "inspect FILE|MODEL",
+		Short: "Show the metadata and tensors of a GGUF file or local model",
+		Args:  cobra.ExactArgs(1),
+		RunE:  GGUFInspectHandler,
+	}
+
+	ggufInspectCmd.Flags().Bool("json", false, "Output as JSON")
+	ggufInspectCmd.Flags().BoolP("verbose", "v", false, "Show arrays in full")
+
+	ggufSetKVCmd := &cobra.Command{
+		Use:   "set-kv FILE KEY VALUE",
+		Short: "Set a metadata key of a GGUF file",
+		Long:  "Set a metadata key of a GGUF file. Values of array and non-string types are given as JSON. Tensor data is left unchanged.",
+		Args:  cobra.ExactArgs(3),
+		RunE:  GGUFSetKVHandler,
+	}
+
+	ggufSetKVCmd.Flags().StringP("type", "t", "", "Type of the value (e.g. uint32, []string; default: the key's current type, or string)")
+	ggufSetKVCmd.Flags().StringP("output", "o", "", "Write to a new file instead of in place")
+
+	ggufRemoveKVCmd := &cobra.Command{
+		Use:   "rm-kv FILE KEY [KEY...]",
+		Short: "Remove metadata keys from a GGUF file",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  GGUFRemoveKVHandler,
+	}
+
+	ggufRemoveKVCmd.Flags().StringP("output", "o", "", "Write to a new file instead of in place")
+
+	ggufCmd.AddCommand(ggufInspectCmd, ggufSetKVCmd, ggufRemoveKVCmd)
+
+	imatrixCmd := &cobra.Command{
+		Use:     "imatrix MODEL",
+		Short:   "Compute an importance matrix for quantization",
+		Long:    "Compute an importance matrix for quantization by running a model over a calibration text on the server. Use its digest with ollama create --imatrix to keep the weights that matter most for the text more precise.",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ImatrixHandler,
+	}
+
+	imatrixCmd.Flags().StringP("file", "f", "", "Calibration text")
+	imatrixCmd.Flags().Int("ctx-size", 512, "Number of tokens in each chunk of the text")
+	imatrixCmd.Flags().Int("chunks", 0, "Maximum number of chunks to process (default: all)")
+	imatrixCmd.Flags().Int("num-gpu", 0, "Number of layers to offload to GPUs (default: as many as fit)")
+	imatrixCmd.MarkFlagRequired("file")
+
 	copyCmd := &cobra.Command{
 		Use:     "cp SOURCE DESTINATION",
 		Short:   "Copy a model",
@@ -1601,13 +1974,21 @@ func NewCLI() *cobra.Command {
 		pushCmd,
 		listCmd,
 		psCmd,
+		duCmd,
+		gcCmd,
 		copyCmd,
 		deleteCmd,
+		exportCmd,
+		importCmd,
+		ggufInspectCmd,
+		imatrixCmd,
 		serveCmd,
 	} {
 		switch cmd {
 		case runCmd:
 			appendEnvDocs(cmd, []envconfig.EnvVar{envVars["OLLAMA_HOST"], envVars["OLLAMA_NOHISTORY"]})
+		case ggufInspectCmd:
+			appendEnvDocs(cmd, []envconfig.EnvVar{envVars["OLLAMA_MODELS"]})
 		case serveCmd:
 			appendEnvDocs(cmd, []envconfig.EnvVar{
 				envVars["OLLAMA_DEBUG"],
@@ -1615,13 +1996,25 @@ func NewCLI() *cobra.Command {
 				envVars["OLLAMA_KEEP_ALIVE"],
 				envVars["OLLAMA_MAX_LOADED_MODELS"],
 				envVars["OLLAMA_MAX_QUEUE"],
+				envVars["OLLAMA_MAX_QUEUE_INTERACTIVE"],
+				envVars["OLLAMA_MAX_QUEUE_BATCH"],
+				envVars["OLLAMA_MAX_QUEUE_BACKGROUND"],
+				envVars["OLLAMA_BATCH_PARALLEL"],
+				envVars["OLLAMA_EMBED_CACHE_SIZE"],
 				envVars["OLLAMA_MODELS"],
 				envVars["OLLAMA_NUM_PARALLEL"],
 				envVars["OLLAMA_NOPRUNE"],
+				envVars["OLLAMA_NO_RESPONSE_STORE"],
+				envVars["OLLAMA_REGISTRY_MIRROR"],
+				envVars["OLLAMA_REGISTRY_SERVE"],
+				envVars["OLLAMA_SIGNATURE_POLICY"],
+				envVars["OLLAMA_TRUSTED_KEYS"],
+				envVars["OLLAMA_VERIFY_ON_LOAD"],
 				envVars["OLLAMA_ORIGINS"],
 				envVars["OLLAMA_SCHED_SPREAD"],
 				envVars["OLLAMA_FLASH_ATTENTION"],
 				envVars["OLLAMA_KV_CACHE_TYPE"],
+				envVars["OLLAMA_KV_SNAPSHOT_SIZE"],
 				envVars["OLLAMA_LLM_LIBRARY"],
 				envVars["OLLAMA_GPU_OVERHEAD"],
 				envVars["OLLAMA_LOAD_TIMEOUT"],
@@ -1641,8 +2034,14 @@ func NewCLI() *cobra.Command {
 		pushCmd,
 		listCmd,
 		psCmd,
+		duCmd,
+		gcCmd,
 		copyCmd,
 		deleteCmd,
+		exportCmd,
+		importCmd,
+		ggufCmd,
+		imatrixCmd,
 		runnerCmd,
 	)
 
@@ -15,6 +15,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/types/model"
 )
 
@@ -289,6 +290,39 @@ Weigh anchor!
 			t.Errorf("unexpected output (-want +got):\n%s", diff)
 		}
 	})
+
+	t.Run("provenance", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := showInfo(&api.ShowResponse{
+			Details: api.ModelDetails{
+				Family:            "test",
+				ParameterSize:     "7B",
+				QuantizationLevel: "FP16",
+			},
+			Provenance: &api.Provenance{
+				Signers: []string{"SHA256:abc"},
+				Trusted: true,
+				Policy:  "warn",
+			},
+		}, false, &b); err != nil {
+			t.Fatal(err)
+		}
+
+		expect := "  Model\n" +
+			"    architecture    test    \n" +
+			"    parameters      7B      \n" +
+			"    quantization    FP16    \n" +
+			"\n" +
+			"  Provenance\n" +
+			"    signed by    SHA256:abc    \n" +
+			"    trusted      true          \n" +
+			"    policy       warn          \n" +
+			"\n"
+
+		if diff := cmp.Diff(expect, b.String()); diff != "" {
+			t.Errorf("unexpected output (-want +got):\n%s", diff)
+		}
+	})
 }
 
 func TestDeleteHandler(t *testing.T) {
@@ -915,3 +949,25 @@ func TestNewCreateRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestShowQuantizationPlan(t *testing.T) {
+	var b bytes.Buffer
+	showQuantizationPlan(&api.QuantizationPlan{
+		Type: "Q4_K_M",
+		Size: 3 * format.MegaByte,
+		Tensors: []api.QuantizationTensor{
+			{Name: "blk.0.attn_q.weight", Shape: []uint64{4096, 4096}, From: "F16", To: "Q4_K", Size: 2 * format.MegaByte},
+			{Name: "blk.0.attn_v.weight", Shape: []uint64{4096, 1024}, From: "F16", To: "Q6_K", Size: format.MegaByte},
+		},
+	}, &b)
+
+	expect := "  Quantization\n" +
+		"    blk.0.attn_q.weight    [4096 4096]    F16    Q4_K    2 MB    \n" +
+		"    blk.0.attn_v.weight    [4096 1024]    F16    Q6_K    1 MB    \n" +
+		"\n" +
+		"  Q4_K_M: estimated size 3 MB\n"
+
+	if diff := cmp.Diff(expect, b.String()); diff != "" {
+		t.Errorf("unexpected output (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,422 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/fs/gguf"
+	"github.com/ollama/ollama/server"
+)
+
+// ggufInfo is the output of `ollama gguf inspect`
+type ggufInfo struct {
+	Version      uint32         `json:"version"`
+	Metadata     []ggufMetadata `json:"metadata"`
+	Tensors      []ggufTensor   `json:"tensors"`
+	Quantization []ggufLayer    `json:"quantization"`
+	ChatTemplate string         `json:"chat_template,omitempty"`
+}
+
+type ggufMetadata struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value any    `json:"value,omitempty"`
+
+	// Length is the number of elements of array values, which are only
+	// included in full when verbose
+	Length int `json:"length,omitempty"`
+}
+
+type ggufTensor struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	Shape []uint64 `json:"shape"`
+	Size  int64    `json:"size"`
+}
+
+// ggufLayer counts the tensors of each type in a layer
+type ggufLayer struct {
+	Layer string         `json:"layer"`
+	Types map[string]int `json:"types"`
+}
+
+// ggufMaxArrayLen is the number of elements of arrays shown when not verbose
+const ggufMaxArrayLen = 8
+
+// ggufPath returns the path of a GGUF file, or of the weights of a local model
+// if no such file exists.
+func ggufPath(name string) (string, error) {
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+
+	m, err := server.GetModel(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no file or model named %q", name)
+	} else if err != nil {
+		return "", err
+	}
+
+	return m.ModelPath, nil
+}
+
+func ggufOpen(name string) (*gguf.File, error) {
+	path, err := ggufPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return gguf.Open(path)
+}
+
+func ggufInspect(f *gguf.File, verbose bool) ggufInfo {
+	info := ggufInfo{Version: f.Version}
+	for _, kv := range f.KeyValues() {
+		md := ggufMetadata{Key: kv.Key, Type: fmt.Sprintf("%T", kv.Interface()), Value: kv.Interface()}
+		if v := reflect.ValueOf(md.Value); v.Kind() == reflect.Slice {
+			md.Length = v.Len()
+			if !verbose && md.Length > ggufMaxArrayLen {
+				md.Value = nil
+			}
+		}
+
+		if kv.Key == "tokenizer.chat_template" {
+			info.ChatTemplate = kv.String()
+		}
+
+		info.Metadata = append(info.Metadata, md)
+	}
+
+	layers := make(map[string]map[string]int)
+	for _, t := range f.TensorInfos() {
+		info.Tensors = append(info.Tensors, ggufTensor{
+			Name:  t.Name,
+			Type:  t.Type.String(),
+			Shape: t.Shape,
+			Size:  t.NumBytes(),
+		})
+
+		layer := "other"
+		if strings.HasPrefix(t.Name, "blk.") {
+			layer, _, _ = strings.Cut(t.Name[len("blk."):], ".")
+			layer = "blk." + layer
+		}
+
+		if layers[layer] == nil {
+			layers[layer] = make(map[string]int)
+		}
+		layers[layer][t.Type.String()]++
+	}
+
+	for layer, types := range layers {
+		info.Quantization = append(info.Quantization, ggufLayer{Layer: layer, Types: types})
+	}
+
+	// order layers by number, with other tensors last
+	slices.SortFunc(info.Quantization, func(a, b ggufLayer) int {
+		an, aerr := strconv.Atoi(strings.TrimPrefix(a.Layer, "blk."))
+		bn, berr := strconv.Atoi(strings.TrimPrefix(b.Layer, "blk."))
+		switch {
+		case aerr != nil && berr != nil:
+			return strings.Compare(a.Layer, b.Layer)
+		case aerr != nil:
+			return 1
+		case berr != nil:
+			return -1
+		default:
+			return an - bn
+		}
+	})
+
+	return info
+}
+
+func showGGUFInfo(info ggufInfo, w io.Writer) {
+	tableRender := func(header string, rows [][]string) {
+		fmt.Fprintln(w, " ", header)
+		table := tablewriter.NewWriter(w)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("    ")
+		table.SetAutoWrapText(false)
+		table.AppendBulk(rows)
+		table.Render()
+		fmt.Fprintln(w)
+	}
+
+	rows := [][]string{{"", "version", strconv.FormatUint(uint64(info.Version), 10), ""}}
+	for _, md := range info.Metadata {
+		rows = append(rows, []string{"", md.Key, md.Type, ggufFormatValue(md)})
+	}
+	tableRender("Metadata", rows)
+
+	rows = nil
+	for _, t := range info.Tensors {
+		shape := make([]string, len(t.Shape))
+		for i, dim := range t.Shape {
+			shape[i] = strconv.FormatUint(dim, 10)
+		}
+		rows = append(rows, []string{"", t.Name, t.Type, "[" + strings.Join(shape, " ") + "]", format.HumanBytes(t.Size)})
+	}
+	tableRender("Tensors", rows)
+
+	var types []string
+	for _, layer := range info.Quantization {
+		for t := range layer.Types {
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	slices.Sort(types)
+
+	rows = [][]string{append([]string{"", "layer"}, types...)}
+	for _, layer := range info.Quantization {
+		row := []string{"", layer.Layer}
+		for _, t := range types {
+			if n := layer.Types[t]; n > 0 {
+				row = append(row, strconv.Itoa(n))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		rows = append(rows, row)
+	}
+	tableRender("Quantization", rows)
+
+	if info.ChatTemplate != "" {
+		fmt.Fprintln(w, " ", "Chat template")
+		for line := range strings.Lines(info.ChatTemplate) {
+			fmt.Fprintln(w, "   ", strings.TrimRight(line, "\n"))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// ggufFormatValue formats a metadata value for the metadata table
+func ggufFormatValue(md ggufMetadata) string {
+	const maxLen = 60
+
+	switch v := md.Value.(type) {
+	case nil:
+		return fmt.Sprintf("[... %d items]", md.Length)
+	case string:
+		s := strconv.Quote(v)
+		if len(s) > maxLen {
+			s = s[:maxLen] + `..."`
+		}
+		return s
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func GGUFInspectHandler(cmd *cobra.Command, args []string) error {
+	f, err := ggufOpen(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return err
+	}
+
+	info := ggufInspect(f, verbose)
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	showGGUFInfo(info, os.Stdout)
+	return nil
+}
+
+// ggufParsers parse values of set-kv by their type, as shown by inspect
+var ggufParsers = map[string]func(string) (any, error){
+	"string":    func(s string) (any, error) { return s, nil },
+	"bool":      parseJSON[bool],
+	"uint8":     parseJSON[uint8],
+	"int8":      parseJSON[int8],
+	"uint16":    parseJSON[uint16],
+	"int16":     parseJSON[int16],
+	"uint32":    parseJSON[uint32],
+	"int32":     parseJSON[int32],
+	"uint64":    parseJSON[uint64],
+	"int64":     parseJSON[int64],
+	"float32":   parseJSON[float32],
+	"float64":   parseJSON[float64],
+	"[]string":  parseJSON[[]string],
+	"[]bool":    parseJSON[[]bool],
+	"[]uint8":   parseJSON[[]uint8],
+	"[]int8":    parseJSON[[]int8],
+	"[]uint16":  parseJSON[[]uint16],
+	"[]int16":   parseJSON[[]int16],
+	"[]uint32":  parseJSON[[]uint32],
+	"[]int32":   parseJSON[[]int32],
+	"[]uint64":  parseJSON[[]uint64],
+	"[]int64":   parseJSON[[]int64],
+	"[]float32": parseJSON[[]float32],
+	"[]float64": parseJSON[[]float64],
+}
+
+func parseJSON[T any](s string) (any, error) {
+	var t T
+	if err := json.Unmarshal([]byte(s), &t); err != nil {
+		return nil, fmt.Errorf("invalid %T value %q", t, s)
+	}
+	return t, nil
+}
+
+// ggufRewrite rewrites the metadata of the GGUF file at path with fn, writing
+// the result to output, or back to path if output is empty. Tensor data is
+// copied unchanged.
+func ggufRewrite(path, output string, fn func([]gguf.KeyValue) ([]gguf.KeyValue, error)) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// model blobs are named by their digest, so editing them in place would
+	// corrupt the model
+	if blobs := filepath.Join(envconfig.Models(), "blobs"); output == "" && strings.HasPrefix(abs, blobs+string(filepath.Separator)) {
+		return fmt.Errorf("%s is a model blob; use --output to write a copy", path)
+	}
+
+	f, err := gguf.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var kvs []gguf.KeyValue
+	for _, kv := range f.KeyValues() {
+		kvs = append(kvs, kv)
+	}
+
+	kvs, err = fn(kvs)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file next to the output so it can be renamed into
+	// place once complete
+	dst := cmp.Or(output, path)
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.partial")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// CreateTemp makes the file private; keep the permissions of the file
+	// being replaced, or of the source for a new output
+	info, err := os.Stat(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		info, err = os.Stat(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if err := f.Rewrite(tmp, kvs); err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+func GGUFSetKVHandler(cmd *cobra.Command, args []string) error {
+	path, key, value := args[0], args[1], args[2]
+
+	typ, err := cmd.Flags().GetString("type")
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	return ggufRewrite(path, output, func(kvs []gguf.KeyValue) ([]gguf.KeyValue, error) {
+		i := slices.IndexFunc(kvs, func(kv gguf.KeyValue) bool { return kv.Key == key })
+		if typ == "" {
+			// keep the type of existing keys; new keys are strings by default
+			typ = "string"
+			if i >= 0 {
+				typ = fmt.Sprintf("%T", kvs[i].Interface())
+			}
+		}
+
+		parse, ok := ggufParsers[typ]
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %q", typ)
+		}
+
+		v, err := parse(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if i >= 0 {
+			kvs[i] = gguf.NewKeyValue(key, v)
+		} else {
+			kvs = append(kvs, gguf.NewKeyValue(key, v))
+		}
+
+		return kvs, nil
+	})
+}
+
+func GGUFRemoveKVHandler(cmd *cobra.Command, args []string) error {
+	path, keys := args[0], args[1:]
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	return ggufRewrite(path, output, func(kvs []gguf.KeyValue) ([]gguf.KeyValue, error) {
+		for _, key := range keys {
+			i := slices.IndexFunc(kvs, func(kv gguf.KeyValue) bool { return kv.Key == key })
+			if i < 0 {
+				return nil, fmt.Errorf("key %q not found", key)
+			}
+
+			kvs = slices.Delete(kvs, i, i+1)
+		}
+
+		return kvs, nil
+	})
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/fs/gguf"
+)
+
+func createGGUF(t *testing.T, dir string) string {
+	t.Helper()
+
+	p := filepath.Join(dir, "model.gguf")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	kv := ggml.KV{
+		"general.architecture":    "llama",
+		"llama.block_count":       uint32(2),
+		"llama.context_length":    uint32(2048),
+		"tokenizer.chat_template": "{{ .Prompt }}",
+		"tokenizer.ggml.tokens":   []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"},
+	}
+
+	tensors := []*ggml.Tensor{
+		{Name: "token_embd.weight", Kind: 0, Shape: []uint64{4, 9}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{1}, 4*4*9))},
+		{Name: "blk.0.attn_q.weight", Kind: 1, Shape: []uint64{4, 4}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{2}, 2*4*4))},
+		{Name: "blk.0.attn_norm.weight", Kind: 0, Shape: []uint64{4}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{3}, 4*4))},
+		{Name: "blk.1.attn_q.weight", Kind: 1, Shape: []uint64{4, 4}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{4}, 2*4*4))},
+	}
+
+	if err := ggml.WriteGGUF(f, kv, tensors); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func runGGUF(t *testing.T, args ...string) error {
+	t.Helper()
+	cmd := NewCLI()
+	cmd.SetArgs(append([]string{"gguf"}, args...))
+	return cmd.Execute()
+}
+
+func TestGGUFInspect(t *testing.T) {
+	f, err := gguf.Open(createGGUF(t, t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	info := ggufInspect(f, false)
+	if info.ChatTemplate != "{{ .Prompt }}" {
+		t.Errorf("expected chat template, got %q", info.ChatTemplate)
+	}
+
+	for _, md := range info.Metadata {
+		switch md.Key {
+		case "llama.context_length":
+			if md.Type != "uint32" || md.Value != uint32(2048) {
+				t.Errorf("unexpected %+v", md)
+			}
+		case "tokenizer.ggml.tokens":
+			if md.Type != "[]string" || md.Length != 9 || md.Value != nil {
+				t.Errorf("expected elided array, got %+v", md)
+			}
+		}
+	}
+
+	if diff := cmp.Diff([]ggufLayer{
+		{Layer: "blk.0", Types: map[string]int{"f16": 1, "f32": 1}},
+		{Layer: "blk.1", Types: map[string]int{"f16": 1}},
+		{Layer: "other", Types: map[string]int{"f32": 1}},
+	}, info.Quantization); diff != "" {
+		t.Errorf("quantization mismatch (-want +got):\n%s", diff)
+	}
+
+	var b bytes.Buffer
+	showGGUFInfo(info, &b)
+	for _, s := range []string{
+		"llama.context_length       uint32      2048",
+		"tokenizer.ggml.tokens      []string    [... 9 items]",
+		"blk.0.attn_q.weight       f16    [4 4]    32 B",
+		"layer    f16    f32",
+		"blk.1    1      -",
+		"  Chat template\n    {{ .Prompt }}",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected %q in output:\n%s", s, b.String())
+		}
+	}
+
+	if info := ggufInspect(f, true); info.Metadata[len(info.Metadata)-1].Value == nil {
+		t.Error("expected arrays in full when verbose")
+	}
+}
+
+func TestGGUFEdit(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	p := createGGUF(t, t.TempDir())
+	before, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(p, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runGGUF(t, "set-kv", p, "llama.context_length", "8192"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runGGUF(t, "set-kv", p, "tokenizer.chat_template", "{{ .System }} {{ .Prompt }}"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runGGUF(t, "set-kv", p, "tokenizer.ggml.eos_token_ids", "[1, 2]", "--type", "[]int32"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runGGUF(t, "rm-kv", p, "tokenizer.ggml.tokens"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := gguf.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if kv := f.KeyValue("context_length"); kv.Uint() != 8192 {
+		t.Errorf("expected context length 8192, got %v", kv.Interface())
+	}
+
+	if s := f.KeyValue("tokenizer.chat_template").String(); s != "{{ .System }} {{ .Prompt }}" {
+		t.Errorf("unexpected chat template %q", s)
+	}
+
+	if diff := cmp.Diff([]int64{1, 2}, f.KeyValue("tokenizer.ggml.eos_token_ids").Ints()); diff != "" {
+		t.Errorf("eos token ids mismatch (-want +got):\n%s", diff)
+	}
+
+	if f.KeyValue("tokenizer.ggml.tokens").Valid() {
+		t.Error("expected tokens to be removed")
+	}
+
+	// editing in place keeps the file's permissions
+	if info, err := os.Stat(p); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o640 {
+		t.Errorf("expected mode 0640, got %v", info.Mode().Perm())
+	}
+
+	// tensor data is unchanged
+	after, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, r, err := f.TensorReader("blk.1.attn_q.weight")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 2*4*4)
+	if _, err := r.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, bytes.Repeat([]byte{4}, 2*4*4)) {
+		t.Errorf("tensor data changed: %v", data)
+	}
+
+	// the data section is copied as is
+	if !bytes.HasSuffix(after, before[len(before)-2*4*4:]) {
+		t.Error("expected data section to be unchanged")
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		if err := runGGUF(t, "set-kv", p, "llama.context_length", "big"); err == nil {
+			t.Error("expected error for invalid value")
+		}
+
+		if err := runGGUF(t, "set-kv", p, "general.name", "x", "--type", "string8"); err == nil {
+			t.Error("expected error for unsupported type")
+		}
+
+		if err := runGGUF(t, "rm-kv", p, "does.not.exist"); err == nil {
+			t.Error("expected error for missing key")
+		}
+
+		blob := filepath.Join(os.Getenv("OLLAMA_MODELS"), "blobs", "sha256-0000")
+		if err := os.MkdirAll(filepath.Dir(blob), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(blob, before, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := runGGUF(t, "rm-kv", blob, "tokenizer.ggml.tokens"); err == nil || !strings.Contains(err.Error(), "model blob") {
+			t.Errorf("expected error editing blob, got %v", err)
+		}
+
+		out := filepath.Join(t.TempDir(), "copy.gguf")
+		if err := runGGUF(t, "rm-kv", blob, "tokenizer.ggml.tokens", "-o", out); err != nil {
+			t.Fatal(err)
+		}
+
+		if bts, _ := os.ReadFile(blob); !bytes.Equal(bts, before) {
+			t.Error("expected blob to be unchanged")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/progress"
+)
+
+func ImatrixHandler(cmd *cobra.Command, args []string) error {
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return err
+	}
+
+	chunkSize, err := cmd.Flags().GetInt("ctx-size")
+	if err != nil {
+		return err
+	}
+
+	chunks, err := cmd.Flags().GetInt("chunks")
+	if err != nil {
+		return err
+	}
+
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	req := api.ImatrixRequest{
+		Model:     args[0],
+		Text:      string(text),
+		Dataset:   filepath.Base(file),
+		ChunkSize: chunkSize,
+		Chunks:    chunks,
+	}
+
+	if cmd.Flags().Changed("num-gpu") {
+		numGPU, err := cmd.Flags().GetInt("num-gpu")
+		if err != nil {
+			return err
+		}
+		req.Options = map[string]any{"num_gpu": numGPU}
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	spinner := progress.NewSpinner("loading model")
+	p.Add("", spinner)
+
+	var bar *progress.Bar
+	var digest string
+	if err := client.Imatrix(cmd.Context(), &req, func(resp api.ProgressResponse) error {
+		if resp.Total > 0 {
+			if bar == nil {
+				spinner.Stop()
+				bar = progress.NewBar(resp.Status, resp.Total, 0)
+				p.Add("", bar)
+			}
+			bar.Set(resp.Completed)
+		}
+
+		digest = resp.Digest
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	p.StopAndClear()
+	fmt.Printf("computed importance matrix %s\n", digest)
+	fmt.Printf("use it with: ollama create --quantize TYPE --imatrix %s MODEL\n", digest)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"math"
 	"net"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -79,6 +80,101 @@ func AllowedOrigins() (origins []string) {
 	return origins
 }
 
+// TrustedUserProxies returns the addresses allowed to set the X-Ollama-User
+// header, which identifies the user a request is made on behalf of for fair
+// queuing. It can be configured via the OLLAMA_TRUSTED_USER_PROXIES
+// environment variable as a comma separated list of addresses or CIDR
+// prefixes. Default is loopback only.
+func TrustedUserProxies() (prefixes []netip.Prefix) {
+	s := Var("OLLAMA_TRUSTED_USER_PROXIES")
+	if s == "" {
+		s = "127.0.0.0/8,::1/128"
+	}
+
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(p)
+			if aerr != nil {
+				slog.Warn("invalid trusted user proxy, ignoring", "OLLAMA_TRUSTED_USER_PROXIES", p, "error", err)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes
+}
+
+// RegistryMirror returns the base URL of an Ollama server to pull models from
+// before trying their registry. It can be configured via the
+// OLLAMA_REGISTRY_MIRROR environment variable, e.g. http://10.0.0.2:11434.
+// The scheme defaults to http.
+func RegistryMirror() *url.URL {
+	s := strings.TrimSpace(Var("OLLAMA_REGISTRY_MIRROR"))
+	if s == "" {
+		return nil
+	}
+
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		slog.Warn("invalid registry mirror, ignoring", "OLLAMA_REGISTRY_MIRROR", s, "error", err)
+		return nil
+	}
+
+	return u
+}
+
+// Signature policies for models that aren't signed by a trusted key
+const (
+	SignaturePolicyOff     = "off"
+	SignaturePolicyWarn    = "warn"
+	SignaturePolicyEnforce = "enforce"
+)
+
+// SignaturePolicy returns what to do with models that aren't signed by a
+// trusted key: "warn" (the default) logs a warning, "enforce" refuses them and
+// "off" skips verification. It can be configured via the
+// OLLAMA_SIGNATURE_POLICY environment variable.
+func SignaturePolicy() string {
+	switch s := strings.ToLower(strings.TrimSpace(Var("OLLAMA_SIGNATURE_POLICY"))); s {
+	case "":
+		return SignaturePolicyWarn
+	case SignaturePolicyOff, SignaturePolicyWarn, SignaturePolicyEnforce:
+		return s
+	default:
+		slog.Warn("invalid signature policy, using warn", "OLLAMA_SIGNATURE_POLICY", s)
+		return SignaturePolicyWarn
+	}
+}
+
+// TrustedKeys returns the path of the file of public keys trusted to sign
+// models, in authorized_keys format. It can be configured via the
+// OLLAMA_TRUSTED_KEYS environment variable. Default is
+// $HOME/.ollama/trusted_keys.
+func TrustedKeys() string {
+	if s := Var("OLLAMA_TRUSTED_KEYS"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".ollama", "trusted_keys")
+}
+
 // Models returns the path to the models directory. Models directory can be configured via the OLLAMA_MODELS environment variable.
 // Default is $HOME/.ollama/models
 func Models() string {
@@ -173,6 +269,12 @@ var (
 	NoHistory = Bool("OLLAMA_NOHISTORY")
 	// NoPrune disables pruning of model blobs on startup.
 	NoPrune = Bool("OLLAMA_NOPRUNE")
+	// NoResponseStore disables storing responses of the OpenAI Responses API.
+	NoResponseStore = Bool("OLLAMA_NO_RESPONSE_STORE")
+	// RegistryServe serves local models to other instances as a read-only registry.
+	RegistryServe = Bool("OLLAMA_REGISTRY_SERVE")
+	// VerifyOnLoad verifies the signatures and layer digests of models each time they are loaded.
+	VerifyOnLoad = Bool("OLLAMA_VERIFY_ON_LOAD")
 	// SchedSpread allows scheduling models across all GPUs.
 	SchedSpread = Bool("OLLAMA_SCHED_SPREAD")
 	// IntelGPU enables experimental Intel GPU detection.
@@ -224,6 +326,19 @@ var (
 	MaxRunners = Uint("OLLAMA_MAX_LOADED_MODELS", 0)
 	// MaxQueue sets the maximum number of queued requests. MaxQueue can be configured via the OLLAMA_MAX_QUEUE environment variable.
 	MaxQueue = Uint("OLLAMA_MAX_QUEUE", 512)
+	// MaxQueueInteractive, MaxQueueBatch and MaxQueueBackground set the maximum number of queued requests of each
+	// priority, defaulting to MaxQueue. They can be configured via the OLLAMA_MAX_QUEUE_INTERACTIVE,
+	// OLLAMA_MAX_QUEUE_BATCH and OLLAMA_MAX_QUEUE_BACKGROUND environment variables.
+	MaxQueueInteractive = Uint("OLLAMA_MAX_QUEUE_INTERACTIVE", 0)
+	MaxQueueBatch       = Uint("OLLAMA_MAX_QUEUE_BATCH", 0)
+	MaxQueueBackground  = Uint("OLLAMA_MAX_QUEUE_BACKGROUND", 0)
+	// BatchParallel sets the number of requests of each batch that are queued at once. BatchParallel can be
+	// configured via the OLLAMA_BATCH_PARALLEL environment variable.
+	BatchParallel = Uint("OLLAMA_BATCH_PARALLEL", 4)
+	// EmbedCacheSize sets the number of embeddings that are kept in memory so that repeated inputs aren't
+	// embedded again. Zero disables the cache. EmbedCacheSize can be configured via the OLLAMA_EMBED_CACHE_SIZE
+	// environment variable.
+	EmbedCacheSize = Uint("OLLAMA_EMBED_CACHE_SIZE", 4096)
 )
 
 func Uint64(key string, defaultValue uint64) func() uint64 {
@@ -243,6 +358,11 @@ func Uint64(key string, defaultValue uint64) func() uint64 {
 // Set aside VRAM per GPU
 var GpuOverhead = Uint64("OLLAMA_GPU_OVERHEAD", 0)
 
+// KvSnapshotSize is the disk space in bytes to use for saving KV cache snapshots, which let long
+// prompts be reused after a model is unloaded. Zero disables snapshots. KvSnapshotSize can be
+// configured via the OLLAMA_KV_SNAPSHOT_SIZE environment variable.
+var KvSnapshotSize = Uint64("OLLAMA_KV_SNAPSHOT_SIZE", 0)
+
 type EnvVar struct {
 	Name        string
 	Value       any
@@ -251,25 +371,38 @@ type EnvVar struct {
 
 func AsMap() map[string]EnvVar {
 	ret := map[string]EnvVar{
-		"OLLAMA_DEBUG":             {"OLLAMA_DEBUG", LogLevel(), "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
-		"OLLAMA_FLASH_ATTENTION":   {"OLLAMA_FLASH_ATTENTION", FlashAttention(), "Enabled flash attention"},
-		"OLLAMA_KV_CACHE_TYPE":     {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Quantization type for the K/V cache (default: f16)"},
-		"OLLAMA_GPU_OVERHEAD":      {"OLLAMA_GPU_OVERHEAD", GpuOverhead(), "Reserve a portion of VRAM per GPU (bytes)"},
-		"OLLAMA_HOST":              {"OLLAMA_HOST", Host(), "IP Address for the ollama server (default 127.0.0.1:11434)"},
-		"OLLAMA_KEEP_ALIVE":        {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
-		"OLLAMA_LLM_LIBRARY":       {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
-		"OLLAMA_LOAD_TIMEOUT":      {"OLLAMA_LOAD_TIMEOUT", LoadTimeout(), "How long to allow model loads to stall before giving up (default \"5m\")"},
-		"OLLAMA_MAX_LOADED_MODELS": {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
-		"OLLAMA_MAX_QUEUE":         {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
-		"OLLAMA_MODELS":            {"OLLAMA_MODELS", Models(), "The path to the models directory"},
-		"OLLAMA_NOHISTORY":         {"OLLAMA_NOHISTORY", NoHistory(), "Do not preserve readline history"},
-		"OLLAMA_NOPRUNE":           {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
-		"OLLAMA_NUM_PARALLEL":      {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
-		"OLLAMA_ORIGINS":           {"OLLAMA_ORIGINS", AllowedOrigins(), "A comma separated list of allowed origins"},
-		"OLLAMA_SCHED_SPREAD":      {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
-		"OLLAMA_MULTIUSER_CACHE":   {"OLLAMA_MULTIUSER_CACHE", MultiUserCache(), "Optimize prompt caching for multi-user scenarios"},
-		"OLLAMA_CONTEXT_LENGTH":    {"OLLAMA_CONTEXT_LENGTH", ContextLength(), "Context length to use unless otherwise specified (default: 4096)"},
-		"OLLAMA_NEW_ENGINE":        {"OLLAMA_NEW_ENGINE", NewEngine(), "Enable the new Ollama engine"},
+		"OLLAMA_DEBUG":                 {"OLLAMA_DEBUG", LogLevel(), "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
+		"OLLAMA_FLASH_ATTENTION":       {"OLLAMA_FLASH_ATTENTION", FlashAttention(), "Enabled flash attention"},
+		"OLLAMA_KV_CACHE_TYPE":         {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Quantization type for the K/V cache (default: f16)"},
+		"OLLAMA_GPU_OVERHEAD":          {"OLLAMA_GPU_OVERHEAD", GpuOverhead(), "Reserve a portion of VRAM per GPU (bytes)"},
+		"OLLAMA_KV_SNAPSHOT_SIZE":      {"OLLAMA_KV_SNAPSHOT_SIZE", KvSnapshotSize(), "Disk space for saving KV cache snapshots of long prompts (bytes, default 0 disables)"},
+		"OLLAMA_HOST":                  {"OLLAMA_HOST", Host(), "IP Address for the ollama server (default 127.0.0.1:11434)"},
+		"OLLAMA_KEEP_ALIVE":            {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
+		"OLLAMA_LLM_LIBRARY":           {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
+		"OLLAMA_LOAD_TIMEOUT":          {"OLLAMA_LOAD_TIMEOUT", LoadTimeout(), "How long to allow model loads to stall before giving up (default \"5m\")"},
+		"OLLAMA_MAX_LOADED_MODELS":     {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
+		"OLLAMA_MAX_QUEUE":             {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
+		"OLLAMA_MAX_QUEUE_INTERACTIVE": {"OLLAMA_MAX_QUEUE_INTERACTIVE", MaxQueueInteractive(), "Maximum number of queued interactive requests (default OLLAMA_MAX_QUEUE)"},
+		"OLLAMA_MAX_QUEUE_BATCH":       {"OLLAMA_MAX_QUEUE_BATCH", MaxQueueBatch(), "Maximum number of queued batch requests (default OLLAMA_MAX_QUEUE)"},
+		"OLLAMA_MAX_QUEUE_BACKGROUND":  {"OLLAMA_MAX_QUEUE_BACKGROUND", MaxQueueBackground(), "Maximum number of queued background requests (default OLLAMA_MAX_QUEUE)"},
+		"OLLAMA_BATCH_PARALLEL":        {"OLLAMA_BATCH_PARALLEL", BatchParallel(), "Maximum number of requests of each batch run at once (default 4)"},
+		"OLLAMA_EMBED_CACHE_SIZE":      {"OLLAMA_EMBED_CACHE_SIZE", EmbedCacheSize(), "Number of embeddings to cache in memory (default 4096, 0 disables)"},
+		"OLLAMA_MODELS":                {"OLLAMA_MODELS", Models(), "The path to the models directory"},
+		"OLLAMA_NOHISTORY":             {"OLLAMA_NOHISTORY", NoHistory(), "Do not preserve readline history"},
+		"OLLAMA_NOPRUNE":               {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
+		"OLLAMA_NO_RESPONSE_STORE":     {"OLLAMA_NO_RESPONSE_STORE", NoResponseStore(), "Do not store responses for previous_response_id"},
+		"OLLAMA_NUM_PARALLEL":          {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
+		"OLLAMA_ORIGINS":               {"OLLAMA_ORIGINS", AllowedOrigins(), "A comma separated list of allowed origins"},
+		"OLLAMA_REGISTRY_MIRROR":       {"OLLAMA_REGISTRY_MIRROR", RegistryMirror(), "Ollama server to pull models from before their registry"},
+		"OLLAMA_REGISTRY_SERVE":        {"OLLAMA_REGISTRY_SERVE", RegistryServe(), "Serve local models to other instances as a read-only registry"},
+		"OLLAMA_SIGNATURE_POLICY":      {"OLLAMA_SIGNATURE_POLICY", SignaturePolicy(), "What to do with models not signed by a trusted key: warn, enforce or off (default: warn)"},
+		"OLLAMA_TRUSTED_USER_PROXIES":  {"OLLAMA_TRUSTED_USER_PROXIES", TrustedUserProxies(), "Addresses allowed to set X-Ollama-User for fair queuing (default: loopback)"},
+		"OLLAMA_TRUSTED_KEYS":          {"OLLAMA_TRUSTED_KEYS", TrustedKeys(), "File of public keys trusted to sign models (default: ~/.ollama/trusted_keys)"},
+		"OLLAMA_VERIFY_ON_LOAD":        {"OLLAMA_VERIFY_ON_LOAD", VerifyOnLoad(), "Verify model signatures and layer digests each time a model is loaded"},
+		"OLLAMA_SCHED_SPREAD":          {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
+		"OLLAMA_MULTIUSER_CACHE":       {"OLLAMA_MULTIUSER_CACHE", MultiUserCache(), "Optimize prompt caching for multi-user scenarios"},
+		"OLLAMA_CONTEXT_LENGTH":        {"OLLAMA_CONTEXT_LENGTH", ContextLength(), "Context length to use unless otherwise specified (default: 4096)"},
+		"OLLAMA_NEW_ENGINE":            {"OLLAMA_NEW_ENGINE", NewEngine(), "Enable the new Ollama engine"},
 
 		// Informational
 		"HTTP_PROXY":  {"HTTP_PROXY", String("HTTP_PROXY")(), "HTTP proxy"},
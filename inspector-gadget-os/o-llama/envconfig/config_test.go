@@ -3,6 +3,7 @@ package envconfig
 import (
 	"log/slog"
 	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -49,6 +50,58 @@ func TestHost(t *testing.T) {
 	}
 }
 
+func TestRegistryMirror(t *testing.T) {
+	cases := map[string]struct {
+		value  string
+		expect string
+	}{
+		"empty":        {"", ""},
+		"address":      {"10.0.0.2:11434", "http://10.0.0.2:11434"},
+		"http":         {"http://10.0.0.2:11434", "http://10.0.0.2:11434"},
+		"https":        {"https://mirror.lan", "https://mirror.lan"},
+		"extra quotes": {"\"mirror.lan:11434\"", "http://mirror.lan:11434"},
+		"no host":      {"http://", ""},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("OLLAMA_REGISTRY_MIRROR", tt.value)
+			var got string
+			if u := RegistryMirror(); u != nil {
+				got = u.String()
+			}
+			if got != tt.expect {
+				t.Errorf("expected %q, got %q", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestTrustedUserProxies(t *testing.T) {
+	cases := map[string]struct {
+		value  string
+		expect string
+	}{
+		"default":   {"", "127.0.0.0/8 ::1/128"},
+		"addresses": {"10.0.0.2, fd00::1", "10.0.0.2/32 fd00::1/128"},
+		"prefixes":  {"10.0.0.7/24", "10.0.0.0/24"},
+		"invalid":   {"proxy.lan,10.0.0.2", "10.0.0.2/32"},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("OLLAMA_TRUSTED_USER_PROXIES", tt.value)
+			var got []string
+			for _, prefix := range TrustedUserProxies() {
+				got = append(got, prefix.String())
+			}
+			if diff := cmp.Diff(strings.Fields(tt.expect), got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestOrigins(t *testing.T) {
 	cases := []struct {
 		value  string
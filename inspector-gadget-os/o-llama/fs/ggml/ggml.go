@@ -350,21 +350,21 @@ func (t TensorType) TypeSize() uint64 {
 		return blockSize/2 + blockSize/4 + blockSize/16 + 2
 	case TensorTypeQ8_K:
 		return 4 + blockSize + 2*blockSize/16
-	case tensorTypeIQ2_XXS:
+	case TensorTypeIQ2_XXS:
 		return 2 + 2*blockSize/8
-	case tensorTypeIQ2_XS:
+	case TensorTypeIQ2_XS:
 		return 2 + 2*blockSize/8 + blockSize/32
-	case tensorTypeIQ3_XXS:
+	case TensorTypeIQ3_XXS:
 		return 2 + blockSize/4 + blockSize/8
 	case tensorTypeIQ1_S:
 		return 2 + blockSize/8 + blockSize/16
-	case tensorTypeIQ4_NL:
+	case TensorTypeIQ4_NL:
 		return 2 + blockSize/2
-	case tensorTypeIQ3_S:
+	case TensorTypeIQ3_S:
 		return 2 + blockSize/4 + blockSize/8 + blockSize/32 + 4
-	case tensorTypeIQ2_S:
+	case TensorTypeIQ2_S:
 		return 2 + blockSize/4 + blockSize/16
-	case tensorTypeIQ4_XS:
+	case TensorTypeIQ4_XS:
 		return 2 + 2 + blockSize/2 + blockSize/64
 	case TensorTypeI8:
 		return 1
@@ -20,27 +20,27 @@ const (
 	FileTypeQ8_0
 	fileTypeQ5_0
 	fileTypeQ5_1
-	fileTypeQ2_K
-	fileTypeQ3_K_S
-	fileTypeQ3_K_M
-	fileTypeQ3_K_L
+	FileTypeQ2_K
+	FileTypeQ3_K_S
+	FileTypeQ3_K_M
+	FileTypeQ3_K_L
 	FileTypeQ4_K_S
 	FileTypeQ4_K_M
-	fileTypeQ5_K_S
-	fileTypeQ5_K_M
-	fileTypeQ6_K
-	fileTypeIQ2_XXS
-	fileTypeIQ2_XS
+	FileTypeQ5_K_S
+	FileTypeQ5_K_M
+	FileTypeQ6_K
+	FileTypeIQ2_XXS
+	FileTypeIQ2_XS
 	fileTypeQ2_K_S
 	fileTypeIQ3_XS
-	fileTypeIQ3_XXS
+	FileTypeIQ3_XXS
 	fileTypeIQ1_S
-	fileTypeIQ4_NL
-	fileTypeIQ3_S
+	FileTypeIQ4_NL
+	FileTypeIQ3_S
 	fileTypeIQ3_M
-	fileTypeIQ2_S
+	FileTypeIQ2_S
 	fileTypeIQ2_M
-	fileTypeIQ4_XS
+	FileTypeIQ4_XS
 	fileTypeIQ1_M
 	FileTypeBF16
 	fileTypeQ4_0_4_4 // unused by GGML
@@ -62,19 +62,61 @@ func ParseFileType(s string) (FileType, error) {
 		return FileTypeF16, nil
 	case "Q8_0":
 		return FileTypeQ8_0, nil
+	case "Q2_K":
+		return FileTypeQ2_K, nil
+	case "Q3_K_S":
+		return FileTypeQ3_K_S, nil
+	case "Q3_K_M", "Q3_K":
+		return FileTypeQ3_K_M, nil
+	case "Q3_K_L":
+		return FileTypeQ3_K_L, nil
 	case "Q4_K_S":
 		return FileTypeQ4_K_S, nil
 	case "Q4_K_M", "Q4_K":
 		return FileTypeQ4_K_M, nil
+	case "Q5_K_S":
+		return FileTypeQ5_K_S, nil
+	case "Q5_K_M", "Q5_K":
+		return FileTypeQ5_K_M, nil
+	case "Q6_K":
+		return FileTypeQ6_K, nil
+	case "IQ2_XXS":
+		return FileTypeIQ2_XXS, nil
+	case "IQ2_XS":
+		return FileTypeIQ2_XS, nil
+	case "IQ2_S":
+		return FileTypeIQ2_S, nil
+	case "IQ3_XXS":
+		return FileTypeIQ3_XXS, nil
+	case "IQ3_S":
+		return FileTypeIQ3_S, nil
+	case "IQ4_NL":
+		return FileTypeIQ4_NL, nil
+	case "IQ4_XS":
+		return FileTypeIQ4_XS, nil
 	case "BF16":
 		return FileTypeBF16, nil
 	default:
 		supportedFileTypes := []FileType{
 			FileTypeF32,
 			FileTypeF16,
+			FileTypeQ2_K,
+			FileTypeQ3_K_S,
+			FileTypeQ3_K_M,
+			FileTypeQ3_K_L,
 			FileTypeQ4_K_S,
 			FileTypeQ4_K_M,
+			FileTypeQ5_K_S,
+			FileTypeQ5_K_M,
+			FileTypeQ6_K,
 			FileTypeQ8_0,
+			FileTypeIQ2_XXS,
+			FileTypeIQ2_XS,
+			FileTypeIQ2_S,
+			FileTypeIQ3_XXS,
+			FileTypeIQ3_S,
+			FileTypeIQ4_NL,
+			FileTypeIQ4_XS,
 			// fsggml.FileTypeBF16, // TODO
 		}
 		strs := make([]string, len(supportedFileTypes))
@@ -105,26 +147,40 @@ func (t FileType) String() string {
 		return "Q5_0"
 	case fileTypeQ5_1:
 		return "Q5_1"
-	case fileTypeQ2_K:
+	case FileTypeQ2_K:
 		return "Q2_K"
-	case fileTypeQ3_K_S:
+	case FileTypeQ3_K_S:
 		return "Q3_K_S"
-	case fileTypeQ3_K_M:
+	case FileTypeQ3_K_M:
 		return "Q3_K_M"
-	case fileTypeQ3_K_L:
+	case FileTypeQ3_K_L:
 		return "Q3_K_L"
 	case FileTypeQ4_K_S:
 		return "Q4_K_S"
 	case FileTypeQ4_K_M:
 		return "Q4_K_M"
-	case fileTypeQ5_K_S:
+	case FileTypeQ5_K_S:
 		return "Q5_K_S"
-	case fileTypeQ5_K_M:
+	case FileTypeQ5_K_M:
 		return "Q5_K_M"
-	case fileTypeQ6_K:
+	case FileTypeQ6_K:
 		return "Q6_K"
 	case fileTypeQ2_K_S:
 		return "Q2_K_S"
+	case FileTypeIQ2_XXS:
+		return "IQ2_XXS"
+	case FileTypeIQ2_XS:
+		return "IQ2_XS"
+	case FileTypeIQ2_S:
+		return "IQ2_S"
+	case FileTypeIQ3_XXS:
+		return "IQ3_XXS"
+	case FileTypeIQ3_S:
+		return "IQ3_S"
+	case FileTypeIQ4_NL:
+		return "IQ4_NL"
+	case FileTypeIQ4_XS:
+		return "IQ4_XS"
 	case FileTypeBF16:
 		return "BF16"
 	default:
@@ -154,26 +210,38 @@ func (ftype FileType) ToTensorType() TensorType {
 		return TensorTypeQ5_0
 	case fileTypeQ5_1:
 		return TensorTypeQ5_1
-	case fileTypeQ2_K:
+	case FileTypeQ2_K:
 		return TensorTypeQ2_K
-	case fileTypeQ3_K_S:
+	case FileTypeQ3_K_S:
 		return TensorTypeQ3_K
-	case fileTypeQ3_K_M:
+	case FileTypeQ3_K_M:
 		return TensorTypeQ3_K
-	case fileTypeQ3_K_L:
+	case FileTypeQ3_K_L:
 		return TensorTypeQ3_K
 	case FileTypeQ4_K_S:
 		return TensorTypeQ4_K
 	case FileTypeQ4_K_M:
 		return TensorTypeQ4_K
-	case fileTypeQ5_K_S:
+	case FileTypeQ5_K_S:
 		return TensorTypeQ5_K
-	case fileTypeQ5_K_M:
+	case FileTypeQ5_K_M:
 		return TensorTypeQ5_K
-	case fileTypeQ6_K:
+	case FileTypeQ6_K:
 		return TensorTypeQ6_K
 	case fileTypeQ2_K_S:
 		return TensorTypeQ2_K
+	case FileTypeIQ2_XXS:
+		return TensorTypeIQ2_XXS
+	case FileTypeIQ2_XS, FileTypeIQ2_S:
+		return TensorTypeIQ2_XS
+	case FileTypeIQ3_XXS:
+		return TensorTypeIQ3_XXS
+	case FileTypeIQ3_S:
+		return TensorTypeIQ3_S
+	case FileTypeIQ4_NL:
+		return TensorTypeIQ4_NL
+	case FileTypeIQ4_XS:
+		return TensorTypeIQ4_XS
 	case FileTypeBF16:
 		return TensorTypeBF16
 	default:
@@ -203,14 +271,14 @@ const (
 	TensorTypeQ5_K
 	TensorTypeQ6_K
 	TensorTypeQ8_K
-	tensorTypeIQ2_XXS // not supported by ollama
-	tensorTypeIQ2_XS  // not supported by ollama
-	tensorTypeIQ3_XXS // not supported by ollama
-	tensorTypeIQ1_S   // not supported by ollama
-	tensorTypeIQ4_NL  // not supported by ollama
-	tensorTypeIQ3_S   // not supported by ollama
-	tensorTypeIQ2_S   // not supported by ollama
-	tensorTypeIQ4_XS  // not supported by ollama
+	TensorTypeIQ2_XXS
+	TensorTypeIQ2_XS
+	TensorTypeIQ3_XXS
+	tensorTypeIQ1_S // not supported by ollama
+	TensorTypeIQ4_NL
+	TensorTypeIQ3_S
+	TensorTypeIQ2_S
+	TensorTypeIQ4_XS
 	TensorTypeI8
 	TensorTypeI16
 	TensorTypeI32
@@ -260,6 +328,20 @@ func ParseTensorType(s string) (TensorType, error) {
 		return TensorTypeQ6_K, nil
 	case "Q8_K":
 		return TensorTypeQ8_K, nil
+	case "IQ2_XXS":
+		return TensorTypeIQ2_XXS, nil
+	case "IQ2_XS":
+		return TensorTypeIQ2_XS, nil
+	case "IQ2_S":
+		return TensorTypeIQ2_S, nil
+	case "IQ3_XXS":
+		return TensorTypeIQ3_XXS, nil
+	case "IQ3_S":
+		return TensorTypeIQ3_S, nil
+	case "IQ4_NL":
+		return TensorTypeIQ4_NL, nil
+	case "IQ4_XS":
+		return TensorTypeIQ4_XS, nil
 	case "F64":
 		return TensorTypeF64, nil
 	case "BF16":
@@ -314,6 +396,20 @@ func (t TensorType) String() string {
 		return "Q6_K"
 	case TensorTypeQ8_K:
 		return "Q8_K"
+	case TensorTypeIQ2_XXS:
+		return "IQ2_XXS"
+	case TensorTypeIQ2_XS:
+		return "IQ2_XS"
+	case TensorTypeIQ2_S:
+		return "IQ2_S"
+	case TensorTypeIQ3_XXS:
+		return "IQ3_XXS"
+	case TensorTypeIQ3_S:
+		return "IQ3_S"
+	case TensorTypeIQ4_NL:
+		return "IQ4_NL"
+	case TensorTypeIQ4_XS:
+		return "IQ4_XS"
 	case TensorTypeF64:
 		return "F64"
 	case TensorTypeBF16:
@@ -2,7 +2,6 @@ package gguf
 
 import (
 	"bytes"
-	"cmp"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -77,7 +76,7 @@ func Open(path string) (f *File, err error) {
 	f.tensors.successFunc = func() error {
 		offset := f.reader.offset
 
-		alignment := cmp.Or(f.KeyValue("general.alignment").Int(), 32)
+		alignment := alignmentOf(f.keyValues.values)
 		f.offset = offset + (alignment-offset%alignment)%alignment
 		return nil
 	}
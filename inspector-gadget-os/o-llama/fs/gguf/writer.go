@@ -0,0 +1,240 @@
+package gguf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NewKeyValue returns a KeyValue with key and value v. v must be a type read
+// from GGUF files: a fixed size integer or float, bool, string, or a slice of
+// one of those.
+func NewKeyValue(key string, v any) KeyValue {
+	return KeyValue{Key: key, Value: Value{v}}
+}
+
+// Interface returns the underlying value of Value.
+func (v Value) Interface() any {
+	return v.value
+}
+
+// Rewrite writes a copy of f to w with its key values replaced by kvs. Tensor
+// infos and data are copied from f unchanged, so kvs must keep the alignment
+// of f.
+func (f *File) Rewrite(w io.Writer, kvs []KeyValue) error {
+	// read all key values and tensor infos, which also finds the start of the
+	// tensor data
+	f.keyValues.rest()
+	f.tensors.rest()
+	if len(f.keyValues.values) != int(f.keyValues.count) || len(f.tensors.values) != int(f.tensors.count) {
+		return fmt.Errorf("%w: read %d of %d key values and %d of %d tensors", io.ErrUnexpectedEOF,
+			len(f.keyValues.values), f.keyValues.count, len(f.tensors.values), f.tensors.count)
+	}
+
+	alignment := alignmentOf(f.keyValues.values)
+	for _, kv := range kvs {
+		if kv.Key == "general.alignment" && alignmentOf([]KeyValue{kv}) != alignment {
+			return errors.New("gguf: cannot change general.alignment")
+		}
+	}
+
+	cw := &countWriter{w: w}
+	if err := binary.Write(cw, binary.LittleEndian, f.Magic); err != nil {
+		return err
+	}
+
+	if err := binary.Write(cw, binary.LittleEndian, f.Version); err != nil {
+		return err
+	}
+
+	if err := binary.Write(cw, binary.LittleEndian, uint64(len(f.tensors.values))); err != nil {
+		return err
+	}
+
+	if err := binary.Write(cw, binary.LittleEndian, uint64(len(kvs))); err != nil {
+		return err
+	}
+
+	for _, kv := range kvs {
+		if err := writeKeyValue(cw, kv); err != nil {
+			return fmt.Errorf("%s: %w", kv.Key, err)
+		}
+	}
+
+	for _, t := range f.tensors.values {
+		if err := writeTensorInfo(cw, t); err != nil {
+			return err
+		}
+	}
+
+	if _, err := cw.Write(make([]byte, (alignment-cw.n%alignment)%alignment)); err != nil {
+		return err
+	}
+
+	fi, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(cw, io.NewSectionReader(f.file, f.offset, fi.Size()-f.offset))
+	return err
+}
+
+func alignmentOf(kvs []KeyValue) int64 {
+	for _, kv := range kvs {
+		if kv.Key == "general.alignment" {
+			if n := max(kv.Int(), int64(kv.Uint())); n > 0 {
+				return n
+			}
+		}
+	}
+
+	return 32
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func writeTensorInfo(w io.Writer, t TensorInfo) error {
+	if err := writeString(w, t.Name); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(t.Shape))); err != nil {
+		return err
+	}
+
+	for _, dim := range t.Shape {
+		if err := binary.Write(w, binary.LittleEndian, dim); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(t.Type)); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, t.Offset)
+}
+
+func writeKeyValue(w io.Writer, kv KeyValue) error {
+	if err := writeString(w, kv.Key); err != nil {
+		return err
+	}
+
+	switch v := kv.value.(type) {
+	case uint8:
+		return writeValue(w, typeUint8, v)
+	case int8:
+		return writeValue(w, typeInt8, v)
+	case uint16:
+		return writeValue(w, typeUint16, v)
+	case int16:
+		return writeValue(w, typeInt16, v)
+	case uint32:
+		return writeValue(w, typeUint32, v)
+	case int32:
+		return writeValue(w, typeInt32, v)
+	case uint64:
+		return writeValue(w, typeUint64, v)
+	case int64:
+		return writeValue(w, typeInt64, v)
+	case float32:
+		return writeValue(w, typeFloat32, v)
+	case float64:
+		return writeValue(w, typeFloat64, v)
+	case bool:
+		return writeValue(w, typeBool, v)
+	case string:
+		if err := binary.Write(w, binary.LittleEndian, typeString); err != nil {
+			return err
+		}
+		return writeString(w, v)
+	case []uint8:
+		return writeArray(w, typeUint8, v)
+	case []int8:
+		return writeArray(w, typeInt8, v)
+	case []uint16:
+		return writeArray(w, typeUint16, v)
+	case []int16:
+		return writeArray(w, typeInt16, v)
+	case []uint32:
+		return writeArray(w, typeUint32, v)
+	case []int32:
+		return writeArray(w, typeInt32, v)
+	case []uint64:
+		return writeArray(w, typeUint64, v)
+	case []int64:
+		return writeArray(w, typeInt64, v)
+	case []float32:
+		return writeArray(w, typeFloat32, v)
+	case []float64:
+		return writeArray(w, typeFloat64, v)
+	case []bool:
+		return writeArray(w, typeBool, v)
+	case []string:
+		if err := binary.Write(w, binary.LittleEndian, typeArray); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, typeString); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, uint64(len(v))); err != nil {
+			return err
+		}
+
+		for _, s := range v {
+			if err := writeString(w, s); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w type %T", ErrUnsupported, v)
+	}
+}
+
+func writeValue[T any](w io.Writer, t uint32, v T) error {
+	if err := binary.Write(w, binary.LittleEndian, t); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, v)
+}
+
+func writeArray[T any](w io.Writer, t uint32, v []T) error {
+	if err := binary.Write(w, binary.LittleEndian, typeArray); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, t); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(v))); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, v)
+}
+
+func writeString(w io.Writer, s string) error {
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(s))); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, s)
+	return err
+}
@@ -0,0 +1,121 @@
+package gguf_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/fs/gguf"
+)
+
+func TestRewrite(t *testing.T) {
+	f, err := gguf.Open(createBinFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var kvs []gguf.KeyValue
+	for _, kv := range f.KeyValues() {
+		switch kv.Key {
+		case "tokenizer.ggml.scores":
+			continue
+		case "llama.block_count":
+			kv = gguf.NewKeyValue(kv.Key, uint32(4))
+		}
+		kvs = append(kvs, kv)
+	}
+	kvs = append(kvs, gguf.NewKeyValue("tokenizer.chat_template", "{{ .Prompt }}"))
+
+	p := filepath.Join(t.TempDir(), "rewritten.gguf")
+	w, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := f.Rewrite(w, kvs); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := gguf.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	if got := g.KeyValue("block_count").Uint(); got != 4 {
+		t.Errorf(`KeyValue("block_count").Uint() = %d, want 4`, got)
+	}
+
+	if got := g.KeyValue("tokenizer.chat_template").String(); got != "{{ .Prompt }}" {
+		t.Errorf(`KeyValue("tokenizer.chat_template").String() = %q, want %q`, got, "{{ .Prompt }}")
+	}
+
+	if g.KeyValue("tokenizer.ggml.scores").Valid() {
+		t.Error(`KeyValue("tokenizer.ggml.scores") still exists`)
+	}
+
+	if diff := cmp.Diff(f.KeyValue("tokenizer.ggml.tokens").Strings(), g.KeyValue("tokenizer.ggml.tokens").Strings()); diff != "" {
+		t.Errorf("tokenizer.ggml.tokens mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(f.KeyValue("tokenizer.ggml.eos_token_ids").Ints(), g.KeyValue("tokenizer.ggml.eos_token_ids").Ints()); diff != "" {
+		t.Errorf("tokenizer.ggml.eos_token_ids mismatch (-want +got):\n%s", diff)
+	}
+
+	if g.NumTensors() != f.NumTensors() {
+		t.Fatalf("NumTensors() = %d, want %d", g.NumTensors(), f.NumTensors())
+	}
+
+	for _, want := range f.TensorInfos() {
+		got, r, err := g.TensorReader(want.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("TensorInfo(%q) mismatch (-want +got):\n%s", want.Name, diff)
+		}
+
+		_, wr, err := f.TensorReader(want.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotData, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantData, err := io.ReadAll(wr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("tensor %q data differs", want.Name)
+		}
+	}
+}
+
+func TestRewriteErrors(t *testing.T) {
+	f, err := gguf.Open(createBinFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.Rewrite(io.Discard, []gguf.KeyValue{gguf.NewKeyValue("general.alignment", uint32(64))}); err == nil {
+		t.Error("expected error changing general.alignment")
+	}
+
+	if err := f.Rewrite(io.Discard, []gguf.KeyValue{gguf.NewKeyValue("general.name", 1)}); !errors.Is(err, gguf.ErrUnsupported) {
+		t.Errorf("expected %v, got %v", gguf.ErrUnsupported, err)
+	}
+}
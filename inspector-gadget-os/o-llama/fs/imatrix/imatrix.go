@@ -0,0 +1,311 @@
+// Package imatrix reads and writes importance matrices.
+//
+// An importance matrix holds, for each weight of a model, the mean square of
+// the inputs to each of its columns over a calibration text. Quantization uses
+// it to weight rounding errors, keeping the columns that matter most for the
+// model's outputs more precise.
+//
+// Matrices are written in the GGUF format of llama.cpp's imatrix tool. Its
+// older format is also read, so matrices computed by either can be used.
+package imatrix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	fsggml "github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/fs/gguf"
+)
+
+const (
+	sumsSuffix   = ".in_sum2"
+	countsSuffix = ".counts"
+)
+
+type Matrix struct {
+	// Datasets are the names of the calibration texts
+	Datasets []string
+
+	// ChunkCount is the number of chunks of text processed, of ChunkSize
+	// tokens each
+	ChunkCount int
+	ChunkSize  int
+
+	Entries map[string]*Entry
+}
+
+// Entry is the importance data of a weight
+type Entry struct {
+	// Sums are the sums of the squares of the inputs to each column of the
+	// weight, for each of its matrices
+	Sums []float32
+
+	// Counts are the number of inputs summed for each matrix
+	Counts []float32
+}
+
+func New() *Matrix {
+	return &Matrix{Entries: make(map[string]*Entry)}
+}
+
+// Add adds the sums of the squares of n inputs to the weight name, which has
+// one matrix
+func (m *Matrix) Add(name string, sums []float32, n int) error {
+	e, ok := m.Entries[name]
+	if !ok {
+		e = &Entry{Sums: make([]float32, len(sums)), Counts: make([]float32, 1)}
+		m.Entries[name] = e
+	}
+
+	if len(e.Sums) != len(sums) || len(e.Counts) != 1 {
+		return fmt.Errorf("imatrix: %s has %d columns, got %d", name, len(e.Sums), len(sums))
+	}
+
+	for i, s := range sums {
+		e.Sums[i] += s
+	}
+	e.Counts[0] += float32(n)
+	return nil
+}
+
+// Importance returns the importance of each column of the weight name, for
+// each of its matrices, or nil if the matrix has no data for it. A nil matrix
+// has no data.
+func (m *Matrix) Importance(name string) []float32 {
+	if m == nil {
+		return nil
+	}
+
+	e, ok := m.Entries[name]
+	if !ok || len(e.Counts) == 0 || len(e.Sums)%len(e.Counts) != 0 {
+		return nil
+	}
+
+	cols := len(e.Sums) / len(e.Counts)
+	importance := make([]float32, len(e.Sums))
+	for i, s := range e.Sums {
+		count := e.Counts[i/cols]
+		if count == 0 {
+			return nil
+		}
+
+		importance[i] = s / count
+	}
+
+	return importance
+}
+
+// WriteFile writes m to a file in GGUF format
+func (m *Matrix) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var ts []*fsggml.Tensor
+	for _, name := range slices.Sorted(maps.Keys(m.Entries)) {
+		e := m.Entries[name]
+		if len(e.Counts) == 0 || len(e.Sums)%len(e.Counts) != 0 {
+			return fmt.Errorf("imatrix: %s has %d sums for %d matrices", name, len(e.Sums), len(e.Counts))
+		}
+
+		ts = append(ts, f32Tensor(name+sumsSuffix, e.Sums, uint64(len(e.Sums)/len(e.Counts)), uint64(len(e.Counts))))
+		ts = append(ts, f32Tensor(name+countsSuffix, e.Counts, 1, uint64(len(e.Counts))))
+	}
+
+	if err := fsggml.WriteGGUF(f, fsggml.KV{
+		"general.type":        "imatrix",
+		"imatrix.datasets":    append([]string{}, m.Datasets...),
+		"imatrix.chunk_count": uint32(m.ChunkCount),
+		"imatrix.chunk_size":  uint32(m.ChunkSize),
+	}, ts); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func f32Tensor(name string, data []float32, shape ...uint64) *fsggml.Tensor {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, data)
+	return &fsggml.Tensor{Name: name, Kind: uint32(fsggml.TensorTypeF32), Shape: shape, WriterTo: &b}
+}
+
+// ReadFile reads a matrix in either GGUF or legacy format
+func ReadFile(name string) (*Matrix, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return nil, fmt.Errorf("imatrix: %w", err)
+	}
+
+	if string(magic[:]) == "GGUF" {
+		return readGGUF(name)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return readLegacy(f)
+}
+
+func readGGUF(name string) (*Matrix, error) {
+	f, err := gguf.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := New()
+	for _, kv := range f.KeyValues() {
+		switch kv.Key {
+		case "general.type":
+			if kv.String() != "imatrix" {
+				return nil, fmt.Errorf("imatrix: not an importance matrix: %s", kv.String())
+			}
+		case "imatrix.datasets":
+			m.Datasets = kv.Strings()
+		case "imatrix.chunk_count":
+			m.ChunkCount = int(kv.Uint())
+		case "imatrix.chunk_size":
+			m.ChunkSize = int(kv.Uint())
+		}
+	}
+
+	var names []string
+	for _, t := range f.TensorInfos() {
+		if name, ok := strings.CutSuffix(t.Name, sumsSuffix); ok {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		sums, err := readF32s(f, name+sumsSuffix)
+		if err != nil {
+			return nil, err
+		}
+
+		counts, err := readF32s(f, name+countsSuffix)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(counts) == 0 || len(sums)%len(counts) != 0 {
+			return nil, fmt.Errorf("imatrix: %s has %d sums for %d matrices", name, len(sums), len(counts))
+		}
+
+		m.Entries[name] = &Entry{Sums: sums, Counts: counts}
+	}
+
+	return m, nil
+}
+
+func readF32s(f *gguf.File, name string) ([]float32, error) {
+	t, r, err := f.TensorReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("imatrix: %w", err)
+	}
+
+	if t.Type != gguf.TensorTypeF32 {
+		return nil, fmt.Errorf("imatrix: %s has type %s, expected f32", name, t.Type)
+	}
+
+	data := make([]float32, t.NumValues())
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		return nil, fmt.Errorf("imatrix: %s: %w", name, err)
+	}
+
+	return data, nil
+}
+
+// readLegacy reads the original format of llama.cpp's imatrix tool, which
+// stores the mean square of inputs multiplied by the number of chunks they
+// were collected over
+func readLegacy(r io.Reader) (*Matrix, error) {
+	read := func(data any) error {
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return fmt.Errorf("imatrix: %w", err)
+		}
+		return nil
+	}
+
+	readString := func() (string, error) {
+		var n int32
+		if err := read(&n); err != nil {
+			return "", err
+		}
+
+		if n < 0 || n > 1<<16 {
+			return "", fmt.Errorf("imatrix: invalid name length %d", n)
+		}
+
+		b := make([]byte, n)
+		if err := read(b); err != nil {
+			return "", err
+		}
+
+		return string(b), nil
+	}
+
+	var n int32
+	if err := read(&n); err != nil {
+		return nil, err
+	}
+
+	if n < 1 {
+		return nil, errors.New("imatrix: no entries")
+	}
+
+	m := New()
+	for range n {
+		name, err := readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var ncall, nval int32
+		if err := read(&ncall); err != nil {
+			return nil, err
+		}
+
+		if err := read(&nval); err != nil {
+			return nil, err
+		}
+
+		if nval < 1 || nval > 1<<24 {
+			return nil, fmt.Errorf("imatrix: %s has invalid size %d", name, nval)
+		}
+
+		sums := make([]float32, nval)
+		if err := read(sums); err != nil {
+			return nil, err
+		}
+
+		m.Entries[name] = &Entry{Sums: sums, Counts: []float32{float32(max(ncall, 1))}}
+	}
+
+	// the number of chunks and dataset name are optional
+	var chunks int32
+	if err := binary.Read(r, binary.LittleEndian, &chunks); err == nil {
+		m.ChunkCount = int(chunks)
+		if dataset, err := readString(); err == nil {
+			m.Datasets = []string{dataset}
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,138 @@
+package imatrix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatrix(t *testing.T) {
+	m := New()
+	m.Datasets = []string{"calibration.txt"}
+	m.ChunkCount = 2
+	m.ChunkSize = 512
+
+	if err := m.Add("blk.0.attn_q.weight", []float32{1, 2, 3, 4}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Add("blk.0.attn_q.weight", []float32{3, 2, 1, 0}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Add("blk.0.ffn_up.weight", []float32{8, 16}, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Add("blk.0.ffn_up.weight", []float32{1}, 1); err == nil {
+		t.Error("expected error adding sums of a different size")
+	}
+
+	p := filepath.Join(t.TempDir(), "imatrix.gguf")
+	if err := m.WriteFile(p); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(m, got); diff != "" {
+		t.Errorf("matrix mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]float32{1, 1, 1, 1}, got.Importance("blk.0.attn_q.weight")); diff != "" {
+		t.Errorf("importance mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]float32{2, 4}, got.Importance("blk.0.ffn_up.weight")); diff != "" {
+		t.Errorf("importance mismatch (-want +got):\n%s", diff)
+	}
+
+	if got.Importance("output.weight") != nil {
+		t.Error("expected no importance for missing weight")
+	}
+}
+
+func TestImportanceExperts(t *testing.T) {
+	m := &Matrix{Entries: map[string]*Entry{
+		"blk.0.ffn_up_exps.weight":   {Sums: []float32{2, 4, 9, 3}, Counts: []float32{2, 3}},
+		"blk.0.ffn_gate_exps.weight": {Sums: []float32{2, 4, 9, 3}, Counts: []float32{2, 0}},
+	}}
+
+	if diff := cmp.Diff([]float32{1, 2, 3, 1}, m.Importance("blk.0.ffn_up_exps.weight")); diff != "" {
+		t.Errorf("importance mismatch (-want +got):\n%s", diff)
+	}
+
+	// experts that saw no inputs have no importance
+	if m.Importance("blk.0.ffn_gate_exps.weight") != nil {
+		t.Error("expected no importance for unused expert")
+	}
+}
+
+func TestReadLegacy(t *testing.T) {
+	var b bytes.Buffer
+	write := func(data any) {
+		if err := binary.Write(&b, binary.LittleEndian, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeString := func(s string) {
+		write(int32(len(s)))
+		write([]byte(s))
+	}
+
+	write(int32(2))
+	writeString("blk.0.attn_q.weight")
+	write(int32(4))
+	write(int32(2))
+	write([]float32{4, 8})
+	writeString("output.weight")
+	write(int32(0))
+	write(int32(1))
+	write([]float32{3})
+	write(int32(10))
+	writeString("wiki.train.raw")
+
+	p := filepath.Join(t.TempDir(), "imatrix.dat")
+	if err := os.WriteFile(p, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(&Matrix{
+		Datasets:   []string{"wiki.train.raw"},
+		ChunkCount: 10,
+		Entries: map[string]*Entry{
+			"blk.0.attn_q.weight": {Sums: []float32{4, 8}, Counts: []float32{4}},
+			"output.weight":       {Sums: []float32{3}, Counts: []float32{1}},
+		},
+	}, m); diff != "" {
+		t.Errorf("matrix mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]float32{1, 2}, m.Importance("blk.0.attn_q.weight")); diff != "" {
+		t.Errorf("importance mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "imatrix.dat")
+		if err := os.WriteFile(p, b.Bytes()[:20], 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ReadFile(p); err == nil {
+			t.Error("expected error reading truncated file")
+		}
+	})
+}
@@ -0,0 +1,237 @@
+// Package grammar compiles the format of a request, such as a JSON Schema,
+// into a GBNF grammar that constrains sampling to matching output.
+//
+// Schema features that can't be enforced by a grammar are reported as errors
+// rather than being ignored, so that output never silently fails to match the
+// schema that was asked for.
+package grammar
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// jsonGrammar matches any JSON object
+const jsonGrammar = `
+root   ::= object
+value  ::= object | array | string | number | ("true" | "false" | "null") ws
+object ::=
+  "{" ws (
+         string ":" ws value
+    ("," ws string ":" ws value)*
+  )? ws "}"
+array  ::=
+  "[" ws (
+            value
+    ("," ws value)*
+  )? ws "]"
+string ::=
+  "\"" (
+    [^"\\\x7F\x00-\x1F] |
+    "\\" (["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F]) # escapes
+  )* "\""
+number ::= ("-"? ([0-9] | [1-9] [0-9]*)) ("." [0-9]+)? ([eE] [-+]? [0-9]+)?
+# Optional space: by convention, applied in this grammar after literal chars when allowed
+ws ::= ([ \t\n] ws)?
+`
+
+// FromFormat returns the grammar for the format of a completion request,
+// which is either empty, "json" for any JSON object, or a JSON Schema. An
+// empty grammar means that output isn't constrained.
+func FromFormat(format json.RawMessage) (string, error) {
+	switch string(format) {
+	case ``, `null`, `""`:
+		// Field was set, but "missing" a value. We accept these as "not set".
+		return "", nil
+	case `"json"`:
+		return jsonGrammar, nil
+	}
+
+	if format[0] != '{' {
+		return "", fmt.Errorf("invalid format: %q; expected \"json\" or a valid JSON Schema object", format)
+	}
+
+	g, err := FromSchema(format)
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON schema in format: %w", err)
+	}
+
+	return g, nil
+}
+
+// FromSchema compiles a JSON Schema into a grammar for the JSON documents
+// that it accepts
+func FromSchema(schema []byte) (string, error) {
+	var root json.RawMessage
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return "", err
+	}
+
+	c := &compiler{
+		root:  root,
+		rules: make(map[string]string),
+		refs:  make(map[string]string),
+	}
+
+	// root is reserved so that definitions can't take its name
+	c.rules["root"] = ""
+
+	name, err := c.visit(root, "", "root")
+	if err != nil {
+		return "", err
+	}
+
+	if name != "root" {
+		c.rules["root"] = name
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "root ::= %s\n", c.rules["root"])
+	for _, name := range slices.Sorted(maps.Keys(c.rules)) {
+		if name != "root" {
+			fmt.Fprintf(&sb, "%s ::= %s\n", name, c.rules[name])
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// compiler holds the rules of the grammar being built. Rules are named after
+// the part of the schema that they match.
+type compiler struct {
+	root  json.RawMessage
+	rules map[string]string
+
+	// refs maps the references that have been visited to their rules
+	refs map[string]string
+}
+
+var invalidRuleChars = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// add adds a rule, returning its name. Rules with the same name but a
+// different body are given a numeric suffix, unless the name was reserved.
+func (c *compiler) add(name, body string) string {
+	name = ruleName(name)
+	key := name
+	for i := 1; ; i++ {
+		existing, ok := c.rules[key]
+		if _, builtin := primitives[key]; !builtin && (!ok || existing == body || existing == "") {
+			c.rules[key] = body
+			return key
+		}
+		key = fmt.Sprintf("%s%d", name, i)
+	}
+}
+
+func ruleName(name string) string {
+	name = strings.Trim(invalidRuleChars.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		return "rule"
+	}
+	return name
+}
+
+// reserve returns an unused name for a rule whose body isn't known yet
+func (c *compiler) reserve(name string) string {
+	name = ruleName(name)
+	key := name
+	for i := 1; ; i++ {
+		_, ok := c.rules[key]
+		if _, builtin := primitives[key]; !builtin && !ok {
+			c.rules[key] = ""
+			return key
+		}
+		key = fmt.Sprintf("%s%d", name, i)
+	}
+}
+
+type primitive struct {
+	body string
+	deps []string
+}
+
+var primitives = map[string]primitive{
+	"space":         {`| " " | "\n"{1,2} [ \t]{0,20}`, nil},
+	"boolean":       {`("true" | "false") space`, []string{"space"}},
+	"null":          {`"null" space`, []string{"space"}},
+	"integral-part": {`[0] | [1-9] [0-9]{0,15}`, nil},
+	"decimal-part":  {`[0-9]{1,16}`, nil},
+	"number":        {`("-"? integral-part) ("." decimal-part)? ([eE] [-+]? integral-part)? space`, []string{"integral-part", "decimal-part", "space"}},
+	"integer":       {`("-"? integral-part) space`, []string{"integral-part", "space"}},
+	"char":          {`[^"\\\x7F\x00-\x1F] | [\\] (["\\/bfnrt] | "u" [0-9a-fA-F]{4})`, nil},
+	"string":        {`"\"" char* "\"" space`, []string{"char", "space"}},
+	"value":         {`object | array | string | number | boolean | null`, []string{"object", "array", "string", "number", "boolean", "null"}},
+	"object":        {`"{" space ( string ":" space value ("," space string ":" space value)* )? "}" space`, []string{"string", "value", "space"}},
+	"array":         {`"[" space ( value ("," space value)* )? "]" space`, []string{"value", "space"}},
+
+	"date":             {`[0-9]{4} "-" ( "0" [1-9] | "1" [0-2] ) "-" ( "0" [1-9] | [1-2] [0-9] | "3" [0-1] )`, nil},
+	"time":             {`([01] [0-9] | "2" [0-3]) ":" [0-5] [0-9] ":" [0-5] [0-9] ( "." [0-9]{3} )? ( "Z" | ( "+" | "-" ) ( [01] [0-9] | "2" [0-3] ) ":" [0-5] [0-9] )`, nil},
+	"date-time":        {`date "T" time`, []string{"date", "time"}},
+	"uuid":             {`[0-9a-fA-F]{8} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{12}`, nil},
+	"date-string":      {`"\"" date "\"" space`, []string{"date", "space"}},
+	"time-string":      {`"\"" time "\"" space`, []string{"time", "space"}},
+	"date-time-string": {`"\"" date-time "\"" space`, []string{"date-time", "space"}},
+	"uuid-string":      {`"\"" uuid "\"" space`, []string{"uuid", "space"}},
+}
+
+// primitive adds a built-in rule and the rules it depends on
+func (c *compiler) primitive(name string) string {
+	p := primitives[name]
+	c.rules[name] = p.body
+	for _, dep := range p.deps {
+		if _, ok := c.rules[dep]; !ok {
+			c.primitive(dep)
+		}
+	}
+	return name
+}
+
+// literal quotes s as a grammar string literal
+func literal(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\x%02X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// jsonLiteral returns a grammar literal for a JSON value as it is written
+// compactly, without escaping HTML characters
+func jsonLiteral(v json.RawMessage) (string, error) {
+	var value any
+	if err := json.Unmarshal(v, &value); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	e := json.NewEncoder(&sb)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(value); err != nil {
+		return "", err
+	}
+
+	return literal(strings.TrimSuffix(sb.String(), "\n")), nil
+}
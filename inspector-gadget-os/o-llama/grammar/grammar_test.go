@@ -0,0 +1,278 @@
+package grammar
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/llama"
+)
+
+// matcher runs a grammar over documents one character at a time
+type matcher struct {
+	grammar string
+	ids     []uint32
+	pieces  []string
+	tokens  map[rune]int32
+}
+
+func newMatcher(t *testing.T, g string, docs ...string) *matcher {
+	t.Helper()
+
+	m := &matcher{grammar: g, tokens: make(map[rune]int32)}
+	for _, doc := range docs {
+		for _, r := range doc {
+			if _, ok := m.tokens[r]; !ok {
+				m.tokens[r] = int32(len(m.ids))
+				m.ids = append(m.ids, uint32(len(m.ids)))
+				m.pieces = append(m.pieces, string(r))
+			}
+		}
+	}
+
+	// the last token is the end of the document
+	m.ids = append(m.ids, uint32(len(m.ids)))
+	m.pieces = append(m.pieces, "")
+	return m
+}
+
+func (m *matcher) match(t *testing.T, doc string) bool {
+	t.Helper()
+
+	eos := int32(len(m.ids) - 1)
+	g := llama.NewGrammar(m.grammar, m.ids, m.pieces, []int32{eos})
+	if g == nil {
+		t.Fatalf("failed to parse grammar:\n%s", m.grammar)
+	}
+	defer g.Free()
+
+	allowed := func(token int32) bool {
+		td := []llama.TokenData{{ID: token}}
+		g.Apply(td)
+		return !math.IsInf(float64(td[0].Logit), -1)
+	}
+
+	for _, r := range doc {
+		if !allowed(m.tokens[r]) {
+			return false
+		}
+		g.Accept(m.tokens[r])
+	}
+
+	return allowed(eos)
+}
+
+func TestFromSchema(t *testing.T) {
+	cases := []struct {
+		name    string
+		schema  string
+		match   []string
+		nomatch []string
+	}{
+		{
+			name:    "empty",
+			schema:  `{}`,
+			match:   []string{`{"a": [1, true, null]}`, `"x"`, `-1.5e3`},
+			nomatch: []string{`{`, `tru`},
+		},
+		{
+			name:    "required and optional properties",
+			schema:  `{"type": "object", "properties": {"name": {"type": "string"}, "age": {"type": "integer"}, "tags": {"type": "array", "items": {"type": "string"}}}, "required": ["name"]}`,
+			match:   []string{`{"name": "a"}`, `{"name": "a", "age": 3}`, `{"name": "a", "tags": []}`, `{"name": "a", "age": -3, "tags": ["x", "y"]}`},
+			nomatch: []string{`{}`, `{"age": 3}`, `{"name": "a", "tags": [], "age": 3}`, `{"name": 1}`, `{"name": "a", "extra": 1}`, `{"name": "a", "age": 1.5}`},
+		},
+		{
+			name:    "only optional properties",
+			schema:  `{"properties": {"a": {"type": "boolean"}, "b": {"type": "null"}}}`,
+			match:   []string{`{}`, `{"a": true}`, `{"b": null}`, `{"a": false, "b": null}`},
+			nomatch: []string{`{"b": null, "a": true}`, `{"a": null}`, `{,}`},
+		},
+		{
+			name:    "additional properties",
+			schema:  `{"type": "object", "additionalProperties": {"type": "number"}}`,
+			match:   []string{`{}`, `{"x": 1, "y": 2.5}`},
+			nomatch: []string{`{"x": "1"}`},
+		},
+		{
+			name:    "enum and const",
+			schema:  `{"type": "object", "properties": {"color": {"enum": ["red", "green", 1, null]}, "kind": {"const": "a\"b"}}, "required": ["color", "kind"]}`,
+			match:   []string{`{"color": "red", "kind": "a\"b"}`, `{"color": 1, "kind": "a\"b"}`, `{"color": null, "kind": "a\"b"}`},
+			nomatch: []string{`{"color": "blue", "kind": "a\"b"}`, `{"color": "red", "kind": "ab"}`},
+		},
+		{
+			name:    "array bounds",
+			schema:  `{"type": "array", "items": {"type": "integer"}, "minItems": 1, "maxItems": 3}`,
+			match:   []string{`[1]`, `[1, 2]`, `[1, 2, 3]`},
+			nomatch: []string{`[]`, `[1, 2, 3, 4]`, `["1"]`},
+		},
+		{
+			name:    "array without minimum",
+			schema:  `{"type": "array", "maxItems": 2}`,
+			match:   []string{`[]`, `["a", 1]`},
+			nomatch: []string{`[1, 2, 3]`},
+		},
+		{
+			name:    "tuple",
+			schema:  `{"type": "array", "prefixItems": [{"type": "string"}, {"type": "integer"}], "items": false}`,
+			match:   []string{`["a", 1]`},
+			nomatch: []string{`["a"]`, `[1, "a"]`, `["a", 1, 2]`},
+		},
+		{
+			name:    "anchored pattern",
+			schema:  `{"type": "string", "pattern": "^[a-c]+-\\d{2,3}$"}`,
+			match:   []string{`"ab-12"`, `"c-123"`},
+			nomatch: []string{`"d-12"`, `"a-1"`, `"a-1234"`, `"xa-12"`},
+		},
+		{
+			name:    "unanchored pattern",
+			schema:  `{"type": "string", "pattern": "(?i)ok"}`,
+			match:   []string{`"ok"`, `"is OK?"`},
+			nomatch: []string{`"no"`},
+		},
+		{
+			name:    "pattern with escaped characters",
+			schema:  `{"type": "string", "pattern": "^a\"[^a-z]\\\\$"}`,
+			match:   []string{`"a\"B\\"`, `"a\"\"\\"`},
+			nomatch: []string{`"a"b\\"`, `"a\"b\\"`},
+		},
+		{
+			name:    "string length",
+			schema:  `{"type": "string", "minLength": 2, "maxLength": 3}`,
+			match:   []string{`"ab"`, `"a\nc"`},
+			nomatch: []string{`"a"`, `"abcd"`},
+		},
+		{
+			name:    "formats",
+			schema:  `{"type": "array", "prefixItems": [{"type": "string", "format": "date"}, {"type": "string", "format": "uuid"}]}`,
+			match:   []string{`["2024-02-29", "123e4567-e89b-12d3-a456-426614174000"]`},
+			nomatch: []string{`["2024-13-01", "123e4567-e89b-12d3-a456-426614174000"]`, `["2024-01-01", "123"]`},
+		},
+		{
+			name:    "anyOf",
+			schema:  `{"anyOf": [{"type": "integer"}, {"type": "object", "properties": {"a": {"type": "string"}}, "required": ["a"]}]}`,
+			match:   []string{`12`, `{"a": "b"}`},
+			nomatch: []string{`"12"`, `{}`},
+		},
+		{
+			name:    "type list",
+			schema:  `{"type": ["string", "null"]}`,
+			match:   []string{`"a"`, `null`},
+			nomatch: []string{`1`},
+		},
+		{
+			name:    "integer range",
+			schema:  `{"type": "integer", "minimum": -15, "maximum": 120}`,
+			match:   []string{`-15`, `-9`, `0`, `7`, `99`, `100`, `120`},
+			nomatch: []string{`-16`, `121`, `200`, `007`, `-0`},
+		},
+		{
+			name:    "exclusive integer range",
+			schema:  `{"type": "integer", "exclusiveMinimum": 0, "exclusiveMaximum": 1000}`,
+			match:   []string{`1`, `999`, `500`},
+			nomatch: []string{`0`, `1000`, `-1`},
+		},
+		{
+			name:    "references",
+			schema:  `{"$defs": {"node": {"type": "object", "properties": {"value": {"type": "integer"}, "next": {"anyOf": [{"$ref": "#/$defs/node"}, {"type": "null"}]}}, "required": ["value", "next"]}}, "$ref": "#/$defs/node"}`,
+			match:   []string{`{"value": 1, "next": null}`, `{"value": 1, "next": {"value": 2, "next": null}}`},
+			nomatch: []string{`{"value": 1}`, `{"value": 1, "next": {"value": 2}}`},
+		},
+		{
+			name:    "allOf",
+			schema:  `{"allOf": [{"properties": {"a": {"type": "integer"}}, "required": ["a"]}, {"properties": {"b": {"type": "integer"}}}]}`,
+			match:   []string{`{"a": 1}`, `{"a": 1, "b": 2}`},
+			nomatch: []string{`{"b": 2}`},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := FromSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := newMatcher(t, g, append(tt.match, tt.nomatch...)...)
+			for _, doc := range tt.match {
+				if !m.match(t, doc) {
+					t.Errorf("expected %s to match\n%s", doc, g)
+				}
+			}
+
+			for _, doc := range tt.nomatch {
+				if m.match(t, doc) {
+					t.Errorf("expected %s not to match\n%s", doc, g)
+				}
+			}
+		})
+	}
+}
+
+func TestFromSchemaErrors(t *testing.T) {
+	cases := []struct {
+		schema string
+		err    string
+	}{
+		{`{"oneOf": [{"type": "string"}]}`, "schema: oneOf is not supported; use anyOf"},
+		{`{"properties": {"x": {"type": "integer", "multipleOf": 2}}}`, "schema at /properties/x: multipleOf is not supported"},
+		{`{"type": "array", "items": {"not": {}}}`, "schema at /items: not is not supported"},
+		{`{"type": "string", "format": "email"}`, `schema at /format: format "email" is not supported`},
+		{`{"type": "string", "pattern": "a\\bb"}`, "schema at /pattern: word boundaries are not supported"},
+		{`{"type": "string", "pattern": "a^b"}`, "schema at /pattern: anchors are only supported at the start and end of the pattern"},
+		{`{"type": "string", "pattern": "^ab", "maxLength": 3}`, "schema: pattern together with minLength or maxLength is not supported"},
+		{`{"type": "number", "minimum": 0}`, "schema: minimum and maximum are only supported for integers"},
+		{`{"type": "array", "uniqueItems": true}`, "schema: uniqueItems is not supported"},
+		{`{"properties": {"a": {}}, "additionalProperties": true}`, "schema at /additionalProperties: additional properties alongside properties are not supported"},
+		{`{"properties": {"a": {}}, "required": ["b"]}`, `schema at /required: "b" is not one of the properties`},
+		{`{"$ref": "https://example.com/schema.json"}`, `schema at /$ref: only local references are supported, got "https://example.com/schema.json"`},
+		{`{"$ref": "#/$defs/missing"}`, `schema at /$ref: "#/$defs/missing" does not exist`},
+		{`{"type": "integer", "minimum": 5, "maximum": 4}`, "schema: no integer is between the minimum and maximum"},
+		{`{"type": "uint"}`, `schema at /type: unknown type "uint"`},
+		{`{"enum": []}`, "schema at /enum: an empty enum matches nothing"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.schema, func(t *testing.T) {
+			_, err := FromSchema([]byte(tt.schema))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			if err.Error() != tt.err {
+				t.Errorf("expected error %q, got %q", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestFromFormat(t *testing.T) {
+	for _, format := range []string{``, `null`, `""`} {
+		g, err := FromFormat(json.RawMessage(format))
+		if err != nil || g != "" {
+			t.Errorf("%q: expected no grammar, got %q, %v", format, g, err)
+		}
+	}
+
+	g, err := FromFormat(json.RawMessage(`"json"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newMatcher(t, g, `{"a": [1, "b"]}`, `[1]`)
+	if !m.match(t, `{"a": [1, "b"]}`) {
+		t.Error("expected object to match")
+	}
+
+	if m.match(t, `[1]`) {
+		t.Error("expected array not to match")
+	}
+
+	if _, err := FromFormat(json.RawMessage(`"yaml"`)); err == nil || !strings.HasPrefix(err.Error(), "invalid format") {
+		t.Errorf("expected invalid format error, got %v", err)
+	}
+
+	if _, err := FromFormat(json.RawMessage(`{"oneOf": []}`)); err == nil || err.Error() != "invalid JSON schema in format: schema: oneOf is not supported; use anyOf" {
+		t.Errorf("expected invalid schema error, got %v", err)
+	}
+}
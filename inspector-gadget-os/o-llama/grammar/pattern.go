@@ -0,0 +1,233 @@
+package grammar
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// pattern returns an expression matching the contents of a JSON string whose
+// value matches a regular expression. Patterns aren't anchored unless they
+// start with ^ or end with $, following JSON Schema.
+func (c *compiler) pattern(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	re = re.Simplify()
+
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+
+	begin := len(subs) > 0 && isAnchor(subs[0], syntax.OpBeginText, syntax.OpBeginLine)
+	if begin {
+		subs = subs[1:]
+	}
+
+	end := len(subs) > 0 && isAnchor(subs[len(subs)-1], syntax.OpEndText, syntax.OpEndLine)
+	if end {
+		subs = subs[:len(subs)-1]
+	}
+
+	var parts []string
+	if !begin {
+		parts = append(parts, c.primitive("char")+"*")
+	}
+
+	for _, sub := range subs {
+		part, err := c.regexp(sub)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+
+	if !end {
+		parts = append(parts, c.primitive("char")+"*")
+	}
+
+	if len(parts) == 0 {
+		return `""`, nil
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+func isAnchor(re *syntax.Regexp, ops ...syntax.Op) bool {
+	for _, op := range ops {
+		if re.Op == op {
+			return true
+		}
+	}
+	return false
+}
+
+// regexp returns an expression for a part of a pattern
+func (c *compiler) regexp(re *syntax.Regexp) (string, error) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return `""`, nil
+	case syntax.OpLiteral:
+		var parts []string
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 {
+				folded := []rune{r, r}
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					folded = append(folded, f, f)
+				}
+				parts = append(parts, charClass(folded))
+			} else {
+				parts = append(parts, literal(jsonEscape(r)))
+			}
+		}
+		return strings.Join(parts, " "), nil
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return "", errors.New("empty character classes are not supported")
+		}
+		return charClass(re.Rune), nil
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return c.primitive("char"), nil
+	case syntax.OpCapture:
+		sub, err := c.regexp(re.Sub[0])
+		if err != nil {
+			return "", err
+		}
+		return "( " + sub + " )", nil
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		sub, err := c.regexp(re.Sub[0])
+		if err != nil {
+			return "", err
+		}
+
+		switch re.Op {
+		case syntax.OpStar:
+			return repeat(sub, 0, -1), nil
+		case syntax.OpPlus:
+			return repeat(sub, 1, -1), nil
+		case syntax.OpQuest:
+			return repeat(sub, 0, 1), nil
+		}
+
+		if re.Max == 0 {
+			return `""`, nil
+		}
+		return repeat(sub, re.Min, re.Max), nil
+	case syntax.OpConcat, syntax.OpAlternate:
+		var parts []string
+		for _, sub := range re.Sub {
+			part, err := c.regexp(sub)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+
+		if re.Op == syntax.OpConcat {
+			return strings.Join(parts, " "), nil
+		}
+		return "( " + strings.Join(parts, " | ") + " )", nil
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return "", errors.New("anchors are only supported at the start and end of the pattern")
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return "", errors.New("word boundaries are not supported")
+	case syntax.OpNoMatch:
+		return "", errors.New("the pattern matches nothing")
+	default:
+		return "", fmt.Errorf("%s is not supported", re)
+	}
+}
+
+// jsonEscape returns a character as it is written in a JSON string
+func jsonEscape(r rune) string {
+	switch r {
+	case '"':
+		return `\"`
+	case '\\':
+		return `\\`
+	case '\b':
+		return `\b`
+	case '\f':
+		return `\f`
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	}
+
+	if r < 0x20 {
+		return fmt.Sprintf(`\u%04x`, r)
+	}
+
+	return string(r)
+}
+
+// charClass returns an expression matching the characters in ranges, given
+// as pairs of the first and last character in each range. Characters that
+// must be escaped in JSON are matched in their escaped form.
+func charClass(ranges []rune) string {
+	var class, escaped []string
+	add := func(lo, hi rune) {
+		if lo > hi {
+			return
+		}
+
+		if lo == hi {
+			class = append(class, classChar(lo))
+		} else {
+			class = append(class, classChar(lo)+"-"+classChar(hi))
+		}
+	}
+
+	for i := 0; i < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		for _, r := range []rune{'"', '\\'} {
+			if lo <= r && r <= hi {
+				escaped = append(escaped, literal(jsonEscape(r)))
+			}
+		}
+
+		for r := lo; r <= min(hi, 0x1f); r++ {
+			escaped = append(escaped, literal(jsonEscape(r)))
+		}
+
+		lo = max(lo, 0x20)
+		for _, r := range []rune{'"', '\\'} {
+			if lo <= r && r <= hi {
+				add(lo, r-1)
+				lo = r + 1
+			}
+		}
+		add(lo, hi)
+	}
+
+	alts := escaped
+	if len(class) > 0 {
+		alts = append([]string{"[" + strings.Join(class, "") + "]"}, alts...)
+	}
+
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	return "( " + strings.Join(alts, " | ") + " )"
+}
+
+// classChar writes a character for use in a grammar character class
+func classChar(r rune) string {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return string(r)
+	case r <= 0xff:
+		return fmt.Sprintf(`\x%02X`, r)
+	case r <= 0xffff:
+		return fmt.Sprintf(`\u%04X`, r)
+	default:
+		return fmt.Sprintf(`\U%08X`, r)
+	}
+}
@@ -0,0 +1,788 @@
+package grammar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// schema holds the keywords of a JSON Schema that the compiler understands
+type schema struct {
+	Type                 schemaType        `json:"type"`
+	Properties           properties        `json:"properties"`
+	Required             []string          `json:"required"`
+	AdditionalProperties json.RawMessage   `json:"additionalProperties"`
+	Items                json.RawMessage   `json:"items"`
+	PrefixItems          []json.RawMessage `json:"prefixItems"`
+	MinItems             *int              `json:"minItems"`
+	MaxItems             *int              `json:"maxItems"`
+	UniqueItems          bool              `json:"uniqueItems"`
+	MinLength            *int              `json:"minLength"`
+	MaxLength            *int              `json:"maxLength"`
+	Pattern              *string           `json:"pattern"`
+	Format               string            `json:"format"`
+	Minimum              *float64          `json:"minimum"`
+	Maximum              *float64          `json:"maximum"`
+	ExclusiveMinimum     json.RawMessage   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     json.RawMessage   `json:"exclusiveMaximum"`
+	Enum                 []json.RawMessage `json:"enum"`
+	Const                json.RawMessage   `json:"const"`
+	AnyOf                []json.RawMessage `json:"anyOf"`
+	AllOf                []json.RawMessage `json:"allOf"`
+	Ref                  string            `json:"$ref"`
+
+	// keywords lists every keyword of the schema, including those that
+	// aren't supported
+	keywords map[string]json.RawMessage
+}
+
+// unsupported maps keywords that a grammar can't enforce to an explanation
+var unsupported = map[string]string{
+	"oneOf":                 "oneOf is not supported; use anyOf",
+	"not":                   "not is not supported",
+	"if":                    "if/then/else is not supported",
+	"then":                  "if/then/else is not supported",
+	"else":                  "if/then/else is not supported",
+	"patternProperties":     "patternProperties is not supported",
+	"propertyNames":         "propertyNames is not supported",
+	"dependencies":          "dependencies is not supported",
+	"dependentRequired":     "dependentRequired is not supported",
+	"dependentSchemas":      "dependentSchemas is not supported",
+	"unevaluatedProperties": "unevaluatedProperties is not supported",
+	"unevaluatedItems":      "unevaluatedItems is not supported",
+	"minProperties":         "minProperties is not supported",
+	"maxProperties":         "maxProperties is not supported",
+	"contains":              "contains is not supported",
+	"minContains":           "minContains is not supported",
+	"maxContains":           "maxContains is not supported",
+	"multipleOf":            "multipleOf is not supported",
+	"$dynamicRef":           "$dynamicRef is not supported",
+	"$recursiveRef":         "$recursiveRef is not supported",
+}
+
+// schemaType is the type keyword, which may be a single type or a list
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = schemaType{s}
+		return nil
+	}
+
+	var types []string
+	if err := json.Unmarshal(data, &types); err != nil {
+		return errors.New("type must be a string or a list of strings")
+	}
+
+	*t = types
+	return nil
+}
+
+type property struct {
+	name   string
+	schema json.RawMessage
+}
+
+// properties holds the properties of an object schema in the order that they
+// are declared, which is the order that they will be generated in
+type properties []property
+
+func (p *properties) UnmarshalJSON(data []byte) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	if t, err := d.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return errors.New("properties must be an object")
+	}
+
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		var value json.RawMessage
+		if err := d.Decode(&value); err != nil {
+			return err
+		}
+
+		*p = append(*p, property{name: t.(string), schema: value})
+	}
+
+	return nil
+}
+
+func parseSchema(raw json.RawMessage) (*schema, error) {
+	var s schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, &s.keywords); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// isBool reports whether raw is the JSON boolean b
+func isBool(raw json.RawMessage, b bool) bool {
+	return string(bytes.TrimSpace(raw)) == strconv.FormatBool(b)
+}
+
+// visit adds the rules for a schema, found at path in the root schema, and
+// returns the name of the rule that matches it
+func (c *compiler) visit(raw json.RawMessage, path, name string) (string, error) {
+	switch {
+	case len(raw) == 0, isBool(raw, true):
+		return c.primitive("value"), nil
+	case isBool(raw, false):
+		return "", fmt.Errorf("%s: a false schema matches nothing", pointer(path))
+	}
+
+	s, err := parseSchema(raw)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", pointer(path), err)
+	}
+
+	for _, keyword := range slices.Sorted(maps.Keys(s.keywords)) {
+		if reason, ok := unsupported[keyword]; ok {
+			return "", fmt.Errorf("%s: %s", pointer(path), reason)
+		}
+	}
+
+	switch {
+	case s.Ref != "":
+		return c.ref(s.Ref, path)
+	case len(s.AllOf) > 0:
+		return c.allOf(s, path, name)
+	case len(s.AnyOf) > 0:
+		var alts []string
+		for i, sub := range s.AnyOf {
+			alt, err := c.visit(sub, fmt.Sprintf("%s/anyOf/%d", path, i), fmt.Sprintf("%s-%d", name, i))
+			if err != nil {
+				return "", err
+			}
+			alts = append(alts, alt)
+		}
+		return c.add(name, strings.Join(alts, " | ")), nil
+	case s.Const != nil:
+		lit, err := jsonLiteral(s.Const)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", pointer(path+"/const"), err)
+		}
+		return c.add(name, lit+" "+c.primitive("space")), nil
+	case s.Enum != nil:
+		if len(s.Enum) == 0 {
+			return "", fmt.Errorf("%s: an empty enum matches nothing", pointer(path+"/enum"))
+		}
+
+		var alts []string
+		for _, v := range s.Enum {
+			lit, err := jsonLiteral(v)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", pointer(path+"/enum"), err)
+			}
+			alts = append(alts, lit)
+		}
+		return c.add(name, "("+strings.Join(alts, " | ")+") "+c.primitive("space")), nil
+	}
+
+	types := s.Type
+	if len(types) == 0 {
+		switch {
+		case s.Properties != nil || s.AdditionalProperties != nil || s.Required != nil:
+			types = schemaType{"object"}
+		case s.Items != nil || s.PrefixItems != nil:
+			types = schemaType{"array"}
+		case s.Pattern != nil || s.Format != "" || s.MinLength != nil || s.MaxLength != nil:
+			types = schemaType{"string"}
+		default:
+			return c.primitive("value"), nil
+		}
+	}
+
+	if len(types) > 1 {
+		var alts []string
+		for _, t := range types {
+			alt, err := c.visitType(s, t, path, name+"-"+t)
+			if err != nil {
+				return "", err
+			}
+			alts = append(alts, alt)
+		}
+		return c.add(name, strings.Join(alts, " | ")), nil
+	}
+
+	return c.visitType(s, types[0], path, name)
+}
+
+func (c *compiler) visitType(s *schema, typ, path, name string) (string, error) {
+	switch typ {
+	case "object":
+		return c.object(s, path, name)
+	case "array":
+		return c.array(s, path, name)
+	case "string":
+		return c.string(s, path, name)
+	case "integer":
+		return c.integer(s, path, name)
+	case "number":
+		if s.Minimum != nil || s.Maximum != nil || s.ExclusiveMinimum != nil || s.ExclusiveMaximum != nil {
+			return "", fmt.Errorf("%s: minimum and maximum are only supported for integers", pointer(path))
+		}
+		return c.primitive("number"), nil
+	case "boolean":
+		return c.primitive("boolean"), nil
+	case "null":
+		return c.primitive("null"), nil
+	default:
+		return "", fmt.Errorf("%s: unknown type %q", pointer(path+"/type"), typ)
+	}
+}
+
+// ref visits the schema that a local reference points to, such as
+// "#/$defs/Item". Each reference becomes a rule, so references may be
+// recursive.
+func (c *compiler) ref(ref, path string) (string, error) {
+	if name, ok := c.refs[ref]; ok {
+		return name, nil
+	}
+
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return "", fmt.Errorf("%s: only local references are supported, got %q", pointer(path+"/$ref"), ref)
+	}
+
+	target := c.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(target, &object); err != nil {
+			return "", fmt.Errorf("%s: %q does not exist", pointer(path+"/$ref"), ref)
+		}
+
+		var ok bool
+		if target, ok = object[token]; !ok {
+			return "", fmt.Errorf("%s: %q does not exist", pointer(path+"/$ref"), ref)
+		}
+	}
+
+	name := "root"
+	if ref != "#" {
+		name = ref[strings.LastIndex(ref, "/")+1:]
+	}
+
+	// the name is reserved first so that recursive references find it
+	name = c.reserve(name)
+	c.refs[ref] = name
+
+	body, err := c.visit(target, strings.TrimPrefix(ref, "#"), name)
+	if err != nil {
+		return "", err
+	}
+
+	if body != name {
+		c.rules[name] = body
+	}
+
+	return name, nil
+}
+
+// allOf merges schemas that are all objects into one object
+func (c *compiler) allOf(s *schema, path, name string) (string, error) {
+	if len(s.AllOf) == 1 && len(s.keywords) == 1 {
+		return c.visit(s.AllOf[0], path+"/allOf/0", name)
+	}
+
+	merged := &schema{Type: schemaType{"object"}}
+	for i, raw := range append([]json.RawMessage{nil}, s.AllOf...) {
+		sub := *s
+		sub.AllOf = nil
+		if raw != nil {
+			p, err := c.resolve(raw, fmt.Sprintf("%s/allOf/%d", path, i-1))
+			if err != nil {
+				return "", err
+			}
+			sub = *p
+		}
+
+		if len(sub.Type) > 0 && !slices.Equal(sub.Type, schemaType{"object"}) {
+			return "", fmt.Errorf("%s: only objects can be combined", pointer(path+"/allOf"))
+		}
+
+		if sub.AdditionalProperties != nil || len(sub.AllOf) > 0 || len(sub.AnyOf) > 0 || sub.Enum != nil || sub.Const != nil {
+			return "", fmt.Errorf("%s: only objects with properties and required can be combined", pointer(path+"/allOf"))
+		}
+
+		merged.Properties = append(merged.Properties, sub.Properties...)
+		merged.Required = append(merged.Required, sub.Required...)
+	}
+
+	return c.object(merged, path, name)
+}
+
+// resolve parses a schema, following a reference if it is one
+func (c *compiler) resolve(raw json.RawMessage, path string) (*schema, error) {
+	for range 32 {
+		s, err := parseSchema(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pointer(path), err)
+		}
+
+		if s.Ref == "" {
+			return s, nil
+		}
+
+		if !strings.HasPrefix(s.Ref, "#/") {
+			return nil, fmt.Errorf("%s: only local references are supported, got %q", pointer(path+"/$ref"), s.Ref)
+		}
+
+		target := c.root
+		for _, token := range strings.Split(s.Ref, "/")[1:] {
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal(target, &object); err != nil {
+				return nil, fmt.Errorf("%s: %q does not exist", pointer(path+"/$ref"), s.Ref)
+			}
+
+			var ok bool
+			if target, ok = object[token]; !ok {
+				return nil, fmt.Errorf("%s: %q does not exist", pointer(path+"/$ref"), s.Ref)
+			}
+		}
+
+		raw, path = target, strings.TrimPrefix(s.Ref, "#")
+	}
+
+	return nil, fmt.Errorf("%s: too many nested references", pointer(path))
+}
+
+func (c *compiler) object(s *schema, path, name string) (string, error) {
+	space := c.primitive("space")
+
+	for _, req := range s.Required {
+		if !slices.ContainsFunc(s.Properties, func(p property) bool { return p.name == req }) {
+			if s.AdditionalProperties == nil || isBool(s.AdditionalProperties, false) {
+				return "", fmt.Errorf("%s: %q is not one of the properties", pointer(path+"/required"), req)
+			}
+			return "", fmt.Errorf("%s: required properties that aren't listed in properties are not supported", pointer(path+"/required"))
+		}
+	}
+
+	if len(s.Properties) == 0 {
+		switch {
+		case s.AdditionalProperties == nil && s.Properties == nil, isBool(s.AdditionalProperties, true):
+			return c.primitive("object"), nil
+		case s.AdditionalProperties == nil, isBool(s.AdditionalProperties, false):
+			return c.add(name, `"{" `+space+` "}" `+space), nil
+		}
+
+		// an object whose values all match a schema
+		value, err := c.visit(s.AdditionalProperties, path+"/additionalProperties", name+"-value")
+		if err != nil {
+			return "", err
+		}
+
+		kv := c.add(name+"-kv", c.primitive("string")+` ":" `+space+" "+value)
+		return c.add(name, `"{" `+space+` ( `+kv+` ( "," `+space+" "+kv+` )* )? "}" `+space), nil
+	}
+
+	if s.AdditionalProperties != nil && !isBool(s.AdditionalProperties, false) {
+		return "", fmt.Errorf("%s: additional properties alongside properties are not supported", pointer(path+"/additionalProperties"))
+	}
+
+	kvs := make(map[string]string)
+	var required, optional []string
+	for _, p := range s.Properties {
+		if _, ok := kvs[p.name]; ok {
+			continue
+		}
+
+		value, err := c.visit(p.schema, path+"/properties/"+escapePointer(p.name), name+"-"+p.name)
+		if err != nil {
+			return "", err
+		}
+
+		key, err := jsonLiteral(json.RawMessage(strconv.Quote(p.name)))
+		if err != nil {
+			return "", err
+		}
+
+		kvs[p.name] = c.add(name+"-"+p.name+"-kv", key+" "+space+` ":" `+space+" "+value)
+		if slices.Contains(s.Required, p.name) {
+			required = append(required, p.name)
+		} else {
+			optional = append(optional, p.name)
+		}
+	}
+
+	// required properties come first, in order, followed by any of the
+	// optional properties, also in order
+	var sb strings.Builder
+	sb.WriteString(`"{" ` + space)
+	for i, p := range required {
+		if i > 0 {
+			sb.WriteString(` "," ` + space)
+		}
+		sb.WriteString(" " + kvs[p])
+	}
+
+	if len(optional) > 0 {
+		// rest matches the optional properties from i onwards, each
+		// preceded by a comma
+		var rest func(i int) string
+		rest = func(i int) string {
+			s := `( "," ` + space + " " + kvs[optional[i]] + " )?"
+			if i+1 < len(optional) {
+				s += " " + c.add(name+"-"+optional[i]+"-rest", rest(i+1))
+			}
+			return s
+		}
+
+		var alts []string
+		for i, p := range optional {
+			alt := kvs[p]
+			if i+1 < len(optional) {
+				alt += " " + c.add(name+"-"+p+"-rest", rest(i+1))
+			}
+			alts = append(alts, alt)
+		}
+
+		if len(required) > 0 {
+			sb.WriteString(` ( "," ` + space + " ( " + strings.Join(alts, " | ") + " ) )?")
+		} else {
+			sb.WriteString(" ( " + strings.Join(alts, " | ") + " )?")
+		}
+	}
+
+	sb.WriteString(` "}" ` + space)
+	return c.add(name, sb.String()), nil
+}
+
+func (c *compiler) array(s *schema, path, name string) (string, error) {
+	space := c.primitive("space")
+
+	if s.UniqueItems {
+		return "", fmt.Errorf("%s: uniqueItems is not supported", pointer(path))
+	}
+
+	if len(s.PrefixItems) > 0 {
+		if s.MinItems != nil || s.MaxItems != nil {
+			return "", fmt.Errorf("%s: minItems and maxItems together with prefixItems are not supported", pointer(path))
+		}
+
+		var sb strings.Builder
+		sb.WriteString(`"[" ` + space)
+		for i, item := range s.PrefixItems {
+			rule, err := c.visit(item, fmt.Sprintf("%s/prefixItems/%d", path, i), fmt.Sprintf("%s-%d", name, i))
+			if err != nil {
+				return "", err
+			}
+
+			if i > 0 {
+				sb.WriteString(` "," ` + space)
+			}
+			sb.WriteString(" " + rule)
+		}
+
+		if s.Items != nil && !isBool(s.Items, false) {
+			rule, err := c.visit(s.Items, path+"/items", name+"-item")
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(` ( "," ` + space + " " + rule + " )*")
+		}
+
+		sb.WriteString(` "]" ` + space)
+		return c.add(name, sb.String()), nil
+	}
+
+	item, err := c.visit(s.Items, path+"/items", name+"-item")
+	if err != nil {
+		return "", err
+	}
+
+	lo := 0
+	if s.MinItems != nil {
+		lo = *s.MinItems
+	}
+
+	hi := -1
+	if s.MaxItems != nil {
+		hi = *s.MaxItems
+	}
+
+	if lo < 0 || (hi >= 0 && hi < lo) {
+		return "", fmt.Errorf("%s: invalid minItems and maxItems", pointer(path))
+	}
+
+	if hi == 0 {
+		return c.add(name, `"[" `+space+` "]" `+space), nil
+	}
+
+	items := item + " " + repeat(`"," `+space+" "+item, max(lo-1, 0), hi-1)
+	if lo == 0 {
+		items = "( " + items + " )?"
+	}
+
+	return c.add(name, `"[" `+space+" "+items+` "]" `+space), nil
+}
+
+// repeat returns expr repeated between lo and hi times, with hi < 0 for no
+// upper limit
+func repeat(expr string, lo, hi int) string {
+	switch {
+	case hi == 0:
+		return ""
+	case lo == 0 && hi < 0:
+		return "( " + expr + " )*"
+	case lo == 1 && hi < 0:
+		return "( " + expr + " )+"
+	case lo == 0 && hi == 1:
+		return "( " + expr + " )?"
+	case hi < 0:
+		return fmt.Sprintf("( %s ){%d,}", expr, lo)
+	case lo == hi:
+		return fmt.Sprintf("( %s ){%d}", expr, lo)
+	default:
+		return fmt.Sprintf("( %s ){%d,%d}", expr, lo, hi)
+	}
+}
+
+func (c *compiler) string(s *schema, path, name string) (string, error) {
+	if s.Format != "" {
+		switch s.Format {
+		case "date", "time", "date-time", "uuid":
+		default:
+			return "", fmt.Errorf("%s: format %q is not supported", pointer(path+"/format"), s.Format)
+		}
+
+		if s.Pattern != nil || s.MinLength != nil || s.MaxLength != nil {
+			return "", fmt.Errorf("%s: format together with pattern, minLength or maxLength is not supported", pointer(path))
+		}
+
+		return c.primitive(s.Format + "-string"), nil
+	}
+
+	if s.Pattern != nil {
+		if s.MinLength != nil || s.MaxLength != nil {
+			return "", fmt.Errorf("%s: pattern together with minLength or maxLength is not supported", pointer(path))
+		}
+
+		body, err := c.pattern(*s.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", pointer(path+"/pattern"), err)
+		}
+
+		return c.add(name, `"\"" `+body+` "\"" `+c.primitive("space")), nil
+	}
+
+	if s.MinLength == nil && s.MaxLength == nil {
+		return c.primitive("string"), nil
+	}
+
+	lo := 0
+	if s.MinLength != nil {
+		lo = *s.MinLength
+	}
+
+	hi := -1
+	if s.MaxLength != nil {
+		hi = *s.MaxLength
+	}
+
+	if lo < 0 || (hi >= 0 && hi < lo) {
+		return "", fmt.Errorf("%s: invalid minLength and maxLength", pointer(path))
+	}
+
+	char := c.primitive("char")
+	body := `"\"" ` + repeat(char, lo, hi) + ` "\"" ` + c.primitive("space")
+	if hi == 0 {
+		body = `"\"" "\"" ` + c.primitive("space")
+	}
+
+	return c.add(name, body), nil
+}
+
+// maxInteger is the largest magnitude of the integers that are generated,
+// matching the 16 digits of integral-part
+const maxInteger = 9_999_999_999_999_999
+
+func (c *compiler) integer(s *schema, path, name string) (string, error) {
+	lo, hi := int64(-maxInteger), int64(maxInteger)
+
+	bound := func(keyword string, v float64, exclusive bool) error {
+		if math.Abs(v) > maxInteger {
+			return fmt.Errorf("%s: must be between -%d and %d", pointer(path+"/"+keyword), int64(maxInteger), int64(maxInteger))
+		}
+
+		if strings.HasSuffix(keyword, "inimum") {
+			n := int64(math.Ceil(v))
+			if exclusive && float64(n) == v {
+				n++
+			}
+			lo = max(lo, n)
+		} else {
+			n := int64(math.Floor(v))
+			if exclusive && float64(n) == v {
+				n--
+			}
+			hi = min(hi, n)
+		}
+
+		return nil
+	}
+
+	// exclusiveMinimum and exclusiveMaximum are numbers, or in older
+	// drafts, booleans that make minimum and maximum exclusive
+	exclusive := func(keyword string, raw json.RawMessage, limit *float64) (bool, error) {
+		if raw == nil || isBool(raw, false) {
+			return false, nil
+		} else if isBool(raw, true) {
+			if limit == nil {
+				return false, fmt.Errorf("%s: requires %s", pointer(path+"/"+keyword), strings.ToLower(strings.TrimPrefix(keyword, "exclusive")))
+			}
+			return true, nil
+		}
+
+		var v float64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return false, fmt.Errorf("%s: must be a number", pointer(path+"/"+keyword))
+		}
+		return false, bound(keyword, v, true)
+	}
+
+	exclusiveMin, err := exclusive("exclusiveMinimum", s.ExclusiveMinimum, s.Minimum)
+	if err != nil {
+		return "", err
+	}
+
+	exclusiveMax, err := exclusive("exclusiveMaximum", s.ExclusiveMaximum, s.Maximum)
+	if err != nil {
+		return "", err
+	}
+
+	if s.Minimum != nil {
+		if err := bound("minimum", *s.Minimum, exclusiveMin); err != nil {
+			return "", err
+		}
+	}
+
+	if s.Maximum != nil {
+		if err := bound("maximum", *s.Maximum, exclusiveMax); err != nil {
+			return "", err
+		}
+	}
+
+	if lo == -maxInteger && hi == maxInteger {
+		return c.primitive("integer"), nil
+	}
+
+	if lo > hi {
+		return "", fmt.Errorf("%s: no integer is between the minimum and maximum", pointer(path))
+	}
+
+	return c.add(name, "("+integerRange(lo, hi)+") "+c.primitive("space")), nil
+}
+
+// integerRange returns an expression matching the integers from lo to hi
+func integerRange(lo, hi int64) string {
+	var alts []string
+	if lo < 0 {
+		alts = append(alts, `"-" (`+strings.Join(uintRange(uint64(-min(hi, -1)), uint64(-lo)), " | ")+")")
+	}
+
+	if hi >= 0 {
+		alts = append(alts, uintRange(uint64(max(lo, 0)), uint64(hi))...)
+	}
+
+	return strings.Join(alts, " | ")
+}
+
+// uintRange returns alternatives matching the non-negative integers from lo
+// to hi, written without leading zeros
+func uintRange(lo, hi uint64) []string {
+	var alts []string
+	for digits := len(strconv.FormatUint(lo, 10)); digits <= len(strconv.FormatUint(hi, 10)); digits++ {
+		first, last := uint64(0), uint64(9)
+		if digits > 1 {
+			first = uint64(math.Pow10(digits - 1))
+			last = first*10 - 1
+		}
+
+		alts = append(alts, digitRange(strconv.FormatUint(max(lo, first), 10), strconv.FormatUint(min(hi, last), 10))...)
+	}
+
+	return alts
+}
+
+// digitRange returns alternatives matching the numbers from a to b, which
+// have the same number of digits
+func digitRange(a, b string) []string {
+	if a == b {
+		return []string{literal(a)}
+	}
+
+	if a[0] == b[0] {
+		rest := digitRange(a[1:], b[1:])
+		if len(rest) == 1 {
+			return []string{literal(a[:1]) + " " + rest[0]}
+		}
+		return []string{literal(a[:1]) + " (" + strings.Join(rest, " | ") + ")"}
+	}
+
+	n := len(a) - 1
+	anyDigits := ""
+	switch n {
+	case 0:
+	case 1:
+		anyDigits = " [0-9]"
+	default:
+		anyDigits = fmt.Sprintf(" [0-9]{%d}", n)
+	}
+
+	var alts []string
+	lo, hi := a[0], b[0]
+	if strings.Trim(a[1:], "0") != "" {
+		for _, rest := range digitRange(a[1:], strings.Repeat("9", n)) {
+			alts = append(alts, literal(a[:1])+" "+rest)
+		}
+		lo++
+	}
+
+	var upper []string
+	if strings.Trim(b[1:], "9") != "" {
+		for _, rest := range digitRange(strings.Repeat("0", n), b[1:]) {
+			upper = append(upper, literal(b[:1])+" "+rest)
+		}
+		hi--
+	}
+
+	switch {
+	case lo == hi:
+		alts = append(alts, literal(string(lo))+anyDigits)
+	case lo < hi:
+		alts = append(alts, fmt.Sprintf("[%c-%c]", lo, hi)+anyDigits)
+	}
+
+	return append(alts, upper...)
+}
+
+// pointer formats a path within the schema for error messages
+func pointer(path string) string {
+	if path == "" {
+		return "schema"
+	}
+	return "schema at " + path
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
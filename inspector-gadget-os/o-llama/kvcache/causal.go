@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"math"
 	"slices"
 
@@ -593,21 +594,7 @@ func (c *Causal) Put(ctx ml.Context, key, value ml.Tensor) {
 		panic(fmt.Errorf("inconsistent batch sizes (layer: %v, batch size: %v layer batch size: %v)", c.curLayer, c.curBatchSize, batchSize))
 	}
 
-	if _, ok := c.ctxs[c.curLayer]; !ok {
-		c.ctxs[c.curLayer] = c.backend.NewContextSize(2).Layer(c.curLayer)
-	}
-
-	if _, ok := c.keys[c.curLayer]; !ok {
-		c.keys[c.curLayer] = c.ctxs[c.curLayer].Zeros(c.DType, kHeadDim, numKVHeads, len(c.cells))
-	}
-
-	if _, ok := c.values[c.curLayer]; !ok {
-		if c.config.PermutedV {
-			c.values[c.curLayer] = c.ctxs[c.curLayer].Zeros(c.DType, len(c.cells), vHeadDim, numKVHeads)
-		} else {
-			c.values[c.curLayer] = c.ctxs[c.curLayer].Zeros(c.DType, vHeadDim, numKVHeads, len(c.cells))
-		}
-	}
+	c.allocLayer(c.curLayer, kHeadDim, vHeadDim, numKVHeads)
 
 	rowSize := c.keys[c.curLayer].Stride(2)
 	ctx.Forward(key.Copy(ctx, c.keys[c.curLayer].View(ctx, rowSize*c.curLoc, kHeadDim*numKVHeads*batchSize)))
@@ -624,6 +611,26 @@ func (c *Causal) Put(ctx ml.Context, key, value ml.Tensor) {
 	}
 }
 
+// allocLayer creates the storage for a layer's keys and values if it does
+// not already exist
+func (c *Causal) allocLayer(layer, kHeadDim, vHeadDim, numKVHeads int) {
+	if _, ok := c.ctxs[layer]; !ok {
+		c.ctxs[layer] = c.backend.NewContextSize(2).Layer(layer)
+	}
+
+	if _, ok := c.keys[layer]; !ok {
+		c.keys[layer] = c.ctxs[layer].Zeros(c.DType, kHeadDim, numKVHeads, len(c.cells))
+	}
+
+	if _, ok := c.values[layer]; !ok {
+		if c.config.PermutedV {
+			c.values[layer] = c.ctxs[layer].Zeros(c.DType, len(c.cells), vHeadDim, numKVHeads)
+		} else {
+			c.values[layer] = c.ctxs[layer].Zeros(c.DType, vHeadDim, numKVHeads, len(c.cells))
+		}
+	}
+}
+
 func (c *Causal) CopyPrefix(srcSeq, dstSeq int, len int32) {
 	seqRange := newRange()
 
@@ -647,6 +654,198 @@ func (c *Causal) CopyPrefix(srcSeq, dstSeq int, len int32) {
 	c.cellRanges[dstSeq] = seqRange
 }
 
+func (c *Causal) Snapshot(seq int, length int32) (*Snapshot, error) {
+	snapshot := Snapshot{DType: c.DType}
+
+	var cells []int
+	if seqRange, ok := c.cellRanges[seq]; ok {
+		for i := seqRange.min; i <= seqRange.max; i++ {
+			if slices.Contains(c.cells[i].sequences, seq) && c.cells[i].pos < length {
+				cells = append(cells, i)
+				snapshot.Positions = append(snapshot.Positions, c.cells[i].pos)
+			}
+		}
+	}
+
+	if cells == nil {
+		return nil, errors.New("no cache entries to snapshot")
+	}
+
+	runs := cellRuns(cells)
+
+	for _, layer := range slices.Sorted(maps.Keys(c.keys)) {
+		key := c.keys[layer]
+		if key == nil {
+			continue
+		}
+
+		value := c.values[layer]
+
+		l := LayerSnapshot{
+			Layer:      layer,
+			KHeadDim:   key.Dim(0),
+			VHeadDim:   value.Dim(0),
+			NumKVHeads: key.Dim(1),
+		}
+		if c.config.PermutedV {
+			l.VHeadDim = value.Dim(1)
+		}
+
+		for start := 0; start < len(runs); {
+			ctx := c.backend.NewContext()
+			end := min(len(runs), start+maxSnapshotRuns(ctx))
+
+			entry := runs[start].entry
+			count := runs[end-1].entry + runs[end-1].count - entry
+
+			kOut := ctx.Input().Empty(c.DType, l.KHeadDim, l.NumKVHeads, count)
+			vOut := ctx.Input().Empty(c.DType, l.VHeadDim, l.NumKVHeads, count)
+
+			for _, run := range runs[start:end] {
+				offset := run.entry - entry
+
+				kSrc := key.View(ctx, key.Stride(2)*run.cell, l.KHeadDim*l.NumKVHeads*run.count)
+				kDst := kOut.View(ctx, kOut.Stride(2)*offset, l.KHeadDim*l.NumKVHeads*run.count)
+
+				var vSrc ml.Tensor
+				if c.config.PermutedV {
+					elemSize := value.Stride(0)
+					vSrc = value.View(ctx, elemSize*run.cell, run.count, len(c.cells)*elemSize, l.VHeadDim*l.NumKVHeads).Permute(ctx, 1, 0, 2, 3)
+				} else {
+					vSrc = value.View(ctx, value.Stride(2)*run.cell, l.VHeadDim*l.NumKVHeads*run.count)
+				}
+				vDst := vOut.View(ctx, vOut.Stride(2)*offset, l.VHeadDim*l.NumKVHeads*run.count)
+
+				ctx.Forward(kSrc.Copy(ctx, kDst), vSrc.Copy(ctx, vDst))
+			}
+
+			ctx.Compute(kOut, vOut)
+			l.Keys = append(l.Keys, kOut.Bytes()...)
+			l.Values = append(l.Values, vOut.Bytes()...)
+			ctx.Close()
+
+			start = end
+		}
+
+		snapshot.Layers = append(snapshot.Layers, l)
+	}
+
+	return &snapshot, nil
+}
+
+func (c *Causal) Restore(seq int, snapshot *Snapshot) error {
+	if snapshot.DType != c.DType {
+		return fmt.Errorf("snapshot type %v does not match cache type %v", snapshot.DType, c.DType)
+	}
+
+	if _, ok := c.cellRanges[seq]; ok {
+		return fmt.Errorf("sequence %v is not empty", seq)
+	}
+
+	n := len(snapshot.Positions)
+
+	cells := make([]int, 0, n)
+	for i := range c.cells {
+		if len(cells) == n {
+			break
+		}
+
+		if len(c.cells[i].sequences) == 0 {
+			cells = append(cells, i)
+		}
+	}
+
+	if len(cells) < n {
+		return ErrKvCacheFull
+	}
+
+	// Check everything before copying so that a mismatched snapshot
+	// doesn't leave a partially written cache behind
+	for _, l := range snapshot.Layers {
+		if key, ok := c.keys[l.Layer]; ok && key != nil && (key.Dim(0) != l.KHeadDim || key.Dim(1) != l.NumKVHeads) {
+			return fmt.Errorf("snapshot of layer %v has shape %v, %v; cache has %v, %v", l.Layer, l.KHeadDim, l.NumKVHeads, key.Dim(0), key.Dim(1))
+		}
+
+		c.allocLayer(l.Layer, l.KHeadDim, l.VHeadDim, l.NumKVHeads)
+
+		if len(l.Keys) != c.keys[l.Layer].Stride(2)*n || len(l.Values) != c.valueRowSize(l.Layer)*n {
+			return fmt.Errorf("snapshot of layer %v has %v bytes of keys and %v bytes of values for %v entries", l.Layer, len(l.Keys), len(l.Values), n)
+		}
+	}
+
+	runs := cellRuns(cells)
+
+	for _, l := range snapshot.Layers {
+		key := c.keys[l.Layer]
+		value := c.values[l.Layer]
+		kRowSize := key.Stride(2)
+		vRowSize := c.valueRowSize(l.Layer)
+
+		for start := 0; start < len(runs); {
+			ctx := c.backend.NewContext()
+			end := min(len(runs), start+maxSnapshotRuns(ctx))
+
+			entry := runs[start].entry
+			count := runs[end-1].entry + runs[end-1].count - entry
+
+			kIn := ctx.Input().FromBytes(c.DType, l.Keys[kRowSize*entry:kRowSize*(entry+count)], l.KHeadDim, l.NumKVHeads, count)
+			vIn := ctx.Input().FromBytes(c.DType, l.Values[vRowSize*entry:vRowSize*(entry+count)], l.VHeadDim, l.NumKVHeads, count)
+
+			for _, run := range runs[start:end] {
+				offset := run.entry - entry
+
+				kSrc := kIn.View(ctx, kIn.Stride(2)*offset, l.KHeadDim*l.NumKVHeads*run.count)
+				kDst := key.View(ctx, kRowSize*run.cell, l.KHeadDim*l.NumKVHeads*run.count)
+
+				vSrc := vIn.View(ctx, vIn.Stride(2)*offset, l.VHeadDim*l.NumKVHeads*run.count)
+				var vDst ml.Tensor
+				if c.config.PermutedV {
+					elemSize := value.Stride(0)
+					vSrc = vSrc.Reshape(ctx, l.VHeadDim*l.NumKVHeads, run.count).Permute(ctx, 1, 0, 2, 3)
+					vDst = value.View(ctx, elemSize*run.cell, run.count, len(c.cells)*elemSize, l.VHeadDim*l.NumKVHeads)
+				} else {
+					vDst = value.View(ctx, vRowSize*run.cell, l.VHeadDim*l.NumKVHeads*run.count)
+				}
+
+				ctx.Forward(kSrc.Copy(ctx, kDst), vSrc.Copy(ctx, vDst))
+			}
+
+			ctx.Compute()
+			ctx.Close()
+
+			start = end
+		}
+	}
+
+	seqRange := newRange()
+	for i, cell := range cells {
+		c.cells[cell] = cacheCell{pos: snapshot.Positions[i], sequences: []int{seq}}
+		seqRange.min = min(seqRange.min, cell)
+		seqRange.max = max(seqRange.max, cell)
+	}
+	c.cellRanges[seq] = seqRange
+
+	return nil
+}
+
+// valueRowSize is the number of bytes used to store the values of one entry
+// in a layer
+func (c *Causal) valueRowSize(layer int) int {
+	value := c.values[layer]
+	if c.config.PermutedV {
+		return value.Stride(0) * value.Dim(1) * value.Dim(2)
+	}
+
+	return value.Stride(2)
+}
+
+// maxSnapshotRuns is the number of runs of cells that can be copied in a
+// single graph, each of which needs up to 8 nodes for the views, permutes
+// and copies of keys and values
+func maxSnapshotRuns(ctx ml.Context) int {
+	return max(1, (ctx.MaxGraphNodes()-4)/8)
+}
+
 func (c *Causal) CanResume(seq int, pos int32) bool {
 	if c.swaMemorySize == math.MaxInt32 {
 		return true
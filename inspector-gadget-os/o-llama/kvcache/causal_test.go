@@ -1,6 +1,7 @@
 package kvcache
 
 import (
+	"encoding/binary"
 	"math"
 	"slices"
 	"testing"
@@ -385,6 +386,89 @@ func TestCopy(t *testing.T) {
 	testCache(t, backend, cache, tests)
 }
 
+func TestSnapshot(t *testing.T) {
+	backend := &testBackend{}
+	cache := NewCausalCache(nil)
+	defer cache.Close()
+
+	cache.Init(backend, ml.DTypeF16, 2, 16, 16)
+
+	x := float32(math.Inf(-1))
+
+	// Interleave two sequences so that the snapshot covers several runs of cells
+	tests := []testCase{
+		{
+			name:          "FirstBatch",
+			in:            []float32{1, 2, 3, 4, 5, 6},
+			inShape:       []int{1, 1, 6},
+			seqs:          []int{0, 1, 0, 1, 0, 0},
+			pos:           []int32{0, 0, 1, 1, 2, 3},
+			expected:      []float32{1, 2, 3, 4, 5, 6},
+			expectedShape: []int{1, 1, 6},
+			expectedMask: []float32{
+				0, x, x, x, x, x,
+				x, 0, x, x, x, x,
+				0, x, 0, x, x, x,
+				x, 0, x, 0, x, x,
+				0, x, 0, x, 0, x,
+				0, x, 0, x, 0, 0,
+			},
+		},
+	}
+
+	testCache(t, backend, cache, tests)
+
+	snapshot, err := cache.Snapshot(0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(snapshot.Positions, []int32{0, 1, 2}) {
+		t.Errorf("snapshot positions: have %v; want %v", snapshot.Positions, []int32{0, 1, 2})
+	}
+
+	if snapshot.Size() != 2*3*4 {
+		t.Errorf("snapshot size: have %v; want %v", snapshot.Size(), 2*3*4)
+	}
+
+	restored := NewCausalCache(nil)
+	defer restored.Close()
+
+	restored.Init(backend, ml.DTypeF16, 2, 16, 16)
+
+	if err := restored.Restore(1, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restored.Restore(1, snapshot); err == nil {
+		t.Error("restoring into a sequence that is not empty should fail")
+	}
+
+	tests = []testCase{
+		{
+			name:          "Restored",
+			in:            []float32{7},
+			inShape:       []int{1, 1, 1},
+			seqs:          []int{1},
+			pos:           []int32{3},
+			expected:      []float32{1, 3, 5, 7},
+			expectedShape: []int{1, 1, 4},
+			expectedMask:  []float32{0, 0, 0, 0},
+		},
+	}
+
+	testCache(t, backend, restored, tests)
+
+	mismatched := NewCausalCache(nil)
+	defer mismatched.Close()
+
+	mismatched.Init(backend, ml.DTypeQ80, 2, 16, 16)
+
+	if err := mismatched.Restore(0, snapshot); err == nil {
+		t.Error("restoring into a cache of a different type should fail")
+	}
+}
+
 func testCache(t *testing.T, backend ml.Backend, cache Cache, tests []testCase) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -607,6 +691,16 @@ func (c *testContext) FromIntSlice(s []int32, shape ...int) ml.Tensor {
 	return out
 }
 
+func (c *testContext) FromBytes(dtype ml.DType, s []byte, shape ...int) ml.Tensor {
+	t := c.Empty(dtype, shape...).(*testTensor)
+
+	if _, err := binary.Decode(s, binary.LittleEndian, t.data); err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
 func (c *testContext) Arange(start, stop, step float32, dtype ml.DType) ml.Tensor {
 	s := make([]float32, 0, int((stop-start)/step))
 	for i := start; i < stop; i += step {
@@ -669,6 +763,14 @@ func (t *testTensor) Floats() []float32 {
 	return out
 }
 
+func (t *testTensor) Bytes() []byte {
+	out, err := binary.Append(nil, binary.LittleEndian, t.data)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
 func (t *testTensor) Neg(ctx ml.Context) ml.Tensor {
 	out := ctx.Empty(t.DType(), t.Shape()...).(*testTensor)
 	for i := range out.data {
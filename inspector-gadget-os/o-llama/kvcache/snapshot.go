@@ -0,0 +1,88 @@
+package kvcache
+
+import (
+	"github.com/ollama/ollama/ml"
+)
+
+// Snapshotter is implemented by caches that can copy the contents of a
+// sequence out of the backend and later restore them, possibly into a cache
+// in another process that was created for the same model
+type Snapshotter interface {
+	// Snapshot copies the entries of seq in the range [0, length)
+	Snapshot(seq int, length int32) (*Snapshot, error)
+
+	// Restore adds the entries of a snapshot to seq, which must be empty.
+	//
+	// If an error occurs, the entire context for the sequence should be
+	// removed by calling Remove(seq, 0, math.MaxInt32)
+	Restore(seq int, snapshot *Snapshot) error
+}
+
+// Snapshot holds the entries of a sequence. Data is stored in the cache's
+// data type with one row per entry, independent of how the backend lays
+// out the cache.
+type Snapshot struct {
+	DType ml.DType
+
+	// Positions holds the position of each entry, in the order that the
+	// entries are stored in each layer
+	Positions []int32
+
+	Layers []LayerSnapshot
+
+	// Caches holds a snapshot for each of the caches in a WrapperCache
+	Caches []*Snapshot
+}
+
+// LayerSnapshot holds the keys and values of a single layer
+type LayerSnapshot struct {
+	Layer int
+
+	KHeadDim   int
+	VHeadDim   int
+	NumKVHeads int
+
+	Keys   []byte
+	Values []byte
+}
+
+// Size returns the number of bytes of key and value data in the snapshot
+func (s *Snapshot) Size() int {
+	var size int
+	for _, layer := range s.Layers {
+		size += len(layer.Keys) + len(layer.Values)
+	}
+
+	for _, cache := range s.Caches {
+		size += cache.Size()
+	}
+
+	return size
+}
+
+// cellRun is a block of consecutive cache cells that are stored
+// consecutively in a snapshot
+type cellRun struct {
+	// cell is the index of the first cell in the cache
+	cell int
+
+	// entry is the index of the first entry in the snapshot
+	entry int
+
+	count int
+}
+
+// cellRuns groups cells, listed in snapshot order, into runs
+func cellRuns(cells []int) []cellRun {
+	var runs []cellRun
+	for i, cell := range cells {
+		if n := len(runs); n > 0 && runs[n-1].cell+runs[n-1].count == cell {
+			runs[n-1].count++
+			continue
+		}
+
+		runs = append(runs, cellRun{cell: cell, entry: i, count: 1})
+	}
+
+	return runs
+}
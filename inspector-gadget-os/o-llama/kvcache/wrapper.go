@@ -1,6 +1,7 @@
 package kvcache
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/ollama/ollama/ml"
@@ -108,3 +109,41 @@ func (c *WrapperCache) Remove(seq int, beginIndex, endIndex int32) error {
 
 	return nil
 }
+
+func (c *WrapperCache) Snapshot(seq int, length int32) (*Snapshot, error) {
+	var snapshot Snapshot
+	for _, cache := range c.caches {
+		s, ok := cache.(Snapshotter)
+		if !ok {
+			return nil, ErrNotSupported
+		}
+
+		cacheSnapshot, err := s.Snapshot(seq, length)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot.Caches = append(snapshot.Caches, cacheSnapshot)
+	}
+
+	return &snapshot, nil
+}
+
+func (c *WrapperCache) Restore(seq int, snapshot *Snapshot) error {
+	if len(snapshot.Caches) != len(c.caches) {
+		return fmt.Errorf("snapshot has %v caches, want %v", len(snapshot.Caches), len(c.caches))
+	}
+
+	for i, cache := range c.caches {
+		s, ok := cache.(Snapshotter)
+		if !ok {
+			return ErrNotSupported
+		}
+
+		if err := s.Restore(seq, snapshot.Caches[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
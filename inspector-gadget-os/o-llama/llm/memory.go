@@ -22,6 +22,10 @@ func PredictServerFit(allGpus discover.GpuInfoList, f *ggml.GGML, adapters, proj
 		var layerCount int
 		estimate := EstimateGPULayers(gpus, f, projectors, opts, numParallel)
 		layerCount, estimatedVRAM = estimate.Layers, estimate.VRAMSize
+		// A draft model that would have to run on the CPU doesn't fit
+		if opts.DraftModel != "" && estimate.draftLayers == 0 {
+			continue
+		}
 		if opts.NumGPU < 0 {
 			if layerCount > 0 && layerCount >= int(f.KV().BlockCount()+1) {
 				return true, estimatedVRAM
@@ -67,10 +71,18 @@ type MemoryEstimate struct {
 	graphPartialOffload uint64
 
 	projectorWeights, projectorGraph uint64
+
+	// draftLayers is how many layers of the draft model to offload to
+	// draftGPU: all of them when it fits on the first GPU with space
+	// alongside the main model, otherwise none
+	draftLayers int
+	draftGPU    int
+	draftSize   uint64
 }
 
 // Given a model and one or more GPU targets, predict how many layers and bytes we can load, and the total size
-// The GPUs provided must all be the same Library
+// The GPUs provided must all be the same Library. opts.DraftModel, if set, is the path of a draft model loaded
+// alongside the model.
 func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, projectors []string, opts api.Options, numParallel int) MemoryEstimate {
 	// Graph size for a partial offload, applies to all GPUs
 	var graphPartialOffload uint64
@@ -145,6 +157,13 @@ func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, projectors []strin
 		layerSize += kv[0]
 	}
 
+	// The draft model keeps its own cache of the same size as the model's
+	var draftSize uint64
+	var draftLayers, draftGPU int
+	if opts.DraftModel != "" {
+		draftSize, draftLayers = draftMemoryRequirements(opts.DraftModel, opts, numParallel, kvct)
+	}
+
 	var kvTotal uint64
 	for _, kvLayer := range kv {
 		kvTotal += kvLayer
@@ -227,6 +246,20 @@ func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, projectors []strin
 		overflow += gpuZeroOverhead
 	}
 
+	// The draft model is small and is only worth running if it's fast, so it
+	// goes on the first GPU before the model's layers as long as that leaves
+	// room for at least one of them. Otherwise it runs on the CPU.
+	if draftSize > 0 {
+		if len(gpusWithSpace) > 0 && opts.NumGPU != 0 &&
+			gpus[gpuZeroID].FreeMemory > overhead+gpuAllocations[gpuZeroID]+max(graphPartialOffload, graphFullOffload)+draftSize+layerSize {
+			gpuAllocations[gpuZeroID] += draftSize
+			draftGPU = gpuZeroID
+		} else {
+			overflow += draftSize
+			draftLayers = 0
+		}
+	}
+
 	// For all the layers, find where they can fit on the GPU(s)
 	for i := int(f.KV().BlockCount()) - 1; i >= 0; i-- {
 		// Some models have inconsistent layer sizes
@@ -342,11 +375,14 @@ func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, projectors []strin
 		graphPartialOffload: graphPartialOffload,
 		projectorWeights:    llamaEngineProjectorWeights + ollamaEngineProjectorWeights,
 		projectorGraph:      ollamaEngineProjectorGraph,
+		draftSize:           draftSize,
 	}
 
 	if gpus[0].Library == "cpu" {
 		return estimate
 	}
+	estimate.draftLayers = draftLayers
+	estimate.draftGPU = draftGPU
 	if layerCount == 0 {
 		slog.Debug("insufficient VRAM to load any model layers")
 		return estimate
@@ -417,6 +453,14 @@ func (m MemoryEstimate) LogValue() slog.Value {
 		))
 	}
 
+	if m.draftSize > 0 {
+		attrs = append(attrs, slog.Group(
+			"draft",
+			"size", format.HumanBytes2(m.draftSize),
+			"offload", m.draftLayers,
+		))
+	}
+
 	return slog.GroupValue(attrs...)
 }
 
@@ -438,3 +482,35 @@ func projectorMemoryRequirements(filename string) (weights uint64) {
 
 	return weights
 }
+
+// draftMemoryRequirements returns the memory needed by a draft model's
+// weights, cache and graph, and its number of layers including the output
+func draftMemoryRequirements(filename string, opts api.Options, numParallel int, kvct string) (size uint64, layers int) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	f, err := ggml.Decode(file, 1024)
+	if err != nil {
+		slog.Warn("unable to estimate draft model memory", "draft", filename, "error", err)
+		return 0, 0
+	}
+
+	for _, layer := range f.Tensors().GroupLayers() {
+		size += layer.Size()
+	}
+
+	if kvct != "" && !f.SupportsKVCacheType(kvct) {
+		kvct = ""
+	}
+
+	kv, graphPartialOffload, graphFullOffload := f.GraphSize(uint64(opts.NumCtx), uint64(min(opts.NumCtx, opts.NumBatch)), numParallel, kvct)
+	for _, kvLayer := range kv {
+		size += kvLayer
+	}
+	size += max(graphPartialOffload, graphFullOffload)
+
+	return size, int(f.KV().BlockCount()) + 1
+}
@@ -128,4 +128,35 @@ func TestEstimateGPULayers(t *testing.T) {
 			}
 		})
 	}
+
+	// The dummy model doubles as its own draft model
+	t.Run("draft", func(t *testing.T) {
+		draftSize, draftLayers := draftMemoryRequirements(f.Name(), opts, 1, "")
+		assert.Equal(t, inputLayerCount+1, draftLayers)
+		assert.Greater(t, draftSize, layerSize)
+
+		single := []discover.GpuInfo{{Library: "cuda", MinimumMemory: gpuMinimumMemory}}
+		single[0].FreeMemory = gpuMinimumMemory + layerSize + uint64(inputLayerCount)*layerSize + memoryLayerOutput + max(graphFullOffload, graphPartialOffload) + 1
+		withDraft := opts
+		withDraft.DraftModel = f.Name()
+
+		// Without room for the draft, it runs on the CPU and the model doesn't fit
+		base := EstimateGPULayers(single, ggml, projectors, opts, 1)
+		estimate := EstimateGPULayers(single, ggml, projectors, withDraft, 1)
+		assert.Equal(t, 0, estimate.draftLayers)
+		assert.Equal(t, base.TotalSize+draftSize, estimate.TotalSize)
+		fits, _ := PredictServerFit(single, ggml, nil, projectors, opts, 1)
+		assert.True(t, fits)
+		fits, _ = PredictServerFit(single, ggml, nil, projectors, withDraft, 1)
+		assert.False(t, fits)
+
+		// With room, it's offloaded along with every layer of the model
+		single[0].FreeMemory += draftSize
+		estimate = EstimateGPULayers(single, ggml, projectors, withDraft, 1)
+		assert.Equal(t, inputLayerCount+1, estimate.draftLayers)
+		assert.Equal(t, inputLayerCount+1, estimate.Layers)
+		assert.Equal(t, base.VRAMSize+draftSize, estimate.VRAMSize)
+		fits, _ = PredictServerFit(single, ggml, nil, projectors, withDraft, 1)
+		assert.True(t, fits)
+	})
 }
@@ -23,13 +23,12 @@ import (
 	"sync"
 	"time"
 
-	"golang.org/x/sync/semaphore"
-
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/discover"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/grammar"
 	"github.com/ollama/ollama/llama"
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/model"
@@ -67,8 +66,10 @@ type LlamaServer interface {
 	WaitUntilRunning(ctx context.Context) error
 	Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error
 	Embedding(ctx context.Context, input string) ([]float32, error)
+	Embeddings(ctx context.Context, inputs []string) ([][]float32, error)
 	Tokenize(ctx context.Context, content string) ([]int, error)
 	Detokenize(ctx context.Context, tokens []int) (string, error)
+	Imatrix(ctx context.Context, req ImatrixRequest, fn func(ImatrixResponse)) error
 	Close() error
 	EstimatedVRAM() uint64 // Total VRAM across all GPUs
 	EstimatedTotal() uint64
@@ -102,7 +103,7 @@ type llmServer struct {
 	loadDuration time.Duration        // Record how long it took the model to load
 	loadProgress float32
 
-	sem *semaphore.Weighted
+	slots *slots
 }
 
 // LoadModel will load a model from disk. The model must be in the GGML format.
@@ -318,6 +319,34 @@ func NewLlamaServer(gpus discover.GpuInfoList, modelPath string, f *ggml.GGML, a
 		params = append(params, "--mmproj", projectors[0])
 	}
 
+	if opts.ImportanceMatrix {
+		if textProcessor == nil {
+			return nil, errors.New("importance matrices require the Ollama engine")
+		}
+		params = append(params, "--imatrix")
+	}
+
+	// opts.DraftModel is the path to the draft model, resolved by the scheduler
+	if opts.DraftModel != "" {
+		if textProcessor != nil {
+			draftLayers := estimate.draftLayers
+			if gpus[0].Library == "cpu" || opts.NumGPU == 0 {
+				draftLayers = 0
+			}
+			params = append(params, "--draft-model", opts.DraftModel, "--draft-n-gpu-layers", strconv.Itoa(draftLayers))
+			if draftLayers > 0 && len(gpus) > 1 {
+				splits := make([]string, len(gpus))
+				for i := range splits {
+					splits[i] = "0"
+				}
+				splits[estimate.draftGPU] = "1"
+				params = append(params, "--draft-tensor-split", strings.Join(splits, ","))
+			}
+		} else {
+			slog.Warn("draft models require the Ollama engine, disabling speculative decoding", "model", modelPath)
+		}
+	}
+
 	// iterate through compatible GPU libraries such as 'cuda_v12', 'rocm', etc.
 	// adding each library's respective path to the LD_LIBRARY_PATH, until finally running
 	// without any LD_LIBRARY_PATH flags
@@ -389,7 +418,7 @@ func NewLlamaServer(gpus discover.GpuInfoList, modelPath string, f *ggml.GGML, a
 			textProcessor: textProcessor,
 			estimate:      estimate,
 			numParallel:   numParallel,
-			sem:           semaphore.NewWeighted(int64(numParallel)),
+			slots:         newSlots(numParallel),
 			totalLayers:   f.KV().BlockCount() + 1,
 			gpus:          gpus,
 			done:          make(chan error, 1),
@@ -660,29 +689,6 @@ func (s *llmServer) Pid() int {
 	return -1
 }
 
-var grammarJSON = `
-root   ::= object
-value  ::= object | array | string | number | ("true" | "false" | "null") ws
-object ::=
-  "{" ws (
-         string ":" ws value
-    ("," ws string ":" ws value)*
-  )? ws "}" 
-array  ::=
-  "[" ws (
-            value
-    ("," ws value)*
-  )? ws "]" 
-string ::=
-  "\"" (
-    [^"\\\x7F\x00-\x1F] |
-    "\\" (["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F]) # escapes
-  )* "\"" 
-number ::= ("-"? ([0-9] | [1-9] [0-9]*)) ("." [0-9]+)? ([eE] [-+]? [0-9]+)? 
-# Optional space: by convention, applied in this grammar after literal chars when allowed
-ws ::= ([ \t\n] ws)?
-`
-
 const maxBufferSize = 512 * format.KiloByte
 
 type ImageData struct {
@@ -696,6 +702,11 @@ type CompletionRequest struct {
 	Images  []ImageData
 	Options *api.Options
 
+	// Logprobs requests per-token log probabilities with TopLogprobs
+	// alternatives each
+	Logprobs    bool
+	TopLogprobs int
+
 	Grammar string // set before sending the request to the subprocess
 }
 
@@ -730,6 +741,15 @@ type CompletionResponse struct {
 	PromptEvalDuration time.Duration `json:"prompt_eval_duration"`
 	EvalCount          int           `json:"eval_count"`
 	EvalDuration       time.Duration `json:"eval_duration"`
+	DraftCount         int           `json:"draft_count,omitempty"`
+	DraftAcceptedCount int           `json:"draft_accepted_count,omitempty"`
+
+	// CacheCount is the number of tokens held in the sequence's context when
+	// it finished
+	CacheCount int `json:"cache_count,omitempty"`
+
+	// Logprobs holds one entry per generated token in Content
+	Logprobs []api.Logprob `json:"logprobs,omitempty"`
 }
 
 func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error {
@@ -737,25 +757,11 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 	slog.Log(ctx, logutil.LevelTrace, "completion request", "prompt", req.Prompt)
 
 	if len(req.Format) > 0 {
-		switch string(req.Format) {
-		case `null`, `""`:
-			// Field was set, but "missing" a value. We accept
-			// these as "not set".
-			break
-		case `"json"`:
-			req.Grammar = grammarJSON
-		default:
-			if req.Format[0] != '{' {
-				return fmt.Errorf("invalid format: %q; expected \"json\" or a valid JSON Schema object", req.Format)
-			}
-
-			// User provided a JSON schema
-			g := llama.SchemaToGrammar(req.Format)
-			if g == nil {
-				return fmt.Errorf("invalid JSON schema in format")
-			}
-			req.Grammar = string(g)
+		g, err := grammar.FromFormat(req.Format)
+		if err != nil {
+			return err
 		}
+		req.Grammar = g
 	}
 
 	if req.Options == nil {
@@ -763,15 +769,15 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 		req.Options = &opts
 	}
 
-	if err := s.sem.Acquire(ctx, 1); err != nil {
+	if err := s.slots.acquire(ctx); err != nil {
 		if errors.Is(err, context.Canceled) {
 			slog.Info("aborting completion request due to client closing the connection")
 		} else {
-			slog.Error("Failed to acquire semaphore", "error", err)
+			slog.Error("Failed to acquire runner slot", "error", err)
 		}
 		return err
 	}
-	defer s.sem.Release(1)
+	defer s.slots.release()
 
 	// put an upper limit on num_predict to avoid the model running on forever
 	if req.Options.NumPredict < 0 || req.Options.NumPredict > 10*s.options.NumCtx {
@@ -860,9 +866,10 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 				return ctx.Err()
 			}
 
-			if c.Content != "" {
+			if c.Content != "" || len(c.Logprobs) > 0 {
 				fn(CompletionResponse{
-					Content: c.Content,
+					Content:  c.Content,
+					Logprobs: c.Logprobs,
 				})
 			}
 
@@ -902,15 +909,15 @@ type EmbeddingResponse struct {
 func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, error) {
 	slog.Log(ctx, logutil.LevelTrace, "embedding request", "input", input)
 
-	if err := s.sem.Acquire(ctx, 1); err != nil {
+	if err := s.slots.acquire(ctx); err != nil {
 		if errors.Is(err, context.Canceled) {
 			slog.Info("aborting embedding request due to client closing the connection")
 		} else {
-			slog.Error("Failed to acquire semaphore", "error", err)
+			slog.Error("Failed to acquire runner slot", "error", err)
 		}
 		return nil, err
 	}
-	defer s.sem.Release(1)
+	defer s.slots.release()
 
 	// Make sure the server is ready
 	status, err := s.getServerStatusRetry(ctx)
@@ -955,6 +962,165 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, err
 	return e.Embedding, nil
 }
 
+type EmbeddingsRequest struct {
+	Content []string `json:"content"`
+}
+
+type EmbeddingsResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embeddings embeds several inputs with one request to the runner, which
+// decodes them together
+func (s *llmServer) Embeddings(ctx context.Context, inputs []string) ([][]float32, error) {
+	slog.Log(ctx, logutil.LevelTrace, "embeddings request", "inputs", len(inputs))
+
+	if err := s.slots.acquire(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			slog.Info("aborting embeddings request due to client closing the connection")
+		} else {
+			slog.Error("Failed to acquire runner slot", "error", err)
+		}
+		return nil, err
+	}
+	defer s.slots.release()
+
+	// Make sure the server is ready
+	status, err := s.getServerStatusRetry(ctx)
+	if err != nil {
+		return nil, err
+	} else if status != ServerStatusReady {
+		return nil, fmt.Errorf("unexpected server status: %s", status)
+	}
+
+	data, err := json.Marshal(EmbeddingsRequest{Content: inputs})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling embed data: %w", err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/embeddings", s.port), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating embed request: %w", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("do embeddings request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading embed response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		log.Printf("llm embeddings error: %s", body)
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	var e EmbeddingsResponse
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("unmarshal embeddings response: %w", err)
+	}
+
+	if len(e.Embeddings) != len(inputs) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(inputs), len(e.Embeddings))
+	}
+
+	return e.Embeddings, nil
+}
+
+// ImatrixRequest asks a runner started for importance matrices to compute
+// one over Text and write it to Path
+type ImatrixRequest struct {
+	Text      string `json:"text"`
+	Dataset   string `json:"dataset"`
+	ChunkSize int    `json:"chunk_size"`
+	Chunks    int    `json:"chunks"`
+	Path      string `json:"path"`
+}
+
+// ImatrixResponse reports the progress of an importance matrix. The last
+// response is Done and counts the weights in the matrix.
+type ImatrixResponse struct {
+	Chunk   int    `json:"chunk"`
+	Chunks  int    `json:"chunks"`
+	Weights int    `json:"weights,omitempty"`
+	Done    bool   `json:"done,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (s *llmServer) Imatrix(ctx context.Context, req ImatrixRequest, fn func(ImatrixResponse)) error {
+	if !s.options.ImportanceMatrix {
+		return errors.New("runner was not started to compute importance matrices")
+	}
+
+	if err := s.slots.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.slots.release()
+
+	status, err := s.getServerStatusRetry(ctx)
+	if err != nil {
+		return err
+	} else if status != ServerStatusReady {
+		return fmt.Errorf("unexpected server status: %s", status)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error marshaling imatrix data: %w", err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/imatrix", s.port), bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("error creating imatrix request: %w", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return fmt.Errorf("do imatrix request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error reading imatrix response: %w", err)
+		}
+		return fmt.Errorf("%s", bytes.TrimSpace(body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var p ImatrixResponse
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			return fmt.Errorf("error unmarshalling imatrix response: %w", err)
+		}
+
+		if p.Error != "" {
+			return errors.New(p.Error)
+		}
+
+		fn(p)
+		if p.Done {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if s.status != nil && s.status.LastErrMsg != "" {
+			return fmt.Errorf("an error was encountered while running the model: %s", s.status.LastErrMsg)
+		}
+		return fmt.Errorf("error reading imatrix response: %w", err)
+	}
+
+	return errors.New("runner stopped before the importance matrix was done")
+}
+
 type TokenizeRequest struct {
 	Content string `json:"content"`
 }
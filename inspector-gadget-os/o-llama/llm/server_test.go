@@ -8,7 +8,6 @@ import (
 	"testing"
 
 	"github.com/ollama/ollama/api"
-	"golang.org/x/sync/semaphore"
 )
 
 func TestLLMServerCompletionFormat(t *testing.T) {
@@ -18,7 +17,7 @@ func TestLLMServerCompletionFormat(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(t.Context())
 	s := &llmServer{
-		sem: semaphore.NewWeighted(1), // required to prevent nil panic
+		slots: newSlots(1), // required to prevent nil panic
 	}
 
 	checkInvalid := func(format string) {
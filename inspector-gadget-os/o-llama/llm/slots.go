@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Schedule is how a request waits for one of a runner's parallel slots.
+// Lower priorities are served first.
+type Schedule struct {
+	Priority int
+	User     string
+}
+
+type scheduleKey struct{}
+
+// WithSchedule returns ctx carrying the schedule of requests made with it
+func WithSchedule(ctx context.Context, s Schedule) context.Context {
+	return context.WithValue(ctx, scheduleKey{}, s)
+}
+
+// ScheduleFrom returns the schedule carried by ctx; the zero value if none
+func ScheduleFrom(ctx context.Context) Schedule {
+	s, _ := ctx.Value(scheduleKey{}).(Schedule)
+	return s
+}
+
+// slots limits the number of requests a runner serves at once. Requests
+// waiting for a slot are granted one strictly by priority and, within a
+// priority, round robin between users, as they are queued by the scheduler.
+type slots struct {
+	mu   sync.Mutex
+	free int
+
+	// waiting holds each priority's waiters; priorities lists the priorities
+	// with waiters in ascending order
+	waiting    map[int]*slotQueue
+	priorities []int
+}
+
+type slotQueue struct {
+	pending map[string][]*slotWaiter
+	users   []string
+}
+
+type slotWaiter struct {
+	ready chan struct{}
+}
+
+func newSlots(n int) *slots {
+	return &slots{free: n, waiting: make(map[int]*slotQueue)}
+}
+
+// acquire waits for a slot for a request with the schedule carried by ctx
+func (s *slots) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.free > 0 && len(s.priorities) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+
+	sched := ScheduleFrom(ctx)
+	w := &slotWaiter{ready: make(chan struct{})}
+	s.push(sched, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		select {
+		case <-w.ready:
+			// granted just as ctx was done; hand the slot on
+			s.releaseLocked()
+		default:
+			s.remove(sched, w)
+		}
+		return ctx.Err()
+	}
+}
+
+// release returns a slot, granting it to the next waiter if there is one
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseLocked()
+}
+
+func (s *slots) releaseLocked() {
+	if len(s.priorities) == 0 {
+		s.free++
+		return
+	}
+
+	p := s.priorities[0]
+	q := s.waiting[p]
+
+	user := q.users[0]
+	q.users = q.users[1:]
+
+	ws := q.pending[user]
+	w := ws[0]
+	if len(ws) > 1 {
+		q.pending[user] = ws[1:]
+		q.users = append(q.users, user)
+	} else {
+		delete(q.pending, user)
+	}
+
+	if len(q.users) == 0 {
+		delete(s.waiting, p)
+		s.priorities = s.priorities[1:]
+	}
+
+	close(w.ready)
+}
+
+func (s *slots) push(sched Schedule, w *slotWaiter) {
+	q, ok := s.waiting[sched.Priority]
+	if !ok {
+		q = &slotQueue{pending: make(map[string][]*slotWaiter)}
+		s.waiting[sched.Priority] = q
+
+		i, _ := slices.BinarySearch(s.priorities, sched.Priority)
+		s.priorities = slices.Insert(s.priorities, i, sched.Priority)
+	}
+
+	if _, ok := q.pending[sched.User]; !ok {
+		q.users = append(q.users, sched.User)
+	}
+	q.pending[sched.User] = append(q.pending[sched.User], w)
+}
+
+func (s *slots) remove(sched Schedule, w *slotWaiter) {
+	q, ok := s.waiting[sched.Priority]
+	if !ok {
+		return
+	}
+
+	ws := slices.DeleteFunc(q.pending[sched.User], func(o *slotWaiter) bool { return o == w })
+	if len(ws) > 0 {
+		q.pending[sched.User] = ws
+		return
+	}
+
+	delete(q.pending, sched.User)
+	q.users = slices.DeleteFunc(q.users, func(u string) bool { return u == sched.User })
+	if len(q.users) == 0 {
+		delete(s.waiting, sched.Priority)
+		s.priorities = slices.DeleteFunc(s.priorities, func(p int) bool { return p == sched.Priority })
+	}
+}
@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSlotsOrder(t *testing.T) {
+	s := newSlots(1)
+	if err := s.acquire(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// queue waiters in an order the slots must not serve them in
+	waiters := []Schedule{
+		{Priority: 2, User: "a"},
+		{Priority: 1, User: "a"},
+		{Priority: 1, User: "a"},
+		{Priority: 1, User: "b"},
+		{Priority: 0, User: "c"},
+	}
+
+	order := make(chan int, len(waiters))
+	for i, sched := range waiters {
+		go func() {
+			if err := s.acquire(WithSchedule(t.Context(), sched)); err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+		}()
+
+		// wait for the waiter to queue so arrival order is deterministic
+		for deadline := time.Now().Add(time.Second); ; {
+			s.mu.Lock()
+			n := 0
+			for _, q := range s.waiting {
+				for _, ws := range q.pending {
+					n += len(ws)
+				}
+			}
+			s.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("waiter did not queue")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// priority 0, then users a and b round robin at priority 1, then 2
+	want := []int{4, 1, 3, 2, 0}
+	for _, w := range want {
+		s.release()
+		select {
+		case got := <-order:
+			if got != w {
+				t.Fatalf("served waiter %d, want %d", got, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("waiter %d not served", w)
+		}
+	}
+
+	s.release()
+	if s.free != 1 || len(s.priorities) != 0 {
+		t.Fatalf("free = %d, priorities = %v; want 1 free and none waiting", s.free, s.priorities)
+	}
+}
+
+func TestSlotsCancel(t *testing.T) {
+	s := newSlots(1)
+	if err := s.acquire(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(WithSchedule(ctx, Schedule{Priority: 1, User: "a"})); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	if len(s.priorities) != 0 || len(s.waiting) != 0 {
+		t.Fatalf("canceled waiter still queued: %v", s.priorities)
+	}
+
+	s.release()
+	if err := s.acquire(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+}
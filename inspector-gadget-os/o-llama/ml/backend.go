@@ -36,6 +36,15 @@ type BackendCacheConfig interface {
 	CacheConfig() CacheConfig
 }
 
+// ImportanceCollector is implemented by backends that can collect statistics
+// for importance matrices. fn is called after each computation with the sum of
+// the squares of the inputs to each column of a weight used in a matrix
+// multiplication, and the number of inputs summed. It must be set before the
+// backend computes any graphs.
+type ImportanceCollector interface {
+	CollectImportance(fn func(name string, sumSquares []float32, n int))
+}
+
 // CacheConfig controls optimizations (mostly backend-specific) that may transform
 // the output the cache to work better with specific kernels.
 type CacheConfig struct {
@@ -221,6 +230,10 @@ type Context interface {
 	FromFloatSlice(s []float32, shape ...int) Tensor
 	FromIntSlice(s []int32, shape ...int) Tensor
 
+	// FromBytes creates a tensor from raw data in the layout of dtype, such
+	// as the result of Tensor.Bytes
+	FromBytes(dtype DType, s []byte, shape ...int) Tensor
+
 	// Arange creates a 1D tensor with values within an interval (start, stop] increased by step.
 	Arange(start, stop, step float32, dtype DType) Tensor
 
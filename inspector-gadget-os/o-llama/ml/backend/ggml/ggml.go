@@ -9,6 +9,7 @@ package ggml
 import "C"
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
@@ -97,6 +98,13 @@ type Backend struct {
 
 	// weightBuffers are the GGML contexts and buffers for allocating weights
 	weightBuffers map[*C.struct_ggml_context]C.ggml_backend_buffer_t
+
+	// importance receives statistics of the inputs to weights, if collecting
+	importance func(name string, sumSquares []float32, n int)
+
+	// importanceNames maps the names of tensors in the model definition to
+	// their names in the file
+	importanceNames map[string]string
 }
 
 func New(modelPath string, params ml.BackendParams) (ml.Backend, error) {
@@ -561,6 +569,30 @@ func (b *Backend) Get(name string) ml.Tensor {
 	return nil
 }
 
+// CollectImportance implements ml.ImportanceCollector
+func (b *Backend) CollectImportance(fn func(name string, sumSquares []float32, n int)) {
+	b.importance = fn
+	b.importanceNames = make(map[string]string)
+	for source, targets := range b.tensorLoadTargets {
+		for _, target := range targets {
+			b.importanceNames[cmp.Or(target, source)] = source
+		}
+	}
+
+	// statistics add nodes to the graph for each matrix multiplication with a
+	// weight so the scheduler is recreated with room for them
+	b.maxGraphNodes *= 3
+	C.ggml_backend_sched_free(b.sched)
+	b.sched = C.ggml_backend_sched_new(
+		(*C.ggml_backend_t)(unsafe.Pointer(&b.schedBackends[0])),
+		(*C.ggml_backend_buffer_type_t)(unsafe.Pointer(&b.schedBufts[0])),
+		C.int(len(b.schedBackends)),
+		C.size_t(b.maxGraphNodes),
+		C._Bool(false),
+		C._Bool(false),
+	)
+}
+
 func (b *Backend) NewContext() ml.Context {
 	return b.NewContextSize(b.maxGraphNodes)
 }
@@ -571,6 +603,7 @@ func (b *Backend) NewContextSize(n int) ml.Context {
 	}
 
 	var allocatedBuffers []C.ggml_backend_buffer_t
+	var importance []importanceStat
 
 	return &Context{
 		b:             b,
@@ -580,6 +613,7 @@ func (b *Backend) NewContextSize(n int) ml.Context {
 			no_alloc: true,
 		}),
 		allocatedBuffers: &allocatedBuffers,
+		importance:       &importance,
 		layer:            -1,
 	}
 }
@@ -610,6 +644,17 @@ type Context struct {
 
 	// layer is the graph layer that this context is allocating for - assumed to be cache
 	layer int
+
+	// importance are the statistics of inputs to weights in the graph, if the
+	// backend is collecting them
+	importance *[]importanceStat
+}
+
+// importanceStat is the sum of the squares of n inputs to the weight name
+type importanceStat struct {
+	name string
+	t    *C.struct_ggml_tensor
+	n    int
 }
 
 func (c *Context) Input() ml.Context {
@@ -620,6 +665,7 @@ func (c *Context) Input() ml.Context {
 			buft:             c.b.input,
 			allocatedBuffers: c.allocatedBuffers,
 			maxGraphNodes:    c.maxGraphNodes,
+			importance:       c.importance,
 			layer:            -1,
 		}
 	}
@@ -635,6 +681,7 @@ func (c *Context) Layer(i int) ml.Context {
 			buft:             buft,
 			allocatedBuffers: c.allocatedBuffers,
 			maxGraphNodes:    c.maxGraphNodes,
+			importance:       c.importance,
 			layer:            i,
 		}
 	}
@@ -651,6 +698,10 @@ func (c *Context) Forward(tensors ...ml.Tensor) ml.Context {
 		C.ggml_build_forward_expand(c.graph, tensor.(*Tensor).t)
 	}
 
+	for _, stat := range *c.importance {
+		C.ggml_build_forward_expand(c.graph, stat.t)
+	}
+
 	return c
 }
 
@@ -673,6 +724,16 @@ func (c *Context) Compute(tensors ...ml.Tensor) {
 			t.(*Tensor).sync = sync
 		}
 	}
+
+	if c.b.importance != nil && len(*c.importance) > 0 {
+		sync()
+		for _, stat := range *c.importance {
+			data := make([]float32, C.ggml_nelements(stat.t))
+			C.ggml_backend_tensor_get(stat.t, unsafe.Pointer(&data[0]), 0, C.ggml_nbytes(stat.t))
+			c.b.importance(stat.name, data, stat.n)
+		}
+		*c.importance = nil
+	}
 }
 
 func (c *Context) Reserve() {
@@ -1040,12 +1101,40 @@ func (t *Tensor) Div(ctx ml.Context, t2 ml.Tensor) ml.Tensor {
 }
 
 func (t *Tensor) Mulmat(ctx ml.Context, t2 ml.Tensor) ml.Tensor {
+	if t.b.importance != nil {
+		ctx.(*Context).collectImportance(t, t2.(*Tensor))
+	}
+
 	return &Tensor{
 		b: t.b,
 		t: C.ggml_mul_mat(ctx.(*Context).ctx, t.t, t2.(*Tensor).t),
 	}
 }
 
+// collectImportance adds the sum of the squares of the inputs x to each column
+// of the weight w to the graph
+func (c *Context) collectImportance(w, x *Tensor) {
+	name := C.GoString(C.ggml_get_name(w.t))
+	source, ok := c.b.importanceNames[name]
+	if !ok || c.b.tensors[name] != w.t {
+		return
+	}
+
+	t := x.t
+	if !C.ggml_is_contiguous(t) {
+		t = C.ggml_cont(c.ctx, t)
+	}
+
+	n := C.ggml_nelements(t) / t.ne[0]
+	t = C.ggml_reshape_2d(c.ctx, t, t.ne[0], n)
+	t = C.ggml_sqr(c.ctx, t)
+	t = C.ggml_cont(c.ctx, C.ggml_transpose(c.ctx, t))
+	t = C.ggml_sum_rows(c.ctx, t)
+	C.ggml_set_output(t)
+
+	*c.importance = append(*c.importance, importanceStat{name: source, t: t, n: int(n)})
+}
+
 func (t *Tensor) MulmatFullPrec(ctx ml.Context, t2 ml.Tensor) ml.Tensor {
 	mul := C.ggml_mul_mat(ctx.(*Context).ctx, t.t, t2.(*Tensor).t)
 	C.ggml_mul_mat_set_prec(mul, C.GGML_PREC_F32)
@@ -58,3 +58,66 @@ func initContextOrSkip(t *testing.T, b ml.Backend, gpu bool) ml.Context {
 	}
 	return ctx.Input()
 }
+
+func TestImportance(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "*.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := ggml.WriteGGUF(f, ggml.KV{
+		"general.architecture": "test",
+		"test.block_count":     uint32(1),
+	}, []*ggml.Tensor{
+		{Name: "blk.0.attn_q.weight", Shape: []uint64{3, 2}, WriterTo: bytes.NewBuffer(slices.Repeat([]byte{0}, 4*3*2))},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := New(f.Name(), ml.BackendParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	type stat struct {
+		name string
+		sums []float32
+		n    int
+	}
+
+	var stats []stat
+	b.(ml.ImportanceCollector).CollectImportance(func(name string, sumSquares []float32, n int) {
+		stats = append(stats, stat{name, sumSquares, n})
+	})
+
+	if err := b.Load(t.Context(), func(float32) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := b.NewContext()
+	defer ctx.Close()
+
+	// a batch of 4 inputs of 3 columns
+	x := ctx.Input().FromFloatSlice([]float32{
+		1, 2, 3,
+		1, 0, 1,
+		0, 1, 0,
+		2, 0, 1,
+	}, 3, 4)
+
+	// only multiplications by weights are collected
+	y := b.Get("blk.0.attn_q.weight").Mulmat(ctx, x)
+	z := x.Mulmat(ctx, x)
+
+	ctx.Forward(y, z).Compute(y, z)
+
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 stat, got %d", len(stats))
+	}
+
+	if stats[0].name != "blk.0.attn_q.weight" || stats[0].n != 4 || !slices.Equal(stats[0].sums, []float32{6, 5, 11}) {
+		t.Errorf("unexpected stat %+v", stats[0])
+	}
+}
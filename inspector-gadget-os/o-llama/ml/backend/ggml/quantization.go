@@ -53,6 +53,13 @@ func ConvertToF32(data []byte, dtype uint32, nelements uint64) []float32 {
 }
 
 func Quantize(newType fsggml.TensorType, f32s []float32, shape []uint64) []byte {
+	return QuantizeImatrix(newType, f32s, shape, nil)
+}
+
+// QuantizeImatrix is like Quantize, weighting the quantization error of each
+// column by its importance: either one value per column, or one per column of
+// each matrix of a 3D tensor.
+func QuantizeImatrix(newType fsggml.TensorType, f32s []float32, shape []uint64, imatrix []float32) []byte {
 	buf := make([]byte, len(f32s)*4) // upper bound on size
 	nPerRow := C.int64_t(shape[0])
 	nrows := C.int64_t(1)
@@ -68,6 +75,14 @@ func Quantize(newType fsggml.TensorType, f32s []float32, shape []uint64) []byte
 	for i03 := C.int64_t(0); i03 < shape2; i03++ {
 		f32s_03 := i03 * nelements_matrix
 		buf_03 := C.int64_t(C.ggml_row_size(uint32(newType), nPerRow)) * i03 * nrows
+
+		var imatrix_03 *C.float
+		if len(imatrix) == int(nPerRow*shape2) {
+			imatrix_03 = (*C.float)(&imatrix[i03*nPerRow])
+		} else if len(imatrix) == int(nPerRow) {
+			imatrix_03 = (*C.float)(&imatrix[0])
+		}
+
 		newSize += C.ggml_quantize_chunk(
 			uint32(newType),
 			(*C.float)(&f32s[f32s_03]),
@@ -75,11 +90,17 @@ func Quantize(newType fsggml.TensorType, f32s []float32, shape []uint64) []byte
 			0,
 			nrows,
 			nPerRow,
-			nil)
+			imatrix_03)
 	}
 	return buf[:newSize]
 }
 
+// QuantizeRequiresImatrix reports whether quantizing to t requires an
+// importance matrix
+func QuantizeRequiresImatrix(t fsggml.TensorType) bool {
+	return bool(C.ggml_quantize_requires_imatrix(uint32(t)))
+}
+
 func QuantizationVersion() uint32 {
 	return uint32(C.GGML_QNT_VERSION)
 }
@@ -0,0 +1,139 @@
+package openai
+
+import (
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// File is a file uploaded for use by the batch API
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+type FileList struct {
+	Object string `json:"object"`
+	Data   []File `json:"data"`
+}
+
+type DeletedFile struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+type BatchRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+type BatchErrors struct {
+	Object string       `json:"object"`
+	Data   []BatchError `json:"data"`
+}
+
+type BatchError struct {
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Param   *string `json:"param"`
+	Line    *int    `json:"line"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type Batch struct {
+	ID               string             `json:"id"`
+	Object           string             `json:"object"`
+	Endpoint         string             `json:"endpoint"`
+	Errors           *BatchErrors       `json:"errors"`
+	InputFileID      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status"`
+	OutputFileID     *string            `json:"output_file_id"`
+	ErrorFileID      *string            `json:"error_file_id"`
+	CreatedAt        int64              `json:"created_at"`
+	InProgressAt     *int64             `json:"in_progress_at"`
+	ExpiresAt        *int64             `json:"expires_at"`
+	FinalizingAt     *int64             `json:"finalizing_at"`
+	CompletedAt      *int64             `json:"completed_at"`
+	FailedAt         *int64             `json:"failed_at"`
+	ExpiredAt        *int64             `json:"expired_at"`
+	CancellingAt     *int64             `json:"cancelling_at"`
+	CancelledAt      *int64             `json:"cancelled_at"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata"`
+}
+
+type BatchList struct {
+	Object  string  `json:"object"`
+	Data    []Batch `json:"data"`
+	FirstID *string `json:"first_id"`
+	LastID  *string `json:"last_id"`
+	HasMore bool    `json:"has_more"`
+}
+
+func unixOrNil(t time.Time) *int64 {
+	if t.IsZero() {
+		return nil
+	}
+
+	u := t.Unix()
+	return &u
+}
+
+// ToBatch converts a native batch to an OpenAI batch object
+func ToBatch(b api.Batch) Batch {
+	batch := Batch{
+		ID:               b.ID,
+		Object:           "batch",
+		Endpoint:         b.Endpoint,
+		InputFileID:      b.InputFileID,
+		CompletionWindow: b.CompletionWindow,
+		Status:           b.Status,
+		CreatedAt:        b.CreatedAt.Unix(),
+		InProgressAt:     unixOrNil(b.StartedAt),
+		FinalizingAt:     unixOrNil(b.FinalizingAt),
+		CompletedAt:      unixOrNil(b.CompletedAt),
+		FailedAt:         unixOrNil(b.FailedAt),
+		CancellingAt:     unixOrNil(b.CancellingAt),
+		CancelledAt:      unixOrNil(b.CancelledAt),
+		RequestCounts:    BatchRequestCounts(b.RequestCounts),
+		Metadata:         b.Metadata,
+	}
+
+	// results are only visible once the batch has stopped
+	switch b.Status {
+	case api.BatchCompleted, api.BatchCancelled, api.BatchFailed:
+		if b.OutputFileID != "" {
+			batch.OutputFileID = &b.OutputFileID
+		}
+
+		if b.ErrorFileID != "" {
+			batch.ErrorFileID = &b.ErrorFileID
+		}
+	}
+
+	if len(b.Errors) > 0 {
+		batch.Errors = &BatchErrors{Object: "list"}
+		for _, e := range b.Errors {
+			be := BatchError{Code: e.Code, Message: e.Message}
+			if e.Line > 0 {
+				be.Line = &e.Line
+			}
+			batch.Errors.Data = append(batch.Errors.Data, be)
+		}
+	}
+
+	return batch
+}
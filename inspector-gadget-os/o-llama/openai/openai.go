@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 
@@ -43,21 +44,51 @@ type Message struct {
 }
 
 type Choice struct {
-	Index        int     `json:"index"`
-	Message      Message `json:"message"`
-	FinishReason *string `json:"finish_reason"`
+	Index        int             `json:"index"`
+	Message      Message         `json:"message"`
+	Logprobs     *ChoiceLogprobs `json:"logprobs,omitempty"`
+	FinishReason *string         `json:"finish_reason"`
 }
 
 type ChunkChoice struct {
-	Index        int     `json:"index"`
-	Delta        Message `json:"delta"`
-	FinishReason *string `json:"finish_reason"`
+	Index        int             `json:"index"`
+	Delta        Message         `json:"delta"`
+	Logprobs     *ChoiceLogprobs `json:"logprobs,omitempty"`
+	FinishReason *string         `json:"finish_reason"`
 }
 
 type CompleteChunkChoice struct {
-	Text         string  `json:"text"`
-	Index        int     `json:"index"`
-	FinishReason *string `json:"finish_reason"`
+	Text         string              `json:"text"`
+	Index        int                 `json:"index"`
+	Logprobs     *CompletionLogprobs `json:"logprobs,omitempty"`
+	FinishReason *string             `json:"finish_reason"`
+}
+
+// ChoiceLogprobs holds the log probabilities of a chat completion choice
+type ChoiceLogprobs struct {
+	Content []ChatLogprob `json:"content"`
+}
+
+type ChatLogprob struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	Bytes       []int        `json:"bytes"`
+	TopLogprobs []TopLogprob `json:"top_logprobs"`
+}
+
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes"`
+}
+
+// CompletionLogprobs holds the log probabilities of a legacy completion
+// choice, with one entry per token in each list
+type CompletionLogprobs struct {
+	Tokens        []string             `json:"tokens"`
+	TokenLogprobs []float64            `json:"token_logprobs"`
+	TopLogprobs   []map[string]float64 `json:"top_logprobs"`
+	TextOffset    []int                `json:"text_offset"`
 }
 
 type Usage struct {
@@ -103,6 +134,8 @@ type ChatCompletionRequest struct {
 	ResponseFormat   *ResponseFormat `json:"response_format"`
 	Tools            []api.Tool      `json:"tools"`
 	Reasoning        *Reasoning      `json:"reasoning,omitempty"`
+	Logprobs         *bool           `json:"logprobs"`
+	TopLogprobs      int             `json:"top_logprobs"`
 }
 
 type ChatCompletion struct {
@@ -139,6 +172,7 @@ type CompletionRequest struct {
 	Temperature      *float32       `json:"temperature"`
 	TopP             float32        `json:"top_p"`
 	Suffix           string         `json:"suffix"`
+	Logprobs         *int           `json:"logprobs"`
 }
 
 type Completion struct {
@@ -251,6 +285,61 @@ func toToolCalls(tc []api.ToolCall) []ToolCall {
 	return toolCalls
 }
 
+func tokenBytes(token string) []int {
+	b := make([]int, len(token))
+	for i := range len(token) {
+		b[i] = int(token[i])
+	}
+	return b
+}
+
+func toChoiceLogprobs(lps []api.Logprob) *ChoiceLogprobs {
+	if len(lps) == 0 {
+		return nil
+	}
+
+	content := make([]ChatLogprob, len(lps))
+	for i, lp := range lps {
+		top := make([]TopLogprob, len(lp.TopLogprobs))
+		for j, alt := range lp.TopLogprobs {
+			top[j] = TopLogprob{Token: alt.Token, Logprob: alt.Logprob, Bytes: tokenBytes(alt.Token)}
+		}
+		content[i] = ChatLogprob{Token: lp.Token, Logprob: lp.Logprob, Bytes: tokenBytes(lp.Token), TopLogprobs: top}
+	}
+	return &ChoiceLogprobs{Content: content}
+}
+
+// toCompletionLogprobs converts log probabilities to the legacy completions
+// format, with text offsets counted in characters from offset
+func toCompletionLogprobs(lps []api.Logprob, offset int) *CompletionLogprobs {
+	if len(lps) == 0 {
+		return nil
+	}
+
+	clp := &CompletionLogprobs{
+		Tokens:        make([]string, len(lps)),
+		TokenLogprobs: make([]float64, len(lps)),
+		TopLogprobs:   make([]map[string]float64, len(lps)),
+		TextOffset:    make([]int, len(lps)),
+	}
+	for i, lp := range lps {
+		clp.Tokens[i] = lp.Token
+		clp.TokenLogprobs[i] = lp.Logprob
+		clp.TextOffset[i] = offset
+		offset += utf8.RuneCountInString(lp.Token)
+
+		top := make(map[string]float64, len(lp.TopLogprobs))
+		for _, alt := range lp.TopLogprobs {
+			// distinct ids can decode to the same text; keep the most likely
+			if _, ok := top[alt.Token]; !ok {
+				top[alt.Token] = alt.Logprob
+			}
+		}
+		clp.TopLogprobs[i] = top
+	}
+	return clp
+}
+
 func toChatCompletion(id string, r api.ChatResponse) ChatCompletion {
 	toolCalls := toToolCalls(r.Message.ToolCalls)
 	return ChatCompletion{
@@ -260,8 +349,9 @@ func toChatCompletion(id string, r api.ChatResponse) ChatCompletion {
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []Choice{{
-			Index:   0,
-			Message: Message{Role: r.Message.Role, Content: r.Message.Content, ToolCalls: toolCalls, Reasoning: r.Message.Thinking},
+			Index:    0,
+			Message:  Message{Role: r.Message.Role, Content: r.Message.Content, ToolCalls: toolCalls, Reasoning: r.Message.Thinking},
+			Logprobs: toChoiceLogprobs(r.Logprobs),
 			FinishReason: func(reason string) *string {
 				if len(toolCalls) > 0 {
 					reason = "tool_calls"
@@ -285,8 +375,9 @@ func toChunk(id string, r api.ChatResponse, toolCallSent bool) ChatCompletionChu
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []ChunkChoice{{
-			Index: 0,
-			Delta: Message{Role: "assistant", Content: r.Message.Content, ToolCalls: toolCalls, Reasoning: r.Message.Thinking},
+			Index:    0,
+			Delta:    Message{Role: "assistant", Content: r.Message.Content, ToolCalls: toolCalls, Reasoning: r.Message.Thinking},
+			Logprobs: toChoiceLogprobs(r.Logprobs),
 			FinishReason: func(reason string) *string {
 				if len(reason) > 0 {
 					if toolCallSent || len(toolCalls) > 0 {
@@ -316,8 +407,9 @@ func toCompletion(id string, r api.GenerateResponse) Completion {
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []CompleteChunkChoice{{
-			Text:  r.Response,
-			Index: 0,
+			Text:     r.Response,
+			Index:    0,
+			Logprobs: toCompletionLogprobs(r.Logprobs, 0),
 			FinishReason: func(reason string) *string {
 				if len(reason) > 0 {
 					return &reason
@@ -329,7 +421,9 @@ func toCompletion(id string, r api.GenerateResponse) Completion {
 	}
 }
 
-func toCompleteChunk(id string, r api.GenerateResponse) CompletionChunk {
+// toCompleteChunk converts a streamed response; textOffset is the length in
+// characters of the text already streamed
+func toCompleteChunk(id string, r api.GenerateResponse, textOffset int) CompletionChunk {
 	return CompletionChunk{
 		Id:                id,
 		Object:            "text_completion",
@@ -337,8 +431,9 @@ func toCompleteChunk(id string, r api.GenerateResponse) CompletionChunk {
 		Model:             r.Model,
 		SystemFingerprint: "fp_ollama",
 		Choices: []CompleteChunkChoice{{
-			Text:  r.Response,
-			Index: 0,
+			Text:     r.Response,
+			Index:    0,
+			Logprobs: toCompletionLogprobs(r.Logprobs, textOffset),
 			FinishReason: func(reason string) *string {
 				if len(reason) > 0 {
 					return &reason
@@ -442,24 +537,9 @@ func fromChatRequest(r ChatCompletionRequest) (*api.ChatRequest, error) {
 						}
 					}
 
-					types := []string{"jpeg", "jpg", "png", "webp"}
-					valid := false
-					for _, t := range types {
-						prefix := "data:image/" + t + ";base64,"
-						if strings.HasPrefix(url, prefix) {
-							url = strings.TrimPrefix(url, prefix)
-							valid = true
-							break
-						}
-					}
-
-					if !valid {
-						return nil, errors.New("invalid image input")
-					}
-
-					img, err := base64.StdEncoding.DecodeString(url)
+					img, err := decodeImageURL(url)
 					if err != nil {
-						return nil, errors.New("invalid message format")
+						return nil, err
 					}
 
 					messages = append(messages, api.Message{Role: msg.Role, Images: []api.ImageData{img}})
@@ -565,17 +645,51 @@ func fromChatRequest(r ChatCompletionRequest) (*api.ChatRequest, error) {
 		}
 	}
 
+	logprobs := r.Logprobs != nil && *r.Logprobs
+	if r.TopLogprobs < 0 || r.TopLogprobs > api.MaxTopLogprobs {
+		return nil, fmt.Errorf("top_logprobs must be between 0 and %d", api.MaxTopLogprobs)
+	} else if r.TopLogprobs > 0 && !logprobs {
+		return nil, errors.New("logprobs must be set to true to use top_logprobs")
+	}
+
 	return &api.ChatRequest{
-		Model:    r.Model,
-		Messages: messages,
-		Format:   format,
-		Options:  options,
-		Stream:   &r.Stream,
-		Tools:    r.Tools,
-		Think:    think,
+		Model:       r.Model,
+		Messages:    messages,
+		Format:      format,
+		Options:     options,
+		Stream:      &r.Stream,
+		Tools:       r.Tools,
+		Think:       think,
+		Logprobs:    logprobs,
+		TopLogprobs: r.TopLogprobs,
 	}, nil
 }
 
+// decodeImageURL decodes an image sent as a base64 data URL
+func decodeImageURL(url string) (api.ImageData, error) {
+	types := []string{"jpeg", "jpg", "png", "webp"}
+	valid := false
+	for _, t := range types {
+		prefix := "data:image/" + t + ";base64,"
+		if strings.HasPrefix(url, prefix) {
+			url = strings.TrimPrefix(url, prefix)
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return nil, errors.New("invalid image input")
+	}
+
+	img, err := base64.StdEncoding.DecodeString(url)
+	if err != nil {
+		return nil, errors.New("invalid message format")
+	}
+
+	return img, nil
+}
+
 func nameFromToolCallID(messages []Message, toolCallID string) string {
 	// iterate backwards to be more resilient to duplicate tool call IDs (this
 	// follows "last one wins")
@@ -645,13 +759,23 @@ func fromCompleteRequest(r CompletionRequest) (api.GenerateRequest, error) {
 		options["top_p"] = 1.0
 	}
 
-	return api.GenerateRequest{
+	req := api.GenerateRequest{
 		Model:   r.Model,
 		Prompt:  r.Prompt,
 		Options: options,
 		Stream:  &r.Stream,
 		Suffix:  r.Suffix,
-	}, nil
+	}
+
+	if r.Logprobs != nil {
+		if *r.Logprobs < 0 || *r.Logprobs > api.MaxTopLogprobs {
+			return api.GenerateRequest{}, fmt.Errorf("logprobs must be between 0 and %d", api.MaxTopLogprobs)
+		}
+		req.Logprobs = true
+		req.TopLogprobs = *r.Logprobs
+	}
+
+	return req, nil
 }
 
 type BaseWriter struct {
@@ -670,6 +794,7 @@ type CompleteWriter struct {
 	stream        bool
 	streamOptions *StreamOptions
 	id            string
+	textOffset    int
 	BaseWriter
 }
 
@@ -778,7 +903,8 @@ func (w *CompleteWriter) writeResponse(data []byte) (int, error) {
 
 	// completion chunk
 	if w.stream {
-		c := toCompleteChunk(w.id, generateResponse)
+		c := toCompleteChunk(w.id, generateResponse, w.textOffset)
+		w.textOffset += utf8.RuneCountInString(generateResponse.Response)
 		if w.streamOptions != nil && w.streamOptions.IncludeUsage {
 			c.Usage = &Usage{}
 		}
@@ -74,6 +74,33 @@ func TestChatMiddleware(t *testing.T) {
 				Stream: &False,
 			},
 		},
+		{
+			name: "chat handler with logprobs",
+			body: `{
+				"model": "test-model",
+				"messages": [
+					{"role": "user", "content": "Hello"}
+				],
+				"logprobs": true,
+				"top_logprobs": 3
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream:      &False,
+				Logprobs:    true,
+				TopLogprobs: 3,
+			},
+		},
 		{
 			name: "chat handler with options",
 			body: `{
@@ -649,6 +676,41 @@ func TestCompletionsMiddleware(t *testing.T) {
 				Stream: &True,
 			},
 		},
+		{
+			name: "completions handler with logprobs",
+			body: `{
+				"model": "test-model",
+				"prompt": "Hello",
+				"logprobs": 2
+			}`,
+			req: api.GenerateRequest{
+				Model:  "test-model",
+				Prompt: "Hello",
+				Options: map[string]any{
+					"frequency_penalty": 0.0,
+					"presence_penalty":  0.0,
+					"temperature":       1.0,
+					"top_p":             1.0,
+				},
+				Stream:      &False,
+				Logprobs:    true,
+				TopLogprobs: 2,
+			},
+		},
+		{
+			name: "completions handler logprobs out of range",
+			body: `{
+				"model": "test-model",
+				"prompt": "Hello",
+				"logprobs": 21
+			}`,
+			err: ErrorResponse{
+				Error: Error{
+					Message: "logprobs must be between 0 and 20",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
 		{
 			name: "completions handler error forwarding",
 			body: `{
@@ -925,3 +987,52 @@ func TestRetrieveMiddleware(t *testing.T) {
 		}
 	}
 }
+
+func TestLogprobsResponses(t *testing.T) {
+	logprobs := []api.Logprob{
+		{
+			TokenLogprob: api.TokenLogprob{Token: "Hé", Logprob: -0.5},
+			TopLogprobs: []api.TokenLogprob{
+				{Token: "Hé", Logprob: -0.5},
+				{Token: "Hi", Logprob: -1.5},
+			},
+		},
+		{TokenLogprob: api.TokenLogprob{Token: "llo", Logprob: -0.25}},
+	}
+
+	chat := toChatCompletion("id", api.ChatResponse{
+		Message:  api.Message{Role: "assistant", Content: "Héllo"},
+		Logprobs: logprobs,
+	})
+	want := &ChoiceLogprobs{Content: []ChatLogprob{
+		{
+			Token:   "Hé",
+			Logprob: -0.5,
+			Bytes:   []int{72, 195, 169},
+			TopLogprobs: []TopLogprob{
+				{Token: "Hé", Logprob: -0.5, Bytes: []int{72, 195, 169}},
+				{Token: "Hi", Logprob: -1.5, Bytes: []int{72, 105}},
+			},
+		},
+		{Token: "llo", Logprob: -0.25, Bytes: []int{108, 108, 111}, TopLogprobs: []TopLogprob{}},
+	}}
+	if diff := cmp.Diff(want, chat.Choices[0].Logprobs); diff != "" {
+		t.Errorf("chat logprobs mismatch (-want +got):\n%s", diff)
+	}
+
+	if chunk := toChunk("id", api.ChatResponse{Message: api.Message{Content: "x"}}, false); chunk.Choices[0].Logprobs != nil {
+		t.Errorf("expected no logprobs without request, got %+v", chunk.Choices[0].Logprobs)
+	}
+
+	// streamed completions continue the text offset of earlier chunks
+	chunk := toCompleteChunk("id", api.GenerateResponse{Response: "Héllo", Logprobs: logprobs}, 3)
+	wantCompletion := &CompletionLogprobs{
+		Tokens:        []string{"Hé", "llo"},
+		TokenLogprobs: []float64{-0.5, -0.25},
+		TopLogprobs:   []map[string]float64{{"Hé": -0.5, "Hi": -1.5}, {}},
+		TextOffset:    []int{3, 5},
+	}
+	if diff := cmp.Diff(wantCompletion, chunk.Choices[0].Logprobs); diff != "" {
+		t.Errorf("completion logprobs mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,887 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ResponseContentPart is a part of the content of a message item, or of the
+// summary of a reasoning item
+type ResponseContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+func (p ResponseContentPart) MarshalJSON() ([]byte, error) {
+	switch p.Type {
+	case "output_text":
+		return json.Marshal(struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			Annotations []any  `json:"annotations"`
+		}{p.Type, p.Text, []any{}})
+	case "input_text", "summary_text":
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}{p.Type, p.Text})
+	default:
+		type part ResponseContentPart
+		return json.Marshal(part(p))
+	}
+}
+
+// ResponseContent is the content of a message item, which requests may also
+// send as a plain string
+type ResponseContent []ResponseContentPart
+
+func (c *ResponseContent) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = ResponseContent{{Type: "input_text", Text: s}}
+		return nil
+	}
+
+	var parts []ResponseContentPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return errors.New("invalid message content")
+	}
+
+	*c = parts
+	return nil
+}
+
+// ResponseItem is an item of the input or output of a response: a message,
+// a function call or its output, or reasoning
+type ResponseItem struct {
+	Type   string `json:"type"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status,omitempty"`
+
+	// message
+	Role    string          `json:"role,omitempty"`
+	Content ResponseContent `json:"content,omitempty"`
+
+	// function_call and function_call_output
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+
+	// reasoning
+	Summary []ResponseContentPart `json:"summary,omitempty"`
+}
+
+func (i ResponseItem) MarshalJSON() ([]byte, error) {
+	switch i.Type {
+	case "message":
+		content := i.Content
+		if content == nil {
+			content = ResponseContent{}
+		}
+
+		return json.Marshal(struct {
+			Type    string          `json:"type"`
+			ID      string          `json:"id,omitempty"`
+			Status  string          `json:"status,omitempty"`
+			Role    string          `json:"role"`
+			Content ResponseContent `json:"content"`
+		}{i.Type, i.ID, i.Status, i.Role, content})
+	case "function_call":
+		return json.Marshal(struct {
+			Type      string `json:"type"`
+			ID        string `json:"id,omitempty"`
+			CallID    string `json:"call_id"`
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+			Status    string `json:"status,omitempty"`
+		}{i.Type, i.ID, i.CallID, i.Name, i.Arguments, i.Status})
+	case "function_call_output":
+		return json.Marshal(struct {
+			Type   string `json:"type"`
+			ID     string `json:"id,omitempty"`
+			CallID string `json:"call_id"`
+			Output string `json:"output"`
+		}{i.Type, i.ID, i.CallID, i.Output})
+	case "reasoning":
+		summary := i.Summary
+		if summary == nil {
+			summary = []ResponseContentPart{}
+		}
+
+		return json.Marshal(struct {
+			Type    string                `json:"type"`
+			ID      string                `json:"id,omitempty"`
+			Summary []ResponseContentPart `json:"summary"`
+		}{i.Type, i.ID, summary})
+	default:
+		type item ResponseItem
+		return json.Marshal(item(i))
+	}
+}
+
+func (i *ResponseItem) UnmarshalJSON(data []byte) error {
+	type item ResponseItem
+	var a item
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+
+	*i = ResponseItem(a)
+
+	// messages may be sent as just a role and content
+	if i.Type == "" && i.Role != "" {
+		i.Type = "message"
+	}
+
+	return nil
+}
+
+// ResponseInput is the input of a request, which may also be sent as a
+// plain string for a single user message
+type ResponseInput []ResponseItem
+
+func (in *ResponseInput) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*in = ResponseInput{{Type: "message", Role: "user", Content: ResponseContent{{Type: "input_text", Text: s}}}}
+		return nil
+	}
+
+	var items []ResponseItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return errors.New("input must be a string or a list of input items")
+	}
+
+	*in = items
+	return nil
+}
+
+type ResponseTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+type ResponseReasoning struct {
+	Effort  *string `json:"effort,omitempty"`
+	Summary *string `json:"summary,omitempty"`
+}
+
+type ResponseTextFormat struct {
+	Type   string          `json:"type"`
+	Name   string          `json:"name,omitempty"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+	Strict *bool           `json:"strict,omitempty"`
+}
+
+type ResponseText struct {
+	Format *ResponseTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesRequest struct {
+	Model              string             `json:"model"`
+	Input              ResponseInput      `json:"input"`
+	Instructions       string             `json:"instructions"`
+	Tools              []ResponseTool     `json:"tools"`
+	ToolChoice         any                `json:"tool_choice"`
+	ParallelToolCalls  *bool              `json:"parallel_tool_calls"`
+	Temperature        *float64           `json:"temperature"`
+	TopP               *float64           `json:"top_p"`
+	MaxOutputTokens    *int               `json:"max_output_tokens"`
+	Stream             bool               `json:"stream"`
+	Store              *bool              `json:"store"`
+	PreviousResponseID string             `json:"previous_response_id"`
+	Reasoning          *ResponseReasoning `json:"reasoning"`
+	Text               *ResponseText      `json:"text"`
+	Metadata           map[string]string  `json:"metadata"`
+}
+
+type ResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type IncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponseUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+type Response struct {
+	ID                 string             `json:"id"`
+	Object             string             `json:"object"`
+	CreatedAt          int64              `json:"created_at"`
+	Status             string             `json:"status"`
+	Error              *ResponseError     `json:"error"`
+	IncompleteDetails  *IncompleteDetails `json:"incomplete_details"`
+	Instructions       *string            `json:"instructions"`
+	MaxOutputTokens    *int               `json:"max_output_tokens"`
+	Model              string             `json:"model"`
+	Output             []ResponseItem     `json:"output"`
+	ParallelToolCalls  bool               `json:"parallel_tool_calls"`
+	PreviousResponseID *string            `json:"previous_response_id"`
+	Reasoning          *ResponseReasoning `json:"reasoning"`
+	Store              bool               `json:"store"`
+	Temperature        *float64           `json:"temperature"`
+	Text               *ResponseText      `json:"text,omitempty"`
+	ToolChoice         any                `json:"tool_choice"`
+	Tools              []ResponseTool     `json:"tools"`
+	TopP               *float64           `json:"top_p"`
+	Usage              *ResponseUsage     `json:"usage"`
+	Metadata           map[string]string  `json:"metadata"`
+}
+
+// ResponseStreamEvent is a server-sent event of a streamed response. Only
+// the fields of the event's type are set.
+type ResponseStreamEvent struct {
+	Type           string               `json:"type"`
+	SequenceNumber int                  `json:"sequence_number"`
+	Response       *Response            `json:"response,omitempty"`
+	OutputIndex    *int                 `json:"output_index,omitempty"`
+	ContentIndex   *int                 `json:"content_index,omitempty"`
+	SummaryIndex   *int                 `json:"summary_index,omitempty"`
+	ItemID         string               `json:"item_id,omitempty"`
+	Item           *ResponseItem        `json:"item,omitempty"`
+	Part           *ResponseContentPart `json:"part,omitempty"`
+	Delta          string               `json:"delta,omitempty"`
+	Text           *string              `json:"text,omitempty"`
+	Arguments      *string              `json:"arguments,omitempty"`
+	Code           string               `json:"code,omitempty"`
+	Message        string               `json:"message,omitempty"`
+}
+
+type DeletedResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+func responseItemID(prefix string) string {
+	const letterBytes = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 24)
+	for i := range b {
+		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+	}
+	return prefix + string(b)
+}
+
+// fromResponseItems converts the items of a conversation into chat messages
+func fromResponseItems(items []ResponseItem) ([]api.Message, error) {
+	var messages []api.Message
+
+	// reasoning items precede the message or function calls they led to
+	var thinking string
+
+	// function call outputs refer to calls by id, which ollama doesn't track
+	toolNames := make(map[string]string)
+
+	// assistant returns the assistant message that the next output item is
+	// part of
+	assistant := func() *api.Message {
+		if n := len(messages); n == 0 || messages[n-1].Role != "assistant" || thinking != "" {
+			messages = append(messages, api.Message{Role: "assistant"})
+		}
+
+		m := &messages[len(messages)-1]
+		m.Thinking, thinking = m.Thinking+thinking, ""
+		return m
+	}
+
+	for _, item := range items {
+		switch item.Type {
+		case "message":
+			role := strings.ToLower(item.Role)
+			switch role {
+			case "developer":
+				role = "system"
+			case "system", "user", "assistant":
+			default:
+				return nil, fmt.Errorf("invalid message role %q", item.Role)
+			}
+
+			var texts []string
+			var images []api.ImageData
+			for _, part := range item.Content {
+				switch part.Type {
+				case "input_text", "output_text":
+					texts = append(texts, part.Text)
+				case "input_image":
+					img, err := decodeImageURL(part.ImageURL)
+					if err != nil {
+						return nil, err
+					}
+					images = append(images, img)
+				default:
+					return nil, fmt.Errorf("unsupported content type %q", part.Type)
+				}
+			}
+
+			if role == "assistant" {
+				m := assistant()
+				m.Content += strings.Join(texts, "\n")
+				continue
+			}
+
+			messages = append(messages, api.Message{Role: role, Content: strings.Join(texts, "\n"), Images: images})
+		case "function_call":
+			var args api.ToolCallFunctionArguments
+			if item.Arguments != "" {
+				if err := json.Unmarshal([]byte(item.Arguments), &args); err != nil {
+					return nil, errors.New("invalid tool call arguments")
+				}
+			}
+
+			toolNames[item.CallID] = item.Name
+
+			m := assistant()
+			m.ToolCalls = append(m.ToolCalls, api.ToolCall{Function: api.ToolCallFunction{Name: item.Name, Arguments: args}})
+		case "function_call_output":
+			messages = append(messages, api.Message{Role: "tool", Content: item.Output, ToolName: toolNames[item.CallID]})
+		case "reasoning":
+			for _, part := range item.Summary {
+				thinking += part.Text
+			}
+		default:
+			return nil, fmt.Errorf("unsupported input item type %q", item.Type)
+		}
+	}
+
+	return messages, nil
+}
+
+func fromResponsesRequest(r ResponsesRequest, items []ResponseItem) (*api.ChatRequest, error) {
+	conversation, err := fromResponseItems(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []api.Message
+	if r.Instructions != "" {
+		messages = append(messages, api.Message{Role: "system", Content: r.Instructions})
+	}
+	messages = append(messages, conversation...)
+
+	options := make(map[string]any)
+
+	if r.MaxOutputTokens != nil {
+		options["num_predict"] = *r.MaxOutputTokens
+	}
+
+	if r.Temperature != nil {
+		options["temperature"] = *r.Temperature
+	} else {
+		options["temperature"] = 1.0
+	}
+
+	if r.TopP != nil {
+		options["top_p"] = *r.TopP
+	} else {
+		options["top_p"] = 1.0
+	}
+
+	var tools []api.Tool
+	if choice, _ := r.ToolChoice.(string); choice != "none" {
+		for _, t := range r.Tools {
+			if t.Type != "function" {
+				return nil, fmt.Errorf("unsupported tool type %q", t.Type)
+			}
+
+			tool := api.Tool{Type: "function"}
+			tool.Function.Name = t.Name
+			tool.Function.Description = t.Description
+			if len(t.Parameters) > 0 {
+				if err := json.Unmarshal(t.Parameters, &tool.Function.Parameters); err != nil {
+					return nil, fmt.Errorf("invalid parameters for tool %q", t.Name)
+				}
+			}
+			tools = append(tools, tool)
+		}
+	}
+
+	var format json.RawMessage
+	if r.Text != nil && r.Text.Format != nil {
+		switch r.Text.Format.Type {
+		case "json_object":
+			format = json.RawMessage(`"json"`)
+		case "json_schema":
+			format = r.Text.Format.Schema
+		}
+	}
+
+	var think *api.ThinkValue
+	if r.Reasoning != nil && r.Reasoning.Effort != nil {
+		think = &api.ThinkValue{
+			Value: *r.Reasoning.Effort,
+		}
+	}
+
+	return &api.ChatRequest{
+		Model:    r.Model,
+		Messages: messages,
+		Format:   format,
+		Options:  options,
+		Stream:   &r.Stream,
+		Tools:    tools,
+		Think:    think,
+	}, nil
+}
+
+// toResponseOutput converts a chat response into output items
+func toResponseOutput(r api.ChatResponse) []ResponseItem {
+	var output []ResponseItem
+	if r.Message.Thinking != "" {
+		output = append(output, ResponseItem{
+			Type:    "reasoning",
+			ID:      responseItemID("rs_"),
+			Summary: []ResponseContentPart{{Type: "summary_text", Text: r.Message.Thinking}},
+		})
+	}
+
+	if r.Message.Content != "" {
+		output = append(output, ResponseItem{
+			Type:    "message",
+			ID:      responseItemID("msg_"),
+			Status:  "completed",
+			Role:    "assistant",
+			Content: ResponseContent{{Type: "output_text", Text: r.Message.Content}},
+		})
+	}
+
+	for _, tc := range toToolCalls(r.Message.ToolCalls) {
+		output = append(output, ResponseItem{
+			Type:      "function_call",
+			ID:        responseItemID("fc_"),
+			Status:    "completed",
+			CallID:    tc.ID,
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+
+	return output
+}
+
+// complete sets the status and usage of a response that is done
+func (resp *Response) complete(r api.ChatResponse) {
+	resp.Status = "completed"
+	if r.DoneReason == "length" {
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &IncompleteDetails{Reason: "max_output_tokens"}
+	}
+
+	resp.Usage = &ResponseUsage{
+		InputTokens:  r.PromptEvalCount,
+		OutputTokens: r.EvalCount,
+		TotalTokens:  r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+type ResponsesWriter struct {
+	stream bool
+	store  *ResponseStore
+
+	// response is filled in as the chat response is written
+	response Response
+
+	// items holds the conversation up to and including the input of this
+	// request, which is stored with the response
+	items []ResponseItem
+
+	// sequence is the sequence number of the next event, and item is the
+	// index in the output of the item being streamed, if any
+	sequence int
+	item     int
+	started  bool
+
+	BaseWriter
+}
+
+func (w *ResponsesWriter) save() {
+	if !w.response.Store || w.store == nil {
+		return
+	}
+
+	items := slices.Concat(w.items, w.response.Output)
+	if err := w.store.put(&storedResponse{Response: w.response, Items: items}); err != nil {
+		slog.Warn("unable to store response", "id", w.response.ID, "error", err)
+	}
+}
+
+func (w *ResponsesWriter) event(e ResponseStreamEvent) error {
+	e.SequenceNumber = w.sequence
+	w.sequence++
+
+	d, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", e.Type, d)
+	return err
+}
+
+func index(i int) *int {
+	return &i
+}
+
+// current returns the item being streamed if it has the given type
+func (w *ResponsesWriter) current(typ string) *ResponseItem {
+	if w.item < 0 || w.response.Output[w.item].Type != typ {
+		return nil
+	}
+
+	return &w.response.Output[w.item]
+}
+
+func (w *ResponsesWriter) addItem(item ResponseItem) error {
+	if err := w.doneItem(); err != nil {
+		return err
+	}
+
+	w.response.Output = append(w.response.Output, item)
+	w.item = len(w.response.Output) - 1
+
+	return w.event(ResponseStreamEvent{Type: "response.output_item.added", OutputIndex: index(w.item), Item: &item})
+}
+
+// doneItem finishes the item being streamed
+func (w *ResponsesWriter) doneItem() error {
+	if w.item < 0 {
+		return nil
+	}
+
+	item := &w.response.Output[w.item]
+	switch item.Type {
+	case "reasoning":
+		part := item.Summary[0]
+		if err := w.event(ResponseStreamEvent{Type: "response.reasoning_summary_text.done", ItemID: item.ID, OutputIndex: index(w.item), SummaryIndex: index(0), Text: &part.Text}); err != nil {
+			return err
+		}
+		if err := w.event(ResponseStreamEvent{Type: "response.reasoning_summary_part.done", ItemID: item.ID, OutputIndex: index(w.item), SummaryIndex: index(0), Part: &part}); err != nil {
+			return err
+		}
+	case "message":
+		part := item.Content[0]
+		if err := w.event(ResponseStreamEvent{Type: "response.output_text.done", ItemID: item.ID, OutputIndex: index(w.item), ContentIndex: index(0), Text: &part.Text}); err != nil {
+			return err
+		}
+		if err := w.event(ResponseStreamEvent{Type: "response.content_part.done", ItemID: item.ID, OutputIndex: index(w.item), ContentIndex: index(0), Part: &part}); err != nil {
+			return err
+		}
+	}
+
+	item.Status = "completed"
+	if item.Type == "reasoning" {
+		item.Status = ""
+	}
+
+	err := w.event(ResponseStreamEvent{Type: "response.output_item.done", OutputIndex: index(w.item), Item: item})
+	w.item = -1
+	return err
+}
+
+func (w *ResponsesWriter) writeEvents(r api.ChatResponse) error {
+	if !w.started {
+		w.started = true
+		w.item = -1
+
+		response := w.response
+		if err := w.event(ResponseStreamEvent{Type: "response.created", Response: &response}); err != nil {
+			return err
+		}
+		if err := w.event(ResponseStreamEvent{Type: "response.in_progress", Response: &response}); err != nil {
+			return err
+		}
+	}
+
+	if r.Message.Thinking != "" {
+		item := w.current("reasoning")
+		if item == nil {
+			if err := w.addItem(ResponseItem{Type: "reasoning", ID: responseItemID("rs_"), Summary: []ResponseContentPart{}}); err != nil {
+				return err
+			}
+
+			item = w.current("reasoning")
+			item.Summary = []ResponseContentPart{{Type: "summary_text"}}
+			if err := w.event(ResponseStreamEvent{Type: "response.reasoning_summary_part.added", ItemID: item.ID, OutputIndex: index(w.item), SummaryIndex: index(0), Part: &item.Summary[0]}); err != nil {
+				return err
+			}
+		}
+
+		item.Summary[0].Text += r.Message.Thinking
+		if err := w.event(ResponseStreamEvent{Type: "response.reasoning_summary_text.delta", ItemID: item.ID, OutputIndex: index(w.item), SummaryIndex: index(0), Delta: r.Message.Thinking}); err != nil {
+			return err
+		}
+	}
+
+	if r.Message.Content != "" {
+		item := w.current("message")
+		if item == nil {
+			if err := w.addItem(ResponseItem{Type: "message", ID: responseItemID("msg_"), Status: "in_progress", Role: "assistant"}); err != nil {
+				return err
+			}
+
+			item = w.current("message")
+			item.Content = ResponseContent{{Type: "output_text"}}
+			if err := w.event(ResponseStreamEvent{Type: "response.content_part.added", ItemID: item.ID, OutputIndex: index(w.item), ContentIndex: index(0), Part: &item.Content[0]}); err != nil {
+				return err
+			}
+		}
+
+		item.Content[0].Text += r.Message.Content
+		if err := w.event(ResponseStreamEvent{Type: "response.output_text.delta", ItemID: item.ID, OutputIndex: index(w.item), ContentIndex: index(0), Delta: r.Message.Content}); err != nil {
+			return err
+		}
+	}
+
+	for _, tc := range toToolCalls(r.Message.ToolCalls) {
+		item := ResponseItem{
+			Type:   "function_call",
+			ID:     responseItemID("fc_"),
+			Status: "in_progress",
+			CallID: tc.ID,
+			Name:   tc.Function.Name,
+		}
+		if err := w.addItem(item); err != nil {
+			return err
+		}
+
+		w.response.Output[w.item].Arguments = tc.Function.Arguments
+		if err := w.event(ResponseStreamEvent{Type: "response.function_call_arguments.delta", ItemID: item.ID, OutputIndex: index(w.item), Delta: tc.Function.Arguments}); err != nil {
+			return err
+		}
+		if err := w.event(ResponseStreamEvent{Type: "response.function_call_arguments.done", ItemID: item.ID, OutputIndex: index(w.item), Arguments: &tc.Function.Arguments}); err != nil {
+			return err
+		}
+	}
+
+	if r.Done {
+		if err := w.doneItem(); err != nil {
+			return err
+		}
+
+		w.response.complete(r)
+		w.save()
+
+		response := w.response
+		return w.event(ResponseStreamEvent{Type: "response." + response.Status, Response: &response})
+	}
+
+	return nil
+}
+
+func (w *ResponsesWriter) writeResponse(data []byte) (int, error) {
+	var chatResponse struct {
+		api.ChatResponse
+
+		// Error is set when the chat handler fails after it has started
+		// streaming
+		Error string `json:"error"`
+	}
+	err := json.Unmarshal(data, &chatResponse)
+	if err != nil {
+		return 0, err
+	}
+
+	if w.stream {
+		w.ResponseWriter.Header().Set("Content-Type", "text/event-stream")
+
+		if chatResponse.Error != "" {
+			err = w.event(ResponseStreamEvent{Type: "error", Code: "server_error", Message: chatResponse.Error})
+		} else {
+			err = w.writeEvents(chatResponse.ChatResponse)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		return len(data), nil
+	}
+
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	if chatResponse.Error != "" {
+		err = json.NewEncoder(w.ResponseWriter).Encode(NewError(http.StatusInternalServerError, chatResponse.Error))
+	} else {
+		w.response.Output = toResponseOutput(chatResponse.ChatResponse)
+		w.response.complete(chatResponse.ChatResponse)
+		w.save()
+		err = json.NewEncoder(w.ResponseWriter).Encode(w.response)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *ResponsesWriter) Write(data []byte) (int, error) {
+	code := w.ResponseWriter.Status()
+	if code != http.StatusOK {
+		return w.writeError(data)
+	}
+
+	return w.writeResponse(data)
+}
+
+// ResponsesMiddleware handles the OpenAI Responses API. Responses are kept
+// in store, if it isn't nil, unless the request opts out.
+func ResponsesMiddleware(store *ResponseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ResponsesRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if len(req.Input) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "[] is too short - 'input'"))
+			return
+		}
+
+		var items []ResponseItem
+		if req.PreviousResponseID != "" {
+			if store == nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, "previous_response_id is not supported without a response store"))
+				return
+			}
+
+			previous, err := store.get(req.PreviousResponseID)
+			if errors.Is(err, errResponseNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, NewError(http.StatusNotFound, fmt.Sprintf("Previous response with id '%s' not found.", req.PreviousResponseID)))
+				return
+			} else if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+				return
+			}
+
+			items = previous.Items
+		}
+		items = append(items, req.Input...)
+
+		chatReq, err := fromResponsesRequest(req, items)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(chatReq); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(&b)
+
+		response := Response{
+			ID:                responseItemID("resp_"),
+			Object:            "response",
+			CreatedAt:         time.Now().Unix(),
+			Status:            "in_progress",
+			MaxOutputTokens:   req.MaxOutputTokens,
+			Model:             req.Model,
+			Output:            []ResponseItem{},
+			ParallelToolCalls: req.ParallelToolCalls == nil || *req.ParallelToolCalls,
+			Reasoning:         req.Reasoning,
+			Store:             store != nil && (req.Store == nil || *req.Store),
+			Temperature:       req.Temperature,
+			Text:              req.Text,
+			ToolChoice:        req.ToolChoice,
+			Tools:             req.Tools,
+			TopP:              req.TopP,
+			Metadata:          req.Metadata,
+		}
+
+		if req.Instructions != "" {
+			response.Instructions = &req.Instructions
+		}
+
+		if req.PreviousResponseID != "" {
+			response.PreviousResponseID = &req.PreviousResponseID
+		}
+
+		if response.ToolChoice == nil {
+			response.ToolChoice = "auto"
+		}
+
+		if response.Tools == nil {
+			response.Tools = []ResponseTool{}
+		}
+
+		w := &ResponsesWriter{
+			BaseWriter: BaseWriter{ResponseWriter: c.Writer},
+			stream:     req.Stream,
+			store:      store,
+			response:   response,
+			items:      items,
+		}
+
+		c.Writer = w
+
+		c.Next()
+	}
+}
+
+// RetrieveResponseHandler returns a stored response
+func RetrieveResponseHandler(store *ResponseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		stored, err := store.get(id)
+		if errors.Is(err, errResponseNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, NewError(http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", id)))
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, stored.Response)
+	}
+}
+
+// DeleteResponseHandler removes a stored response
+func DeleteResponseHandler(store *ResponseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		err := store.delete(id)
+		if errors.Is(err, errResponseNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, NewError(http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", id)))
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, NewError(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, DeletedResponse{ID: id, Object: "response.deleted", Deleted: true})
+	}
+}
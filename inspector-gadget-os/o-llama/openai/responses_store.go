@@ -0,0 +1,177 @@
+package openai
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// responseRetention is how long stored responses are kept
+const responseRetention = 30 * 24 * time.Hour
+
+var errResponseNotFound = errors.New("response not found")
+
+// ResponseStore keeps responses in a SQLite database so that later requests
+// can continue from them with previous_response_id. The database is created
+// when it is first used.
+type ResponseStore struct {
+	path string
+
+	once sync.Once
+	db   *sql.DB
+	err  error
+}
+
+// storedResponse is a response along with the items of the conversation
+// that led to it, which are the input of a request that continues from it
+type storedResponse struct {
+	Response Response
+	Items    []ResponseItem
+}
+
+func NewResponseStore(path string) *ResponseStore {
+	return &ResponseStore{path: path}
+}
+
+func (s *ResponseStore) open() (*sql.DB, error) {
+	s.once.Do(func() {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+			s.err = err
+			return
+		}
+
+		db, err := sql.Open("sqlite", s.path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS responses (
+			id TEXT PRIMARY KEY,
+			created_at INTEGER NOT NULL,
+			response TEXT NOT NULL,
+			items TEXT NOT NULL
+		)`); err != nil {
+			db.Close()
+			s.err = err
+			return
+		}
+
+		if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS responses_created_at ON responses (created_at)`); err != nil {
+			db.Close()
+			s.err = err
+			return
+		}
+
+		if _, err := db.Exec(`DELETE FROM responses WHERE created_at < ?`, retentionCutoff()); err != nil {
+			db.Close()
+			s.err = err
+			return
+		}
+
+		s.db = db
+	})
+
+	return s.db, s.err
+}
+
+// retentionCutoff is the creation time of the oldest response still kept
+func retentionCutoff() int64 {
+	return time.Now().Add(-responseRetention).Unix()
+}
+
+// get returns a stored response, unless it has expired
+func (s *ResponseStore) get(id string) (*storedResponse, error) {
+	if s == nil {
+		return nil, errResponseNotFound
+	}
+
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	var response, items string
+	err = db.QueryRow(`SELECT response, items FROM responses WHERE id = ? AND created_at >= ?`, id, retentionCutoff()).Scan(&response, &items)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errResponseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var stored storedResponse
+	if err := json.Unmarshal([]byte(response), &stored.Response); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(items), &stored.Items); err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+func (s *ResponseStore) put(stored *storedResponse) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+
+	response, err := json.Marshal(stored.Response)
+	if err != nil {
+		return err
+	}
+
+	items, err := json.Marshal(stored.Items)
+	if err != nil {
+		return err
+	}
+
+	// expired responses are dropped as new ones are stored, so that a
+	// long running server doesn't keep them
+	if _, err := db.Exec(`DELETE FROM responses WHERE created_at < ?`, retentionCutoff()); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT OR REPLACE INTO responses (id, created_at, response, items) VALUES (?, ?, ?, ?)`,
+		stored.Response.ID, stored.Response.CreatedAt, string(response), string(items))
+	return err
+}
+
+func (s *ResponseStore) delete(id string) error {
+	if s == nil {
+		return errResponseNotFound
+	}
+
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(`DELETE FROM responses WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errResponseNotFound
+	}
+
+	return nil
+}
+
+// Close closes the database if it was opened
+func (s *ResponseStore) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+
+	return nil
+}
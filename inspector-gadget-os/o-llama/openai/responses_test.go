@@ -0,0 +1,670 @@
+package openai
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestResponsesMiddleware(t *testing.T) {
+	type testCase struct {
+		name string
+		body string
+		req  api.ChatRequest
+		err  ErrorResponse
+	}
+
+	var capturedRequest *api.ChatRequest
+
+	imageData, _ := base64.StdEncoding.DecodeString(image)
+
+	weatherTool := api.Tool{Type: "function"}
+	weatherTool.Function.Name = "get_weather"
+	weatherTool.Function.Description = "Get the current weather"
+	weatherTool.Function.Parameters.Type = "object"
+	weatherTool.Function.Parameters.Required = []string{"location"}
+	weatherTool.Function.Parameters.Properties = map[string]api.ToolProperty{
+		"location": {
+			Type:        api.PropertyType{"string"},
+			Description: "The city and state",
+		},
+	}
+
+	testCases := []testCase{
+		{
+			name: "responses handler",
+			body: `{
+				"model": "test-model",
+				"input": "Hello"
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "responses handler with instructions and options",
+			body: `{
+				"model": "test-model",
+				"instructions": "You are helpful.",
+				"input": [
+					{"role": "developer", "content": "Answer briefly."},
+					{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Hello"}]}
+				],
+				"max_output_tokens": 100,
+				"temperature": 0.5,
+				"top_p": 0.9,
+				"stream": true
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "system",
+						Content: "You are helpful.",
+					},
+					{
+						Role:    "system",
+						Content: "Answer briefly.",
+					},
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"num_predict": 100.0,
+					"temperature": 0.5,
+					"top_p":       0.9,
+				},
+				Stream: &True,
+			},
+		},
+		{
+			name: "responses handler with image input",
+			body: `{
+				"model": "test-model",
+				"input": [
+					{
+						"role": "user",
+						"content": [
+							{"type": "input_text", "text": "What is in this image?"},
+							{"type": "input_image", "image_url": "` + prefix + image + `"}
+						]
+					}
+				]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "What is in this image?",
+						Images:  []api.ImageData{imageData},
+					},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "responses handler with tools",
+			body: `{
+				"model": "test-model",
+				"input": "What's the weather like in Paris?",
+				"tools": [{
+					"type": "function",
+					"name": "get_weather",
+					"description": "Get the current weather",
+					"parameters": {
+						"type": "object",
+						"required": ["location"],
+						"properties": {
+							"location": {"type": "string", "description": "The city and state"}
+						}
+					}
+				}]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "What's the weather like in Paris?",
+					},
+				},
+				Tools: []api.Tool{weatherTool},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "responses handler with tool choice none",
+			body: `{
+				"model": "test-model",
+				"input": "Hello",
+				"tools": [{"type": "function", "name": "get_weather"}],
+				"tool_choice": "none"
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "responses handler with function calls and reasoning",
+			body: `{
+				"model": "test-model",
+				"input": [
+					{"role": "user", "content": "What's the weather like in Paris?"},
+					{"type": "reasoning", "id": "rs_1", "summary": [{"type": "summary_text", "text": "I should check the weather."}]},
+					{"type": "function_call", "id": "fc_1", "call_id": "call_1", "name": "get_weather", "arguments": "{\"location\":\"Paris, France\"}"},
+					{"type": "function_call_output", "call_id": "call_1", "output": "22°C and sunny"}
+				],
+				"reasoning": {"effort": "low"}
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "What's the weather like in Paris?",
+					},
+					{
+						Role:     "assistant",
+						Thinking: "I should check the weather.",
+						ToolCalls: []api.ToolCall{
+							{
+								Function: api.ToolCallFunction{
+									Name: "get_weather",
+									Arguments: api.ToolCallFunctionArguments{
+										"location": "Paris, France",
+									},
+								},
+							},
+						},
+					},
+					{
+						Role:     "tool",
+						Content:  "22°C and sunny",
+						ToolName: "get_weather",
+					},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+				Think:  &api.ThinkValue{Value: "low"},
+			},
+		},
+		{
+			name: "responses handler with json schema",
+			body: `{
+				"model": "test-model",
+				"input": "Hello",
+				"text": {"format": {"type": "json_schema", "name": "greeting", "schema": {"type": "object"}}}
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{
+						Role:    "user",
+						Content: "Hello",
+					},
+				},
+				Format: json.RawMessage(`{"type":"object"}`),
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+			},
+		},
+		{
+			name: "responses handler with unsupported tool",
+			body: `{
+				"model": "test-model",
+				"input": "Hello",
+				"tools": [{"type": "web_search"}]
+			}`,
+			err: ErrorResponse{
+				Error: Error{
+					Message: `unsupported tool type "web_search"`,
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+		{
+			name: "responses handler with invalid role",
+			body: `{
+				"model": "test-model",
+				"input": [{"role": "tool", "content": "Hello"}]
+			}`,
+			err: ErrorResponse{
+				Error: Error{
+					Message: `invalid message role "tool"`,
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+		{
+			name: "responses handler without input",
+			body: `{
+				"model": "test-model",
+				"input": []
+			}`,
+			err: ErrorResponse{
+				Error: Error{
+					Message: "[] is too short - 'input'",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+		{
+			name: "responses handler without store",
+			body: `{
+				"model": "test-model",
+				"input": "Hello",
+				"previous_response_id": "resp_1"
+			}`,
+			err: ErrorResponse{
+				Error: Error{
+					Message: "previous_response_id is not supported without a response store",
+					Type:    "invalid_request_error",
+				},
+			},
+		},
+	}
+
+	endpoint := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ResponsesMiddleware(nil), captureRequestMiddleware(&capturedRequest))
+	router.Handle(http.MethodPost, "/v1/responses", endpoint)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			defer func() { capturedRequest = nil }()
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			var errResp ErrorResponse
+			if resp.Code != http.StatusOK {
+				if err := json.Unmarshal(resp.Body.Bytes(), &errResp); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tc.err, errResp); diff != "" {
+					t.Fatalf("errors did not match for %s:\n%s", tc.name, diff)
+				}
+				return
+			}
+			if diff := cmp.Diff(&tc.req, capturedRequest); diff != "" {
+				t.Fatalf("requests did not match: %+v", diff)
+			}
+		})
+	}
+}
+
+func TestResponsesOutput(t *testing.T) {
+	cases := []struct {
+		name   string
+		resp   api.ChatResponse
+		types  []string
+		status string
+	}{
+		{
+			name: "text",
+			resp: api.ChatResponse{
+				Message:    api.Message{Role: "assistant", Content: "Hello"},
+				Done:       true,
+				DoneReason: "stop",
+				Metrics:    api.Metrics{PromptEvalCount: 3, EvalCount: 2},
+			},
+			types:  []string{"message"},
+			status: "completed",
+		},
+		{
+			name: "reasoning and function call",
+			resp: api.ChatResponse{
+				Message: api.Message{
+					Role:     "assistant",
+					Thinking: "Let me check.",
+					ToolCalls: []api.ToolCall{
+						{Function: api.ToolCallFunction{Name: "get_weather", Arguments: api.ToolCallFunctionArguments{"location": "Paris"}}},
+					},
+				},
+				Done:       true,
+				DoneReason: "stop",
+				Metrics:    api.Metrics{PromptEvalCount: 3, EvalCount: 2},
+			},
+			types:  []string{"reasoning", "function_call"},
+			status: "completed",
+		},
+		{
+			name: "max output tokens",
+			resp: api.ChatResponse{
+				Message:    api.Message{Role: "assistant", Content: "Hel"},
+				Done:       true,
+				DoneReason: "length",
+				Metrics:    api.Metrics{PromptEvalCount: 3, EvalCount: 2},
+			},
+			types:  []string{"message"},
+			status: "incomplete",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(ResponsesMiddleware(nil))
+			router.Handle(http.MethodPost, "/v1/responses", func(c *gin.Context) {
+				c.JSON(http.StatusOK, tt.resp)
+			})
+
+			req, _ := http.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model": "test-model", "input": "Hello"}`))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			var r Response
+			if err := json.Unmarshal(resp.Body.Bytes(), &r); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(r.ID, "resp_") || r.Object != "response" || r.Model != "test-model" {
+				t.Errorf("unexpected response: %+v", r)
+			}
+
+			if r.Status != tt.status {
+				t.Errorf("expected status %q, got %q", tt.status, r.Status)
+			}
+
+			var types []string
+			for _, item := range r.Output {
+				types = append(types, item.Type)
+			}
+			if diff := cmp.Diff(tt.types, types); diff != "" {
+				t.Errorf("output types did not match (-want +got):\n%s", diff)
+			}
+
+			if r.Usage == nil || r.Usage.InputTokens != 3 || r.Usage.OutputTokens != 2 || r.Usage.TotalTokens != 5 {
+				t.Errorf("unexpected usage: %+v", r.Usage)
+			}
+		})
+	}
+
+	// function calls get ids that later requests refer to
+	output := toResponseOutput(cases[1].resp)
+	call := output[1]
+	if !strings.HasPrefix(call.CallID, "call_") || call.Name != "get_weather" || call.Arguments != `{"location":"Paris"}` || call.Status != "completed" {
+		t.Errorf("unexpected function call: %+v", call)
+	}
+}
+
+func TestResponsesStream(t *testing.T) {
+	chunks := []api.ChatResponse{
+		{Message: api.Message{Role: "assistant", Thinking: "Hmm"}},
+		{Message: api.Message{Role: "assistant", Content: "Hel"}},
+		{Message: api.Message{Role: "assistant", Content: "lo"}},
+		{Message: api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{Function: api.ToolCallFunction{Name: "get_weather", Arguments: api.ToolCallFunctionArguments{"location": "Paris"}}}}}},
+		{Message: api.Message{Role: "assistant"}, Done: true, DoneReason: "stop", Metrics: api.Metrics{PromptEvalCount: 3, EvalCount: 4}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ResponsesMiddleware(nil))
+	router.Handle(http.MethodPost, "/v1/responses", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		for _, chunk := range chunks {
+			b, _ := json.Marshal(chunk)
+			c.Writer.Write(b)
+		}
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model": "test-model", "input": "Hello", "stream": true}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if ct := resp.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected content type text/event-stream, got %q", ct)
+	}
+
+	var names []string
+	var last ResponseStreamEvent
+	for i, raw := range strings.Split(strings.TrimSpace(resp.Body.String()), "\n\n") {
+		name, data, ok := strings.Cut(raw, "\n")
+		if !ok || !strings.HasPrefix(name, "event: ") || !strings.HasPrefix(data, "data: ") {
+			t.Fatalf("malformed event %q", raw)
+		}
+
+		var e ResponseStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &e); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Type != strings.TrimPrefix(name, "event: ") || e.SequenceNumber != i {
+			t.Errorf("event %d: unexpected %q with type %q and sequence number %d", i, name, e.Type, e.SequenceNumber)
+		}
+
+		names = append(names, e.Type)
+		last = e
+	}
+
+	want := []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.reasoning_summary_part.added",
+		"response.reasoning_summary_text.delta",
+		"response.reasoning_summary_text.done",
+		"response.reasoning_summary_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("events did not match (-want +got):\n%s", diff)
+	}
+
+	r := last.Response
+	if r == nil || r.Status != "completed" || len(r.Output) != 3 {
+		t.Fatalf("unexpected final response: %+v", r)
+	}
+
+	if text := r.Output[1].Content[0].Text; text != "Hello" {
+		t.Errorf("expected accumulated text %q, got %q", "Hello", text)
+	}
+
+	if summary := r.Output[0].Summary[0].Text; summary != "Hmm" {
+		t.Errorf("expected accumulated summary %q, got %q", "Hmm", summary)
+	}
+}
+
+func TestResponsesStore(t *testing.T) {
+	store := NewResponseStore(filepath.Join(t.TempDir(), "responses.db"))
+	defer store.Close()
+
+	var capturedRequest *api.ChatRequest
+	replies := []string{"Hi, I'm Ollama.", "You said hello.", "Hi."}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/responses", ResponsesMiddleware(store), captureRequestMiddleware(&capturedRequest), func(c *gin.Context) {
+		reply := replies[0]
+		replies = replies[1:]
+		c.JSON(http.StatusOK, api.ChatResponse{Message: api.Message{Role: "assistant", Content: reply}, Done: true})
+	})
+	router.GET("/v1/responses/:id", RetrieveResponseHandler(store))
+	router.DELETE("/v1/responses/:id", DeleteResponseHandler(store))
+
+	post := func(body string) (*httptest.ResponseRecorder, Response) {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var r Response
+		json.Unmarshal(resp.Body.Bytes(), &r)
+		return resp, r
+	}
+
+	_, first := post(`{"model": "test-model", "instructions": "Be brief.", "input": "Hello"}`)
+	if !first.Store {
+		t.Fatal("expected response to be stored")
+	}
+
+	// the conversation continues without repeating it, but instructions are
+	// not carried over
+	_, second := post(fmt.Sprintf(`{"model": "test-model", "input": "What did I say?", "previous_response_id": %q}`, first.ID))
+	wantMessages := []api.Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi, I'm Ollama."},
+		{Role: "user", Content: "What did I say?"},
+	}
+	if diff := cmp.Diff(wantMessages, capturedRequest.Messages); diff != "" {
+		t.Errorf("messages did not match (-want +got):\n%s", diff)
+	}
+
+	if second.PreviousResponseID == nil || *second.PreviousResponseID != first.ID {
+		t.Errorf("expected previous_response_id %q, got %v", first.ID, second.PreviousResponseID)
+	}
+
+	// responses that opt out are not stored
+	resp, unstored := post(`{"model": "test-model", "input": "Hello", "store": false}`)
+	if resp.Code != http.StatusOK || unstored.Store {
+		t.Fatalf("expected response not to be stored: %s", resp.Body.String())
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/responses/"+id, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := get(unstored.ID); resp.Code != http.StatusNotFound {
+		t.Errorf("expected unstored response to be missing, got %d", resp.Code)
+	}
+
+	resp = get(second.ID)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var retrieved Response
+	if err := json.Unmarshal(resp.Body.Bytes(), &retrieved); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(second, retrieved); diff != "" {
+		t.Errorf("retrieved response did not match (-want +got):\n%s", diff)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, "/v1/responses/"+first.ID, nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	var deleted DeletedResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &deleted); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(DeletedResponse{ID: first.ID, Object: "response.deleted", Deleted: true}, deleted); diff != "" {
+		t.Errorf("delete did not match (-want +got):\n%s", diff)
+	}
+
+	resp, _ = post(fmt.Sprintf(`{"model": "test-model", "input": "Hello", "previous_response_id": %q}`, first.ID))
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected deleted response to be missing, got %d", resp.Code)
+	}
+}
+
+func TestResponsesStoreExpires(t *testing.T) {
+	store := NewResponseStore(filepath.Join(t.TempDir(), "responses.db"))
+	defer store.Close()
+
+	expired := time.Now().Add(-responseRetention - time.Hour).Unix()
+	if err := store.put(&storedResponse{Response: Response{ID: "resp_old", CreatedAt: expired}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.get("resp_old"); !errors.Is(err, errResponseNotFound) {
+		t.Errorf("expected expired response to be missing, got %v", err)
+	}
+
+	if err := store.put(&storedResponse{Response: Response{ID: "resp_new", CreatedAt: time.Now().Unix()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.get("resp_new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// storing a response drops those which expired
+	var n int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM responses`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 stored response, got %d", n)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -49,17 +50,28 @@ var deprecatedParameters = []string{
 	"mirostat",
 	"mirostat_tau",
 	"mirostat_eta",
+	"numa",
+	"num_gqa",
 }
 
 // CreateRequest creates a new *api.CreateRequest from an existing Modelfile
 func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error) {
+	commands, err := includeCommands(f.Commands, relativeDir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(commands, func(c Command) bool { return c.Name == "model" }) {
+		return nil, errMissingFrom
+	}
+
 	req := &api.CreateRequest{}
 
 	var messages []api.Message
 	var licenses []string
 	params := make(map[string]any)
 
-	for _, c := range f.Commands {
+	for _, c := range commands {
 		switch c.Name {
 		case "model":
 			path, err := expandPath(c.Args, relativeDir)
@@ -103,6 +115,15 @@ func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error)
 		case "message":
 			role, msg, _ := strings.Cut(c.Args, ": ")
 			messages = append(messages, api.Message{Role: role, Content: msg})
+		case "tools":
+			tools, err := parseTools(c.Args)
+			if err != nil {
+				return nil, err
+			}
+
+			req.Tools = append(req.Tools, tools...)
+		case "draft":
+			params["draft_model"] = c.Args
 		default:
 			if slices.Contains(deprecatedParameters, c.Name) {
 				fmt.Printf("warning: parameter %s is deprecated\n", c.Name)
@@ -139,6 +160,96 @@ func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error)
 	return req, nil
 }
 
+// includeCommands replaces INCLUDE commands with the commands of the
+// Modelfiles they name. Paths in an included Modelfile are relative to the
+// directory it's in. seen holds the Modelfiles being included, to catch
+// cycles.
+func includeCommands(commands []Command, relativeDir string, seen []string) ([]Command, error) {
+	var out []Command
+	for _, c := range commands {
+		switch {
+		case c.Name == "include":
+			path, err := expandPath(c.Args, relativeDir)
+			if err != nil {
+				return nil, err
+			}
+
+			if slices.Contains(seen, path) {
+				return nil, fmt.Errorf("%s: include cycle", c.Args)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+
+			included, err := parseFile(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", c.Args, err)
+			}
+
+			cs, err := includeCommands(included.Commands, filepath.Dir(path), append(seen, path))
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, cs...)
+		case (c.Name == "model" || c.Name == "adapter") && len(seen) > 0:
+			// resolve local paths now since the including Modelfile may be
+			// in a different directory
+			if path, err := expandPath(c.Args, relativeDir); err == nil {
+				if _, err := os.Stat(path); err == nil {
+					c.Args = path
+				}
+			}
+
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return out, nil
+}
+
+// parseTools parses the JSON of a TOOLS command, which is either a single
+// tool or a list of them
+func parseTools(s string) (api.Tools, error) {
+	var tools api.Tools
+	if strings.HasPrefix(strings.TrimSpace(s), "[") {
+		if err := json.Unmarshal([]byte(s), &tools); err != nil {
+			return nil, fmt.Errorf("invalid tools: %w", err)
+		}
+	} else {
+		var tool api.Tool
+		if err := json.Unmarshal([]byte(s), &tool); err != nil {
+			return nil, fmt.Errorf("invalid tools: %w", err)
+		}
+
+		tools = api.Tools{tool}
+	}
+
+	for _, tool := range tools {
+		if tool.Function.Name == "" {
+			return nil, errors.New("invalid tools: function name is required")
+		}
+	}
+
+	return tools, nil
+}
+
+// validateParameter checks that name is a known parameter and value has the
+// right type for it
+func validateParameter(name, value string) error {
+	if slices.Contains(deprecatedParameters, name) {
+		return nil
+	}
+
+	_, err := api.FormatParams(map[string][]string{name: {value}})
+	return err
+}
+
 func fileDigestMap(path string) (map[string]string, error) {
 	fl := make(map[string]string)
 
@@ -319,7 +430,7 @@ func (c Command) String() string {
 	switch c.Name {
 	case "model":
 		fmt.Fprintf(&sb, "FROM %s", c.Args)
-	case "license", "template", "system", "adapter":
+	case "license", "template", "system", "adapter", "include", "tools", "draft":
 		fmt.Fprintf(&sb, "%s %s", strings.ToUpper(c.Name), quote(c.Args))
 	case "message":
 		role, message, _ := strings.Cut(c.Args, ": ")
@@ -345,7 +456,7 @@ const (
 var (
 	errMissingFrom        = errors.New("no FROM line")
 	errInvalidMessageRole = errors.New("message role must be one of \"system\", \"user\", or \"assistant\"")
-	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"parameter\", or \"message\"")
+	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"parameter\", \"message\", \"include\", \"tools\", or \"draft\"")
 )
 
 type ParserError struct {
@@ -360,10 +471,29 @@ func (e *ParserError) Error() string {
 	return e.Msg
 }
 
+// ParseFile parses a Modelfile, which must have a FROM command or include a
+// Modelfile with one
 func ParseFile(r io.Reader) (*Modelfile, error) {
+	f, err := parseFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range f.Commands {
+		if cmd.Name == "model" || cmd.Name == "include" {
+			return f, nil
+		}
+	}
+
+	return nil, errMissingFrom
+}
+
+func parseFile(r io.Reader) (*Modelfile, error) {
 	var cmd Command
 	var curr state
 	var currLine int = 1
+	// cmdLine is the line the current command starts on
+	var cmdLine int
 	var b bytes.Buffer
 	var role string
 
@@ -397,6 +527,8 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 		// process the state transition, some transitions need to be intercepted and redirected
 		if next != curr {
 			switch curr {
+			case stateNil:
+				cmdLine = currLine
 			case stateName:
 				if !isValidCommand(b.String()) {
 					return nil, &ParserError{
@@ -430,7 +562,7 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 				}
 
 				role = b.String()
-			case stateComment, stateNil:
+			case stateComment:
 				// pass
 			case stateValue:
 				s, ok := unquote(strings.TrimSpace(b.String()))
@@ -448,6 +580,13 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 				}
 
 				cmd.Args = s
+				if err := validateCommand(cmd); err != nil {
+					return nil, &ParserError{
+						LineNumber: cmdLine,
+						Msg:        err.Error(),
+					}
+				}
+
 				f.Commands = append(f.Commands, cmd)
 			}
 
@@ -477,18 +616,39 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 		}
 
 		cmd.Args = s
+		if err := validateCommand(cmd); err != nil {
+			return nil, &ParserError{
+				LineNumber: cmdLine,
+				Msg:        err.Error(),
+			}
+		}
+
 		f.Commands = append(f.Commands, cmd)
 	default:
 		return nil, io.ErrUnexpectedEOF
 	}
 
-	for _, cmd := range f.Commands {
-		if cmd.Name == "model" {
-			return &f, nil
+	return &f, nil
+}
+
+// validateCommand checks the arguments of commands which can be checked
+// without the files or models they refer to
+func validateCommand(cmd Command) error {
+	switch cmd.Name {
+	case "model", "adapter", "license", "template", "system", "message":
+		return nil
+	case "include", "draft":
+		if cmd.Args == "" {
+			return fmt.Errorf("%s requires an argument", strings.ToUpper(cmd.Name))
 		}
-	}
 
-	return nil, errMissingFrom
+		return nil
+	case "tools":
+		_, err := parseTools(cmd.Args)
+		return err
+	default:
+		return validateParameter(cmd.Name, cmd.Args)
+	}
 }
 
 func parseRuneForState(r rune, cs state) (state, rune, error) {
@@ -605,7 +765,7 @@ func isValidMessageRole(role string) bool {
 
 func isValidCommand(cmd string) bool {
 	switch strings.ToLower(cmd) {
-	case "from", "license", "template", "system", "adapter", "parameter", "message":
+	case "from", "license", "template", "system", "adapter", "parameter", "message", "include", "tools", "draft":
 		return true
 	default:
 		return false
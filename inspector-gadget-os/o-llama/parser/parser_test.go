@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"unicode/utf16"
@@ -27,8 +28,8 @@ func TestParseFileFile(t *testing.T) {
 FROM model1
 ADAPTER adapter1
 LICENSE MIT
-PARAMETER param1 value1
-PARAMETER param2 value2
+PARAMETER stop value1
+PARAMETER stop value2
 TEMPLATE """{{ if .System }}<|start_header_id|>system<|end_header_id|>
 
 {{ .System }}<|eot_id|>{{ end }}{{ if .Prompt }}<|start_header_id|>user<|end_header_id|>
@@ -47,8 +48,8 @@ TEMPLATE """{{ if .System }}<|start_header_id|>system<|end_header_id|>
 		{Name: "model", Args: "model1"},
 		{Name: "adapter", Args: "adapter1"},
 		{Name: "license", Args: "MIT"},
-		{Name: "param1", Args: "value1"},
-		{Name: "param2", Args: "value2"},
+		{Name: "stop", Args: "value1"},
+		{Name: "stop", Args: "value2"},
 		{Name: "template", Args: "{{ if .System }}<|start_header_id|>system<|end_header_id|>\n\n{{ .System }}<|eot_id|>{{ end }}{{ if .Prompt }}<|start_header_id|>user<|end_header_id|>\n\n{{ .Prompt }}<|eot_id|>{{ end }}<|start_header_id|>assistant<|end_header_id|>\n\n{{ .Response }}<|eot_id|>"},
 	}
 
@@ -60,8 +61,8 @@ func TestParseFileTrimSpace(t *testing.T) {
 FROM "     model 1"
 ADAPTER      adapter3
 LICENSE "MIT       "
-PARAMETER param1        value1
-PARAMETER param2    value2
+PARAMETER stop        value1
+PARAMETER stop    value2
 TEMPLATE """   {{ if .System }}<|start_header_id|>system<|end_header_id|>
 
 {{ .System }}<|eot_id|>{{ end }}{{ if .Prompt }}<|start_header_id|>user<|end_header_id|>
@@ -80,8 +81,8 @@ TEMPLATE """   {{ if .System }}<|start_header_id|>system<|end_header_id|>
 		{Name: "model", Args: "     model 1"},
 		{Name: "adapter", Args: "adapter3"},
 		{Name: "license", Args: "MIT       "},
-		{Name: "param1", Args: "value1"},
-		{Name: "param2", Args: "value2"},
+		{Name: "stop", Args: "value1"},
+		{Name: "stop", Args: "value2"},
 		{Name: "template", Args: "   {{ if .System }}<|start_header_id|>system<|end_header_id|>\n\n{{ .System }}<|eot_id|>{{ end }}{{ if .Prompt }}<|start_header_id|>user<|end_header_id|>\n\n{{ .Prompt }}<|eot_id|>{{ end }}<|start_header_id|>assistant<|end_header_id|>\n\n{{ .Response }}<|eot_id|>   "},
 	}
 
@@ -100,8 +101,8 @@ func TestParseFileFrom(t *testing.T) {
 			nil,
 		},
 		{
-			"FROM \"FOO BAR\"\nPARAMETER param1 value1",
-			[]Command{{Name: "model", Args: "FOO BAR"}, {Name: "param1", Args: "value1"}},
+			"FROM \"FOO BAR\"\nPARAMETER stop value1",
+			[]Command{{Name: "model", Args: "FOO BAR"}, {Name: "stop", Args: "value1"}},
 			nil,
 		},
 		{
@@ -143,18 +144,18 @@ func TestParseFileFrom(t *testing.T) {
 			"", nil, errMissingFrom,
 		},
 		{
-			"PARAMETER param1 value1",
+			"PARAMETER stop value1",
 			nil,
 			errMissingFrom,
 		},
 		{
-			"PARAMETER param1 value1\nFROM foo",
-			[]Command{{Name: "param1", Args: "value1"}, {Name: "model", Args: "foo"}},
+			"PARAMETER stop value1\nFROM foo",
+			[]Command{{Name: "stop", Args: "value1"}, {Name: "model", Args: "foo"}},
 			nil,
 		},
 		{
-			"PARAMETER what the \nFROM lemons make lemonade ",
-			[]Command{{Name: "what", Args: "the"}, {Name: "model", Args: "lemons make lemonade"}},
+			"PARAMETER stop the \nFROM lemons make lemonade ",
+			[]Command{{Name: "stop", Args: "the"}, {Name: "model", Args: "lemons make lemonade"}},
 			nil,
 		},
 	}
@@ -468,6 +469,57 @@ TEMPLATE """
 	}
 }
 
+func TestParseFileInvalid(t *testing.T) {
+	cases := map[string]struct {
+		input string
+		err   ParserError
+	}{
+		"unknown parameter": {
+			"FROM foo\nPARAMETER temperature 0.5\nPARAMETER temprature 0.5\n",
+			ParserError{LineNumber: 3, Msg: "unknown parameter 'temprature'"},
+		},
+		"invalid float": {
+			"FROM foo\n\nPARAMETER temperature hot\n",
+			ParserError{LineNumber: 3, Msg: "invalid float value [hot]"},
+		},
+		"invalid int": {
+			"FROM foo\nPARAMETER num_ctx 4k",
+			ParserError{LineNumber: 2, Msg: "invalid int value [4k]"},
+		},
+		"invalid bool": {
+			"FROM foo\nPARAMETER use_mmap \"\"\"maybe\"\"\"\n",
+			ParserError{LineNumber: 2, Msg: "invalid bool value [maybe]"},
+		},
+		"invalid tools": {
+			"FROM foo\nTOOLS \"\"\"\n{\"type\": \"function\",\n\"function\": {}}\n\"\"\"\nSYSTEM hi\n",
+			ParserError{LineNumber: 2, Msg: "invalid tools: function name is required"},
+		},
+		"malformed tools": {
+			"FROM foo\nTOOLS {\"type\": \"function\"\n",
+			ParserError{LineNumber: 2, Msg: "invalid tools: unexpected end of JSON input"},
+		},
+		"empty draft": {
+			"FROM foo\nDRAFT \"\"\n",
+			ParserError{LineNumber: 2, Msg: "DRAFT requires an argument"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseFile(strings.NewReader(tt.input))
+
+			var perr *ParserError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected ParserError, got %v", err)
+			}
+
+			if diff := cmp.Diff(tt.err, *perr); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestParseFileParameters(t *testing.T) {
 	cases := map[string]struct {
 		name, value string
@@ -551,8 +603,8 @@ func TestParseFileFormatParseFile(t *testing.T) {
 FROM foo
 ADAPTER adapter1
 LICENSE MIT
-PARAMETER param1 value1
-PARAMETER param2 value2
+PARAMETER stop value1
+PARAMETER stop value2
 TEMPLATE template1
 MESSAGE system You are a file parser. Always parse things.
 MESSAGE user Hey there!
@@ -562,8 +614,8 @@ MESSAGE assistant Hello, I want to parse all the things!
 FROM foo
 ADAPTER adapter1
 LICENSE MIT
-PARAMETER param1 value1
-PARAMETER param2 value2
+PARAMETER stop value1
+PARAMETER stop value2
 TEMPLATE template1
 MESSAGE system """
 You are a store greeter. Always respond with "Hello!".
@@ -580,8 +632,8 @@ Blah blah blah.
 "Oh look, a quote!"
 """
 
-PARAMETER param1 value1
-PARAMETER param2 value2
+PARAMETER stop value1
+PARAMETER stop value2
 TEMPLATE template1
 MESSAGE system """
 You are a store greeter. Always respond with "Hello!".
@@ -592,6 +644,11 @@ MESSAGE assistant Hello, I want to parse all the things!
 		`
 FROM foo
 SYSTEM ""
+`,
+		`
+INCLUDE base.Modelfile
+DRAFT foo-draft
+TOOLS """{"type": "function", "function": {"name": "get_weather"}}"""
 `,
 	}
 
@@ -610,15 +667,15 @@ SYSTEM ""
 
 func TestParseFileUTF16ParseFile(t *testing.T) {
 	data := `FROM bob
-PARAMETER param1 1
-PARAMETER param2 4096
+PARAMETER stop 1
+PARAMETER num_ctx 4096
 SYSTEM You are a utf16 file.
 `
 
 	expected := []Command{
 		{Name: "model", Args: "bob"},
-		{Name: "param1", Args: "1"},
-		{Name: "param2", Args: "4096"},
+		{Name: "stop", Args: "1"},
+		{Name: "num_ctx", Args: "4096"},
 		{Name: "system", Args: "You are a utf16 file."},
 	}
 
@@ -726,6 +783,25 @@ MESSAGE assistant Hi! How are you?
 				},
 			},
 		},
+		{
+			`FROM test
+DRAFT test-draft
+TOOLS {"type": "function", "function": {"name": "get_time"}}
+TOOLS """[
+  {"type": "function", "function": {"name": "get_weather"}},
+  {"type": "function", "function": {"name": "get_date"}}
+]"""
+`,
+			&api.CreateRequest{
+				From:       "test",
+				Parameters: map[string]any{"draft_model": "test-draft"},
+				Tools: []api.Tool{
+					{Type: "function", Function: api.ToolFunction{Name: "get_time"}},
+					{Type: "function", Function: api.ToolFunction{Name: "get_weather"}},
+					{Type: "function", Function: api.ToolFunction{Name: "get_date"}},
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -750,6 +826,85 @@ MESSAGE assistant Hi! How are you?
 	}
 }
 
+func TestCreateRequestInclude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "base", "weights"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	n, d := createBinFile(t, nil, nil)
+	if err := os.Rename(n, filepath.Join(dir, "base", "weights", "model.gguf")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"Modelfile":             "INCLUDE base/Modelfile\nPARAMETER temperature 0.2\nSYSTEM You are a pirate.\n",
+		"base/Modelfile":        "FROM ./weights\nINCLUDE params.Modelfile\nSYSTEM You are a bot.\n",
+		"base/params.Modelfile": "PARAMETER temperature 0.8\nPARAMETER stop <|end|>\n",
+		"cycle/a.Modelfile":     "FROM foo\nINCLUDE b.Modelfile\n",
+		"cycle/b.Modelfile":     "INCLUDE a.Modelfile\n",
+	}
+
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parse := func(name string) (*api.CreateRequest, error) {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		modelfile, err := ParseFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return modelfile.CreateRequest(filepath.Dir(filepath.Join(dir, name)))
+	}
+
+	t.Run("nested", func(t *testing.T) {
+		actual, err := parse("Modelfile")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := &api.CreateRequest{
+			Files:      map[string]string{filepath.Join(dir, "base", "weights", "model.gguf"): d},
+			System:     "You are a pirate.",
+			Parameters: map[string]any{"temperature": float32(0.2), "stop": []string{"<|end|>"}},
+		}
+
+		if diff := cmp.Diff(actual, expected); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		if _, err := parse(filepath.Join("cycle", "a.Modelfile")); err == nil || !strings.Contains(err.Error(), "include cycle") {
+			t.Errorf("expected include cycle error, got %v", err)
+		}
+	})
+
+	t.Run("missing from", func(t *testing.T) {
+		modelfile, err := ParseFile(strings.NewReader("INCLUDE base/params.Modelfile\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := modelfile.CreateRequest(dir); !errors.Is(err, errMissingFrom) {
+			t.Errorf("expected %v, got %v", errMissingFrom, err)
+		}
+	})
+}
+
 func getSHA256Digest(t *testing.T, r io.Reader) (string, int64) {
 	t.Helper()
 
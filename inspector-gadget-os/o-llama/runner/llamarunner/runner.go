@@ -87,6 +87,7 @@ type Sequence struct {
 	startGenerationTime time.Time
 	numDecoded          int
 	numPromptInputs     int
+	numCached           int
 }
 
 type NewSequenceParams struct {
@@ -303,6 +304,7 @@ func (s *Server) removeSequence(seqIndex int, reason llm.DoneReason) {
 
 	flushPending(seq)
 	seq.doneReason = reason
+	seq.numCached = len(seq.cache.Inputs)
 	close(seq.responses)
 	close(seq.embedding)
 	seq.cache.InUse = false
@@ -644,6 +646,7 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 					PromptEvalDuration: seq.startGenerationTime.Sub(seq.startProcessingTime),
 					EvalCount:          seq.numDecoded,
 					EvalDuration:       time.Since(seq.startGenerationTime),
+					CacheCount:         seq.numCached,
 				}); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode final response: %v", err), http.StatusInternalServerError)
 				}
@@ -663,20 +666,84 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	seq, err := s.NewSequence(req.Content, nil, NewSequenceParams{embedding: true})
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create new sequence: %v", err), http.StatusInternalServerError)
+	embedding, err := s.embed(r.Context(), req.Content)
+	if errors.Is(err, context.Canceled) {
+		slog.Info("aborting embeddings request due to client closing the connection")
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&llm.EmbeddingResponse{
+		Embedding: embedding,
+	}); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// batchEmbeddings embeds several inputs at once. They are added as sequences
+// as soon as there are free slots, so that they are decoded together.
+func (s *Server) batchEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req llm.EmbeddingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %s", err), http.StatusBadRequest)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var err error
+	embeddings := make([][]float32, len(req.Content))
+	for i, content := range req.Content {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			embedding, e := s.embed(ctx, content)
+			if e != nil {
+				once.Do(func() {
+					err = e
+					cancel()
+				})
+				return
+			}
+			embeddings[i] = embedding
+		}()
+	}
+	wg.Wait()
+
+	if errors.Is(err, context.Canceled) {
+		slog.Info("aborting embeddings request due to client closing the connection")
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&llm.EmbeddingsResponse{
+		Embeddings: embeddings,
+	}); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) embed(ctx context.Context, content string) ([]float32, error) {
+	seq, err := s.NewSequence(content, nil, NewSequenceParams{embedding: true})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new sequence: %v", err)
+	}
+
 	// Ensure there is a place to put the sequence, released when removed from s.seqs
-	if err := s.seqsSem.Acquire(r.Context(), 1); err != nil {
+	if err := s.seqsSem.Acquire(ctx, 1); err != nil {
 		if errors.Is(err, context.Canceled) {
-			slog.Info("aborting embeddings request due to client closing the connection")
-		} else {
-			http.Error(w, fmt.Sprintf("Failed to acquire semaphore: %v", err), http.StatusInternalServerError)
+			return nil, err
 		}
-		return
+		return nil, fmt.Errorf("Failed to acquire semaphore: %v", err)
 	}
 
 	s.mu.Lock()
@@ -687,8 +754,7 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				s.mu.Unlock()
 				s.seqsSem.Release(1)
-				http.Error(w, fmt.Sprintf("Failed to load cache: %v", err), http.StatusInternalServerError)
-				return
+				return nil, fmt.Errorf("Failed to load cache: %v", err)
 			}
 			s.seqs[i] = seq
 			s.cond.Signal()
@@ -700,17 +766,10 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 
 	if !found {
 		s.seqsSem.Release(1)
-		http.Error(w, "could not find an available sequence", http.StatusInternalServerError)
-		return
+		return nil, errors.New("could not find an available sequence")
 	}
 
-	embedding := <-seq.embedding
-
-	if err := json.NewEncoder(w).Encode(&llm.EmbeddingResponse{
-		Embedding: embedding,
-	}); err != nil {
-		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
-	}
+	return <-seq.embedding, nil
 }
 
 func (s *Server) health(w http.ResponseWriter, r *http.Request) {
@@ -864,6 +923,7 @@ func Execute(args []string) error {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/embedding", server.embeddings)
+	mux.HandleFunc("/embeddings", server.batchEmbeddings)
 	mux.HandleFunc("/completion", server.completion)
 	mux.HandleFunc("/health", server.health)
 
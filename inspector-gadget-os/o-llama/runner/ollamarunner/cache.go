@@ -29,6 +29,9 @@ type InputCache struct {
 	multiUserCache bool
 
 	cache kvcache.Cache
+
+	// optional store for saving slots to disk, nil if disabled
+	snapshots *snapshotStore
 }
 
 func NewInputCache(model model.Model, kvCacheType string, kvSize int32, numSlots int, batchSize int, multiUserCache bool) (*InputCache, error) {
@@ -74,6 +77,10 @@ func (c *InputCache) Close() {
 		return
 	}
 
+	if c.snapshots != nil {
+		c.snapshots.wait()
+	}
+
 	c.cache.Close()
 }
 
@@ -116,6 +123,10 @@ func (c *InputCache) LoadCacheSlot(prompt []input.Input) (*InputCacheSlot, []inp
 	slot.InUse = true
 	slot.lastUsed = time.Now()
 
+	if c.snapshots != nil && c.cache != nil {
+		numPast = c.restoreSnapshot(slot, prompt, numPast)
+	}
+
 	if numPast == int32(len(prompt)) {
 		// Leave one input to sample so we can get a response
 		numPast--
@@ -215,6 +226,76 @@ func (c *InputCache) findBestCacheSlot(prompt []input.Input) (*InputCacheSlot, i
 	return oldestSlot, longest, nil
 }
 
+// restoreSnapshot replaces the contents of a slot with a snapshot from disk
+// if one shares a longer prefix with the prompt than the slot does, returning
+// the number of inputs that can be reused
+func (c *InputCache) restoreSnapshot(slot *InputCacheSlot, prompt []input.Input, numPast int32) int32 {
+	s, ok := c.cache.(kvcache.Snapshotter)
+	if !ok {
+		return numPast
+	}
+
+	digest, count := c.snapshots.find(prompt)
+	if count <= numPast || count < minSnapshotInputs {
+		return numPast
+	}
+
+	snapshot, err := c.snapshots.load(digest)
+	if err != nil {
+		slog.Warn("unable to load kv cache snapshot", "digest", digest, "error", err)
+		return numPast
+	}
+
+	err = c.cache.Remove(slot.Id, 0, math.MaxInt32)
+	if err == nil {
+		err = s.Restore(slot.Id, snapshot)
+	}
+	if err != nil {
+		slog.Warn("unable to restore kv cache snapshot", "digest", digest, "error", err)
+		_ = c.cache.Remove(slot.Id, 0, math.MaxInt32)
+		slot.Inputs = nil
+		return 0
+	}
+
+	slog.Debug("restored kv cache snapshot", "id", slot.Id, "digest", digest, "inputs", len(snapshot.Positions), "used", count)
+	return count
+}
+
+// saveSnapshot writes the contents of a slot to disk so that later
+// sequences can reuse them, even after the runner has exited
+func (c *InputCache) saveSnapshot(slot *InputCacheSlot) {
+	if c.snapshots == nil || c.cache == nil {
+		return
+	}
+
+	s, ok := c.cache.(kvcache.Snapshotter)
+	if !ok {
+		return
+	}
+
+	// Only the text before the first image is saved, since images can't be
+	// matched against later prompts without their data
+	inputs := make([]int32, 0, len(slot.Inputs))
+	for _, inp := range slot.Inputs {
+		if inp.Multimodal != nil || inp.MultimodalHash != 0 {
+			break
+		}
+		inputs = append(inputs, inp.Token)
+	}
+
+	if len(inputs) < minSnapshotInputs || !c.snapshots.wants(inputs) {
+		return
+	}
+
+	snapshot, err := s.Snapshot(slot.Id, int32(len(inputs)))
+	if err != nil {
+		slog.Debug("unable to snapshot kv cache", "id", slot.Id, "error", err)
+		return
+	}
+
+	c.snapshots.save(inputs, snapshot)
+}
+
 func countCommonPrefix(a []input.Input, b []input.Input) int32 {
 	var count int32
 
@@ -0,0 +1,320 @@
+package ollamarunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+)
+
+// maxVocabDifference is how many more tokens one of the main and draft
+// vocabularies may have than the other, matching llama.cpp
+const maxVocabDifference = 128
+
+// draftModel proposes tokens for speculative decoding. It is a smaller model
+// sharing the main model's vocabulary, with one cache slot for each slot of
+// the main model's cache so that each sequence keeps its own draft context.
+type draftModel struct {
+	model model.Model
+	cache *InputCache
+
+	batchSize int
+	isEOS     func(int32) bool
+}
+
+func newDraftModel(mpath string, params ml.BackendParams, main model.Model, kvCacheType string, kvSize int, parallel int, batchSize int) (*draftModel, error) {
+	m, err := model.New(mpath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	mainText, ok := main.(model.TextProcessor)
+	if !ok {
+		m.Backend().Close()
+		return nil, errors.New("main model does not generate text")
+	}
+
+	draftText, ok := m.(model.TextProcessor)
+	if !ok {
+		m.Backend().Close()
+		return nil, errors.New("draft model does not generate text")
+	}
+
+	if err := compatibleVocab(mainText.Vocabulary(), draftText.Vocabulary()); err != nil {
+		m.Backend().Close()
+		return nil, err
+	}
+
+	cache, err := NewInputCache(m, kvCacheType, int32(kvSize), parallel, batchSize, false)
+	if err != nil {
+		m.Backend().Close()
+		return nil, err
+	}
+
+	if !cache.enabled {
+		cache.Close()
+		m.Backend().Close()
+		return nil, errors.New("draft model does not support caching")
+	}
+
+	return &draftModel{
+		model:     m,
+		cache:     cache,
+		batchSize: batchSize,
+		isEOS:     func(id int32) bool { return mainText.Is(id, model.SpecialEOS) },
+	}, nil
+}
+
+// compatibleVocab checks that token ids mean the same thing to both models,
+// so that drafted ids can be verified directly by the main model
+func compatibleVocab(main, draft *model.Vocabulary) error {
+	if diff := len(main.Values) - len(draft.Values); diff > maxVocabDifference || -diff > maxVocabDifference {
+		return fmt.Errorf("vocabulary sizes differ too much (main: %d draft: %d)", len(main.Values), len(draft.Values))
+	}
+
+	if !slices.Equal(main.BOS, draft.BOS) || !slices.Equal(main.EOS, draft.EOS) {
+		return errors.New("special tokens differ")
+	}
+
+	for i := range min(len(main.Values), len(draft.Values)) {
+		if main.Values[i] != draft.Values[i] {
+			return fmt.Errorf("token %d differs (main: %q draft: %q)", i, main.Values[i], draft.Values[i])
+		}
+	}
+
+	return nil
+}
+
+func (d *draftModel) load(ctx context.Context) error {
+	return d.model.Backend().Load(ctx, func(float32) {})
+}
+
+func (d *draftModel) Close() {
+	d.cache.Close()
+	d.model.Backend().Close()
+}
+
+// propose brings the draft context of a cache slot up to date with inputs,
+// the main model's processed inputs followed by its next input, and then
+// greedily drafts up to n tokens to follow them
+func (d *draftModel) propose(slotId int, inputs []input.Input, n int) ([]int32, error) {
+	if n <= 0 || len(inputs) == 0 {
+		return nil, nil
+	}
+
+	// The draft model cannot see images
+	if slices.ContainsFunc(inputs, func(inp input.Input) bool { return inp.Multimodal != nil }) {
+		return nil, nil
+	}
+
+	slot := &d.cache.slots[slotId]
+
+	numPast := countCommonPrefix(slot.Inputs, inputs)
+	if numPast == int32(len(inputs)) {
+		// Reprocess the last input to get logits for the first draft
+		numPast--
+	}
+
+	if err := d.cache.cache.Remove(slotId, numPast, math.MaxInt32); err != nil {
+		if err := d.cache.cache.Remove(slotId, 0, math.MaxInt32); err != nil {
+			return nil, err
+		}
+		numPast = 0
+	}
+	slot.Inputs = slot.Inputs[:numPast]
+
+	var logits []float32
+	pending := inputs[numPast:]
+	for len(pending) > 0 {
+		chunk := pending[:min(len(pending), d.batchSize)]
+		pending = pending[len(chunk):]
+
+		var err error
+		logits, err = d.forward(slot, chunk)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	draft := make([]int32, 0, n)
+	for {
+		token := argmax(logits)
+		draft = append(draft, token)
+		if len(draft) == n || d.isEOS(token) || len(slot.Inputs) >= int(d.cache.numCtx) {
+			return draft, nil
+		}
+
+		var err error
+		logits, err = d.forward(slot, []input.Input{{Token: token}})
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// forward adds inputs to a slot's draft context and returns the logits
+// following the last of them
+func (d *draftModel) forward(slot *InputCacheSlot, inputs []input.Input) ([]float32, error) {
+	ctx := d.model.Backend().NewContext()
+	defer ctx.Close()
+
+	tokens := make([]int32, len(inputs))
+	batch := input.Batch{
+		Positions: make([]int32, len(inputs)),
+		Sequences: make([]int, len(inputs)),
+		Outputs:   []int32{int32(len(inputs) - 1)},
+	}
+	for i, inp := range inputs {
+		tokens[i] = inp.Token
+		batch.Positions[i] = int32(len(slot.Inputs) + i)
+		batch.Sequences[i] = slot.Id
+	}
+
+	out, err := model.Forward(ctx, d.model, tokens, batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode draft batch: %w", err)
+	}
+
+	slot.Inputs = append(slot.Inputs, inputs...)
+	return out.Floats(), nil
+}
+
+func argmax(logits []float32) int32 {
+	var best int
+	for i := range logits {
+		if logits[i] > logits[best] {
+			best = i
+		}
+	}
+	return int32(best)
+}
+
+// acceptDraft verifies drafted tokens against the main model. sample returns
+// the main model's token at each position, given that all earlier drafted
+// tokens were accepted; it is called in order until a sampled token differs
+// from the draft or sample asks to stop. The result is the accepted draft
+// tokens followed by the token sampled at the first rejected position, or
+// after the last drafted token when all were accepted.
+func acceptDraft(draft []int32, sample func(i int) (int32, bool, error)) ([]int32, error) {
+	accepted := make([]int32, 0, len(draft)+1)
+	for i := 0; i <= len(draft); i++ {
+		token, more, err := sample(i)
+		if err != nil {
+			return nil, err
+		}
+
+		accepted = append(accepted, token)
+		if !more || i == len(draft) || token != draft[i] {
+			break
+		}
+	}
+
+	return accepted, nil
+}
+
+// draftTokens appends tokens proposed by the draft model to the next input of
+// a generating sequence, using at most space positions of the batch
+func (s *Server) draftTokens(seq *Sequence, space int) error {
+	seq.draft = nil
+
+	if s.draft == nil || !s.cache.enabled || seq.embeddingOnly || seq.numPredicted == 0 ||
+		len(seq.inputs) != 1 || len(seq.pendingInputs) != 0 {
+		return nil
+	}
+
+	// Leave room for the sequence's next input and stay within the context
+	// and prediction limits so that verification never has to be split
+	n := min(seq.numDraft, space-1, int(s.cache.numCtx)-len(seq.cache.Inputs)-1)
+	if seq.numPredict > 0 {
+		n = min(n, seq.numPredict-seq.numPredicted-1)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	inputs := append(seq.cache.Inputs[:len(seq.cache.Inputs):len(seq.cache.Inputs)], seq.inputs[0])
+	draft, err := s.draft.propose(seq.cache.Id, inputs, n)
+	if err != nil {
+		slog.Warn("draft model failed, disabling speculative decoding", "error", err)
+		s.draft.Close()
+		s.draft = nil
+		return nil
+	}
+
+	for _, token := range draft {
+		seq.inputs = append(seq.inputs, input.Input{Token: token})
+	}
+	seq.draft = draft
+	seq.numDrafted += len(draft)
+
+	return nil
+}
+
+// verifyDraft samples the main model's tokens at each drafted position of a
+// sequence, emitting them until one differs from the draft, and then drops
+// the rejected drafts from the cache
+func (s *Server) verifyDraft(seqIndex int, seq *Sequence, logits []float32, vocabSize int) error {
+	draft := seq.draft
+	seq.draft = nil
+
+	// The cache now holds the sequence's previous token followed by the draft
+	inputs := seq.cache.Inputs
+	base := len(inputs) - len(draft)
+
+	live := true
+	tokens, err := acceptDraft(draft, func(i int) (int32, bool, error) {
+		if i > 0 {
+			seq.numPredicted++
+		}
+
+		// Sampling and stop handling see only the tokens before this position
+		seq.cache.Inputs = inputs[:base+i]
+
+		iBatch := seq.iBatch + i
+		token, logprobs, err := s.sample(seq, logits[iBatch*vocabSize:(iBatch+1)*vocabSize])
+		if err != nil {
+			return -1, false, err
+		}
+
+		live, err = s.emitToken(seqIndex, seq, token, logprobs)
+		return token, live, err
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range min(len(tokens), len(draft)) {
+		if tokens[i] != draft[i] {
+			break
+		}
+		seq.numDraftAccepted++
+	}
+
+	if !live {
+		// The slot is released and its cache is trimmed when next loaded
+		return nil
+	}
+
+	if err := s.cache.cache.Remove(seq.cache.Id, int32(len(seq.cache.Inputs)), math.MaxInt32); err != nil {
+		slog.Warn("kv cache removal unsupported, disabling speculative decoding", "error", err)
+		if s.draft != nil {
+			s.draft.Close()
+			s.draft = nil
+		}
+
+		// Reprocess the sequence from an empty cache
+		if err := s.cache.cache.Remove(seq.cache.Id, 0, math.MaxInt32); err != nil {
+			return err
+		}
+		seq.inputs = append(slices.Clone(seq.cache.Inputs), seq.inputs...)
+		seq.cache.Inputs = []input.Input{}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package ollamarunner
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/model"
+)
+
+func TestCompatibleVocab(t *testing.T) {
+	main := &model.Vocabulary{
+		Values: []string{"<s>", "</s>", "a", "b", "c"},
+		BOS:    []int32{0},
+		EOS:    []int32{1},
+	}
+
+	tests := []struct {
+		name  string
+		draft *model.Vocabulary
+		ok    bool
+	}{
+		{
+			name:  "identical",
+			draft: &model.Vocabulary{Values: []string{"<s>", "</s>", "a", "b", "c"}, BOS: []int32{0}, EOS: []int32{1}},
+			ok:    true,
+		},
+		{
+			name:  "shorter",
+			draft: &model.Vocabulary{Values: []string{"<s>", "</s>", "a"}, BOS: []int32{0}, EOS: []int32{1}},
+			ok:    true,
+		},
+		{
+			name:  "different token",
+			draft: &model.Vocabulary{Values: []string{"<s>", "</s>", "a", "x", "c"}, BOS: []int32{0}, EOS: []int32{1}},
+		},
+		{
+			name:  "different eos",
+			draft: &model.Vocabulary{Values: []string{"<s>", "</s>", "a", "b", "c"}, BOS: []int32{0}, EOS: []int32{2}},
+		},
+		{
+			name:  "size difference",
+			draft: &model.Vocabulary{Values: make([]string, len(main.Values)+maxVocabDifference+1), BOS: []int32{0}, EOS: []int32{1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.draft.Values[0] == "" {
+				copy(tt.draft.Values, main.Values)
+			}
+
+			err := compatibleVocab(main, tt.draft)
+			if tt.ok && err != nil {
+				t.Errorf("expected compatible, got %v", err)
+			} else if !tt.ok && err == nil {
+				t.Error("expected incompatible vocabularies")
+			}
+		})
+	}
+}
+
+func TestAcceptDraft(t *testing.T) {
+	tests := []struct {
+		name    string
+		draft   []int32
+		target  []int32
+		stopAt  int
+		want    []int32
+		samples int
+	}{
+		{
+			name:    "all accepted",
+			draft:   []int32{1, 2, 3},
+			target:  []int32{1, 2, 3, 4},
+			stopAt:  -1,
+			want:    []int32{1, 2, 3, 4},
+			samples: 4,
+		},
+		{
+			name:    "rejected in the middle",
+			draft:   []int32{1, 2, 3},
+			target:  []int32{1, 5, 3, 4},
+			stopAt:  -1,
+			want:    []int32{1, 5},
+			samples: 2,
+		},
+		{
+			name:    "first rejected",
+			draft:   []int32{1, 2},
+			target:  []int32{7, 2, 3},
+			stopAt:  -1,
+			want:    []int32{7},
+			samples: 1,
+		},
+		{
+			name:    "sequence stops",
+			draft:   []int32{1, 2, 3},
+			target:  []int32{1, 2, 3, 4},
+			stopAt:  1,
+			want:    []int32{1, 2},
+			samples: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var samples int
+			got, err := acceptDraft(tt.draft, func(i int) (int32, bool, error) {
+				samples++
+				return tt.target[i], i != tt.stopAt, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if samples != tt.samples {
+				t.Errorf("sampled %d positions, want %d", samples, tt.samples)
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		want := errors.New("sample failed")
+		_, err := acceptDraft([]int32{1}, func(int) (int32, bool, error) { return -1, false, want })
+		if !errors.Is(err, want) {
+			t.Errorf("got %v, want %v", err, want)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package ollamarunner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+
+	"github.com/ollama/ollama/fs/imatrix"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/model/input"
+)
+
+// collectImportance starts collecting importance statistics for the model.
+// It must be called before the worst case graph is reserved, which then
+// includes the statistics.
+func (s *Server) collectImportance() error {
+	collector, ok := s.model.Backend().(ml.ImportanceCollector)
+	if !ok {
+		return errors.New("backend does not support importance matrices")
+	}
+
+	collector.CollectImportance(func(name string, sumSquares []float32, n int) {
+		if s.importance == nil {
+			return
+		}
+
+		if err := s.importance.Add(name, sumSquares, n); err != nil && s.importanceErr == nil {
+			s.importanceErr = err
+		}
+	})
+
+	return nil
+}
+
+func (s *Server) imatrix(w http.ResponseWriter, r *http.Request) {
+	if !s.imatrixRunner {
+		http.Error(w, "runner was not started to compute importance matrices", http.StatusBadRequest)
+		return
+	}
+
+	var req llm.ImatrixRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if req.ChunkSize < 2 || req.ChunkSize > s.batchSize || int32(req.ChunkSize) > s.cache.numCtx {
+		http.Error(w, fmt.Sprintf("chunk size must be between 2 and %d, got %d", min(s.batchSize, int(s.cache.numCtx)), req.ChunkSize), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Transfer-Encoding", "chunked")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// take every sequence so that nothing else runs on the model while its
+	// statistics are collected
+	if err := s.seqsSem.Acquire(r.Context(), int64(s.parallel)); err != nil {
+		if errors.Is(err, context.Canceled) {
+			slog.Info("aborting importance matrix request due to client closing the connection")
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to acquire semaphore: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer s.seqsSem.Release(int64(s.parallel))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	matrix, err := s.computeImatrix(r.Context(), req, func(chunk, chunks int) {
+		enc.Encode(&llm.ImatrixResponse{Chunk: chunk, Chunks: chunks})
+		flusher.Flush()
+	})
+	if err == nil {
+		err = matrix.WriteFile(req.Path)
+	}
+	if err != nil {
+		enc.Encode(&llm.ImatrixResponse{Error: err.Error()})
+		return
+	}
+
+	enc.Encode(&llm.ImatrixResponse{
+		Chunk:   matrix.ChunkCount,
+		Chunks:  matrix.ChunkCount,
+		Weights: len(matrix.Entries),
+		Done:    true,
+	})
+}
+
+// computeImatrix computes an importance matrix by running the model over
+// req.Text. progress is called after each chunk is processed. s.mu must be
+// held with no sequences running.
+func (s *Server) computeImatrix(ctx context.Context, req llm.ImatrixRequest, progress func(chunk, chunks int)) (*imatrix.Matrix, error) {
+	tp, ok := s.model.(model.TextProcessor)
+	if !ok {
+		return nil, errors.New("model does not process text")
+	}
+
+	tokens, err := tp.Encode(req.Text, false)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := len(tokens) / req.ChunkSize
+	if req.Chunks > 0 {
+		chunks = min(chunks, req.Chunks)
+	}
+
+	if chunks == 0 {
+		return nil, fmt.Errorf("calibration text has %d tokens, need at least %d", len(tokens), req.ChunkSize)
+	}
+
+	matrix := imatrix.New()
+	matrix.ChunkSize = req.ChunkSize
+	if req.Dataset != "" {
+		matrix.Datasets = []string{req.Dataset}
+	}
+
+	s.importance, s.importanceErr = matrix, nil
+	defer func() { s.importance, s.importanceErr = nil, nil }()
+
+	vocab := tp.Vocabulary()
+	for i := range chunks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		chunk := tokens[i*req.ChunkSize : (i+1)*req.ChunkSize]
+
+		// each chunk starts a new context so, like the first token of a
+		// prompt, starts with BOS
+		if vocab.AddBOS && len(vocab.BOS) > 0 {
+			chunk = append([]int32{vocab.BOS[0]}, chunk[1:]...)
+		}
+
+		if s.cache.enabled {
+			if err := s.cache.cache.Remove(0, 0, math.MaxInt32); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := imatrixForward(s.model, chunk); err != nil {
+			return nil, err
+		}
+
+		if s.importanceErr != nil {
+			return nil, s.importanceErr
+		}
+
+		matrix.ChunkCount++
+		if progress != nil {
+			progress(i+1, chunks)
+		}
+	}
+
+	// the first slot's cache no longer holds the inputs it remembers
+	s.cache.slots[0].Inputs = nil
+
+	return matrix, nil
+}
+
+// imatrixForward processes a chunk of tokens in the first sequence,
+// computing outputs for all of them so that the output weights see every
+// input
+func imatrixForward(m model.Model, tokens []int32) error {
+	ctx := m.Backend().NewContext()
+	defer ctx.Close()
+
+	batch := input.Batch{
+		Positions: make([]int32, len(tokens)),
+		Sequences: make([]int, len(tokens)),
+		Outputs:   make([]int32, len(tokens)),
+	}
+	for i := range tokens {
+		batch.Positions[i] = int32(i)
+		batch.Outputs[i] = int32(i)
+	}
+
+	if _, err := model.Forward(ctx, m, tokens, batch); err != nil {
+		return fmt.Errorf("failed to process chunk: %w", err)
+	}
+
+	return nil
+}
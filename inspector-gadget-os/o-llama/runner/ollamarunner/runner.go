@@ -14,6 +14,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -27,6 +28,7 @@ import (
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/fs/imatrix"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/ml"
@@ -58,11 +60,14 @@ type Sequence struct {
 	// tokens that have been generated but not returned yet (e.g. for stop sequences)
 	pendingResponses []string
 
+	// log probabilities of pendingResponses when requested, one per token
+	pendingLogprobs []api.Logprob
+
 	// input cache being used by this sequence
 	cache *InputCacheSlot
 
 	// channel to send responses over
-	responses chan string
+	responses chan llm.CompletionResponse
 
 	// channel to stop decoding (such as if the remote connection is closed)
 	quit chan bool
@@ -73,6 +78,19 @@ type Sequence struct {
 	// sampler with transforms to run on generated logits
 	sampler sample.Sampler
 
+	// reusable buffer of recent tokens passed to the sampler's penalties
+	history []int32
+
+	// whether to return log probabilities and how many alternatives per token
+	logprobs    bool
+	topLogprobs int
+
+	// maximum number of tokens to draft per step when a draft model is loaded
+	numDraft int
+
+	// tokens proposed by the draft model that follow inputs in the current batch
+	draft []int32
+
 	// channel to send back the embedding if embedding only
 	embedding chan []float32
 
@@ -92,6 +110,9 @@ type Sequence struct {
 	startGenerationTime time.Time
 	numPredicted        int
 	numPromptInputs     int
+	numDrafted          int
+	numDraftAccepted    int
+	numCached           int
 }
 
 type NewSequenceParams struct {
@@ -100,6 +121,10 @@ type NewSequenceParams struct {
 	numKeep    int32
 	sampler    sample.Sampler
 	embedding  bool
+
+	logprobs    bool
+	topLogprobs int
+	numDraft    int
 }
 
 func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSequenceParams) (*Sequence, error) {
@@ -168,13 +193,16 @@ func (s *Server) NewSequence(prompt string, images []llm.ImageData, params NewSe
 		startProcessingTime: startTime,
 		numPredict:          params.numPredict,
 		pendingResponses:    make([]string, 0),
-		responses:           make(chan string, 100),
+		responses:           make(chan llm.CompletionResponse, 100),
 		quit:                make(chan bool, 1),
 		embedding:           make(chan []float32, 1),
 		sampler:             params.sampler,
 		embeddingOnly:       params.embedding,
 		stop:                params.stop,
 		numKeep:             params.numKeep,
+		logprobs:            params.logprobs || params.topLogprobs > 0,
+		topLogprobs:         params.topLogprobs,
+		numDraft:            params.numDraft,
 	}, nil
 }
 
@@ -279,6 +307,10 @@ type Server struct {
 	// TODO (jmorganca): make this n_batch
 	batchSize int
 
+	// imatrixRunner is set if the runner computes importance matrices
+	// rather than serving completions
+	imatrixRunner bool
+
 	// protects access to everything below this line
 	// this is context state needed for decoding
 	mu sync.Mutex
@@ -296,6 +328,14 @@ type Server struct {
 	// KV cache
 	cache *InputCache
 
+	// optional draft model for speculative decoding
+	draft *draftModel
+
+	// importance receives the statistics of the importance matrix being
+	// computed, if any, and importanceErr the first error adding them
+	importance    *imatrix.Matrix
+	importanceErr error
+
 	// next sequence for prompt processing to avoid starvation
 	nextSeq int
 
@@ -315,7 +355,9 @@ func (s *Server) allNil() bool {
 
 func flushPending(seq *Sequence) bool {
 	joined := strings.Join(seq.pendingResponses, "")
+	logprobs := seq.pendingLogprobs
 	seq.pendingResponses = []string{}
+	seq.pendingLogprobs = nil
 
 	// Check if there are any partial UTF-8 characters remaining.
 	// We already check and queue as we are generating but some may
@@ -327,12 +369,12 @@ func flushPending(seq *Sequence) bool {
 		joined = joined[:len(joined)-1]
 	}
 
-	if len(joined) == 0 {
+	if len(joined) == 0 && len(logprobs) == 0 {
 		return true
 	}
 
 	select {
-	case seq.responses <- joined:
+	case seq.responses <- llm.CompletionResponse{Content: joined, Logprobs: logprobs}:
 		return true
 	case <-seq.quit:
 		return false
@@ -344,8 +386,10 @@ func (s *Server) removeSequence(seqIndex int, reason llm.DoneReason) {
 
 	flushPending(seq)
 	seq.doneReason = reason
+	seq.numCached = len(seq.cache.Inputs)
 	close(seq.responses)
 	close(seq.embedding)
+	s.cache.saveSnapshot(seq.cache)
 	seq.cache.InUse = false
 	s.seqs[seqIndex] = nil
 	s.seqsSem.Release(1)
@@ -403,6 +447,10 @@ func (s *Server) processBatch() error {
 
 		batchSize := s.batchSize
 
+		if err := s.draftTokens(seq, batchSize-len(batchInputs)); err != nil {
+			return err
+		}
+
 		for i, inp := range seq.inputs {
 			// If we are required to put following inputs into a single batch then extend the
 			// batch size. Since we are only extending the size the minimum amount possible, this
@@ -457,9 +505,17 @@ func (s *Server) processBatch() error {
 			batch.Positions = append(batch.Positions, int32(len(seq.cache.Inputs)+len(seq.pendingInputs)))
 			batch.Sequences = append(batch.Sequences, seq.cache.Id)
 
-			seq.iBatch = len(batch.Outputs)
-			if i+1 == len(seq.inputs) {
+			if len(seq.draft) > 0 {
+				// drafted tokens need the main model's output at every position
+				if i == 0 {
+					seq.iBatch = len(batch.Outputs)
+				}
 				batch.Outputs = append(batch.Outputs, int32(len(batchInputs)-1))
+			} else {
+				seq.iBatch = len(batch.Outputs)
+				if i+1 == len(seq.inputs) {
+					batch.Outputs = append(batch.Outputs, int32(len(batchInputs)-1))
+				}
 			}
 			seq.pendingInputs = append(seq.pendingInputs, inp)
 		}
@@ -519,71 +575,185 @@ func (s *Server) processBatch() error {
 		// sample a token
 		vocabSize := len(logits) / len(batch.Outputs)
 
-		token, err := seq.sampler.Sample(logits[seq.iBatch*vocabSize : (seq.iBatch+1)*vocabSize])
-		if err != nil {
-			return fmt.Errorf("failed to sample token: %w", err)
-		}
-
-		// if it's an end of sequence token, break
-		if s.model.(model.TextProcessor).Is(token, model.SpecialEOS) {
-			// TODO (jmorganca): we should send this back
-			// as it's important for the /api/generate context
-			// seq.responses <- piece
-
-			s.removeSequence(i, llm.DoneReasonStop)
+		if len(seq.draft) > 0 {
+			if err := s.verifyDraft(i, seq, logits, vocabSize); err != nil {
+				return err
+			}
 			continue
 		}
 
-		piece, err := s.model.(model.TextProcessor).Decode([]int32{token})
+		token, logprobs, err := s.sample(seq, logits[seq.iBatch*vocabSize:(seq.iBatch+1)*vocabSize])
 		if err != nil {
 			return err
 		}
 
-		seq.inputs = []input.Input{{Token: token}}
+		if _, err := s.emitToken(i, seq, token, logprobs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sample selects the next token of a sequence from the logits of its last input
+func (s *Server) sample(seq *Sequence, logits []float32) (int32, sample.Logprobs, error) {
+	var token int32
+	var logprobs sample.Logprobs
+	var err error
+	if seq.logprobs {
+		token, logprobs, err = seq.sampler.SampleWithLogprobs(logits, seq.recentTokens(), seq.topLogprobs)
+	} else {
+		token, err = seq.sampler.Sample(logits, seq.recentTokens())
+	}
+	if err != nil {
+		return -1, sample.Logprobs{}, fmt.Errorf("failed to sample token: %w", err)
+	}
 
-		seq.pendingResponses = append(seq.pendingResponses, piece)
-		sequence := strings.Join(seq.pendingResponses, "")
+	return token, logprobs, nil
+}
 
-		if ok, stop := common.FindStop(sequence, seq.stop); ok {
-			slog.Debug("hit stop token", "pending", seq.pendingResponses, "stop", stop)
+// emitToken makes a sampled token the next input of a sequence and queues its
+// text for the response. It returns false if the sequence has finished and
+// was removed.
+func (s *Server) emitToken(seqIndex int, seq *Sequence, token int32, logprobs sample.Logprobs) (bool, error) {
+	// if it's an end of sequence token, break
+	if s.model.(model.TextProcessor).Is(token, model.SpecialEOS) {
+		// TODO (jmorganca): we should send this back
+		// as it's important for the /api/generate context
+		// seq.responses <- piece
+
+		s.removeSequence(seqIndex, llm.DoneReasonStop)
+		return false, nil
+	}
 
-			var tokenTruncated bool
-			origLen := len(seq.pendingResponses)
-			seq.pendingResponses, tokenTruncated = common.TruncateStop(seq.pendingResponses, stop)
-			newLen := len(seq.pendingResponses)
+	piece, err := s.model.(model.TextProcessor).Decode([]int32{token})
+	if err != nil {
+		return false, err
+	}
 
-			// Update the cache based on the tokens that will be returned:
-			// - We have 1 token more than is currently in the cache because
-			// the last one generated wasn't submitted to Decode
-			// - Remove any stop sequences that we stripped out
-			// - If truncateStop removed a portion of a token, drop that
-			// - As defense-in-depth, if truncatedToken didn't find a stop token
-			// remove the extra one that we added to the cache len
-			tokenLen := len(seq.cache.Inputs) + 1
-			tokenLen -= origLen - newLen
-			if tokenTruncated || origLen == newLen {
-				tokenLen--
-			}
-			seq.cache.Inputs = seq.cache.Inputs[:tokenLen]
+	seq.inputs = []input.Input{{Token: token}}
 
-			s.removeSequence(i, llm.DoneReasonStop)
-			continue
+	seq.pendingResponses = append(seq.pendingResponses, piece)
+	if seq.logprobs {
+		lp, err := s.toLogprob(piece, logprobs)
+		if err != nil {
+			return false, err
 		}
+		seq.pendingLogprobs = append(seq.pendingLogprobs, lp)
+	}
+	sequence := strings.Join(seq.pendingResponses, "")
 
-		if common.ContainsStopSuffix(sequence, seq.stop) {
-			continue
+	if ok, stop := common.FindStop(sequence, seq.stop); ok {
+		slog.Debug("hit stop token", "pending", seq.pendingResponses, "stop", stop)
+
+		var tokenTruncated bool
+		origLen := len(seq.pendingResponses)
+		seq.pendingResponses, tokenTruncated = common.TruncateStop(seq.pendingResponses, stop)
+		newLen := len(seq.pendingResponses)
+		if len(seq.pendingLogprobs) > newLen {
+			seq.pendingLogprobs = seq.pendingLogprobs[:newLen]
 		}
 
-		if common.IncompleteUnicode(sequence) {
-			continue
+		// Update the cache based on the tokens that will be returned:
+		// - We have 1 token more than is currently in the cache because
+		// the last one generated wasn't submitted to Decode
+		// - Remove any stop sequences that we stripped out
+		// - If truncateStop removed a portion of a token, drop that
+		// - As defense-in-depth, if truncatedToken didn't find a stop token
+		// remove the extra one that we added to the cache len
+		tokenLen := len(seq.cache.Inputs) + 1
+		tokenLen -= origLen - newLen
+		if tokenTruncated || origLen == newLen {
+			tokenLen--
 		}
+		seq.cache.Inputs = seq.cache.Inputs[:tokenLen]
+
+		s.removeSequence(seqIndex, llm.DoneReasonStop)
+		return false, nil
+	}
+
+	if common.ContainsStopSuffix(sequence, seq.stop) {
+		return true, nil
+	}
+
+	if common.IncompleteUnicode(sequence) {
+		return true, nil
+	}
+
+	if !flushPending(seq) {
+		s.removeSequence(seqIndex, llm.DoneReasonConnectionClosed)
+		return false, nil
+	}
 
-		if !flushPending(seq) {
-			s.removeSequence(i, llm.DoneReasonConnectionClosed)
+	return true, nil
+}
+
+// toLogprob converts sampler log probabilities for a generated piece to
+// their API form, decoding the alternative tokens
+func (s *Server) toLogprob(piece string, logprobs sample.Logprobs) (api.Logprob, error) {
+	lp := api.Logprob{
+		TokenLogprob: api.TokenLogprob{Token: piece, Logprob: float64(logprobs.Token.Logprob)},
+	}
+
+	for _, alt := range logprobs.Top {
+		token, err := s.model.(model.TextProcessor).Decode([]int32{alt.ID})
+		if err != nil {
+			return api.Logprob{}, err
 		}
+		lp.TopLogprobs = append(lp.TopLogprobs, api.TokenLogprob{Token: token, Logprob: float64(alt.Logprob)})
 	}
 
-	return nil
+	return lp, nil
+}
+
+// recentTokens returns the text tokens at the end of the sequence's cache,
+// limited to the window its sampler penalties need
+func (seq *Sequence) recentTokens() []int32 {
+	n := seq.sampler.HistoryLen()
+	if n == 0 {
+		return nil
+	}
+
+	inputs := seq.cache.Inputs
+	if n > 0 && n < len(inputs) {
+		inputs = inputs[len(inputs)-n:]
+	}
+
+	seq.history = seq.history[:0]
+	for _, inp := range inputs {
+		if inp.Multimodal == nil {
+			seq.history = append(seq.history, inp.Token)
+		}
+	}
+
+	return seq.history
+}
+
+// penalties converts request options to sampler penalties, resolving the DRY
+// sequence breakers to single-token ids in the model's vocabulary
+func (s *Server) penalties(opts *api.Options) sample.Penalties {
+	p := sample.Penalties{
+		RepeatLastN:      opts.RepeatLastN,
+		RepeatPenalty:    opts.RepeatPenalty,
+		FrequencyPenalty: opts.FrequencyPenalty,
+		PresencePenalty:  opts.PresencePenalty,
+		DRYMultiplier:    opts.DRYMultiplier,
+		DRYBase:          opts.DRYBase,
+		DRYAllowedLength: opts.DRYAllowedLength,
+		DRYPenaltyLastN:  opts.DRYPenaltyLastN,
+	}
+
+	if p.DRYMultiplier > 0 {
+		tp := s.model.(model.TextProcessor)
+		for _, breaker := range sample.DefaultDRYSequenceBreakers {
+			ids, err := tp.Encode(breaker, false)
+			if err == nil && len(ids) == 1 {
+				p.DRYSequenceBreakers = append(p.DRYSequenceBreakers, ids[0])
+			}
+		}
+	}
+
+	return p
 }
 
 func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
@@ -626,6 +796,7 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		req.Options.MinP,
 		req.Options.Seed,
 		grammar,
+		s.penalties(req.Options),
 	)
 
 	seq, err := s.NewSequence(req.Prompt, req.Images, NewSequenceParams{
@@ -634,6 +805,10 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		numKeep:    int32(req.Options.NumKeep),
 		sampler:    sampler,
 		embedding:  false,
+
+		logprobs:    req.Logprobs,
+		topLogprobs: min(req.TopLogprobs, api.MaxTopLogprobs),
+		numDraft:    req.Options.NumDraft,
 	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create new sequence: %v", err), http.StatusInternalServerError)
@@ -681,11 +856,9 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 		case <-r.Context().Done():
 			close(seq.quit)
 			return
-		case content, ok := <-seq.responses:
+		case resp, ok := <-seq.responses:
 			if ok {
-				if err := json.NewEncoder(w).Encode(&llm.CompletionResponse{
-					Content: content,
-				}); err != nil {
+				if err := json.NewEncoder(w).Encode(&resp); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
 					close(seq.quit)
 					return
@@ -700,6 +873,9 @@ func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 					PromptEvalDuration: seq.startGenerationTime.Sub(seq.startProcessingTime),
 					EvalCount:          seq.numPredicted,
 					EvalDuration:       time.Since(seq.startGenerationTime),
+					CacheCount:         seq.numCached,
+					DraftCount:         seq.numDrafted,
+					DraftAcceptedCount: seq.numDraftAccepted,
 				}); err != nil {
 					http.Error(w, fmt.Sprintf("failed to encode final response: %v", err), http.StatusInternalServerError)
 				}
@@ -830,7 +1006,9 @@ func (s *Server) reserveWorstCaseGraph() error {
 
 func (s *Server) initModel(
 	mpath string,
+	dpath string,
 	params ml.BackendParams,
+	draftParams ml.BackendParams,
 	lpath multiLPath,
 	parallel int,
 	kvCacheType string,
@@ -848,6 +1026,12 @@ func (s *Server) initModel(
 		return errors.New("loras are not yet implemented")
 	}
 
+	if s.imatrixRunner {
+		if err := s.collectImportance(); err != nil {
+			return err
+		}
+	}
+
 	s.cache, err = NewInputCache(s.model, kvCacheType, int32(kvSize), parallel, s.batchSize, multiUserCache)
 	if err != nil {
 		return err
@@ -858,29 +1042,53 @@ func (s *Server) initModel(
 		slog.Warn("model does not support caching, disabling parallel processing")
 	}
 
+	if maxSize := envconfig.KvSnapshotSize(); maxSize > 0 && s.cache.enabled {
+		snapshots, err := newSnapshotStore(filepath.Join(envconfig.Models(), "kvcache"), filepath.Base(mpath), kvCacheType, s.cache.numCtx, int64(maxSize))
+		if err != nil {
+			slog.Warn("unable to use kv cache snapshots", "error", err)
+		} else {
+			s.cache.snapshots = snapshots
+		}
+	}
+
 	s.parallel = parallel
 	s.seqs = make([]*Sequence, s.parallel)
 	s.seqsSem = semaphore.NewWeighted(int64(s.parallel))
 
+	if dpath != "" {
+		// Speculative decoding is an optimization, so run without it rather
+		// than fail when the draft model can't be used
+		s.draft, err = newDraftModel(dpath, draftParams, s.model, kvCacheType, kvSize, s.parallel, s.batchSize)
+		if err != nil {
+			slog.Warn("unable to use draft model, disabling speculative decoding", "draft", dpath, "error", err)
+			s.draft = nil
+		}
+	}
+
 	return s.reserveWorstCaseGraph()
 }
 
 func (s *Server) load(
 	ctx context.Context,
 	mpath string,
+	dpath string,
 	params ml.BackendParams,
+	draftParams ml.BackendParams,
 	lpath multiLPath,
 	parallel int,
 	kvCacheType string,
 	kvSize int,
 	multiUserCache bool,
 ) {
-	err := s.initModel(mpath, params, lpath, parallel, kvCacheType, kvSize, multiUserCache)
+	err := s.initModel(mpath, dpath, params, draftParams, lpath, parallel, kvCacheType, kvSize, multiUserCache)
 	if err != nil {
 		var noMem ml.ErrNoMem
 		if errors.As(err, &noMem) {
 			// We can't yet handle this but in the future we will
 			s.cache.Close()
+			if s.draft != nil {
+				s.draft.Close()
+			}
 			if s.model != nil {
 				s.model.Backend().Close()
 			}
@@ -899,6 +1107,15 @@ func (s *Server) load(
 		panic(err)
 	}
 
+	if s.draft != nil {
+		if err := s.draft.load(ctx); err != nil {
+			// as when initializing it, the main model doesn't need the draft
+			slog.Warn("unable to load draft model, disabling speculative decoding", "draft", dpath, "error", err)
+			s.draft.Close()
+			s.draft = nil
+		}
+	}
+
 	s.status = llm.ServerStatusReady
 	s.ready.Done()
 }
@@ -906,9 +1123,11 @@ func (s *Server) load(
 func Execute(args []string) error {
 	fs := flag.NewFlagSet("runner", flag.ExitOnError)
 	mpath := fs.String("model", "", "Path to model binary file")
+	dpath := fs.String("draft-model", "", "Path to draft model binary file for speculative decoding")
 	parallel := fs.Int("parallel", 1, "Number of sequences to handle simultaneously")
 	batchSize := fs.Int("batch-size", 512, "Batch size")
 	numGPULayers := fs.Int("n-gpu-layers", 0, "Number of layers to offload to GPU")
+	draftGPULayers := fs.Int("draft-n-gpu-layers", 0, "Number of draft model layers to offload to GPU")
 	mainGPU := fs.Int("main-gpu", 0, "Main GPU")
 	flashAttention := fs.Bool("flash-attn", false, "Enable flash attention")
 	kvSize := fs.Int("ctx-size", 2048, "Context (or KV cache) size")
@@ -918,7 +1137,9 @@ func Execute(args []string) error {
 	_ = fs.Bool("verbose", false, "verbose output (default: disabled)")
 	_ = fs.Bool("no-mmap", false, "do not memory-map model (slower load but may reduce pageouts if not using mlock)")
 	tensorSplit := fs.String("tensor-split", "", "fraction of the model to offload to each GPU, comma-separated list of proportions")
+	draftTensorSplit := fs.String("draft-tensor-split", "", "fraction of the draft model to offload to each GPU, comma-separated list of proportions")
 	multiUserCache := fs.Bool("multiuser-cache", false, "optimize input cache algorithm for multiple users")
+	imatrixRunner := fs.Bool("imatrix", false, "compute importance matrices rather than serve completions")
 
 	var lpaths multiLPath
 	fs.Var(&lpaths, "lora", "Path to lora layer file (can be specified multiple times)")
@@ -934,8 +1155,9 @@ func Execute(args []string) error {
 	slog.Info("starting ollama engine")
 
 	server := &Server{
-		batchSize: *batchSize,
-		status:    llm.ServerStatusLoadingModel,
+		batchSize:     *batchSize,
+		imatrixRunner: *imatrixRunner,
+		status:        llm.ServerStatusLoadingModel,
 	}
 
 	server.cond = sync.NewCond(&server.mu)
@@ -947,25 +1169,38 @@ func Execute(args []string) error {
 	// TODO(jessegross): Parameters that need to be implemented:
 	//	no-mmap
 
-	var tensorSplitFloats []float32
-	if *tensorSplit != "" {
-		splits := strings.Split(*tensorSplit, ",")
-		tensorSplitFloats = make([]float32, len(splits))
+	parseSplit := func(s string) []float32 {
+		if s == "" {
+			return nil
+		}
+
+		splits := strings.Split(s, ",")
+		floats := make([]float32, len(splits))
 		for i, s := range splits {
 			f, _ := strconv.ParseFloat(s, 32)
-			tensorSplitFloats[i] = float32(f)
+			floats[i] = float32(f)
 		}
+		return floats
 	}
 
 	params := ml.BackendParams{
 		NumThreads:     *threads,
 		NumGPULayers:   *numGPULayers,
 		MainGPU:        *mainGPU,
-		TensorSplit:    tensorSplitFloats,
+		TensorSplit:    parseSplit(*tensorSplit),
 		FlashAttention: *flashAttention,
 	}
 
-	go server.load(ctx, *mpath, params, lpaths, *parallel, *kvCacheType, *kvSize, *multiUserCache)
+	// The draft model is sized and placed separately by the scheduler
+	draftParams := ml.BackendParams{
+		NumThreads:     *threads,
+		NumGPULayers:   *draftGPULayers,
+		MainGPU:        *mainGPU,
+		TensorSplit:    parseSplit(*draftTensorSplit),
+		FlashAttention: *flashAttention,
+	}
+
+	go server.load(ctx, *mpath, *dpath, params, draftParams, lpaths, *parallel, *kvCacheType, *kvSize, *multiUserCache)
 	go server.run(ctx)
 
 	addr := "127.0.0.1:" + strconv.Itoa(*port)
@@ -981,8 +1216,12 @@ func Execute(args []string) error {
 	mux.HandleFunc("POST /embedding", func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "this model does not support embeddings", http.StatusNotImplemented)
 	})
+	mux.HandleFunc("POST /embeddings", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "this model does not support embeddings", http.StatusNotImplemented)
+	})
 
 	mux.HandleFunc("POST /completion", server.completion)
+	mux.HandleFunc("POST /imatrix", server.imatrix)
 	mux.HandleFunc("GET /health", server.health)
 
 	httpServer := http.Server{
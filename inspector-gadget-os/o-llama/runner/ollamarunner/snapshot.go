@@ -0,0 +1,335 @@
+package ollamarunner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/model/input"
+)
+
+// minSnapshotInputs is the shortest prefix that is saved to disk. Shorter
+// prompts are quick enough to process that reading them back isn't worth it.
+const minSnapshotInputs = 512
+
+// snapshotHeader is written before the cache data so that the store can be
+// indexed without reading whole snapshots
+type snapshotHeader struct {
+	Model  string
+	DType  string
+	Inputs []int32
+}
+
+// snapshotStore keeps snapshots of cache slots in a directory shared by all
+// runners, named by the digest of the model, cache type and inputs that they
+// hold. When the directory grows beyond maxSize, the least recently used
+// snapshots are removed.
+type snapshotStore struct {
+	dir     string
+	model   string
+	dtype   string
+	numCtx  int32
+	maxSize int64
+
+	mu sync.Mutex
+
+	// entries maps the digests of the snapshots of this model to their inputs
+	entries map[string][]int32
+
+	// writing is set while a snapshot is being written in the background. New
+	// snapshots are skipped rather than queued to bound the memory used.
+	writing bool
+	wg      sync.WaitGroup
+}
+
+func newSnapshotStore(dir, model, dtype string, numCtx int32, maxSize int64) (*snapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &snapshotStore{
+		dir:     dir,
+		model:   model,
+		dtype:   dtype,
+		numCtx:  numCtx,
+		maxSize: maxSize,
+		entries: make(map[string][]int32),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(dir, name)
+
+		if strings.HasPrefix(name, "partial-") {
+			// Left behind by a runner that exited mid-write, unless another
+			// runner is writing it now
+			if info, err := file.Info(); err == nil && time.Since(info.ModTime()) > time.Hour {
+				os.Remove(path)
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(name, "sha256-") {
+			continue
+		}
+
+		header, err := readSnapshotHeader(path)
+		if err != nil {
+			slog.Warn("removing unreadable kv cache snapshot", "path", path, "error", err)
+			os.Remove(path)
+			continue
+		}
+
+		if header.Model == model && header.DType == dtype {
+			s.entries[name] = header.Inputs
+		}
+	}
+
+	slog.Debug("kv cache snapshots", "dir", dir, "model", model, "count", len(s.entries))
+	return s, nil
+}
+
+func readSnapshotHeader(path string) (*snapshotHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header snapshotHeader
+	if err := gob.NewDecoder(f).Decode(&header); err != nil {
+		return nil, err
+	}
+
+	return &header, nil
+}
+
+func (s *snapshotStore) digest(inputs []int32) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", s.model, s.dtype)
+	binary.Write(h, binary.LittleEndian, inputs)
+	return fmt.Sprintf("sha256-%x", h.Sum(nil))
+}
+
+// find returns the snapshot sharing the longest prefix with a prompt and the
+// length of that prefix
+func (s *snapshotStore) find(prompt []input.Input) (string, int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var digest string
+	var longest int32
+	for d, inputs := range s.entries {
+		if int32(len(inputs)) > s.numCtx {
+			continue
+		}
+
+		var count int32
+		for i, token := range inputs {
+			if i >= len(prompt) || prompt[i].Token != token || prompt[i].MultimodalHash != 0 {
+				break
+			}
+			count++
+		}
+
+		if count > longest {
+			digest, longest = d, count
+		}
+	}
+
+	return digest, longest
+}
+
+// load reads a snapshot and marks it as recently used
+func (s *snapshotStore) load(digest string) (*kvcache.Snapshot, error) {
+	path := filepath.Join(s.dir, digest)
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Evicted by another runner
+		s.mu.Lock()
+		delete(s.entries, digest)
+		s.mu.Unlock()
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header snapshotHeader
+	var snapshot kvcache.Snapshot
+	d := gob.NewDecoder(f)
+	if err := d.Decode(&header); err != nil {
+		return nil, err
+	}
+	if err := d.Decode(&snapshot); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		slog.Debug("unable to update kv cache snapshot time", "path", path, "error", err)
+	}
+
+	return &snapshot, nil
+}
+
+// wants reports whether a snapshot of inputs should be taken. It is false
+// if the snapshot already exists, in which case it is marked as recently
+// used, or if another snapshot is still being written.
+func (s *snapshotStore) wants(inputs []int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writing {
+		return false
+	}
+
+	digest := s.digest(inputs)
+	if _, ok := s.entries[digest]; ok {
+		now := time.Now()
+		os.Chtimes(filepath.Join(s.dir, digest), now, now)
+		return false
+	}
+
+	return true
+}
+
+// save writes a snapshot of inputs in the background. Snapshots of this
+// model that are a prefix of inputs are removed, since restoring the new
+// snapshot covers them.
+func (s *snapshotStore) save(inputs []int32, snapshot *kvcache.Snapshot) {
+	if int64(snapshot.Size()) > s.maxSize {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writing {
+		return
+	}
+
+	digest := s.digest(inputs)
+
+	s.writing = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		err := s.write(digest, &snapshotHeader{Model: s.model, DType: s.dtype, Inputs: inputs}, snapshot)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.writing = false
+		if err != nil {
+			slog.Warn("unable to save kv cache snapshot", "error", err)
+			return
+		}
+
+		for d, prefix := range s.entries {
+			if len(prefix) < len(inputs) && slices.Equal(prefix, inputs[:len(prefix)]) {
+				os.Remove(filepath.Join(s.dir, d))
+				delete(s.entries, d)
+			}
+		}
+
+		s.entries[digest] = inputs
+		slog.Debug("saved kv cache snapshot", "digest", digest, "inputs", len(inputs), "size", snapshot.Size())
+
+		if err := s.evict(); err != nil {
+			slog.Warn("unable to evict kv cache snapshots", "error", err)
+		}
+	}()
+}
+
+func (s *snapshotStore) write(digest string, header *snapshotHeader, snapshot *kvcache.Snapshot) error {
+	f, err := os.CreateTemp(s.dir, "partial-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	e := gob.NewEncoder(f)
+	if err := e.Encode(header); err != nil {
+		f.Close()
+		return err
+	}
+	if err := e.Encode(snapshot); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(s.dir, digest))
+}
+
+// evict removes the least recently used snapshots, of any model, until the
+// directory is within maxSize. The lock must already be held.
+func (s *snapshotStore) evict() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var infos []fs.FileInfo
+	var size int64
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "sha256-") {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		infos = append(infos, info)
+		size += info.Size()
+	}
+
+	slices.SortFunc(infos, func(a, b fs.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+
+	for _, info := range infos {
+		if size <= s.maxSize {
+			break
+		}
+
+		if err := os.Remove(filepath.Join(s.dir, info.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		slog.Debug("evicted kv cache snapshot", "digest", info.Name(), "size", info.Size())
+		delete(s.entries, info.Name())
+		size -= info.Size()
+	}
+
+	return nil
+}
+
+// wait blocks until snapshots being written in the background are done
+func (s *snapshotStore) wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,156 @@
+package ollamarunner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/kvcache"
+	"github.com/ollama/ollama/ml"
+	"github.com/ollama/ollama/model/input"
+)
+
+func testSnapshot(n int) *kvcache.Snapshot {
+	snapshot := &kvcache.Snapshot{DType: ml.DTypeF16}
+	for i := range n {
+		snapshot.Positions = append(snapshot.Positions, int32(i))
+	}
+
+	snapshot.Layers = []kvcache.LayerSnapshot{{
+		KHeadDim:   1,
+		VHeadDim:   1,
+		NumKVHeads: 1,
+		Keys:       make([]byte, 2*n),
+		Values:     make([]byte, 2*n),
+	}}
+
+	return snapshot
+}
+
+func testPrompt(tokens ...int32) []input.Input {
+	prompt := make([]input.Input, len(tokens))
+	for i, token := range tokens {
+		prompt[i].Token = token
+	}
+	return prompt
+}
+
+func TestSnapshotStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := newSnapshotStore(dir, "sha256-model", "f16", 16, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := testSnapshot(3)
+	s.save([]int32{1, 2, 3}, saved)
+	s.wait()
+
+	if s.wants([]int32{1, 2, 3}) {
+		t.Error("wants a snapshot that already exists")
+	}
+
+	// A new runner for the same model finds the snapshot on disk, another
+	// model or cache type does not
+	s, err = newSnapshotStore(dir, "sha256-model", "f16", 16, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, other := range [][2]string{{"sha256-other", "f16"}, {"sha256-model", "q8_0"}} {
+		o, err := newSnapshotStore(dir, other[0], other[1], 16, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, count := o.find(testPrompt(1, 2, 3)); count != 0 {
+			t.Errorf("%v: found snapshot of another model", other)
+		}
+	}
+
+	digest, count := s.find(testPrompt(1, 2, 4))
+	if count != 2 {
+		t.Fatalf("find: have %v; want 2", count)
+	}
+
+	loaded, err := s.load(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("load: have %+v; want %+v", loaded, saved)
+	}
+
+	// Snapshots too long for the context are ignored
+	small, err := newSnapshotStore(dir, "sha256-model", "f16", 2, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, count := small.find(testPrompt(1, 2, 3)); count != 0 {
+		t.Errorf("find with small context: have %v; want 0", count)
+	}
+
+	// Extending a snapshot replaces it
+	s.save([]int32{1, 2, 3, 4}, testSnapshot(4))
+	s.wait()
+
+	if _, err := os.Stat(filepath.Join(dir, digest)); !os.IsNotExist(err) {
+		t.Errorf("prefix snapshot was not removed: %v", err)
+	}
+
+	if _, count := s.find(testPrompt(1, 2, 3, 4, 5)); count != 4 {
+		t.Errorf("find extended: have %v; want 4", count)
+	}
+}
+
+func TestSnapshotStoreEvict(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := newSnapshotStore(dir, "sha256-model", "f16", 16, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.save([]int32{1}, testSnapshot(1))
+	s.wait()
+	s.save([]int32{2}, testSnapshot(1))
+	s.wait()
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("have %v snapshots; want 2", len(files))
+	}
+
+	info, err := files[0].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make {2} the least recently used, then leave room for two snapshots
+	digest, _ := s.find(testPrompt(1))
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, s.digest([]int32{2})), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	s.maxSize = 2*info.Size() + info.Size()/2
+	s.save([]int32{3}, testSnapshot(1))
+	s.wait()
+
+	if _, err := os.Stat(filepath.Join(dir, digest)); err != nil {
+		t.Errorf("recently used snapshot was evicted: %v", err)
+	}
+
+	if _, count := s.find(testPrompt(2)); count != 0 {
+		t.Error("least recently used snapshot was not evicted")
+	}
+}
@@ -0,0 +1,78 @@
+package sample
+
+import (
+	"container/heap"
+	"math"
+	"slices"
+)
+
+// TokenLogprob is the log probability of a single token id
+type TokenLogprob struct {
+	ID      int32
+	Logprob float32
+}
+
+// Logprobs reports the log probability of a sampled token and of the most
+// likely tokens at the same position, most likely first
+type Logprobs struct {
+	Token TokenLogprob
+	Top   []TokenLogprob
+}
+
+// logprobs computes the log-softmax of tokens, which must be indexed by token
+// id, for the token id and the topN most likely tokens. Tokens masked to -inf
+// are never reported as alternatives.
+func logprobs(tokens []token, id int32, topN int) Logprobs {
+	maxLogit := math.Inf(-1)
+	for _, t := range tokens {
+		maxLogit = max(maxLogit, float64(t.value))
+	}
+
+	var sum float64
+	for _, t := range tokens {
+		sum += math.Exp(float64(t.value) - maxLogit)
+	}
+	logSum := maxLogit + math.Log(sum)
+
+	logprob := func(t token) TokenLogprob {
+		return TokenLogprob{ID: t.id, Logprob: float32(float64(t.value) - logSum)}
+	}
+
+	var lp Logprobs
+	if id >= 0 && int(id) < len(tokens) {
+		lp.Token = logprob(tokens[id])
+	}
+
+	if topN <= 0 {
+		return lp
+	}
+
+	h := make(tokenHeap, 0, topN)
+	for _, t := range tokens {
+		if math.IsInf(float64(t.value), -1) {
+			continue
+		}
+		if h.Len() < topN {
+			heap.Push(&h, t)
+		} else if t.value > h[0].value {
+			h[0] = t
+			heap.Fix(&h, 0)
+		}
+	}
+
+	lp.Top = make([]TokenLogprob, h.Len())
+	for i, t := range h {
+		lp.Top[i] = logprob(t)
+	}
+	slices.SortStableFunc(lp.Top, func(a, b TokenLogprob) int {
+		switch {
+		case a.Logprob > b.Logprob:
+			return -1
+		case a.Logprob < b.Logprob:
+			return 1
+		}
+		return int(a.ID - b.ID)
+	})
+
+	return lp
+}
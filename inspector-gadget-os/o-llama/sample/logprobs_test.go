@@ -0,0 +1,81 @@
+package sample
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSampleWithLogprobs(t *testing.T) {
+	logits := []float32{1, 3, 2, float32(math.Inf(-1))}
+
+	// Log probabilities do not depend on temperature or truncation
+	for _, sampler := range []Sampler{
+		NewSampler(0, 0, 0, 0, 0, nil, Penalties{}),
+		NewSampler(0.1, 1, 0.5, 0, 0, nil, Penalties{}),
+	} {
+		id, lp, err := sampler.SampleWithLogprobs(logits, nil, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 1 {
+			t.Fatalf("sampled %d, want 1", id)
+		}
+
+		logSum := math.Log(math.Exp(1) + math.Exp(3) + math.Exp(2))
+		if lp.Token.ID != 1 || math.Abs(float64(lp.Token.Logprob)-(3-logSum)) > 1e-5 {
+			t.Errorf("token logprob = %+v, want id 1 logprob %f", lp.Token, 3-logSum)
+		}
+
+		// the masked token is never an alternative
+		want := []int32{1, 2, 0}
+		if len(lp.Top) != len(want) {
+			t.Fatalf("got %d alternatives, want %d", len(lp.Top), len(want))
+		}
+		var total float64
+		for i, alt := range lp.Top {
+			if alt.ID != want[i] {
+				t.Errorf("alternative %d = %d, want %d", i, alt.ID, want[i])
+			}
+			total += math.Exp(float64(alt.Logprob))
+		}
+		if math.Abs(total-1) > 1e-5 {
+			t.Errorf("probabilities sum to %f, want 1", total)
+		}
+	}
+}
+
+func TestSampleWithLogprobsPenalties(t *testing.T) {
+	logits := []float32{2, 2}
+
+	sampler := NewSampler(0, 0, 0, 0, 0, nil, Penalties{RepeatLastN: -1, PresencePenalty: 1})
+	id, lp, err := sampler.SampleWithLogprobs(logits, []int32{0}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Fatalf("sampled %d, want 1", id)
+	}
+
+	// The penalized distribution is reported, not the raw logits
+	want := -math.Log(1 + math.Exp(-1))
+	if math.Abs(float64(lp.Token.Logprob)-want) > 1e-5 {
+		t.Errorf("logprob = %f, want %f", lp.Token.Logprob, want)
+	}
+	if len(lp.Top) != 1 || lp.Top[0].ID != 1 {
+		t.Errorf("top = %+v, want only token 1", lp.Top)
+	}
+}
+
+func BenchmarkSampleWithLogprobs(b *testing.B) {
+	logits := make([]float32, 1<<16)
+	for i := range logits {
+		logits[i] = float32(i%97) / 10
+	}
+
+	sampler := NewSampler(0.8, 40, 0.9, 0.05, -1, nil, Penalties{})
+	for b.Loop() {
+		if _, _, err := sampler.SampleWithLogprobs(logits, nil, 5); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -16,6 +16,28 @@ type token struct {
 	value float32 // The raw logit or probability from the model
 }
 
+// DefaultDRYSequenceBreakers are the strings that end a DRY match, matching
+// llama.cpp's defaults
+var DefaultDRYSequenceBreakers = []string{"\n", ":", "\"", "*"}
+
+// Penalties configures logit penalties computed from previously seen tokens
+type Penalties struct {
+	// RepeatLastN is the number of recent tokens considered by the repeat,
+	// frequency and presence penalties; 0 disables them and -1 uses all history
+	RepeatLastN      int
+	RepeatPenalty    float32
+	FrequencyPenalty float32
+	PresencePenalty  float32
+
+	// DRYMultiplier enables the DRY sequence penalty when greater than 0.
+	// DRYPenaltyLastN follows the same convention as RepeatLastN.
+	DRYMultiplier       float32
+	DRYBase             float32
+	DRYAllowedLength    int
+	DRYPenaltyLastN     int
+	DRYSequenceBreakers []int32
+}
+
 type Sampler struct {
 	rng         *rand.Rand
 	topK        int
@@ -23,17 +45,43 @@ type Sampler struct {
 	minP        float32
 	temperature float32
 	grammar     *GrammarSampler
+	penalties   Penalties
+	breakers    map[int32]struct{}
+
+	// snapshot holds the transformed logits for computing log probabilities
+	snapshot []token
+}
+
+// Sample selects the next token from logits. history holds the tokens already
+// in the sequence, oldest first, and is used by the repetition penalties.
+func (s *Sampler) Sample(logits []float32, history []int32) (int32, error) {
+	return s.next(logits, history, false)
+}
+
+// SampleWithLogprobs is like Sample but also returns the log probability of
+// the selected token and of the topN most likely tokens. Log probabilities
+// are taken over the logits after penalties and any grammar constraint, but
+// before temperature and truncation, so they do not depend on those settings.
+func (s *Sampler) SampleWithLogprobs(logits []float32, history []int32, topN int) (int32, Logprobs, error) {
+	id, err := s.next(logits, history, true)
+	if err != nil {
+		return -1, Logprobs{}, err
+	}
+
+	return id, logprobs(s.snapshot, id, topN), nil
 }
 
-func (s *Sampler) Sample(logits []float32) (int32, error) {
+// next selects the next token, keeping a copy of the transformed logits in
+// s.snapshot when snapshot is set
+func (s *Sampler) next(logits []float32, history []int32, snapshot bool) (int32, error) {
 	if len(logits) == 0 {
 		return -1, errors.New("sample: no logits provided to sample")
 	}
 
 	tokens := make([]token, len(logits))
-	for i := range logits {
-		tokens[i].id = int32(i)
-		tokens[i].value = logits[i]
+	s.reset(tokens, logits, history)
+	if snapshot {
+		s.snapshot = append(s.snapshot[:0], tokens...)
 	}
 
 	t, err := s.sample(tokens)
@@ -47,6 +95,10 @@ func (s *Sampler) Sample(logits []float32) (int32, error) {
 		top := []token{t}
 		s.grammar.Apply(top)
 		if !math.IsInf(float64(top[0].value), -1) {
+			if snapshot {
+				// report log probabilities under the grammar constraint
+				s.grammar.Apply(s.snapshot)
+			}
 			s.grammar.Accept(top[0].id)
 			return top[0].id, nil
 		}
@@ -54,11 +106,11 @@ func (s *Sampler) Sample(logits []float32) (int32, error) {
 		// since .sample has side effects of modifying the tokens
 		// we need to reset them before applying the grammar and
 		// sampling again
-		for i := range logits {
-			tokens[i].id = int32(i)
-			tokens[i].value = logits[i]
-		}
+		s.reset(tokens, logits, history)
 		s.grammar.Apply(tokens)
+		if snapshot {
+			s.snapshot = append(s.snapshot[:0], tokens...)
+		}
 		t, err = s.sample(tokens)
 		if err != nil {
 			return -1, err
@@ -69,6 +121,56 @@ func (s *Sampler) Sample(logits []float32) (int32, error) {
 	return t.id, nil
 }
 
+// HistoryLen returns how many trailing history tokens the penalties use: 0
+// when they are disabled and -1 when they need the whole history
+func (s *Sampler) HistoryLen() int {
+	p := s.penalties
+
+	n := 0
+	if p.RepeatPenalty != 1 || p.FrequencyPenalty != 0 || p.PresencePenalty != 0 {
+		n = p.RepeatLastN
+	}
+
+	if p.DRYMultiplier > 0 {
+		if p.DRYPenaltyLastN < 0 || n < 0 {
+			return -1
+		}
+		n = max(n, p.DRYPenaltyLastN)
+	}
+
+	return n
+}
+
+// reset fills tokens from logits and applies the history penalties
+func (s *Sampler) reset(tokens []token, logits []float32, history []int32) {
+	for i := range logits {
+		tokens[i].id = int32(i)
+		tokens[i].value = logits[i]
+	}
+
+	p := s.penalties
+	if window := lastN(history, p.RepeatLastN); len(window) > 0 &&
+		(p.RepeatPenalty != 1 || p.FrequencyPenalty != 0 || p.PresencePenalty != 0) {
+		repeatPenalties(tokens, window, p.RepeatPenalty, p.FrequencyPenalty, p.PresencePenalty)
+	}
+
+	if p.DRYMultiplier > 0 {
+		dry(tokens, lastN(history, p.DRYPenaltyLastN), p.DRYMultiplier, p.DRYBase, p.DRYAllowedLength, s.breakers)
+	}
+}
+
+// lastN returns the trailing n tokens of history; -1 returns all of it
+func lastN(history []int32, n int) []int32 {
+	switch {
+	case n < 0 || n >= len(history):
+		return history
+	case n == 0:
+		return nil
+	default:
+		return history[len(history)-n:]
+	}
+}
+
 // greedy returns the highest probability token from the tokens
 func greedy(tokens []token) token {
 	max := tokens[0]
@@ -127,7 +229,7 @@ func (s *Sampler) sample(tokens []token) (token, error) {
 }
 
 // TODO(parthsareen): update sampler interface to use json unmarshal https://github.com/ollama/ollama/issues/9278
-func NewSampler(temperature float32, topK int, topP float32, minP float32, seed int, grammar *GrammarSampler) Sampler {
+func NewSampler(temperature float32, topK int, topP float32, minP float32, seed int, grammar *GrammarSampler, penalties Penalties) Sampler {
 	var rng *rand.Rand
 	if seed != -1 {
 		// PCG requires two parameters: sequence and stream
@@ -154,6 +256,26 @@ func NewSampler(temperature float32, topK int, topP float32, minP float32, seed
 		minP = 1.0
 	}
 
+	// A non-positive repeat penalty would flip or zero logits; treat as disabled
+	if penalties.RepeatPenalty <= 0 {
+		penalties.RepeatPenalty = 1.0
+	}
+
+	if penalties.DRYMultiplier < 0 {
+		penalties.DRYMultiplier = 0
+	}
+	if penalties.DRYBase < 1.0 {
+		penalties.DRYBase = 1.0
+	}
+	if penalties.DRYAllowedLength < 1 {
+		penalties.DRYAllowedLength = 1
+	}
+
+	breakers := make(map[int32]struct{}, len(penalties.DRYSequenceBreakers))
+	for _, id := range penalties.DRYSequenceBreakers {
+		breakers[id] = struct{}{}
+	}
+
 	return Sampler{
 		rng:         rng,
 		topK:        topK,
@@ -161,6 +283,8 @@ func NewSampler(temperature float32, topK int, topP float32, minP float32, seed
 		minP:        minP,
 		temperature: temperature,
 		grammar:     grammar,
+		penalties:   penalties,
+		breakers:    breakers,
 	}
 }
 
@@ -16,10 +16,10 @@ func BenchmarkWeightedSampler(b *testing.B) {
 				logits[i] = float32(rand.Float64()*10 - 5)
 			}
 
-			sampler := NewSampler(0.8, 0, 0, 0, 42, nil)
+			sampler := NewSampler(0.8, 0, 0, 0, 42, nil, Penalties{})
 			b.ResetTimer()
 			for b.Loop() {
-				sampler.Sample(logits)
+				sampler.Sample(logits, nil)
 			}
 		})
 	}
@@ -49,28 +49,62 @@ func BenchmarkWeightedSampler(b *testing.B) {
 
 	for _, tc := range configs {
 		b.Run("Config"+tc.name, func(b *testing.B) {
-			sampler := NewSampler(tc.temperature, tc.topK, tc.topP, tc.minP, tc.seed, nil)
-			sampler.Sample(logits)
+			sampler := NewSampler(tc.temperature, tc.topK, tc.topP, tc.minP, tc.seed, nil, Penalties{})
+			sampler.Sample(logits, nil)
 
 			b.ResetTimer()
 
 			for b.Loop() {
-				sampler.Sample(logits)
+				sampler.Sample(logits, nil)
 			}
 		})
 	}
 
 	// Test with combined transforms separately - topK influences performance greatly
 	b.Run("TransformCombined", func(b *testing.B) {
-		sampler := NewSampler(0.8, 50, 0.9, 0.05, 42, nil)
+		sampler := NewSampler(0.8, 50, 0.9, 0.05, 42, nil, Penalties{})
 		b.ResetTimer()
 
 		for b.Loop() {
-			sampler.Sample(logits)
+			sampler.Sample(logits, nil)
 		}
 	})
 }
 
+func BenchmarkPenalties(b *testing.B) {
+	size := 128000
+	logits := make([]float32, size)
+	for i := range logits {
+		logits[i] = float32(rand.Float64()*10 - 5)
+	}
+
+	history := make([]int32, 4096)
+	for i := range history {
+		history[i] = int32(rand.Intn(size))
+	}
+
+	configs := []struct {
+		name      string
+		penalties Penalties
+	}{
+		{"None", Penalties{}},
+		{"Repeat", Penalties{RepeatLastN: 64, RepeatPenalty: 1.1}},
+		{"FrequencyPresence", Penalties{RepeatLastN: -1, RepeatPenalty: 1, FrequencyPenalty: 0.5, PresencePenalty: 0.5}},
+		{"DRY", Penalties{DRYMultiplier: 0.8, DRYBase: 1.75, DRYAllowedLength: 2, DRYPenaltyLastN: -1}},
+	}
+
+	for _, tc := range configs {
+		b.Run(tc.name, func(b *testing.B) {
+			sampler := NewSampler(0.8, 40, 0.9, 0, 42, nil, tc.penalties)
+			b.ResetTimer()
+
+			for b.Loop() {
+				sampler.Sample(logits, history)
+			}
+		})
+	}
+}
+
 func BenchmarkGreedySampler(b *testing.B) {
 	sizes := []int{10, 100, 1000, 10000, 100000}
 
@@ -81,11 +115,11 @@ func BenchmarkGreedySampler(b *testing.B) {
 				logits[i] = float32(rand.Float64()*10 - 5)
 			}
 
-			sampler := NewSampler(0, -1, 0, 0, -1, nil)
+			sampler := NewSampler(0, -1, 0, 0, -1, nil, Penalties{})
 			b.ResetTimer()
 
 			for b.Loop() {
-				sampler.Sample(logits)
+				sampler.Sample(logits, nil)
 			}
 		})
 	}
@@ -13,8 +13,8 @@ import (
 
 func TestWeighted(t *testing.T) {
 	logits := []float32{-10, 3, -10, -10}
-	sampler := NewSampler(0, 0, 0, 0, 0, nil)
-	got, err := sampler.Sample(logits)
+	sampler := NewSampler(0, 0, 0, 0, 0, nil, Penalties{})
+	got, err := sampler.Sample(logits, nil)
 	if err != nil {
 		t.Error(err)
 		return
@@ -25,8 +25,8 @@ func TestWeighted(t *testing.T) {
 	}
 
 	logits = []float32{-100, -10, 0, 10}
-	sampler = NewSampler(0, 0, 0, 0, 0, nil)
-	got, err = sampler.Sample(logits)
+	sampler = NewSampler(0, 0, 0, 0, 0, nil, Penalties{})
+	got, err = sampler.Sample(logits, nil)
 	if err != nil {
 		t.Error(err)
 		return
@@ -39,8 +39,8 @@ func TestWeighted(t *testing.T) {
 	// Test very high p
 	logits = []float32{1.0, 0.9999999999999999, 0.5, 0.1}
 	// Use extremely small topP to filter out all tokens
-	sampler = NewSampler(1.0, 0, 1e-10, 0, 0, nil)
-	got, err = sampler.Sample(logits)
+	sampler = NewSampler(1.0, 0, 1e-10, 0, 0, nil, Penalties{})
+	got, err = sampler.Sample(logits, nil)
 	if err != nil {
 		t.Error(err)
 		return
@@ -52,14 +52,55 @@ func TestWeighted(t *testing.T) {
 	}
 
 	logits = []float32{float32(math.NaN()), float32(math.NaN()), float32(math.NaN())}
-	sampler = NewSampler(1, 0, 0.95, 0.05, 0, nil)
-	got, err = sampler.Sample(logits)
+	sampler = NewSampler(1, 0, 0.95, 0.05, 0, nil, Penalties{})
+	got, err = sampler.Sample(logits, nil)
 	if err == nil {
 		t.Errorf("expected error, got %d", got)
 		return
 	}
 }
 
+func TestSamplePenalizesHistory(t *testing.T) {
+	logits := []float32{3, 2.9, 1}
+
+	sampler := NewSampler(0, 0, 0, 0, 0, nil, Penalties{})
+	got, err := sampler.Sample(logits, []int32{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 0 {
+		t.Errorf("without penalties: got %d, want 0", got)
+	}
+
+	sampler = NewSampler(0, 0, 0, 0, 0, nil, Penalties{RepeatLastN: 64, RepeatPenalty: 1.1})
+	got, err = sampler.Sample(logits, []int32{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1 {
+		t.Errorf("repeat penalty: got %d, want 1", got)
+	}
+
+	// tokens outside the window are not penalized
+	sampler = NewSampler(0, 0, 0, 0, 0, nil, Penalties{RepeatLastN: 1, RepeatPenalty: 1.1})
+	got, err = sampler.Sample(logits, []int32{0, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 0 {
+		t.Errorf("repeat window: got %d, want 0", got)
+	}
+
+	sampler = NewSampler(0, 0, 0, 0, 0, nil, Penalties{DRYMultiplier: 1, DRYBase: 2, DRYAllowedLength: 1, DRYPenaltyLastN: -1})
+	got, err = sampler.Sample(logits, []int32{1, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1 {
+		t.Errorf("dry: got %d, want 1", got)
+	}
+}
+
 func modelHelper(t testing.TB) model.BytePairEncoding {
 	t.Helper()
 
@@ -152,8 +193,8 @@ func TestGrammar(t *testing.T) {
 
 func BenchmarkSample(b *testing.B) {
 	samplers := map[string]Sampler{
-		"Greedy":   NewSampler(0, 0, 0, 0, 0, nil), // Use NewSampler with temp=0 for greedy
-		"Weighted": NewSampler(0.5, 10, 0.9, 0.2, -1, nil),
+		"Greedy":   NewSampler(0, 0, 0, 0, 0, nil, Penalties{}), // Use NewSampler with temp=0 for greedy
+		"Weighted": NewSampler(0.5, 10, 0.9, 0.2, -1, nil, Penalties{}),
 	}
 
 	// Generate random logits for benchmarking
@@ -166,7 +207,7 @@ func BenchmarkSample(b *testing.B) {
 		b.Run(name, func(b *testing.B) {
 			b.ResetTimer()
 			for b.Loop() {
-				if _, err := s.Sample(logits); err != nil {
+				if _, err := s.Sample(logits, nil); err != nil {
 					b.Fatalf("error sampling: %v", err)
 				}
 			}
@@ -128,3 +128,87 @@ func minP(ts []token, p float32) []token {
 	}
 	return ts
 }
+
+// repeatPenalties applies the classic repeat penalty together with OpenAI-style
+// frequency and presence penalties to tokens seen in history. ts must be
+// indexed by token id.
+func repeatPenalties(ts []token, history []int32, repeat, frequency, presence float32) {
+	if len(history) == 0 {
+		return
+	}
+
+	counts := make(map[int32]int, len(history))
+	for _, id := range history {
+		if id >= 0 && int(id) < len(ts) {
+			counts[id]++
+		}
+	}
+
+	for id, count := range counts {
+		v := ts[id].value
+
+		// Dividing a negative logit would make the token more likely
+		if v > 0 {
+			v /= repeat
+		} else {
+			v *= repeat
+		}
+
+		v -= float32(count)*frequency + presence
+		ts[id].value = v
+	}
+}
+
+// maxDRYMatch bounds how far back a repeated sequence is followed; the
+// exponential penalty saturates long before this
+const maxDRYMatch = 64
+
+// dry applies the "Don't Repeat Yourself" penalty: when the end of history
+// repeats an earlier sequence of at least allowedLength tokens, the token that
+// continued that earlier sequence is penalized by
+// multiplier * base^(length - allowedLength). Breaker tokens end matches. ts
+// must be indexed by token id.
+func dry(ts []token, history []int32, multiplier, base float32, allowedLength int, breakers map[int32]struct{}) {
+	n := len(history)
+	if n < 2 {
+		return
+	}
+
+	last := history[n-1]
+	if _, ok := breakers[last]; ok {
+		return
+	}
+
+	longest := make(map[int32]int)
+	for i := n - 2; i >= 0; i-- {
+		if history[i] != last {
+			continue
+		}
+
+		// Length of the common suffix of history[:i+1] and history
+		length := 1
+		for length < maxDRYMatch && i-length >= 0 {
+			prev := history[i-length]
+			if prev != history[n-1-length] {
+				break
+			}
+			if _, ok := breakers[prev]; ok {
+				break
+			}
+			length++
+		}
+
+		next := history[i+1]
+		if length > longest[next] {
+			longest[next] = length
+		}
+	}
+
+	for id, length := range longest {
+		if length < allowedLength || id < 0 || int(id) >= len(ts) {
+			continue
+		}
+		penalty := multiplier * float32(math.Pow(float64(base), float64(length-allowedLength)))
+		ts[id].value -= penalty
+	}
+}
@@ -295,6 +295,53 @@ func TestMinP(t *testing.T) {
 	}
 }
 
+func TestRepeatPenalties(t *testing.T) {
+	input := []float32{2.0, -2.0, 1.0, 4.0}
+	tokens := toTokens(input)
+	repeatPenalties(tokens, []int32{0, 1, 1}, 2.0, 0, 0)
+	// positive logits are divided, negative multiplied
+	want := []float32{1.0, -4.0, 1.0, 4.0}
+	compareLogits(t, "repeatPenalties(repeat)", want, tokens)
+
+	tokens = toTokens(input)
+	repeatPenalties(tokens, []int32{0, 1, 1}, 1.0, 0.5, 0.25)
+	want = []float32{2.0 - 0.5 - 0.25, -2.0 - 1.0 - 0.25, 1.0, 4.0}
+	compareLogits(t, "repeatPenalties(frequency, presence)", want, tokens)
+
+	// Out of range ids are ignored
+	tokens = toTokens(input)
+	repeatPenalties(tokens, []int32{-1, 9}, 2.0, 1, 1)
+	compareLogits(t, "repeatPenalties(out of range)", input, tokens)
+}
+
+func TestDRY(t *testing.T) {
+	input := []float32{1, 1, 1, 1, 1, 1}
+	none := map[int32]struct{}{}
+
+	// history ends with 1 2, which previously continued with 3
+	tokens := toTokens(input)
+	dry(tokens, []int32{1, 2, 3, 4, 1, 2}, 1.0, 2.0, 2, none)
+	want := []float32{1, 1, 1, 0, 1, 1}
+	compareLogits(t, "dry(length 2)", want, tokens)
+
+	// a longer repeat is penalized exponentially
+	tokens = toTokens(input)
+	dry(tokens, []int32{0, 1, 2, 3, 5, 0, 1, 2}, 1.0, 2.0, 2, none)
+	want = []float32{1, 1, 1, -1, 1, 1}
+	compareLogits(t, "dry(length 3)", want, tokens)
+
+	// matches shorter than the allowed length are not penalized
+	tokens = toTokens(input)
+	dry(tokens, []int32{2, 3, 4, 2}, 1.0, 2.0, 2, none)
+	compareLogits(t, "dry(short)", input, tokens)
+
+	// breakers stop the match from extending
+	tokens = toTokens(input)
+	dry(tokens, []int32{0, 1, 2, 3, 5, 0, 1, 2}, 1.0, 2.0, 2, map[int32]struct{}{0: {}})
+	want = []float32{1, 1, 1, 0, 1, 1}
+	compareLogits(t, "dry(breaker)", want, tokens)
+}
+
 func BenchmarkTransforms(b *testing.B) {
 	// Generate random logits
 	tokens := make([]token, 1<<16)
@@ -347,6 +394,27 @@ func BenchmarkTransforms(b *testing.B) {
 		}
 	})
 
+	history := make([]int32, 4096)
+	for i := range history {
+		history[i] = rand.Int32N(64)
+	}
+
+	b.Run("RepeatPenalties", func(b *testing.B) {
+		b.ResetTimer()
+		for b.Loop() {
+			copy(tokensCopy, tokens)
+			repeatPenalties(tokensCopy, history[len(history)-64:], 1.1, 0.1, 0.1)
+		}
+	})
+
+	b.Run("DRY", func(b *testing.B) {
+		b.ResetTimer()
+		for b.Loop() {
+			copy(tokensCopy, tokens)
+			dry(tokensCopy, history, 0.8, 1.75, 2, nil)
+		}
+	})
+
 	b.Run("SortTokens", func(b *testing.B) {
 		b.ResetTimer()
 		for b.Loop() {
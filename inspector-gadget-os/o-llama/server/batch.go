@@ -0,0 +1,1075 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/openai"
+)
+
+// batchEndpoints are the endpoints that the requests of a batch can be made to
+var batchEndpoints = []string{
+	"/api/generate",
+	"/api/chat",
+	"/api/embed",
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+	"/v1/responses",
+}
+
+const (
+	maxBatchRequests = 50_000
+	maxBatchFileSize = 200 * format.MegaByte
+	maxBatchLineSize = 64 * format.MegaByte
+)
+
+var (
+	errInvalidBatch  = errors.New("invalid batch")
+	errBatchNotFound = errors.New("batch not found")
+	errFileNotFound  = errors.New("file not found")
+	errBatchFinished = errors.New("batch has already finished")
+)
+
+var validBatchID = regexp.MustCompile(`^[a-z]+[-_][a-z0-9]+$`)
+
+// batchRecord is a batch as it is stored
+type batchRecord struct {
+	api.Batch
+
+	// User is who created the batch. Its requests are queued on their
+	// behalf.
+	User string `json:"user,omitempty"`
+}
+
+// batchQueue runs batches of requests in the background by passing each
+// request to the server's own handler at background priority. Batches and
+// their input and output files are kept in a directory so that unfinished
+// batches resume when the server restarts.
+type batchQueue struct {
+	dir     string
+	handler http.Handler
+
+	once sync.Once
+	err  error
+
+	mu      sync.Mutex
+	ctx     context.Context
+	batches map[string]*batchRecord
+	cancels map[string]context.CancelFunc
+}
+
+func newBatchQueue(dir string, handler http.Handler) *batchQueue {
+	return &batchQueue{
+		dir:     dir,
+		handler: handler,
+		ctx:     context.Background(),
+		batches: make(map[string]*batchRecord),
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+func (q *batchQueue) load() error {
+	q.once.Do(func() {
+		if q.err = os.MkdirAll(filepath.Join(q.dir, "files"), 0o755); q.err != nil {
+			return
+		}
+
+		matches, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+		if err != nil {
+			q.err = err
+			return
+		}
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		for _, match := range matches {
+			bts, err := os.ReadFile(match)
+			if err != nil {
+				q.err = err
+				return
+			}
+
+			var b batchRecord
+			if err := json.Unmarshal(bts, &b); err != nil {
+				slog.Warn("skipping corrupt batch", "path", match, "error", err)
+				continue
+			}
+
+			q.batches[b.ID] = &b
+		}
+	})
+
+	return q.err
+}
+
+// start resumes the batches that were running when the server stopped.
+// Batches stop when ctx is done.
+func (q *batchQueue) start(ctx context.Context) error {
+	if err := q.load(); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.ctx = ctx
+	for id, b := range q.batches {
+		switch b.Status {
+		case api.BatchValidating, api.BatchInProgress, api.BatchFinalizing:
+			slog.Info("resuming batch", "id", id, "completed", b.RequestCounts.Completed, "failed", b.RequestCounts.Failed, "total", b.RequestCounts.Total)
+			q.run(id)
+		case api.BatchCancelling:
+			b.Status = api.BatchCancelled
+			b.CancelledAt = time.Now()
+			if err := q.save(b); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func newBatchID(prefix string) string {
+	return prefix + strings.ToLower(rand.Text())
+}
+
+func (q *batchQueue) filePath(id string) string {
+	return filepath.Join(q.dir, "files", id+".jsonl")
+}
+
+// createFile stores a file for use by batches
+func (q *batchQueue) createFile(filename, purpose string, r io.Reader) (*openai.File, error) {
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	f := openai.File{
+		ID:        newBatchID("file-"),
+		Object:    "file",
+		CreatedAt: time.Now().Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}
+
+	w, err := os.Create(q.filePath(f.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	if f.Bytes, err = io.Copy(w, r); err != nil {
+		os.Remove(w.Name())
+		return nil, err
+	}
+
+	bts, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(q.dir, "files", f.ID+".json"), bts, 0o644); err != nil {
+		os.Remove(w.Name())
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+func (q *batchQueue) file(id string) (*openai.File, error) {
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	if !validBatchID.MatchString(id) {
+		return nil, errFileNotFound
+	}
+
+	bts, err := os.ReadFile(filepath.Join(q.dir, "files", id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errFileNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f openai.File
+	if err := json.Unmarshal(bts, &f); err != nil {
+		return nil, err
+	}
+
+	// output files grow as a batch runs
+	if fi, err := os.Stat(q.filePath(id)); err == nil {
+		f.Bytes = fi.Size()
+	}
+
+	return &f, nil
+}
+
+func (q *batchQueue) files() ([]openai.File, error) {
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(q.dir, "files", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []openai.File{}
+	for _, match := range matches {
+		f, err := q.file(strings.TrimSuffix(filepath.Base(match), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *f)
+	}
+
+	slices.SortFunc(files, func(a, b openai.File) int {
+		return cmp.Or(cmp.Compare(b.CreatedAt, a.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+
+	return files, nil
+}
+
+func (q *batchQueue) deleteFile(id string) error {
+	if _, err := q.file(id); err != nil {
+		return err
+	}
+
+	if err := os.Remove(filepath.Join(q.dir, "files", id+".json")); err != nil {
+		return err
+	}
+
+	return os.Remove(q.filePath(id))
+}
+
+// readBatchItems reads the requests of a batch from a JSONL file. If
+// endpoint is set, every request must be made to it.
+func readBatchItems(r io.Reader, endpoint string) ([]api.BatchItem, error) {
+	var items []api.BatchItem
+	ids := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*format.KiloByte), maxBatchLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var item api.BatchItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", errInvalidBatch, line, err)
+		}
+
+		if err := validateBatchItem(item, endpoint, ids); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", errInvalidBatch, line, err)
+		}
+
+		if len(items) == maxBatchRequests {
+			return nil, fmt.Errorf("%w: more than %d requests", errInvalidBatch, maxBatchRequests)
+		}
+
+		items = append(items, item)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidBatch, err)
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: no requests", errInvalidBatch)
+	}
+
+	return items, nil
+}
+
+func validateBatchItem(item api.BatchItem, endpoint string, ids map[string]bool) error {
+	switch {
+	case item.CustomID == "":
+		return errors.New("custom_id is required")
+	case ids[item.CustomID]:
+		return fmt.Errorf("duplicate custom_id %q", item.CustomID)
+	case item.Method != "" && item.Method != http.MethodPost:
+		return fmt.Errorf("method must be POST, got %q", item.Method)
+	case !slices.Contains(batchEndpoints, item.URL):
+		return fmt.Errorf("url must be one of %s, got %q", strings.Join(batchEndpoints, ", "), item.URL)
+	case endpoint != "" && item.URL != endpoint:
+		return fmt.Errorf("url %q does not match the batch endpoint %q", item.URL, endpoint)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(item.Body, &body); err != nil || body == nil {
+		return errors.New("body must be a JSON object")
+	}
+
+	ids[item.CustomID] = true
+	return nil
+}
+
+// create starts a batch of the requests in an input file
+func (q *batchQueue) create(inputFileID, endpoint, window string, metadata map[string]string, user string) (*api.Batch, error) {
+	if _, err := q.file(inputFileID); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(q.filePath(inputFileID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	items, err := readBatchItems(f, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &batchRecord{
+		Batch: api.Batch{
+			ID:               newBatchID("batch_"),
+			Status:           api.BatchValidating,
+			Endpoint:         endpoint,
+			InputFileID:      inputFileID,
+			RequestCounts:    api.BatchRequestCounts{Total: len(items)},
+			Metadata:         metadata,
+			CompletionWindow: window,
+			CreatedAt:        time.Now(),
+		},
+		User: user,
+	}
+
+	output, err := q.createFile(b.ID+"_output.jsonl", "batch_output", strings.NewReader(""))
+	if err != nil {
+		return nil, err
+	}
+	b.OutputFileID = output.ID
+
+	errs, err := q.createFile(b.ID+"_error.jsonl", "batch_output", strings.NewReader(""))
+	if err != nil {
+		return nil, err
+	}
+	b.ErrorFileID = errs.ID
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.save(b); err != nil {
+		return nil, err
+	}
+
+	q.batches[b.ID] = b
+	q.run(b.ID)
+	return &b.Batch, nil
+}
+
+// save writes a batch to disk. It must be called with q.mu held.
+func (q *batchQueue) save(b *batchRecord) error {
+	bts, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(q.dir, b.ID+".json")
+	if err := os.WriteFile(path+".tmp", bts, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func (q *batchQueue) get(id string) (*api.Batch, error) {
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	b, ok := q.batches[id]
+	if !ok {
+		return nil, errBatchNotFound
+	}
+
+	batch := b.Batch
+	return &batch, nil
+}
+
+// list returns batches, most recent first
+func (q *batchQueue) list() ([]api.Batch, error) {
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	batches := []api.Batch{}
+	for _, b := range q.batches {
+		batches = append(batches, b.Batch)
+	}
+
+	slices.SortFunc(batches, func(a, b api.Batch) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+
+	return batches, nil
+}
+
+// cancel stops a batch. Requests that are running are abandoned, and their
+// results aren't recorded.
+func (q *batchQueue) cancel(id string) (*api.Batch, error) {
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	b, ok := q.batches[id]
+	if !ok {
+		return nil, errBatchNotFound
+	}
+
+	switch b.Status {
+	case api.BatchValidating, api.BatchInProgress, api.BatchFinalizing:
+	default:
+		return nil, fmt.Errorf("%w: status is %s", errBatchFinished, b.Status)
+	}
+
+	b.Status = api.BatchCancelling
+	b.CancellingAt = time.Now()
+	if cancel, ok := q.cancels[id]; ok {
+		cancel()
+	} else {
+		b.Status = api.BatchCancelled
+		b.CancelledAt = b.CancellingAt
+	}
+
+	if err := q.save(b); err != nil {
+		return nil, err
+	}
+
+	batch := b.Batch
+	return &batch, nil
+}
+
+// sizes returns the sizes of files, which aren't written to while the lock
+// is held
+func (q *batchQueue) sizes(ids ...string) []int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sizes := make([]int64, len(ids))
+	for i, id := range ids {
+		if fi, err := os.Stat(q.filePath(id)); err == nil {
+			sizes[i] = fi.Size()
+		}
+	}
+
+	return sizes
+}
+
+// update changes a batch and saves it
+func (q *batchQueue) update(id string, fn func(*batchRecord)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	b := q.batches[id]
+	fn(b)
+	if err := q.save(b); err != nil {
+		slog.Error("failed to save batch", "id", id, "error", err)
+	}
+}
+
+// run starts processing a batch. It must be called with q.mu held.
+func (q *batchQueue) run(id string) {
+	ctx, cancel := context.WithCancel(q.ctx)
+	q.cancels[id] = cancel
+
+	go func() {
+		defer func() {
+			q.mu.Lock()
+			delete(q.cancels, id)
+			q.mu.Unlock()
+			cancel()
+		}()
+
+		if err := q.process(ctx, id); err != nil {
+			slog.Error("batch failed", "id", id, "error", err)
+			q.update(id, func(b *batchRecord) {
+				b.Status = api.BatchFailed
+				b.FailedAt = time.Now()
+				b.Errors = append(b.Errors, api.BatchError{Code: "batch_failed", Message: err.Error()})
+			})
+		}
+	}()
+}
+
+func (q *batchQueue) process(ctx context.Context, id string) error {
+	q.mu.Lock()
+	b := *q.batches[id]
+	q.mu.Unlock()
+
+	input, err := os.Open(q.filePath(b.InputFileID))
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	items, err := readBatchItems(input, b.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	// requests that finished before a restart are skipped
+	done := make(map[string]bool)
+	output, completed, err := openBatchResults(q.filePath(b.OutputFileID), done)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	errs, failed, err := openBatchResults(q.filePath(b.ErrorFileID), done)
+	if err != nil {
+		return err
+	}
+	defer errs.Close()
+
+	q.update(id, func(b *batchRecord) {
+		if b.Status == api.BatchValidating || b.Status == api.BatchFinalizing {
+			b.Status = api.BatchInProgress
+		}
+
+		if b.StartedAt.IsZero() {
+			b.StartedAt = time.Now()
+		}
+
+		b.RequestCounts.Completed = completed
+		b.RequestCounts.Failed = failed
+	})
+
+	ch := make(chan api.BatchItem)
+	var wg sync.WaitGroup
+	for range max(envconfig.BatchParallel(), 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range ch {
+				result, ok := q.do(ctx, b.User, item)
+				if !ok {
+					continue
+				}
+
+				bts, err := json.Marshal(result)
+				if err != nil {
+					slog.Error("failed to encode batch result", "id", id, "custom_id", item.CustomID, "error", err)
+					continue
+				}
+
+				q.update(id, func(b *batchRecord) {
+					w := output
+					if result.Error != nil {
+						w = errs
+					}
+
+					if _, err := w.Write(append(bts, '\n')); err != nil {
+						slog.Error("failed to write batch result", "id", id, "custom_id", item.CustomID, "error", err)
+						return
+					}
+
+					if result.Error != nil {
+						b.RequestCounts.Failed++
+					} else {
+						b.RequestCounts.Completed++
+					}
+				})
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		if done[item.CustomID] {
+			continue
+		}
+
+		select {
+		case ch <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(ch)
+	wg.Wait()
+
+	q.update(id, func(b *batchRecord) {
+		now := time.Now()
+		switch {
+		case b.Status == api.BatchCancelling:
+			b.Status = api.BatchCancelled
+			b.CancelledAt = now
+		case ctx.Err() != nil:
+			// the server is stopping, so the batch is left to resume
+		default:
+			b.Status = api.BatchCompleted
+			b.FinalizingAt = now
+			b.CompletedAt = now
+		}
+	})
+
+	return nil
+}
+
+// openBatchResults opens a results file for appending, adding the requests
+// it holds to done and returning how many there are. A partially written
+// last line is removed.
+func openBatchResults(path string, done map[string]bool) (*os.File, int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	bts, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	n := bytes.LastIndexByte(bts, '\n') + 1
+	if n < len(bts) {
+		if err := f.Truncate(int64(n)); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+	}
+
+	if _, err := f.Seek(int64(n), io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	var count int
+	for line := range bytes.Lines(bts[:n]) {
+		var result api.BatchResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			f.Close()
+			return nil, 0, fmt.Errorf("%s: %w", path, err)
+		}
+
+		done[result.CustomID] = true
+		count++
+	}
+
+	return f, count, nil
+}
+
+// batchResponseWriter records the response to a request of a batch
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *batchResponseWriter) Flush() {}
+
+// do makes a request of a batch, retrying while the queue is full. It
+// returns false if ctx is done before the request completes.
+func (q *batchQueue) do(ctx context.Context, user string, item api.BatchItem) (api.BatchResult, bool) {
+	requestID := newBatchID("batch_req_")
+	result := api.BatchResult{ID: requestID, CustomID: item.CustomID}
+
+	body, err := batchRequestBody(item.Body)
+	if err != nil {
+		result.Error = &api.BatchError{Code: "invalid_request", Message: err.Error()}
+		return result, true
+	}
+
+	for {
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, item.URL, bytes.NewReader(body))
+		if err != nil {
+			result.Error = &api.BatchError{Code: "invalid_request", Message: err.Error()}
+			return result, true
+		}
+
+		r.Host = "localhost"
+		r.RemoteAddr = "127.0.0.1:0"
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(priorityHeader, api.PriorityBackground)
+		if user != "" {
+			r.Header.Set(userHeader, user)
+		}
+
+		w := &batchResponseWriter{header: make(http.Header)}
+		q.handler.ServeHTTP(w, r)
+		if ctx.Err() != nil {
+			return result, false
+		}
+
+		if w.status == http.StatusTooManyRequests || w.status == http.StatusServiceUnavailable {
+			wait := time.Second
+			if s, err := strconv.Atoi(w.header.Get("Retry-After")); err == nil && s > 0 {
+				wait = min(time.Duration(s)*time.Second, 30*time.Second)
+			}
+
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return result, false
+			}
+		}
+
+		status := cmp.Or(w.status, http.StatusOK)
+		response := bytes.TrimSpace(w.body.Bytes())
+		if !json.Valid(response) {
+			response, _ = json.Marshal(string(response))
+		}
+
+		result.Response = &api.BatchResultResponse{StatusCode: status, RequestID: requestID, Body: response}
+		if status >= http.StatusBadRequest {
+			result.Error = &api.BatchError{
+				Code:    strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+				Message: errorMessage(response),
+			}
+		}
+
+		return result, true
+	}
+}
+
+// batchRequestBody disables streaming and removes any priority from the body
+// of a request, since batches always run at background priority
+func batchRequestBody(raw json.RawMessage) ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+
+	body["stream"] = json.RawMessage("false")
+	delete(body, "priority")
+	return json.Marshal(body)
+}
+
+// errorMessage returns the message of an error response from either the
+// native or the OpenAI compatible endpoints
+func errorMessage(body []byte) string {
+	var native struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &native); err == nil && native.Error != "" {
+		return native.Error
+	}
+
+	var compat openai.ErrorResponse
+	if err := json.Unmarshal(body, &compat); err == nil && compat.Error.Message != "" {
+		return compat.Error.Message
+	}
+
+	return string(body)
+}
+
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidBatch):
+		return http.StatusBadRequest
+	case errors.Is(err, errBatchNotFound), errors.Is(err, errFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errBatchFinished):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (s *Server) CreateBatchHandler(c *gin.Context) {
+	var req api.CreateBatchRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sb bytes.Buffer
+	e := json.NewEncoder(&sb)
+	for _, item := range req.Requests {
+		if err := e.Encode(item); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	input, err := s.batches.createFile("batch_input.jsonl", "batch", &sb)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	b, err := s.batches.create(input.ID, "", "", req.Metadata, requestUser(c))
+	if err != nil {
+		if err := s.batches.deleteFile(input.ID); err != nil {
+			slog.Warn("failed to remove batch input", "id", input.ID, "error", err)
+		}
+		c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+func (s *Server) ListBatchesHandler(c *gin.Context) {
+	batches, err := s.batches.list()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ListBatchesResponse{Batches: batches})
+}
+
+func (s *Server) BatchHandler(c *gin.Context) {
+	b, err := s.batches.get(c.Param("id"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+func (s *Server) CancelBatchHandler(c *gin.Context) {
+	b, err := s.batches.cancel(c.Param("id"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+// BatchResultsHandler streams the results of a batch's requests that have
+// finished so far, successful or not, as newline delimited JSON
+func (s *Server) BatchResultsHandler(c *gin.Context) {
+	b, err := s.batches.get(c.Param("id"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// results are written a line at a time while holding the lock, so the
+	// sizes of the files at this point end with whole lines
+	sizes := s.batches.sizes(b.OutputFileID, b.ErrorFileID)
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	for i, id := range []string{b.OutputFileID, b.ErrorFileID} {
+		f, err := os.Open(s.batches.filePath(id))
+		if err != nil {
+			slog.Error("failed to open batch results", "id", b.ID, "error", err)
+			return
+		}
+
+		_, err = io.CopyN(c.Writer, f, sizes[i])
+		f.Close()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) CreateFileHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchFileSize)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if purpose := c.PostForm("purpose"); purpose != "batch" {
+		c.JSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, fmt.Sprintf("purpose must be batch, got %q", purpose)))
+		return
+	}
+
+	r, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	defer r.Close()
+
+	f, err := s.batches.createFile(header.Filename, "batch", r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, f)
+}
+
+func (s *Server) ListFilesHandler(c *gin.Context) {
+	files, err := s.batches.files()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if purpose := c.Query("purpose"); purpose != "" {
+		files = slices.DeleteFunc(files, func(f openai.File) bool { return f.Purpose != purpose })
+	}
+
+	c.JSON(http.StatusOK, openai.FileList{Object: "list", Data: files})
+}
+
+func (s *Server) FileHandler(c *gin.Context) {
+	f, err := s.batches.file(c.Param("id"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), openai.NewError(batchErrorStatus(err), err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, f)
+}
+
+func (s *Server) FileContentHandler(c *gin.Context) {
+	f, err := s.batches.file(c.Param("id"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), openai.NewError(batchErrorStatus(err), err.Error()))
+		return
+	}
+
+	c.Header("Content-Type", "application/jsonl")
+	c.File(s.batches.filePath(f.ID))
+}
+
+func (s *Server) DeleteFileHandler(c *gin.Context) {
+	id := c.Param("id")
+	if err := s.batches.deleteFile(id); err != nil {
+		c.JSON(batchErrorStatus(err), openai.NewError(batchErrorStatus(err), err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, openai.DeletedFile{ID: id, Object: "file", Deleted: true})
+}
+
+func (s *Server) CreateOpenAIBatchHandler(c *gin.Context) {
+	var req openai.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	switch {
+	case req.InputFileID == "":
+		c.JSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "input_file_id is required"))
+		return
+	case !strings.HasPrefix(req.Endpoint, "/v1/") || !slices.Contains(batchEndpoints, req.Endpoint):
+		c.JSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, fmt.Sprintf("unsupported endpoint %q", req.Endpoint)))
+		return
+	case req.CompletionWindow != "24h":
+		c.JSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "completion_window must be 24h"))
+		return
+	}
+
+	b, err := s.batches.create(req.InputFileID, req.Endpoint, req.CompletionWindow, req.Metadata, requestUser(c))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), openai.NewError(batchErrorStatus(err), err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, openai.ToBatch(*b))
+}
+
+func (s *Server) ListOpenAIBatchesHandler(c *gin.Context) {
+	limit := 20
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "limit must be between 1 and 100"))
+			return
+		}
+		limit = n
+	}
+
+	batches, err := s.batches.list()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if after := c.Query("after"); after != "" {
+		i := slices.IndexFunc(batches, func(b api.Batch) bool { return b.ID == after })
+		batches = batches[i+1:]
+	}
+
+	list := openai.BatchList{Object: "list", Data: []openai.Batch{}, HasMore: len(batches) > limit}
+	for _, b := range batches[:min(limit, len(batches))] {
+		list.Data = append(list.Data, openai.ToBatch(b))
+	}
+
+	if len(list.Data) > 0 {
+		list.FirstID = &list.Data[0].ID
+		list.LastID = &list.Data[len(list.Data)-1].ID
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (s *Server) OpenAIBatchHandler(c *gin.Context) {
+	b, err := s.batches.get(c.Param("id"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), openai.NewError(batchErrorStatus(err), err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, openai.ToBatch(*b))
+}
+
+func (s *Server) CancelOpenAIBatchHandler(c *gin.Context) {
+	b, err := s.batches.cancel(c.Param("id"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), openai.NewError(batchErrorStatus(err), err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, openai.ToBatch(*b))
+}
@@ -0,0 +1,445 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/openai"
+)
+
+// batchHandler stands in for the server's routes, echoing each request's
+// prompt and recording how it was made
+type batchHandler struct {
+	mu       sync.Mutex
+	requests []map[string]any
+	headers  []http.Header
+	busy     int
+	block    bool
+}
+
+func (h *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	if h.busy > 0 {
+		h.busy--
+		h.mu.Unlock()
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "server busy"})
+		return
+	}
+
+	h.requests = append(h.requests, body)
+	h.headers = append(h.headers, r.Header.Clone())
+	block := h.block
+	h.mu.Unlock()
+
+	if block {
+		<-r.Context().Done()
+		return
+	}
+
+	if body["prompt"] == "fail" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad prompt"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"response": body["prompt"], "done": true})
+}
+
+func (h *batchHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.requests)
+}
+
+func batchInput(t *testing.T, prompts ...string) string {
+	t.Helper()
+
+	var sb strings.Builder
+	for i, prompt := range prompts {
+		item := api.BatchItem{
+			CustomID: "request-" + string(rune('a'+i)),
+			URL:      "/api/generate",
+			Body:     json.RawMessage(`{"model": "test", "prompt": "` + prompt + `", "priority": "interactive"}`),
+		}
+
+		bts, err := json.Marshal(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sb.Write(bts)
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+func waitForBatch(t *testing.T, q *batchQueue, id string, statuses ...string) *api.Batch {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		b, err := q.get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, status := range statuses {
+			if b.Status == status {
+				return b
+			}
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for batch, status is %s", b.Status)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func readResults(t *testing.T, q *batchQueue, fileID string) map[string]api.BatchResult {
+	t.Helper()
+
+	bts, err := os.ReadFile(q.filePath(fileID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(map[string]api.BatchResult)
+	for line := range bytes.Lines(bts) {
+		var result api.BatchResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			t.Fatal(err)
+		}
+		results[result.CustomID] = result
+	}
+
+	return results
+}
+
+func TestBatchQueue(t *testing.T) {
+	h := &batchHandler{busy: 1}
+	q := newBatchQueue(t.TempDir(), h)
+
+	input, err := q.createFile("input.jsonl", "batch", strings.NewReader(batchInput(t, "one", "two", "fail")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := q.create(input.ID, "", "", map[string]string{"job": "nightly"}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b = waitForBatch(t, q, b.ID, api.BatchCompleted)
+	if diff := cmp.Diff(api.BatchRequestCounts{Total: 3, Completed: 2, Failed: 1}, b.RequestCounts); diff != "" {
+		t.Errorf("request counts mismatch (-want +got):\n%s", diff)
+	}
+
+	if b.StartedAt.IsZero() || b.CompletedAt.IsZero() {
+		t.Errorf("expected start and completion times, got %v and %v", b.StartedAt, b.CompletedAt)
+	}
+
+	output := readResults(t, q, b.OutputFileID)
+	if len(output) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(output))
+	}
+
+	for id, want := range map[string]string{"request-a": "one", "request-b": "two"} {
+		var resp api.GenerateResponse
+		if err := json.Unmarshal(output[id].Response.Body, &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if output[id].Response.StatusCode != http.StatusOK || resp.Response != want {
+			t.Errorf("%s: expected %q, got %d %q", id, want, output[id].Response.StatusCode, resp.Response)
+		}
+	}
+
+	errs := readResults(t, q, b.ErrorFileID)
+	if diff := cmp.Diff(&api.BatchError{Code: "bad_request", Message: "bad prompt"}, errs["request-c"].Error); diff != "" {
+		t.Errorf("error mismatch (-want +got):\n%s", diff)
+	}
+
+	for i, body := range h.requests {
+		if body["stream"] != false {
+			t.Errorf("expected streaming to be disabled, got %v", body["stream"])
+		}
+
+		if _, ok := body["priority"]; ok {
+			t.Error("expected priority to be removed from the body")
+		}
+
+		if got := h.headers[i].Get(priorityHeader); got != api.PriorityBackground {
+			t.Errorf("expected background priority, got %q", got)
+		}
+
+		if got := h.headers[i].Get(userHeader); got != "alice" {
+			t.Errorf("expected user alice, got %q", got)
+		}
+	}
+
+	if _, err := q.cancel(b.ID); !errors.Is(err, errBatchFinished) {
+		t.Errorf("expected errBatchFinished, got %v", err)
+	}
+}
+
+func TestBatchQueueResume(t *testing.T) {
+	dir := t.TempDir()
+
+	q := newBatchQueue(dir, &batchHandler{block: true})
+	input, err := q.createFile("input.jsonl", "batch", strings.NewReader(batchInput(t, "one", "two", "three")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	if err := q.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := q.create(input.ID, "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a restart after the first request finished and while the
+	// second was being written
+	cancel()
+	waitForBatch(t, q, b.ID, api.BatchInProgress)
+	for !func() bool { q.mu.Lock(); defer q.mu.Unlock(); return len(q.cancels) == 0 }() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := os.WriteFile(q.filePath(b.OutputFileID), []byte(`{"id":"batch_req_1","custom_id":"request-a","response":{"status_code":200,"request_id":"batch_req_1","body":{}},"error":null}`+"\n"+`{"id":"batch_req_2","cus`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &batchHandler{}
+	q = newBatchQueue(dir, h)
+	if err := q.start(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	b = waitForBatch(t, q, b.ID, api.BatchCompleted)
+	if diff := cmp.Diff(api.BatchRequestCounts{Total: 3, Completed: 3}, b.RequestCounts); diff != "" {
+		t.Errorf("request counts mismatch (-want +got):\n%s", diff)
+	}
+
+	if h.count() != 2 {
+		t.Errorf("expected 2 requests after resuming, got %d", h.count())
+	}
+
+	output := readResults(t, q, b.OutputFileID)
+	if len(output) != 3 || output["request-a"].ID != "batch_req_1" {
+		t.Errorf("unexpected results %v", output)
+	}
+}
+
+func TestBatchQueueCancel(t *testing.T) {
+	h := &batchHandler{block: true}
+	q := newBatchQueue(t.TempDir(), h)
+
+	input, err := q.createFile("input.jsonl", "batch", strings.NewReader(batchInput(t, "one", "two")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := q.create(input.ID, "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for h.count() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := q.cancel(b.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	b = waitForBatch(t, q, b.ID, api.BatchCancelled)
+	if b.RequestCounts.Completed != 0 || b.RequestCounts.Failed != 0 || b.CancelledAt.IsZero() {
+		t.Errorf("unexpected batch after cancelling %+v", b)
+	}
+
+	// the cancellation is kept across a restart
+	q = newBatchQueue(q.dir, h)
+	if b, err := q.get(b.ID); err != nil || b.Status != api.BatchCancelled {
+		t.Errorf("expected cancelled batch, got %v, %v", b, err)
+	}
+}
+
+func TestReadBatchItems(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		endpoint string
+		err      string
+	}{
+		{"empty", "\n", "", "invalid batch: no requests"},
+		{"invalid json", "{", "", "invalid batch: line 1: unexpected end of JSON input"},
+		{"missing custom id", `{"url": "/api/chat", "body": {}}`, "", "invalid batch: line 1: custom_id is required"},
+		{"duplicate custom id", `{"custom_id": "a", "url": "/api/chat", "body": {}}` + "\n\n" + `{"custom_id": "a", "url": "/api/chat", "body": {}}`, "", `invalid batch: line 3: duplicate custom_id "a"`},
+		{"method", `{"custom_id": "a", "method": "GET", "url": "/api/chat", "body": {}}`, "", `invalid batch: line 1: method must be POST, got "GET"`},
+		{"url", `{"custom_id": "a", "url": "/api/pull", "body": {}}`, "", `invalid batch: line 1: url must be one of ` + strings.Join(batchEndpoints, ", ") + `, got "/api/pull"`},
+		{"endpoint", `{"custom_id": "a", "url": "/v1/embeddings", "body": {}}`, "/v1/chat/completions", `invalid batch: line 1: url "/v1/embeddings" does not match the batch endpoint "/v1/chat/completions"`},
+		{"body", `{"custom_id": "a", "url": "/api/chat", "body": []}`, "", "invalid batch: line 1: body must be a JSON object"},
+		{"valid", `{"custom_id": "a", "url": "/v1/chat/completions", "body": {"model": "test"}}`, "/v1/chat/completions", ""},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readBatchItems(strings.NewReader(tt.input), tt.endpoint)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestOpenAIBatchHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := &Server{batches: newBatchQueue(t.TempDir(), &batchHandler{})}
+	r := gin.New()
+	r.POST("/v1/files", s.CreateFileHandler)
+	r.GET("/v1/files/:id/content", s.FileContentHandler)
+	r.POST("/v1/batches", s.CreateOpenAIBatchHandler)
+	r.GET("/v1/batches", s.ListOpenAIBatchesHandler)
+	r.GET("/v1/batches/:id", s.OpenAIBatchHandler)
+	r.GET("/api/batches/:id/results", s.BatchResultsHandler)
+
+	do := func(method, path, contentType string, body io.Reader, v any) int {
+		t.Helper()
+
+		req := httptest.NewRequest(method, path, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if v != nil {
+			if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+				t.Fatalf("%s %s: %v: %s", method, path, err, w.Body)
+			}
+		}
+		return w.Code
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("purpose", "batch")
+	fw, err := mw.CreateFormFile("file", "input.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, `{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "test", "messages": []}}`+"\n")
+	mw.Close()
+
+	var file openai.File
+	if code := do(http.MethodPost, "/v1/files", mw.FormDataContentType(), &form, &file); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+
+	if file.Object != "file" || file.Purpose != "batch" || file.Filename != "input.jsonl" || file.Bytes == 0 {
+		t.Errorf("unexpected file %+v", file)
+	}
+
+	var errResp openai.ErrorResponse
+	if code := do(http.MethodPost, "/v1/batches", "application/json", strings.NewReader(`{"input_file_id": "`+file.ID+`", "endpoint": "/v1/embeddings", "completion_window": "24h"}`), &errResp); code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", code)
+	}
+
+	if want := `invalid batch: line 1: url "/v1/chat/completions" does not match the batch endpoint "/v1/embeddings"`; errResp.Error.Message != want {
+		t.Errorf("expected error %q, got %q", want, errResp.Error.Message)
+	}
+
+	if code := do(http.MethodPost, "/v1/batches", "application/json", strings.NewReader(`{"input_file_id": "file-missing", "endpoint": "/v1/chat/completions", "completion_window": "24h"}`), nil); code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", code)
+	}
+
+	var batch openai.Batch
+	if code := do(http.MethodPost, "/v1/batches", "application/json", strings.NewReader(`{"input_file_id": "`+file.ID+`", "endpoint": "/v1/chat/completions", "completion_window": "24h", "metadata": {"job": "nightly"}}`), &batch); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+
+	if batch.Object != "batch" || batch.InputFileID != file.ID || batch.Metadata["job"] != "nightly" || batch.RequestCounts.Total != 1 {
+		t.Errorf("unexpected batch %+v", batch)
+	}
+
+	waitForBatch(t, s.batches, batch.ID, api.BatchCompleted)
+	if code := do(http.MethodGet, "/v1/batches/"+batch.ID, "", nil, &batch); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+
+	if batch.Status != api.BatchCompleted || batch.OutputFileID == nil || batch.CompletedAt == nil {
+		t.Fatalf("unexpected batch %+v", batch)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/files/"+*batch.OutputFileID+"/content", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var result api.BatchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.CustomID != "a" || result.Response.StatusCode != http.StatusOK || result.Error != nil {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/batches/"+batch.ID+"/results", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != strings.TrimSpace(w.Body.String())+"\n" || strings.Count(w.Body.String(), "\n") != 1 {
+		t.Errorf("unexpected results %q", w.Body)
+	}
+
+	var list openai.BatchList
+	if code := do(http.MethodGet, "/v1/batches?limit=1", "", nil, &list); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+
+	if len(list.Data) != 1 || list.HasMore || *list.FirstID != batch.ID {
+		t.Errorf("unexpected list %+v", list)
+	}
+
+	if _, err := os.Stat(filepath.Join(s.batches.dir, batch.ID+".json")); err != nil {
+		t.Errorf("expected batch to be stored: %v", err)
+	}
+}
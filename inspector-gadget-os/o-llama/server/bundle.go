@@ -0,0 +1,442 @@
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// A bundle is a tar archive of models, for moving them to machines that
+// can't reach a registry. It holds:
+//
+//	index.json                the names of the models and their manifests
+//	manifests/sha256-<hex>    each model's manifest, as stored
+//	blobs/sha256-<hex>        each layer, once even if models share it
+//
+// Bundles may be compressed with gzip.
+const bundleIndex = "index.json"
+
+// maxBundleManifestSize limits the size of manifests read from bundles
+const maxBundleManifestSize = 4 << 20
+
+var bundleDigest = regexp.MustCompile(`^sha256-[0-9a-f]{64}$`)
+
+var errModelNotFound = errors.New("model not found")
+
+type bundleIndexFile struct {
+	Models []bundleModel `json:"models"`
+}
+
+type bundleModel struct {
+	Name     string `json:"name"`
+	Manifest string `json:"manifest"`
+}
+
+type bundleEntry struct {
+	name string
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+// bundleEntries returns the entries of a bundle of models, in the order they
+// are written
+func bundleEntries(names []string) ([]bundleEntry, error) {
+	var index bundleIndexFile
+	var manifests, blobs []bundleEntry
+	seen := make(map[string]bool)
+
+	for _, s := range names {
+		n := model.ParseName(s)
+		if !n.IsValid() {
+			return nil, fmt.Errorf("invalid model name %q", s)
+		}
+
+		m, err := ParseNamedManifest(n)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", errModelNotFound, s)
+		} else if err != nil {
+			return nil, err
+		}
+
+		bts, err := os.ReadFile(m.filepath)
+		if err != nil {
+			return nil, err
+		}
+
+		index.Models = append(index.Models, bundleModel{Name: n.String(), Manifest: "sha256:" + m.digest})
+		if !seen[m.digest] {
+			seen[m.digest] = true
+			manifests = append(manifests, bundleEntry{
+				name: "manifests/sha256-" + m.digest,
+				size: int64(len(bts)),
+				open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(bts)), nil },
+			})
+		}
+
+		for _, layer := range append(m.Layers, m.Config) {
+			if layer.Digest == "" || seen[layer.Digest] {
+				continue
+			}
+			seen[layer.Digest] = true
+
+			p, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			fi, err := os.Stat(p)
+			if err != nil {
+				return nil, fmt.Errorf("model %q: %w", s, err)
+			}
+
+			blobs = append(blobs, bundleEntry{
+				name: "blobs/" + filepath.Base(p),
+				size: fi.Size(),
+				open: func() (io.ReadCloser, error) { return os.Open(p) },
+			})
+		}
+	}
+
+	bts, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []bundleEntry{{
+		name: bundleIndex,
+		size: int64(len(bts)),
+		open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(bts)), nil },
+	}}
+
+	entries = append(entries, manifests...)
+	return append(entries, blobs...), nil
+}
+
+// bundleSize returns the size of the tar archive of entries
+func bundleSize(entries []bundleEntry) (size int64) {
+	for _, e := range entries {
+		size += 512 + (e.size+511)/512*512
+	}
+
+	// the archive ends with two empty blocks
+	return size + 1024
+}
+
+func writeBundle(w io.Writer, entries []bundleEntry) error {
+	tw := tar.NewWriter(w)
+	now := time.Now().Truncate(time.Second)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.name,
+			Size:     e.size,
+			Mode:     0o644,
+			ModTime:  now,
+			Format:   tar.FormatUSTAR,
+		}); err != nil {
+			return err
+		}
+
+		r, err := e.open()
+		if err != nil {
+			return err
+		}
+
+		_, err = io.CopyN(tw, r, e.size)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// importBundle adds the models of a bundle, returning their names. Every
+// layer is verified before any model is written: layers already present are
+// checked against their digest and replaced if they don't match, and other
+// layers are hashed as they are written.
+func importBundle(r io.Reader, fn func(api.ProgressResponse)) ([]string, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+
+	var index *bundleIndexFile
+	manifests := make(map[string][]byte)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read bundle: %w", err)
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		dir, base := path.Split(path.Clean(hdr.Name))
+		switch {
+		case dir == "" && base == bundleIndex:
+			index = &bundleIndexFile{}
+			if err := json.NewDecoder(io.LimitReader(tr, maxBundleManifestSize)).Decode(index); err != nil {
+				return nil, fmt.Errorf("read bundle index: %w", err)
+			}
+		case dir == "manifests/" && bundleDigest.MatchString(base):
+			bts, err := io.ReadAll(io.LimitReader(tr, maxBundleManifestSize))
+			if err != nil {
+				return nil, err
+			}
+
+			digest := strings.Replace(base, "-", ":", 1)
+			if sum := sha256.Sum256(bts); "sha256:"+hex.EncodeToString(sum[:]) != digest {
+				return nil, fmt.Errorf("manifest %s: %w", digest, errDigestMismatch)
+			}
+
+			manifests[digest] = bts
+		case dir == "blobs/" && bundleDigest.MatchString(base):
+			if err := importBundleBlob(tr, strings.Replace(base, "-", ":", 1), hdr.Size, fn); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected file %q in bundle", hdr.Name)
+		}
+	}
+
+	if index == nil {
+		return nil, errors.New("bundle has no index")
+	}
+
+	if len(index.Models) == 0 {
+		return nil, errors.New("bundle has no models")
+	}
+
+	manifestsPath, err := GetManifestPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// every model is checked before any are written, so that a bundle
+	// missing layers doesn't leave some of its models behind
+	type write struct {
+		path string
+		data []byte
+	}
+
+	var writes []write
+	var names []string
+	for _, bm := range index.Models {
+		n := model.ParseName(bm.Name)
+		if !n.IsFullyQualified() {
+			return nil, fmt.Errorf("invalid model name %q in bundle", bm.Name)
+		}
+
+		bts, ok := manifests[bm.Manifest]
+		if !ok {
+			return nil, fmt.Errorf("model %q: manifest %s is missing", bm.Name, bm.Manifest)
+		}
+
+		var m Manifest
+		if err := json.Unmarshal(bts, &m); err != nil {
+			return nil, fmt.Errorf("model %q: %w", bm.Name, err)
+		}
+
+		if warning, err := checkProvenance(n.DisplayShortest(), &m); err != nil {
+			return nil, err
+		} else if warning != "" {
+			fn(api.ProgressResponse{Status: warning})
+		}
+
+		for _, layer := range append(m.Layers, m.Config) {
+			if layer.Digest == "" {
+				continue
+			}
+
+			p, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("model %q: %w", bm.Name, err)
+			}
+
+			if _, err := os.Stat(p); err != nil {
+				return nil, fmt.Errorf("model %q: layer %s is missing", bm.Name, layer.Digest)
+			}
+		}
+
+		n, err := getExistingName(n)
+		if err != nil {
+			return nil, err
+		}
+
+		writes = append(writes, write{path: filepath.Join(manifestsPath, n.Filepath()), data: bts})
+		names = append(names, n.DisplayShortest())
+	}
+
+	for _, w := range writes {
+		fn(api.ProgressResponse{Status: "writing manifest"})
+		if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+			return nil, err
+		}
+
+		if err := os.WriteFile(w.path, w.data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// importBundleBlob writes a layer from a bundle, unless a layer matching its
+// digest is already present. The layer is hashed as it is written and only
+// moved into place if it matches.
+func importBundleBlob(r io.Reader, digest string, size int64, fn func(api.ProgressResponse)) error {
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(p); err == nil && fi.Size() == size {
+		if err := verifyBlob(digest); err == nil {
+			slog.Debug("layer already exists", "digest", digest)
+			fn(api.ProgressResponse{Status: "using existing layer", Digest: digest, Total: size, Completed: size})
+			return nil
+		}
+		slog.Warn("existing layer doesn't match its digest, replacing it", "digest", digest)
+	}
+
+	fn(api.ProgressResponse{Status: "importing", Digest: digest, Total: size})
+
+	f, err := os.Create(p + "-partial")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	w := &importProgressWriter{fn: fn, digest: digest, total: size}
+	if _, err := io.CopyN(io.MultiWriter(f, h), io.TeeReader(r, w), size); err != nil {
+		return err
+	}
+
+	if fileDigest := "sha256:" + hex.EncodeToString(h.Sum(nil)); fileDigest != digest {
+		return fmt.Errorf("layer %s: %w", digest, errDigestMismatch)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+// importProgressWriter reports the progress of a layer each time another percent
+// of it is written
+type importProgressWriter struct {
+	fn       func(api.ProgressResponse)
+	digest   string
+	total    int64
+	written  int64
+	reported int64
+}
+
+func (w *importProgressWriter) Write(b []byte) (int, error) {
+	w.written += int64(len(b))
+	if w.written == w.total || (w.written-w.reported)*100 >= w.total {
+		w.reported = w.written
+		w.fn(api.ProgressResponse{Status: "importing", Digest: w.digest, Total: w.total, Completed: w.written})
+	}
+	return len(b), nil
+}
+
+func (s *Server) ExportHandler(c *gin.Context) {
+	var req api.ExportRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Models) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "models are required"})
+		return
+	}
+
+	entries, err := bundleEntries(req.Models)
+	if errors.Is(err, errModelNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Length", strconv.FormatInt(bundleSize(entries), 10))
+	c.Status(http.StatusOK)
+	if err := writeBundle(c.Writer, entries); err != nil {
+		slog.Error("export failed", "models", req.Models, "error", err)
+	}
+}
+
+func (s *Server) ImportHandler(c *gin.Context) {
+	// progress is streamed back while the bundle is still being uploaded
+	if err := http.NewResponseController(c.Writer).EnableFullDuplex(); err != nil {
+		slog.Debug("full duplex not supported", "error", err)
+	}
+
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+		fn := func(r api.ProgressResponse) {
+			ch <- r
+		}
+
+		blobsMu.RLock()
+		names, err := importBundle(c.Request.Body, fn)
+		blobsMu.RUnlock()
+		if err != nil {
+			ch <- gin.H{"error": err.Error()}
+			return
+		}
+
+		for _, name := range names {
+			fn(api.ProgressResponse{Status: fmt.Sprintf("imported %s", name)})
+		}
+		fn(api.ProgressResponse{Status: "success"})
+	}()
+
+	streamResponse(c, ch)
+}
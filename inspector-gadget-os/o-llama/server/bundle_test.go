@@ -0,0 +1,295 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+func importRequest(t *testing.T, s *Server, body []byte) (*httptest.ResponseRecorder, []api.ProgressResponse) {
+	t.Helper()
+
+	w := NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/import", bytes.NewReader(body))
+	s.ImportHandler(c)
+
+	var progress []api.ProgressResponse
+	for line := range bytes.Lines(w.Body.Bytes()) {
+		var resp api.ProgressResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			t.Fatal(err)
+		}
+		progress = append(progress, resp)
+	}
+
+	return w.ResponseRecorder, progress
+}
+
+func lastStatus(t *testing.T, w *httptest.ResponseRecorder, progress []api.ProgressResponse) string {
+	t.Helper()
+	if len(progress) == 0 {
+		t.Fatalf("no progress in response: %s", w.Body.String())
+	}
+
+	if status := progress[len(progress)-1].Status; status != "" {
+		return status
+	}
+
+	var resp struct {
+		Error string `json:"error"`
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(w.Body.Bytes()), []byte("\n"))
+	if err := json.Unmarshal(lines[len(lines)-1], &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Error
+}
+
+func TestBundle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	src := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", src)
+
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+	for _, req := range []api.CreateRequest{
+		{Name: "test", Files: map[string]string{"test.gguf": digest}},
+		{Name: "test2", Files: map[string]string{"test.gguf": digest}, Template: "{{ .Prompt }}"},
+	} {
+		if w := createRequest(t, s.CreateHandler, req); w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+	}
+
+	w := createRequest(t, s.ExportHandler, api.ExportRequest{Models: []string{"test", "test2"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	bundle := w.Body.Bytes()
+	if n, _ := strconv.Atoi(w.Header().Get("Content-Length")); n != len(bundle) {
+		t.Fatalf("expected content length %d, actual %d", len(bundle), n)
+	}
+
+	// shared layers are only written once
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(bundle))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+
+	if names[0] != bundleIndex {
+		t.Fatalf("expected %s first, got %v", bundleIndex, names)
+	}
+
+	blobs, err := filepath.Glob(filepath.Join(src, "blobs", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the index, two manifests and every blob
+	if len(names) != 3+len(blobs) {
+		t.Fatalf("expected %d entries, got %v", 3+len(blobs), names)
+	}
+
+	t.Run("import", func(t *testing.T) {
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+
+		w, progress := importRequest(t, &s, bundle)
+		if status := lastStatus(t, w, progress); status != "success" {
+			t.Fatalf("expected success, got %q", status)
+		}
+
+		checkFileExists(t, filepath.Join(dst, "manifests", "*", "*", "*", "*"), []string{
+			filepath.Join(dst, "manifests", "registry.ollama.ai", "library", "test", "latest"),
+			filepath.Join(dst, "manifests", "registry.ollama.ai", "library", "test2", "latest"),
+		})
+
+		var expect []string
+		for _, blob := range blobs {
+			expect = append(expect, filepath.Join(dst, "blobs", filepath.Base(blob)))
+		}
+		checkFileExists(t, filepath.Join(dst, "blobs", "*"), expect)
+
+		for _, name := range []string{"test", "test2"} {
+			w := createRequest(t, s.ShowHandler, api.ShowRequest{Model: name})
+			if w.Code != http.StatusOK {
+				t.Fatalf("show %s: expected status code 200, actual %d", name, w.Code)
+			}
+		}
+
+		// importing again reuses every layer
+		w, progress = importRequest(t, &s, bundle)
+		if status := lastStatus(t, w, progress); status != "success" {
+			t.Fatalf("expected success, got %q", status)
+		}
+
+		for _, p := range progress {
+			if p.Status == "importing" {
+				t.Fatalf("expected existing layers to be reused, got %+v", p)
+			}
+		}
+
+		// an existing layer of the right size that doesn't match its digest
+		// is replaced
+		p := filepath.Join(dst, "blobs", strings.Replace(digest, ":", "-", 1))
+		bts, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bts[len(bts)/2] ^= 0xff
+		if err := os.WriteFile(p, bts, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		w, progress = importRequest(t, &s, bundle)
+		if status := lastStatus(t, w, progress); status != "success" {
+			t.Fatalf("expected success, got %q", status)
+		}
+
+		var replaced bool
+		for _, p := range progress {
+			replaced = replaced || (p.Status == "importing" && p.Digest == digest)
+		}
+		if !replaced {
+			t.Fatal("expected corrupt layer to be imported again")
+		}
+
+		if err := verifyBlob(digest); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		if _, err := zw.Write(bundle); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		w, progress := importRequest(t, &s, b.Bytes())
+		if status := lastStatus(t, w, progress); status != "success" {
+			t.Fatalf("expected success, got %q", status)
+		}
+	})
+
+	t.Run("corrupt layer", func(t *testing.T) {
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+
+		// flip a byte in the model's weights
+		bts, err := os.ReadFile(filepath.Join(src, "blobs", strings.Replace(digest, ":", "-", 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		i := bytes.Index(bundle, bts)
+		if i < 0 {
+			t.Fatal("expected weights in bundle")
+		}
+
+		corrupt := bytes.Clone(bundle)
+		corrupt[i+len(bts)/2] ^= 0xff
+
+		w, progress := importRequest(t, &s, corrupt)
+		if status := lastStatus(t, w, progress); !strings.Contains(status, errDigestMismatch.Error()) {
+			t.Fatalf("expected digest mismatch, got %q", status)
+		}
+
+		checkFileExists(t, filepath.Join(dst, "manifests", "*", "*", "*", "*"), []string{})
+		if matches, _ := filepath.Glob(filepath.Join(dst, "blobs", "*-partial")); len(matches) > 0 {
+			t.Fatalf("expected partial files to be removed, got %v", matches)
+		}
+
+		// the corrupt layer is never moved into place
+		if _, err := os.Stat(filepath.Join(dst, "blobs", strings.Replace(digest, ":", "-", 1))); err == nil {
+			t.Fatal("expected corrupt layer to not be written")
+		}
+	})
+
+	t.Run("no models", func(t *testing.T) {
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		index := []byte(`{"models":[]}`)
+		if err := tw.WriteHeader(&tar.Header{Name: bundleIndex, Size: int64(len(index)), Mode: 0o644}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(index); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		w, progress := importRequest(t, &s, b.Bytes())
+		if status := lastStatus(t, w, progress); !strings.Contains(status, "no models") {
+			t.Fatalf("expected no models error, got %q", status)
+		}
+	})
+
+	t.Run("unexpected file", func(t *testing.T) {
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		if err := tw.WriteHeader(&tar.Header{Name: "../escape", Size: 1, Mode: 0o644}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		w, progress := importRequest(t, &s, b.Bytes())
+		if status := lastStatus(t, w, progress); !strings.Contains(status, "unexpected file") {
+			t.Fatalf("expected unexpected file error, got %q", status)
+		}
+
+		if _, err := os.Stat(filepath.Join(dst, "..", "escape")); err == nil {
+			t.Fatal("expected file outside of models to not be written")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		w := createRequest(t, s.ExportHandler, api.ExportRequest{Models: []string{"missing"}})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("expected status code 404, actual %d", w.Code)
+		}
+	})
+}
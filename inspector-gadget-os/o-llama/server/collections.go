@@ -0,0 +1,722 @@
+package server
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+const defaultQueryK = 10
+
+var (
+	errInvalidCollection  = errors.New("invalid collection")
+	errCollectionNotFound = errors.New("collection not found")
+	errCollectionExists   = errors.New("collection already exists")
+)
+
+var validCollectionName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// minCollectionLog is the number of documents a collection's log holds
+// before it may be compacted into its file, however few documents the
+// collection has
+const minCollectionLog = 1024
+
+// collection is a collection as it is stored
+type collection struct {
+	Info      api.Collection `json:"collection"`
+	Documents []api.Document `json:"documents"`
+
+	// mu guards the collection, which is only changed once its change is
+	// appended to its log
+	mu sync.RWMutex
+
+	// index maps the IDs of documents to their position in Documents
+	index map[string]int
+
+	// logged is the number of documents upserted or deleted in the log since
+	// the collection was last saved
+	logged int
+
+	// deleted is set once the collection is deleted, for those which looked
+	// it up before
+	deleted bool
+}
+
+// collectionChange is a change to a collection as it is appended to the log
+type collectionChange struct {
+	Info      api.Collection `json:"collection"`
+	Documents []api.Document `json:"documents,omitempty"`
+	Deleted   []string       `json:"deleted,omitempty"`
+}
+
+func (c *collection) reindex() {
+	c.index = make(map[string]int, len(c.Documents))
+	for i, doc := range c.Documents {
+		c.index[doc.ID] = i
+	}
+}
+
+// apply makes change to the collection
+func (c *collection) apply(change collectionChange) {
+	for _, doc := range change.Documents {
+		if i, ok := c.index[doc.ID]; ok {
+			c.Documents[i] = doc
+		} else {
+			c.index[doc.ID] = len(c.Documents)
+			c.Documents = append(c.Documents, doc)
+		}
+	}
+
+	if len(change.Deleted) > 0 {
+		c.Documents = slices.DeleteFunc(c.Documents, func(doc api.Document) bool {
+			return slices.Contains(change.Deleted, doc.ID)
+		})
+		c.reindex()
+	}
+
+	c.Info = change.Info
+	c.Info.Documents = len(c.Documents)
+	c.logged += len(change.Documents) + len(change.Deleted)
+}
+
+// collectionStore keeps collections of documents in memory. Each collection
+// is saved to a file of a directory, and changes to it are appended to a log
+// next to the file until the log grows as large as the collection and the
+// two are compacted into the file again. Collections are searched by
+// comparing the query with every document, which is fast enough for the
+// thousands of documents they're meant for.
+type collectionStore struct {
+	dir string
+
+	once sync.Once
+	err  error
+
+	// mu guards collections. It is never held while waiting for the lock of
+	// a collection.
+	mu          sync.RWMutex
+	collections map[string]*collection
+}
+
+func newCollectionStore(dir string) *collectionStore {
+	return &collectionStore{
+		dir:         dir,
+		collections: make(map[string]*collection),
+	}
+}
+
+func (s *collectionStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+func (s *collectionStore) logPath(name string) string {
+	return filepath.Join(s.dir, name+".log")
+}
+
+func (s *collectionStore) load() error {
+	s.once.Do(func() {
+		if s.err = os.MkdirAll(s.dir, 0o755); s.err != nil {
+			return
+		}
+
+		matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, match := range matches {
+			bts, err := os.ReadFile(match)
+			if err != nil {
+				s.err = err
+				return
+			}
+
+			var c collection
+			if err := json.Unmarshal(bts, &c); err != nil {
+				slog.Warn("skipping corrupt collection", "path", match, "error", err)
+				continue
+			}
+
+			c.reindex()
+			if err := s.replay(&c); err != nil {
+				s.err = err
+				return
+			}
+
+			s.collections[c.Info.Name] = &c
+		}
+	})
+
+	return s.err
+}
+
+// replay applies the changes logged for c and compacts them into its file
+func (s *collectionStore) replay(c *collection) error {
+	f, err := os.Open(s.logPath(c.Info.Name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, math.MaxInt32)
+	for scanner.Scan() {
+		var change collectionChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			// a change is only partly written if the server stopped while
+			// appending it, so it was never acknowledged
+			slog.Warn("ignoring incomplete collection change", "path", f.Name(), "error", err)
+			break
+		}
+
+		c.apply(change)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return s.save(c)
+}
+
+// save writes c to its file and removes its log. The collection's lock
+// must already be held.
+func (s *collectionStore) save(c *collection) error {
+	bts, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(c.Info.Name)
+	if err := os.WriteFile(path+".tmp", bts, 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	// replaying changes already in the file leaves it unchanged, so the
+	// log only needs to go once the file is in place
+	if err := os.Remove(s.logPath(c.Info.Name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	c.logged = 0
+	return nil
+}
+
+// change appends change to the log of c, then makes it. The log is compacted
+// into the collection's file once it holds as many documents as the
+// collection. The collection's lock must already be held.
+func (s *collectionStore) change(c *collection, change collectionChange) error {
+	bts, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.logPath(c.Info.Name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Write(append(bts, '\n')); err != nil {
+		// drop what was written of the change so that later changes aren't
+		// appended to it
+		f.Truncate(fi.Size())
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	c.apply(change)
+	if c.logged >= max(len(c.Documents), minCollectionLog) {
+		if err := s.save(c); err != nil {
+			// the log still has every change, so saving can wait for the
+			// next one
+			slog.Warn("failed to compact collection", "name", c.Info.Name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// collection looks up the named collection and takes its lock, for reading
+// only if read is set
+func (s *collectionStore) collection(name string, read bool) (*collection, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	c, ok := s.collections[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errCollectionNotFound
+	}
+
+	if read {
+		c.mu.RLock()
+	} else {
+		c.mu.Lock()
+	}
+
+	if c.deleted {
+		if read {
+			c.mu.RUnlock()
+		} else {
+			c.mu.Unlock()
+		}
+		return nil, errCollectionNotFound
+	}
+
+	return c, nil
+}
+
+func (s *collectionStore) create(req api.CreateCollectionRequest) (*api.Collection, error) {
+	if !validCollectionName.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: name %q must be letters, digits, '_', '.' and '-'", errInvalidCollection, req.Name)
+	}
+
+	metric := cmp.Or(req.Metric, api.MetricCosine)
+	if metric != api.MetricCosine && metric != api.MetricDot {
+		return nil, fmt.Errorf("%w: unknown metric %q", errInvalidCollection, req.Metric)
+	}
+
+	if req.Model != "" && !model.ParseName(req.Model).IsValid() {
+		return nil, fmt.Errorf("%w: model %q is invalid", errInvalidCollection, req.Model)
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.collections[req.Name]; ok {
+		return nil, errCollectionExists
+	}
+
+	now := time.Now().UTC()
+	c := &collection{
+		Info: api.Collection{
+			Name:       req.Name,
+			Model:      req.Model,
+			Metric:     metric,
+			CreatedAt:  now,
+			ModifiedAt: now,
+		},
+		Documents: []api.Document{},
+		index:     make(map[string]int),
+	}
+
+	if err := s.save(c); err != nil {
+		return nil, err
+	}
+
+	s.collections[c.Info.Name] = c
+	info := c.Info
+	return &info, nil
+}
+
+func (s *collectionStore) get(name string) (*api.Collection, error) {
+	c, err := s.collection(name, true)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.RUnlock()
+
+	info := c.Info
+	return &info, nil
+}
+
+func (s *collectionStore) list() ([]api.Collection, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	cs := slices.Collect(maps.Values(s.collections))
+	s.mu.RUnlock()
+
+	collections := make([]api.Collection, 0, len(cs))
+	for _, c := range cs {
+		c.mu.RLock()
+		if !c.deleted {
+			collections = append(collections, c.Info)
+		}
+		c.mu.RUnlock()
+	}
+
+	slices.SortFunc(collections, func(a, b api.Collection) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return collections, nil
+}
+
+func (s *collectionStore) delete(name string) error {
+	c, err := s.collection(name, false)
+	if err != nil {
+		return err
+	}
+	defer c.mu.Unlock()
+
+	for _, path := range []string{s.path(name), s.logPath(name)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	c.deleted = true
+
+	s.mu.Lock()
+	delete(s.collections, name)
+	s.mu.Unlock()
+	return nil
+}
+
+// upsert adds docs to the collection, replacing documents with the same IDs.
+// Every document must have an embedding.
+func (s *collectionStore) upsert(name string, docs []api.Document) (*api.Collection, error) {
+	c, err := s.collection(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+
+	dims := c.Info.Dimensions
+	for _, doc := range docs {
+		if dims == 0 {
+			dims = len(doc.Embedding)
+		}
+
+		if len(doc.Embedding) != dims {
+			return nil, fmt.Errorf("%w: document %q has %d dimensions, expected %d", errInvalidCollection, doc.ID, len(doc.Embedding), dims)
+		}
+	}
+
+	change := collectionChange{Info: c.Info, Documents: docs}
+	change.Info.Dimensions = dims
+	change.Info.ModifiedAt = time.Now().UTC()
+	if err := s.change(c, change); err != nil {
+		return nil, err
+	}
+
+	info := c.Info
+	return &info, nil
+}
+
+func (s *collectionStore) deleteDocuments(name string, ids []string) (*api.Collection, error) {
+	c, err := s.collection(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+
+	// only log the documents which are in the collection
+	ids = slices.DeleteFunc(slices.Clone(ids), func(id string) bool {
+		_, ok := c.index[id]
+		return !ok
+	})
+
+	change := collectionChange{Info: c.Info, Deleted: ids}
+	change.Info.ModifiedAt = time.Now().UTC()
+	if err := s.change(c, change); err != nil {
+		return nil, err
+	}
+
+	info := c.Info
+	return &info, nil
+}
+
+// query returns the k documents of the collection which are most similar to
+// embedding and match filter
+func (s *collectionStore) query(name string, embedding []float32, k int, filter map[string]any) ([]api.QueryResult, error) {
+	c, err := s.collection(name, true)
+	if err != nil {
+		return nil, err
+	}
+	defer c.mu.RUnlock()
+
+	if c.Info.Dimensions > 0 && len(embedding) != c.Info.Dimensions {
+		return nil, fmt.Errorf("%w: query has %d dimensions, expected %d", errInvalidCollection, len(embedding), c.Info.Dimensions)
+	}
+
+	results := make([]api.QueryResult, 0, min(k, len(c.Documents)))
+	for _, doc := range c.Documents {
+		if !matchesFilter(doc.Metadata, filter) {
+			continue
+		}
+
+		score := dot(embedding, doc.Embedding)
+		if c.Info.Metric == api.MetricCosine {
+			if norms := norm(embedding) * norm(doc.Embedding); norms > 0 {
+				score /= norms
+			} else {
+				score = 0
+			}
+		}
+
+		doc.Embedding = nil
+		results = append(results, api.QueryResult{Document: doc, Score: score})
+	}
+
+	slices.SortStableFunc(results, func(a, b api.QueryResult) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+
+	return results[:min(k, len(results))], nil
+}
+
+func matchesFilter(metadata, filter map[string]any) bool {
+	for k, v := range filter {
+		if mv, ok := metadata[k]; !ok || !reflect.DeepEqual(mv, v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func norm(vec []float32) float32 {
+	return float32(math.Sqrt(float64(dot(vec, vec))))
+}
+
+func collectionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidCollection):
+		return http.StatusBadRequest
+	case errors.Is(err, errCollectionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errCollectionExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// embedDocuments computes the embeddings of the given texts with the model
+// of the collection. Errors are written to c, in which case ok is false.
+func (s *Server) embedDocuments(c *gin.Context, info *api.Collection, texts []string, keepAlive *api.Duration, priority string) (embeddings [][]float32, ok bool) {
+	if info.Model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("collection %q has no model to embed text with", info.Name)})
+		return nil, false
+	}
+
+	resp, ok := s.embed(c, api.EmbedRequest{Model: info.Model, KeepAlive: keepAlive, Priority: priority}, texts)
+	if !ok {
+		return nil, false
+	}
+
+	return resp.Embeddings, true
+}
+
+func (s *Server) CreateCollectionHandler(c *gin.Context) {
+	var req api.CreateCollectionRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := s.collections.create(req)
+	if err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (s *Server) ListCollectionsHandler(c *gin.Context) {
+	collections, err := s.collections.list()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ListCollectionsResponse{Collections: collections})
+}
+
+func (s *Server) CollectionHandler(c *gin.Context) {
+	info, err := s.collections.get(c.Param("name"))
+	if err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (s *Server) DeleteCollectionHandler(c *gin.Context) {
+	if err := s.collections.delete(c.Param("name")); err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (s *Server) UpsertDocumentsHandler(c *gin.Context) {
+	var req api.UpsertDocumentsRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := s.collections.get(c.Param("name"))
+	if err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var missing []int
+	var texts []string
+	for i, doc := range req.Documents {
+		if doc.ID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "documents must have an id"})
+			return
+		}
+
+		if len(doc.Embedding) == 0 {
+			if doc.Text == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("document %q has neither text nor an embedding", doc.ID)})
+				return
+			}
+
+			missing = append(missing, i)
+			texts = append(texts, doc.Text)
+		}
+	}
+
+	if len(texts) > 0 {
+		embeddings, ok := s.embedDocuments(c, info, texts, req.KeepAlive, req.Priority)
+		if !ok {
+			return
+		}
+
+		for j, i := range missing {
+			req.Documents[i].Embedding = embeddings[j]
+		}
+	}
+
+	info, err = s.collections.upsert(info.Name, req.Documents)
+	if err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (s *Server) DeleteDocumentsHandler(c *gin.Context) {
+	var req api.DeleteDocumentsRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := s.collections.deleteDocuments(c.Param("name"), req.IDs)
+	if err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (s *Server) QueryCollectionHandler(c *gin.Context) {
+	var req api.QueryRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.K < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "k must not be negative"})
+		return
+	}
+
+	info, err := s.collections.get(c.Param("name"))
+	if err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	embedding := req.Embedding
+	if len(embedding) == 0 {
+		if req.Text == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "query needs text or an embedding"})
+			return
+		}
+
+		embeddings, ok := s.embedDocuments(c, info, []string{req.Text}, req.KeepAlive, req.Priority)
+		if !ok {
+			return
+		}
+
+		embedding = embeddings[0]
+	}
+
+	results, err := s.collections.query(info.Name, embedding, cmp.Or(req.K, defaultQueryK), req.Filter)
+	if err != nil {
+		c.JSON(collectionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.QueryResponse{Results: results})
+}
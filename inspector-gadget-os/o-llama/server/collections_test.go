@@ -0,0 +1,300 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestCollections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir := filepath.Join(t.TempDir(), "collections")
+	s := Server{collections: newCollectionStore(dir)}
+
+	w := createRequest(t, s.CreateCollectionHandler, api.CreateCollectionRequest{Name: "notes"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, tt := range []struct {
+		req  api.CreateCollectionRequest
+		code int
+	}{
+		{api.CreateCollectionRequest{Name: "notes"}, http.StatusConflict},
+		{api.CreateCollectionRequest{Name: "../notes"}, http.StatusBadRequest},
+		{api.CreateCollectionRequest{Name: "other", Metric: "l2"}, http.StatusBadRequest},
+	} {
+		if w := createRequest(t, s.CreateCollectionHandler, tt.req); w.Code != tt.code {
+			t.Errorf("expected status code %d for %+v, actual %d", tt.code, tt.req, w.Code)
+		}
+	}
+
+	collectionRequest := func(fn gin.HandlerFunc, name string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return createRequest(t, func(c *gin.Context) {
+			c.Params = gin.Params{{Key: "name", Value: name}}
+			fn(c)
+		}, body)
+	}
+
+	w = collectionRequest(s.UpsertDocumentsHandler, "notes", api.UpsertDocumentsRequest{
+		Documents: []api.Document{
+			{ID: "a", Text: "north", Embedding: []float32{1, 0}, Metadata: map[string]any{"path": "/home/a.md"}},
+			{ID: "b", Text: "east", Embedding: []float32{0, 2}, Metadata: map[string]any{"path": "/home/b.md"}},
+			{ID: "c", Text: "north east", Embedding: []float32{3, 3}, Metadata: map[string]any{"path": "/workspace/c.md"}},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	var info api.Collection
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Documents != 3 || info.Dimensions != 2 || info.Metric != api.MetricCosine {
+		t.Errorf("unexpected collection %+v", info)
+	}
+
+	for name, req := range map[string]api.UpsertDocumentsRequest{
+		"dimensions": {Documents: []api.Document{{ID: "d", Embedding: []float32{1, 2, 3}}}},
+		"no model":   {Documents: []api.Document{{ID: "d", Text: "south"}}},
+		"no id":      {Documents: []api.Document{{Embedding: []float32{1, 2}}}},
+	} {
+		if w := collectionRequest(s.UpsertDocumentsHandler, "notes", req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code 400, actual %d", name, w.Code)
+		}
+	}
+
+	query := func(name string, req api.QueryRequest) []string {
+		t.Helper()
+		w := collectionRequest(s.QueryCollectionHandler, name, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.QueryResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, r := range resp.Results {
+			if r.Embedding != nil || r.Text == "" {
+				t.Errorf("unexpected result %+v", r)
+			}
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	if ids := query("notes", api.QueryRequest{Embedding: []float32{1, 0.1}}); !slices.Equal(ids, []string{"a", "c", "b"}) {
+		t.Errorf("unexpected cosine results %v", ids)
+	}
+
+	if ids := query("notes", api.QueryRequest{Embedding: []float32{1, 0.1}, K: 1}); !slices.Equal(ids, []string{"a"}) {
+		t.Errorf("unexpected results %v", ids)
+	}
+
+	if ids := query("notes", api.QueryRequest{Embedding: []float32{1, 0.1}, Filter: map[string]any{"path": "/home/b.md"}}); !slices.Equal(ids, []string{"b"}) {
+		t.Errorf("unexpected filtered results %v", ids)
+	}
+
+	if w := collectionRequest(s.QueryCollectionHandler, "notes", api.QueryRequest{Embedding: []float32{1}}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code 400, actual %d", w.Code)
+	}
+
+	if w := collectionRequest(s.QueryCollectionHandler, "missing", api.QueryRequest{Embedding: []float32{1, 0}}); w.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.CreateCollectionHandler, api.CreateCollectionRequest{Name: "scores", Metric: api.MetricDot})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = collectionRequest(s.UpsertDocumentsHandler, "scores", api.UpsertDocumentsRequest{
+		Documents: []api.Document{
+			{ID: "a", Text: "north", Embedding: []float32{1, 0}},
+			{ID: "c", Text: "north east", Embedding: []float32{3, 3}},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	if ids := query("scores", api.QueryRequest{Embedding: []float32{1, 0.1}}); !slices.Equal(ids, []string{"c", "a"}) {
+		t.Errorf("unexpected dot results %v", ids)
+	}
+
+	// replace a and remove b
+	w = collectionRequest(s.UpsertDocumentsHandler, "notes", api.UpsertDocumentsRequest{
+		Documents: []api.Document{{ID: "a", Text: "south", Embedding: []float32{-1, 0}}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = collectionRequest(s.DeleteDocumentsHandler, "notes", api.DeleteDocumentsRequest{IDs: []string{"b", "missing"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	// collections are loaded again from disk
+	s = Server{collections: newCollectionStore(dir)}
+
+	w = createRequest(t, s.ListCollectionsHandler, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var list api.ListCollectionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.Collections) != 2 || list.Collections[0].Name != "notes" || list.Collections[0].Documents != 2 || list.Collections[1].Name != "scores" {
+		t.Fatalf("unexpected collections %+v", list.Collections)
+	}
+
+	if ids := query("notes", api.QueryRequest{Embedding: []float32{1, 0.1}}); !slices.Equal(ids, []string{"c", "a"}) {
+		t.Errorf("unexpected results after reload %v", ids)
+	}
+
+	if w := collectionRequest(s.DeleteCollectionHandler, "scores", nil); w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	checkFileExists(t, filepath.Join(dir, "*"), []string{filepath.Join(dir, "notes.json")})
+
+	if w := collectionRequest(s.CollectionHandler, "scores", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404, actual %d", w.Code)
+	}
+}
+
+func TestCollectionsLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "collections")
+	s := newCollectionStore(dir)
+
+	if _, err := s.create(api.CreateCollectionRequest{Name: "notes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dir, "notes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.upsert("notes", []api.Document{
+		{ID: "a", Embedding: []float32{1, 0}},
+		{ID: "b", Embedding: []float32{0, 1}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.deleteDocuments("notes", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes are appended to the log rather than rewriting the collection
+	if bts, err := os.ReadFile(filepath.Join(dir, "notes.json")); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(bts, saved) {
+		t.Errorf("expected the collection's file to be unchanged, got %s", bts)
+	}
+
+	// a change cut short while it was appended is ignored
+	f, err := os.OpenFile(filepath.Join(dir, "notes.log"), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"collection":{"name":"notes"},"documents":[{"id":"c"`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s = newCollectionStore(dir)
+	info, err := s.get("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Documents != 1 || info.Dimensions != 2 {
+		t.Errorf("unexpected collection after reload %+v", info)
+	}
+
+	results, err := s.query("notes", []float32{1, 0}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].ID != "b" {
+		t.Errorf("unexpected results after reload %+v", results)
+	}
+
+	// the log is compacted into the collection's file when it's loaded
+	checkFileExists(t, filepath.Join(dir, "*"), []string{filepath.Join(dir, "notes.json")})
+
+	// and once it holds as many documents as the collection
+	for i := range minCollectionLog {
+		if _, err := s.upsert("notes", []api.Document{{ID: "b", Embedding: []float32{float32(i), 1}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkFileExists(t, filepath.Join(dir, "*"), []string{filepath.Join(dir, "notes.json")})
+}
+
+func TestCollectionsConcurrentUpsert(t *testing.T) {
+	s := newCollectionStore(filepath.Join(t.TempDir(), "collections"))
+
+	names := []string{"a", "b"}
+	for _, name := range names {
+		if _, err := s.create(api.CreateCollectionRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range 16 {
+		for _, name := range names {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := s.upsert(name, []api.Document{{ID: strconv.Itoa(i), Embedding: []float32{1, 0}}}); err != nil {
+					t.Error(err)
+				}
+
+				if _, err := s.query(name, []float32{1, 0}, 1, nil); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	s = newCollectionStore(s.dir)
+	for _, name := range names {
+		info, err := s.get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Documents != 16 {
+			t.Errorf("expected 16 documents in %s, got %d", name, info.Documents)
+		}
+	}
+}
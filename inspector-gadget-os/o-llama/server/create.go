@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
@@ -24,6 +25,8 @@ import (
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/fs/imatrix"
+	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/template"
 	"github.com/ollama/ollama/types/errtypes"
 	"github.com/ollama/ollama/types/model"
@@ -36,8 +39,13 @@ var (
 	errUnknownType             = errors.New("unknown type")
 	errNeitherFromOrFiles      = errors.New("neither 'from' or 'files' was specified")
 	errFilePath                = errors.New("file path must be relative")
+	errDraftVocab              = errors.New("draft model vocabulary does not match")
 )
 
+// maxDraftVocabDifference is how many more tokens the main or draft model
+// may have than the other, as checked by the runner
+const maxDraftVocabDifference = 128
+
 func (s *Server) CreateHandler(c *gin.Context) {
 	var r api.CreateRequest
 	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
@@ -55,6 +63,11 @@ func (s *Server) CreateHandler(c *gin.Context) {
 		}
 	}
 
+	if (r.Imatrix != "" || r.DryRun) && cmp.Or(r.Quantize, r.Quantization) == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "imatrix and dry_run require quantize"})
+		return
+	}
+
 	name := model.ParseName(cmp.Or(r.Model, r.Name))
 	if !name.IsValid() {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errtypes.InvalidModelNameErrMsg})
@@ -74,6 +87,10 @@ func (s *Server) CreateHandler(c *gin.Context) {
 			ch <- resp
 		}
 
+		blobsMu.RLock()
+		unlock := sync.OnceFunc(blobsMu.RUnlock)
+		defer unlock()
+
 		oldManifest, _ := ParseNamedManifest(name)
 
 		var baseLayers []*layerGGML
@@ -128,18 +145,38 @@ func (s *Server) CreateHandler(c *gin.Context) {
 			baseLayers = append(baseLayers, adapterLayers...)
 		}
 
-		if err := createModel(r, name, baseLayers, fn); err != nil {
-			if errors.Is(err, errBadTemplate) {
+		if r.DryRun {
+			plan, err := planQuantization(r, baseLayers)
+			if err != nil {
 				ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
 				return
 			}
+
+			ch <- api.ProgressResponse{Status: "success", Quantization: plan}
+			return
+		}
+
+		if err := createModel(r, name, baseLayers, fn); err != nil {
+			for _, badReq := range []error{errBadTemplate, errDraftModel, errDraftVocab} {
+				if errors.Is(err, badReq) {
+					ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
+					return
+				}
+			}
 			ch <- gin.H{"error": err.Error()}
 			return
 		}
 
+		unlock()
 		if !envconfig.NoPrune() && oldManifest != nil {
-			if err := oldManifest.RemoveLayers(); err != nil {
-				ch <- gin.H{"error": err.Error()}
+			if !blobsMu.TryLock() {
+				slog.Info("skipping removal of unused layers while a pull, create or import is in progress")
+			} else {
+				err := oldManifest.RemoveLayers()
+				blobsMu.Unlock()
+				if err != nil {
+					ch <- gin.H{"error": err.Error()}
+				}
 			}
 		}
 
@@ -325,25 +362,22 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 		},
 	}
 
+	im, err := loadImatrix(r.Imatrix)
+	if err != nil {
+		return err
+	}
+
 	var layers []Layer
 	for _, layer := range baseLayers {
 		if layer.GGML != nil {
 			quantType := strings.ToUpper(cmp.Or(r.Quantize, r.Quantization))
-			if quantType != "" && layer.GGML.Name() == "gguf" && layer.MediaType == "application/vnd.ollama.image.model" {
-				want, err := ggml.ParseFileType(quantType)
+			if ok, err := needsQuantization(layer, quantType); err != nil {
+				return err
+			} else if ok {
+				layer, err = quantizeLayer(layer, quantType, im, fn)
 				if err != nil {
 					return err
 				}
-
-				ft := layer.GGML.KV().FileType()
-				if !slices.Contains([]string{"F16", "F32"}, ft.String()) {
-					return errors.New("quantization is only supported for F16 and F32 models")
-				} else if ft != want {
-					layer, err = quantizeLayer(layer, quantType, fn)
-					if err != nil {
-						return err
-					}
-				}
 			}
 			config.ModelFormat = cmp.Or(config.ModelFormat, layer.GGML.Name())
 			config.ModelFamily = cmp.Or(config.ModelFamily, layer.GGML.KV().Architecture())
@@ -394,6 +428,12 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 		}
 	}
 
+	if draft, ok := r.Parameters["draft_model"].(string); ok && draft != "" {
+		if err := checkDraftModel(draft, baseLayers); err != nil {
+			return err
+		}
+	}
+
 	layers, err = setParameters(layers, r.Parameters)
 	if err != nil {
 		return err
@@ -404,6 +444,11 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 		return err
 	}
 
+	layers, err = setTools(layers, r.Tools)
+	if err != nil {
+		return err
+	}
+
 	configLayer, err := createConfigLayer(layers, config)
 	if err != nil {
 		return err
@@ -423,7 +468,128 @@ func createModel(r api.CreateRequest, name model.Name, baseLayers []*layerGGML,
 	return nil
 }
 
-func quantizeLayer(layer *layerGGML, quantizeType string, fn func(resp api.ProgressResponse)) (*layerGGML, error) {
+// checkDraftModel checks that the draft model exists and shares the
+// vocabulary of the model being created, so that the runner can verify its
+// drafted tokens with the main model
+func checkDraftModel(name string, baseLayers []*layerGGML) error {
+	draft, err := GetModel(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errDraftModel, name)
+	}
+
+	var main *ggml.GGML
+	for _, layer := range baseLayers {
+		if layer.GGML != nil && layer.MediaType == "application/vnd.ollama.image.model" {
+			main = layer.GGML
+			break
+		}
+	}
+	if main == nil {
+		// adapters and projectors only; the vocabulary is the base model's
+		return nil
+	}
+
+	f, err := llm.LoadModel(draft.ModelPath, -1)
+	if err != nil {
+		return err
+	}
+
+	mkv, dkv := main.KV(), f.KV()
+	if mkv.String("tokenizer.ggml.model") != dkv.String("tokenizer.ggml.model") {
+		return fmt.Errorf("%w: %s uses a %q tokenizer, not %q", errDraftVocab, name, dkv.String("tokenizer.ggml.model"), mkv.String("tokenizer.ggml.model"))
+	}
+
+	mtokens, dtokens := mkv.Strings("tokenizer.ggml.tokens"), dkv.Strings("tokenizer.ggml.tokens")
+	if diff := len(mtokens) - len(dtokens); diff > maxDraftVocabDifference || -diff > maxDraftVocabDifference {
+		return fmt.Errorf("%w: %s has %d tokens, not about %d", errDraftVocab, name, len(dtokens), len(mtokens))
+	}
+
+	for _, key := range []string{"tokenizer.ggml.bos_token_id", "tokenizer.ggml.eos_token_id"} {
+		if mkv.Uint(key) != dkv.Uint(key) {
+			return fmt.Errorf("%w: %s has different special tokens", errDraftVocab, name)
+		}
+	}
+
+	for i := range min(len(mtokens), len(dtokens)) {
+		if mtokens[i] != dtokens[i] {
+			return fmt.Errorf("%w: %s token %d is %q, not %q", errDraftVocab, name, i, dtokens[i], mtokens[i])
+		}
+	}
+
+	return nil
+}
+
+// needsQuantization reports whether layer is model weights to be quantized to
+// quantType
+func needsQuantization(layer *layerGGML, quantType string) (bool, error) {
+	if quantType == "" || layer.GGML.Name() != "gguf" || layer.MediaType != "application/vnd.ollama.image.model" {
+		return false, nil
+	}
+
+	want, err := ggml.ParseFileType(quantType)
+	if err != nil {
+		return false, err
+	}
+
+	ft := layer.GGML.KV().FileType()
+	if !slices.Contains([]string{"F16", "F32"}, ft.String()) {
+		return false, errors.New("quantization is only supported for F16 and F32 models")
+	}
+
+	return ft != want, nil
+}
+
+// planQuantization describes how the model of a create request would be
+// quantized, without quantizing it
+func planQuantization(r api.CreateRequest, baseLayers []*layerGGML) (*api.QuantizationPlan, error) {
+	im, err := loadImatrix(r.Imatrix)
+	if err != nil {
+		return nil, err
+	}
+
+	quantType := strings.ToUpper(cmp.Or(r.Quantize, r.Quantization))
+	for _, layer := range baseLayers {
+		if layer.GGML == nil {
+			continue
+		}
+
+		if ok, err := needsQuantization(layer, quantType); err != nil {
+			return nil, err
+		} else if ok {
+			ftype, err := ggml.ParseFileType(quantType)
+			if err != nil {
+				return nil, err
+			}
+
+			return quantizationPlan(layer.GGML, ftype, im)
+		}
+	}
+
+	return nil, fmt.Errorf("no model weights to quantize to %s", quantType)
+}
+
+// loadImatrix reads the importance matrix blob with digest, if any
+func loadImatrix(digest string) (*imatrix.Matrix, error) {
+	if digest == "" {
+		return nil, nil
+	}
+
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	im, err := imatrix.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("importance matrix %s not found", digest)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return im, nil
+}
+
+func quantizeLayer(layer *layerGGML, quantizeType string, im *imatrix.Matrix, fn func(resp api.ProgressResponse)) (*layerGGML, error) {
 	ft := layer.GGML.KV().FileType()
 	var doneBytes atomic.Uint64
 	totalBytes := uint64(layer.Size) - layer.GGML.Tensors().Offset
@@ -454,7 +620,7 @@ func quantizeLayer(layer *layerGGML, quantizeType string, fn func(resp api.Progr
 	defer temp.Close()
 	defer os.Remove(temp.Name())
 
-	if err := quantize(fp, temp, layer.GGML, ftype, fnWrap); err != nil {
+	if err := quantize(fp, temp, layer.GGML, ftype, im, fnWrap); err != nil {
 		return nil, err
 	}
 	temp.Seek(0, io.SeekStart)
@@ -654,6 +820,25 @@ func setMessages(layers []Layer, m []api.Message) ([]Layer, error) {
 	return layers, nil
 }
 
+func setTools(layers []Layer, tools []api.Tool) ([]Layer, error) {
+	// like messages, tools of the base model are kept unless replaced
+	if len(tools) == 0 {
+		return layers, nil
+	}
+
+	layers = removeLayer(layers, "application/vnd.ollama.image.tools")
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(tools); err != nil {
+		return nil, err
+	}
+	layer, err := NewLayer(&b, "application/vnd.ollama.image.tools")
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, layer)
+	return layers, nil
+}
+
 func createConfigLayer(layers []Layer, config ConfigV2) (*Layer, error) {
 	digests := make([]string, len(layers))
 	for i, layer := range layers {
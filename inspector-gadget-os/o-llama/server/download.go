@@ -260,10 +260,15 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 				continue
 			}
 			defer resp.Body.Close()
-			if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusOK {
+			switch resp.StatusCode {
+			case http.StatusTemporaryRedirect:
+				return resp.Location()
+			case http.StatusOK:
+				// served directly, e.g. by a registry mirror
+				return resp.Request.URL, nil
+			default:
 				return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
 			}
-			return resp.Location()
 		}
 	}()
 	if err != nil {
@@ -456,10 +461,13 @@ func (b *blobDownload) Wait(ctx context.Context, fn func(api.ProgressResponse))
 }
 
 type downloadOpts struct {
-	mp      ModelPath
-	digest  string
-	regOpts *registryOptions
-	fn      func(api.ProgressResponse)
+	mp ModelPath
+	// repository is the URL of the repository to download from, if not
+	// the registry of mp
+	repository *url.URL
+	digest     string
+	regOpts    *registryOptions
+	fn         func(api.ProgressResponse)
 }
 
 // downloadBlob downloads a blob from the registry and stores it in the blobs directory
@@ -492,8 +500,12 @@ func downloadBlob(ctx context.Context, opts downloadOpts) (cacheHit bool, _ erro
 	data, ok := blobDownloadManager.LoadOrStore(opts.digest, &blobDownload{Name: fp, Digest: opts.digest})
 	download := data.(*blobDownload)
 	if !ok {
-		requestURL := opts.mp.BaseURL()
-		requestURL = requestURL.JoinPath("v2", opts.mp.GetNamespaceRepository(), "blobs", opts.digest)
+		repository := opts.repository
+		if repository == nil {
+			repository = opts.mp.BaseURL().JoinPath("v2", opts.mp.GetNamespaceRepository())
+		}
+
+		requestURL := repository.JoinPath("blobs", opts.digest)
 		if err := download.Prepare(ctx, requestURL, opts.regOpts); err != nil {
 			blobDownloadManager.Delete(opts.digest)
 			return false, err
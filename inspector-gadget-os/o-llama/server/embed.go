@@ -0,0 +1,283 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+const (
+	// embedBatchWindow is how long an embedding request waits for others to
+	// the same runner so that they are sent to it together
+	embedBatchWindow = 5 * time.Millisecond
+
+	// maxEmbedBatch is the most inputs sent to a runner at once
+	maxEmbedBatch = 64
+)
+
+// embed computes normalized embeddings of input with the model of req,
+// truncating inputs longer than the context if req allows it. Errors are
+// written to c, in which case ok is false.
+func (s *Server) embed(c *gin.Context, req api.EmbedRequest, input []string) (resp *api.EmbedResponse, ok bool) {
+	checkpointStart := time.Now()
+
+	truncate := true
+	if req.Truncate != nil && !*req.Truncate {
+		truncate = false
+	}
+
+	name, err := getExistingName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return nil, false
+	}
+
+	ctx, err := withQueueInfo(c, req.Priority, priorityBatch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	r, m, opts, err := s.scheduleRunner(ctx, name.String(), []model.Capability{}, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return nil, false
+	}
+
+	checkpointLoaded := time.Now()
+
+	if len(input) == 0 {
+		return &api.EmbedResponse{Model: req.Model, Embeddings: [][]float32{}}, true
+	}
+
+	kvData, _, err := getModelData(m.ModelPath, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	var count int
+	input = append([]string(nil), input...)
+	for i, text := range input {
+		tokens, err := r.Tokenize(c.Request.Context(), text)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+
+		ctxLen := min(opts.NumCtx, int(kvData.ContextLength()))
+		if len(tokens) > ctxLen {
+			if !truncate {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "input length exceeds maximum context length"})
+				return nil, false
+			}
+
+			tokens = tokens[:ctxLen]
+			text, err = r.Detokenize(c.Request.Context(), tokens)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return nil, false
+			}
+		}
+
+		count += len(tokens)
+
+		input[i] = text
+	}
+
+	// embeddings depend only on the weights of the model and the input
+	digest := filepath.Base(m.ModelPath)
+
+	embeddings := make([][]float32, len(input))
+	var missing []int
+	var texts []string
+	for i, text := range input {
+		if embedding, ok := s.embedCache.get(digest, text); ok {
+			embeddings[i] = embedding
+			continue
+		}
+
+		missing = append(missing, i)
+		texts = append(texts, text)
+	}
+
+	if len(texts) > 0 {
+		computed, err := s.embeds.embed(c.Request.Context(), r, texts)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+			return nil, false
+		}
+
+		for j, i := range missing {
+			embeddings[i] = normalize(computed[j])
+			s.embedCache.put(digest, texts[j], embeddings[i])
+		}
+	}
+
+	return &api.EmbedResponse{
+		Model:           req.Model,
+		Embeddings:      embeddings,
+		TotalDuration:   time.Since(checkpointStart),
+		LoadDuration:    checkpointLoaded.Sub(checkpointStart),
+		PromptEvalCount: count,
+	}, true
+}
+
+// embedBatch is the inputs of concurrent requests to a runner which are
+// embedded together
+type embedBatch struct {
+	inputs []string
+	done   chan struct{}
+
+	// schedule is that of the most urgent request in the batch
+	schedule llm.Schedule
+
+	embeddings [][]float32
+	err        error
+}
+
+// embedBatcher combines embedding requests which arrive at about the same time
+// for the same runner into one call to it
+type embedBatcher struct {
+	mu      sync.Mutex
+	pending map[llm.LlamaServer]*embedBatch
+}
+
+func newEmbedBatcher() *embedBatcher {
+	return &embedBatcher{pending: make(map[llm.LlamaServer]*embedBatch)}
+}
+
+// embed returns the embeddings of inputs from r. A nil batcher calls r
+// directly.
+func (b *embedBatcher) embed(ctx context.Context, r llm.LlamaServer, inputs []string) ([][]float32, error) {
+	if b == nil {
+		return r.Embeddings(ctx, inputs)
+	}
+
+	b.mu.Lock()
+	batch, ok := b.pending[r]
+	if !ok || len(batch.inputs)+len(inputs) > maxEmbedBatch {
+		batch = &embedBatch{done: make(chan struct{}), schedule: llm.ScheduleFrom(ctx)}
+		b.pending[r] = batch
+		time.AfterFunc(embedBatchWindow, func() { b.run(r, batch) })
+	} else if sched := llm.ScheduleFrom(ctx); sched.Priority < batch.schedule.Priority {
+		batch.schedule = sched
+	}
+
+	offset := len(batch.inputs)
+	batch.inputs = append(batch.inputs, inputs...)
+	b.mu.Unlock()
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if batch.err != nil {
+		return nil, batch.err
+	}
+
+	return batch.embeddings[offset : offset+len(inputs)], nil
+}
+
+func (b *embedBatcher) run(r llm.LlamaServer, batch *embedBatch) {
+	b.mu.Lock()
+	if b.pending[r] == batch {
+		delete(b.pending, r)
+	}
+	b.mu.Unlock()
+
+	defer close(batch.done)
+
+	// the batch is shared by requests which may be canceled independently,
+	// so it isn't canceled by any of them
+	ctx := llm.WithSchedule(context.Background(), batch.schedule)
+	batch.embeddings, batch.err = r.Embeddings(ctx, batch.inputs)
+}
+
+// embedCache keeps the most recently used embeddings, keyed by the hash of
+// the model and input
+type embedCache struct {
+	size int
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type embedCacheEntry struct {
+	key       [sha256.Size]byte
+	embedding []float32
+}
+
+// newEmbedCache returns a cache of size embeddings, or nil if size is zero
+func newEmbedCache(size int) *embedCache {
+	if size <= 0 {
+		return nil
+	}
+
+	return &embedCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+func embedCacheKey(digest, input string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(digest + "\x00" + input))
+}
+
+// get returns the cached embedding of input. Embeddings are shared, so they
+// must not be modified.
+func (c *embedCache) get(digest, input string) ([]float32, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[embedCacheKey(digest, input)]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	return e.Value.(*embedCacheEntry).embedding, true
+}
+
+func (c *embedCache) put(digest, input string, embedding []float32) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := embedCacheKey(digest, input)
+	if e, ok := c.entries[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*embedCacheEntry).embedding = embedding
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&embedCacheEntry{key: key, embedding: embedding})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.entries, e.Value.(*embedCacheEntry).key)
+	}
+}
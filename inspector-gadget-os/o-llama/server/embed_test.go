@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// embedRunner embeds each input as its length, recording the inputs of each
+// call
+type embedRunner struct {
+	llm.LlamaServer
+
+	mu    sync.Mutex
+	calls [][]string
+}
+
+func (r *embedRunner) Embeddings(_ context.Context, inputs []string) ([][]float32, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, inputs)
+	r.mu.Unlock()
+
+	embeddings := make([][]float32, len(inputs))
+	for i, input := range inputs {
+		embeddings[i] = []float32{float32(len(input))}
+	}
+	return embeddings, nil
+}
+
+func TestEmbedBatcher(t *testing.T) {
+	b := newEmbedBatcher()
+	r := &embedRunner{}
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			input := []string{strconv.Itoa(i * 100), "x"}
+			embeddings, err := b.embed(t.Context(), r, input)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			for j := range input {
+				if embeddings[j][0] != float32(len(input[j])) {
+					t.Errorf("expected embedding of %q, got %v", input[j], embeddings[j])
+				}
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	var inputs int
+	for _, call := range r.calls {
+		inputs += len(call)
+	}
+
+	if inputs != 20 {
+		t.Errorf("expected 20 inputs to be embedded, got %d", inputs)
+	}
+
+	if len(r.calls) >= 10 {
+		t.Errorf("expected concurrent requests to be batched, got %d calls", len(r.calls))
+	}
+
+	t.Run("full", func(t *testing.T) {
+		r := &embedRunner{}
+
+		var wg sync.WaitGroup
+		for _, n := range []int{maxEmbedBatch, 1} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := b.embed(t.Context(), r, make([]string, n)); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(r.calls) != 2 {
+			t.Errorf("expected 2 calls, got %d", len(r.calls))
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		if _, err := b.embed(ctx, &embedRunner{}, []string{"a"}); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context canceled, got %v", err)
+		}
+	})
+}
+
+func TestEmbedCache(t *testing.T) {
+	c := newEmbedCache(2)
+	c.put("sha256-a", "one", []float32{1})
+	c.put("sha256-a", "two", []float32{2})
+
+	if _, ok := c.get("sha256-b", "one"); ok {
+		t.Error("expected embeddings of another model to be missing")
+	}
+
+	// one is now the most recently used, so adding three evicts two
+	if e, ok := c.get("sha256-a", "one"); !ok || !slices.Equal(e, []float32{1}) {
+		t.Errorf("expected cached embedding, got %v", e)
+	}
+
+	c.put("sha256-a", "three", []float32{3})
+
+	if _, ok := c.get("sha256-a", "two"); ok {
+		t.Error("expected least recently used embedding to be evicted")
+	}
+
+	for _, input := range []string{"one", "three"} {
+		if _, ok := c.get("sha256-a", input); !ok {
+			t.Errorf("expected %q to be cached", input)
+		}
+	}
+
+	if c := newEmbedCache(0); c != nil {
+		t.Error("expected a disabled cache")
+	} else if _, ok := c.get("sha256-a", "one"); ok {
+		t.Error("expected a disabled cache to be empty")
+	}
+}
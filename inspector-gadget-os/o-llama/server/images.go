@@ -64,6 +64,7 @@ type Model struct {
 	Digest         string
 	Options        map[string]any
 	Messages       []api.Message
+	Tools          []api.Tool
 
 	Template *template.Template
 }
@@ -200,6 +201,16 @@ func (m *Model) String() string {
 
 	for k, v := range m.Options {
 		switch v := v.(type) {
+		case string:
+			name := k
+			if k == "draft_model" {
+				name = "draft"
+			}
+
+			modelfile.Commands = append(modelfile.Commands, parser.Command{
+				Name: name,
+				Args: v,
+			})
 		case []any:
 			for _, s := range v {
 				modelfile.Commands = append(modelfile.Commands, parser.Command{
@@ -229,6 +240,15 @@ func (m *Model) String() string {
 		})
 	}
 
+	for _, tool := range m.Tools {
+		if bts, err := json.Marshal(tool); err == nil {
+			modelfile.Commands = append(modelfile.Commands, parser.Command{
+				Name: "tools",
+				Args: string(bts),
+			})
+		}
+	}
+
 	return modelfile.String()
 }
 
@@ -279,6 +299,16 @@ func GetModel(name string) (*Model, error) {
 		return nil, err
 	}
 
+	if envconfig.VerifyOnLoad() {
+		if _, err := checkProvenance(mp.GetShortTagname(), manifest); err != nil {
+			return nil, err
+		}
+
+		if err := verifyLayers(manifest); err != nil {
+			return nil, fmt.Errorf("%s: %w", mp.GetShortTagname(), err)
+		}
+	}
+
 	model := &Model{
 		Name:      mp.GetFullTagname(),
 		ShortName: mp.GetShortTagname(),
@@ -360,6 +390,16 @@ func GetModel(name string) (*Model, error) {
 			if err = json.NewDecoder(msgs).Decode(&model.Messages); err != nil {
 				return nil, err
 			}
+		case "application/vnd.ollama.image.tools":
+			tools, err := os.Open(filename)
+			if err != nil {
+				return nil, err
+			}
+			defer tools.Close()
+
+			if err = json.NewDecoder(tools).Decode(&model.Tools); err != nil {
+				return nil, err
+			}
 		case "application/vnd.ollama.image.license":
 			bts, err := os.ReadFile(filename)
 			if err != nil {
@@ -443,6 +483,12 @@ func deleteUnusedLayers(deleteMap map[string]struct{}) error {
 }
 
 func PruneLayers() error {
+	if !blobsMu.TryLock() {
+		slog.Info("skipping pruning of unused layers while a pull, create or import is in progress")
+		return nil
+	}
+	defer blobsMu.Unlock()
+
 	deleteMap := make(map[string]struct{})
 	p, err := GetBlobsPath("")
 	if err != nil {
@@ -533,6 +579,10 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		return err
 	}
 
+	if err := signPushedManifest(ctx, mp, manifest); err != nil {
+		return err
+	}
+
 	var layers []Layer
 	layers = append(layers, manifest.Layers...)
 	if manifest.Config.Digest != "" {
@@ -569,6 +619,37 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 }
 
 func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	deleteMap, err := pullModel(ctx, name, regOpts, fn)
+	if err != nil {
+		return err
+	}
+
+	if !envconfig.NoPrune() && len(deleteMap) > 0 {
+		fn(api.ProgressResponse{Status: "removing unused layers"})
+		if !blobsMu.TryLock() {
+			// they'll be removed by the next prune or gc
+			slog.Info("skipping removal of unused layers while a pull, create or import is in progress")
+		} else {
+			err := deleteUnusedLayers(deleteMap)
+			blobsMu.Unlock()
+			if err != nil {
+				fn(api.ProgressResponse{Status: fmt.Sprintf("couldn't remove unused layers: %v", err)})
+			}
+		}
+	}
+
+	fn(api.ProgressResponse{Status: "success"})
+
+	return nil
+}
+
+// pullModel downloads the layers and writes the manifest of the model,
+// returning the layers of the model's previous manifest that it no longer
+// uses
+func pullModel(ctx context.Context, name string, regOpts *registryOptions, fn func(api.ProgressResponse)) (map[string]struct{}, error) {
+	blobsMu.RLock()
+	defer blobsMu.RUnlock()
+
 	mp := ParseModelPath(name)
 
 	// build deleteMap to prune unused layers
@@ -588,14 +669,38 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	}
 
 	if mp.ProtocolScheme == "http" && !regOpts.Insecure {
-		return errInsecureProtocol
+		return nil, errInsecureProtocol
 	}
 
 	fn(api.ProgressResponse{Status: "pulling manifest"})
 
-	manifest, err = pullModelManifest(ctx, mp, regOpts)
-	if err != nil {
-		return fmt.Errorf("pull model manifest: %s", err)
+	repository := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository())
+
+	manifest = nil
+	if mirror := mirrorURL(mp); mirror != nil {
+		// the mirror is another Ollama server, so it gets no credentials
+		mirrorOpts := &registryOptions{}
+		manifest, err = pullModelManifest(ctx, mirror, mp.Tag, mirrorOpts)
+		if err != nil {
+			slog.Info("couldn't pull from registry mirror, pulling from registry", "mirror", mirror, "error", err)
+			manifest = nil
+		} else {
+			repository, regOpts = mirror, mirrorOpts
+		}
+	}
+
+	if manifest == nil {
+		manifest, err = pullModelManifest(ctx, repository, mp.Tag, regOpts)
+		if err != nil {
+			return nil, fmt.Errorf("pull model manifest: %s", err)
+		}
+	}
+
+	// check the manifest before downloading anything it refers to
+	if warning, err := checkProvenance(mp.GetShortTagname(), manifest); err != nil {
+		return nil, err
+	} else if warning != "" {
+		fn(api.ProgressResponse{Status: warning})
 	}
 
 	var layers []Layer
@@ -607,13 +712,14 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	skipVerify := make(map[string]bool)
 	for _, layer := range layers {
 		cacheHit, err := downloadBlob(ctx, downloadOpts{
-			mp:      mp,
-			digest:  layer.Digest,
-			regOpts: regOpts,
-			fn:      fn,
+			mp:         mp,
+			repository: repository,
+			digest:     layer.Digest,
+			regOpts:    regOpts,
+			fn:         fn,
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 		skipVerify[layer.Digest] = cacheHit
 		delete(deleteMap, layer.Digest)
@@ -630,14 +736,14 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 				// something went wrong, delete the blob
 				fp, err := GetBlobsPath(layer.Digest)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				if err := os.Remove(fp); err != nil {
 					// log this, but return the original error
 					slog.Info(fmt.Sprintf("couldn't remove file with digest mismatch '%s': %v", fp, err))
 				}
 			}
-			return err
+			return nil, err
 		}
 	}
 
@@ -645,37 +751,44 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 
 	manifestJSON, err := json.Marshal(manifest)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fp, err := mp.GetManifestPath()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
-		return err
+		return nil, err
 	}
 
 	err = os.WriteFile(fp, manifestJSON, 0o644)
 	if err != nil {
 		slog.Info(fmt.Sprintf("couldn't write to %s", fp))
-		return err
+		return nil, err
 	}
 
-	if !envconfig.NoPrune() && len(deleteMap) > 0 {
-		fn(api.ProgressResponse{Status: "removing unused layers"})
-		if err := deleteUnusedLayers(deleteMap); err != nil {
-			fn(api.ProgressResponse{Status: fmt.Sprintf("couldn't remove unused layers: %v", err)})
-		}
+	return deleteMap, nil
+}
+
+// mirrorURL returns the URL of mp's repository on the registry mirror, or nil
+// if no mirror is configured. Models of registries other than the default are
+// named by their registry, as well as their namespace and repository.
+func mirrorURL(mp ModelPath) *url.URL {
+	mirror := envconfig.RegistryMirror()
+	if mirror == nil {
+		return nil
 	}
 
-	fn(api.ProgressResponse{Status: "success"})
+	if mp.Registry != DefaultRegistry {
+		return mirror.JoinPath("v2", mp.Registry, mp.GetNamespaceRepository())
+	}
 
-	return nil
+	return mirror.JoinPath("v2", mp.GetNamespaceRepository())
 }
 
-func pullModelManifest(ctx context.Context, mp ModelPath, regOpts *registryOptions) (*Manifest, error) {
-	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
+func pullModelManifest(ctx context.Context, repository *url.URL, tag string, regOpts *registryOptions) (*Manifest, error) {
+	requestURL := repository.JoinPath("manifests", tag)
 
 	headers := make(http.Header)
 	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
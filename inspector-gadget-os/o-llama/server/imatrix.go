@@ -0,0 +1,157 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+// defaultImatrixChunkSize is the number of tokens in each chunk of a
+// calibration text when a request leaves it unset
+const defaultImatrixChunkSize = 512
+
+// ImatrixHandler computes an importance matrix for a model on a runner
+// scheduled like any other and stores it as a blob for [api.CreateRequest]
+func (s *Server) ImatrixHandler(c *gin.Context) {
+	var req api.ImatrixRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Text == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+
+	chunkSize := cmp.Or(req.ChunkSize, defaultImatrixChunkSize)
+	if chunkSize < 2 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("chunk_size must be at least 2, got %d", chunkSize)})
+		return
+	}
+
+	name, err := getExistingName(model.ParseName(req.Model))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	ctx, err := withQueueInfo(c, "", priorityBatch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := GetModel(name.String())
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	opts, err := modelOptions(m, req.Options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// each chunk is processed in one batch with a context of its own on a
+	// runner that collects statistics rather than serving requests
+	opts.NumCtx = chunkSize
+	opts.NumBatch = chunkSize
+	opts.DraftModel = ""
+	opts.ImportanceMatrix = true
+
+	// the runner is only of use for importance matrices, so unload it
+	// when done unless asked to keep it
+	keepAlive := cmp.Or(req.KeepAlive, &api.Duration{})
+
+	runnerCh, errCh := s.sched.GetRunner(ctx, m, opts, keepAlive)
+	var runner *runnerRef
+	select {
+	case runner = <-runnerCh:
+	case err := <-errCh:
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+
+		digest, err := computeImatrix(c.Request.Context(), runner.llama, req, chunkSize, func(resp api.ProgressResponse) {
+			ch <- resp
+		})
+		if err != nil {
+			ch <- gin.H{"error": err.Error()}
+			return
+		}
+
+		ch <- api.ProgressResponse{Status: "success", Digest: digest}
+	}()
+
+	if req.Stream != nil && !*req.Stream {
+		waitForStream(c, ch)
+		return
+	}
+
+	streamResponse(c, ch)
+}
+
+// computeImatrix runs the importance matrix of req on r and returns the
+// digest of the blob it is stored in
+func computeImatrix(ctx context.Context, r llm.LlamaServer, req api.ImatrixRequest, chunkSize int, fn func(api.ProgressResponse)) (string, error) {
+	blobs, err := GetBlobsPath("")
+	if err != nil {
+		return "", err
+	}
+
+	// the runner writes the matrix next to the blobs it's moved in with
+	temp, err := os.CreateTemp(blobs, "sha256-imatrix-")
+	if err != nil {
+		return "", err
+	}
+	temp.Close()
+	defer os.Remove(temp.Name())
+
+	const status = "computing importance matrix"
+	if err := r.Imatrix(ctx, llm.ImatrixRequest{
+		Text:      req.Text,
+		Dataset:   req.Dataset,
+		ChunkSize: chunkSize,
+		Chunks:    req.Chunks,
+		Path:      temp.Name(),
+	}, func(resp llm.ImatrixResponse) {
+		fn(api.ProgressResponse{Status: status, Total: int64(resp.Chunks), Completed: int64(resp.Chunk)})
+	}); err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(temp.Name())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	blobsMu.RLock()
+	defer blobsMu.RUnlock()
+
+	layer, err := NewLayer(f, "application/vnd.ollama.image.imatrix")
+	if err != nil {
+		return "", err
+	}
+
+	return layer.Digest, nil
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/fs/imatrix"
+	"github.com/ollama/ollama/llm"
+)
+
+type imatrixRunner struct {
+	llm.LlamaServer
+
+	req llm.ImatrixRequest
+}
+
+func (r *imatrixRunner) Imatrix(_ context.Context, req llm.ImatrixRequest, fn func(llm.ImatrixResponse)) error {
+	r.req = req
+
+	m := imatrix.New()
+	for i := range 2 {
+		if err := m.Add("blk.0.attn_q.weight", []float32{1, 2}, req.ChunkSize); err != nil {
+			return err
+		}
+		m.ChunkCount++
+		fn(llm.ImatrixResponse{Chunk: i + 1, Chunks: 2})
+	}
+
+	if err := m.WriteFile(req.Path); err != nil {
+		return err
+	}
+
+	fn(llm.ImatrixResponse{Chunk: 2, Chunks: 2, Weights: 1, Done: true})
+	return nil
+}
+
+func TestImatrixHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var loaded api.Options
+	runner := &imatrixRunner{}
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:  make(chan *LlmRequest, 1),
+			finishedReqCh: make(chan *LlmRequest, 1),
+			expiredCh:     make(chan *runnerRef, 1),
+			unloadedCh:    make(chan any, 1),
+			loaded:        make(map[string]*runnerRef),
+			getGpuFn:      discover.GetGPUInfo,
+			getCpuFn:      discover.GetCPUInfo,
+			reschedDelay:  250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ discover.GpuInfoList, _ int) {
+				loaded = req.opts
+				req.successCh <- &runnerRef{llama: runner}
+			},
+		},
+	}
+
+	go s.sched.Run(t.Context())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []*ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test",
+		Files:  map[string]string{"file.gguf": digest},
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Run("missing text", func(t *testing.T) {
+		w := createRequest(t, s.ImatrixHandler, api.ImatrixRequest{Model: "test"})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("missing model", func(t *testing.T) {
+		w := createRequest(t, s.ImatrixHandler, api.ImatrixRequest{Model: "missing", Text: "text"})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("computed on an importance matrix runner", func(t *testing.T) {
+		w := createRequest(t, s.ImatrixHandler, api.ImatrixRequest{
+			Model:     "test",
+			Text:      "calibration text",
+			Dataset:   "calibration.txt",
+			ChunkSize: 64,
+			Stream:    &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		if !loaded.ImportanceMatrix || loaded.NumCtx != 64 || loaded.NumBatch != 64 {
+			t.Errorf("expected an importance matrix runner with a context of 64, got %+v", loaded.Runner)
+		}
+
+		if runner.req.Text != "calibration text" || runner.req.Dataset != "calibration.txt" || runner.req.ChunkSize != 64 {
+			t.Errorf("unexpected runner request %+v", runner.req)
+		}
+
+		var resp api.ProgressResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Status != "success" || resp.Digest == "" {
+			t.Fatalf("expected success with a digest, got %+v", resp)
+		}
+
+		m, err := loadImatrix(resp.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m.ChunkCount != 2 || len(m.Entries) != 1 {
+			t.Errorf("expected 1 weight over 2 chunks, got %d over %d", len(m.Entries), m.ChunkCount)
+		}
+	})
+}
@@ -199,6 +199,18 @@ func (c *DiskCache) Resolve(name string) (Digest, error) {
 	return d, nil
 }
 
+// ReadLink returns the data of the manifest linked to name, and its digest.
+//
+// Unlike [DiskCache.Resolve], it does not copy the manifest into the blob
+// store, so it is safe for callers that only read from the cache.
+func (c *DiskCache) ReadLink(name string) ([]byte, Digest, error) {
+	file, err := c.manifestPath(name)
+	if err != nil {
+		return nil, Digest{}, err
+	}
+	return readAndSum(file, 1<<20)
+}
+
 // Put writes a new blob to the cache, identified by its digest. The operation
 // reads content from r, which must precisely match both the specified size and
 // digest.
@@ -0,0 +1,200 @@
+package registry
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/server/internal/cache/blob"
+	"github.com/ollama/ollama/server/internal/client/ollama"
+	"github.com/ollama/ollama/server/internal/internal/names"
+)
+
+// Mirror implements an http.Handler that serves the models in a local cache
+// as a read-only registry, so other Ollama instances can pull from it instead
+// of downloading the same blobs from their registry.
+//
+// It serves the subset of the registry API used for pulling:
+//
+//	GET /v2/
+//	GET /v2/<name>/manifests/<tag>
+//	GET /v2/<name>/blobs/<digest>
+//
+// and HEAD for each. Blob requests support ranges, so clients can download
+// large layers in parts.
+//
+// Names are of the form <namespace>/<model> for models of the host in Mask,
+// or <host>/<namespace>/<model> for models of other hosts.
+type Mirror struct {
+	Cache *blob.DiskCache // required
+
+	// Mask, if set, is the name used to complete names in requests.
+	// If empty, [ollama.DefaultMask] is used.
+	Mask string
+
+	// Logger, if set, is used to log failed requests.
+	Logger *slog.Logger
+}
+
+// mirrorError is an error in the format of the registry API
+type mirrorError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *mirrorError) Error() string {
+	return e.Message
+}
+
+var (
+	errNameUnknown     = &mirrorError{404, "NAME_UNKNOWN", "repository name not known to registry"}
+	errManifestUnknown = &mirrorError{404, "MANIFEST_UNKNOWN", "manifest unknown"}
+	errBlobUnknown     = &mirrorError{404, "BLOB_UNKNOWN", "blob unknown to registry"}
+	errUnsupported     = &mirrorError{405, "UNSUPPORTED", "the operation is unsupported"}
+)
+
+func (s *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.serveHTTP(w, r)
+	if err == nil {
+		return
+	}
+
+	var e *mirrorError
+	if !errors.As(err, &e) {
+		if s.Logger != nil {
+			s.Logger.LogAttrs(r.Context(), slog.LevelError, "mirror",
+				slog.String("error", err.Error()),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+			)
+		}
+		e = &mirrorError{500, "UNKNOWN", "unknown error"}
+	}
+
+	data, err := json.Marshal(map[string][]*mirrorError{"errors": {e}})
+	if err != nil {
+		// unreachable
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	w.Write(data)
+}
+
+func (s *Mirror) serveHTTP(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return errUnsupported
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/v2/")
+	if !ok {
+		return errNameUnknown
+	}
+
+	if path == "" {
+		// clients check the API version before anything else
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return nil
+	}
+
+	if repo, ref, ok := cutLast(path, "/manifests/"); ok {
+		return s.serveManifest(w, r, repo, ref)
+	}
+
+	if repo, ref, ok := cutLast(path, "/blobs/"); ok {
+		return s.serveBlob(w, r, repo, ref)
+	}
+
+	return errNameUnknown
+}
+
+func (s *Mirror) serveManifest(w http.ResponseWriter, r *http.Request, repo, ref string) error {
+	if strings.HasPrefix(ref, "sha256:") {
+		return s.serveBlob(w, r, repo, ref)
+	}
+
+	n, err := s.parseName(repo, ref)
+	if err != nil {
+		return err
+	}
+
+	data, d, err := s.Cache.ReadLink(n.String())
+	if errors.Is(err, fs.ErrNotExist) {
+		return errManifestUnknown
+	} else if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+	w.Header().Set("Docker-Content-Digest", d.String())
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	return nil
+}
+
+func (s *Mirror) serveBlob(w http.ResponseWriter, r *http.Request, repo, ref string) error {
+	if _, err := s.parseName(repo, ""); err != nil {
+		return err
+	}
+
+	d, err := blob.ParseDigest(ref)
+	if err != nil {
+		return errBlobUnknown
+	}
+
+	// blobs are only served once complete, which Get checks
+	if _, err := s.Cache.Get(d); errors.Is(err, fs.ErrNotExist) {
+		return errBlobUnknown
+	} else if err != nil {
+		return err
+	}
+
+	f, err := os.Open(s.Cache.GetFile(d))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", d.String())
+	http.ServeContent(w, r, "", info.ModTime(), f)
+	return nil
+}
+
+// parseName returns the fully qualified name of the model named by repo and
+// tag in a request path.
+func (s *Mirror) parseName(repo, tag string) (names.Name, error) {
+	if strings.Count(repo, "/") > 2 || strings.Contains(repo, "@") {
+		return names.Name{}, errNameUnknown
+	}
+
+	mask := names.Parse(cmp.Or(s.Mask, ollama.DefaultMask))
+	n := names.Merge(names.Parse(repo+":"+cmp.Or(tag, mask.Tag())), mask)
+	if !n.IsFullyQualified() {
+		return names.Name{}, errNameUnknown
+	}
+
+	return n, nil
+}
+
+// cutLast is like strings.Cut but slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,171 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/server/internal/cache/blob"
+	"github.com/ollama/ollama/server/internal/testutil"
+)
+
+func newTestMirror(t *testing.T) *Mirror {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, os.DirFS("testdata/models")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := blob.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Mirror{
+		Cache:  c,
+		Mask:   "example.com/library/_:latest",
+		Logger: testutil.Slogger(t),
+	}
+}
+
+func (s *Mirror) send(t *testing.T, method, path string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequestWithContext(t.Context(), method, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+const (
+	smolManifestDigest = "sha256:ecfb1acfca9c76444d622fcdc3840217bd502124a9d3687d438c19b3cb9c3cb1"
+	smolModelDigest    = "sha256:a4e5e156ddec27e286f75328784d7106b60a4eb1d246e950a001a3f944fbda99"
+)
+
+func TestMirrorManifest(t *testing.T) {
+	s := newTestMirror(t)
+
+	d, err := blob.ParseDigest(smolManifestDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(s.Cache.GetFile(d)); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := os.ReadFile("testdata/models/manifests/example.com/library/smol/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"/v2/library/smol/manifests/latest",
+		"/v2/example.com/library/smol/manifests/latest",
+		"/v2/library/SMOL/manifests/latest",
+	} {
+		got := s.send(t, "GET", path, nil)
+		if got.Code != 200 {
+			t.Fatalf("%s: Code = %d; want 200\n%s", path, got.Code, got.Body)
+		}
+		if got.Body.String() != string(want) {
+			t.Errorf("%s: body = %s; want %s", path, got.Body, want)
+		}
+		if d := got.Header().Get("Docker-Content-Digest"); d != smolManifestDigest {
+			t.Errorf("%s: Docker-Content-Digest = %q; want %q", path, d, smolManifestDigest)
+		}
+	}
+
+	got := s.send(t, "HEAD", "/v2/library/smol/manifests/latest", nil)
+	if got.Code != 200 || got.Body.Len() != 0 {
+		t.Fatalf("HEAD: Code = %d, body = %q; want 200 and no body", got.Code, got.Body)
+	}
+	if n := got.Header().Get("Content-Length"); n != "407" {
+		t.Errorf("HEAD: Content-Length = %q; want 407", n)
+	}
+
+	// reading manifests must not write to the cache
+	if _, err := s.Cache.Get(d); err == nil {
+		t.Error("expected manifest to not be copied to the blob store")
+	}
+}
+
+func TestMirrorBlob(t *testing.T) {
+	s := newTestMirror(t)
+
+	want, err := os.ReadFile("testdata/models/blobs/" + strings.Replace(smolModelDigest, ":", "-", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.send(t, "GET", "/v2/library/smol/blobs/"+smolModelDigest, nil)
+	if got.Code != 200 {
+		t.Fatalf("Code = %d; want 200\n%s", got.Code, got.Body)
+	}
+	if got.Body.String() != string(want) {
+		t.Errorf("body = %q; want %q", got.Body, want)
+	}
+
+	got = s.send(t, "GET", "/v2/library/smol/blobs/"+smolModelDigest, http.Header{"Range": {"bytes=4-9"}})
+	if got.Code != 206 {
+		t.Fatalf("range: Code = %d; want 206", got.Code)
+	}
+	if got.Body.String() != string(want[4:10]) {
+		t.Errorf("range: body = %q; want %q", got.Body, want[4:10])
+	}
+	if cr := got.Header().Get("Content-Range"); cr != "bytes 4-9/24" {
+		t.Errorf("range: Content-Range = %q; want %q", cr, "bytes 4-9/24")
+	}
+
+	got = s.send(t, "HEAD", "/v2/library/smol/blobs/"+smolModelDigest, nil)
+	if got.Code != 200 || got.Header().Get("Content-Length") != "24" {
+		t.Fatalf("HEAD: Code = %d, Content-Length = %q; want 200 and 24", got.Code, got.Header().Get("Content-Length"))
+	}
+}
+
+func TestMirrorErrors(t *testing.T) {
+	s := newTestMirror(t)
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"GET", "/v2/library/missing/manifests/latest", 404, "MANIFEST_UNKNOWN"},
+		{"GET", "/v2/library/smol/manifests/missing", 404, "MANIFEST_UNKNOWN"},
+		{"GET", "/v2/library/smol/blobs/sha256:" + strings.Repeat("0", 64), 404, "BLOB_UNKNOWN"},
+		{"GET", "/v2/library/smol/blobs/notadigest", 404, "BLOB_UNKNOWN"},
+		{"GET", "/v2/a/b/c/d/manifests/latest", 404, "NAME_UNKNOWN"},
+		{"GET", "/v2/library/smol/tags/list", 404, "NAME_UNKNOWN"},
+		{"PUT", "/v2/library/smol/manifests/latest", 405, "UNSUPPORTED"},
+		{"DELETE", "/v2/library/smol/blobs/" + smolModelDigest, 405, "UNSUPPORTED"},
+	}
+
+	for _, tt := range cases {
+		got := s.send(t, tt.method, tt.path, nil)
+		if got.Code != tt.status {
+			t.Errorf("%s %s: Code = %d; want %d", tt.method, tt.path, got.Code, tt.status)
+			continue
+		}
+
+		var body struct {
+			Errors []struct {
+				Code string `json:"code"`
+			} `json:"errors"`
+		}
+		if err := json.Unmarshal(got.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Errors) != 1 || body.Errors[0].Code != tt.code {
+			t.Errorf("%s %s: errors = %+v; want %s", tt.method, tt.path, body.Errors, tt.code)
+		}
+	}
+
+	got := s.send(t, "GET", "/v2/", nil)
+	if got.Code != 200 {
+		t.Errorf("GET /v2/: Code = %d; want 200", got.Code)
+	}
+}
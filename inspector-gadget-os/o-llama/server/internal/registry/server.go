@@ -37,6 +37,10 @@ type Local struct {
 	// Prune, if set, is called to prune the local disk cache after a model
 	// is deleted.
 	Prune func() error // optional
+
+	// PullLock, if set, is held while pulling a model so that its blobs
+	// aren't pruned before its manifest is written.
+	PullLock sync.Locker // optional
 }
 
 // serverError is like ollama.Error, but with a Status field for the HTTP
@@ -266,6 +270,11 @@ func (s *Local) handlePull(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	if s.PullLock != nil {
+		s.PullLock.Lock()
+		defer s.PullLock.Unlock()
+	}
+
 	enc := json.NewEncoder(w)
 	if !p.stream() {
 		if err := s.Client.Pull(r.Context(), p.model()); err != nil {
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -20,6 +21,10 @@ type Manifest struct {
 	Config        Layer   `json:"config"`
 	Layers        []Layer `json:"layers"`
 
+	// Signatures are signatures of the manifest by the servers that
+	// created or pushed it. See signManifest.
+	Signatures []string `json:"signatures,omitempty"`
+
 	filepath string
 	fi       os.FileInfo
 	digest   string
@@ -97,6 +102,19 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 }
 
 func WriteManifest(name model.Name, config Layer, layers []Layer) error {
+	m := Manifest{
+		SchemaVersion: 2,
+		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
+		Config:        config,
+		Layers:        layers,
+	}
+
+	if err := signManifest(context.TODO(), &m); errors.Is(err, errSigningKeyNotFound) {
+		slog.Debug("not signing manifest", "name", name, "error", err)
+	} else if err != nil {
+		return err
+	}
+
 	manifests, err := GetManifestPath()
 	if err != nil {
 		return err
@@ -113,13 +131,6 @@ func WriteManifest(name model.Name, config Layer, layers []Layer) error {
 	}
 	defer f.Close()
 
-	m := Manifest{
-		SchemaVersion: 2,
-		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
-		Config:        config,
-		Layers:        layers,
-	}
-
 	return json.NewEncoder(f).Encode(m)
 }
 
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ollama/ollama/llm"
+)
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	// latencyBuckets cover time to first token and model loads, which take
+	// much longer than most requests
+	latencyBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+	metricsFactory = promauto.With(metricsRegistry)
+
+	httpRequests        = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "ollama_http_requests_total", Help: "HTTP requests served."}, []string{"method", "route", "status"})
+	httpRequestDuration = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{Name: "ollama_http_request_duration_seconds", Help: "Time to serve HTTP requests, including streamed responses.", Buckets: prometheus.DefBuckets}, []string{"method", "route"})
+
+	modelLoads         = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "ollama_model_loads_total", Help: "Model loads by outcome."}, []string{"model", "status"})
+	modelLoadDuration  = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{Name: "ollama_model_load_duration_seconds", Help: "Time to load a model.", Buckets: latencyBuckets}, []string{"model"})
+	modelEvictions     = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "ollama_model_evictions_total", Help: "Models unloaded to make room for another or to reload."}, []string{"model", "reason"})
+	modelsLoaded       = metricsFactory.NewGauge(prometheus.GaugeOpts{Name: "ollama_models_loaded", Help: "Models currently loaded."})
+	queueDepth         = metricsFactory.NewGaugeVec(prometheus.GaugeOpts{Name: "ollama_queue_depth", Help: "Requests waiting to be scheduled."}, []string{"priority"})
+	queueWait          = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{Name: "ollama_queue_wait_seconds", Help: "Time requests waited to be scheduled.", Buckets: latencyBuckets}, []string{"priority"})
+	promptTokens       = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "ollama_prompt_tokens_total", Help: "Prompt tokens evaluated."}, []string{"model"})
+	promptEvalSeconds  = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "ollama_prompt_eval_seconds_total", Help: "Time spent evaluating prompts."}, []string{"model"})
+	evalTokens         = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "ollama_eval_tokens_total", Help: "Tokens generated."}, []string{"model"})
+	evalSeconds        = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "ollama_eval_seconds_total", Help: "Time spent generating tokens."}, []string{"model"})
+	timeToFirstToken   = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{Name: "ollama_time_to_first_token_seconds", Help: "Time from a completion request to its first generated token.", Buckets: latencyBuckets}, []string{"model"})
+	kvCacheUtilization = metricsFactory.NewGaugeVec(prometheus.GaugeOpts{Name: "ollama_kv_cache_utilization_ratio", Help: "Fraction of a sequence's context in use when its last completion finished."}, []string{"model"})
+
+	metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+)
+
+// metricsMiddleware records the count and latency of requests by route
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+}
+
+// MetricsHandler serves the server's metrics in the Prometheus text format,
+// or OpenMetrics when the client accepts it
+func (s *Server) MetricsHandler(c *gin.Context) {
+	s.sched.collectMetrics()
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
+
+// collectMetrics updates the gauges that reflect the scheduler's current state
+func (s *Scheduler) collectMetrics() {
+	s.loadedMu.Lock()
+	modelsLoaded.Set(float64(len(s.loaded)))
+	s.loadedMu.Unlock()
+
+	for _, q := range s.QueueStatus() {
+		queueDepth.WithLabelValues(q.Priority).Set(float64(q.Depth))
+	}
+}
+
+// modelName labels the runner's metrics. The refMu must already be held.
+func (runner *runnerRef) modelName() string {
+	if runner.model != nil {
+		return runner.model.ShortName
+	}
+	return runner.modelPath
+}
+
+// observeCompletion wraps a completion callback to record generation
+// metrics. numCtx is the context size of the sequence.
+func observeCompletion(model string, numCtx int, fn func(llm.CompletionResponse)) func(llm.CompletionResponse) {
+	start := time.Now()
+	first := true
+	return func(cr llm.CompletionResponse) {
+		if first && (cr.Content != "" || cr.EvalCount > 0) {
+			first = false
+			timeToFirstToken.WithLabelValues(model).Observe(time.Since(start).Seconds())
+		}
+
+		if cr.Done {
+			promptTokens.WithLabelValues(model).Add(float64(cr.PromptEvalCount))
+			promptEvalSeconds.WithLabelValues(model).Add(cr.PromptEvalDuration.Seconds())
+			evalTokens.WithLabelValues(model).Add(float64(cr.EvalCount))
+			evalSeconds.WithLabelValues(model).Add(cr.EvalDuration.Seconds())
+			if cr.CacheCount > 0 && numCtx > 0 {
+				kvCacheUtilization.WithLabelValues(model).Set(float64(cr.CacheCount) / float64(numCtx))
+			}
+		}
+
+		fn(cr)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	s := Server{sched: &Scheduler{loaded: make(map[string]*runnerRef)}}
+	s.sched.loaded["a"] = &runnerRef{}
+
+	fn := observeCompletion("metrics-test", 100, func(llm.CompletionResponse) {})
+	fn(llm.CompletionResponse{Content: "hi"})
+	fn(llm.CompletionResponse{
+		Done:               true,
+		PromptEvalCount:    10,
+		PromptEvalDuration: time.Second,
+		EvalCount:          5,
+		EvalDuration:       2 * time.Second,
+		CacheCount:         25,
+	})
+
+	r := gin.New()
+	r.Use(metricsMiddleware)
+	r.GET("/metrics", s.MetricsHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("content type %q", w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`ollama_prompt_tokens_total{model="metrics-test"} 10`,
+		`ollama_eval_tokens_total{model="metrics-test"} 5`,
+		`ollama_eval_seconds_total{model="metrics-test"} 2`,
+		`ollama_time_to_first_token_seconds_count{model="metrics-test"} 1`,
+		`ollama_kv_cache_utilization_ratio{model="metrics-test"} 0.25`,
+		`ollama_models_loaded 1`,
+		`ollama_queue_depth{priority="background"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+
+	// Requests are recorded once they are served, so the first scrape shows
+	// up in the next
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `ollama_http_requests_total{method="GET",route="/metrics",status="200"}`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("missing %q", want)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+// newMirrorServer starts a server with its own models directory that serves
+// it as a registry mirror
+func newMirrorServer(t *testing.T, dir string) *httptest.Server {
+	t.Helper()
+	t.Setenv("OLLAMA_MODELS", dir)
+	t.Setenv("OLLAMA_REGISTRY_SERVE", "1")
+
+	var s Server
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRegistryMirror(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	src := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", src)
+
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:  "test",
+		Files: map[string]string{"test.gguf": digest},
+	}); w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	mirror := newMirrorServer(t, src)
+
+	blobs, err := filepath.Glob(filepath.Join(src, "blobs", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkPulled := func(t *testing.T, dst, manifest string) {
+		t.Helper()
+		checkFileExists(t, filepath.Join(dst, "manifests", "*", "*", "*", "*"), []string{manifest})
+
+		var expect []string
+		for _, blob := range blobs {
+			expect = append(expect, filepath.Join(dst, "blobs", filepath.Base(blob)))
+		}
+		checkFileExists(t, filepath.Join(dst, "blobs", "*"), expect)
+	}
+
+	t.Run("pull", func(t *testing.T) {
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+		t.Setenv("OLLAMA_REGISTRY_SERVE", "")
+		t.Setenv("OLLAMA_REGISTRY_MIRROR", mirror.URL)
+
+		var s Server
+		h, err := s.GenerateRoutes(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+
+		resp, err := http.Post(srv.URL+"/api/pull", "application/json", strings.NewReader(`{"model":"test","stream":false}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var status struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK || status.Status != "success" {
+			t.Fatalf("expected success, got %d %+v", resp.StatusCode, status)
+		}
+
+		checkPulled(t, dst, filepath.Join(dst, "manifests", "registry.ollama.ai", "library", "test", "latest"))
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		// a mirror without the model
+		empty := newMirrorServer(t, t.TempDir())
+
+		dst := t.TempDir()
+		t.Setenv("OLLAMA_MODELS", dst)
+		t.Setenv("OLLAMA_REGISTRY_MIRROR", empty.URL)
+
+		// the first mirror stands in for the model's registry
+		host := strings.TrimPrefix(mirror.URL, "http://")
+
+		if err := PullModel(t.Context(), "http://"+host+"/library/test", &registryOptions{Insecure: true}, func(api.ProgressResponse) {}); err != nil {
+			t.Fatal(err)
+		}
+
+		checkPulled(t, dst, filepath.Join(dst, "manifests", host, "library", "test", "latest"))
+	})
+}
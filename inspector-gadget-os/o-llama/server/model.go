@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/fs/ggml"
@@ -77,38 +78,79 @@ func parseFromModel(ctx context.Context, name model.Name, fn func(api.ProgressRe
 
 func detectChatTemplate(layers []*layerGGML) ([]*layerGGML, error) {
 	for _, layer := range layers {
-		if s := layer.GGML.KV().ChatTemplate(); s != "" {
-			if t, err := template.Named(s); err != nil {
-				slog.Debug("template detection", "error", err, "template", s)
-			} else {
-				layer, err := NewLayer(t.Reader(), "application/vnd.ollama.image.template")
-				if err != nil {
-					return nil, err
-				}
-
-				layer.status = fmt.Sprintf("using autodetected template %s", t.Name)
-				layers = append(layers, &layerGGML{layer, nil})
-
-				if t.Parameters != nil {
-					var b bytes.Buffer
-					if err := json.NewEncoder(&b).Encode(t.Parameters); err != nil {
-						return nil, err
-					}
-
-					layer, err := NewLayer(&b, "application/vnd.ollama.image.params")
-					if err != nil {
-						return nil, err
-					}
-
-					layers = append(layers, &layerGGML{layer, nil})
-				}
+		kv := layer.GGML.KV()
+		s := kv.ChatTemplate()
+		if s == "" {
+			continue
+		}
+
+		named, err := template.Named(s)
+		if err != nil {
+			slog.Debug("template detection", "error", err, "template", s)
+		}
+
+		var r io.Reader
+		var status string
+		bos, eos := chatTemplateTokens(kv)
+		if t, err := template.FromJinja(s, bos, eos); err == nil {
+			r = strings.NewReader(t.String())
+			status = "converted chat template"
+		} else if named != nil {
+			slog.Warn("couldn't convert chat template, using closest named template", "error", err, "template", named.Name)
+			r = named.Reader()
+			status = fmt.Sprintf("couldn't convert chat template, using autodetected template %s", named.Name)
+		} else {
+			slog.Warn("couldn't convert chat template", "error", err)
+			continue
+		}
+
+		layer, err := NewLayer(r, "application/vnd.ollama.image.template")
+		if err != nil {
+			return nil, err
+		}
+
+		layer.status = status
+		layers = append(layers, &layerGGML{layer, nil})
+
+		// stop words of the closest named template apply to converted
+		// templates as well
+		if named != nil && named.Parameters != nil {
+			var b bytes.Buffer
+			if err := json.NewEncoder(&b).Encode(named.Parameters); err != nil {
+				return nil, err
 			}
+
+			layer, err := NewLayer(&b, "application/vnd.ollama.image.params")
+			if err != nil {
+				return nil, err
+			}
+
+			layers = append(layers, &layerGGML{layer, nil})
 		}
 	}
 
 	return layers, nil
 }
 
+// chatTemplateTokens returns the text of the BOS and EOS tokens for converting
+// chat templates. BOS is left out if the tokenizer adds it to prompts itself.
+func chatTemplateTokens(kv ggml.KV) (bos, eos string) {
+	tokens := kv.Strings("tokenizer.ggml.tokens")
+	token := func(key string) string {
+		if id, ok := kv[key].(uint32); ok && int(id) < len(tokens) {
+			return tokens[id]
+		}
+
+		return ""
+	}
+
+	if !kv.Bool("tokenizer.ggml.add_bos_token", true) {
+		bos = token("tokenizer.ggml.bos_token_id")
+	}
+
+	return bos, token("tokenizer.ggml.eos_token_id")
+}
+
 func detectContentType(r io.Reader) (string, error) {
 	var b bytes.Buffer
 	if _, err := io.Copy(&b, r); err != nil {
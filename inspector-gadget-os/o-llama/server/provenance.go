@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// Manifests are signed with the key of the server that creates or pushes
+// them. Signatures cover the manifest without its signatures, and so its
+// config and layers by digest, so any change to a model invalidates them.
+const signaturePrefix = "ollama manifest signature v1\n"
+
+var (
+	errUnsignedModel      = errors.New("model is not signed")
+	errUntrustedSigner    = errors.New("model is not signed by a trusted key")
+	errInvalidSignature   = errors.New("model signature is invalid")
+	errProvenancePolicy   = errors.New("refusing model under signature policy \"enforce\"")
+	errSigningKeyNotFound = errors.New("signing key not found")
+)
+
+// signaturePayload returns the data that the signatures of m sign
+func signaturePayload(m Manifest) ([]byte, error) {
+	m.Signatures = nil
+	bts, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(signaturePrefix), bts...), nil
+}
+
+// signManifest signs m with the server's key, replacing any signature it
+// already has from that key. It returns errSigningKeyNotFound if the server has
+// no key.
+func signManifest(ctx context.Context, m *Manifest) error {
+	if _, err := auth.GetPublicKey(); errors.Is(err, os.ErrNotExist) {
+		return errSigningKeyNotFound
+	} else if err != nil {
+		return err
+	}
+
+	payload, err := signaturePayload(*m)
+	if err != nil {
+		return err
+	}
+
+	signature, err := auth.Sign(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	key, _, _ := strings.Cut(signature, ":")
+	m.Signatures = slices.DeleteFunc(m.Signatures, func(s string) bool {
+		return strings.HasPrefix(s, key+":")
+	})
+	m.Signatures = append(m.Signatures, signature)
+	return nil
+}
+
+// signPushedManifest signs the manifest of a model being pushed, rewriting it
+// locally so the local and pushed manifests match. Manifests are left as they
+// are if the server has no key.
+func signPushedManifest(ctx context.Context, mp ModelPath, m *Manifest) error {
+	signatures := slices.Clone(m.Signatures)
+	if err := signManifest(ctx, m); errors.Is(err, errSigningKeyNotFound) {
+		slog.Debug("not signing manifest", "name", mp.GetShortTagname(), "error", err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if slices.Equal(signatures, m.Signatures) {
+		return nil
+	}
+
+	bts, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	p, err := mp.GetManifestPath()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(p, bts, 0o644)
+}
+
+// trustedKeys returns the fingerprints of the keys trusted to sign models: the
+// keys in the trust store and the server's own key.
+func trustedKeys() (map[string]bool, error) {
+	keys := make(map[string]bool)
+	if s, err := auth.GetPublicKey(); err == nil {
+		if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s)); err == nil {
+			keys[ssh.FingerprintSHA256(key)] = true
+		}
+	}
+
+	bts, err := os.ReadFile(envconfig.TrustedKeys())
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for len(bytes.TrimSpace(bts)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(bts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", envconfig.TrustedKeys(), err)
+		}
+
+		keys[ssh.FingerprintSHA256(key)] = true
+		bts = rest
+	}
+
+	return keys, nil
+}
+
+// verifyManifest checks the signatures of m. The error is nil only if every
+// signature is valid and at least one is from a trusted key.
+func verifyManifest(m *Manifest) (api.Provenance, error) {
+	p := api.Provenance{Policy: envconfig.SignaturePolicy()}
+	if len(m.Signatures) == 0 {
+		return p, errUnsignedModel
+	}
+
+	payload, err := signaturePayload(*m)
+	if err != nil {
+		return p, err
+	}
+
+	trusted, err := trustedKeys()
+	if err != nil {
+		return p, err
+	}
+
+	for _, signature := range m.Signatures {
+		key, err := auth.Verify(payload, signature)
+		if err != nil {
+			return p, fmt.Errorf("%w: %w", errInvalidSignature, err)
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+		p.Signers = append(p.Signers, fingerprint)
+		p.Trusted = p.Trusted || trusted[fingerprint]
+	}
+
+	if !p.Trusted {
+		return p, errUntrustedSigner
+	}
+
+	return p, nil
+}
+
+// modelProvenance returns the provenance of m, for showing to users
+func modelProvenance(m *Manifest) *api.Provenance {
+	p, err := verifyManifest(m)
+	if err != nil && !errors.Is(err, errUnsignedModel) && !errors.Is(err, errUntrustedSigner) {
+		p.Error = err.Error()
+	}
+
+	return &p
+}
+
+// checkProvenance applies the signature policy to the manifest of a model.
+// Under "enforce" it returns an error unless the manifest is signed by a
+// trusted key; under "warn" it logs and returns a warning instead.
+func checkProvenance(name string, m *Manifest) (warning string, _ error) {
+	policy := envconfig.SignaturePolicy()
+	if policy == envconfig.SignaturePolicyOff {
+		return "", nil
+	}
+
+	_, err := verifyManifest(m)
+	if err == nil {
+		return "", nil
+	}
+
+	if policy == envconfig.SignaturePolicyEnforce {
+		return "", fmt.Errorf("%s: %w: %w", name, errProvenancePolicy, err)
+	}
+
+	slog.Warn("model provenance", "model", name, "error", err)
+	return fmt.Sprintf("warning: %s", err), nil
+}
+
+// verifiedLayer is the file of a layer when it last matched its digest
+type verifiedLayer struct {
+	size    int64
+	modTime time.Time
+}
+
+// verifiedLayers caches the layers verified on load by digest, so that each
+// is only hashed again once its file changes
+var verifiedLayers = struct {
+	sync.Mutex
+	m map[string]verifiedLayer
+}{m: make(map[string]verifiedLayer)}
+
+// verifyLayers checks that the config and every layer of m match their
+// digests. Layers whose size and modification time haven't changed since
+// they were last verified aren't hashed again.
+func verifyLayers(m *Manifest) error {
+	for _, layer := range append(m.Layers, m.Config) {
+		if layer.Digest == "" {
+			continue
+		}
+
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+
+		verifiedLayers.Lock()
+		v, ok := verifiedLayers.m[layer.Digest]
+		verifiedLayers.Unlock()
+		if ok && v.size == fi.Size() && v.modTime.Equal(fi.ModTime()) {
+			continue
+		}
+
+		if err := verifyBlob(layer.Digest); err != nil {
+			return err
+		}
+
+		verifiedLayers.Lock()
+		verifiedLayers.m[layer.Digest] = verifiedLayer{size: fi.Size(), modTime: fi.ModTime()}
+		verifiedLayers.Unlock()
+	}
+
+	return nil
+}
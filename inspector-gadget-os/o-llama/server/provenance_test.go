@@ -0,0 +1,283 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// newSigningKey writes a new private key to home, where the server looks for
+// its key, and returns the corresponding public key.
+func newSigningKey(t *testing.T, home string) ssh.PublicKey {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, ".ollama"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".ollama", "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestProvenance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_SIGNATURE_POLICY", "")
+
+	key := newSigningKey(t, home)
+
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:  "test",
+		Files: map[string]string{"test.gguf": digest},
+	}); w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	name := model.ParseName("test")
+	m, err := ParseNamedManifest(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("signed on create", func(t *testing.T) {
+		if len(m.Signatures) != 1 {
+			t.Fatalf("expected 1 signature, got %d", len(m.Signatures))
+		}
+
+		p, err := verifyManifest(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fingerprint := ssh.FingerprintSHA256(key); len(p.Signers) != 1 || p.Signers[0] != fingerprint {
+			t.Fatalf("expected signer %s, got %v", fingerprint, p.Signers)
+		}
+
+		if !p.Trusted {
+			t.Fatal("expected own key to be trusted")
+		}
+	})
+
+	t.Run("resigning replaces signature", func(t *testing.T) {
+		m := *m
+		if err := signManifest(t.Context(), &m); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m.Signatures) != 1 {
+			t.Fatalf("expected 1 signature, got %d", len(m.Signatures))
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		m := *m
+		m.Layers = append(m.Layers, Layer{MediaType: "application/vnd.ollama.image.system", Digest: "sha256:" + strings.Repeat("0", 64)})
+
+		_, err := verifyManifest(&m)
+		if !errors.Is(err, errInvalidSignature) {
+			t.Fatalf("expected %v, got %v", errInvalidSignature, err)
+		}
+
+		if p := modelProvenance(&m); p.Error == "" {
+			t.Fatal("expected error in provenance")
+		}
+	})
+
+	t.Run("trust store", func(t *testing.T) {
+		// models signed by another server are untrusted until its key is
+		// in the trust store
+		other := t.TempDir()
+		t.Setenv("HOME", other)
+		t.Setenv("USERPROFILE", other)
+		otherKey := newSigningKey(t, other)
+
+		m := *m
+		m.Signatures = nil
+		if err := signManifest(t.Context(), &m); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Setenv("HOME", home)
+		t.Setenv("USERPROFILE", home)
+
+		if _, err := verifyManifest(&m); !errors.Is(err, errUntrustedSigner) {
+			t.Fatalf("expected %v, got %v", errUntrustedSigner, err)
+		}
+
+		if err := os.WriteFile(filepath.Join(home, ".ollama", "trusted_keys"), ssh.MarshalAuthorizedKey(otherKey), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Remove(filepath.Join(home, ".ollama", "trusted_keys")) })
+
+		p, err := verifyManifest(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !p.Trusted {
+			t.Fatal("expected key in trust store to be trusted")
+		}
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		m := *m
+		m.Signatures = nil
+
+		cases := []struct {
+			policy  string
+			warning bool
+			err     error
+		}{
+			{"off", false, nil},
+			{"warn", true, nil},
+			{"enforce", false, errProvenancePolicy},
+		}
+
+		for _, tt := range cases {
+			t.Run(tt.policy, func(t *testing.T) {
+				t.Setenv("OLLAMA_SIGNATURE_POLICY", tt.policy)
+
+				warning, err := checkProvenance("test", &m)
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+
+				if tt.warning != (warning != "") {
+					t.Fatalf("expected warning %t, got %q", tt.warning, warning)
+				}
+			})
+		}
+	})
+
+	t.Run("show", func(t *testing.T) {
+		w := createRequest(t, s.ShowHandler, api.ShowRequest{Model: "test"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.ShowResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Provenance == nil || !resp.Provenance.Trusted || resp.Provenance.Policy != "warn" {
+			t.Fatalf("unexpected provenance %+v", resp.Provenance)
+		}
+	})
+
+	t.Run("verify on load", func(t *testing.T) {
+		t.Setenv("OLLAMA_VERIFY_ON_LOAD", "1")
+
+		if _, err := GetModel("test"); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := GetBlobsPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bts, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.WriteFile(p, bts, 0o644) })
+
+		corrupt := bytes.Clone(bts)
+		corrupt[len(corrupt)/2] ^= 0xff
+		if err := os.WriteFile(p, corrupt, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		// layers are only hashed again once their size or modification
+		// time changes
+		if err := os.Chtimes(p, fi.ModTime(), fi.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetModel("test"); err != nil {
+			t.Fatalf("expected verified layer to be cached, got %v", err)
+		}
+
+		later := fi.ModTime().Add(time.Second)
+		if err := os.Chtimes(p, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetModel("test"); !errors.Is(err, errDigestMismatch) {
+			t.Fatalf("expected %v, got %v", errDigestMismatch, err)
+		}
+	})
+
+	t.Run("enforce on import", func(t *testing.T) {
+		w := createRequest(t, s.ExportHandler, api.ExportRequest{Models: []string{"test"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+		bundle := w.Body.Bytes()
+
+		// a server with a different key and an empty trust store
+		other := t.TempDir()
+		t.Setenv("HOME", other)
+		t.Setenv("USERPROFILE", other)
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		t.Setenv("OLLAMA_SIGNATURE_POLICY", "enforce")
+		newSigningKey(t, other)
+
+		rw, progress := importRequest(t, &s, bundle)
+		if status := lastStatus(t, rw, progress); !strings.Contains(status, errProvenancePolicy.Error()) {
+			t.Fatalf("expected policy error, got %q", status)
+		}
+
+		if err := os.WriteFile(filepath.Join(other, ".ollama", "trusted_keys"), ssh.MarshalAuthorizedKey(key), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		rw, progress = importRequest(t, &s, bundle)
+		if status := lastStatus(t, rw, progress); status != "success" {
+			t.Fatalf("expected success, got %q", status)
+		}
+	})
+}
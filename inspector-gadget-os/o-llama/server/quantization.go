@@ -9,7 +9,9 @@ import (
 	"strings"
 	"unsafe"
 
+	"github.com/ollama/ollama/api"
 	fsggml "github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/fs/imatrix"
 	"github.com/ollama/ollama/ml/backend/ggml"
 )
 
@@ -18,6 +20,9 @@ type quantizer struct {
 	offset     uint64
 	from, to   *fsggml.Tensor
 	progressFn func(n uint64)
+
+	// importance weights the quantization error of each column, if not nil
+	importance []float32
 }
 
 func (q quantizer) WriteTo(w io.Writer) (int64, error) {
@@ -40,7 +45,7 @@ func (q quantizer) WriteTo(w io.Writer) (int64, error) {
 	} else {
 		f32s = ggml.ConvertToF32(data, q.from.Kind, q.from.Elements())
 	}
-	data = ggml.Quantize(newType, f32s, q.from.Shape)
+	data = ggml.QuantizeImatrix(newType, f32s, q.from.Shape, q.importance)
 	n, err := w.Write(data)
 	q.progressFn(q.from.Size())
 	return int64(n), err
@@ -52,6 +57,8 @@ type quantizeState struct {
 	iAttnV    int  // Running counter of number of attn_v tensors that have been processed
 	iFfnDown  int  // Running counter of number of ffn_down tensors that have been processed
 	hasOutput bool // used to figure out if a model shares tok_embd with the output weight
+
+	hasImatrix bool // an importance matrix guides quantization
 }
 
 func useMoreBits(iLayer, nLayers int) bool {
@@ -61,19 +68,83 @@ func useMoreBits(iLayer, nLayers int) bool {
 func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType, name string, shape []uint64, ftype fsggml.FileType) fsggml.TensorType {
 	// Ported from llama_tensor_get_type, removed unsupported quantization types
 	nExperts := max(1, kv.Uint("expert_count", 0))
+	nGQA := kv.HeadCountMax() / max(1, kv.HeadCountKVMin())
+	isIQ2 := ftype == fsggml.FileTypeIQ2_XXS || ftype == fsggml.FileTypeIQ2_XS || ftype == fsggml.FileTypeIQ2_S
 	if name == "output.weight" || name == "output_norm.weight" || (!qs.hasOutput && name == "token_embd.weight") {
 		nx := shape[0]
 		qk_k := newType.BlockSize()
 		if nx%qk_k != 0 {
 			newType = fsggml.TensorTypeQ8_0
+		} else if isIQ2 || ftype == fsggml.FileTypeIQ3_XXS {
+			newType = fsggml.TensorTypeQ5_K
 		} else if newType != fsggml.TensorTypeQ8_0 {
 			newType = fsggml.TensorTypeQ6_K
 		}
+	} else if name == "token_embd.weight" {
+		switch ftype {
+		case fsggml.FileTypeIQ2_XXS, fsggml.FileTypeIQ2_XS:
+			newType = fsggml.TensorTypeQ2_K
+		case fsggml.FileTypeIQ2_S, fsggml.FileTypeIQ3_XXS, fsggml.FileTypeIQ3_S:
+			newType = fsggml.TensorTypeIQ3_S
+		}
+	} else if isIQ2 {
+		// the lowest bit types need more bits in a few places to stay usable
+		if strings.Contains(name, "attn_v.weight") {
+			if nGQA >= 4 || nExperts >= 4 {
+				newType = fsggml.TensorTypeQ4_K
+			} else if ftype == fsggml.FileTypeIQ2_S {
+				newType = fsggml.TensorTypeIQ3_S
+			} else {
+				newType = fsggml.TensorTypeQ2_K
+			}
+			qs.iAttnV++
+		} else if nExperts == 8 && strings.Contains(name, "attn_k.weight") {
+			newType = fsggml.TensorTypeQ4_K
+		} else if strings.Contains(name, "ffn_down") {
+			if qs.iFfnDown < qs.nFfnDown/8 {
+				if ftype == fsggml.FileTypeIQ2_S {
+					newType = fsggml.TensorTypeIQ3_S
+				} else {
+					newType = fsggml.TensorTypeQ2_K
+				}
+			}
+			qs.iFfnDown++
+		} else if strings.Contains(name, "attn_output.weight") {
+			if nExperts == 8 {
+				newType = fsggml.TensorTypeQ5_K
+			} else if ftype == fsggml.FileTypeIQ2_S {
+				newType = fsggml.TensorTypeIQ3_S
+			}
+		}
 	} else if strings.Contains(name, "attn_v.weight") {
-		if (ftype == fsggml.FileTypeQ4_K_M) &&
-			useMoreBits(qs.iAttnV, qs.nAttnV) {
+		switch {
+		case ftype == fsggml.FileTypeQ2_K:
+			if nGQA >= 4 {
+				newType = fsggml.TensorTypeQ4_K
+			} else {
+				newType = fsggml.TensorTypeQ3_K
+			}
+		case ftype == fsggml.FileTypeIQ3_XXS:
+			if nGQA >= 4 {
+				newType = fsggml.TensorTypeQ4_K
+			} else if !qs.hasImatrix {
+				newType = fsggml.TensorTypeIQ3_S
+			}
+		case ftype == fsggml.FileTypeIQ3_S && nGQA >= 4:
+			newType = fsggml.TensorTypeQ4_K
+		case ftype == fsggml.FileTypeQ3_K_M:
+			if qs.iAttnV < 2 {
+				newType = fsggml.TensorTypeQ5_K
+			} else {
+				newType = fsggml.TensorTypeQ4_K
+			}
+		case ftype == fsggml.FileTypeQ3_K_L:
+			newType = fsggml.TensorTypeQ5_K
+		case (ftype == fsggml.FileTypeIQ4_NL || ftype == fsggml.FileTypeIQ4_XS) && nGQA >= 4:
+			newType = fsggml.TensorTypeQ5_K
+		case (ftype == fsggml.FileTypeQ4_K_M || ftype == fsggml.FileTypeQ5_K_M) && useMoreBits(qs.iAttnV, qs.nAttnV):
 			newType = fsggml.TensorTypeQ6_K
-		} else if ftype == fsggml.FileTypeQ4_K_S && qs.iAttnV < 4 {
+		case ftype == fsggml.FileTypeQ4_K_S && qs.iAttnV < 4:
 			newType = fsggml.TensorTypeQ5_K
 		}
 
@@ -98,23 +169,61 @@ func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType
 	} else if strings.Contains(name, "ffn_down") {
 		iLayer := qs.iFfnDown
 		n_layer := qs.nFfnDown
-		if ftype == fsggml.FileTypeQ4_K_M {
+		switch {
+		case ftype == fsggml.FileTypeQ2_K:
+			newType = fsggml.TensorTypeQ3_K
+		case ftype == fsggml.FileTypeIQ3_XXS && !qs.hasImatrix:
+			if iLayer < n_layer/8 {
+				newType = fsggml.TensorTypeQ4_K
+			} else {
+				newType = fsggml.TensorTypeQ3_K
+			}
+		case ftype == fsggml.FileTypeQ3_K_M:
+			if iLayer < n_layer/16 {
+				newType = fsggml.TensorTypeQ5_K
+			} else {
+				newType = fsggml.TensorTypeQ4_K
+			}
+		case ftype == fsggml.FileTypeQ3_K_L:
+			newType = fsggml.TensorTypeQ5_K
+		case ftype == fsggml.FileTypeQ4_K_M || ftype == fsggml.FileTypeQ5_K_M:
 			if useMoreBits(iLayer, n_layer) {
 				newType = fsggml.TensorTypeQ6_K
 			}
-		} else if ftype == fsggml.FileTypeQ4_K_S && iLayer < n_layer/8 {
+		case (ftype == fsggml.FileTypeIQ4_NL || ftype == fsggml.FileTypeIQ4_XS) && !qs.hasImatrix && iLayer < n_layer/8:
+			newType = fsggml.TensorTypeQ5_K
+		case ftype == fsggml.FileTypeQ4_K_S && iLayer < n_layer/8:
 			newType = fsggml.TensorTypeQ5_K
 		}
 		qs.iFfnDown++
 	} else if strings.Contains(name, "attn_output.weight") {
 		if nExperts == 8 {
-			if ftype == fsggml.FileTypeQ4_K_S || ftype == fsggml.FileTypeQ4_K_M {
+			switch ftype {
+			case fsggml.FileTypeQ2_K, fsggml.FileTypeQ3_K_S, fsggml.FileTypeQ3_K_M,
+				fsggml.FileTypeQ4_K_S, fsggml.FileTypeQ4_K_M,
+				fsggml.FileTypeIQ3_XXS, fsggml.FileTypeIQ3_S, fsggml.FileTypeIQ4_NL, fsggml.FileTypeIQ4_XS:
+				newType = fsggml.TensorTypeQ5_K
+			}
+		} else {
+			switch ftype {
+			case fsggml.FileTypeQ2_K:
+				newType = fsggml.TensorTypeQ3_K
+			case fsggml.FileTypeIQ3_XXS:
+				newType = fsggml.TensorTypeIQ3_S
+			case fsggml.FileTypeQ3_K_M:
+				newType = fsggml.TensorTypeQ4_K
+			case fsggml.FileTypeQ3_K_L:
 				newType = fsggml.TensorTypeQ5_K
 			}
 		}
 	} else if strings.Contains(name, "attn_qkv.weight") {
-		if ftype == fsggml.FileTypeQ4_K_M {
+		switch ftype {
+		case fsggml.FileTypeQ3_K_M, fsggml.FileTypeQ3_K_L:
+			newType = fsggml.TensorTypeQ4_K
+		case fsggml.FileTypeQ4_K_M:
 			newType = fsggml.TensorTypeQ5_K
+		case fsggml.FileTypeQ5_K_M:
+			newType = fsggml.TensorTypeQ6_K
 		}
 	}
 
@@ -129,6 +238,10 @@ func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType
 
 			// Select appropriate fallback based on original type
 			switch newType {
+			case fsggml.TensorTypeQ2_K, fsggml.TensorTypeQ3_K,
+				fsggml.TensorTypeIQ2_XXS, fsggml.TensorTypeIQ2_XS, fsggml.TensorTypeIQ2_S,
+				fsggml.TensorTypeIQ3_XXS, fsggml.TensorTypeIQ3_S, fsggml.TensorTypeIQ4_XS:
+				newType = fsggml.TensorTypeIQ4_NL
 			case fsggml.TensorTypeQ4_K:
 				newType = fsggml.TensorTypeQ5_0
 			case fsggml.TensorTypeQ5_K:
@@ -149,11 +262,11 @@ func getTensorNewType(kv fsggml.KV, qs *quantizeState, newType fsggml.TensorType
 	return newType
 }
 
-func quantize(in, out *os.File, orig *fsggml.GGML, newFileType fsggml.FileType, progressFn func(n uint64)) error {
-	kv := maps.Clone(orig.KV())
-	kv["general.file_type"] = newFileType
-	// kv["general.quantization_version"] = ggml.QuantizationVersion()
-	qs := &quantizeState{}
+// quantizeTensors returns the tensors of orig with the types they are
+// quantized to as newFileType
+func quantizeTensors(orig *fsggml.GGML, newFileType fsggml.FileType, im *imatrix.Matrix) ([]*fsggml.Tensor, error) {
+	kv := orig.KV()
+	qs := &quantizeState{hasImatrix: im != nil}
 	// Build up the quantize state so newType can adjust types
 	layerCount := 0
 	for k, l := range orig.Tensors().GroupLayers() {
@@ -173,22 +286,81 @@ func quantize(in, out *os.File, orig *fsggml.GGML, newFileType fsggml.FileType,
 	qs.nFfnDown = layerCount
 
 	origTensors := orig.Tensors().Items()
-	outputTensors := make([]*fsggml.Tensor, len(origTensors))
+	tensors := make([]*fsggml.Tensor, len(origTensors))
 	for i, tensor := range origTensors {
-		tensor := tensor
 		newType := newType(tensor, kv, qs, newFileType)
-		newTensor := &fsggml.Tensor{
+		if ggml.QuantizeRequiresImatrix(newType) && im.Importance(tensor.Name) == nil {
+			return nil, fmt.Errorf("quantizing %s to %s requires an importance matrix", tensor.Name, newType)
+		}
+
+		tensors[i] = &fsggml.Tensor{
 			Name:  tensor.Name,
 			Shape: tensor.Shape,
 			Kind:  uint32(newType),
 		}
-		outputTensors[i] = newTensor
+	}
+
+	return tensors, nil
+}
+
+// quantizationPlan describes quantizing orig to newFileType without
+// quantizing it
+func quantizationPlan(orig *fsggml.GGML, newFileType fsggml.FileType, im *imatrix.Matrix) (*api.QuantizationPlan, error) {
+	tensors, err := quantizeTensors(orig, newFileType, im)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := api.QuantizationPlan{Type: newFileType.String()}
+	for i, from := range orig.Tensors().Items() {
+		to := tensors[i]
+		plan.Size += int64(to.Size())
+		plan.Tensors = append(plan.Tensors, api.QuantizationTensor{
+			Name:  to.Name,
+			Shape: to.Shape,
+			From:  fsggml.TensorType(from.Kind).String(),
+			To:    fsggml.TensorType(to.Kind).String(),
+			Size:  int64(to.Size()),
+		})
+	}
+
+	return &plan, nil
+}
+
+func quantize(in, out *os.File, orig *fsggml.GGML, newFileType fsggml.FileType, im *imatrix.Matrix, progressFn func(n uint64)) error {
+	kv := maps.Clone(orig.KV())
+	kv["general.file_type"] = newFileType
+	// kv["general.quantization_version"] = ggml.QuantizationVersion()
+
+	outputTensors, err := quantizeTensors(orig, newFileType, im)
+	if err != nil {
+		return err
+	}
+
+	for i, tensor := range orig.Tensors().Items() {
+		var importance []float32
+		if fsggml.TensorType(outputTensors[i].Kind) != fsggml.TensorType(tensor.Kind) {
+			importance = im.Importance(tensor.Name)
+		}
+
+		// importance is given for each column of one matrix, or of each matrix
+		// of a 3D tensor
+		matrices := uint64(1)
+		if len(tensor.Shape) > 2 {
+			matrices = tensor.Shape[2]
+		}
+
+		if n := uint64(len(importance)); importance != nil && n != tensor.Shape[0] && n != tensor.Shape[0]*matrices {
+			return fmt.Errorf("importance matrix of %s has %d values, expected %d per matrix", tensor.Name, n, tensor.Shape[0])
+		}
+
 		outputTensors[i].WriterTo = quantizer{
 			File:       in,
 			offset:     orig.Tensors().Offset + tensor.Offset,
 			from:       tensor,
-			to:         newTensor,
+			to:         outputTensors[i],
 			progressFn: progressFn,
+			importance: importance,
 		}
 	}
 	return fsggml.WriteGGUF(out, kv, outputTensors)
@@ -3,12 +3,18 @@ package server
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
 	fsggml "github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/fs/imatrix"
 	"github.com/ollama/ollama/ml/backend/ggml"
 )
 
@@ -140,6 +146,82 @@ func TestGetTensorNewType(t *testing.T) {
 			ftype:       fsggml.FileTypeQ4_K_M,
 			expected:    fsggml.TensorTypeQ5_K,
 		},
+		{
+			name:        "attn_v.weight_q3_k_m",
+			qs:          quantizeState{},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeQ3_K,
+			tensor_name: "blk.0.attn_v.weight",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeQ3_K_M,
+			expected:    fsggml.TensorTypeQ5_K,
+		},
+		{
+			name: "ffn_down_q2_k",
+			qs: quantizeState{
+				iFfnDown: 5,
+				nFfnDown: 8,
+			},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeQ2_K,
+			tensor_name: "ffn_down",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeQ2_K,
+			expected:    fsggml.TensorTypeQ3_K,
+		},
+		{
+			name:        "attn_v.weight_iq3_xxs",
+			qs:          quantizeState{},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ3_XXS,
+			tensor_name: "blk.0.attn_v.weight",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ3_XXS,
+			expected:    fsggml.TensorTypeIQ3_S,
+		},
+		{
+			name:        "attn_v.weight_iq3_xxs_imatrix",
+			qs:          quantizeState{hasImatrix: true},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ3_XXS,
+			tensor_name: "blk.0.attn_v.weight",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ3_XXS,
+			expected:    fsggml.TensorTypeIQ3_XXS,
+		},
+		{
+			name: "ffn_down_iq2_xxs",
+			qs: quantizeState{
+				iFfnDown: 0,
+				nFfnDown: 8,
+			},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ2_XXS,
+			tensor_name: "ffn_down",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ2_XXS,
+			expected:    fsggml.TensorTypeQ2_K,
+		},
+		{
+			name:        "token_embd_iq2_s",
+			qs:          quantizeState{hasOutput: true},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ2_XS,
+			tensor_name: "token_embd.weight",
+			shape:       []uint64{256},
+			ftype:       fsggml.FileTypeIQ2_S,
+			expected:    fsggml.TensorTypeIQ3_S,
+		},
+		{
+			name:        "iq4_xs_fallback",
+			qs:          quantizeState{},
+			kv:          map[string]any{},
+			newType:     fsggml.TensorTypeIQ4_XS,
+			tensor_name: "blk.0.attn_q.weight",
+			shape:       []uint64{96},
+			ftype:       fsggml.FileTypeIQ4_XS,
+			expected:    fsggml.TensorTypeIQ4_NL,
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
@@ -282,7 +364,7 @@ func TestQuantizeModel(t *testing.T) {
 				t.Fatal(err.Error())
 			}
 
-			err = quantize(fp, tmp, meta, ftype, progress)
+			err = quantize(fp, tmp, meta, ftype, nil, progress)
 			if err != nil {
 				t.Fatalf("error during quantize: %s", err)
 			}
@@ -311,6 +393,128 @@ func TestQuantizeModel(t *testing.T) {
 	}
 }
 
+func TestQuantizeImatrix(t *testing.T) {
+	f16s := func(n int) *bytes.Reader {
+		return bytes.NewReader(bytes.Repeat(quantBytes[fsggml.TensorTypeF16], n))
+	}
+
+	p, _ := createBinFile(t, map[string]any{
+		"general.architecture": "foo",
+	}, []*fsggml.Tensor{
+		{Name: "blk.0.attn_q.weight", Kind: uint32(fsggml.TensorTypeF16), Shape: []uint64{256, 2}, WriterTo: f16s(2)},
+		{Name: "blk.0.attn_norm.weight", Kind: uint32(fsggml.TensorTypeF16), Shape: []uint64{256}, WriterTo: f16s(1)},
+	})
+
+	fp, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	meta, err := fsggml.Decode(fp, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quantizeTo := func(ftype fsggml.FileType, im *imatrix.Matrix) (*fsggml.GGML, error) {
+		out, err := os.CreateTemp(t.TempDir(), "*.gguf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+
+		if err := quantize(fp, out, meta, ftype, im, func(uint64) {}); err != nil {
+			return nil, err
+		}
+
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := fsggml.Decode(out, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f, nil
+	}
+
+	if _, err := quantizeTo(fsggml.FileTypeIQ2_XXS, nil); err == nil || !strings.Contains(err.Error(), "requires an importance matrix") {
+		t.Fatalf("expected error quantizing without importance matrix, got %v", err)
+	}
+
+	im := imatrix.New()
+	if err := im.Add("blk.0.attn_q.weight", slices.Repeat([]float32{1}, 256), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := quantizeTo(fsggml.FileTypeIQ2_XXS, im)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tensor := range f.Tensors().Items() {
+		want := fsggml.TensorTypeIQ2_XXS
+		if tensor.Name == "blk.0.attn_norm.weight" {
+			want = fsggml.TensorTypeF16
+		}
+
+		if got := fsggml.TensorType(tensor.Kind); got != want {
+			t.Errorf("%s: got %s, want %s", tensor.Name, got, want)
+		}
+	}
+
+	t.Run("size mismatch", func(t *testing.T) {
+		im := imatrix.New()
+		if err := im.Add("blk.0.attn_q.weight", []float32{1, 1}, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := quantizeTo(fsggml.FileTypeQ4_K_M, im); err == nil {
+			t.Error("expected error for importance matrix of wrong size")
+		}
+	})
+}
+
+func TestQuantizationPlan(t *testing.T) {
+	p, _ := createBinFile(t, map[string]any{
+		"general.architecture": "foo",
+	}, []*fsggml.Tensor{
+		{Name: "blk.0.attn_q.weight", Kind: uint32(fsggml.TensorTypeF16), Shape: []uint64{256, 2}, WriterTo: bytes.NewReader(make([]byte, 2*256*2))},
+		{Name: "blk.0.attn_norm.weight", Kind: uint32(fsggml.TensorTypeF32), Shape: []uint64{256}, WriterTo: bytes.NewReader(make([]byte, 4*256))},
+		{Name: "output.weight", Kind: uint32(fsggml.TensorTypeF16), Shape: []uint64{256, 2}, WriterTo: bytes.NewReader(make([]byte, 2*256*2))},
+	})
+
+	fp, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	meta, err := fsggml.Decode(fp, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := quantizationPlan(meta, fsggml.FileTypeQ3_K_S, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q3k := int64(fsggml.TensorTypeQ3_K.RowSize(256)) * 2
+	q6k := int64(fsggml.TensorTypeQ6_K.RowSize(256)) * 2
+	if diff := cmp.Diff(&api.QuantizationPlan{
+		Type: "Q3_K_S",
+		Size: q3k + 4*256 + q6k,
+		Tensors: []api.QuantizationTensor{
+			{Name: "blk.0.attn_norm.weight", Shape: []uint64{256}, From: "F32", To: "F32", Size: 4 * 256},
+			{Name: "blk.0.attn_q.weight", Shape: []uint64{256, 2}, From: "F16", To: "Q3_K", Size: q3k},
+			{Name: "output.weight", Shape: []uint64{256, 2}, From: "F16", To: "Q6_K", Size: q6k},
+		},
+	}, plan); diff != "" {
+		t.Errorf("plan mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestConvertToF32(t *testing.T) {
 	expected := make([]float32, 256)
 	for i := range expected {
@@ -0,0 +1,318 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+)
+
+// priority orders pending requests in the scheduler; lower values are served
+// first
+type priority int
+
+const (
+	priorityInteractive priority = iota
+	priorityBatch
+	priorityBackground
+
+	numPriorities
+)
+
+func (p priority) String() string {
+	switch p {
+	case priorityBatch:
+		return api.PriorityBatch
+	case priorityBackground:
+		return api.PriorityBackground
+	default:
+		return api.PriorityInteractive
+	}
+}
+
+func parsePriority(s string) (priority, error) {
+	switch strings.ToLower(s) {
+	case api.PriorityInteractive:
+		return priorityInteractive, nil
+	case api.PriorityBatch:
+		return priorityBatch, nil
+	case api.PriorityBackground:
+		return priorityBackground, nil
+	default:
+		return 0, fmt.Errorf("invalid priority %q, must be one of %s, %s or %s", s, api.PriorityInteractive, api.PriorityBatch, api.PriorityBackground)
+	}
+}
+
+// maxQueue returns the configured maximum number of queued requests at p
+func (p priority) maxQueue() int {
+	var n uint
+	switch p {
+	case priorityInteractive:
+		n = envconfig.MaxQueueInteractive()
+	case priorityBatch:
+		n = envconfig.MaxQueueBatch()
+	case priorityBackground:
+		n = envconfig.MaxQueueBackground()
+	}
+
+	if n == 0 {
+		n = envconfig.MaxQueue()
+	}
+	return int(n)
+}
+
+const (
+	// priorityHeader sets the priority of requests whose body has none, such
+	// as those to the OpenAI compatible endpoints
+	priorityHeader = "X-Ollama-Priority"
+
+	// userHeader identifies the user a request is made on behalf of for fair
+	// queuing. It is only accepted from OLLAMA_TRUSTED_USER_PROXIES, such as
+	// the integrated server setting it from its JWT claims; the client
+	// address is used otherwise.
+	userHeader = "X-Ollama-User"
+)
+
+type queueKey struct{}
+
+// queueInfo is how a request is queued by the scheduler
+type queueInfo struct {
+	priority priority
+	user     string
+}
+
+// withQueueInfo returns the request's context carrying its scheduling
+// priority and user. The priority is taken from the request body, then the
+// priority header, and otherwise defaults to def. The request's context is
+// replaced too, so that it waits for a runner slot with the same schedule.
+func withQueueInfo(c *gin.Context, name string, def priority) (context.Context, error) {
+	if name == "" {
+		name = c.GetHeader(priorityHeader)
+	}
+
+	p := def
+	if name != "" {
+		var err error
+		if p, err = parsePriority(name); err != nil {
+			return nil, err
+		}
+	}
+
+	info := queueInfo{priority: p, user: requestUser(c)}
+	ctx := context.WithValue(c.Request.Context(), queueKey{}, info)
+	ctx = llm.WithSchedule(ctx, llm.Schedule{Priority: int(info.priority), User: info.user})
+	c.Request = c.Request.WithContext(ctx)
+	return ctx, nil
+}
+
+// requestUser returns the user a request is made on behalf of. The user
+// header is ignored unless the request comes from a trusted proxy.
+func requestUser(c *gin.Context) string {
+	if user := c.GetHeader(userHeader); user != "" {
+		if addr, err := netip.ParseAddr(c.RemoteIP()); err == nil {
+			addr = addr.Unmap()
+			for _, prefix := range envconfig.TrustedUserProxies() {
+				if prefix.Contains(addr) {
+					return user
+				}
+			}
+		}
+		slog.Debug("ignoring user header from untrusted client", "client", c.RemoteIP())
+	}
+	return c.ClientIP()
+}
+
+func queueInfoFrom(ctx context.Context) queueInfo {
+	info, _ := ctx.Value(queueKey{}).(queueInfo)
+	return info
+}
+
+// QueueFullError is returned when the queue for a request's priority is at its
+// maximum depth. It matches [ErrMaxQueue].
+type QueueFullError struct {
+	Priority string
+
+	// RetryAfter is an estimate of when the queue will have room
+	RetryAfter time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("server busy, please try again.  maximum pending %s requests exceeded", e.Priority)
+}
+
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrMaxQueue
+}
+
+// waitSmoothing weights the latest wait in the moving average of wait times
+const waitSmoothing = 0.2
+
+// requestQueue holds requests waiting to be scheduled. Requests are served
+// strictly by priority and, within a priority, round robin between users so
+// that one user's burst of requests does not hold up everyone else's. The
+// zero value is an empty queue.
+type requestQueue struct {
+	mu      sync.Mutex
+	classes [numPriorities]userQueues
+}
+
+type userQueues struct {
+	// pending holds each user's requests in arrival order, and users the
+	// round robin order of users with pending requests
+	pending map[string][]*LlmRequest
+	users   []string
+	depth   int
+
+	averageWait time.Duration
+}
+
+// push adds a request to the back of its user's queue, failing if its
+// priority is already at its maximum depth
+func (q *requestQueue) push(req *LlmRequest) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c := &q.classes[req.priority]
+	if c.depth >= req.priority.maxQueue() {
+		c.prune()
+		if c.depth >= req.priority.maxQueue() {
+			return &QueueFullError{Priority: req.priority.String(), RetryAfter: c.averageWait}
+		}
+	}
+
+	if req.enqueuedAt.IsZero() {
+		req.enqueuedAt = time.Now()
+	}
+	c.add(req)
+	return nil
+}
+
+// requeue adds back a request that has already been admitted to the queue,
+// regardless of its depth
+func (q *requestQueue) requeue(req *LlmRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.classes[req.priority].add(req)
+}
+
+// pop removes the next request to schedule, or returns nil if there is none
+func (q *requestQueue) pop() *LlmRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.classes {
+		c := &q.classes[i]
+		if c.depth == 0 {
+			continue
+		}
+
+		user := c.users[0]
+		c.users = c.users[1:]
+
+		reqs := c.pending[user]
+		req := reqs[0]
+		if len(reqs) > 1 {
+			c.pending[user] = reqs[1:]
+			c.users = append(c.users, user)
+		} else {
+			delete(c.pending, user)
+		}
+		c.depth--
+
+		wait := time.Since(req.enqueuedAt)
+		queueWait.WithLabelValues(req.priority.String()).Observe(wait.Seconds())
+		if c.averageWait == 0 {
+			c.averageWait = wait
+		} else {
+			c.averageWait = time.Duration(waitSmoothing*float64(wait) + (1-waitSmoothing)*float64(c.averageWait))
+		}
+
+		return req
+	}
+
+	return nil
+}
+
+func (q *requestQueue) status() []api.QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	status := make([]api.QueueStatus, numPriorities)
+	for i := range q.classes {
+		c := &q.classes[i]
+		p := priority(i)
+
+		var oldest time.Duration
+		for _, reqs := range c.pending {
+			// Each user's requests are in arrival order
+			oldest = max(oldest, now.Sub(reqs[0].enqueuedAt))
+		}
+
+		status[i] = api.QueueStatus{
+			Priority:    p.String(),
+			Depth:       c.depth,
+			MaxDepth:    p.maxQueue(),
+			Users:       len(c.pending),
+			OldestWait:  oldest,
+			AverageWait: c.averageWait,
+		}
+	}
+
+	return status
+}
+
+func (c *userQueues) add(req *LlmRequest) {
+	if c.pending == nil {
+		c.pending = make(map[string][]*LlmRequest)
+	}
+
+	if _, ok := c.pending[req.user]; !ok {
+		c.users = append(c.users, req.user)
+	}
+	c.pending[req.user] = append(c.pending[req.user], req)
+	c.depth++
+}
+
+// prune drops requests whose context is done, which the scheduler would skip
+func (c *userQueues) prune() {
+	for user, reqs := range c.pending {
+		live := reqs[:0]
+		for _, req := range reqs {
+			if req.ctx.Err() == nil {
+				live = append(live, req)
+			}
+		}
+		c.depth -= len(reqs) - len(live)
+
+		if len(live) > 0 {
+			c.pending[user] = live
+		} else {
+			delete(c.pending, user)
+			c.users = slices.DeleteFunc(c.users, func(u string) bool { return u == user })
+		}
+	}
+}
+
+// retryAfter returns the Retry-After value in seconds for a full queue
+func retryAfter(err error) (int, bool) {
+	var qerr *QueueFullError
+	if !errors.As(err, &qerr) {
+		return 0, false
+	}
+
+	return max(1, int(math.Ceil(qerr.RetryAfter.Seconds()))), true
+}
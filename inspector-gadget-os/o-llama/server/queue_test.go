@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+)
+
+func newQueuedRequest(ctx context.Context, name string, p priority, user string) *LlmRequest {
+	return &LlmRequest{
+		ctx:      ctx,
+		model:    &Model{ModelPath: name},
+		priority: p,
+		user:     user,
+	}
+}
+
+func popNames(q *requestQueue) []string {
+	var names []string
+	for req := q.pop(); req != nil; req = q.pop() {
+		names = append(names, req.model.ModelPath)
+	}
+	return names
+}
+
+func TestRequestQueuePriority(t *testing.T) {
+	var q requestQueue
+	for _, req := range []*LlmRequest{
+		newQueuedRequest(t.Context(), "background", priorityBackground, "a"),
+		newQueuedRequest(t.Context(), "batch", priorityBatch, "a"),
+		newQueuedRequest(t.Context(), "interactive", priorityInteractive, "a"),
+	} {
+		require.NoError(t, q.push(req))
+	}
+
+	require.Equal(t, []string{"interactive", "batch", "background"}, popNames(&q))
+}
+
+func TestRequestQueueFairness(t *testing.T) {
+	var q requestQueue
+	for _, req := range []*LlmRequest{
+		newQueuedRequest(t.Context(), "a1", priorityBatch, "a"),
+		newQueuedRequest(t.Context(), "a2", priorityBatch, "a"),
+		newQueuedRequest(t.Context(), "a3", priorityBatch, "a"),
+		newQueuedRequest(t.Context(), "b1", priorityBatch, "b"),
+		newQueuedRequest(t.Context(), "c1", priorityBatch, "c"),
+		newQueuedRequest(t.Context(), "b2", priorityBatch, "b"),
+	} {
+		require.NoError(t, q.push(req))
+	}
+
+	require.Equal(t, []string{"a1", "b1", "c1", "a2", "b2", "a3"}, popNames(&q))
+}
+
+func TestRequestQueueFull(t *testing.T) {
+	t.Setenv("OLLAMA_MAX_QUEUE", "3")
+	t.Setenv("OLLAMA_MAX_QUEUE_BATCH", "2")
+
+	var q requestQueue
+	ctx, cancel := context.WithCancel(t.Context())
+	require.NoError(t, q.push(newQueuedRequest(ctx, "a1", priorityBatch, "a")))
+	require.NoError(t, q.push(newQueuedRequest(t.Context(), "a2", priorityBatch, "a")))
+
+	err := q.push(newQueuedRequest(t.Context(), "a3", priorityBatch, "a"))
+	var qerr *QueueFullError
+	require.ErrorAs(t, err, &qerr)
+	require.ErrorIs(t, err, ErrMaxQueue)
+	require.Equal(t, api.PriorityBatch, qerr.Priority)
+
+	// Other priorities have their own limits
+	require.NoError(t, q.push(newQueuedRequest(t.Context(), "i1", priorityInteractive, "a")))
+
+	// Canceled requests no longer count once the queue is full
+	cancel()
+	require.NoError(t, q.push(newQueuedRequest(t.Context(), "a3", priorityBatch, "a")))
+
+	status := q.status()
+	require.Len(t, status, int(numPriorities))
+	require.Equal(t, api.PriorityInteractive, status[0].Priority)
+	require.Equal(t, 1, status[0].Depth)
+	require.Equal(t, 3, status[0].MaxDepth)
+	require.Equal(t, 2, status[1].Depth)
+	require.Equal(t, 2, status[1].MaxDepth)
+	require.Equal(t, 1, status[1].Users)
+	require.Equal(t, 0, status[2].Depth)
+
+	require.Equal(t, []string{"i1", "a2", "a3"}, popNames(&q))
+}
+
+func TestGetRunnerPriority(t *testing.T) {
+	ctx, done := context.WithTimeout(t.Context(), 3*time.Second)
+	defer done()
+
+	s := InitScheduler(ctx)
+	batch := context.WithValue(ctx, queueKey{}, queueInfo{priority: priorityBatch, user: "a"})
+	interactive := context.WithValue(ctx, queueKey{}, queueInfo{priority: priorityInteractive, user: "b"})
+
+	_, errCh := s.GetRunner(batch, &Model{ModelPath: "batch"}, api.DefaultOptions(), nil)
+	require.Empty(t, errCh)
+	_, errCh = s.GetRunner(interactive, &Model{ModelPath: "interactive"}, api.DefaultOptions(), nil)
+	require.Empty(t, errCh)
+
+	// The interactive request is scheduled first even though it arrived last
+	req := s.nextPending(ctx)
+	require.NotNil(t, req)
+	require.Equal(t, "interactive", req.model.ModelPath)
+	require.Equal(t, "b", req.user)
+
+	req = s.nextPending(ctx)
+	require.NotNil(t, req)
+	require.Equal(t, "batch", req.model.ModelPath)
+
+	// Wake ups for requests already scheduled are ignored
+	require.Nil(t, s.queue.pop())
+	require.Empty(t, s.pendingReqCh)
+}
+
+func TestWithQueueInfo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name     string
+		body     string
+		header   http.Header
+		remote   string
+		priority priority
+		user     string
+		err      bool
+	}{
+		{name: "default", priority: priorityBatch, user: "192.0.2.1"},
+		{name: "body", body: "Background", priority: priorityBackground, user: "192.0.2.1"},
+		{name: "header", header: http.Header{priorityHeader: {"interactive"}, userHeader: {"alice"}}, remote: "127.0.0.1:1234", priority: priorityInteractive, user: "alice"},
+		{name: "untrusted user", header: http.Header{userHeader: {"alice"}}, priority: priorityBatch, user: "192.0.2.1"},
+		{name: "body over header", body: "batch", header: http.Header{priorityHeader: {"background"}}, priority: priorityBatch, user: "192.0.2.1"},
+		{name: "invalid", body: "urgent", err: true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/embed", nil)
+			c.Request.RemoteAddr = "192.0.2.1:1234"
+			if tt.remote != "" {
+				c.Request.RemoteAddr = tt.remote
+			}
+			for k, v := range tt.header {
+				c.Request.Header[k] = v
+			}
+
+			ctx, err := withQueueInfo(c, tt.body, priorityBatch)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, queueInfo{priority: tt.priority, user: tt.user}, queueInfoFrom(ctx))
+			require.Equal(t, llm.Schedule{Priority: int(tt.priority), User: tt.user}, llm.ScheduleFrom(c.Request.Context()))
+		})
+	}
+}
+
+func TestHandleScheduleErrorQueueFull(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	handleScheduleError(c, "test", &QueueFullError{Priority: api.PriorityBatch, RetryAfter: 1500 * time.Millisecond})
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	handleScheduleError(c, "test", fmt.Errorf("scheduling: %w", &QueueFullError{Priority: api.PriorityBatch}))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+}
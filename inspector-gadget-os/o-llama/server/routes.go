@@ -17,7 +17,9 @@ import (
 	"net/netip"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -25,16 +27,18 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/image/webp"
-	"golang.org/x/sync/errgroup"
 
+	"github.com/ollama/ollama/anthropic"
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/discover"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/grammar"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/logutil"
 	"github.com/ollama/ollama/openai"
+	"github.com/ollama/ollama/server/internal/cache/blob"
 	"github.com/ollama/ollama/server/internal/client/ollama"
 	"github.com/ollama/ollama/server/internal/registry"
 	"github.com/ollama/ollama/template"
@@ -61,6 +65,11 @@ type Server struct {
 	addr    net.Addr
 	sched   *Scheduler
 	lowVRAM bool
+	batches *batchQueue
+
+	embeds      *embedBatcher
+	embedCache  *embedCache
+	collections *collectionStore
 }
 
 func init() {
@@ -78,6 +87,7 @@ func init() {
 var (
 	errRequired    = errors.New("is required")
 	errBadTemplate = errors.New("template error")
+	errDraftModel  = errors.New("draft model not found")
 )
 
 func modelOptions(model *Model, requestOpts map[string]any) (api.Options, error) {
@@ -146,6 +156,16 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	if req.TopLogprobs < 0 || req.TopLogprobs > api.MaxTopLogprobs {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("top_logprobs must be between 0 and %d", api.MaxTopLogprobs)})
+		return
+	}
+
+	if _, err := grammar.FromFormat(req.Format); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	name := model.ParseName(req.Model)
 	if !name.IsValid() {
 		// Ideally this is "invalid model name" but we're keeping with
@@ -221,7 +241,13 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		// updated template supporting thinking
 	}
 
-	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Options, req.KeepAlive)
+	ctx, err := withQueueInfo(c, req.Priority, priorityInteractive)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r, m, opts, err := s.scheduleRunner(ctx, name.String(), caps, req.Options, req.KeepAlive)
 	if errors.Is(err, errCapabilityCompletion) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support generate", req.Model)})
 		return
@@ -330,12 +356,23 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		// TODO (jmorganca): avoid building the response twice both here and below
 		var sb strings.Builder
 		defer close(ch)
+
+		// parsers may hold back content, so logprobs are sent with the next response
+		var logprobs []api.Logprob
+		send := func(res api.GenerateResponse) {
+			res.Logprobs, logprobs = logprobs, nil
+			ch <- res
+		}
+
 		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
-			Prompt:  prompt,
-			Images:  images,
-			Format:  req.Format,
-			Options: opts,
-		}, func(cr llm.CompletionResponse) {
+			Prompt:      prompt,
+			Images:      images,
+			Format:      req.Format,
+			Options:     opts,
+			Logprobs:    req.Logprobs,
+			TopLogprobs: req.TopLogprobs,
+		}, observeCompletion(m.ShortName, opts.NumCtx, func(cr llm.CompletionResponse) {
+			logprobs = append(logprobs, cr.Logprobs...)
 			res := api.GenerateResponse{
 				Model:     req.Model,
 				CreatedAt: time.Now().UTC(),
@@ -346,6 +383,8 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 					PromptEvalDuration: cr.PromptEvalDuration,
 					EvalCount:          cr.EvalCount,
 					EvalDuration:       cr.EvalDuration,
+					DraftCount:         cr.DraftCount,
+					DraftAcceptedCount: cr.DraftAcceptedCount,
 				},
 			}
 
@@ -401,20 +440,21 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 			if useHarmony {
 				// only send messages with meaningful content (empty messages confuse clients)
 				if res.Response != "" || res.Thinking != "" || res.Done || len(res.ToolCalls) > 0 {
-					ch <- res
+					send(res)
 				}
 
 				return
 			}
 
-			ch <- res
-		}); err != nil {
+			send(res)
+		})); err != nil {
 			ch <- gin.H{"error": err.Error()}
 		}
 	}()
 
 	if req.Stream != nil && !*req.Stream {
 		var r api.GenerateResponse
+		var logprobs []api.Logprob
 		var sbThinking strings.Builder
 		var sbContent strings.Builder
 		for rr := range ch {
@@ -422,6 +462,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 			case api.GenerateResponse:
 				sbThinking.WriteString(t.Thinking)
 				sbContent.WriteString(t.Response)
+				logprobs = append(logprobs, t.Logprobs...)
 				r = t
 			case gin.H:
 				msg, ok := t["error"].(string)
@@ -439,6 +480,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 
 		r.Thinking = sbThinking.String()
 		r.Response = sbContent.String()
+		r.Logprobs = logprobs
 
 		c.JSON(http.StatusOK, r)
 		return
@@ -448,7 +490,6 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 }
 
 func (s *Server) EmbedHandler(c *gin.Context) {
-	checkpointStart := time.Now()
 	var req api.EmbedRequest
 	err := c.ShouldBindJSON(&req)
 	switch {
@@ -460,12 +501,6 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		return
 	}
 
-	truncate := true
-
-	if req.Truncate != nil && !*req.Truncate {
-		truncate = false
-	}
-
 	var input []string
 
 	switch i := req.Input.(type) {
@@ -488,84 +523,11 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		}
 	}
 
-	name, err := getExistingName(model.ParseName(req.Model))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
-		return
-	}
-
-	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{}, req.Options, req.KeepAlive)
-	if err != nil {
-		handleScheduleError(c, req.Model, err)
-		return
-	}
-
-	checkpointLoaded := time.Now()
-
-	if len(input) == 0 {
-		c.JSON(http.StatusOK, api.EmbedResponse{Model: req.Model, Embeddings: [][]float32{}})
-		return
-	}
-
-	kvData, _, err := getModelData(m.ModelPath, false)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	var count int
-	for i, s := range input {
-		tokens, err := r.Tokenize(c.Request.Context(), s)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		ctxLen := min(opts.NumCtx, int(kvData.ContextLength()))
-		if len(tokens) > ctxLen {
-			if !truncate {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "input length exceeds maximum context length"})
-				return
-			}
-
-			tokens = tokens[:ctxLen]
-			s, err = r.Detokenize(c.Request.Context(), tokens)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-		}
-
-		count += len(tokens)
-
-		input[i] = s
-	}
-
-	var g errgroup.Group
-	embeddings := make([][]float32, len(input))
-	for i, text := range input {
-		g.Go(func() error {
-			embedding, err := r.Embedding(c.Request.Context(), text)
-			if err != nil {
-				return err
-			}
-			embeddings[i] = normalize(embedding)
-			return nil
-		})
-	}
-
-	if err := g.Wait(); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": strings.TrimSpace(err.Error())})
+	resp, ok := s.embed(c, req, input)
+	if !ok {
 		return
 	}
 
-	resp := api.EmbedResponse{
-		Model:           req.Model,
-		Embeddings:      embeddings,
-		TotalDuration:   time.Since(checkpointStart),
-		LoadDuration:    checkpointLoaded.Sub(checkpointStart),
-		PromptEvalCount: count,
-	}
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -602,7 +564,13 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 		return
 	}
 
-	r, _, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []model.Capability{}, req.Options, req.KeepAlive)
+	ctx, err := withQueueInfo(c, req.Priority, priorityBatch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r, _, _, err := s.scheduleRunner(ctx, name.String(), []model.Capability{}, req.Options, req.KeepAlive)
 	if err != nil {
 		handleScheduleError(c, req.Model, err)
 		return
@@ -803,6 +771,12 @@ func (s *Server) DeleteHandler(c *gin.Context) {
 		return
 	}
 
+	if !blobsMu.TryLock() {
+		slog.Info("leaving layers of deleted model for gc while a pull, create or import is in progress", "model", n.DisplayShortest())
+		return
+	}
+	defer blobsMu.Unlock()
+
 	if err := m.RemoveLayers(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -892,6 +866,7 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 		Messages:     msgs,
 		Capabilities: m.Capabilities(),
 		ModifiedAt:   manifest.fi.ModTime(),
+		Provenance:   modelProvenance(manifest),
 	}
 
 	var params []string
@@ -1115,7 +1090,9 @@ func (s *Server) CreateBlobHandler(c *gin.Context) {
 		return
 	}
 
+	blobsMu.RLock()
 	layer, err := NewLayer(c.Request.Body, "")
+	blobsMu.RUnlock()
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1248,6 +1225,7 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.Use(
 		cors.New(corsConfig),
 		allowedHostsMiddleware(s.addr),
+		metricsMiddleware,
 	)
 
 	// General
@@ -1255,6 +1233,7 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "Ollama is running") })
 	r.HEAD("/api/version", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": version.Version}) })
 	r.GET("/api/version", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": version.Version}) })
+	r.GET("/metrics", s.MetricsHandler)
 
 	// Local model cache management (new implementation is at end of function)
 	r.POST("/api/pull", s.PullHandler)
@@ -1263,20 +1242,37 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.GET("/api/tags", s.ListHandler)
 	r.POST("/api/show", s.ShowHandler)
 	r.DELETE("/api/delete", s.DeleteHandler)
+	r.GET("/api/storage", s.StorageHandler)
+	r.POST("/api/gc", s.GCHandler)
 
 	// Create
 	r.POST("/api/create", s.CreateHandler)
+	r.POST("/api/imatrix", s.ImatrixHandler)
 	r.POST("/api/blobs/:digest", s.CreateBlobHandler)
 	r.HEAD("/api/blobs/:digest", s.HeadBlobHandler)
 	r.POST("/api/copy", s.CopyHandler)
+	r.POST("/api/export", s.ExportHandler)
+	r.POST("/api/import", s.ImportHandler)
 
 	// Inference
 	r.GET("/api/ps", s.PsHandler)
 	r.POST("/api/generate", s.GenerateHandler)
 	r.POST("/api/chat", s.ChatHandler)
+	s.embeds = newEmbedBatcher()
+	s.embedCache = newEmbedCache(int(envconfig.EmbedCacheSize()))
 	r.POST("/api/embed", s.EmbedHandler)
 	r.POST("/api/embeddings", s.EmbeddingsHandler)
 
+	// Collections
+	s.collections = newCollectionStore(filepath.Join(envconfig.Models(), "collections"))
+	r.POST("/api/collections", s.CreateCollectionHandler)
+	r.GET("/api/collections", s.ListCollectionsHandler)
+	r.GET("/api/collections/:name", s.CollectionHandler)
+	r.DELETE("/api/collections/:name", s.DeleteCollectionHandler)
+	r.POST("/api/collections/:name/documents", s.UpsertDocumentsHandler)
+	r.DELETE("/api/collections/:name/documents", s.DeleteDocumentsHandler)
+	r.POST("/api/collections/:name/query", s.QueryCollectionHandler)
+
 	// Inference (OpenAI compatibility)
 	r.POST("/v1/chat/completions", openai.ChatMiddleware(), s.ChatHandler)
 	r.POST("/v1/completions", openai.CompletionsMiddleware(), s.GenerateHandler)
@@ -1284,6 +1280,48 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.GET("/v1/models", openai.ListMiddleware(), s.ListHandler)
 	r.GET("/v1/models/:model", openai.RetrieveMiddleware(), s.ShowHandler)
 
+	var responses *openai.ResponseStore
+	if !envconfig.NoResponseStore() {
+		responses = openai.NewResponseStore(filepath.Join(envconfig.Models(), "responses.db"))
+	}
+
+	r.POST("/v1/responses", openai.ResponsesMiddleware(responses), s.ChatHandler)
+	r.GET("/v1/responses/:id", openai.RetrieveResponseHandler(responses))
+	r.DELETE("/v1/responses/:id", openai.DeleteResponseHandler(responses))
+
+	// Inference (Anthropic compatibility)
+	r.POST("/v1/messages", anthropic.MessagesMiddleware(), s.ChatHandler)
+
+	// Batches
+	s.batches = newBatchQueue(filepath.Join(envconfig.Models(), "batches"), r)
+	r.POST("/api/batches", s.CreateBatchHandler)
+	r.GET("/api/batches", s.ListBatchesHandler)
+	r.GET("/api/batches/:id", s.BatchHandler)
+	r.POST("/api/batches/:id/cancel", s.CancelBatchHandler)
+	r.GET("/api/batches/:id/results", s.BatchResultsHandler)
+
+	// Batches (OpenAI compatibility)
+	r.POST("/v1/files", s.CreateFileHandler)
+	r.GET("/v1/files", s.ListFilesHandler)
+	r.GET("/v1/files/:id", s.FileHandler)
+	r.GET("/v1/files/:id/content", s.FileContentHandler)
+	r.DELETE("/v1/files/:id", s.DeleteFileHandler)
+	r.POST("/v1/batches", s.CreateOpenAIBatchHandler)
+	r.GET("/v1/batches", s.ListOpenAIBatchesHandler)
+	r.GET("/v1/batches/:id", s.OpenAIBatchHandler)
+	r.POST("/v1/batches/:id/cancel", s.CancelOpenAIBatchHandler)
+
+	if envconfig.RegistryServe() {
+		c, err := blob.Open(envconfig.Models())
+		if err != nil {
+			return nil, err
+		}
+
+		mirror := gin.WrapH(&registry.Mirror{Cache: c, Logger: slog.Default()})
+		r.GET("/v2/*path", mirror)
+		r.HEAD("/v2/*path", mirror)
+	}
+
 	if rc != nil {
 		// wrap old with new
 		rs := &registry.Local{
@@ -1291,7 +1329,8 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 			Logger:   slog.Default(), // TODO(bmizerany): Take a logger, do not use slog.Default()
 			Fallback: r,
 
-			Prune: PruneLayers,
+			Prune:    PruneLayers,
+			PullLock: blobsMu.RLocker(),
 		}
 		return rs, nil
 	}
@@ -1380,6 +1419,10 @@ func Serve(ln net.Listener) error {
 
 	s.sched.Run(schedCtx)
 
+	if err := s.batches.start(schedCtx); err != nil {
+		slog.Warn("failed to resume batches", "error", err)
+	}
+
 	// register the experimental webp decoder
 	// so webp images can be used in multimodal inputs
 	image.RegisterFormat("webp", "RIFF????WEBP", webp.Decode, webp.DecodeConfig)
@@ -1501,7 +1544,7 @@ func (s *Server) PsHandler(c *gin.Context) {
 		return cmp.Compare(j.ExpiresAt.Unix(), i.ExpiresAt.Unix())
 	})
 
-	c.JSON(http.StatusOK, api.ProcessResponse{Models: models})
+	c.JSON(http.StatusOK, api.ProcessResponse{Models: models, Queues: s.sched.QueueStatus()})
 }
 
 func (s *Server) ChatHandler(c *gin.Context) {
@@ -1516,6 +1559,16 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
+	if req.TopLogprobs < 0 || req.TopLogprobs > api.MaxTopLogprobs {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("top_logprobs must be between 0 and %d", api.MaxTopLogprobs)})
+		return
+	}
+
+	if _, err := grammar.FromFormat(req.Format); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// expire the runner
 	if len(req.Messages) == 0 && req.KeepAlive != nil && int(req.KeepAlive.Seconds()) == 0 {
 		model, err := GetModel(req.Model)
@@ -1561,7 +1614,13 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
-	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Options, req.KeepAlive)
+	ctx, err := withQueueInfo(c, req.Priority, priorityInteractive)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r, m, opts, err := s.scheduleRunner(ctx, name.String(), caps, req.Options, req.KeepAlive)
 	if errors.Is(err, errCapabilityCompletion) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support chat", req.Model)})
 		return
@@ -1589,6 +1648,11 @@ func (s *Server) ChatHandler(c *gin.Context) {
 	}
 	msgs = filterThinkTags(msgs, m)
 
+	// tools set with TOOLS in the Modelfile are the default
+	if len(req.Tools) == 0 && len(m.Tools) > 0 && slices.Contains(m.Template.Vars(), "tools") {
+		req.Tools = m.Tools
+	}
+
 	prompt, images, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, req.Tools, req.Think)
 	if err != nil {
 		slog.Error("chat prompt error", "error", err)
@@ -1635,12 +1699,22 @@ func (s *Server) ChatHandler(c *gin.Context) {
 	go func() {
 		defer close(ch)
 
+		// parsers may hold back content, so logprobs are sent with the next response
+		var logprobs []api.Logprob
+		send := func(res api.ChatResponse) {
+			res.Logprobs, logprobs = logprobs, nil
+			ch <- res
+		}
+
 		if err := r.Completion(c.Request.Context(), llm.CompletionRequest{
-			Prompt:  prompt,
-			Images:  images,
-			Format:  req.Format,
-			Options: opts,
-		}, func(r llm.CompletionResponse) {
+			Prompt:      prompt,
+			Images:      images,
+			Format:      req.Format,
+			Options:     opts,
+			Logprobs:    req.Logprobs,
+			TopLogprobs: req.TopLogprobs,
+		}, observeCompletion(m.ShortName, opts.NumCtx, func(r llm.CompletionResponse) {
+			logprobs = append(logprobs, r.Logprobs...)
 			res := api.ChatResponse{
 				Model:     req.Model,
 				CreatedAt: time.Now().UTC(),
@@ -1651,6 +1725,8 @@ func (s *Server) ChatHandler(c *gin.Context) {
 					PromptEvalDuration: r.PromptEvalDuration,
 					EvalCount:          r.EvalCount,
 					EvalDuration:       r.EvalDuration,
+					DraftCount:         r.DraftCount,
+					DraftAcceptedCount: r.DraftAcceptedCount,
 				},
 			}
 			if r.Done {
@@ -1680,7 +1756,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 
 				// only send messages with meaningful content (empty messages confuse clients)
 				if res.Message.Content != "" || res.Message.Thinking != "" || len(res.Message.ToolCalls) > 0 || res.Done {
-					ch <- res
+					send(res)
 				}
 
 				return
@@ -1708,14 +1784,14 @@ func (s *Server) ChatHandler(c *gin.Context) {
 				} else {
 					if r.Done {
 						res.Message.Content = toolParser.Content()
-						ch <- res
+						send(res)
 					}
 					return
 				}
 			}
 
-			ch <- res
-		}); err != nil {
+			send(res)
+		})); err != nil {
 			ch <- gin.H{"error": err.Error()}
 		}
 	}()
@@ -1723,6 +1799,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 	if req.Stream != nil && !*req.Stream {
 		var resp api.ChatResponse
 		var toolCalls []api.ToolCall
+		var logprobs []api.Logprob
 		var sbThinking strings.Builder
 		var sbContent strings.Builder
 		for rr := range ch {
@@ -1730,6 +1807,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			case api.ChatResponse:
 				sbThinking.WriteString(t.Message.Thinking)
 				sbContent.WriteString(t.Message.Content)
+				logprobs = append(logprobs, t.Logprobs...)
 				resp = t
 				if len(req.Tools) > 0 {
 					toolCalls = append(toolCalls, t.Message.ToolCalls...)
@@ -1750,6 +1828,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 
 		resp.Message.Content = sbContent.String()
 		resp.Message.Thinking = sbThinking.String()
+		resp.Logprobs = logprobs
 
 		if len(toolCalls) > 0 {
 			resp.Message.ToolCalls = toolCalls
@@ -1769,6 +1848,11 @@ func handleScheduleError(c *gin.Context, name string, err error) {
 	case errors.Is(err, context.Canceled):
 		c.JSON(499, gin.H{"error": "request canceled"})
 	case errors.Is(err, ErrMaxQueue):
+		if seconds, ok := retryAfter(err); ok {
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 	case errors.Is(err, os.ErrNotExist):
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found, try pulling it first", name)})
@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"slices"
 	"strings"
 	"testing"
@@ -20,6 +21,8 @@ import (
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/fs/imatrix"
+	"github.com/ollama/ollama/parser"
 )
 
 var stream bool = false
@@ -523,6 +526,133 @@ func TestCreateReplacesMessages(t *testing.T) {
 	}
 }
 
+func TestCreateTools(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	var s Server
+
+	tools := []api.Tool{
+		{Type: "function", Function: api.ToolFunction{Name: "get_weather", Description: "Get the weather"}},
+	}
+
+	_, digest := createBinFile(t, nil, nil)
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:   "test-draft",
+		Files:  map[string]string{"test.gguf": digest},
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:       "test",
+		Files:      map[string]string{"test.gguf": digest},
+		Parameters: map[string]any{"draft_model": "test-draft"},
+		Tools:      tools,
+		Stream:     &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(tools, m.Tools) {
+		t.Errorf("expected tools %v, actual %v", tools, m.Tools)
+	}
+
+	// the generated Modelfile round trips through the parser
+	modelfile, err := parser.ParseFile(strings.NewReader(m.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := modelfile.CreateRequest("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(tools, r.Tools) {
+		t.Errorf("expected tools %v, actual %v", tools, r.Tools)
+	}
+
+	if r.Parameters["draft_model"] != "test-draft" {
+		t.Errorf("expected draft model test-draft, got %v", r.Parameters["draft_model"])
+	}
+}
+
+func TestCreateDraftModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	var s Server
+
+	vocab := func(tokens ...string) ggml.KV {
+		return ggml.KV{
+			"general.architecture":         "llama",
+			"tokenizer.ggml.model":         "gpt2",
+			"tokenizer.ggml.tokens":        tokens,
+			"tokenizer.ggml.bos_token_id":  uint32(0),
+			"tokenizer.ggml.eos_token_id":  uint32(1),
+			"tokenizer.ggml.token_type":    make([]int32, len(tokens)),
+			"tokenizer.ggml.add_bos_token": true,
+		}
+	}
+
+	_, mainDigest := createBinFile(t, vocab("<s>", "</s>", "a", "b"), nil)
+	_, draftDigest := createBinFile(t, vocab("<s>", "</s>", "a", "b", "c"), nil)
+	_, otherDigest := createBinFile(t, vocab("<s>", "</s>", "b", "a"), nil)
+
+	for name, digest := range map[string]string{"draft": draftDigest, "other": otherDigest} {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:   name,
+			Files:  map[string]string{"test.gguf": digest},
+			Stream: &stream,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+	}
+
+	cases := []struct {
+		draft string
+		code  int
+		err   string
+	}{
+		{"draft", http.StatusOK, ""},
+		{"missing", http.StatusBadRequest, "draft model not found: missing"},
+		{"other", http.StatusBadRequest, "draft model vocabulary does not match: other token 2"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.draft, func(t *testing.T) {
+			w := createRequest(t, s.CreateHandler, api.CreateRequest{
+				Name:       "test",
+				Files:      map[string]string{"test.gguf": mainDigest},
+				Parameters: map[string]any{"draft_model": tt.draft},
+				Stream:     &stream,
+			})
+
+			if w.Code != tt.code {
+				t.Fatalf("expected status code %d, actual %d: %s", tt.code, w.Code, w.Body.String())
+			}
+
+			if tt.err != "" && !strings.Contains(w.Body.String(), tt.err) {
+				t.Errorf("expected error %q, actual %s", tt.err, w.Body.String())
+			}
+		})
+	}
+}
+
 func TestCreateTemplateSystem(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -671,7 +801,7 @@ func TestCreateDetectTemplate(t *testing.T) {
 	t.Setenv("OLLAMA_MODELS", p)
 	var s Server
 
-	t.Run("matched", func(t *testing.T) {
+	t.Run("converted", func(t *testing.T) {
 		_, digest := createBinFile(t, ggml.KV{
 			"tokenizer.chat_template": "{{ bos_token }}{% for message in messages %}{{'<|' + message['role'] + '|>' + '\n' + message['content'] + '<|end|>\n' }}{% endfor %}{% if add_generation_prompt %}{{ '<|assistant|>\n' }}{% else %}{{ eos_token }}{% endif %}",
 		}, nil)
@@ -687,9 +817,31 @@ func TestCreateDetectTemplate(t *testing.T) {
 
 		checkFileExists(t, filepath.Join(p, "blobs", "*"), []string{
 			filepath.Join(p, "blobs", "sha256-0d79f567714c62c048378f2107fb332dabee0135d080c302d884317da9433cc5"),
-			filepath.Join(p, "blobs", "sha256-35360843d0c84fb1506952a131bbef13cd2bb4a541251f22535170c05b56e672"),
+			filepath.Join(p, "blobs", "sha256-103c7d0c375540fe35f39c2090749fe1c9ab37095e0660bc7bf95ce2069144aa"),
 			filepath.Join(p, "blobs", "sha256-553c4a3f747b3d22a4946875f1cc8ed011c2930d83f864a0c7265f9ec0a20413"),
-			filepath.Join(p, "blobs", "sha256-de3959f841e9ef6b4b6255fa41cb9e0a45da89c3066aa72bdd07a4747f848990"),
+			filepath.Join(p, "blobs", "sha256-935bcfafa3514c82da1b79cbb388fe31bab60a42be93dcc61615dd51ac523971"),
+		})
+	})
+
+	t.Run("matched", func(t *testing.T) {
+		_, digest := createBinFile(t, ggml.KV{
+			"tokenizer.chat_template": "{{ bos_token }}{% for message in messages %}{{ 'GPT4 Correct ' + message['role'].title() + ': ' + message['content'] + '<|end_of_turn|>'}}{% endfor %}{% if add_generation_prompt %}{{ 'GPT4 Correct Assistant:' }}{% endif %}",
+		}, nil)
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:   "test",
+			Files:  map[string]string{"test.gguf": digest},
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		checkFileExists(t, filepath.Join(p, "blobs", "*"), []string{
+			filepath.Join(p, "blobs", "sha256-047d6b7fe5d61aff0014d7e54a40dab72bace1db0c70302185857765e6d0f620"),
+			filepath.Join(p, "blobs", "sha256-40c59278652c1b897e9c66209982288bbb6fe17c3cac5e414383d2904f609289"),
+			filepath.Join(p, "blobs", "sha256-a458bb6d7ac5a11a4f61963757bcf3d046c3b5d558f3c08894ede957fe93669c"),
+			filepath.Join(p, "blobs", "sha256-e4ef0210ea1e3e5794d5cc22e95b85f97cfa0be15c3d18ad4b20e6915dcc2266"),
 		})
 	})
 
@@ -808,3 +960,112 @@ func TestDetectModelTypeFromFiles(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateQuantize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	var s Server
+
+	_, digest := createBinFile(t, map[string]any{
+		"general.architecture": "foo",
+		"general.file_type":    uint32(ggml.FileTypeF16),
+	}, []*ggml.Tensor{
+		{Name: "blk.0.attn_q.weight", Kind: uint32(ggml.TensorTypeF16), Shape: []uint64{256, 2}, WriterTo: bytes.NewReader(make([]byte, 2*256*2))},
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:    "test",
+			Files:    map[string]string{"test.gguf": digest},
+			Quantize: "q3_k_s",
+			DryRun:   true,
+			Stream:   &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.ProgressResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Quantization == nil || resp.Quantization.Type != "Q3_K_S" || len(resp.Quantization.Tensors) != 1 || resp.Quantization.Tensors[0].To != "Q3_K" {
+			t.Fatalf("unexpected plan %+v", resp.Quantization)
+		}
+
+		checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{})
+	})
+
+	t.Run("requires quantize", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:  "test",
+			Files:  map[string]string{"test.gguf": digest},
+			DryRun: true,
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d", w.Code)
+		}
+	})
+
+	t.Run("requires imatrix", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:    "test",
+			Files:    map[string]string{"test.gguf": digest},
+			Quantize: "iq2_xxs",
+			Stream:   &stream,
+		})
+
+		if w.Code == http.StatusOK || !strings.Contains(w.Body.String(), "requires an importance matrix") {
+			t.Fatalf("expected error, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("imatrix", func(t *testing.T) {
+		im := imatrix.New()
+		if err := im.Add("blk.0.attn_q.weight", slices.Repeat([]float32{1}, 256), 1); err != nil {
+			t.Fatal(err)
+		}
+
+		f := filepath.Join(t.TempDir(), "imatrix.gguf")
+		if err := im.WriteFile(f); err != nil {
+			t.Fatal(err)
+		}
+
+		bts, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imatrixDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(bts))
+		if err := createLink(f, filepath.Join(p, "blobs", "sha256-"+strings.TrimPrefix(imatrixDigest, "sha256:"))); err != nil {
+			t.Fatal(err)
+		}
+
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Model:    "test",
+			Files:    map[string]string{"test.gguf": digest},
+			Quantize: "iq2_xxs",
+			Imatrix:  imatrixDigest,
+			Stream:   &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body)
+		}
+
+		m, err := GetModel("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m.Config.FileType != "IQ2_XXS" {
+			t.Errorf("expected file type IQ2_XXS, got %s", m.Config.FileType)
+		}
+	})
+}
@@ -173,6 +173,24 @@ func TestGenerateChat(t *testing.T) {
 		}
 	})
 
+	t.Run("unsupported format schema", func(t *testing.T) {
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test",
+			Messages: []api.Message{
+				{Role: "user", Content: "Hello!"},
+			},
+			Format: json.RawMessage(`{"type": "object", "properties": {"n": {"type": "integer", "multipleOf": 2}}}`),
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+
+		if diff := cmp.Diff(w.Body.String(), `{"error":"invalid JSON schema in format: schema at /properties/n: multipleOf is not supported"}`); diff != "" {
+			t.Errorf("mismatch (-got +want):\n%s", diff)
+		}
+	})
+
 	t.Run("missing capabilities chat", func(t *testing.T) {
 		_, digest := createBinFile(t, ggml.KV{
 			"general.architecture": "bert",
@@ -376,6 +394,36 @@ func TestGenerateChat(t *testing.T) {
 		checkChatResponse(t, w.Body, "test-system", "Abra kadabra!")
 	})
 
+	w = createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: "test-tools",
+		From:  "test",
+		Tools: []api.Tool{{Type: "function", Function: api.ToolFunction{Name: "get_time"}}},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	t.Run("messages with model tools", func(t *testing.T) {
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model: "test-tools",
+			Messages: []api.Message{
+				{Role: "user", Content: "Hello!"},
+			},
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+
+		if !strings.Contains(mock.CompletionRequest.Prompt, "get_time") {
+			t.Errorf("expected model tools in prompt, got %q", mock.CompletionRequest.Prompt)
+		}
+
+		checkChatResponse(t, w.Body, "test-tools", "Abra kadabra!")
+	})
+
 	t.Run("messages with tools (non-streaming)", func(t *testing.T) {
 		if w.Code != http.StatusOK {
 			t.Fatalf("failed to create test-system model: %d", w.Code)
@@ -593,6 +641,61 @@ func TestGenerateChat(t *testing.T) {
 			t.Errorf("final tool call mismatch (-got +want):\n%s", diff)
 		}
 	})
+
+	t.Run("logprobs", func(t *testing.T) {
+		mock.CompletionFn = func(ctx context.Context, r llm.CompletionRequest, fn func(r llm.CompletionResponse)) error {
+			fn(llm.CompletionResponse{
+				Content:  "Hi",
+				Logprobs: []api.Logprob{{TokenLogprob: api.TokenLogprob{Token: "Hi", Logprob: -0.1}}},
+			})
+			fn(llm.CompletionResponse{
+				Content:  "!",
+				Logprobs: []api.Logprob{{TokenLogprob: api.TokenLogprob{Token: "!", Logprob: -0.2}}},
+			})
+			fn(llm.CompletionResponse{Done: true, DoneReason: llm.DoneReasonStop})
+			return nil
+		}
+		defer func() { mock.CompletionFn = nil }()
+
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model:       "test",
+			Messages:    []api.Message{{Role: "user", Content: "Hello!"}},
+			Stream:      &stream,
+			Logprobs:    true,
+			TopLogprobs: 2,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		if !mock.CompletionRequest.Logprobs || mock.CompletionRequest.TopLogprobs != 2 {
+			t.Errorf("logprobs not passed to runner: %+v", mock.CompletionRequest)
+		}
+
+		var resp api.ChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []api.Logprob{
+			{TokenLogprob: api.TokenLogprob{Token: "Hi", Logprob: -0.1}},
+			{TokenLogprob: api.TokenLogprob{Token: "!", Logprob: -0.2}},
+		}
+		if diff := cmp.Diff(want, resp.Logprobs); diff != "" {
+			t.Errorf("logprobs mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("top logprobs out of range", func(t *testing.T) {
+		w := createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model:       "test",
+			Messages:    []api.Message{{Role: "user", Content: "Hello!"}},
+			TopLogprobs: api.MaxTopLogprobs + 1,
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
 }
 
 func TestGenerate(t *testing.T) {
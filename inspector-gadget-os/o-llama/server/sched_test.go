@@ -403,6 +403,41 @@ func TestGetRunner(t *testing.T) {
 	b.ctxDone()
 }
 
+func TestGetRunnerMissingDraftModel(t *testing.T) {
+	ctx, done := context.WithTimeout(t.Context(), 500*time.Millisecond)
+	defer done()
+
+	a := newScenarioRequest(t, ctx, "ollama-model-1", 10, nil)
+	a.req.opts.DraftModel = "missing-draft"
+
+	s := InitScheduler(ctx)
+	s.getGpuFn = getGpuFn
+	s.getCpuFn = getCpuFn
+
+	var loaded api.Options
+	s.newServerFn = func(gpus discover.GpuInfoList, model string, f *ggml.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+		loaded = opts
+		return a.srv, nil
+	}
+
+	successCh, errCh := s.GetRunner(a.ctx, a.req.model, a.req.opts, a.req.sessionDuration)
+	s.Run(ctx)
+	select {
+	case resp := <-successCh:
+		require.Equal(t, a.srv, resp.llama)
+		require.Empty(t, loaded.DraftModel)
+		// the runner keeps the requested draft so later requests naming it
+		// don't reload the model
+		require.Equal(t, "missing-draft", resp.Options.DraftModel)
+		require.False(t, resp.needsReload(ctx, a.req))
+	case err := <-errCh:
+		t.Fatal(err.Error())
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+	a.ctxDone()
+}
+
 func TestExpireRunner(t *testing.T) {
 	ctx, done := context.WithTimeout(t.Context(), 20*time.Millisecond)
 	defer done()
@@ -773,6 +808,14 @@ func (s *mockLlm) Embedding(ctx context.Context, input string) ([]float32, error
 	return s.embeddingResp, s.embeddingRespErr
 }
 
+func (s *mockLlm) Embeddings(ctx context.Context, inputs []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(inputs))
+	for i := range inputs {
+		embeddings[i] = s.embeddingResp
+	}
+	return embeddings, s.embeddingRespErr
+}
+
 func (s *mockLlm) Tokenize(ctx context.Context, content string) ([]int, error) {
 	return s.tokenizeResp, s.tokenizeRespErr
 }
@@ -781,6 +824,10 @@ func (s *mockLlm) Detokenize(ctx context.Context, tokens []int) (string, error)
 	return s.detokenizeResp, s.detonekizeRespErr
 }
 
+func (s *mockLlm) Imatrix(ctx context.Context, req llm.ImatrixRequest, fn func(llm.ImatrixResponse)) error {
+	return errors.New("not implemented")
+}
+
 func (s *mockLlm) Close() error {
 	s.closeCalled = true
 	return s.closeResp
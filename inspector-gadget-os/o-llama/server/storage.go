@@ -0,0 +1,384 @@
+package server
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// blobsMu keeps blobs from being removed while a pull, create or import
+// that will refer to them from a manifest is in progress. Those hold it for
+// reading; anything removing blobs only ever tries to take it for writing,
+// so that readers never wait and may nest, as when a create pulls its base
+// model.
+var blobsMu sync.RWMutex
+
+var errStorageBusy = errors.New("a pull, create or import is in progress")
+
+var digestPrefix = regexp.MustCompile(`^sha256-[0-9a-fA-F]{64}`)
+
+// storageUsage is the disk usage of the model store along with the paths of
+// the files which aren't part of any model
+type storageUsage struct {
+	api.StorageResponse
+	paths map[api.StorageFile][]string
+}
+
+func (u *storageUsage) add(f api.StorageFile, paths ...string) {
+	u.Files = append(u.Files, f)
+	u.paths[f] = paths
+	u.Size += f.Size
+}
+
+// partialDownload is a blob being downloaded or imported. Downloads write
+// the blob as a sparse file with a JSON file for each part, so their size is
+// counted from the parts.
+type partialDownload struct {
+	paths     []string
+	size      int64
+	completed int64
+	parts     bool
+}
+
+// readStorageUsage walks the blobs and KV cache snapshots of the model store,
+// attributing them to manifests
+func readStorageUsage(manifests map[model.Name]*Manifest) (*storageUsage, error) {
+	u := storageUsage{
+		StorageResponse: api.StorageResponse{Models: []api.StorageModel{}},
+		paths:           make(map[api.StorageFile][]string),
+	}
+
+	dir, err := GetBlobsPath("")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]int64)
+	partials := make(map[string]*partialDownload)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if _, err := GetBlobsPath(name); err == nil {
+			blobs[strings.Replace(name, "-", ":", 1)] = info.Size()
+			continue
+		}
+
+		// partial downloads and imports, and temporary files of layers
+		// being created
+		digest := name
+		if prefix := digestPrefix.FindString(name); prefix != "" {
+			digest = strings.Replace(prefix, "-", ":", 1)
+		}
+
+		p, ok := partials[digest]
+		if !ok {
+			p = &partialDownload{}
+			partials[digest] = p
+		}
+
+		p.paths = append(p.paths, path)
+		if strings.HasPrefix(name[len(digest):], "-partial-") {
+			var part jsonBlobDownloadPart
+			if bts, err := os.ReadFile(path); err == nil && json.Unmarshal(bts, &part) == nil {
+				p.completed += part.Completed
+				p.parts = true
+			}
+		} else {
+			p.size += info.Size()
+		}
+	}
+
+	for digest, p := range partials {
+		size := p.size
+		if p.parts {
+			size = p.completed
+		}
+
+		u.add(api.StorageFile{Kind: api.StoragePartial, Digest: digest, Size: size}, p.paths...)
+	}
+
+	// refs counts the models using each blob, and models names the models
+	// of each model weights blob
+	refs := make(map[string]int)
+	models := make(map[string][]string)
+	for name, m := range manifests {
+		var digests []string
+		for _, layer := range append(m.Layers, m.Config) {
+			if layer.Digest != "" && !slices.Contains(digests, layer.Digest) {
+				digests = append(digests, layer.Digest)
+				refs[layer.Digest]++
+			}
+
+			if layer.MediaType == "application/vnd.ollama.image.model" {
+				models[layer.Digest] = append(models[layer.Digest], name.DisplayShortest())
+			}
+		}
+	}
+
+	for name, m := range manifests {
+		sm := api.StorageModel{Name: name.DisplayShortest()}
+
+		var digests []string
+		for _, layer := range append(m.Layers, m.Config) {
+			if layer.Digest == "" || slices.Contains(digests, layer.Digest) {
+				continue
+			}
+			digests = append(digests, layer.Digest)
+
+			size, ok := blobs[layer.Digest]
+			if !ok {
+				size = layer.Size
+			}
+
+			sm.Size += size
+			if refs[layer.Digest] > 1 {
+				sm.Shared += size
+			} else {
+				sm.Unique += size
+			}
+		}
+
+		u.Models = append(u.Models, sm)
+	}
+
+	for digest, size := range blobs {
+		if refs[digest] > 0 {
+			u.Size += size
+			continue
+		}
+
+		u.add(api.StorageFile{Kind: api.StorageOrphaned, Digest: digest, Size: size}, filepath.Join(dir, strings.Replace(digest, ":", "-", 1)))
+	}
+
+	snapshots, err := u.readSnapshotUsage(models)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range u.Models {
+		u.Models[i].Snapshots = snapshots[m.Name]
+	}
+
+	u.Snapshots = snapshots[""]
+	u.Size += snapshots[""]
+	for _, f := range u.Files {
+		if f.Kind == api.StorageSnapshot {
+			// already counted in u.Snapshots
+			u.Size -= f.Size
+		}
+	}
+
+	slices.SortFunc(u.Models, func(a, b api.StorageModel) int { return strings.Compare(a.Name, b.Name) })
+	slices.SortFunc(u.Files, func(a, b api.StorageFile) int {
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Digest, b.Digest)
+	})
+
+	return &u, nil
+}
+
+// snapshotModel is the start of the header of KV cache snapshots written by
+// the runner, which names the blob of the model they were taken of
+type snapshotModel struct {
+	Model string
+}
+
+// readSnapshotUsage returns the size of the KV cache snapshots of each model,
+// keyed by model name, with the total keyed by "". models names the models of
+// each model weights blob. Snapshots of blobs no model uses are added to u as
+// files.
+func (u *storageUsage) readSnapshotUsage(models map[string][]string) (map[string]int64, error) {
+	dir := filepath.Join(envconfig.Models(), "kvcache")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		// partially written snapshots are counted but left to the runner
+		sizes[""] += info.Size()
+		if !strings.HasPrefix(entry.Name(), "sha256-") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		header, err := readSnapshotModel(path)
+		if err != nil {
+			slog.Debug("unreadable kv cache snapshot", "path", path, "error", err)
+			continue
+		}
+
+		names := models[strings.Replace(header.Model, "-", ":", 1)]
+		if len(names) == 0 {
+			u.add(api.StorageFile{Kind: api.StorageSnapshot, Digest: strings.Replace(entry.Name(), "-", ":", 1), Size: info.Size()}, path)
+			continue
+		}
+
+		for _, name := range names {
+			sizes[name] += info.Size()
+		}
+	}
+
+	return sizes, nil
+}
+
+func readSnapshotModel(path string) (*snapshotModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header snapshotModel
+	if err := gob.NewDecoder(f).Decode(&header); err != nil {
+		return nil, err
+	}
+
+	return &header, nil
+}
+
+// gcGracePeriod is how long files must be unused before gc removes them
+const gcGracePeriod = time.Hour
+
+func modifiedSince(t time.Time) func(string) bool {
+	return func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && info.ModTime().After(t)
+	}
+}
+
+// collectGarbage removes the files of the model store which aren't part of
+// any model. Partial downloads that are still running and files changed
+// within gcGracePeriod are kept.
+func collectGarbage(dryRun bool) (*api.GCResponse, error) {
+	if !dryRun {
+		if !blobsMu.TryLock() {
+			return nil, errStorageBusy
+		}
+		defer blobsMu.Unlock()
+	}
+
+	// unlike for reporting, a corrupt manifest must stop garbage collection
+	// since its blobs would appear to be orphaned
+	manifests, err := Manifests(false)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := readStorageUsage(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := api.GCResponse{Files: []api.StorageFile{}}
+	for _, f := range u.Files {
+		if _, ok := blobDownloadManager.Load(f.Digest); ok && f.Kind == api.StoragePartial {
+			continue
+		}
+
+		// blobs are uploaded before the create that uses them, so recent
+		// ones may be about to be referenced
+		if f.Kind != api.StorageSnapshot && slices.ContainsFunc(u.paths[f], modifiedSince(time.Now().Add(-gcGracePeriod))) {
+			continue
+		}
+
+		if !dryRun {
+			for _, path := range u.paths[f] {
+				if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return nil, err
+				}
+			}
+		}
+
+		resp.Files = append(resp.Files, f)
+		resp.Size += f.Size
+	}
+
+	if !dryRun {
+		p, err := GetManifestPath()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := PruneDirectory(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return &resp, nil
+}
+
+func (s *Server) StorageHandler(c *gin.Context) {
+	manifests, err := Manifests(true)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, err := readStorageUsage(manifests)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, u.StorageResponse)
+}
+
+func (s *Server) GCHandler(c *gin.Context) {
+	var req api.GCRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := collectGarbage(req.DryRun)
+	if errors.Is(err, errStorageBusy) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
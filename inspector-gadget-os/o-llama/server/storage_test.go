@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+	for _, r := range []api.CreateRequest{
+		{Name: "test", Files: map[string]string{"test.gguf": digest}},
+		{Name: "test2", Files: map[string]string{"test.gguf": digest}, Template: "{{ .System }} {{ .Prompt }}"},
+	} {
+		if w := createRequest(t, s.CreateHandler, r); w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+	}
+
+	orphan := "sha256:" + strings.Repeat("a", 64)
+	partial := "sha256:" + strings.Repeat("b", 64)
+	writeFile := func(path string, bts []byte) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, bts, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile(filepath.Join(p, "blobs", "sha256-"+strings.Repeat("a", 64)), []byte("orphan"))
+	writeFile(filepath.Join(p, "blobs", "sha256-"+strings.Repeat("b", 64)+"-partial"), make([]byte, 100))
+	part, err := json.Marshal(jsonBlobDownloadPart{Size: 100, Completed: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(filepath.Join(p, "blobs", "sha256-"+strings.Repeat("b", 64)+"-partial-0"), part)
+
+	writeSnapshot := func(name, model string, size int) {
+		t.Helper()
+		path := filepath.Join(p, "kvcache", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := gob.NewEncoder(f).Encode(snapshotModel{Model: model}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeSnapshot("sha256-"+strings.Repeat("c", 64), strings.Replace(digest, ":", "-", 1), 1000)
+	writeSnapshot("sha256-"+strings.Repeat("d", 64), "sha256-"+strings.Repeat("e", 64), 10)
+
+	// everything is older than the grace period of gc
+	old := time.Now().Add(-2 * gcGracePeriod)
+	for _, dir := range []string{"blobs", "kvcache"} {
+		entries, err := os.ReadDir(filepath.Join(p, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if err := os.Chtimes(filepath.Join(p, dir, entry.Name()), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	storage := func() api.StorageResponse {
+		t.Helper()
+		w := createRequest(t, s.StorageHandler, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.StorageResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	info, err := os.Stat(filepath.Join(p, "blobs", strings.Replace(digest, ":", "-", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := storage()
+	if len(resp.Models) != 2 || resp.Models[0].Name != "test2:latest" || resp.Models[1].Name != "test:latest" {
+		t.Fatalf("unexpected models %+v", resp.Models)
+	}
+
+	for _, m := range resp.Models {
+		if m.Shared < info.Size() || m.Unique+m.Shared != m.Size {
+			t.Errorf("unexpected usage of %s: %+v", m.Name, m)
+		}
+
+		if m.Snapshots < 1000 {
+			t.Errorf("expected snapshots of %s, got %d", m.Name, m.Snapshots)
+		}
+	}
+
+	if resp.Models[0].Unique <= resp.Models[1].Unique {
+		t.Errorf("expected template of test2 to be unique, got %+v", resp.Models)
+	}
+
+	if len(resp.Files) != 3 ||
+		resp.Files[0] != (api.StorageFile{Kind: api.StorageOrphaned, Digest: orphan, Size: 6}) ||
+		resp.Files[1] != (api.StorageFile{Kind: api.StoragePartial, Digest: partial, Size: 40}) ||
+		resp.Files[2].Kind != api.StorageSnapshot || resp.Files[2].Digest != "sha256:"+strings.Repeat("d", 64) {
+		t.Fatalf("unexpected files %+v", resp.Files)
+	}
+
+	if resp.Snapshots <= 1010 || resp.Size <= resp.Snapshots {
+		t.Errorf("unexpected totals %+v", resp)
+	}
+
+	blobs, err := filepath.Glob(filepath.Join(p, "blobs", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := createRequest(t, s.GCHandler, api.GCRequest{DryRun: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var gc api.GCResponse
+	if err := json.NewDecoder(w.Body).Decode(&gc); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gc.Files) != 3 || gc.Size != 6+40+resp.Files[2].Size {
+		t.Fatalf("unexpected dry run %+v", gc)
+	}
+
+	checkFileExists(t, filepath.Join(p, "blobs", "*"), blobs)
+
+	t.Run("busy", func(t *testing.T) {
+		blobsMu.RLock()
+		defer blobsMu.RUnlock()
+
+		w := createRequest(t, s.GCHandler, api.GCRequest{})
+		if w.Code != http.StatusConflict {
+			t.Fatalf("expected status code 409, actual %d", w.Code)
+		}
+
+		checkFileExists(t, filepath.Join(p, "blobs", "*"), blobs)
+	})
+
+	// files changed recently may be about to be used
+	writeFile(filepath.Join(p, "blobs", "sha256-"+strings.Repeat("f", 64)), []byte("upload"))
+
+	w = createRequest(t, s.GCHandler, api.GCRequest{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	checkFileExists(t, filepath.Join(p, "blobs", "*"), []string{
+		filepath.Join(p, "blobs", "sha256-8f2c2167d789c6b2302dff965160fa5029f6a24096d262c1cbb469f21a045382"),
+		filepath.Join(p, "blobs", "sha256-a4e5e156ddec27e286f75328784d7106b60a4eb1d246e950a001a3f944fbda99"),
+		filepath.Join(p, "blobs", "sha256-ca239d7bd8ea90e4a5d2e6bf88f8d74a47b14336e73eb4e18bed4dd325018116"),
+		filepath.Join(p, "blobs", "sha256-fe7ac77b725cda2ccad03f88a880ecdfd7a33192d6cae08fce2c0ee1455991ed"),
+		filepath.Join(p, "blobs", "sha256-"+strings.Repeat("f", 64)),
+	})
+
+	checkFileExists(t, filepath.Join(p, "kvcache", "*"), []string{
+		filepath.Join(p, "kvcache", "sha256-"+strings.Repeat("c", 64)),
+	})
+
+	if resp := storage(); len(resp.Files) != 1 || resp.Files[0].Digest != "sha256:"+strings.Repeat("f", 64) {
+		t.Errorf("unexpected files after gc %+v", resp.Files)
+	}
+}
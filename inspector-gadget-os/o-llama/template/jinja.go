@@ -0,0 +1,130 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/template/jinja"
+)
+
+var weatherTool = api.Tool{
+	Type: "function",
+	Function: api.ToolFunction{
+		Name:        "get_weather",
+		Description: "Get the current weather in a city",
+		Parameters: struct {
+			Type       string                      `json:"type"`
+			Defs       any                         `json:"$defs,omitempty"`
+			Items      any                         `json:"items,omitempty"`
+			Required   []string                    `json:"required"`
+			Properties map[string]api.ToolProperty `json:"properties"`
+		}{
+			Type:     "object",
+			Required: []string{"city"},
+			Properties: map[string]api.ToolProperty{
+				"city": {Type: api.PropertyType{"string"}, Description: "The name of the city"},
+			},
+		},
+	},
+}
+
+// jinjaSamples are the conversations converted chat templates are checked
+// with. The first must render; the rest are skipped if the chat template
+// rejects them.
+var jinjaSamples = []struct {
+	name     string
+	messages []api.Message
+	tools    api.Tools
+}{
+	{
+		name:     "user",
+		messages: []api.Message{{Role: "user", Content: "Hello!"}},
+	},
+	{
+		name: "system",
+		messages: []api.Message{
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "user", Content: "Hello!"},
+		},
+	},
+	{
+		name: "conversation",
+		messages: []api.Message{
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "user", Content: "Hello!"},
+			{Role: "assistant", Content: "Hi! How can I help?"},
+			{Role: "user", Content: " What is 1 + 1?\n"},
+		},
+	},
+	{
+		name: "continuation",
+		messages: []api.Message{
+			{Role: "user", Content: "Hello!"},
+			{Role: "assistant", Content: "Hi!"},
+		},
+	},
+	{
+		name: "tools",
+		messages: []api.Message{
+			{Role: "user", Content: "What's the weather in Paris?"},
+			{Role: "assistant", ToolCalls: []api.ToolCall{{Function: api.ToolCallFunction{
+				Name:      "get_weather",
+				Arguments: api.ToolCallFunctionArguments{"city": "Paris"},
+			}}}},
+			{Role: "tool", Content: "22°C and sunny", ToolName: "get_weather"},
+		},
+		tools: api.Tools{weatherTool},
+	},
+}
+
+// FromJinja converts a Hugging Face chat template to a template. bos and eos
+// are the text of the model's BOS and EOS tokens; bos should be empty if the
+// tokenizer adds BOS to prompts itself.
+//
+// Only a subset of Jinja can be converted. FromJinja fails for templates
+// outside of it, and for templates whose conversion renders sample
+// conversations differently from the original.
+func FromJinja(s, bos, eos string) (*Template, error) {
+	j, err := jinja.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := j.Convert(jinja.Options{BOSToken: bos, EOSToken: eos})
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := Parse(converted)
+	if err != nil {
+		return nil, fmt.Errorf("jinja: converted template: %w", err)
+	}
+
+	for i, sample := range jinjaSamples {
+		var want strings.Builder
+		if err := j.Execute(&want, map[string]any{
+			"messages":              sample.messages,
+			"tools":                 sample.tools,
+			"add_generation_prompt": sample.messages[len(sample.messages)-1].Role != "assistant",
+			"bos_token":             bos,
+			"eos_token":             eos,
+		}); err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			continue
+		}
+
+		var got strings.Builder
+		if err := t.Execute(&got, Values{Messages: sample.messages, Tools: sample.tools}); err != nil {
+			return nil, fmt.Errorf("jinja: converted template: %w", err)
+		}
+
+		if got.String() != want.String() {
+			return nil, fmt.Errorf("jinja: converted template renders %s conversation as %q, expected %q", sample.name, got.String(), want.String())
+		}
+	}
+
+	return t, nil
+}
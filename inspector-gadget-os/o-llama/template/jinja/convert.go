@@ -0,0 +1,1191 @@
+package jinja
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Options configures the conversion of a template to a Go template
+type Options struct {
+	// BOSToken and EOSToken are the values of bos_token and eos_token
+	BOSToken, EOSToken string
+}
+
+// Convert converts t to an Ollama Go template, which reads the conversation
+// from .Messages and tool definitions from .Tools. It fails if t uses
+// constructs that have no equivalent in Go templates.
+//
+// Hugging Face renders a conversation ending in an assistant message, which
+// Ollama continues, without add_generation_prompt, so add_generation_prompt
+// is true if the last message isn't the assistant's. Branches that only raise
+// exceptions are removed, as Ollama doesn't validate conversations.
+func (t *Template) Convert(opts Options) (string, error) {
+	c := converter{
+		scopes: []map[string]value{{
+			"messages":  {code: "$.Messages", typ: typ{kindList, kindMessage}},
+			"tools":     {code: "$.Tools", typ: typ{kindList, kindTool}},
+			"bos_token": stringValue(opts.BOSToken),
+			"eos_token": stringValue(opts.EOSToken),
+		}},
+		declared: make(map[string]bool),
+	}
+
+	body, err := c.nodes(t.root)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(c.decls, "") + body, nil
+}
+
+// globals are the variables Hugging Face passes to chat templates
+var globals = map[string]bool{
+	"messages":              true,
+	"tools":                 true,
+	"bos_token":             true,
+	"eos_token":             true,
+	"add_generation_prompt": true,
+}
+
+type kind int
+
+const (
+	kindUnknown kind = iota
+	kindUndefined
+	kindBool
+	kindNumber
+	kindString
+	kindList
+	kindMap
+	kindNamespace
+	kindMessage
+	kindToolCall
+	kindToolCallFunction
+	kindTool
+	kindToolFunction
+	kindParameters
+)
+
+// typ is what is known of the type of a value
+type typ struct {
+	kind kind
+
+	// elem is the kind of the elements of lists
+	elem kind
+}
+
+func unify(a, b typ) typ {
+	if a == b {
+		return a
+	}
+
+	return typ{kind: kindUnknown}
+}
+
+type field struct {
+	name string
+	typ  typ
+
+	// always is set for fields that are always present in the JSON encoding
+	// of their struct, as opposed to being omitted when empty
+	always bool
+}
+
+// fields maps the keys of the objects a Hugging Face template reads to the
+// fields of the api types that hold them
+var fields = map[kind]map[string]field{
+	kindMessage: {
+		"role":       {"Role", typ{kind: kindString}, true},
+		"content":    {"Content", typ{kind: kindString}, true},
+		"thinking":   {"Thinking", typ{kind: kindString}, false},
+		"tool_calls": {"ToolCalls", typ{kindList, kindToolCall}, false},
+		"tool_name":  {"ToolName", typ{kind: kindString}, false},
+	},
+	kindToolCall: {
+		"function": {"Function", typ{kind: kindToolCallFunction}, true},
+	},
+	kindToolCallFunction: {
+		"name":      {"Name", typ{kind: kindString}, true},
+		"arguments": {"Arguments", typ{kind: kindMap}, true},
+	},
+	kindTool: {
+		"type":     {"Type", typ{kind: kindString}, true},
+		"function": {"Function", typ{kind: kindToolFunction}, true},
+	},
+	kindToolFunction: {
+		"name":        {"Name", typ{kind: kindString}, true},
+		"description": {"Description", typ{kind: kindString}, true},
+		"parameters":  {"Parameters", typ{kind: kindParameters}, true},
+	},
+	kindParameters: {
+		"type":       {"Type", typ{kind: kindString}, true},
+		"required":   {"Required", typ{kindList, kindString}, true},
+		"properties": {"Properties", typ{kind: kindMap}, true},
+	},
+}
+
+// value is a converted expression
+type value struct {
+	code string
+	typ  typ
+
+	// text is the value of string literals
+	text    string
+	literal bool
+
+	// parts are the operands of a concatenation
+	parts []value
+
+	// truthy is set for values that are only meaningful as conditions, such
+	// as the results of tests
+	truthy bool
+}
+
+var undefinedValue = value{code: `""`, typ: typ{kind: kindUndefined}}
+
+func stringValue(s string) value {
+	return value{code: strconv.Quote(s), typ: typ{kind: kindString}, text: s, literal: true}
+}
+
+func boolValue(b bool) value {
+	return value{code: strconv.FormatBool(b), typ: typ{kind: kindBool}}
+}
+
+// constant reports whether v is known to be true or false
+func (v value) constant() (b, ok bool) {
+	switch {
+	case v.typ.kind == kindUndefined:
+		return false, true
+	case v.code == "true":
+		return true, true
+	case v.code == "false":
+		return false, true
+	}
+
+	return false, false
+}
+
+// bool returns code that evaluates to whether v is true
+func (v value) bool() string {
+	if b, ok := v.constant(); ok {
+		return strconv.FormatBool(b)
+	} else if v.truthy || v.typ.kind != kindBool {
+		return "(not (not " + v.code + "))"
+	}
+
+	return v.code
+}
+
+func (v value) cond() string {
+	if b, ok := v.constant(); ok {
+		return strconv.FormatBool(b)
+	}
+
+	return v.code
+}
+
+type loop struct {
+	// index is the variable holding the index of the current item
+	index string
+	iter  value
+
+	// prev is the variable holding the previous item, if it's used
+	prev string
+
+	// conditional is the depth of conditionals the loop is in
+	conditional int
+}
+
+type converter struct {
+	// scopes are the variables in scope, starting with the template's,
+	// followed by those of each loop
+	scopes []map[string]value
+	loops  []*loop
+
+	// decls declare variables at the start of the template
+	decls    []string
+	declared map[string]bool
+
+	// conditional is the depth of conditionals being converted
+	conditional int
+}
+
+func (c *converter) errorf(format string, args ...any) error {
+	return fmt.Errorf("jinja: can't convert %s", fmt.Sprintf(format, args...))
+}
+
+func (c *converter) declare(name, decl string) {
+	if !c.declared[name] {
+		c.declared[name] = true
+		c.decls = append(c.decls, decl)
+	}
+}
+
+func (c *converter) lookup(name string) (value, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if b, ok := c.scopes[i][name]; ok {
+			return b, true
+		}
+	}
+
+	switch name {
+	case "add_generation_prompt":
+		c.declare("$add_generation_prompt", `{{ $add_generation_prompt := true }}{{ range $.Messages }}{{ $add_generation_prompt = ne .Role "assistant" }}{{ end }}`)
+		return value{code: "$add_generation_prompt", typ: typ{kind: kindBool}}, true
+	}
+
+	return value{}, false
+}
+
+// assign returns the variable to assign to for the template variable name,
+// declaring it if needed
+func (c *converter) assign(name string, t typ) string {
+	for i := len(c.scopes) - 1; i > 0; i-- {
+		if b, ok := c.scopes[i][name]; ok {
+			// a variable that's only sometimes assigned may keep its type
+			if c.conditional > c.loops[i-1].conditional {
+				t = unify(b.typ, t)
+			}
+
+			c.scopes[i][name] = value{code: b.code, typ: t}
+			return b.code
+		}
+	}
+
+	b, ok := c.lookup(name)
+	if ok && c.declared[b.code] {
+		c.scopes[0][name] = value{code: b.code, typ: unify(b.typ, t)}
+		return b.code
+	}
+
+	// variables are declared at the start of the template, so they keep
+	// their values across loops and conditionals
+	init := `""`
+	if ok {
+		init = b.code
+	}
+
+	v := "$" + strings.ReplaceAll(name, ".", "_")
+	c.declare(v, fmt.Sprintf("{{ %s := %s }}", v, init))
+	c.scopes[0][name] = value{code: v, typ: t}
+	return v
+}
+
+// unparen removes the parentheses around a function call, which aren't
+// needed when it's the whole of an action
+func unparen(code string) string {
+	if !strings.HasPrefix(code, "(") {
+		return code
+	}
+
+	var depth int
+	var quoted bool
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 && i < len(code)-1 {
+				return code
+			}
+		}
+	}
+
+	return code[1 : len(code)-1]
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(s, "{{", `{{ "{{" }}`)
+}
+
+func isRaise(e expr) bool {
+	call, ok := e.(*callExpr)
+	if !ok {
+		return false
+	}
+
+	fn, ok := call.fn.(*nameExpr)
+	return ok && fn.name == "raise_exception"
+}
+
+// raises reports whether nodes always raise an exception
+func raises(nodes []node) bool {
+	var raised bool
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *textNode:
+		case *outputNode:
+			if !isRaise(n.expr) {
+				return false
+			}
+			raised = true
+		default:
+			return false
+		}
+	}
+
+	return raised
+}
+
+func (c *converter) nodes(nodes []node) (string, error) {
+	var b strings.Builder
+	for _, n := range nodes {
+		var s string
+		var err error
+		switch n := n.(type) {
+		case *textNode:
+			s = escape(n.text)
+		case *outputNode:
+			if isRaise(n.expr) {
+				continue
+			}
+			s, err = c.output(n.expr)
+		case *ifNode:
+			s, err = c.ifNode(n)
+		case *forNode:
+			s, err = c.forNode(n)
+		case *setNode:
+			s, err = c.setNode(n)
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(s)
+	}
+
+	return b.String(), nil
+}
+
+// branches converts an if statement with the converted conditions conds and
+// bodies, leaving out branches that are never taken
+func (c *converter) branches(conds []string, bodies []func() (string, error)) (string, error) {
+	var b strings.Builder
+	var open bool
+	for i, cond := range conds {
+		if cond == "false" {
+			continue
+		}
+
+		if cond == "true" && !open {
+			return bodies[i]()
+		}
+
+		c.conditional++
+		body, err := bodies[i]()
+		c.conditional--
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case cond == "true" && body == "":
+		case cond == "true":
+			b.WriteString("{{ else }}")
+		case open:
+			fmt.Fprintf(&b, "{{ else if %s }}", unparen(cond))
+		default:
+			fmt.Fprintf(&b, "{{ if %s }}", unparen(cond))
+		}
+
+		open = true
+		b.WriteString(body)
+		if cond == "true" {
+			break
+		}
+	}
+
+	if open {
+		b.WriteString("{{ end }}")
+	}
+
+	return b.String(), nil
+}
+
+func (c *converter) ifNode(n *ifNode) (string, error) {
+	var conds []string
+	var bodies []func() (string, error)
+	for _, br := range n.branches {
+		if raises(br.body) {
+			continue
+		}
+
+		v, err := c.expr(br.cond)
+		if err != nil {
+			return "", err
+		}
+
+		conds = append(conds, v.cond())
+		bodies = append(bodies, func() (string, error) { return c.nodes(br.body) })
+
+		// later conditions are never checked
+		if v.cond() == "true" {
+			break
+		}
+	}
+
+	if n.orElse != nil && !raises(n.orElse) {
+		conds = append(conds, "true")
+		bodies = append(bodies, func() (string, error) { return c.nodes(n.orElse) })
+	}
+
+	return c.branches(conds, bodies)
+}
+
+func (c *converter) output(e expr) (string, error) {
+	switch e := e.(type) {
+	case *condExpr:
+		return c.condExpr(e, func(e expr) (string, error) {
+			if e == nil {
+				return "", nil
+			}
+			return c.output(e)
+		})
+	case *binaryExpr:
+		// conditional expressions can't be converted within expressions,
+		// but concatenations of them can be output piece by piece
+		if (e.op == "+" || e.op == "~") && (hasCondExpr(e.x) || hasCondExpr(e.y)) {
+			x, err := c.output(e.x)
+			if err != nil {
+				return "", err
+			}
+
+			y, err := c.output(e.y)
+			if err != nil {
+				return "", err
+			}
+
+			return x + y, nil
+		}
+	}
+
+	v, err := c.expr(e)
+	if err != nil {
+		return "", err
+	}
+
+	parts := []value{v}
+	if v.parts != nil {
+		parts = v.parts
+	}
+
+	var b strings.Builder
+	for _, p := range parts {
+		switch {
+		case p.literal:
+			b.WriteString(escape(p.text))
+		case p.typ.kind == kindUndefined:
+		case p.truthy || p.typ.kind == kindBool || p.typ.kind > kindString:
+			// Go prints these differently from Python
+			return "", c.errorf("output of %s", p.code)
+		default:
+			fmt.Fprintf(&b, "{{ %s }}", unparen(p.code))
+		}
+	}
+
+	return b.String(), nil
+}
+
+func hasCondExpr(e expr) bool {
+	switch e := e.(type) {
+	case *condExpr:
+		return true
+	case *binaryExpr:
+		return (e.op == "+" || e.op == "~") && (hasCondExpr(e.x) || hasCondExpr(e.y))
+	}
+
+	return false
+}
+
+// condExpr converts x if cond else y, converting x and y with fn
+func (c *converter) condExpr(e *condExpr, fn func(expr) (string, error)) (string, error) {
+	cond, err := c.expr(e.cond)
+	if err != nil {
+		return "", err
+	}
+
+	return c.branches([]string{cond.cond(), "true"}, []func() (string, error){
+		func() (string, error) { return fn(e.x) },
+		func() (string, error) { return fn(e.y) },
+	})
+}
+
+func (c *converter) setNode(n *setNode) (string, error) {
+	if n.attr == "" {
+		if call, ok := n.value.(*callExpr); ok {
+			if fn, ok := call.fn.(*nameExpr); ok && fn.name == "namespace" {
+				return c.namespace(n.name, call)
+			}
+		}
+	} else if b, ok := c.lookup(n.name); !ok || b.typ.kind != kindNamespace {
+		return "", c.errorf("assignment to attribute %s of %s", n.attr, n.name)
+	}
+
+	set := func(e expr) (string, error) {
+		v := undefinedValue
+		if e != nil {
+			var err error
+			if v, err = c.expr(e); err != nil {
+				return "", err
+			}
+		}
+
+		code := v.code
+		if v.truthy {
+			code = v.bool()
+		} else if v.parts != nil {
+			code = concat(v.parts).code
+		}
+
+		var name string
+		if n.attr != "" {
+			name = c.assign(n.name+"."+n.attr, v.typ)
+		} else {
+			name = c.assign(n.name, v.typ)
+		}
+
+		return fmt.Sprintf("{{ %s = %s }}", name, unparen(code)), nil
+	}
+
+	if e, ok := n.value.(*condExpr); ok {
+		return c.condExpr(e, set)
+	}
+
+	return set(n.value)
+}
+
+// namespace converts the creation of a namespace, whose attributes become
+// variables named after the namespace and attribute
+func (c *converter) namespace(name string, call *callExpr) (string, error) {
+	if len(call.args) > 0 {
+		return "", c.errorf("positional arguments to namespace")
+	}
+
+	c.scopes[0][name] = value{typ: typ{kind: kindNamespace}}
+
+	var b strings.Builder
+	for _, kw := range call.kwargs {
+		s, err := c.setNode(&setNode{name: name, attr: kw.name, value: kw.value})
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+
+	return b.String(), nil
+}
+
+func (c *converter) forNode(n *forNode) (string, error) {
+	l := loop{conditional: c.conditional}
+	scope := make(map[string]value)
+
+	var header string
+	if call, ok := n.iter.(*callExpr); ok && len(call.args) == 0 && len(call.kwargs) == 0 {
+		// for key, value in mapping.items()
+		fn, ok := call.fn.(*attrExpr)
+		if !ok || fn.attr != "items" || len(n.targets) != 2 {
+			return "", c.errorf("loop over a function call")
+		}
+
+		v, err := c.expr(fn.x)
+		if err != nil {
+			return "", err
+		}
+
+		if v.typ.kind != kindMap {
+			return "", c.errorf("loop over items of %s", v.code)
+		}
+
+		l.iter = v
+		k, val := "$"+n.targets[0], "$"+n.targets[1]
+		scope[n.targets[0]] = value{code: k, typ: typ{kind: kindString}}
+		scope[n.targets[1]] = value{code: val, typ: typ{kind: kindUnknown}}
+		header = fmt.Sprintf("{{ range %s, %s := %s }}", k, val, v.code)
+	} else {
+		v, err := c.expr(n.iter)
+		if err != nil {
+			return "", err
+		}
+
+		if v.typ.kind != kindList || len(n.targets) != 1 {
+			return "", c.errorf("loop over %s", v.code)
+		}
+
+		l.iter = v
+		l.index = fmt.Sprintf("$loop%d", len(c.loops))
+		target := "$" + n.targets[0]
+		scope[n.targets[0]] = value{code: target, typ: typ{kind: v.typ.elem}}
+		header = fmt.Sprintf("{{ range %s, %s := %s }}", l.index, target, v.code)
+	}
+
+	c.scopes = append(c.scopes, scope)
+	c.loops = append(c.loops, &l)
+	body, err := c.nodes(n.body)
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.loops = c.loops[:len(c.loops)-1]
+	if err != nil {
+		return "", err
+	}
+
+	if l.prev != "" {
+		body += fmt.Sprintf("{{ %s = index %s %s }}", l.prev, l.iter.code, l.index)
+	}
+
+	if n.orElse != nil {
+		c.conditional++
+		orElse, err := c.nodes(n.orElse)
+		c.conditional--
+		if err != nil {
+			return "", err
+		}
+
+		body += "{{ else }}" + orElse
+	}
+
+	return header + body + "{{ end }}", nil
+}
+
+func concat(parts []value) value {
+	codes := make([]string, len(parts))
+	for i, p := range parts {
+		codes[i] = p.code
+	}
+
+	return value{
+		code:  "(print " + strings.Join(codes, " ") + ")",
+		typ:   typ{kind: kindString},
+		parts: parts,
+	}
+}
+
+func (c *converter) expr(e expr) (value, error) {
+	switch e := e.(type) {
+	case *literal:
+		switch v := e.value.(type) {
+		case string:
+			return stringValue(v), nil
+		case bool:
+			return boolValue(v), nil
+		case int:
+			return value{code: strconv.Itoa(v), typ: typ{kind: kindNumber}}, nil
+		case float64:
+			return value{code: strconv.FormatFloat(v, 'g', -1, 64), typ: typ{kind: kindNumber}}, nil
+		}
+
+		return value{}, c.errorf("none outside of comparisons")
+	case *nameExpr:
+		if e.name == "loop" && len(c.loops) > 0 {
+			return value{}, c.errorf("loop outside of attributes")
+		}
+
+		v, ok := c.lookup(e.name)
+		if !ok {
+			return undefinedValue, nil
+		}
+
+		return v, nil
+	case *attrExpr:
+		return c.attr(e)
+	case *indexExpr:
+		return c.index(e)
+	case *sliceExpr:
+		x, err := c.expr(e.x)
+		if err != nil {
+			return value{}, err
+		}
+
+		if x.typ.kind != kindList {
+			return value{}, c.errorf("slice of %s", x.code)
+		}
+
+		bounds := []expr{e.lo, e.hi}
+		if e.hi == nil {
+			bounds = bounds[:1]
+		}
+
+		code := "(slice " + x.code
+		for _, bound := range bounds {
+			i := 0
+			if bound != nil {
+				l, ok := bound.(*literal)
+				if !ok {
+					return value{}, c.errorf("slice with variable bounds")
+				}
+
+				if i, ok = l.value.(int); !ok || i < 0 {
+					return value{}, c.errorf("slice with bound %v", l.value)
+				}
+			}
+			code += " " + strconv.Itoa(i)
+		}
+
+		return value{code: code + ")", typ: x.typ}, nil
+	case *callExpr:
+		if fn, ok := e.fn.(*attrExpr); ok && fn.attr == "strip" && len(e.args) == 0 {
+			return c.filter(&filterExpr{x: fn.x, name: "trim"})
+		}
+
+		return value{}, c.errorf("function call")
+	case *filterExpr:
+		return c.filter(e)
+	case *testExpr:
+		return c.test(e)
+	case *unaryExpr:
+		x, err := c.expr(e.x)
+		if err != nil {
+			return value{}, err
+		}
+
+		if e.op == "not" {
+			if b, ok := x.constant(); ok {
+				return boolValue(!b), nil
+			}
+
+			return value{code: "(not " + x.code + ")", typ: typ{kind: kindBool}}, nil
+		}
+
+		if _, ok := e.x.(*literal); ok && x.typ.kind == kindNumber {
+			return value{code: "-" + x.code, typ: x.typ}, nil
+		}
+
+		return value{}, c.errorf("negation of %s", x.code)
+	case *binaryExpr:
+		return c.binary(e)
+	case *valueExpr:
+		return e.value, nil
+	case *condExpr:
+		return value{}, c.errorf("conditional expression within an expression")
+	case *listExpr:
+		return value{}, c.errorf("list outside of in")
+	}
+
+	return value{}, c.errorf("expression %T", e)
+}
+
+func (c *converter) attr(e *attrExpr) (value, error) {
+	if name, ok := e.x.(*nameExpr); ok {
+		if name.name == "loop" && len(c.loops) > 0 {
+			return c.loopAttr(e.attr)
+		}
+
+		if b, ok := c.lookup(name.name); ok && b.typ.kind == kindNamespace {
+			v, ok := c.lookup(name.name + "." + e.attr)
+			if !ok {
+				return undefinedValue, nil
+			}
+
+			return v, nil
+		}
+	}
+
+	x, err := c.expr(e.x)
+	if err != nil {
+		return value{}, err
+	}
+
+	if x.typ.kind == kindUndefined {
+		return undefinedValue, nil
+	}
+
+	f, ok := fields[x.typ.kind][e.attr]
+	if !ok {
+		return value{}, c.errorf("attribute %s of %s", e.attr, x.code)
+	}
+
+	return value{code: x.code + "." + f.name, typ: f.typ}, nil
+}
+
+func (c *converter) loopAttr(attr string) (value, error) {
+	l := c.loops[len(c.loops)-1]
+	if l.index == "" {
+		return value{}, c.errorf("loop.%s in a loop over items", attr)
+	}
+
+	switch attr {
+	case "first":
+		return value{code: fmt.Sprintf("(eq %s 0)", l.index), typ: typ{kind: kindBool}}, nil
+	case "last":
+		return value{code: fmt.Sprintf("(eq (len (slice %s %s)) 1)", l.iter.code, l.index), typ: typ{kind: kindBool}}, nil
+	case "index0":
+		return value{code: l.index, typ: typ{kind: kindNumber}}, nil
+	case "length":
+		return value{code: fmt.Sprintf("(len %s)", l.iter.code), typ: typ{kind: kindNumber}}, nil
+	}
+
+	return value{}, c.errorf("loop.%s", attr)
+}
+
+func (c *converter) index(e *indexExpr) (value, error) {
+	x, err := c.expr(e.x)
+	if err != nil {
+		return value{}, err
+	}
+
+	if x.typ.kind != kindList {
+		return value{}, c.errorf("index of %s", x.code)
+	}
+	elem := typ{kind: x.typ.elem}
+
+	switch i := e.index.(type) {
+	case *literal:
+		if n, ok := i.value.(int); ok && n >= 0 {
+			return value{code: fmt.Sprintf("(index %s %d)", x.code, n), typ: elem}, nil
+		}
+	case *unaryExpr:
+		// the last message
+		if l, ok := i.x.(*literal); ok && i.op == "-" && l.value == 1 && x.code == "$.Messages" {
+			c.declare("$last_message", `{{ $last_message := "" }}{{ range $.Messages }}{{ $last_message = . }}{{ end }}`)
+			return value{code: "$last_message", typ: elem}, nil
+		}
+	case *binaryExpr:
+		// the items before and after the current one in a loop over x
+		if len(c.loops) == 0 {
+			break
+		}
+
+		l := c.loops[len(c.loops)-1]
+		attr, ok := i.x.(*attrExpr)
+		if !ok || attr.attr != "index0" || l.index == "" || l.iter.code != x.code {
+			break
+		}
+
+		if name, ok := attr.x.(*nameExpr); !ok || name.name != "loop" {
+			break
+		}
+
+		if one, ok := i.y.(*literal); !ok || one.value != 1 {
+			break
+		}
+
+		switch i.op {
+		case "+":
+			return value{code: fmt.Sprintf("(index (slice %s %s) 1)", x.code, l.index), typ: elem}, nil
+		case "-":
+			if l.prev == "" {
+				l.prev = l.index + "_prev"
+				c.declare(l.prev, fmt.Sprintf(`{{ %s := "" }}`, l.prev))
+			}
+			return value{code: l.prev, typ: elem}, nil
+		}
+	}
+
+	return value{}, c.errorf("index of %s", x.code)
+}
+
+func (c *converter) filter(e *filterExpr) (value, error) {
+	x, err := c.expr(e.x)
+	if err != nil {
+		return value{}, err
+	}
+
+	if len(e.args) > 0 || len(e.kwargs) > 0 {
+		return value{}, c.errorf("filter %s with arguments", e.name)
+	}
+
+	if x.parts != nil {
+		x = concat(x.parts)
+	}
+
+	switch e.name {
+	case "trim":
+		if x.typ.kind != kindString && x.typ.kind != kindUnknown {
+			return value{}, c.errorf("trim of %s", x.code)
+		}
+		return value{code: "(trim " + x.code + ")", typ: typ{kind: kindString}}, nil
+	case "tojson":
+		return value{code: "(json " + x.code + ")", typ: typ{kind: kindString}}, nil
+	case "length", "count":
+		return value{code: "(len " + x.code + ")", typ: typ{kind: kindNumber}}, nil
+	case "string":
+		if x.typ.kind == kindString {
+			return x, nil
+		}
+	}
+
+	return value{}, c.errorf("filter %s", e.name)
+}
+
+func (c *converter) test(e *testExpr) (value, error) {
+	if len(e.args) > 0 {
+		return value{}, c.errorf("test %s with arguments", e.name)
+	}
+
+	v, err := c.testValue(e)
+	if err != nil {
+		return value{}, err
+	}
+
+	if e.negate {
+		if b, ok := v.constant(); ok {
+			return boolValue(!b), nil
+		}
+		return value{code: "(not " + v.code + ")", typ: typ{kind: kindBool}}, nil
+	}
+
+	return v, nil
+}
+
+// testValue converts a test without its negation
+func (c *converter) testValue(e *testExpr) (value, error) {
+	if name, ok := e.x.(*nameExpr); ok && (e.name == "defined" || e.name == "undefined") {
+		// the variables Hugging Face passes are always defined, and those
+		// the template sets are if they have a value
+		defined := boolValue(true)
+		if !globals[name.name] {
+			b, ok := c.lookup(name.name)
+			switch {
+			case !ok:
+				defined = boolValue(false)
+			case b.typ.kind != kindNamespace && c.declared[b.code]:
+				defined = value{code: b.code, truthy: true}
+			}
+		}
+
+		if e.name == "undefined" {
+			return c.not(defined), nil
+		}
+		return defined, nil
+	}
+
+	var f *field
+	if attr, ok := e.x.(*attrExpr); ok {
+		x, err := c.expr(attr.x)
+		if err == nil {
+			if ff, ok := fields[x.typ.kind][attr.attr]; ok {
+				f = &ff
+			}
+		}
+	}
+
+	x, err := c.expr(e.x)
+	if err != nil {
+		return value{}, err
+	}
+
+	if x.parts != nil {
+		x = concat(x.parts)
+	}
+
+	switch e.name {
+	case "defined", "undefined":
+		defined := value{code: x.code, truthy: true}
+		switch {
+		case x.typ.kind == kindUndefined:
+			defined = boolValue(false)
+		case f != nil && f.always, x.literal:
+			defined = boolValue(true)
+		}
+
+		if e.name == "undefined" {
+			return c.not(defined), nil
+		}
+		return defined, nil
+	case "none":
+		switch {
+		case x.typ.kind == kindUndefined, x.literal:
+			return boolValue(false), nil
+		case f != nil && (!f.always || f.typ.kind == kindString || f.typ.kind == kindNumber || f.typ.kind == kindBool):
+			// fields are either omitted or set
+			return boolValue(false), nil
+		}
+
+		return value{code: "(not " + x.code + ")", truthy: true}, nil
+	}
+
+	var is func(kind) bool
+	switch e.name {
+	case "string":
+		is = func(k kind) bool { return k == kindString }
+	case "number":
+		is = func(k kind) bool { return k == kindNumber }
+	case "boolean":
+		is = func(k kind) bool { return k == kindBool }
+	case "mapping":
+		is = func(k kind) bool { return k == kindMap || k >= kindMessage }
+	case "iterable", "sequence":
+		is = func(k kind) bool { return k == kindString || k == kindList || k == kindMap }
+	default:
+		return value{}, c.errorf("test %s", e.name)
+	}
+
+	if x.typ.kind == kindUnknown || x.typ.kind == kindUndefined || x.typ.kind == kindNamespace {
+		return value{}, c.errorf("test %s of %s", e.name, x.code)
+	}
+
+	return boolValue(is(x.typ.kind)), nil
+}
+
+func (c *converter) binary(e *binaryExpr) (value, error) {
+	x, err := c.expr(e.x)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch e.op {
+	case "in", "not in":
+		v, err := c.in(x, e.y)
+		if err != nil {
+			return value{}, err
+		}
+
+		if e.op == "not in" {
+			return c.not(v), nil
+		}
+		return v, nil
+	case "==", "!=":
+		if l, ok := e.y.(*literal); ok && l.value == nil {
+			return c.test(&testExpr{x: &valueExpr{x}, name: "none", negate: e.op == "!="})
+		}
+
+		if l, ok := e.y.(*literal); ok && (l.value == true || l.value == false) {
+			// comparisons to booleans are converted to truth tests, as Go
+			// can't compare values of different types
+			v := value{code: x.code, truthy: true}
+			if b, ok := x.constant(); ok {
+				v = boolValue(b)
+			}
+
+			if (l.value == true) != (e.op == "==") {
+				return c.not(v), nil
+			}
+			return v, nil
+		}
+	}
+
+	y, err := c.expr(e.y)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch e.op {
+	case "and", "or":
+		and := e.op == "and"
+		if b, ok := x.constant(); ok {
+			if b == and {
+				return y, nil
+			}
+			return x, nil
+		}
+
+		if b, ok := y.constant(); ok {
+			if b == and {
+				return value{code: x.code, typ: x.typ, truthy: true}, nil
+			}
+			return boolValue(b), nil
+		}
+
+		return value{code: fmt.Sprintf("(%s %s %s)", e.op, x.code, y.code), typ: unify(x.typ, y.typ), truthy: x.truthy || y.truthy}, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		for _, v := range []value{x, y} {
+			if v.truthy || v.typ.kind >= kindList {
+				return value{}, c.errorf("comparison of %s", v.code)
+			}
+		}
+
+		fn := map[string]string{"==": "eq", "!=": "ne", "<": "lt", "<=": "le", ">": "gt", ">=": "ge"}[e.op]
+		if x.typ.kind != kindUnknown && y.typ.kind != kindUnknown && x.typ.kind != y.typ.kind {
+			if e.op == "==" || e.op == "!=" {
+				// values of different types are never equal
+				return boolValue(e.op == "!="), nil
+			}
+
+			return value{}, c.errorf("comparison of %s and %s", x.code, y.code)
+		}
+
+		if x.parts != nil {
+			x = concat(x.parts)
+		}
+
+		if y.parts != nil {
+			y = concat(y.parts)
+		}
+
+		return value{code: fmt.Sprintf("(%s %s %s)", fn, x.code, y.code), typ: typ{kind: kindBool}}, nil
+	case "+", "~":
+		if x.typ.kind != kindString && y.typ.kind != kindString {
+			return value{}, c.errorf("%s of %s and %s", e.op, x.code, y.code)
+		}
+
+		var parts []value
+		for _, v := range []value{x, y} {
+			switch {
+			case v.truthy || v.typ.kind == kindBool || v.typ.kind >= kindList:
+				return value{}, c.errorf("concatenation of %s", v.code)
+			case v.typ.kind == kindUndefined && e.op == "+":
+				return value{}, c.errorf("concatenation of undefined value")
+			case v.parts != nil:
+				parts = append(parts, v.parts...)
+			default:
+				parts = append(parts, v)
+			}
+		}
+
+		return concat(parts), nil
+	}
+
+	return value{}, c.errorf("operator %s", e.op)
+}
+
+func (c *converter) not(v value) value {
+	if b, ok := v.constant(); ok {
+		return boolValue(!b)
+	}
+
+	return value{code: "(not " + v.code + ")", typ: typ{kind: kindBool}}
+}
+
+// in converts x in y, for lists of literals and keys of objects
+func (c *converter) in(x value, y expr) (value, error) {
+	if l, ok := y.(*listExpr); ok {
+		var v value
+		for i, item := range l.items {
+			eq, err := c.binary(&binaryExpr{"==", &valueExpr{x}, item})
+			if err != nil {
+				return value{}, err
+			}
+
+			if i == 0 {
+				v = eq
+				continue
+			}
+
+			v, err = c.binary(&binaryExpr{"or", &valueExpr{v}, &valueExpr{eq}})
+			if err != nil {
+				return value{}, err
+			}
+		}
+
+		if len(l.items) == 0 {
+			return boolValue(false), nil
+		}
+		return v, nil
+	}
+
+	container, err := c.expr(y)
+	if err != nil {
+		return value{}, err
+	}
+
+	if f, ok := fields[container.typ.kind][x.text]; ok && x.literal {
+		if f.always {
+			return boolValue(true), nil
+		}
+
+		return value{code: container.code + "." + f.name, truthy: true}, nil
+	}
+
+	return value{}, c.errorf("%s in %s", x.code, container.code)
+}
+
+// valueExpr is an expression that has already been converted
+type valueExpr struct {
+	value
+}
@@ -0,0 +1,1036 @@
+package jinja
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// undefined is the value of names and attributes that don't exist
+type undefined struct{}
+
+// dict is a mapping that keeps its keys in insertion order, as Python's
+// dictionaries do
+type dict struct {
+	keys   []string
+	values map[string]any
+}
+
+func newDict() *dict {
+	return &dict{values: make(map[string]any)}
+}
+
+func (d *dict) get(key string) (any, bool) {
+	v, ok := d.values[key]
+	return v, ok
+}
+
+func (d *dict) set(key string, value any) {
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = value
+}
+
+// valueOf converts v to a template value through its JSON encoding, so that
+// structs have the same fields and field order as their JSON objects
+func valueOf(v any) (any, error) {
+	switch v.(type) {
+	case nil, bool, int, float64, string, []any, *dict:
+		return v, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return decode(d)
+}
+
+func decode(d *json.Decoder) (any, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		if t == '[' {
+			l := []any{}
+			for d.More() {
+				v, err := decode(d)
+				if err != nil {
+					return nil, err
+				}
+				l = append(l, v)
+			}
+
+			_, err := d.Token()
+			return l, err
+		}
+
+		m := newDict()
+		for d.More() {
+			k, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := decode(d)
+			if err != nil {
+				return nil, err
+			}
+			m.set(k.(string), v)
+		}
+
+		_, err := d.Token()
+		return m, err
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return int(n), nil
+		}
+
+		return t.Float64()
+	}
+
+	return t, nil
+}
+
+type scope struct {
+	vars   map[string]any
+	parent *scope
+}
+
+func (s *scope) lookup(name string) any {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v
+		}
+	}
+
+	return undefined{}
+}
+
+// Execute renders the template with the variables vars, which are converted
+// to template values through their JSON encodings
+func (t *Template) Execute(w io.Writer, vars map[string]any) error {
+	s := scope{vars: make(map[string]any)}
+	for k, v := range vars {
+		value, err := valueOf(v)
+		if err != nil {
+			return err
+		}
+		s.vars[k] = value
+	}
+
+	var b strings.Builder
+	if err := execute(&b, &s, t.root); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func execute(b *strings.Builder, s *scope, nodes []node) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *textNode:
+			b.WriteString(n.text)
+		case *outputNode:
+			v, err := eval(s, n.expr)
+			if err != nil {
+				return err
+			}
+			b.WriteString(str(v))
+		case *ifNode:
+			body := n.orElse
+			for _, br := range n.branches {
+				v, err := eval(s, br.cond)
+				if err != nil {
+					return err
+				}
+
+				if truthy(v) {
+					body = br.body
+					break
+				}
+			}
+
+			if err := execute(b, s, body); err != nil {
+				return err
+			}
+		case *forNode:
+			if err := executeFor(b, s, n); err != nil {
+				return err
+			}
+		case *setNode:
+			v, err := eval(s, n.value)
+			if err != nil {
+				return err
+			}
+
+			if n.attr == "" {
+				s.vars[n.name] = v
+				continue
+			}
+
+			ns, ok := s.lookup(n.name).(*dict)
+			if !ok {
+				return fmt.Errorf("jinja: can't set attribute %s of %s", n.attr, n.name)
+			}
+			ns.set(n.attr, v)
+		}
+	}
+
+	return nil
+}
+
+func executeFor(b *strings.Builder, s *scope, n *forNode) error {
+	v, err := eval(s, n.iter)
+	if err != nil {
+		return err
+	}
+
+	items, err := iterate(v)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return execute(b, s, n.orElse)
+	}
+
+	for i, item := range items {
+		loop := newDict()
+		loop.set("index", i+1)
+		loop.set("index0", i)
+		loop.set("revindex", len(items)-i)
+		loop.set("revindex0", len(items)-i-1)
+		loop.set("first", i == 0)
+		loop.set("last", i == len(items)-1)
+		loop.set("length", len(items))
+		if i > 0 {
+			loop.set("previtem", items[i-1])
+		}
+		if i < len(items)-1 {
+			loop.set("nextitem", items[i+1])
+		}
+
+		// each iteration has its own scope, so variables set in the loop
+		// don't outlive it
+		iteration := scope{vars: map[string]any{"loop": loop}, parent: s}
+		if len(n.targets) == 1 {
+			iteration.vars[n.targets[0]] = item
+		} else {
+			values, ok := item.([]any)
+			if !ok || len(values) != len(n.targets) {
+				return fmt.Errorf("jinja: can't unpack %s into %d variables", repr(item), len(n.targets))
+			}
+
+			for j, target := range n.targets {
+				iteration.vars[target] = values[j]
+			}
+		}
+
+		if err := execute(b, &iteration, n.body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func iterate(v any) ([]any, error) {
+	switch v := v.(type) {
+	case undefined:
+		return nil, nil
+	case []any:
+		return v, nil
+	case *dict:
+		items := make([]any, len(v.keys))
+		for i, k := range v.keys {
+			items[i] = k
+		}
+		return items, nil
+	case string:
+		var items []any
+		for _, r := range v {
+			items = append(items, string(r))
+		}
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("jinja: %s is not iterable", repr(v))
+}
+
+func eval(s *scope, e expr) (any, error) {
+	switch e := e.(type) {
+	case *literal:
+		return e.value, nil
+	case *nameExpr:
+		return s.lookup(e.name), nil
+	case *listExpr:
+		l := make([]any, len(e.items))
+		for i, item := range e.items {
+			v, err := eval(s, item)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = v
+		}
+		return l, nil
+	case *attrExpr:
+		x, err := eval(s, e.x)
+		if err != nil {
+			return nil, err
+		}
+
+		return attr(x, e.attr), nil
+	case *indexExpr:
+		x, err := eval(s, e.x)
+		if err != nil {
+			return nil, err
+		}
+
+		index, err := eval(s, e.index)
+		if err != nil {
+			return nil, err
+		}
+
+		return item(x, index)
+	case *sliceExpr:
+		return evalSlice(s, e)
+	case *callExpr:
+		return evalCall(s, e)
+	case *filterExpr:
+		return evalFilter(s, e)
+	case *testExpr:
+		return evalTest(s, e)
+	case *unaryExpr:
+		x, err := eval(s, e.x)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.op == "not" {
+			return !truthy(x), nil
+		}
+
+		switch x := x.(type) {
+		case int:
+			return -x, nil
+		case float64:
+			return -x, nil
+		}
+
+		return nil, fmt.Errorf("jinja: bad operand for -: %s", repr(x))
+	case *binaryExpr:
+		return evalBinary(s, e)
+	case *condExpr:
+		cond, err := eval(s, e.cond)
+		if err != nil {
+			return nil, err
+		}
+
+		if truthy(cond) {
+			return eval(s, e.x)
+		} else if e.y == nil {
+			return undefined{}, nil
+		}
+
+		return eval(s, e.y)
+	}
+
+	return nil, fmt.Errorf("jinja: unknown expression %T", e)
+}
+
+func attr(x any, name string) any {
+	switch x := x.(type) {
+	case *dict:
+		if v, ok := x.get(name); ok {
+			return v
+		}
+	case []any:
+		if i, err := strconv.Atoi(name); err == nil && i < len(x) {
+			return x[i]
+		}
+	}
+
+	return undefined{}
+}
+
+func item(x, index any) (any, error) {
+	switch x := x.(type) {
+	case *dict:
+		if k, ok := index.(string); ok {
+			return attr(x, k), nil
+		}
+	case []any:
+		if i, ok := index.(int); ok {
+			if i < 0 {
+				i += len(x)
+			}
+
+			if i >= 0 && i < len(x) {
+				return x[i], nil
+			}
+
+			return undefined{}, nil
+		}
+	case string:
+		if i, ok := index.(int); ok {
+			r := []rune(x)
+			if i < 0 {
+				i += len(r)
+			}
+
+			if i >= 0 && i < len(r) {
+				return string(r[i]), nil
+			}
+
+			return undefined{}, nil
+		}
+	case undefined:
+		return undefined{}, nil
+	}
+
+	return nil, fmt.Errorf("jinja: can't index %s with %s", repr(x), repr(index))
+}
+
+func evalSlice(s *scope, e *sliceExpr) (any, error) {
+	x, err := eval(s, e.x)
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch x := x.(type) {
+	case []any:
+		n = len(x)
+	case string:
+		n = utf8.RuneCountInString(x)
+	default:
+		return nil, fmt.Errorf("jinja: can't slice %s", repr(x))
+	}
+
+	bound := func(e expr, fallback int) (int, error) {
+		if e == nil {
+			return fallback, nil
+		}
+
+		v, err := eval(s, e)
+		if err != nil {
+			return 0, err
+		}
+
+		i, ok := v.(int)
+		if !ok {
+			return 0, fmt.Errorf("jinja: slice index %s is not an integer", repr(v))
+		}
+
+		if i < 0 {
+			i += n
+		}
+		return min(max(i, 0), n), nil
+	}
+
+	lo, err := bound(e.lo, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	hi, err := bound(e.hi, n)
+	if err != nil {
+		return nil, err
+	}
+	hi = max(lo, hi)
+
+	if l, ok := x.([]any); ok {
+		return l[lo:hi], nil
+	}
+
+	return string([]rune(x.(string))[lo:hi]), nil
+}
+
+func evalArgs(s *scope, args []expr) ([]any, error) {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		v, err := eval(s, arg)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+func evalCall(s *scope, e *callExpr) (any, error) {
+	args, err := evalArgs(s, e.args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch fn := e.fn.(type) {
+	case *nameExpr:
+		switch fn.name {
+		case "raise_exception":
+			if len(args) > 0 {
+				return nil, fmt.Errorf("jinja: %s", str(args[0]))
+			}
+			return nil, errors.New("jinja: exception raised")
+		case "namespace":
+			ns := newDict()
+			for _, kw := range e.kwargs {
+				v, err := eval(s, kw.value)
+				if err != nil {
+					return nil, err
+				}
+				ns.set(kw.name, v)
+			}
+			return ns, nil
+		}
+	case *attrExpr:
+		x, err := eval(s, fn.x)
+		if err != nil {
+			return nil, err
+		}
+
+		if v, ok := method(x, fn.attr, args); ok {
+			return v, nil
+		}
+	}
+
+	return nil, errors.New("jinja: unsupported function call")
+}
+
+func method(x any, name string, args []any) (any, bool) {
+	switch x := x.(type) {
+	case string:
+		switch name {
+		case "strip":
+			return trim(x, args), true
+		case "lstrip":
+			if len(args) > 0 {
+				return strings.TrimLeft(x, str(args[0])), true
+			}
+			return strings.TrimLeftFunc(x, unicode.IsSpace), true
+		case "rstrip":
+			if len(args) > 0 {
+				return strings.TrimRight(x, str(args[0])), true
+			}
+			return strings.TrimRightFunc(x, unicode.IsSpace), true
+		case "lower":
+			return strings.ToLower(x), true
+		case "upper":
+			return strings.ToUpper(x), true
+		case "startswith":
+			return len(args) == 1 && strings.HasPrefix(x, str(args[0])), true
+		case "endswith":
+			return len(args) == 1 && strings.HasSuffix(x, str(args[0])), true
+		}
+	case *dict:
+		switch name {
+		case "items", "keys", "values":
+			var l []any
+			for _, k := range x.keys {
+				switch name {
+				case "items":
+					l = append(l, []any{k, x.values[k]})
+				case "keys":
+					l = append(l, k)
+				case "values":
+					l = append(l, x.values[k])
+				}
+			}
+			return l, true
+		case "get":
+			if len(args) > 0 {
+				if v, ok := x.get(str(args[0])); ok {
+					return v, true
+				} else if len(args) > 1 {
+					return args[1], true
+				}
+				return nil, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func trim(s string, args []any) string {
+	if len(args) > 0 {
+		return strings.Trim(s, str(args[0]))
+	}
+
+	return strings.TrimFunc(s, unicode.IsSpace)
+}
+
+func evalFilter(s *scope, e *filterExpr) (any, error) {
+	x, err := eval(s, e.x)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := evalArgs(s, e.args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.kwargs) > 0 {
+		return nil, fmt.Errorf("jinja: unsupported arguments to filter %s", e.name)
+	}
+
+	switch e.name {
+	case "trim":
+		return trim(str(x), args), nil
+	case "tojson":
+		return toJSON(x), nil
+	case "string":
+		return str(x), nil
+	case "lower":
+		return strings.ToLower(str(x)), nil
+	case "upper":
+		return strings.ToUpper(str(x)), nil
+	case "length", "count":
+		switch x := x.(type) {
+		case []any:
+			return len(x), nil
+		case *dict:
+			return len(x.keys), nil
+		case string:
+			return utf8.RuneCountInString(x), nil
+		case undefined:
+			return 0, nil
+		}
+
+		return nil, fmt.Errorf("jinja: %s has no length", repr(x))
+	case "default", "d":
+		if _, ok := x.(undefined); ok || (len(args) > 1 && truthy(args[1]) && !truthy(x)) {
+			if len(args) > 0 {
+				return args[0], nil
+			}
+			return "", nil
+		}
+		return x, nil
+	}
+
+	return nil, fmt.Errorf("jinja: unsupported filter %s", e.name)
+}
+
+func evalTest(s *scope, e *testExpr) (any, error) {
+	x, err := eval(s, e.x)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := evalArgs(s, e.args)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	switch e.name {
+	case "defined":
+		_, undef := x.(undefined)
+		ok = !undef
+	case "undefined":
+		_, ok = x.(undefined)
+	case "none":
+		ok = x == nil
+	case "true":
+		ok = x == true
+	case "false":
+		ok = x == false
+	case "boolean":
+		_, ok = x.(bool)
+	case "string":
+		_, ok = x.(string)
+	case "number":
+		switch x.(type) {
+		case int, float64:
+			ok = true
+		}
+	case "integer":
+		_, ok = x.(int)
+	case "float":
+		_, ok = x.(float64)
+	case "mapping":
+		_, ok = x.(*dict)
+	case "sequence", "iterable":
+		switch x.(type) {
+		case []any, *dict, string:
+			ok = true
+		}
+	case "equalto", "eq", "==":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("jinja: test %s takes one argument", e.name)
+		}
+		ok = equal(x, args[0])
+	default:
+		return nil, fmt.Errorf("jinja: unsupported test %s", e.name)
+	}
+
+	return ok != e.negate, nil
+}
+
+func evalBinary(s *scope, e *binaryExpr) (any, error) {
+	x, err := eval(s, e.x)
+	if err != nil {
+		return nil, err
+	}
+
+	// and and or short circuit, returning one of their operands
+	switch e.op {
+	case "and":
+		if !truthy(x) {
+			return x, nil
+		}
+		return eval(s, e.y)
+	case "or":
+		if truthy(x) {
+			return x, nil
+		}
+		return eval(s, e.y)
+	}
+
+	y, err := eval(s, e.y)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(x, y)
+		if err != nil {
+			return nil, err
+		}
+
+		switch e.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case "in", "not in":
+		ok, err := contains(y, x)
+		if err != nil {
+			return nil, err
+		}
+		return ok == (e.op == "in"), nil
+	case "~":
+		return str(x) + str(y), nil
+	case "+":
+		switch x := x.(type) {
+		case string:
+			if y, ok := y.(string); ok {
+				return x + y, nil
+			}
+		case []any:
+			if y, ok := y.([]any); ok {
+				return append(append([]any{}, x...), y...), nil
+			}
+		}
+	case "*":
+		if x, ok := x.(string); ok {
+			if n, ok := y.(int); ok {
+				return strings.Repeat(x, max(n, 0)), nil
+			}
+		}
+	}
+
+	return arithmetic(e.op, x, y)
+}
+
+func arithmetic(op string, x, y any) (any, error) {
+	a, aok := number(x)
+	b, bok := number(y)
+	if !aok || !bok {
+		return nil, fmt.Errorf("jinja: unsupported operands for %s: %s and %s", op, repr(x), repr(y))
+	}
+
+	i, iok := x.(int)
+	j, jok := y.(int)
+	ints := iok && jok
+	switch op {
+	case "+":
+		if ints {
+			return i + j, nil
+		}
+		return a + b, nil
+	case "-":
+		if ints {
+			return i - j, nil
+		}
+		return a - b, nil
+	case "*":
+		if ints {
+			return i * j, nil
+		}
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, errors.New("jinja: division by zero")
+		}
+		return a / b, nil
+	case "//", "%":
+		if b == 0 {
+			return nil, errors.New("jinja: division by zero")
+		}
+
+		// Python rounds quotients down and gives remainders the sign of
+		// the divisor
+		q := math.Floor(a / b)
+		if op == "//" {
+			if ints {
+				return int(q), nil
+			}
+			return q, nil
+		}
+
+		if ints {
+			return i - j*int(q), nil
+		}
+		return a - b*q, nil
+	case "**":
+		if ints && j >= 0 {
+			return int(math.Pow(a, b)), nil
+		}
+		return math.Pow(a, b), nil
+	}
+
+	return nil, fmt.Errorf("jinja: unsupported operator %s", op)
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case *dict:
+		return len(v.keys) > 0
+	}
+
+	return true
+}
+
+func equal(x, y any) bool {
+	if a, ok := number(x); ok {
+		b, ok := number(y)
+		return ok && a == b
+	}
+
+	switch x := x.(type) {
+	case nil:
+		return y == nil
+	case undefined:
+		_, ok := y.(undefined)
+		return ok
+	case string:
+		y, ok := y.(string)
+		return ok && x == y
+	case []any:
+		y, ok := y.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case *dict:
+		y, ok := y.(*dict)
+		if !ok || len(x.keys) != len(y.keys) {
+			return false
+		}
+
+		for k, v := range x.values {
+			if w, ok := y.get(k); !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+func compare(x, y any) (int, error) {
+	if a, ok := number(x); ok {
+		if b, ok := number(y); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	if a, ok := x.(string); ok {
+		if b, ok := y.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+
+	return 0, fmt.Errorf("jinja: can't compare %s and %s", repr(x), repr(y))
+}
+
+func contains(container, v any) (bool, error) {
+	switch c := container.(type) {
+	case []any:
+		for _, item := range c {
+			if equal(item, v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *dict:
+		k, ok := v.(string)
+		if !ok {
+			return false, nil
+		}
+
+		_, ok = c.get(k)
+		return ok, nil
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false, fmt.Errorf("jinja: %s in string requires a string", repr(v))
+		}
+		return strings.Contains(c, s), nil
+	case undefined:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("jinja: %s is not a container", repr(container))
+}
+
+// str converts v to a string as Python's str does
+func str(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case undefined:
+		return ""
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e16 {
+			return strconv.FormatFloat(v, 'f', 1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	return repr(v)
+}
+
+// repr converts v to a string as Python's repr does
+func repr(v any) string {
+	switch v := v.(type) {
+	case string:
+		r := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+		return "'" + r.Replace(v) + "'"
+	case undefined:
+		return "Undefined"
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = repr(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *dict:
+		items := make([]string, len(v.keys))
+		for i, k := range v.keys {
+			items[i] = repr(k) + ": " + repr(v.values[k])
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+
+	return str(v)
+}
+
+// toJSON encodes v as compact JSON with the same escaping as encoding/json,
+// so that it matches the output of the json function of Go templates rather
+// than Python's json.dumps
+func toJSON(v any) string {
+	switch v := v.(type) {
+	case nil, undefined:
+		return "null"
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = toJSON(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case *dict:
+		items := make([]string, len(v.keys))
+		for i, k := range v.keys {
+			items[i] = toJSON(k) + ":" + toJSON(v.values[k])
+		}
+		return "{" + strings.Join(items, ",") + "}"
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+
+	return string(b)
+}
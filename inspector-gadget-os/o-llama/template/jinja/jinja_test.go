@@ -0,0 +1,176 @@
+package jinja
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	messages := []map[string]any{
+		{"role": "system", "content": "You are a pirate."},
+		{"role": "user", "content": " Hello! "},
+	}
+
+	cases := []struct {
+		name     string
+		template string
+		vars     map[string]any
+		expected string
+	}{
+		{"text", "Hello!", nil, "Hello!"},
+		{"output", "{{ 'a' + 'b' ~ 1 }}", nil, "ab1"},
+		{"trim blocks", "{% if true %}\nyes\n{% endif %}\n", nil, "yes\n"},
+		{"lstrip blocks", "a\n    {% if true %}\n    b\n    {% endif %}\n", nil, "a\n    b\n"},
+		{"whitespace markers", "a  {{- 'b' -}}  c {%+ if true %}d{% endif %}", nil, "abc d"},
+		{"comment", "a{# comment #}\nb", nil, "ab"},
+		{"loop", "{% for m in messages %}{{ loop.index }}:{{ m.role }}{% if not loop.last %},{% endif %}{% endfor %}", map[string]any{"messages": messages}, "1:system,2:user"},
+		{"loop else", "{% for m in [] %}{{ m }}{% else %}empty{% endfor %}", nil, "empty"},
+		{"index", "{{ messages[0]['content'] }}|{{ messages[-1].content | trim }}", map[string]any{"messages": messages}, "You are a pirate.|Hello!"},
+		{"slice", "{% for m in messages[1:] %}{{ m.role }}{% endfor %}", map[string]any{"messages": messages}, "user"},
+		{"namespace", "{% set ns = namespace(n=0) %}{% for m in messages %}{% set ns.n = ns.n + 1 %}{% endfor %}{{ ns.n }}", map[string]any{"messages": messages}, "2"},
+		{"scoping", "{% set n = 0 %}{% for m in messages %}{% set n = n + 1 %}{% endfor %}{{ n }}", map[string]any{"messages": messages}, "0"},
+		{"conditional expression", "{{ 'yes' if add_generation_prompt else 'no' }}", map[string]any{"add_generation_prompt": true}, "yes"},
+		{"undefined", "{{ missing }}{% if missing is defined %}defined{% else %}undefined{% endif %}", nil, "undefined"},
+		{"default", "{{ missing | default('fallback') }}", nil, "fallback"},
+		{"methods", "{{ ' Hi '.strip().upper() }}{{ 'abc'.startswith('a') }}", nil, "HITrue"},
+		{"tojson", "{{ tools | tojson }}", map[string]any{"tools": []any{map[string]any{"b": []any{1, 2.5, nil}, "a": true}}}, `[{"a":true,"b":[1,2.5,null]}]`},
+		{"items", "{% for k, v in messages[0].items() %}{{ k }}={{ v }};{% endfor %}", map[string]any{"messages": messages}, "content=You are a pirate.;role=system;"},
+		{"arithmetic", "{{ 7 // 2 }} {{ -7 // 2 }} {{ -7 % 3 }} {{ 2 ** 3 }} {{ 1 / 2 }}", nil, "3 -4 2 8 0.5"},
+		{"in", "{{ 'b' in 'abc' }} {{ 3 not in [1, 2] }} {{ 'role' in messages[0] }}", map[string]any{"messages": messages}, "True True True"},
+		{"string escapes", `{{ "a\nb" }}{{ 'é' }}`, nil, "a\nbé"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b strings.Builder
+			if err := tmpl.Execute(&b, tt.vars); err != nil {
+				t.Fatal(err)
+			}
+
+			if b.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestExecuteError(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"raise exception", "{{ raise_exception('Roles must alternate') }}", "Roles must alternate"},
+		{"unsupported call", "{{ missing() }}", "unsupported function call"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b strings.Builder
+			if err := tmpl.Execute(&b, nil); err == nil {
+				t.Fatalf("expected error, got %q", b.String())
+			} else if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+	}{
+		{"unclosed tag", "{{ messages"},
+		{"unclosed comment", "{# comment"},
+		{"unclosed block", "{% if true %}yes"},
+		{"unexpected end", "{% endfor %}"},
+		{"unknown statement", "{% macro m() %}{% endmacro %}"},
+		{"unterminated string", "{{ 'abc }}"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.template); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			"loop",
+			"{% for message in messages %}<|{{ message['role'] }}|>{{ message['content'] }}\n{% endfor %}",
+			"{{ range $loop0, $message := $.Messages }}<|{{ $message.Role }}|>{{ $message.Content }}\n{{ end }}",
+		},
+		{
+			"role conditional",
+			"{% for message in messages %}{% if message.role == 'user' %}[INST] {{ message.content | trim }} [/INST]{% elif message.role == 'assistant' %}{{ message.content }}{{ eos_token }}{% endif %}{% endfor %}",
+			`{{ range $loop0, $message := $.Messages }}{{ if eq $message.Role "user" }}[INST] {{ trim $message.Content }} [/INST]{{ else if eq $message.Role "assistant" }}{{ $message.Content }}</s>{{ end }}{{ end }}`,
+		},
+		{
+			"generation prompt",
+			"{{ bos_token }}{% for message in messages %}{{ message.content }}{% endfor %}{% if add_generation_prompt %}<|assistant|>{% endif %}",
+			`{{ $add_generation_prompt := true }}{{ range $.Messages }}{{ $add_generation_prompt = ne .Role "assistant" }}{{ end }}<s>{{ range $loop0, $message := $.Messages }}{{ $message.Content }}{{ end }}{{ if $add_generation_prompt }}<|assistant|>{{ end }}`,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := tmpl.Convert(Options{BOSToken: "<s>", EOSToken: "</s>"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, s)
+			}
+		})
+	}
+}
+
+func TestConvertError(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+	}{
+		{"unsupported method", "{% for message in messages %}{{ message.role.title() }}{% endfor %}"},
+		{"unsupported filter", "{{ tools | tojson(indent=4) }}"},
+		{"arithmetic", "{% for message in messages %}{{ loop.index * 2 }}{% endfor %}"},
+		{"output boolean", "{{ add_generation_prompt }}"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s, err := tmpl.Convert(Options{}); err == nil {
+				t.Errorf("expected error, got %q", s)
+			}
+		})
+	}
+}
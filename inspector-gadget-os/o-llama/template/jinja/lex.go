@@ -0,0 +1,294 @@
+package jinja
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type segmentKind int
+
+const (
+	segmentText segmentKind = iota
+	segmentOutput
+	segmentStatement
+)
+
+// segment is a run of text or the contents of a {{ }} or {% %} tag
+type segment struct {
+	kind segmentKind
+	text string
+	line int
+}
+
+// split splits s into segments, applying whitespace control the way Hugging
+// Face renders chat templates: with trim_blocks and lstrip_blocks enabled,
+// in addition to the - and + markers on tags
+func split(s string) ([]segment, error) {
+	var segments []segment
+	line := 1
+
+	// lstrip is set by a tag ending in -, trimNewline by a block or comment
+	// tag, and lineStart when the next text starts a line
+	var lstrip, trimNewline bool
+	lineStart := true
+	for {
+		i := nextTag(s)
+		text := s[:i]
+		if lstrip {
+			text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		} else if trimNewline {
+			text = strings.TrimPrefix(text, "\n")
+		}
+
+		line += strings.Count(s[:i], "\n")
+		s = s[i:]
+		if s == "" {
+			if text != "" {
+				segments = append(segments, segment{segmentText, text, line})
+			}
+			return segments, nil
+		}
+
+		open := s[:2]
+		s = s[2:]
+		switch {
+		case strings.HasPrefix(s, "-"):
+			text = strings.TrimRightFunc(text, unicode.IsSpace)
+			s = s[1:]
+		case strings.HasPrefix(s, "+"):
+			s = s[1:]
+		case open != "{{":
+			start := strings.LastIndexByte(text, '\n') + 1
+			if (start > 0 || lineStart) && strings.Trim(text[start:], " \t") == "" {
+				text = text[:start]
+			}
+		}
+
+		if text != "" {
+			segments = append(segments, segment{segmentText, text, line})
+		}
+
+		var end int
+		var kind segmentKind
+		switch open {
+		case "{#":
+			end = strings.Index(s, "#}")
+			if end < 0 {
+				return nil, fmt.Errorf("jinja: line %d: unclosed comment", line)
+			}
+		case "{{":
+			end = tagEnd(s, "}}")
+			kind = segmentOutput
+		case "{%":
+			end = tagEnd(s, "%}")
+			kind = segmentStatement
+		}
+
+		if end < 0 {
+			return nil, fmt.Errorf("jinja: line %d: unclosed tag %s", line, open)
+		}
+
+		body := s[:end]
+		lstrip = strings.HasSuffix(body, "-")
+		body = strings.TrimSuffix(body, "-")
+		trimNewline = open != "{{"
+
+		if open != "{#" {
+			segments = append(segments, segment{kind, body, line})
+		}
+
+		line += strings.Count(s[:end+2], "\n")
+		s = s[end+2:]
+
+		lineStart = false
+		if trimNewline && !lstrip && strings.HasPrefix(s, "\n") {
+			lineStart = true
+		}
+	}
+}
+
+// nextTag returns the offset of the next tag in s, or len(s) if there is none
+func nextTag(s string) int {
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == '{' && (s[i+1] == '{' || s[i+1] == '%' || s[i+1] == '#') {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// tagEnd returns the offset of the delimiter closing a tag, skipping over
+// string literals, or -1 if the tag isn't closed
+func tagEnd(s, delim string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(s[i:], delim):
+			return i
+		}
+	}
+
+	return -1
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenString
+	tokenInt
+	tokenFloat
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of tag"
+	case tokenString:
+		return strconv.Quote(t.value)
+	}
+
+	return t.value
+}
+
+var operators = []string{
+	"//", "**", "==", "!=", "<=", ">=",
+	"+", "-", "*", "/", "%", "~", "|", ".", ",", ":", "(", ")", "[", "]", "{", "}", "<", ">", "=",
+}
+
+// tokenize splits the contents of a tag into tokens
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return append(tokens, token{kind: tokenEOF}), nil
+		}
+
+		switch c := s[0]; {
+		case c == '_' || unicode.IsLetter(rune(c)):
+			n := strings.IndexFunc(s, func(r rune) bool {
+				return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})
+			if n < 0 {
+				n = len(s)
+			}
+
+			tokens = append(tokens, token{tokenName, s[:n]})
+			s = s[n:]
+		case c >= '0' && c <= '9':
+			n := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+			if n < 0 {
+				n = len(s)
+			}
+
+			kind := tokenInt
+			if n+1 < len(s) && s[n] == '.' && s[n+1] >= '0' && s[n+1] <= '9' {
+				kind = tokenFloat
+				n++
+				for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+					n++
+				}
+			}
+
+			tokens = append(tokens, token{kind, s[:n]})
+			s = s[n:]
+		case c == '\'' || c == '"':
+			value, n, err := unquote(s)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, token{tokenString, value})
+			s = s[n:]
+		default:
+			var op string
+			for _, o := range operators {
+				if strings.HasPrefix(s, o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+
+			tokens = append(tokens, token{tokenOperator, op})
+			s = s[len(op):]
+		}
+	}
+}
+
+// unquote reads the string literal at the start of s, returning its value and
+// length. Escapes are interpreted as in Python.
+func unquote(s string) (string, int, error) {
+	quote := s[0]
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'v':
+				b.WriteByte('\v')
+			case '0':
+				b.WriteByte(0)
+			case '\\', '\'', '"':
+				b.WriteByte(e)
+			case '\n':
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+n >= len(s) {
+					return "", 0, fmt.Errorf("invalid escape \\%c", e)
+				}
+
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape \\%c%s", e, s[i+1:i+1+n])
+				}
+
+				b.WriteRune(rune(r))
+				i += n
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string")
+}
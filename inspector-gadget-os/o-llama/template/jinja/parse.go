@@ -0,0 +1,770 @@
+package jinja
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Template is a parsed Jinja template
+type Template struct {
+	root []node
+}
+
+type node any
+
+type textNode struct {
+	text string
+}
+
+type outputNode struct {
+	expr expr
+}
+
+type ifNode struct {
+	branches []branch
+	orElse   []node
+}
+
+type branch struct {
+	cond expr
+	body []node
+}
+
+type forNode struct {
+	targets []string
+	iter    expr
+	body    []node
+	orElse  []node
+}
+
+// setNode assigns to a variable, or to an attribute of a namespace
+type setNode struct {
+	name, attr string
+	value      expr
+}
+
+type expr any
+
+type literal struct {
+	value any
+}
+
+type nameExpr struct {
+	name string
+}
+
+// attrExpr is both x.attr and x['attr']
+type attrExpr struct {
+	x    expr
+	attr string
+}
+
+type indexExpr struct {
+	x, index expr
+}
+
+type sliceExpr struct {
+	x, lo, hi expr
+}
+
+type callExpr struct {
+	fn     expr
+	args   []expr
+	kwargs []kwarg
+}
+
+type kwarg struct {
+	name  string
+	value expr
+}
+
+type filterExpr struct {
+	x      expr
+	name   string
+	args   []expr
+	kwargs []kwarg
+}
+
+type testExpr struct {
+	x      expr
+	name   string
+	negate bool
+	args   []expr
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+// condExpr is x if cond else y. y is nil if there is no else.
+type condExpr struct {
+	cond, x, y expr
+}
+
+type listExpr struct {
+	items []expr
+}
+
+// Parse parses a template
+func Parse(s string) (*Template, error) {
+	segments, err := split(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{segments: segments}
+	root, end, err := p.nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if end != "" {
+		return nil, p.errorf("unexpected %s", end)
+	}
+
+	return &Template{root: root}, nil
+}
+
+type parser struct {
+	segments []segment
+	line     int
+
+	// tokens of the current tag
+	tokens []token
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("jinja: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// nodes parses nodes up to the end of the template or the next statement it
+// can't parse by itself, such as endif, returning that statement's keyword
+func (p *parser) nodes() ([]node, string, error) {
+	var nodes []node
+	for len(p.segments) > 0 {
+		s := p.segments[0]
+		p.segments = p.segments[1:]
+		p.line = s.line
+
+		if s.kind == segmentText {
+			nodes = append(nodes, &textNode{s.text})
+			continue
+		}
+
+		tokens, err := tokenize(s.text)
+		if err != nil {
+			return nil, "", p.errorf("%v", err)
+		}
+		p.tokens = tokens
+
+		if s.kind == segmentOutput {
+			e, err := p.expr()
+			if err != nil {
+				return nil, "", err
+			}
+
+			if err := p.end(); err != nil {
+				return nil, "", err
+			}
+
+			nodes = append(nodes, &outputNode{e})
+			continue
+		}
+
+		keyword := p.next()
+		if keyword.kind != tokenName {
+			return nil, "", p.errorf("expected statement, got %s", keyword)
+		}
+
+		switch keyword.value {
+		case "if":
+			n, err := p.ifNode()
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, n)
+		case "for":
+			n, err := p.forNode()
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, n)
+		case "set":
+			n, err := p.setNode()
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, n)
+		case "generation":
+			// generation marks assistant output for training and renders its
+			// contents unchanged
+			if err := p.end(); err != nil {
+				return nil, "", err
+			}
+
+			body, end, err := p.nodes()
+			if err != nil {
+				return nil, "", err
+			}
+
+			if end != "endgeneration" {
+				return nil, "", p.errorf("expected endgeneration, got %s", cmp.Or(end, "end of template"))
+			}
+			nodes = append(nodes, body...)
+		case "elif", "else", "endif", "endfor", "endgeneration":
+			// the caller parses the rest of the statement
+			return nodes, keyword.value, nil
+		default:
+			return nil, "", p.errorf("unsupported statement %s", keyword.value)
+		}
+	}
+
+	return nodes, "", nil
+}
+
+func (p *parser) ifNode() (*ifNode, error) {
+	var n ifNode
+	for {
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.end(); err != nil {
+			return nil, err
+		}
+
+		body, end, err := p.nodes()
+		if err != nil {
+			return nil, err
+		}
+
+		n.branches = append(n.branches, branch{cond, body})
+		switch end {
+		case "elif":
+			continue
+		case "else":
+			if err := p.end(); err != nil {
+				return nil, err
+			}
+
+			body, end, err := p.nodes()
+			if err != nil {
+				return nil, err
+			}
+
+			if end != "endif" {
+				return nil, p.errorf("expected endif, got %s", cmp.Or(end, "end of template"))
+			}
+
+			n.orElse = body
+			fallthrough
+		case "endif":
+			return &n, p.end()
+		default:
+			return nil, p.errorf("expected endif, got %s", cmp.Or(end, "end of template"))
+		}
+	}
+}
+
+func (p *parser) forNode() (*forNode, error) {
+	var n forNode
+	for {
+		t := p.next()
+		if t.kind != tokenName {
+			return nil, p.errorf("expected loop variable, got %s", t)
+		}
+
+		n.targets = append(n.targets, t.value)
+		if !p.accept(tokenOperator, ",") {
+			break
+		}
+	}
+
+	if !p.accept(tokenName, "in") {
+		return nil, p.errorf("expected in, got %s", p.peek())
+	}
+
+	// parse the iterable without conditional expressions so that a
+	// trailing if, which filters the loop, isn't mistaken for one
+	iter, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	n.iter = iter
+
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+
+	body, end, err := p.nodes()
+	if err != nil {
+		return nil, err
+	}
+	n.body = body
+
+	if end == "else" {
+		if err := p.end(); err != nil {
+			return nil, err
+		}
+
+		n.orElse, end, err = p.nodes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if end != "endfor" {
+		return nil, p.errorf("expected endfor, got %s", cmp.Or(end, "end of template"))
+	}
+
+	return &n, p.end()
+}
+
+func (p *parser) setNode() (*setNode, error) {
+	t := p.next()
+	if t.kind != tokenName {
+		return nil, p.errorf("expected variable, got %s", t)
+	}
+
+	n := setNode{name: t.value}
+	if p.accept(tokenOperator, ".") {
+		attr := p.next()
+		if attr.kind != tokenName {
+			return nil, p.errorf("expected attribute, got %s", attr)
+		}
+		n.attr = attr.value
+	}
+
+	if !p.accept(tokenOperator, "=") {
+		// block assignments aren't supported
+		return nil, p.errorf("expected =, got %s", p.peek())
+	}
+
+	value, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	n.value = value
+
+	return &n, p.end()
+}
+
+func (p *parser) peek() token {
+	return p.tokens[0]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[0]
+	if t.kind != tokenEOF {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+// accept consumes the next token if it matches
+func (p *parser) accept(kind tokenKind, value string) bool {
+	if t := p.peek(); t.kind == kind && t.value == value {
+		p.next()
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(value string) error {
+	if !p.accept(tokenOperator, value) {
+		return p.errorf("expected %s, got %s", value, p.peek())
+	}
+
+	return nil
+}
+
+// end checks that the whole tag has been parsed
+func (p *parser) end() error {
+	if t := p.peek(); t.kind != tokenEOF {
+		return p.errorf("unexpected %s", t)
+	}
+
+	return nil
+}
+
+func (p *parser) expr() (expr, error) {
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.accept(tokenName, "if") {
+		return x, nil
+	}
+
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	var y expr
+	if p.accept(tokenName, "else") {
+		if y, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &condExpr{cond, x, y}, nil
+}
+
+func (p *parser) or() (expr, error) {
+	return p.binary(p.and, "or")
+}
+
+func (p *parser) and() (expr, error) {
+	return p.binary(p.not, "and")
+}
+
+func (p *parser) not() (expr, error) {
+	if p.accept(tokenName, "not") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		return &unaryExpr{"not", x}, nil
+	}
+
+	return p.compare()
+}
+
+func (p *parser) compare() (expr, error) {
+	x, err := p.math1()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var op string
+		switch t := p.peek(); {
+		case t.kind == tokenOperator && slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, t.value):
+			op = t.value
+			p.next()
+		case t.kind == tokenName && t.value == "in":
+			op = "in"
+			p.next()
+		case t.kind == tokenName && t.value == "not" && len(p.tokens) > 1 && p.tokens[1].kind == tokenName && p.tokens[1].value == "in":
+			op = "not in"
+			p.next()
+			p.next()
+		default:
+			return x, nil
+		}
+
+		y, err := p.math1()
+		if err != nil {
+			return nil, err
+		}
+
+		x = &binaryExpr{op, x, y}
+	}
+}
+
+func (p *parser) math1() (expr, error) {
+	return p.binary(p.concat, "+", "-")
+}
+
+func (p *parser) concat() (expr, error) {
+	return p.binary(p.math2, "~")
+}
+
+func (p *parser) math2() (expr, error) {
+	return p.binary(p.pow, "*", "/", "//", "%")
+}
+
+func (p *parser) pow() (expr, error) {
+	return p.binary(p.unary, "**")
+}
+
+// binary parses left associative operators ops, with operands parsed by next
+func (p *parser) binary(next func() (expr, error), ops ...string) (expr, error) {
+	x, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if (t.kind != tokenOperator && t.kind != tokenName) || !slices.Contains(ops, t.value) {
+			return x, nil
+		}
+		p.next()
+
+		y, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		x = &binaryExpr{t.value, x, y}
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	var x expr
+	if p.accept(tokenOperator, "-") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		x = &unaryExpr{"-", operand}
+	} else {
+		var err error
+		if x, err = p.primary(); err != nil {
+			return nil, err
+		}
+
+		if x, err = p.postfix(x); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.filters(x)
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenName:
+		switch t.value {
+		case "true", "True":
+			return &literal{true}, nil
+		case "false", "False":
+			return &literal{false}, nil
+		case "none", "None":
+			return &literal{nil}, nil
+		}
+
+		return &nameExpr{t.value}, nil
+	case tokenString:
+		// adjacent strings are concatenated
+		s := t.value
+		for p.peek().kind == tokenString {
+			s += p.next().value
+		}
+
+		return &literal{s}, nil
+	case tokenInt:
+		n, err := strconv.Atoi(t.value)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", t.value)
+		}
+
+		return &literal{n}, nil
+	case tokenFloat:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", t.value)
+		}
+
+		return &literal{f}, nil
+	case tokenOperator:
+		switch t.value {
+		case "(":
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+
+			if p.peek().value == "," {
+				return nil, p.errorf("tuples are not supported")
+			}
+
+			return x, p.expect(")")
+		case "[":
+			var l listExpr
+			for !p.accept(tokenOperator, "]") {
+				if len(l.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+
+					if p.accept(tokenOperator, "]") {
+						break
+					}
+				}
+
+				item, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+
+				l.items = append(l.items, item)
+			}
+
+			return &l, nil
+		}
+	}
+
+	return nil, p.errorf("unexpected %s", t)
+}
+
+func (p *parser) postfix(x expr) (expr, error) {
+	for {
+		switch {
+		case p.accept(tokenOperator, "."):
+			t := p.next()
+			if t.kind != tokenName && t.kind != tokenInt {
+				return nil, p.errorf("expected attribute, got %s", t)
+			}
+
+			x = &attrExpr{x, t.value}
+		case p.accept(tokenOperator, "["):
+			var lo, hi expr
+			var err error
+			if p.peek().value != ":" {
+				if lo, err = p.expr(); err != nil {
+					return nil, err
+				}
+			}
+
+			if p.accept(tokenOperator, ":") {
+				if p.peek().value != "]" {
+					if hi, err = p.expr(); err != nil {
+						return nil, err
+					}
+				}
+
+				if p.peek().value == ":" {
+					return nil, p.errorf("slice steps are not supported")
+				}
+
+				x = &sliceExpr{x, lo, hi}
+			} else if s, ok := lo.(*literal); ok && isString(s.value) {
+				x = &attrExpr{x, s.value.(string)}
+			} else {
+				x = &indexExpr{x, lo}
+			}
+
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		case p.accept(tokenOperator, "("):
+			args, kwargs, err := p.args()
+			if err != nil {
+				return nil, err
+			}
+
+			x = &callExpr{x, args, kwargs}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// args parses call arguments after the opening parenthesis
+func (p *parser) args() ([]expr, []kwarg, error) {
+	var args []expr
+	var kwargs []kwarg
+	for !p.accept(tokenOperator, ")") {
+		if len(args)+len(kwargs) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, nil, err
+			}
+
+			if p.accept(tokenOperator, ")") {
+				break
+			}
+		}
+
+		if len(p.tokens) > 1 && p.peek().kind == tokenName && p.tokens[1].kind == tokenOperator && p.tokens[1].value == "=" {
+			name := p.next().value
+			p.next()
+
+			value, err := p.expr()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			kwargs = append(kwargs, kwarg{name, value})
+			continue
+		}
+
+		if len(kwargs) > 0 {
+			return nil, nil, p.errorf("positional argument follows keyword argument")
+		}
+
+		arg, err := p.expr()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		args = append(args, arg)
+	}
+
+	return args, kwargs, nil
+}
+
+func (p *parser) filters(x expr) (expr, error) {
+	for {
+		switch {
+		case p.accept(tokenOperator, "|"):
+			t := p.next()
+			if t.kind != tokenName {
+				return nil, p.errorf("expected filter, got %s", t)
+			}
+
+			f := filterExpr{x: x, name: t.value}
+			if p.accept(tokenOperator, "(") {
+				var err error
+				if f.args, f.kwargs, err = p.args(); err != nil {
+					return nil, err
+				}
+			}
+
+			x = &f
+		case p.accept(tokenName, "is"):
+			test := testExpr{x: x, negate: p.accept(tokenName, "not")}
+
+			t := p.next()
+			if t.kind != tokenName {
+				return nil, p.errorf("expected test, got %s", t)
+			}
+
+			// none, true and false are names of tests as well as literals
+			test.name = t.value
+			if p.accept(tokenOperator, "(") {
+				args, kwargs, err := p.args()
+				if err != nil {
+					return nil, err
+				}
+
+				if len(kwargs) > 0 {
+					return nil, p.errorf("tests don't take keyword arguments")
+				}
+				test.args = args
+			} else if k := p.peek().kind; k == tokenString || k == tokenInt || k == tokenFloat {
+				// a test can take a single argument without parentheses
+				arg, err := p.primary()
+				if err != nil {
+					return nil, err
+				}
+				test.args = []expr{arg}
+			}
+
+			x = &test
+		default:
+			return x, nil
+		}
+	}
+}
+
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
@@ -0,0 +1,98 @@
+package template
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFromJinja(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "templates.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// these use constructs outside of the subset that can be converted
+	unsupported := map[string]bool{
+		"chatml#10": true,
+		"openchat":  true,
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ss map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &ss); err != nil {
+			t.Fatal(err)
+		}
+
+		for k, v := range ss {
+			t.Run(k, func(t *testing.T) {
+				tmpl, err := FromJinja(v, "", "</s>")
+				if unsupported[filepath.Base(t.Name())] {
+					if err == nil {
+						t.Errorf("expected error, got %q", tmpl.String())
+					}
+					return
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				if tmpl.Tree.Root.String() == "" {
+					t.Errorf("empty %s template", k)
+				}
+			})
+		}
+	}
+
+	matches, err := filepath.Glob(filepath.Join("testdata", "jinja", "*.jinja"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, match := range matches {
+		t.Run(filepath.Base(match), func(t *testing.T) {
+			bts, err := os.ReadFile(match)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tmpl, err := FromJinja(string(bts), "<bos>", "<eos>")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(tmpl.String(), "{{ range") {
+				t.Errorf("expected a loop over messages, got %q", tmpl.String())
+			}
+		})
+	}
+}
+
+func TestFromJinjaTools(t *testing.T) {
+	bts, err := os.ReadFile(filepath.Join("testdata", "jinja", "qwen2.5.jinja"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := FromJinja(string(bts), "", "<|im_end|>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vars := tmpl.Vars(); !strings.Contains(strings.Join(vars, " "), "tools") {
+		t.Errorf("expected template to use tools, got %v", vars)
+	}
+}
+
+func TestFromJinjaMismatch(t *testing.T) {
+	// Jinja counts characters where Go templates count bytes, which shows
+	// in the tool result of the sample conversations
+	_, err := FromJinja("{% for message in messages %}{{ message.content | length }} {% endfor %}", "", "")
+	if err == nil || !strings.Contains(err.Error(), "tools conversation") {
+		t.Errorf("expected tools conversation mismatch, got %v", err)
+	}
+}
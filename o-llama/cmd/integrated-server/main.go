@@ -3,23 +3,31 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"inspector-gadget-os/o-llama/internal/agent"
 	"inspector-gadget-os/o-llama/internal/auth"
 	"inspector-gadget-os/o-llama/internal/integration"
     "inspector-gadget-os/o-llama/internal/logging"
 	"inspector-gadget-os/o-llama/internal/mcp"
+	"inspector-gadget-os/o-llama/internal/metrics"
+	"inspector-gadget-os/o-llama/internal/rag"
 	"inspector-gadget-os/o-llama/internal/rbac"
 	"inspector-gadget-os/o-llama/internal/safefs"
+	"inspector-gadget-os/o-llama/internal/tools"
 	"inspector-gadget-os/o-llama/version"
 )
 
@@ -31,6 +39,12 @@ type Config struct {
 	JWTSecret        string
 	AllowedBasePaths []string
 	MaxFileSize      int64
+	ModelRuntimeURL  string
+	AgentModel       string
+	AgentConfirm     bool
+	RAGModel         string
+	RAGSyncInterval  time.Duration
+	RAGStatePath     string
 }
 
 func main() {
@@ -65,6 +79,16 @@ func loadConfig() *Config {
 		JWTSecret:        getEnvOrDefault("JWT_SECRET", "inspector-gadget-secret-key-change-in-production"),
 		AllowedBasePaths: []string{"/tmp", "/home", "/workspace"},
 		MaxFileSize:      10 * 1024 * 1024, // 10MB
+		ModelRuntimeURL:  getEnvOrDefault("OLLAMA_HOST", "http://127.0.0.1:11434"),
+		AgentModel:       getEnvOrDefault("AGENT_MODEL", "llama3.2"),
+		AgentConfirm:     getEnvOrDefault("AGENT_REQUIRE_CONFIRMATION", "true") == "true",
+		RAGModel:         getEnvOrDefault("RAG_EMBED_MODEL", "nomic-embed-text"),
+		RAGSyncInterval:  rag.DefaultSyncInterval,
+		RAGStatePath:     getEnvOrDefault("RAG_STATE_PATH", "./rag-indexes.json"),
+	}
+	
+	if interval, err := time.ParseDuration(os.Getenv("RAG_SYNC_INTERVAL")); err == nil && interval > 0 {
+		config.RAGSyncInterval = interval
 	}
 	
 	// Resolve absolute path for gadget binary
@@ -125,6 +149,39 @@ func initializeServer(config *Config, logger *log.Logger) (*gin.Engine, error) {
 	
 	mcpManager := mcp.NewMCPManager(mcpConfig)
 	
+	// Initialize unified tool registry (MCP tools, gadgets, SafeFS builtins)
+	toolRegistry := tools.NewRegistry(tools.Config{
+		MCP:        mcpManager,
+		Gadgets:    gadgetIntegration,
+		FS:         safeFS,
+		Authorizer: rbacMiddleware,
+		Events:     mcpManager.Events(),
+	})
+	
+	// Initialize agent loop against the bundled model runtime
+	agentRunner := agent.NewAgent(agent.Config{
+		Model:               agent.NewModelClient(config.ModelRuntimeURL),
+		Tools:               toolRegistry,
+		DefaultModel:        config.AgentModel,
+		RequireConfirmation: config.AgentConfirm,
+	})
+	
+	// Initialize retrieval over SafeFS directories, embedded by the model runtime
+	ragIndexer, err := rag.NewIndexer(rag.Config{
+		FS:           safeFS,
+		Store:        rag.NewRuntimeStore(config.ModelRuntimeURL),
+		Authorizer:   rbacMiddleware,
+		Roles:        casbinManager,
+		DefaultModel: config.RAGModel,
+		SyncInterval: config.RAGSyncInterval,
+		StatePath:    config.RAGStatePath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize RAG indexer: %w", err)
+	}
+	
+	chatProxy := rag.NewChatProxy(config.ModelRuntimeURL, ragIndexer)
+	
     // Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
     router := gin.New()
@@ -134,6 +191,7 @@ func initializeServer(config *Config, logger *log.Logger) (*gin.Engine, error) {
     logging.Init("integrated-server", version.Version)
     router.Use(logging.RequestIDMiddleware())
     router.Use(logging.AccessLogMiddleware())
+	router.Use(metrics.Middleware())
 	
 	// Health check endpoint (no auth required)
     router.GET("/health", func(c *gin.Context) {
@@ -160,6 +218,9 @@ func initializeServer(config *Config, logger *log.Logger) (*gin.Engine, error) {
         c.JSON(http.StatusOK, status)
 	})
 	
+	// Prometheus/OpenMetrics scrape endpoint (no auth required, like /health)
+	router.GET("/metrics", metrics.Handler())
+	
 	// Authentication endpoints (no auth middleware)
     // Ensure JSON binding uses DisallowUnknownFields for stricter input validation
     binding.EnableDecoderUseNumber = true
@@ -196,15 +257,51 @@ func initializeServer(config *Config, logger *log.Logger) (*gin.Engine, error) {
 		mcpAPI.GET("/servers", createMCPServersHandler(mcpManager))
 		mcpAPI.POST("/servers/:name/connect", createMCPConnectHandler(mcpManager))
 		mcpAPI.DELETE("/servers/:name", createMCPDisconnectHandler(mcpManager))
+		// Captured stderr may contain secrets; limited to system managers
+		mcpAPI.GET("/servers/:name/logs", rbacMiddleware.SystemManage(), createMCPServerLogsHandler(mcpManager))
 		mcpAPI.GET("/resources", createMCPResourcesHandler(mcpManager))
+		mcpAPI.GET("/resources/:server", createMCPReadResourceHandler(mcpManager))
+		mcpAPI.GET("/prompts", createMCPPromptsHandler(mcpManager))
+		mcpAPI.POST("/prompts/:server/:name", createMCPPromptHandler(mcpManager))
 		mcpAPI.POST("/tools/:server/:tool", createMCPToolHandler(mcpManager))
+		// Server-sent change events; browsers authenticate with ?token= since
+		// EventSource cannot set headers
+		mcpAPI.GET("/events", createMCPEventsHandler(mcpManager))
+	}
+	
+	// Unified tool catalog for LLM tool calling (AI access required)
+	toolsAPI := api.Group("/tools")
+	toolsAPI.Use(rbacMiddleware.AIAccess())
+	{
+		toolsAPI.GET("", createToolCatalogHandler(toolRegistry))
+		toolsAPI.POST("/:name/call", createToolCallHandler(toolRegistry))
+		// Relists gadgets and MCP tools, e.g. after installing a gadget
+		toolsAPI.POST("/refresh", rbacMiddleware.SystemManage(), createToolRefreshHandler(toolRegistry))
 	}
 	
+	// Agent chat: local model with gadget/MCP/SafeFS tool calling (AI access required)
+	agentAPI := api.Group("/agent")
+	agentAPI.Use(rbacMiddleware.AIAccess())
+	{
+		agentAPI.POST("/chat", agentRunner.Chat)
+	}
+	
+	// Model chat proxy; the rag option answers from indexed files the caller may read
+	api.POST("/chat", rbacMiddleware.AIAccess(), chatProxy.Chat)
+	
+	// Indexes of SafeFS directories used by rag chat (AI access and filesystem read required)
+	ragAPI := api.Group("")
+	ragAPI.Use(rbacMiddleware.AIAccess(), rbacMiddleware.FileSystemRead())
+	ragIndexer.RegisterRoutes(ragAPI)
+	
 	// Create default admin user if none exists
 	if err := createDefaultAdmin(casbinManager, jwtManager, logger); err != nil {
 		logger.Printf("Warning: Could not create default admin: %v", err)
 	}
 	
+	// Keep indexes up to date with file changes
+	go ragIndexer.Start(context.Background())
+	
 	// Start MCP manager
 	go func() {
 		if err := mcpManager.Start(context.Background()); err != nil {
@@ -469,6 +566,37 @@ func createMCPDisconnectHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
 	}
 }
 
+// createMCPServerLogsHandler returns recent stderr output of a stdio server;
+// ?lines= limits the number of lines
+func createMCPServerLogsHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverName := c.Param("name")
+		
+		limit := 0
+		if raw := c.Query("lines"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "lines must be a non-negative integer"})
+				return
+			}
+			limit = n
+		}
+		
+		lines, err := mcpManager.ServerLogs(serverName, limit)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		
+		process, _ := mcpManager.ProcessStatus(serverName)
+		c.JSON(http.StatusOK, gin.H{
+			"server":  serverName,
+			"process": process,
+			"lines":   lines,
+		})
+	}
+}
+
 func createMCPResourcesHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		resources, err := mcpManager.ListResources(c.Request.Context())
@@ -481,6 +609,64 @@ func createMCPResourcesHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
 	}
 }
 
+// createMCPReadResourceHandler reads the resource named by ?uri= from a server
+func createMCPReadResourceHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverName := c.Param("server")
+		uri := c.Query("uri")
+		if uri == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "uri query parameter is required"})
+			return
+		}
+		
+		response, err := mcpManager.ReadResource(c.Request.Context(), serverName, uri)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func createMCPPromptsHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prompts, err := mcpManager.ListPrompts(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		
+		c.JSON(http.StatusOK, gin.H{"prompts": prompts})
+	}
+}
+
+// createMCPPromptHandler renders a prompt with the arguments in the request body
+func createMCPPromptHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverName := c.Param("server")
+		promptName := c.Param("name")
+		
+		var req struct {
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		
+		response, err := mcpManager.GetPrompt(c.Request.Context(), serverName, promptName, req.Arguments)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		
+		c.JSON(http.StatusOK, response)
+	}
+}
+
 func createMCPToolHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serverName := c.Param("server")
@@ -499,6 +685,152 @@ func createMCPToolHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
 	}
 }
 
+// createMCPEventsHandler streams MCP change events over SSE. Each
+// ?resource=<server>:<uri> parameter subscribes to that resource for the
+// lifetime of the connection; list changes are forwarded to every listener.
+func createMCPEventsHandler(mcpManager *mcp.MCPManager) gin.HandlerFunc {
+	type subscription struct {
+		server string
+		uri    string
+	}
+	
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		
+		var held []subscription
+		release := func() {
+			for _, sub := range held {
+				if err := mcpManager.UnsubscribeResource(context.Background(), sub.server, sub.uri); err != nil {
+					logging.L().Warnw("mcp.events.unsubscribe.error", "server", sub.server, "uri", sub.uri, "error", err.Error())
+				}
+			}
+		}
+		defer release()
+		
+		for _, spec := range c.QueryArray("resource") {
+			server, uri, ok := strings.Cut(spec, ":")
+			if !ok || server == "" || uri == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "resource must be <server>:<uri>"})
+				return
+			}
+			if err := mcpManager.SubscribeResource(ctx, server, uri); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "resource": spec})
+				return
+			}
+			held = append(held, subscription{server: server, uri: uri})
+		}
+		
+		subscribed := func(server, uri string) bool {
+			for _, sub := range held {
+				if sub.server == server && sub.uri == uri {
+					return true
+				}
+			}
+			return false
+		}
+		
+		events, cancel := mcpManager.Events().Subscribe(32)
+		defer cancel()
+		
+		// Event streams are long-lived; lift the server's write timeout
+		_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+		
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		
+		claims, _ := auth.GetUserFromContext(c)
+		logging.L().Infow("mcp.events.open", "user", claims.Username, "subscriptions", len(held))
+		
+		keepalive := time.NewTicker(15 * time.Second)
+		defer keepalive.Stop()
+		
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return false
+				}
+				if event.Type == mcp.EventResourceUpdated && !subscribed(event.Server, event.URI) {
+					return true
+				}
+				c.SSEvent(event.Type, event)
+				return true
+			case <-keepalive.C:
+				c.SSEvent("ping", gin.H{"timestamp": time.Now()})
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		
+		logging.L().Infow("mcp.events.close", "user", claims.Username)
+	}
+}
+
+// Tool registry handler functions
+func createToolCatalogHandler(registry *tools.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := auth.GetUserFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		
+		catalog, err := registry.Catalog(c.Request.Context(), claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		
+		c.JSON(http.StatusOK, gin.H{
+			"tools": catalog,
+			"count": len(catalog),
+		})
+	}
+}
+
+func createToolRefreshHandler(registry *tools.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registry.Invalidate()
+		c.JSON(http.StatusOK, gin.H{"message": "Tool catalog refreshed"})
+	}
+}
+
+func createToolCallHandler(registry *tools.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := auth.GetUserFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		
+		var args map[string]interface{}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&args); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		
+		response, err := registry.Execute(c.Request.Context(), claims, c.Param("name"), args)
+		switch {
+		case errors.Is(err, tools.ErrToolNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, tools.ErrPermissionDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		
+		c.JSON(http.StatusOK, response)
+	}
+}
+
 func createDefaultAdmin(casbinManager *rbac.CasbinManager, jwtManager *auth.JWTManager, logger *log.Logger) error {
 	users, err := casbinManager.GetAllUsers()
 	if err != nil {
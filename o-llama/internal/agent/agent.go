@@ -0,0 +1,478 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/logging"
+	"inspector-gadget-os/o-llama/internal/mcp"
+	"inspector-gadget-os/o-llama/internal/tools"
+)
+
+// Default budgets applied when the server configuration leaves them unset
+const (
+	DefaultMaxSteps    = 8
+	DefaultMaxDuration = 2 * time.Minute
+	DefaultPendingTTL  = 15 * time.Minute
+)
+
+// Event types streamed to the client while the loop runs
+const (
+	EventDelta                = "delta"
+	EventAssistant            = "assistant"
+	EventToolCall             = "tool_call"
+	EventToolResult           = "tool_result"
+	EventConfirmationRequired = "confirmation_required"
+	EventDone                 = "done"
+	EventError                = "error"
+)
+
+// Reasons reported in the final done event
+const (
+	DoneReasonStop     = "stop"
+	DoneReasonMaxSteps = "max_steps"
+	DoneReasonTimeout  = "timeout"
+	DoneReasonConfirm  = "confirmation_required"
+)
+
+// Model runs a single chat turn against a tool-calling model
+type Model interface {
+	Chat(ctx context.Context, model string, messages []Message, defs []tools.FunctionDefinition, options map[string]interface{}, onDelta func(string)) (*Message, error)
+}
+
+// ToolExecutor is the subset of tools.Registry used by the agent
+type ToolExecutor interface {
+	Catalog(ctx context.Context, claims *auth.Claims) ([]tools.Tool, error)
+	Execute(ctx context.Context, claims *auth.Claims, name string, arguments map[string]interface{}) (*mcp.CallToolResponse, error)
+}
+
+// Config holds agent configuration
+type Config struct {
+	Model               Model
+	Tools               ToolExecutor
+	DefaultModel        string
+	MaxSteps            int
+	MaxDuration         time.Duration
+	RequireConfirmation bool
+
+	// PendingTTL is how long a loop paused for confirmation can be resumed
+	PendingTTL time.Duration
+}
+
+// ChatRequest is the body of POST /api/agent/chat
+type ChatRequest struct {
+	Model    string                 `json:"model,omitempty"`
+	Messages []Message              `json:"messages,omitempty"`
+	Tools    []string               `json:"tools,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+
+	// Budgets may only tighten the server limits
+	MaxSteps       int `json:"max_steps,omitempty"`
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+
+	// RequireConfirmation pauses before destructive tools. It can only turn
+	// confirmation on; the server config is a floor.
+	RequireConfirmation *bool `json:"require_confirmation,omitempty"`
+
+	// RunID and Approve resolve the tool calls held by the server for a
+	// previous confirmation_required event. The conversation, model and
+	// tools of that run are resumed; Messages are ignored.
+	RunID   string `json:"run_id,omitempty"`
+	Approve *bool  `json:"approve,omitempty"`
+}
+
+// Event is a single streamed step of the agent loop
+type Event struct {
+	Type       string                `json:"type"`
+	Step       int                   `json:"step"`
+	RunID      string                `json:"run_id,omitempty"`
+	Content    string                `json:"content,omitempty"`
+	Message    *Message              `json:"message,omitempty"`
+	ToolCall   *ToolCall             `json:"tool_call,omitempty"`
+	Result     *mcp.CallToolResponse `json:"result,omitempty"`
+	Pending    []ToolCall            `json:"pending,omitempty"`
+	Messages   []Message             `json:"messages,omitempty"`
+	DoneReason string                `json:"done_reason,omitempty"`
+	Error      string                `json:"error,omitempty"`
+}
+
+// Common errors
+var (
+	ErrNoMessages       = errors.New("messages are required")
+	ErrNoModel          = errors.New("model is required")
+	ErrNothingToApprove = errors.New("approve requires the run_id of a confirmation_required event")
+	ErrRunNotFound      = errors.New("no pending run with that run_id")
+)
+
+// pendingRun is a loop paused for confirmation. Only the calls held here can
+// be approved, never ones sent back by the client.
+type pendingRun struct {
+	user                string
+	model               string
+	tools               []string
+	options             map[string]interface{}
+	requireConfirmation bool
+	messages            []Message
+	calls               []ToolCall
+	expires             time.Time
+}
+
+// Agent runs multi-turn tool-calling conversations
+type Agent struct {
+	model               Model
+	tools               ToolExecutor
+	defaultModel        string
+	maxSteps            int
+	maxDuration         time.Duration
+	requireConfirmation bool
+	pendingTTL          time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingRun
+}
+
+// NewAgent creates a new agent
+func NewAgent(config Config) *Agent {
+	if config.MaxSteps <= 0 {
+		config.MaxSteps = DefaultMaxSteps
+	}
+
+	if config.MaxDuration <= 0 {
+		config.MaxDuration = DefaultMaxDuration
+	}
+
+	if config.PendingTTL <= 0 {
+		config.PendingTTL = DefaultPendingTTL
+	}
+
+	return &Agent{
+		model:               config.Model,
+		tools:               config.Tools,
+		defaultModel:        config.DefaultModel,
+		maxSteps:            config.MaxSteps,
+		maxDuration:         config.MaxDuration,
+		requireConfirmation: config.RequireConfirmation,
+		pendingTTL:          config.PendingTTL,
+		pending:             make(map[string]*pendingRun),
+	}
+}
+
+// Validate checks a request before any output is streamed
+func (a *Agent) Validate(req *ChatRequest) error {
+	if req.Approve != nil || req.RunID != "" {
+		if req.Approve == nil || req.RunID == "" {
+			return ErrNothingToApprove
+		}
+		return nil
+	}
+
+	if len(req.Messages) == 0 {
+		return ErrNoMessages
+	}
+
+	if req.Model == "" && a.defaultModel == "" {
+		return ErrNoModel
+	}
+
+	return nil
+}
+
+// HasPending reports whether runID is a paused run of username that can
+// still be resumed
+func (a *Agent) HasPending(username, runID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.prunePending()
+	p, ok := a.pending[runID]
+	return ok && p.user == username
+}
+
+// hold keeps a paused run for resumption, returning its ID
+func (a *Agent) hold(p *pendingRun) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.prunePending()
+	p.expires = time.Now().Add(a.pendingTTL)
+	a.pending[id] = p
+	return id, nil
+}
+
+// take removes and returns a paused run of username; runs can be resumed once
+func (a *Agent) take(username, runID string) (*pendingRun, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.prunePending()
+	p, ok := a.pending[runID]
+	if !ok || p.user != username {
+		return nil, ErrRunNotFound
+	}
+
+	delete(a.pending, runID)
+	return p, nil
+}
+
+// prunePending drops expired runs. The caller holds a.mu.
+func (a *Agent) prunePending() {
+	now := time.Now()
+	for id, p := range a.pending {
+		if now.After(p.expires) {
+			delete(a.pending, id)
+		}
+	}
+}
+
+// Run executes the agent loop, calling emit for every step. Emit errors
+// (e.g. a disconnected client) stop the loop.
+func (a *Agent) Run(ctx context.Context, claims *auth.Claims, req ChatRequest, emit func(Event) error) error {
+	if err := a.Validate(&req); err != nil {
+		return err
+	}
+
+	// Resuming restores the paused run rather than trusting the client
+	var resumed *pendingRun
+	if req.Approve != nil {
+		p, err := a.take(claims.Username, req.RunID)
+		if err != nil {
+			return err
+		}
+		resumed = p
+		req.Model, req.Tools, req.Options, req.Messages = p.model, p.tools, p.options, p.messages
+	}
+
+	model := req.Model
+	if model == "" {
+		model = a.defaultModel
+	}
+
+	maxSteps := a.maxSteps
+	if req.MaxSteps > 0 && req.MaxSteps < maxSteps {
+		maxSteps = req.MaxSteps
+	}
+
+	maxDuration := a.maxDuration
+	if timeout := time.Duration(req.TimeoutSeconds) * time.Second; timeout > 0 && timeout < maxDuration {
+		maxDuration = timeout
+	}
+
+	requireConfirmation := a.requireConfirmation
+	if req.RequireConfirmation != nil && *req.RequireConfirmation {
+		requireConfirmation = true
+	}
+	if resumed != nil && resumed.requireConfirmation {
+		requireConfirmation = true
+	}
+
+	ctx, cancel := context.WithTimeout(WithUser(ctx, claims.Username), maxDuration)
+	defer cancel()
+
+	available, defs, err := a.resolveTools(ctx, claims, req.Tools)
+	if err != nil {
+		return err
+	}
+
+	run := &run{
+		agent:     a,
+		claims:    claims,
+		available: available,
+		messages:  append([]Message(nil), req.Messages...),
+		emit:      emit,
+	}
+
+	// Resume a loop paused for confirmation
+	if resumed != nil {
+		if err := run.executeTools(ctx, 0, resumed.calls, *req.Approve); err != nil {
+			return run.finish(ctx, 0, err)
+		}
+	}
+
+	for step := 1; step <= maxSteps; step++ {
+		assistant, err := a.model.Chat(ctx, model, run.messages, defs, req.Options, func(delta string) {
+			emit(Event{Type: EventDelta, Step: step, Content: delta})
+		})
+		if err != nil {
+			return run.finish(ctx, step, err)
+		}
+
+		for i := range assistant.ToolCalls {
+			if assistant.ToolCalls[i].ID == "" {
+				assistant.ToolCalls[i].ID = fmt.Sprintf("call_%d_%d", step, i)
+			}
+		}
+
+		run.messages = append(run.messages, *assistant)
+		if err := emit(Event{Type: EventAssistant, Step: step, Message: assistant}); err != nil {
+			return err
+		}
+
+		if len(assistant.ToolCalls) == 0 {
+			return emit(Event{Type: EventDone, Step: step, DoneReason: DoneReasonStop, Messages: run.messages})
+		}
+
+		if requireConfirmation && run.needsConfirmation(assistant.ToolCalls) {
+			runID, err := a.hold(&pendingRun{
+				user:                claims.Username,
+				model:               model,
+				tools:               req.Tools,
+				options:             req.Options,
+				requireConfirmation: requireConfirmation,
+				messages:            run.messages,
+				calls:               assistant.ToolCalls,
+			})
+			if err != nil {
+				return err
+			}
+
+			logging.L().Infow("agent.confirmation_required", "user", claims.Username, "step", step, "calls", len(assistant.ToolCalls), "run_id", runID)
+			return emit(Event{
+				Type:       EventConfirmationRequired,
+				Step:       step,
+				RunID:      runID,
+				Pending:    assistant.ToolCalls,
+				Messages:   run.messages,
+				DoneReason: DoneReasonConfirm,
+			})
+		}
+
+		if err := run.executeTools(ctx, step, assistant.ToolCalls, true); err != nil {
+			return run.finish(ctx, step, err)
+		}
+	}
+
+	return emit(Event{Type: EventDone, Step: maxSteps, DoneReason: DoneReasonMaxSteps, Messages: run.messages})
+}
+
+// resolveTools returns the caller's catalog, optionally narrowed to a named subset
+func (a *Agent) resolveTools(ctx context.Context, claims *auth.Claims, names []string) (map[string]tools.Tool, []tools.FunctionDefinition, error) {
+	catalog, err := a.tools.Catalog(ctx, claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load tool catalog: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	available := make(map[string]tools.Tool, len(catalog))
+	defs := make([]tools.FunctionDefinition, 0, len(catalog))
+	for _, tool := range catalog {
+		if len(wanted) > 0 && !wanted[tool.Name] {
+			continue
+		}
+		available[tool.Name] = tool
+		defs = append(defs, tool.Definition())
+	}
+
+	return available, defs, nil
+}
+
+// run holds the state of a single agent invocation
+type run struct {
+	agent     *Agent
+	claims    *auth.Claims
+	available map[string]tools.Tool
+	messages  []Message
+	emit      func(Event) error
+}
+
+// needsConfirmation reports whether any requested call targets a destructive tool
+func (r *run) needsConfirmation(calls []ToolCall) bool {
+	for _, call := range calls {
+		if tool, ok := r.available[call.Function.Name]; ok && tool.Destructive {
+			return true
+		}
+	}
+	return false
+}
+
+// executeTools runs each tool call and appends the results to the conversation
+func (r *run) executeTools(ctx context.Context, step int, calls []ToolCall, approved bool) error {
+	for i := range calls {
+		call := calls[i]
+		if err := r.emit(Event{Type: EventToolCall, Step: step, ToolCall: &call}); err != nil {
+			return err
+		}
+
+		result := r.executeTool(ctx, call, approved)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		r.messages = append(r.messages, Message{
+			Role:     "tool",
+			Content:  resultText(result),
+			ToolName: call.Function.Name,
+		})
+
+		if err := r.emit(Event{Type: EventToolResult, Step: step, ToolCall: &call, Result: result}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executeTool dispatches one call, reporting failures as tool errors
+func (r *run) executeTool(ctx context.Context, call ToolCall, approved bool) *mcp.CallToolResponse {
+	name := call.Function.Name
+	if _, ok := r.available[name]; !ok {
+		return toolError("tool not available: " + name)
+	}
+
+	if !approved {
+		return toolError("tool call was not approved by the user")
+	}
+
+	result, err := r.agent.tools.Execute(ctx, r.claims, name, call.Function.Arguments)
+	if err != nil {
+		return toolError(err.Error())
+	}
+	return result
+}
+
+// finish reports a terminal error, mapping an exhausted time budget to a done event
+func (r *run) finish(ctx context.Context, step int, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return r.emit(Event{Type: EventDone, Step: step, DoneReason: DoneReasonTimeout, Messages: r.messages})
+	}
+	return err
+}
+
+// resultText flattens a tool response into text for the model
+func resultText(result *mcp.CallToolResponse) string {
+	var parts []string
+	for _, item := range result.Content {
+		if item.Type == mcp.ContentTypeText && item.Text != "" {
+			parts = append(parts, item.Text)
+		}
+	}
+
+	text := strings.Join(parts, "\n")
+	if result.IsError {
+		return "Error: " + text
+	}
+	return text
+}
+
+// toolError wraps a message in a failed tool response
+func toolError(message string) *mcp.CallToolResponse {
+	return &mcp.CallToolResponse{
+		Content: []mcp.ContentItem{{Type: mcp.ContentTypeText, Text: message}},
+		IsError: true,
+	}
+}
@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/mcp"
+	"inspector-gadget-os/o-llama/internal/tools"
+)
+
+// scriptedModel replays a fixed sequence of assistant turns
+type scriptedModel struct {
+	turns []Message
+	calls int
+	delay time.Duration
+}
+
+func (m *scriptedModel) Chat(ctx context.Context, model string, messages []Message, defs []tools.FunctionDefinition, options map[string]interface{}, onDelta func(string)) (*Message, error) {
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	turn := m.turns[m.calls%len(m.turns)]
+	m.calls++
+	if turn.Content != "" {
+		onDelta(turn.Content)
+	}
+	return &turn, nil
+}
+
+type fakeExecutor struct {
+	executed []string
+}
+
+func (f *fakeExecutor) Catalog(ctx context.Context, claims *auth.Claims) ([]tools.Tool, error) {
+	return []tools.Tool{
+		{Name: "fs.read", Source: tools.SourceBuiltin},
+		{Name: "fs.write", Source: tools.SourceBuiltin, Destructive: true},
+	}, nil
+}
+
+func (f *fakeExecutor) Execute(ctx context.Context, claims *auth.Claims, name string, arguments map[string]interface{}) (*mcp.CallToolResponse, error) {
+	f.executed = append(f.executed, name)
+	return &mcp.CallToolResponse{Content: []mcp.ContentItem{{Type: mcp.ContentTypeText, Text: "result of " + name}}}, nil
+}
+
+func toolCall(name string) Message {
+	return Message{Role: "assistant", ToolCalls: []ToolCall{{Function: ToolCallFunction{Name: name, Arguments: map[string]interface{}{"path": "/tmp/a.txt"}}}}}
+}
+
+func collect(events *[]Event) func(Event) error {
+	return func(e Event) error {
+		*events = append(*events, e)
+		return nil
+	}
+}
+
+func eventTypes(events []Event) []string {
+	var types []string
+	for _, e := range events {
+		if e.Type != EventDelta {
+			types = append(types, e.Type)
+		}
+	}
+	return types
+}
+
+var testClaims = &auth.Claims{Username: "tester", Roles: []string{"user"}}
+
+func TestRunExecutesToolsUntilAnswer(t *testing.T) {
+	model := &scriptedModel{turns: []Message{toolCall("fs.read"), {Role: "assistant", Content: "done"}}}
+	executor := &fakeExecutor{}
+	agent := NewAgent(Config{Model: model, Tools: executor, DefaultModel: "test"})
+
+	var events []Event
+	err := agent.Run(context.Background(), testClaims, ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}, collect(&events))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{EventAssistant, EventToolCall, EventToolResult, EventAssistant, EventDone}, eventTypes(events))
+	assert.Equal(t, []string{"fs.read"}, executor.executed)
+
+	done := events[len(events)-1]
+	assert.Equal(t, DoneReasonStop, done.DoneReason)
+	require.Len(t, done.Messages, 4)
+	assert.Equal(t, "tool", done.Messages[2].Role)
+	assert.Equal(t, "fs.read", done.Messages[2].ToolName)
+	assert.Equal(t, "result of fs.read", done.Messages[2].Content)
+}
+
+func TestRunRequiresConfirmationForDestructiveTools(t *testing.T) {
+	model := &scriptedModel{turns: []Message{toolCall("fs.write")}}
+	executor := &fakeExecutor{}
+	agent := NewAgent(Config{Model: model, Tools: executor, DefaultModel: "test", RequireConfirmation: true})
+
+	pause := func() Event {
+		t.Helper()
+		model.turns = []Message{toolCall("fs.write")}
+		model.calls = 0
+
+		var events []Event
+		require.NoError(t, agent.Run(context.Background(), testClaims, ChatRequest{Messages: []Message{{Role: "user", Content: "write"}}}, collect(&events)))
+
+		last := events[len(events)-1]
+		require.Equal(t, EventConfirmationRequired, last.Type)
+		require.NotEmpty(t, last.RunID)
+		require.Len(t, last.Pending, 1)
+		assert.Equal(t, "call_1_0", last.Pending[0].ID)
+		return last
+	}
+
+	// Denying resumes the loop without executing the tool
+	last := pause()
+	assert.Empty(t, executor.executed)
+	model.turns = []Message{{Role: "assistant", Content: "ok, skipped"}}
+	model.calls = 0
+	deny := false
+	var events []Event
+	err := agent.Run(context.Background(), testClaims, ChatRequest{RunID: last.RunID, Approve: &deny}, collect(&events))
+	require.NoError(t, err)
+	assert.Empty(t, executor.executed)
+	assert.Equal(t, []string{EventToolCall, EventToolResult, EventAssistant, EventDone}, eventTypes(events))
+	assert.True(t, events[1].Result.IsError)
+
+	// A run is resumed once, and only by its user
+	approve := true
+	assert.ErrorIs(t, agent.Run(context.Background(), testClaims, ChatRequest{RunID: last.RunID, Approve: &approve}, collect(&events)), ErrRunNotFound)
+
+	last = pause()
+	other := &auth.Claims{Username: "other", Roles: []string{"user"}}
+	assert.False(t, agent.HasPending(other.Username, last.RunID))
+	assert.ErrorIs(t, agent.Run(context.Background(), other, ChatRequest{RunID: last.RunID, Approve: &approve}, collect(&events)), ErrRunNotFound)
+	assert.Empty(t, executor.executed)
+
+	// Approving executes the held call, not calls sent by the client
+	assert.True(t, agent.HasPending(testClaims.Username, last.RunID))
+	model.turns = []Message{{Role: "assistant", Content: "written"}}
+	model.calls = 0
+	forged := append(last.Messages[:len(last.Messages)-1:len(last.Messages)-1], toolCall("fs.delete"))
+	events = nil
+	err = agent.Run(context.Background(), testClaims, ChatRequest{RunID: last.RunID, Approve: &approve, Messages: forged}, collect(&events))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fs.write"}, executor.executed)
+}
+
+func TestRunConfirmationIsAServerFloor(t *testing.T) {
+	model := &scriptedModel{turns: []Message{toolCall("fs.write")}}
+	executor := &fakeExecutor{}
+	agent := NewAgent(Config{Model: model, Tools: executor, DefaultModel: "test", RequireConfirmation: true})
+
+	off := false
+	var events []Event
+	req := ChatRequest{Messages: []Message{{Role: "user", Content: "write"}}, RequireConfirmation: &off}
+	require.NoError(t, agent.Run(context.Background(), testClaims, req, collect(&events)))
+	assert.Equal(t, EventConfirmationRequired, events[len(events)-1].Type)
+	assert.Empty(t, executor.executed)
+
+	// Requests can still ask for confirmation when the server doesn't
+	agent = NewAgent(Config{Model: model, Tools: executor, DefaultModel: "test"})
+	model.calls = 0
+	on := true
+	events = nil
+	req.RequireConfirmation = &on
+	require.NoError(t, agent.Run(context.Background(), testClaims, req, collect(&events)))
+	assert.Equal(t, EventConfirmationRequired, events[len(events)-1].Type)
+	assert.Empty(t, executor.executed)
+}
+
+func TestRunEnforcesBudgets(t *testing.T) {
+	model := &scriptedModel{turns: []Message{toolCall("fs.read")}}
+	agent := NewAgent(Config{Model: model, Tools: &fakeExecutor{}, DefaultModel: "test", MaxSteps: 5})
+
+	var events []Event
+	err := agent.Run(context.Background(), testClaims, ChatRequest{Messages: []Message{{Role: "user", Content: "loop"}}, MaxSteps: 2}, collect(&events))
+	require.NoError(t, err)
+	assert.Equal(t, 2, model.calls)
+	assert.Equal(t, DoneReasonMaxSteps, events[len(events)-1].DoneReason)
+
+	model = &scriptedModel{turns: []Message{toolCall("fs.read")}, delay: 50 * time.Millisecond}
+	agent = NewAgent(Config{Model: model, Tools: &fakeExecutor{}, DefaultModel: "test", MaxDuration: 20 * time.Millisecond})
+
+	events = nil
+	err = agent.Run(context.Background(), testClaims, ChatRequest{Messages: []Message{{Role: "user", Content: "slow"}}}, collect(&events))
+	require.NoError(t, err)
+	assert.Equal(t, DoneReasonTimeout, events[len(events)-1].DoneReason)
+}
+
+func TestRunRejectsUnavailableTools(t *testing.T) {
+	model := &scriptedModel{turns: []Message{toolCall("fs.write"), {Role: "assistant", Content: "done"}}}
+	executor := &fakeExecutor{}
+	agent := NewAgent(Config{Model: model, Tools: executor, DefaultModel: "test"})
+
+	var events []Event
+	req := ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}, Tools: []string{"fs.read"}}
+	require.NoError(t, agent.Run(context.Background(), testClaims, req, collect(&events)))
+	assert.Empty(t, executor.executed)
+	assert.True(t, events[2].Result.IsError)
+}
+
+func TestValidate(t *testing.T) {
+	agent := NewAgent(Config{Model: &scriptedModel{}, Tools: &fakeExecutor{}})
+	approve := true
+
+	assert.ErrorIs(t, agent.Validate(&ChatRequest{}), ErrNoMessages)
+	assert.ErrorIs(t, agent.Validate(&ChatRequest{Messages: []Message{{Role: "user"}}}), ErrNoModel)
+	assert.ErrorIs(t, agent.Validate(&ChatRequest{Model: "m", Messages: []Message{{Role: "user"}}, Approve: &approve}), ErrNothingToApprove)
+	assert.ErrorIs(t, agent.Validate(&ChatRequest{RunID: "abc"}), ErrNothingToApprove)
+	assert.NoError(t, agent.Validate(&ChatRequest{RunID: "abc", Approve: &approve}))
+}
+
+func TestModelClientAssemblesStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req modelChatRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		assert.Len(t, req.Tools, 1)
+
+		enc := json.NewEncoder(w)
+		enc.Encode(modelChatResponse{Message: Message{Role: "assistant", Content: "Hel"}})
+		enc.Encode(modelChatResponse{Message: Message{Role: "assistant", Content: "lo"}})
+		enc.Encode(modelChatResponse{Message: Message{Role: "assistant", ToolCalls: []ToolCall{{Function: ToolCallFunction{Name: "fs.read"}}}}})
+		enc.Encode(modelChatResponse{Done: true, DoneReason: "stop"})
+	}))
+	defer server.Close()
+
+	var deltas []string
+	client := NewModelClient(server.URL + "/")
+	msg, err := client.Chat(context.Background(), "m", []Message{{Role: "user", Content: "hi"}},
+		[]tools.FunctionDefinition{(tools.Tool{Name: "fs.read"}).Definition()}, nil,
+		func(d string) { deltas = append(deltas, d) })
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello", msg.Content)
+	assert.Equal(t, []string{"Hel", "lo"}, deltas)
+	require.Len(t, msg.ToolCalls, 1)
+	assert.Equal(t, "fs.read", msg.ToolCalls[0].Function.Name)
+}
+
+func TestModelClientForwardsUser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "alice", r.Header.Get(UserHeader))
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewModelClient(server.URL)
+	_, err := client.Chat(WithUser(context.Background(), "alice"), "m", []Message{{Role: "user", Content: "hi"}}, nil, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "retry after 3s")
+}
@@ -0,0 +1,164 @@
+// Package agent runs tool-calling conversations between a local model and the
+// gadget, MCP and SafeFS backends exposed by the tool registry.
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"inspector-gadget-os/o-llama/internal/tools"
+)
+
+// Message is a single chat message exchanged with the model runtime
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Thinking  string     `json:"thinking,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	ID       string           `json:"id,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction names the function and carries its arguments
+type ToolCallFunction struct {
+	Index     int                    `json:"index,omitempty"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// modelChatRequest mirrors the runtime's /api/chat request body
+type modelChatRequest struct {
+	Model    string                     `json:"model"`
+	Messages []Message                  `json:"messages"`
+	Tools    []tools.FunctionDefinition `json:"tools,omitempty"`
+	Stream   bool                       `json:"stream"`
+	Options  map[string]interface{}     `json:"options,omitempty"`
+}
+
+// modelChatResponse mirrors a single streamed /api/chat response chunk
+type modelChatResponse struct {
+	Message    Message `json:"message"`
+	Done       bool    `json:"done"`
+	DoneReason string  `json:"done_reason,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// UserHeader tells the model runtime which user a request is made for, so
+// that its scheduler queues each user's requests fairly
+const UserHeader = "X-Ollama-User"
+
+type userKey struct{}
+
+// WithUser returns a context whose model requests are made on behalf of username
+func WithUser(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, userKey{}, username)
+}
+
+// UserFromContext returns the user set with WithUser, if any
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// ModelClient talks to the bundled model runtime over its HTTP API
+type ModelClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewModelClient creates a client for the model runtime at baseURL
+func NewModelClient(baseURL string) *ModelClient {
+	return &ModelClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{},
+	}
+}
+
+// Chat runs one model turn, invoking onDelta for each streamed content chunk,
+// and returns the assembled assistant message
+func (m *ModelClient) Chat(ctx context.Context, model string, messages []Message, defs []tools.FunctionDefinition, options map[string]interface{}, onDelta func(string)) (*Message, error) {
+	body, err := json.Marshal(modelChatRequest{
+		Model:    model,
+		Messages: messages,
+		Tools:    defs,
+		Stream:   true,
+		Options:  options,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if user := UserFromContext(ctx); user != "" {
+		req.Header.Set(UserHeader, user)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("model runtime unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("model runtime busy, retry after %ss", resp.Header.Get("Retry-After"))
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("model runtime error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	assistant := &Message{Role: "assistant"}
+	var content, thinking strings.Builder
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var chunk modelChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("invalid model response: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("model runtime error: %s", chunk.Error)
+		}
+
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if onDelta != nil {
+				onDelta(chunk.Message.Content)
+			}
+		}
+		thinking.WriteString(chunk.Message.Thinking)
+		assistant.ToolCalls = append(assistant.ToolCalls, chunk.Message.ToolCalls...)
+
+		if chunk.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	assistant.Content = content.String()
+	assistant.Thinking = thinking.String()
+	return assistant, nil
+}
@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/logging"
+)
+
+// Chat handles POST /api/agent/chat, streaming loop events as NDJSON
+func (a *Agent) Chat(c *gin.Context) {
+	claims, err := auth.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var req ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := a.Validate(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Approve != nil && !a.HasPending(claims.Username, req.RunID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrRunNotFound.Error()})
+		return
+	}
+
+	// Agent runs outlive the server's default write timeout; the loop's own
+	// time budget bounds the response instead.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+
+	requestID := c.GetString(logging.RequestIDKey)
+	start := time.Now()
+	logging.L().Infow("agent.chat.start",
+		"request_id", requestID,
+		"user", claims.Username,
+		"model", req.Model,
+		"messages", len(req.Messages),
+		"run_id", req.RunID,
+	)
+
+	steps := 0
+	emit := func(event Event) error {
+		if event.Type == EventAssistant {
+			steps++
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Writer.Write(append(data, '\n')); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	if err := a.Run(c.Request.Context(), claims, req, emit); err != nil {
+		logging.L().Warnw("agent.chat.error", "request_id", requestID, "user", claims.Username, "error", err.Error())
+		emit(Event{Type: EventError, Error: err.Error()})
+	}
+
+	logging.L().Infow("agent.chat.finish",
+		"request_id", requestID,
+		"user", claims.Username,
+		"steps", steps,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+}
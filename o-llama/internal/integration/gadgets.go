@@ -6,15 +6,23 @@ import (
 	"fmt"
 	"net/http"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"inspector-gadget-os/o-llama/internal/auth"
     "inspector-gadget-os/o-llama/internal/logging"
+	"inspector-gadget-os/o-llama/internal/metrics"
 	"inspector-gadget-os/o-llama/internal/rbac"
 )
 
+var (
+	gadgetExecutions        = metrics.Factory.NewCounterVec(prometheus.CounterOpts{Name: "inspector_gadget_gadget_executions_total", Help: "Gadget executions by exit code."}, []string{"gadget", "exit_code"})
+	gadgetExecutionDuration = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{Name: "inspector_gadget_gadget_execution_duration_seconds", Help: "Time to run a gadget.", Buckets: prometheus.DefBuckets}, []string{"gadget"})
+)
+
 // GadgetIntegration provides secure integration with the gadget framework
 type GadgetIntegration struct {
 	gadgetBinaryPath string
@@ -233,20 +241,51 @@ func (gi *GadgetIntegration) ExecuteSystemGadget(c *gin.Context) {
 	}
 }
 
+// List returns the gadgets reported by the gadget framework binary
+func (gi *GadgetIntegration) List() ([]GadgetInfo, error) {
+	cmd := exec.Command(gi.gadgetBinaryPath, "list")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return gi.parseGadgetList(string(output)), nil
+}
+
+// Run validates a gadget name and executes it on behalf of a user.
+// Callers are responsible for RBAC checks before invoking Run.
+func (gi *GadgetIntegration) Run(ctx context.Context, gadgetName string, args []string, username string) (*GadgetExecuteResponse, error) {
+	if !gi.isValidGadgetName(gadgetName) {
+		return nil, fmt.Errorf("invalid gadget name")
+	}
+	return gi.executeGadgetCommandContext(ctx, gadgetName, args, username), nil
+}
+
+// IsSystemGadget reports whether a gadget requires system management permission
+func (gi *GadgetIntegration) IsSystemGadget(name string) bool {
+	return gi.isSystemGadget(name)
+}
+
 // executeGadgetCommand executes a gadget command with security measures
 func (gi *GadgetIntegration) executeGadgetCommand(gadgetName string, args []string, username string) *GadgetExecuteResponse {
+	return gi.executeGadgetCommandContext(context.Background(), gadgetName, args, username)
+}
+
+// executeGadgetCommandContext executes a gadget command bounded by the parent context
+func (gi *GadgetIntegration) executeGadgetCommandContext(parent context.Context, gadgetName string, args []string, username string) *GadgetExecuteResponse {
 	// Prepare command
 	cmdArgs := []string{"run", gadgetName}
 	cmdArgs = append(cmdArgs, args...)
 	
 	// Create command with timeout context
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second) // 30 second timeout
+	ctx, cancel := context.WithTimeout(parent, 30*time.Second) // 30 second timeout
 	defer cancel()
 	
 	cmd := exec.CommandContext(ctx, gi.gadgetBinaryPath, cmdArgs...)
 	
 	// Execute command
+	start := time.Now()
 	output, err := cmd.CombinedOutput()
+	gadgetExecutionDuration.WithLabelValues(gadgetName).Observe(time.Since(start).Seconds())
 	
 	response := &GadgetExecuteResponse{
 		GadgetName: gadgetName,
@@ -267,6 +306,7 @@ func (gi *GadgetIntegration) executeGadgetCommand(gadgetName string, args []stri
 		response.Success = true
 		response.ExitCode = 0
 	}
+	gadgetExecutions.WithLabelValues(gadgetName, strconv.Itoa(response.ExitCode)).Inc()
 	
 	// TODO: Add audit logging here
 	// gi.auditLogger.LogGadgetExecution(username, gadgetName, args, response.Success)
@@ -4,7 +4,9 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"sync"
 	"time"
@@ -31,9 +33,15 @@ type MCPClient struct {
 	
 	// Event handlers
 	onResourceChanged func([]Resource)
+	onResourceUpdated func(string)
 	onToolChanged     func([]Tool)
 	onPromptChanged   func([]Prompt)
 	
+	// Resource subscriptions and cached contents of subscribed resources
+	subscriptions map[string]bool
+	resourceCache map[string]*ReadResourceResponse
+	cacheMutex    sync.RWMutex
+	
 	// Context for cancellation
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -70,6 +78,8 @@ func NewMCPClient(config MCPClientConfig) *MCPClient {
 		capabilities:    config.Capabilities,
 		idGen:           NewMessageIDGenerator(),
 		pendingRequests: make(map[interface{}]chan *Message),
+		subscriptions:   make(map[string]bool),
+		resourceCache:   make(map[string]*ReadResourceResponse),
 		ctx:             ctx,
 		cancel:          cancel,
 		logger:          config.Logger,
@@ -179,6 +189,8 @@ func (c *MCPClient) sendRequest(ctx context.Context, method string, params inter
 	select {
 	case response := <-respChan:
 		return response, nil
+	case <-c.ctx.Done():
+		return nil, fmt.Errorf("connection closed")
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case <-time.After(30 * time.Second):
@@ -195,6 +207,13 @@ func (c *MCPClient) handleMessages() {
 		default:
 			message, err := c.transport.Receive()
 			if err != nil {
+				// A closed stream or dead transport ends the session; fail
+				// pending requests instead of spinning on the error
+				if errors.Is(err, io.EOF) || !c.transport.IsConnected() {
+					c.logger.Printf("Transport closed: %v", err)
+					c.cancel()
+					return
+				}
 				c.logger.Printf("Error receiving message: %v", err)
 				continue
 			}
@@ -223,7 +242,7 @@ func (c *MCPClient) processMessage(message *Message) {
 // handleResponse handles response messages
 func (c *MCPClient) handleResponse(message *Message) {
 	c.requestMutex.RLock()
-	respChan, exists := c.pendingRequests[message.ID]
+	respChan, exists := c.pendingRequests[normalizeID(message.ID)]
 	c.requestMutex.RUnlock()
 	
 	if exists {
@@ -237,31 +256,52 @@ func (c *MCPClient) handleResponse(message *Message) {
 	}
 }
 
-// handleNotification handles notification messages
+// handleNotification handles notification messages. Handlers that issue
+// follow-up requests run in their own goroutine so the message loop stays
+// free to deliver the responses.
 func (c *MCPClient) handleNotification(message *Message) {
 	switch message.Method {
 	case "notifications/resources/list_changed":
+		// Listed resources may have been removed, so drop all cached contents
+		c.clearResourceCache()
 		if c.onResourceChanged != nil {
-			// Fetch updated resources
-			if resources, err := c.ListResources(c.ctx); err == nil {
-				c.onResourceChanged(resources.Resources)
-			}
+			go func() {
+				// Fetch updated resources
+				if resources, err := c.ListResources(c.ctx); err == nil {
+					c.onResourceChanged(resources.Resources)
+				}
+			}()
+		}
+		
+	case "notifications/resources/updated":
+		var params ResourceUpdatedNotification
+		if err := parseResult(message.Params, &params); err != nil || params.URI == "" {
+			c.logger.Printf("Invalid resource update notification: %v", err)
+			return
+		}
+		c.invalidateResource(params.URI)
+		if c.onResourceUpdated != nil {
+			c.onResourceUpdated(params.URI)
 		}
 		
 	case "notifications/tools/list_changed":
 		if c.onToolChanged != nil {
-			// Fetch updated tools
-			if tools, err := c.ListTools(c.ctx); err == nil {
-				c.onToolChanged(tools.Tools)
-			}
+			go func() {
+				// Fetch updated tools
+				if tools, err := c.ListTools(c.ctx); err == nil {
+					c.onToolChanged(tools.Tools)
+				}
+			}()
 		}
 		
 	case "notifications/prompts/list_changed":
 		if c.onPromptChanged != nil {
-			// Fetch updated prompts
-			if prompts, err := c.ListPrompts(c.ctx); err == nil {
-				c.onPromptChanged(prompts.Prompts)
-			}
+			go func() {
+				// Fetch updated prompts
+				if prompts, err := c.ListPrompts(c.ctx); err == nil {
+					c.onPromptChanged(prompts.Prompts)
+				}
+			}()
 		}
 		
 	default:
@@ -278,35 +318,84 @@ func (c *MCPClient) handleRequest(message *Message) {
 	c.transport.Send(errorResp)
 }
 
-// ListResources requests available resources from the server
+// ListResources requests all available resources from the server, following
+// pagination cursors until the last page
 func (c *MCPClient) ListResources(ctx context.Context) (*ListResourcesResponse, error) {
 	if !c.IsReady() {
 		return nil, fmt.Errorf("client not ready")
 	}
 	
-	response, err := c.sendRequest(ctx, "resources/list", nil)
+	var all ListResourcesResponse
+	err := c.listPages(ctx, "resources/list", func(result interface{}) (string, error) {
+		var page ListResourcesResponse
+		if err := parseResult(result, &page); err != nil {
+			return "", err
+		}
+		all.Resources = append(all.Resources, page.Resources...)
+		return page.NextCursor, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 	
-	if response.Error != nil {
-		return nil, fmt.Errorf("server error: %s", response.Error.Message)
-	}
-	
-	var result ListResourcesResponse
-	if err := parseResult(response.Result, &result); err != nil {
-		return nil, err
+	return &all, nil
+}
+
+// listPages issues a list request repeatedly, passing each page's result to
+// collect until it returns an empty cursor
+func (c *MCPClient) listPages(ctx context.Context, method string, collect func(result interface{}) (string, error)) error {
+	cursor := ""
+	seen := make(map[string]bool)
+	
+	for page := 0; page < MaxListPages; page++ {
+		var params interface{}
+		if cursor != "" {
+			params = ListRequest{Cursor: cursor}
+		}
+		
+		response, err := c.sendRequest(ctx, method, params)
+		if err != nil {
+			return err
+		}
+		
+		if response.Error != nil {
+			return fmt.Errorf("server error: %s", response.Error.Message)
+		}
+		
+		next, err := collect(response.Result)
+		if err != nil {
+			return err
+		}
+		
+		if next == "" {
+			return nil
+		}
+		
+		// A server repeating a cursor would otherwise loop forever
+		if seen[next] {
+			return fmt.Errorf("%s: server returned repeated cursor %q", method, next)
+		}
+		seen[next] = true
+		cursor = next
 	}
 	
-	return &result, nil
+	return fmt.Errorf("%s: exceeded %d pages", method, MaxListPages)
 }
 
-// ReadResource requests content of a specific resource
+// ReadResource requests content of a specific resource. Contents of
+// subscribed resources are cached until the server reports an update.
 func (c *MCPClient) ReadResource(ctx context.Context, uri string) (*ReadResourceResponse, error) {
 	if !c.IsReady() {
 		return nil, fmt.Errorf("client not ready")
 	}
 	
+	c.cacheMutex.RLock()
+	cached, hit := c.resourceCache[uri]
+	c.cacheMutex.RUnlock()
+	if hit {
+		return cached, nil
+	}
+	
 	request := ReadResourceRequest{URI: uri}
 	response, err := c.sendRequest(ctx, "resources/read", request)
 	if err != nil {
@@ -322,30 +411,112 @@ func (c *MCPClient) ReadResource(ctx context.Context, uri string) (*ReadResource
 		return nil, err
 	}
 	
+	c.cacheMutex.Lock()
+	if c.subscriptions[uri] {
+		c.resourceCache[uri] = &result
+	}
+	c.cacheMutex.Unlock()
+	
 	return &result, nil
 }
 
-// ListTools requests available tools from the server
-func (c *MCPClient) ListTools(ctx context.Context) (*ListToolsResponse, error) {
+// SubscribeResource asks the server to send update notifications for a resource
+func (c *MCPClient) SubscribeResource(ctx context.Context, uri string) error {
 	if !c.IsReady() {
-		return nil, fmt.Errorf("client not ready")
+		return fmt.Errorf("client not ready")
 	}
 	
-	response, err := c.sendRequest(ctx, "tools/list", nil)
+	caps := c.GetServerCapabilities()
+	if caps == nil || caps.Resources == nil || !caps.Resources.Subscribe {
+		return fmt.Errorf("server does not support resource subscriptions")
+	}
+	
+	response, err := c.sendRequest(ctx, "resources/subscribe", SubscribeRequest{URI: uri})
 	if err != nil {
-		return nil, err
+		return err
 	}
 	
 	if response.Error != nil {
-		return nil, fmt.Errorf("server error: %s", response.Error.Message)
+		return fmt.Errorf("server error: %s", response.Error.Message)
 	}
 	
-	var result ListToolsResponse
-	if err := parseResult(response.Result, &result); err != nil {
+	c.cacheMutex.Lock()
+	c.subscriptions[uri] = true
+	c.cacheMutex.Unlock()
+	
+	return nil
+}
+
+// UnsubscribeResource stops update notifications for a resource
+func (c *MCPClient) UnsubscribeResource(ctx context.Context, uri string) error {
+	if !c.IsReady() {
+		return fmt.Errorf("client not ready")
+	}
+	
+	c.cacheMutex.Lock()
+	delete(c.subscriptions, uri)
+	delete(c.resourceCache, uri)
+	c.cacheMutex.Unlock()
+	
+	response, err := c.sendRequest(ctx, "resources/unsubscribe", SubscribeRequest{URI: uri})
+	if err != nil {
+		return err
+	}
+	
+	if response.Error != nil {
+		return fmt.Errorf("server error: %s", response.Error.Message)
+	}
+	
+	return nil
+}
+
+// Subscriptions returns the URIs this client is subscribed to
+func (c *MCPClient) Subscriptions() []string {
+	c.cacheMutex.RLock()
+	defer c.cacheMutex.RUnlock()
+	
+	uris := make([]string, 0, len(c.subscriptions))
+	for uri := range c.subscriptions {
+		uris = append(uris, uri)
+	}
+	return uris
+}
+
+// invalidateResource drops cached contents for a single resource
+func (c *MCPClient) invalidateResource(uri string) {
+	c.cacheMutex.Lock()
+	delete(c.resourceCache, uri)
+	c.cacheMutex.Unlock()
+}
+
+// clearResourceCache drops all cached resource contents
+func (c *MCPClient) clearResourceCache() {
+	c.cacheMutex.Lock()
+	c.resourceCache = make(map[string]*ReadResourceResponse)
+	c.cacheMutex.Unlock()
+}
+
+// ListTools requests all available tools from the server, following
+// pagination cursors until the last page
+func (c *MCPClient) ListTools(ctx context.Context) (*ListToolsResponse, error) {
+	if !c.IsReady() {
+		return nil, fmt.Errorf("client not ready")
+	}
+	
+	var all ListToolsResponse
+	err := c.listPages(ctx, "tools/list", func(result interface{}) (string, error) {
+		var page ListToolsResponse
+		if err := parseResult(result, &page); err != nil {
+			return "", err
+		}
+		all.Tools = append(all.Tools, page.Tools...)
+		return page.NextCursor, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 	
-	return &result, nil
+	return &all, nil
 }
 
 // CallTool executes a tool on the server
@@ -376,27 +547,27 @@ func (c *MCPClient) CallTool(ctx context.Context, name string, arguments interfa
 	return &result, nil
 }
 
-// ListPrompts requests available prompts from the server
+// ListPrompts requests all available prompts from the server, following
+// pagination cursors until the last page
 func (c *MCPClient) ListPrompts(ctx context.Context) (*ListPromptsResponse, error) {
 	if !c.IsReady() {
 		return nil, fmt.Errorf("client not ready")
 	}
 	
-	response, err := c.sendRequest(ctx, "prompts/list", nil)
+	var all ListPromptsResponse
+	err := c.listPages(ctx, "prompts/list", func(result interface{}) (string, error) {
+		var page ListPromptsResponse
+		if err := parseResult(result, &page); err != nil {
+			return "", err
+		}
+		all.Prompts = append(all.Prompts, page.Prompts...)
+		return page.NextCursor, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 	
-	if response.Error != nil {
-		return nil, fmt.Errorf("server error: %s", response.Error.Message)
-	}
-	
-	var result ListPromptsResponse
-	if err := parseResult(response.Result, &result); err != nil {
-		return nil, err
-	}
-	
-	return &result, nil
+	return &all, nil
 }
 
 // GetPrompt requests a specific prompt from the server
@@ -432,6 +603,11 @@ func (c *MCPClient) SetResourceChangeHandler(handler func([]Resource)) {
 	c.onResourceChanged = handler
 }
 
+// SetResourceUpdateHandler sets callback for updates to subscribed resources
+func (c *MCPClient) SetResourceUpdateHandler(handler func(string)) {
+	c.onResourceUpdated = handler
+}
+
 // SetToolChangeHandler sets callback for tool list changes
 func (c *MCPClient) SetToolChangeHandler(handler func([]Tool)) {
 	c.onToolChanged = handler
@@ -485,14 +661,18 @@ func (c *MCPClient) Close() error {
 	// Close transport
 	err := c.transport.Close()
 	
-	// Clear pending requests
+	// Pending requests observe the cancelled context and clean up their
+	// own channels
 	c.requestMutex.Lock()
-	for _, ch := range c.pendingRequests {
-		close(ch)
-	}
 	c.pendingRequests = make(map[interface{}]chan *Message)
 	c.requestMutex.Unlock()
 	
+	// Subscriptions do not survive the session
+	c.cacheMutex.Lock()
+	c.subscriptions = make(map[string]bool)
+	c.resourceCache = make(map[string]*ReadResourceResponse)
+	c.cacheMutex.Unlock()
+	
 	c.connected = false
 	c.initialized = false
 	
@@ -500,6 +680,24 @@ func (c *MCPClient) Close() error {
 	return err
 }
 
+// normalizeID maps JSON-decoded request IDs back to the uint64 keys used for
+// pending requests; transports decode numeric IDs as float64 or json.Number.
+func normalizeID(id interface{}) interface{} {
+	switch v := id.(type) {
+	case float64:
+		return uint64(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return uint64(n)
+		}
+	case int:
+		return uint64(v)
+	case int64:
+		return uint64(v)
+	}
+	return id
+}
+
 // parseResult parses JSON result into a struct
 func parseResult(result interface{}, target interface{}) error {
 	if result == nil {
@@ -0,0 +1,259 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer answers client requests sent over an InMemoryTransport
+type fakeServer struct {
+	transport *InMemoryTransport
+	handlers  map[string]func(params json.RawMessage) interface{}
+	requests  []string
+	mutex     sync.Mutex
+	stop      chan struct{}
+}
+
+func newFakeServer(t *testing.T, caps ServerCapabilities) (*fakeServer, *MCPClient) {
+	transport := NewInMemoryTransport()
+	require.NoError(t, transport.Connect(context.Background()))
+
+	server := &fakeServer{
+		transport: transport,
+		handlers:  make(map[string]func(json.RawMessage) interface{}),
+		stop:      make(chan struct{}),
+	}
+	server.handle("initialize", func(json.RawMessage) interface{} {
+		return InitializeResponse{ProtocolVersion: MCPVersion, Capabilities: caps, ServerInfo: ServerInfo{Name: "fake"}}
+	})
+	go server.serve()
+
+	client := NewMCPClient(MCPClientConfig{
+		Name:      "test",
+		Transport: transport,
+		Logger:    log.New(io.Discard, "", 0),
+	})
+	require.NoError(t, client.Connect(context.Background()))
+
+	t.Cleanup(func() {
+		close(server.stop)
+		client.Close()
+	})
+
+	return server, client
+}
+
+func (s *fakeServer) handle(method string, fn func(params json.RawMessage) interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers[method] = fn
+}
+
+func (s *fakeServer) count(method string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := 0
+	for _, m := range s.requests {
+		if m == method {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *fakeServer) serve() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		msg, err := s.transport.ReceiveFromOutgoing()
+		if err != nil {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if !msg.IsRequest() {
+			continue
+		}
+
+		s.mutex.Lock()
+		s.requests = append(s.requests, msg.Method)
+		fn := s.handlers[msg.Method]
+		s.mutex.Unlock()
+
+		params, _ := json.Marshal(msg.Params)
+
+		// Round-trip through JSON like a real transport, so IDs arrive as float64
+		var reply *Message
+		if fn == nil {
+			reply = CreateErrorResponse(msg.ID, MethodNotFound, "not found", nil)
+		} else {
+			reply = CreateResponse(msg.ID, fn(params))
+		}
+		data, _ := MarshalMessage(reply)
+		decoded, _ := UnmarshalMessage(data)
+		s.transport.SendToIncoming(decoded)
+	}
+}
+
+func (s *fakeServer) notify(method string, params interface{}) {
+	s.transport.SendToIncoming(CreateNotification(method, params))
+}
+
+func TestResourceSubscriptionCaching(t *testing.T) {
+	server, client := newFakeServer(t, ServerCapabilities{Resources: &ResourceCapabilities{Subscribe: true}})
+
+	server.handle("resources/read", func(json.RawMessage) interface{} {
+		return ReadResourceResponse{Contents: []ResourceContents{{URI: "file:///a", Text: "v1"}}}
+	})
+	server.handle("resources/subscribe", func(json.RawMessage) interface{} { return map[string]interface{}{} })
+
+	updated := make(chan string, 1)
+	client.SetResourceUpdateHandler(func(uri string) { updated <- uri })
+
+	ctx := context.Background()
+
+	// Unsubscribed reads always hit the server
+	_, err := client.ReadResource(ctx, "file:///a")
+	require.NoError(t, err)
+	_, err = client.ReadResource(ctx, "file:///a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.count("resources/read"))
+
+	require.NoError(t, client.SubscribeResource(ctx, "file:///a"))
+	assert.Equal(t, []string{"file:///a"}, client.Subscriptions())
+
+	resp, err := client.ReadResource(ctx, "file:///a")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", resp.Contents[0].Text)
+	_, err = client.ReadResource(ctx, "file:///a")
+	require.NoError(t, err)
+	assert.Equal(t, 3, server.count("resources/read"))
+
+	// An update notification invalidates the cached contents
+	server.handle("resources/read", func(json.RawMessage) interface{} {
+		return ReadResourceResponse{Contents: []ResourceContents{{URI: "file:///a", Text: "v2"}}}
+	})
+	server.notify("notifications/resources/updated", ResourceUpdatedNotification{URI: "file:///a"})
+
+	select {
+	case uri := <-updated:
+		assert.Equal(t, "file:///a", uri)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no update notification")
+	}
+
+	resp, err = client.ReadResource(ctx, "file:///a")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", resp.Contents[0].Text)
+}
+
+func TestSubscribeRequiresCapability(t *testing.T) {
+	_, client := newFakeServer(t, ServerCapabilities{Resources: &ResourceCapabilities{}})
+	assert.Error(t, client.SubscribeResource(context.Background(), "file:///a"))
+}
+
+func TestListChangedRefetchesWithoutBlocking(t *testing.T) {
+	server, client := newFakeServer(t, ServerCapabilities{Tools: &ToolCapabilities{ListChanged: true}})
+	server.handle("tools/list", func(json.RawMessage) interface{} {
+		return ListToolsResponse{Tools: []Tool{{Name: "echo"}}}
+	})
+
+	changed := make(chan []Tool, 1)
+	client.SetToolChangeHandler(func(tools []Tool) { changed <- tools })
+	server.notify("notifications/tools/list_changed", nil)
+
+	select {
+	case tools := <-changed:
+		require.Len(t, tools, 1)
+		assert.Equal(t, "echo", tools[0].Name)
+	case <-time.After(2 * time.Second):
+		t.Fatal("tool list was not refetched")
+	}
+}
+
+func TestEventHubFanOut(t *testing.T) {
+	hub := NewEventHub()
+
+	a, cancelA := hub.Subscribe(1)
+	b, cancelB := hub.Subscribe(1)
+	assert.Equal(t, 2, hub.Listeners())
+
+	hub.Publish(ChangeEvent{Type: EventToolsChanged, Server: "s"})
+	// Full listeners drop events instead of blocking
+	hub.Publish(ChangeEvent{Type: EventPromptsChanged, Server: "s"})
+
+	assert.Equal(t, EventToolsChanged, (<-a).Type)
+	assert.Equal(t, EventToolsChanged, (<-b).Type)
+
+	cancelA()
+	cancelA()
+	assert.Equal(t, 1, hub.Listeners())
+	cancelB()
+
+	_, open := <-a
+	assert.False(t, open)
+}
+
+func TestListFollowsCursors(t *testing.T) {
+	server, client := newFakeServer(t, ServerCapabilities{Tools: &ToolCapabilities{}})
+	server.handle("tools/list", func(params json.RawMessage) interface{} {
+		var req ListRequest
+		json.Unmarshal(params, &req)
+		switch req.Cursor {
+		case "":
+			return ListToolsResponse{Tools: []Tool{{Name: "a"}}, NextCursor: "p2"}
+		case "p2":
+			return ListToolsResponse{Tools: []Tool{{Name: "b"}}, NextCursor: "p3"}
+		default:
+			return ListToolsResponse{Tools: []Tool{{Name: "c"}}}
+		}
+	})
+
+	resp, err := client.ListTools(context.Background())
+	require.NoError(t, err)
+	require.Len(t, resp.Tools, 3)
+	assert.Equal(t, "c", resp.Tools[2].Name)
+	assert.Empty(t, resp.NextCursor)
+	assert.Equal(t, 3, server.count("tools/list"))
+
+	// A server that repeats its cursor is cut off rather than looped on
+	server.handle("prompts/list", func(json.RawMessage) interface{} {
+		return ListPromptsResponse{Prompts: []Prompt{{Name: "p"}}, NextCursor: "same"}
+	})
+	_, err = client.ListPrompts(context.Background())
+	assert.Error(t, err)
+}
+
+func TestGetPromptAcceptsSingleContent(t *testing.T) {
+	server, client := newFakeServer(t, ServerCapabilities{Prompts: &PromptCapabilities{}})
+	server.handle("prompts/get", func(params json.RawMessage) interface{} {
+		var req GetPromptRequest
+		json.Unmarshal(params, &req)
+		return map[string]interface{}{
+			"messages": []interface{}{
+				map[string]interface{}{
+					"role":    "user",
+					"content": map[string]interface{}{"type": "text", "text": "review " + req.Arguments["file"].(string)},
+				},
+			},
+		}
+	})
+
+	resp, err := client.GetPrompt(context.Background(), "review", map[string]interface{}{"file": "main.go"})
+	require.NoError(t, err)
+	require.Len(t, resp.Messages, 1)
+	assert.Equal(t, MessageRoleUser, resp.Messages[0].Role)
+	require.Len(t, resp.Messages[0].Content, 1)
+	assert.Equal(t, "review main.go", resp.Messages[0].Content[0].Text)
+}
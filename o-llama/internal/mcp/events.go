@@ -0,0 +1,94 @@
+// Package mcp provides change event fan-out for MCP servers
+package mcp
+
+import (
+	"sync"
+	"time"
+)
+
+// Change event types published by the manager
+const (
+	EventResourcesChanged   = "resources_changed"
+	EventResourceUpdated    = "resource_updated"
+	EventToolsChanged       = "tools_changed"
+	EventPromptsChanged     = "prompts_changed"
+	EventServerConnected    = "server_connected"
+	EventServerDisconnected = "server_disconnected"
+	EventServerExited       = "server_exited"
+	EventServerCrashLoop    = "server_crash_loop"
+)
+
+// ChangeEvent describes a change reported by an MCP server
+type ChangeEvent struct {
+	Type      string     `json:"type"`
+	Server    string     `json:"server"`
+	URI       string     `json:"uri,omitempty"`
+	Resources []Resource `json:"resources,omitempty"`
+	Tools     []Tool     `json:"tools,omitempty"`
+	Prompts   []Prompt   `json:"prompts,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// EventHub fans change events out to any number of listeners. Slow listeners
+// drop events rather than blocking the MCP message loop.
+type EventHub struct {
+	listeners map[chan ChangeEvent]struct{}
+	mutex     sync.RWMutex
+}
+
+// NewEventHub creates a new event hub
+func NewEventHub() *EventHub {
+	return &EventHub{
+		listeners: make(map[chan ChangeEvent]struct{}),
+	}
+}
+
+// Subscribe registers a listener and returns its channel and a cancel function
+func (h *EventHub) Subscribe(buffer int) (<-chan ChangeEvent, func()) {
+	if buffer <= 0 {
+		buffer = 16
+	}
+
+	ch := make(chan ChangeEvent, buffer)
+
+	h.mutex.Lock()
+	h.listeners[ch] = struct{}{}
+	h.mutex.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mutex.Lock()
+			delete(h.listeners, ch)
+			close(ch)
+			h.mutex.Unlock()
+		})
+	}
+
+	return ch, cancel
+}
+
+// Publish delivers an event to every listener without blocking
+func (h *EventHub) Publish(event ChangeEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for ch := range h.listeners {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Listeners returns the number of registered listeners
+func (h *EventHub) Listeners() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.listeners)
+}
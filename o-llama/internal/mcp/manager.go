@@ -27,6 +27,15 @@ type MCPManager struct {
 	onServerDisconnect func(string, error)
 	onResourceChange   func(string, []Resource)
 	onToolChange       func(string, []Tool)
+	
+	// Change fan-out and reference-counted resource subscriptions
+	events        *EventHub
+	subscriptions map[string]map[string]int
+	subMutex      sync.Mutex
+	
+	// Stdio process supervision: logs, restarts and crash-loop state
+	processes map[string]*supervisedServer
+	procMutex sync.Mutex
 }
 
 // MCPServerConfig holds configuration for an MCP server
@@ -40,6 +49,14 @@ type MCPServerConfig struct {
 	RetryCount   int                    `json:"retry_count" yaml:"retry_count"`
 	RetryDelay   time.Duration          `json:"retry_delay" yaml:"retry_delay"`
 	Environment  map[string]string      `json:"environment" yaml:"environment"`
+	
+	// Stdio process supervision
+	WorkingDir    string        `json:"working_dir,omitempty" yaml:"working_dir"`
+	RestartPolicy string        `json:"restart_policy,omitempty" yaml:"restart_policy"` // never, on-failure, always
+	MaxRestarts   int           `json:"max_restarts,omitempty" yaml:"max_restarts"`     // within RestartWindow before crash-loop suspension
+	RestartWindow time.Duration `json:"restart_window,omitempty" yaml:"restart_window"`
+	StopTimeout   time.Duration `json:"stop_timeout,omitempty" yaml:"stop_timeout"` // per stage of stdin close, SIGTERM, SIGKILL
+	LogLines      int           `json:"log_lines,omitempty" yaml:"log_lines"`
 }
 
 // MCPManagerConfig holds configuration for the MCP manager
@@ -63,6 +80,7 @@ type ServerStatus struct {
 	Resources    []Resource          `json:"resources,omitempty"`
 	Tools        []Tool              `json:"tools,omitempty"`
 	Prompts      []Prompt            `json:"prompts,omitempty"`
+	Process      *ProcessStatus      `json:"process,omitempty"`
 }
 
 // NewMCPManager creates a new MCP manager
@@ -75,6 +93,10 @@ func NewMCPManager(config MCPManagerConfig) *MCPManager {
 		config.HealthCheck = 30 * time.Second
 	}
 	
+	if config.Servers == nil {
+		config.Servers = make(map[string]*MCPServerConfig)
+	}
+	
 	if config.ClientName == "" {
 		config.ClientName = "o-llama"
 	}
@@ -88,8 +110,11 @@ func NewMCPManager(config MCPManagerConfig) *MCPManager {
 		configs:     config.Servers,
 		factory:     &TransportFactory{},
 		logger:      config.Logger,
-		healthCheck: config.HealthCheck,
-		healthStop:  make(chan struct{}),
+		healthCheck:   config.HealthCheck,
+		healthStop:    make(chan struct{}),
+		events:        NewEventHub(),
+		subscriptions: make(map[string]map[string]int),
+		processes:     make(map[string]*supervisedServer),
 	}
 }
 
@@ -112,34 +137,62 @@ func (m *MCPManager) Start(ctx context.Context) error {
 	return nil
 }
 
-// ConnectServer establishes connection to a specific MCP server
+// ConnectServer establishes connection to a specific MCP server. A manual
+// connect also clears crash-loop suspension.
 func (m *MCPManager) ConnectServer(ctx context.Context, serverName string) error {
+	m.resetSupervision(serverName)
+	return m.connectServer(ctx, serverName)
+}
+
+// connectServer establishes the connection without touching supervision state
+func (m *MCPManager) connectServer(ctx context.Context, serverName string) error {
+	client, err := m.startClient(ctx, serverName)
+	if err != nil {
+		return err
+	}
+	
+	// Restore subscriptions held before a reconnect. Each is a round trip to
+	// the server, so the manager lock is released first.
+	m.resubscribe(ctx, serverName, client)
+	
+	// Trigger connection callback
+	if m.onServerConnect != nil {
+		m.onServerConnect(serverName, client.GetServerInfo())
+	}
+	m.events.Publish(ChangeEvent{Type: EventServerConnected, Server: serverName})
+	
+	return nil
+}
+
+// startClient connects the transport and client of a server and stores the
+// client
+func (m *MCPManager) startClient(ctx context.Context, serverName string) (*MCPClient, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	
 	config, exists := m.configs[serverName]
 	if !exists {
-		return fmt.Errorf("server %s not configured", serverName)
+		return nil, fmt.Errorf("server %s not configured", serverName)
 	}
 	
 	if !config.Enabled {
-		return fmt.Errorf("server %s is disabled", serverName)
+		return nil, fmt.Errorf("server %s is disabled", serverName)
 	}
 	
 	// Check if already connected
 	if client, exists := m.clients[serverName]; exists && client.IsConnected() {
-		return fmt.Errorf("server %s already connected", serverName)
+		return nil, fmt.Errorf("server %s already connected", serverName)
 	}
 	
 	// Create transport
-	transport, err := m.factory.CreateTransport(config.Transport)
+	transport, err := m.createTransport(serverName, config)
 	if err != nil {
-		return fmt.Errorf("failed to create transport for %s: %w", serverName, err)
+		return nil, fmt.Errorf("failed to create transport for %s: %w", serverName, err)
 	}
 	
 	// Connect transport
 	if err := transport.Connect(ctx); err != nil {
-		return fmt.Errorf("failed to connect transport for %s: %w", serverName, err)
+		return nil, fmt.Errorf("failed to connect transport for %s: %w", serverName, err)
 	}
 	
 	// Create and configure client
@@ -159,31 +212,37 @@ func (m *MCPManager) ConnectServer(ctx context.Context, serverName string) error
 		if m.onResourceChange != nil {
 			m.onResourceChange(serverName, resources)
 		}
+		m.events.Publish(ChangeEvent{Type: EventResourcesChanged, Server: serverName, Resources: resources})
+	})
+	
+	client.SetResourceUpdateHandler(func(uri string) {
+		m.events.Publish(ChangeEvent{Type: EventResourceUpdated, Server: serverName, URI: uri})
 	})
 	
 	client.SetToolChangeHandler(func(tools []Tool) {
 		if m.onToolChange != nil {
 			m.onToolChange(serverName, tools)
 		}
+		m.events.Publish(ChangeEvent{Type: EventToolsChanged, Server: serverName, Tools: tools})
+	})
+	
+	client.SetPromptChangeHandler(func(prompts []Prompt) {
+		m.events.Publish(ChangeEvent{Type: EventPromptsChanged, Server: serverName, Prompts: prompts})
 	})
 	
 	// Connect client
 	if err := client.Connect(ctx); err != nil {
 		transport.Close()
-		return fmt.Errorf("failed to connect MCP client for %s: %w", serverName, err)
+		return nil, fmt.Errorf("failed to connect MCP client for %s: %w", serverName, err)
 	}
 	
 	// Store client
 	m.clients[serverName] = client
+	m.processStarted(serverName, transport)
 	
 	m.logger.Printf("Successfully connected to MCP server: %s", serverName)
 	
-	// Trigger connection callback
-	if m.onServerConnect != nil {
-		m.onServerConnect(serverName, client.GetServerInfo())
-	}
-	
-	return nil
+	return client, nil
 }
 
 // DisconnectServer disconnects from a specific MCP server
@@ -205,6 +264,7 @@ func (m *MCPManager) DisconnectServer(serverName string) error {
 	if m.onServerDisconnect != nil {
 		m.onServerDisconnect(serverName, err)
 	}
+	m.events.Publish(ChangeEvent{Type: EventServerDisconnected, Server: serverName})
 	
 	return err
 }
@@ -278,6 +338,49 @@ func (m *MCPManager) ListTools(ctx context.Context) (map[string][]Tool, error) {
 	return tools, nil
 }
 
+// ListPrompts returns all prompts from all connected servers
+func (m *MCPManager) ListPrompts(ctx context.Context) (map[string][]Prompt, error) {
+	m.mutex.RLock()
+	clients := make(map[string]*MCPClient)
+	for name, client := range m.clients {
+		if client.IsReady() {
+			clients[name] = client
+		}
+	}
+	m.mutex.RUnlock()
+	
+	prompts := make(map[string][]Prompt)
+	
+	for serverName, client := range clients {
+		// Servers without the prompts capability would only answer with an error
+		if caps := client.GetServerCapabilities(); caps == nil || caps.Prompts == nil {
+			continue
+		}
+		
+		response, err := client.ListPrompts(ctx)
+		if err != nil {
+			m.logger.Printf("Failed to list prompts from %s: %v", serverName, err)
+			continue
+		}
+		
+		prompts[serverName] = response.Prompts
+	}
+	
+	return prompts, nil
+}
+
+// GetPrompt renders a prompt on a specific server
+func (m *MCPManager) GetPrompt(ctx context.Context, serverName, promptName string, arguments map[string]interface{}) (*GetPromptResponse, error) {
+	client, err := m.GetClient(serverName)
+	if err != nil {
+		return nil, err
+	}
+	
+	defer observeCall(serverName, "prompts/get", time.Now(), &err)
+	response, err := client.GetPrompt(ctx, promptName, arguments)
+	return response, err
+}
+
 // CallTool calls a tool on a specific server
 func (m *MCPManager) CallTool(ctx context.Context, serverName, toolName string, arguments interface{}) (*CallToolResponse, error) {
 	client, err := m.GetClient(serverName)
@@ -285,7 +388,9 @@ func (m *MCPManager) CallTool(ctx context.Context, serverName, toolName string,
 		return nil, err
 	}
 	
-	return client.CallTool(ctx, toolName, arguments)
+	defer observeCall(serverName, "tools/call", time.Now(), &err)
+	response, err := client.CallTool(ctx, toolName, arguments)
+	return response, err
 }
 
 // ReadResource reads a resource from a specific server
@@ -295,7 +400,81 @@ func (m *MCPManager) ReadResource(ctx context.Context, serverName, uri string) (
 		return nil, err
 	}
 	
-	return client.ReadResource(ctx, uri)
+	defer observeCall(serverName, "resources/read", time.Now(), &err)
+	response, err := client.ReadResource(ctx, uri)
+	return response, err
+}
+
+// SubscribeResource subscribes to updates for a resource on a server. Calls
+// are reference counted so several listeners can share one subscription.
+func (m *MCPManager) SubscribeResource(ctx context.Context, serverName, uri string) error {
+	client, err := m.GetClient(serverName)
+	if err != nil {
+		return err
+	}
+	
+	m.subMutex.Lock()
+	defer m.subMutex.Unlock()
+	
+	uris := m.subscriptions[serverName]
+	if uris == nil {
+		uris = make(map[string]int)
+		m.subscriptions[serverName] = uris
+	}
+	
+	if uris[uri] == 0 {
+		if err := client.SubscribeResource(ctx, uri); err != nil {
+			return err
+		}
+	}
+	uris[uri]++
+	
+	return nil
+}
+
+// UnsubscribeResource releases a subscription taken with SubscribeResource
+func (m *MCPManager) UnsubscribeResource(ctx context.Context, serverName, uri string) error {
+	// Resolve the client before taking subMutex; ConnectServer acquires the
+	// manager mutex first and subMutex second.
+	client, clientErr := m.GetClient(serverName)
+	
+	m.subMutex.Lock()
+	defer m.subMutex.Unlock()
+	
+	uris := m.subscriptions[serverName]
+	if uris[uri] == 0 {
+		return fmt.Errorf("not subscribed to %s on %s", uri, serverName)
+	}
+	
+	uris[uri]--
+	if uris[uri] > 0 {
+		return nil
+	}
+	delete(uris, uri)
+	
+	if clientErr != nil {
+		// Server is gone; nothing left to unsubscribe from
+		return nil
+	}
+	
+	return client.UnsubscribeResource(ctx, uri)
+}
+
+// resubscribe restores subscriptions for a freshly connected client
+func (m *MCPManager) resubscribe(ctx context.Context, serverName string, client *MCPClient) {
+	m.subMutex.Lock()
+	defer m.subMutex.Unlock()
+	
+	for uri := range m.subscriptions[serverName] {
+		if err := client.SubscribeResource(ctx, uri); err != nil {
+			m.logger.Printf("Failed to restore subscription %s on %s: %v", uri, serverName, err)
+		}
+	}
+}
+
+// Events returns the hub that publishes resource, tool and prompt changes
+func (m *MCPManager) Events() *EventHub {
+	return m.events
 }
 
 // GetServerStatus returns status information for all servers
@@ -334,6 +513,11 @@ func (m *MCPManager) GetServerStatus() map[string]*ServerStatus {
 			}
 		}
 		
+		if process, ok := m.ProcessStatus(serverName); ok {
+			serverStatus.Process = process
+			serverStatus.LastError = process.LastExit
+		}
+		
 		status[serverName] = serverStatus
 	}
 	
@@ -390,9 +574,12 @@ func (m *MCPManager) performHealthCheck() {
 			m.logger.Printf("Health check: server %s disconnected", serverName)
 			
 			// Attempt to reconnect if auto-start is enabled
-			if serverConfig, exists := m.configs[serverName]; exists && serverConfig.AutoStart {
+			m.mutex.RLock()
+			serverConfig, exists := m.configs[serverName]
+			m.mutex.RUnlock()
+			if exists && serverConfig.AutoStart && !m.isCrashLooping(serverName) {
 				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-				if err := m.ConnectServer(ctx, serverName); err != nil {
+				if err := m.connectServer(ctx, serverName); err != nil {
 					m.logger.Printf("Failed to reconnect to %s: %v", serverName, err)
 				}
 				cancel()
@@ -406,16 +593,21 @@ func (m *MCPManager) Stop() error {
 	m.logger.Printf("Stopping MCP manager")
 	
 	// Stop health monitoring
+	// Closing healthStop also cancels pending restarts
 	if m.healthTicker != nil {
 		m.healthTicker.Stop()
-		close(m.healthStop)
 	}
+	close(m.healthStop)
 	
-	// Disconnect all servers
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	
+	// Disconnect all servers; DisconnectServer takes the lock itself
+	m.mutex.RLock()
+	serverNames := make([]string, 0, len(m.clients))
 	for serverName := range m.clients {
+		serverNames = append(serverNames, serverName)
+	}
+	m.mutex.RUnlock()
+	
+	for _, serverName := range serverNames {
 		if err := m.DisconnectServer(serverName); err != nil {
 			m.logger.Printf("Error disconnecting from %s: %v", serverName, err)
 		}
@@ -436,16 +628,22 @@ func (m *MCPManager) AddServer(name string, config *MCPServerConfig) {
 // RemoveServer removes a server configuration and disconnects if connected
 func (m *MCPManager) RemoveServer(name string) error {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	
-	// Disconnect if connected
-	if client, exists := m.clients[name]; exists {
-		client.Close()
-		delete(m.clients, name)
-	}
+	client, connected := m.clients[name]
+	delete(m.clients, name)
 	
 	// Remove configuration
 	delete(m.configs, name)
+	m.mutex.Unlock()
+	
+	m.procMutex.Lock()
+	delete(m.processes, name)
+	m.procMutex.Unlock()
+	
+	// Stopping the process can take several stop timeouts, so other calls
+	// aren't kept waiting for it
+	if connected {
+		client.Close()
+	}
 	
 	m.logger.Printf("Removed MCP server: %s", name)
 	return nil
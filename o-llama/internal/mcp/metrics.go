@@ -0,0 +1,21 @@
+package mcp
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"inspector-gadget-os/o-llama/internal/metrics"
+)
+
+var callDuration = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{Name: "inspector_gadget_mcp_call_duration_seconds", Help: "Latency of MCP server requests by method and outcome.", Buckets: prometheus.DefBuckets}, []string{"server", "method", "status"})
+
+// observeCall records the latency of a request to an MCP server; deferred
+// with a pointer to the caller's error
+func observeCall(server, method string, start time.Time, err *error) {
+	status := "ok"
+	if *err != nil {
+		status = "error"
+	}
+	callDuration.WithLabelValues(server, method, status).Observe(time.Since(start).Seconds())
+}
@@ -2,6 +2,7 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,9 @@ import (
 // MCPVersion represents the MCP protocol version
 const MCPVersion = "2024-11-05"
 
+// MaxListPages bounds how many pages a single list call will follow
+const MaxListPages = 100
+
 // Transport defines the interface for MCP communication mechanisms
 type Transport interface {
 	Connect(ctx context.Context) error
@@ -147,9 +151,34 @@ const (
 
 // Tool represents a function that can be called by the model
 type Tool struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description,omitempty"`
-	InputSchema Schema      `json:"inputSchema"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	InputSchema Schema           `json:"inputSchema"`
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are optional behavioural hints a server may attach to a tool
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+	IdempotentHint  *bool  `json:"idempotentHint,omitempty"`
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`
+}
+
+// IsDestructive reports whether a tool may modify its environment.
+// Tools without hints are treated as destructive.
+func (t Tool) IsDestructive() bool {
+	if t.Annotations == nil {
+		return true
+	}
+	if t.Annotations.ReadOnlyHint != nil && *t.Annotations.ReadOnlyHint {
+		return false
+	}
+	if t.Annotations.DestructiveHint != nil {
+		return *t.Annotations.DestructiveHint
+	}
+	return true
 }
 
 // Schema represents a JSON schema for tool parameters
@@ -222,6 +251,37 @@ type PromptMessage struct {
 	Content []ContentItem `json:"content"`
 }
 
+// UnmarshalJSON accepts content as a single item, as sent by servers following
+// the MCP specification, or as a list
+func (m *PromptMessage) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Role    MessageRole     `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	
+	m.Role = raw.Role
+	m.Content = nil
+	
+	trimmed := bytes.TrimSpace(raw.Content)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	
+	if trimmed[0] == '[' {
+		return json.Unmarshal(trimmed, &m.Content)
+	}
+	
+	var item ContentItem
+	if err := json.Unmarshal(trimmed, &item); err != nil {
+		return err
+	}
+	m.Content = []ContentItem{item}
+	return nil
+}
+
 // MessageRole defines the role in a conversation
 type MessageRole string
 
@@ -231,6 +291,11 @@ const (
 	MessageRoleSystem    MessageRole = "system"
 )
 
+// ListRequest carries the pagination cursor for list methods
+type ListRequest struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
 // ListResourcesResponse contains available resources
 type ListResourcesResponse struct {
 	Resources []Resource `json:"resources"`
@@ -259,6 +324,16 @@ type ReadResourceResponse struct {
 	Contents []ResourceContents `json:"contents"`
 }
 
+// SubscribeRequest subscribes to or unsubscribes from resource updates
+type SubscribeRequest struct {
+	URI string `json:"uri"`
+}
+
+// ResourceUpdatedNotification is sent by the server when a subscribed resource changes
+type ResourceUpdatedNotification struct {
+	URI string `json:"uri"`
+}
+
 // MCPError represents MCP-specific errors
 type MCPError struct {
 	Code    int
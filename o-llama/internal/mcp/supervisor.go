@@ -0,0 +1,376 @@
+// Package mcp provides process supervision for stdio MCP servers
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"inspector-gadget-os/o-llama/internal/logging"
+)
+
+// Restart policies for stdio servers
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// Supervision defaults applied when the server configuration leaves them unset
+const (
+	DefaultLogLines       = 200
+	DefaultMaxRestarts    = 5
+	DefaultRestartWindow  = time.Minute
+	DefaultRestartDelay   = time.Second
+	MaxRestartDelay       = 30 * time.Second
+	restartConnectTimeout = 30 * time.Second
+)
+
+// LogLine is a single captured line of server output
+type LogLine struct {
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+}
+
+// LogBuffer keeps the most recent lines written by a server
+type LogBuffer struct {
+	lines []LogLine
+	next  int
+	full  bool
+	mutex sync.RWMutex
+}
+
+// NewLogBuffer creates a ring buffer holding up to size lines
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = DefaultLogLines
+	}
+	return &LogBuffer{lines: make([]LogLine, size)}
+}
+
+// Append records a line, evicting the oldest when full
+func (b *LogBuffer) Append(line string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.lines[b.next] = LogLine{Time: time.Now(), Line: line}
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Lines returns up to limit of the most recent lines, oldest first. A
+// non-positive limit returns everything buffered.
+func (b *LogBuffer) Lines(limit int) []LogLine {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var out []LogLine
+	if b.full {
+		out = append(out, b.lines[b.next:]...)
+	}
+	out = append(out, b.lines[:b.next]...)
+
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// ProcessStatus reports supervision state for a stdio server
+type ProcessStatus struct {
+	PID          int       `json:"pid,omitempty"`
+	StartedAt    time.Time `json:"started_at,omitempty"`
+	Restarts     int       `json:"restarts"`
+	CrashLooping bool      `json:"crash_looping"`
+	LastExit     string    `json:"last_exit,omitempty"`
+	LastExitAt   time.Time `json:"last_exit_at,omitempty"`
+}
+
+// supervisedServer holds per-server supervision state that survives restarts
+type supervisedServer struct {
+	logs     *LogBuffer
+	status   ProcessStatus
+	failures []time.Time
+	pending  bool
+}
+
+// restartPolicy resolves the configured policy. Servers without an explicit
+// policy keep the auto-start behaviour of being reconnected after failures.
+func restartPolicy(config *MCPServerConfig) string {
+	switch config.RestartPolicy {
+	case RestartNever, RestartOnFailure, RestartAlways:
+		return config.RestartPolicy
+	}
+	if config.AutoStart {
+		return RestartOnFailure
+	}
+	return RestartNever
+}
+
+// supervised returns the supervision state for a server, creating it on first use
+func (m *MCPManager) supervised(serverName string, config *MCPServerConfig) *supervisedServer {
+	m.procMutex.Lock()
+	defer m.procMutex.Unlock()
+
+	server, ok := m.processes[serverName]
+	if !ok {
+		server = &supervisedServer{logs: NewLogBuffer(config.LogLines)}
+		m.processes[serverName] = server
+	}
+	return server
+}
+
+// createTransport builds the transport for a server, wiring stdio processes
+// into supervision
+func (m *MCPManager) createTransport(serverName string, config *MCPServerConfig) (Transport, error) {
+	if transportType, _ := config.Transport["type"].(string); transportType != "stdio" {
+		return m.factory.CreateTransport(config.Transport)
+	}
+
+	stdio, err := m.factory.StdioConfig(config.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	stdio.Env = config.Environment
+	if config.WorkingDir != "" {
+		stdio.Dir = config.WorkingDir
+	}
+	stdio.StopTimeout = config.StopTimeout
+
+	logs := m.supervised(serverName, config).logs
+	stdio.Stderr = func(line string) {
+		logs.Append(line)
+		logging.L().Infow("mcp.server.stderr", "server", serverName, "line", line)
+	}
+
+	var transport *StdioTransport
+	stdio.OnExit = func(err error) {
+		// The waiter goroutine must not block on manager locks
+		go m.handleProcessExit(serverName, transport, err)
+	}
+	transport = NewStdioTransportWithConfig(stdio)
+
+	return transport, nil
+}
+
+// processStarted records a successfully connected stdio process
+func (m *MCPManager) processStarted(serverName string, transport Transport) {
+	stdio, ok := transport.(*StdioTransport)
+	if !ok {
+		return
+	}
+
+	m.procMutex.Lock()
+	defer m.procMutex.Unlock()
+
+	if server, ok := m.processes[serverName]; ok {
+		server.status.PID = stdio.PID()
+		server.status.StartedAt = stdio.StartedAt()
+	}
+}
+
+// handleProcessExit tears down the session of a server whose process died and
+// schedules a restart according to its policy
+func (m *MCPManager) handleProcessExit(serverName string, transport Transport, exitErr error) {
+	m.mutex.Lock()
+	client, ok := m.clients[serverName]
+	if !ok || client.transport != transport {
+		// Disconnected on purpose or already replaced
+		m.mutex.Unlock()
+		return
+	}
+	delete(m.clients, serverName)
+	config := m.configs[serverName]
+	m.mutex.Unlock()
+
+	client.Close()
+
+	reason := "exited"
+	if exitErr != nil {
+		reason = exitErr.Error()
+	}
+	logging.L().Warnw("mcp.server.exit", "server", serverName, "reason", reason)
+	m.logger.Printf("MCP server %s exited: %s", serverName, reason)
+
+	m.events.Publish(ChangeEvent{Type: EventServerExited, Server: serverName, Error: reason})
+	if m.onServerDisconnect != nil {
+		m.onServerDisconnect(serverName, fmt.Errorf("process exited: %s", reason))
+	}
+
+	if config == nil {
+		return
+	}
+
+	if delay, restart := m.recordExit(serverName, config, exitErr, time.Now()); restart {
+		go m.restartAfter(serverName, delay)
+	}
+}
+
+// recordExit updates supervision state for an exit or failed start and
+// decides whether and when to restart
+func (m *MCPManager) recordExit(serverName string, config *MCPServerConfig, exitErr error, now time.Time) (time.Duration, bool) {
+	server := m.supervised(serverName, config)
+
+	m.procMutex.Lock()
+	defer m.procMutex.Unlock()
+
+	server.status.PID = 0
+	server.status.LastExitAt = now
+	server.status.LastExit = "exited"
+	if exitErr != nil {
+		server.status.LastExit = exitErr.Error()
+	}
+
+	switch restartPolicy(config) {
+	case RestartNever:
+		return 0, false
+	case RestartOnFailure:
+		if exitErr == nil {
+			return 0, false
+		}
+	}
+
+	if server.status.CrashLooping || server.pending {
+		return 0, false
+	}
+
+	maxRestarts := config.MaxRestarts
+	if maxRestarts <= 0 {
+		maxRestarts = DefaultMaxRestarts
+	}
+	window := config.RestartWindow
+	if window <= 0 {
+		window = DefaultRestartWindow
+	}
+
+	// Keep only failures inside the crash-loop window
+	recent := server.failures[:0]
+	for _, at := range server.failures {
+		if now.Sub(at) < window {
+			recent = append(recent, at)
+		}
+	}
+	server.failures = append(recent, now)
+
+	if len(server.failures) > maxRestarts {
+		server.status.CrashLooping = true
+		logging.L().Errorw("mcp.server.crash_loop", "server", serverName, "failures", len(server.failures), "window", window.String())
+		m.logger.Printf("MCP server %s is crash looping; restarts suspended", serverName)
+		m.events.Publish(ChangeEvent{Type: EventServerCrashLoop, Server: serverName, Error: server.status.LastExit})
+		return 0, false
+	}
+
+	// Exponential backoff over the failures in the window
+	delay := config.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRestartDelay
+	}
+	for i := 1; i < len(server.failures) && delay < MaxRestartDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxRestartDelay {
+		delay = MaxRestartDelay
+	}
+
+	server.pending = true
+	return delay, true
+}
+
+// restartAfter reconnects a server after delay unless the manager stops or
+// the server was reconnected or removed in the meantime
+func (m *MCPManager) restartAfter(serverName string, delay time.Duration) {
+	select {
+	case <-time.After(delay):
+	case <-m.healthStop:
+		return
+	}
+
+	m.mutex.RLock()
+	config, configured := m.configs[serverName]
+	_, connected := m.clients[serverName]
+	m.mutex.RUnlock()
+
+	m.procMutex.Lock()
+	server := m.processes[serverName]
+	if server == nil || !configured {
+		// removed while waiting to restart
+		m.procMutex.Unlock()
+		return
+	}
+	server.pending = false
+	if !config.Enabled || connected {
+		m.procMutex.Unlock()
+		return
+	}
+	server.status.Restarts++
+	restarts := server.status.Restarts
+	m.procMutex.Unlock()
+
+	logging.L().Infow("mcp.server.restart", "server", serverName, "restarts", restarts, "delay", delay.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), restartConnectTimeout)
+	defer cancel()
+
+	if err := m.connectServer(ctx, serverName); err != nil {
+		logging.L().Warnw("mcp.server.restart.error", "server", serverName, "error", err.Error())
+		if delay, restart := m.recordExit(serverName, config, err, time.Now()); restart {
+			go m.restartAfter(serverName, delay)
+		}
+	}
+}
+
+// resetSupervision clears crash-loop state so a manual connect starts fresh
+func (m *MCPManager) resetSupervision(serverName string) {
+	m.procMutex.Lock()
+	defer m.procMutex.Unlock()
+
+	if server, ok := m.processes[serverName]; ok {
+		server.failures = nil
+		server.status.CrashLooping = false
+	}
+}
+
+// isCrashLooping reports whether restarts of a server are suspended
+func (m *MCPManager) isCrashLooping(serverName string) bool {
+	m.procMutex.Lock()
+	defer m.procMutex.Unlock()
+
+	server, ok := m.processes[serverName]
+	return ok && server.status.CrashLooping
+}
+
+// ProcessStatus returns supervision state for a stdio server
+func (m *MCPManager) ProcessStatus(serverName string) (*ProcessStatus, bool) {
+	m.procMutex.Lock()
+	defer m.procMutex.Unlock()
+
+	server, ok := m.processes[serverName]
+	if !ok {
+		return nil, false
+	}
+	status := server.status
+	return &status, true
+}
+
+// ServerLogs returns up to limit recent stderr lines of a stdio server
+func (m *MCPManager) ServerLogs(serverName string, limit int) ([]LogLine, error) {
+	m.procMutex.Lock()
+	server, ok := m.processes[serverName]
+	m.procMutex.Unlock()
+
+	if !ok {
+		m.mutex.RLock()
+		_, configured := m.configs[serverName]
+		m.mutex.RUnlock()
+		if !configured {
+			return nil, fmt.Errorf("server %s not configured", serverName)
+		}
+		return []LogLine{}, nil
+	}
+
+	return server.logs.Lines(limit), nil
+}
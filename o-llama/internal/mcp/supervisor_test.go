@@ -0,0 +1,267 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperMCPServer is not a real test: when MCP_HELPER is set the test
+// binary acts as a minimal stdio MCP server for the supervisor tests
+func TestHelperMCPServer(t *testing.T) {
+	mode := os.Getenv("MCP_HELPER")
+	if mode == "" {
+		return
+	}
+
+	wd, _ := os.Getwd()
+	fmt.Fprintf(os.Stderr, "helper started dir=%s value=%s\n", wd, os.Getenv("HELPER_VALUE"))
+
+	if mode == "stubborn" {
+		signal.Ignore(syscall.SIGTERM)
+		select {}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+
+		switch msg.Method {
+		case "initialize":
+			data, _ := json.Marshal(CreateResponse(msg.ID, InitializeResponse{
+				ProtocolVersion: MCPVersion,
+				ServerInfo:      ServerInfo{Name: "helper"},
+			}))
+			os.Stdout.Write(append(data, '\n'))
+		case "notifications/initialized":
+			if mode == "crash" {
+				time.Sleep(50 * time.Millisecond)
+				fmt.Fprintln(os.Stderr, "helper crashing")
+				os.Exit(3)
+			}
+		}
+	}
+	os.Exit(0)
+}
+
+func helperStdio(mode string) StdioConfig {
+	return StdioConfig{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestHelperMCPServer$"},
+		Env:     map[string]string{"MCP_HELPER": mode},
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestLogBufferKeepsMostRecentLines(t *testing.T) {
+	buf := NewLogBuffer(3)
+	assert.Empty(t, buf.Lines(0))
+
+	for i := 1; i <= 5; i++ {
+		buf.Append(fmt.Sprintf("line %d", i))
+	}
+
+	var got []string
+	for _, line := range buf.Lines(0) {
+		got = append(got, line.Line)
+	}
+	assert.Equal(t, []string{"line 3", "line 4", "line 5"}, got)
+
+	recent := buf.Lines(1)
+	require.Len(t, recent, 1)
+	assert.Equal(t, "line 5", recent[0].Line)
+}
+
+func TestStdioTransportEnvDirAndStderr(t *testing.T) {
+	dir := t.TempDir()
+	lines := make(chan string, 8)
+
+	config := helperStdio("serve")
+	config.Env["HELPER_VALUE"] = "from-config"
+	config.Dir = dir
+	config.Stderr = func(line string) { lines <- line }
+	exited := make(chan error, 1)
+	config.OnExit = func(err error) { exited <- err }
+
+	transport := NewStdioTransportWithConfig(config)
+	require.NoError(t, transport.Connect(context.Background()))
+	assert.NotZero(t, transport.PID())
+
+	select {
+	case line := <-lines:
+		assert.Contains(t, line, "dir="+dir)
+		assert.Contains(t, line, "value=from-config")
+	case <-time.After(10 * time.Second):
+		t.Fatal("no stderr output")
+	}
+
+	// A requested shutdown is not reported as an exit
+	require.NoError(t, transport.Close())
+	assert.False(t, transport.IsConnected())
+	select {
+	case err := <-exited:
+		t.Fatalf("unexpected exit callback: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStdioTransportEscalatesToKill(t *testing.T) {
+	config := helperStdio("stubborn")
+	config.StopTimeout = 100 * time.Millisecond
+	started := make(chan struct{}, 1)
+	config.Stderr = func(string) { started <- struct{}{} }
+
+	transport := NewStdioTransportWithConfig(config)
+	require.NoError(t, transport.Connect(context.Background()))
+	<-started
+
+	start := time.Now()
+	require.NoError(t, transport.Close())
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(transport.exitErr, &exitErr))
+	assert.Equal(t, syscall.SIGKILL, exitErr.Sys().(syscall.WaitStatus).Signal())
+}
+
+func TestRecordExitPolicies(t *testing.T) {
+	m := NewMCPManager(MCPManagerConfig{Logger: log.New(io.Discard, "", 0)})
+	now := time.Now()
+	failure := errors.New("exit status 1")
+
+	_, restart := m.recordExit("never", &MCPServerConfig{RestartPolicy: RestartNever}, failure, now)
+	assert.False(t, restart)
+
+	_, restart = m.recordExit("clean", &MCPServerConfig{RestartPolicy: RestartOnFailure}, nil, now)
+	assert.False(t, restart)
+
+	_, restart = m.recordExit("auto", &MCPServerConfig{AutoStart: true}, failure, now)
+	assert.True(t, restart, "auto-start servers default to on-failure")
+
+	config := &MCPServerConfig{RestartPolicy: RestartAlways, RetryDelay: 100 * time.Millisecond, MaxRestarts: 3}
+	var delays []time.Duration
+	for i := 0; i < 3; i++ {
+		delay, restart := m.recordExit("loop", config, nil, now.Add(time.Duration(i)*time.Second))
+		require.True(t, restart)
+		delays = append(delays, delay)
+		m.processes["loop"].pending = false
+	}
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, delays)
+
+	_, restart = m.recordExit("loop", config, nil, now.Add(3*time.Second))
+	assert.False(t, restart)
+	status, ok := m.ProcessStatus("loop")
+	require.True(t, ok)
+	assert.True(t, status.CrashLooping)
+
+	// Failures outside the window do not count towards a crash loop
+	m.resetSupervision("loop")
+	_, restart = m.recordExit("loop", config, nil, now.Add(10*time.Minute))
+	assert.True(t, restart)
+}
+
+func TestRestartAfterRemovedServer(t *testing.T) {
+	m := NewMCPManager(MCPManagerConfig{Logger: log.New(io.Discard, "", 0)})
+	defer m.Stop()
+
+	config := &MCPServerConfig{Name: "gone", Enabled: true, RestartPolicy: RestartAlways}
+	m.AddServer("gone", config)
+
+	_, restart := m.recordExit("gone", config, errors.New("exit status 1"), time.Now())
+	require.True(t, restart)
+
+	// Removed during the restart backoff
+	require.NoError(t, m.RemoveServer("gone"))
+	m.restartAfter("gone", 0)
+
+	_, ok := m.ProcessStatus("gone")
+	assert.False(t, ok)
+}
+
+func TestManagerRestartsCrashedServerUntilCrashLoop(t *testing.T) {
+	m := NewMCPManager(MCPManagerConfig{Logger: log.New(io.Discard, "", 0)})
+	defer m.Stop()
+
+	events, cancel := m.Events().Subscribe(32)
+	defer cancel()
+
+	stdio := helperStdio("crash")
+	m.AddServer("helper", &MCPServerConfig{
+		Name:    "helper",
+		Enabled: true,
+		Transport: map[string]interface{}{
+			"type":    "stdio",
+			"command": stdio.Command,
+			"args":    stdio.Args,
+		},
+		Environment:   map[string]string{"MCP_HELPER": "crash", "HELPER_VALUE": "env"},
+		WorkingDir:    t.TempDir(),
+		RestartPolicy: RestartOnFailure,
+		RetryDelay:    10 * time.Millisecond,
+		MaxRestarts:   2,
+	})
+
+	require.NoError(t, m.ConnectServer(context.Background(), "helper"))
+
+	exits := 0
+	waitFor(t, "crash loop", func() bool {
+		for {
+			select {
+			case event := <-events:
+				switch event.Type {
+				case EventServerExited:
+					exits++
+				case EventServerCrashLoop:
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	})
+	assert.Equal(t, 3, exits)
+
+	status, ok := m.ProcessStatus("helper")
+	require.True(t, ok)
+	assert.True(t, status.CrashLooping)
+	assert.Equal(t, 2, status.Restarts)
+	assert.Contains(t, status.LastExit, "exit status 3")
+
+	logs, err := m.ServerLogs("helper", 0)
+	require.NoError(t, err)
+	var text []string
+	for _, line := range logs {
+		text = append(text, line.Line)
+	}
+	joined := strings.Join(text, "\n")
+	assert.Contains(t, joined, "value=env")
+	assert.Equal(t, 3, strings.Count(joined, "helper crashing"))
+}
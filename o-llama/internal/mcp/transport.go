@@ -9,34 +9,70 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"os/exec"
+	"sort"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
+// Default supervision settings for stdio servers
+const (
+	DefaultStopTimeout = 3 * time.Second
+	maxStdioLineSize   = 16 * 1024 * 1024
+)
+
+// StdioConfig configures a stdio transport and the process behind it
+type StdioConfig struct {
+	Command string
+	Args    []string
+	
+	// Env is merged over the parent environment; Dir sets the working directory
+	Env map[string]string
+	Dir string
+	
+	// StopTimeout bounds each shutdown stage: stdin close, SIGTERM, SIGKILL
+	StopTimeout time.Duration
+	
+	// Stderr receives each line the process writes to stderr
+	Stderr func(line string)
+	
+	// OnExit is called when the process exits without Close being called
+	OnExit func(err error)
+}
+
 // StdioTransport implements MCP transport over stdio
 type StdioTransport struct {
+	config    StdioConfig
 	cmd       *exec.Cmd
 	stdin     io.WriteCloser
 	stdout    io.ReadCloser
 	scanner   *bufio.Scanner
 	connected bool
+	closing   bool
+	startedAt time.Time
+	exited    chan struct{}
+	exitErr   error
 	mutex     sync.RWMutex
+	writeMutex sync.Mutex
 }
 
 // NewStdioTransport creates a new stdio transport for a command
 func NewStdioTransport(command string, args ...string) *StdioTransport {
-	cmd := exec.Command(command, args...)
-	
-	stdin, _ := cmd.StdinPipe()
-	stdout, _ := cmd.StdoutPipe()
+	return NewStdioTransportWithConfig(StdioConfig{Command: command, Args: args})
+}
+
+// NewStdioTransportWithConfig creates a stdio transport with environment,
+// working directory and supervision hooks
+func NewStdioTransportWithConfig(config StdioConfig) *StdioTransport {
+	if config.StopTimeout <= 0 {
+		config.StopTimeout = DefaultStopTimeout
+	}
 	
 	return &StdioTransport{
-		cmd:     cmd,
-		stdin:   stdin,
-		stdout:  stdout,
-		scanner: bufio.NewScanner(stdout),
+		config: config,
+		exited: make(chan struct{}),
 	}
 }
 
@@ -45,32 +81,89 @@ func (t *StdioTransport) Connect(ctx context.Context) error {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 	
-	if t.connected {
+	if t.cmd != nil {
 		return fmt.Errorf("transport already connected")
 	}
 	
-	// Start the command
-	if err := t.cmd.Start(); err != nil {
+	// The process outlives the connect context; Close stops it
+	cmd := exec.Command(t.config.Command, t.config.Args...)
+	cmd.Dir = t.config.Dir
+	cmd.Env = mergeEnv(os.Environ(), t.config.Env)
+	// Own process group so shutdown signals reach wrapper children (npx, uvx)
+	setProcessGroup(cmd)
+	
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	
+	// Parent-owned pipes so Wait does not close them under the reader
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+	
+	err = cmd.Start()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		stdoutR.Close()
+		stderrR.Close()
 		return fmt.Errorf("failed to start command: %w", err)
 	}
 	
+	t.cmd = cmd
+	t.stdin = stdin
+	t.stdout = stdoutR
+	t.scanner = bufio.NewScanner(stdoutR)
+	t.scanner.Buffer(make([]byte, 64*1024), maxStdioLineSize)
 	t.connected = true
+	t.startedAt = time.Now()
 	
-	// Monitor process in background
-	go func() {
-		err := t.cmd.Wait()
-		t.mutex.Lock()
-		t.connected = false
-		t.mutex.Unlock()
-		if err != nil && ctx.Err() == nil {
-			// Process died unexpectedly
-			fmt.Printf("MCP server process died: %v\n", err)
-		}
-	}()
+	go t.readStderr(stderrR)
+	go t.wait()
 	
 	return nil
 }
 
+// readStderr forwards stderr lines until the process closes the stream
+func (t *StdioTransport) readStderr(stderr io.ReadCloser) {
+	defer stderr.Close()
+	
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 4096), 1024*1024)
+	for scanner.Scan() {
+		if t.config.Stderr != nil {
+			t.config.Stderr(scanner.Text())
+		}
+	}
+}
+
+// wait reaps the process and reports unexpected exits
+func (t *StdioTransport) wait() {
+	err := t.cmd.Wait()
+	
+	t.mutex.Lock()
+	t.connected = false
+	t.exitErr = err
+	closing := t.closing
+	t.mutex.Unlock()
+	
+	close(t.exited)
+	
+	if !closing && t.config.OnExit != nil {
+		t.config.OnExit(err)
+	}
+}
+
 // Send sends a message over stdio
 func (t *StdioTransport) Send(message *Message) error {
 	t.mutex.RLock()
@@ -86,7 +179,9 @@ func (t *StdioTransport) Send(message *Message) error {
 	}
 	
 	// Write message with newline delimiter
+	t.writeMutex.Lock()
 	_, err = t.stdin.Write(append(data, '\n'))
+	t.writeMutex.Unlock()
 	if err != nil {
 		return fmt.Errorf("failed to write message: %w", err)
 	}
@@ -97,33 +192,35 @@ func (t *StdioTransport) Send(message *Message) error {
 // Receive receives a message from stdio
 func (t *StdioTransport) Receive() (*Message, error) {
 	t.mutex.RLock()
-	connected := t.connected
+	scanner := t.scanner
 	t.mutex.RUnlock()
 	
-	if !connected {
+	if scanner == nil {
 		return nil, fmt.Errorf("transport not connected")
 	}
 	
-	// Read line from stdout
-	if !t.scanner.Scan() {
-		if err := t.scanner.Err(); err != nil {
-			return nil, fmt.Errorf("failed to read from stdout: %w", err)
+	for {
+		// Read line from stdout
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("failed to read from stdout: %w", err)
+			}
+			return nil, fmt.Errorf("EOF from server: %w", io.EOF)
 		}
-		return nil, fmt.Errorf("EOF from server")
-	}
-	
-	line := t.scanner.Text()
-	if line == "" {
-		return t.Receive() // Skip empty lines
-	}
-	
-	// Parse JSON message
-	var message Message
-	if err := json.Unmarshal([]byte(line), &message); err != nil {
-		return nil, fmt.Errorf("failed to parse message: %w", err)
+		
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue // Skip empty lines
+		}
+		
+		// Parse JSON message
+		var message Message
+		if err := json.Unmarshal(line, &message); err != nil {
+			return nil, fmt.Errorf("failed to parse message: %w", err)
+		}
+		
+		return &message, nil
 	}
-	
-	return &message, nil
 }
 
 // IsConnected returns whether the transport is connected
@@ -133,46 +230,88 @@ func (t *StdioTransport) IsConnected() bool {
 	return t.connected
 }
 
-// Close closes the transport and terminates the command
+// PID returns the process ID, or 0 before the process has started
+func (t *StdioTransport) PID() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if t.cmd == nil || t.cmd.Process == nil {
+		return 0
+	}
+	return t.cmd.Process.Pid
+}
+
+// StartedAt returns when the process was started
+func (t *StdioTransport) StartedAt() time.Time {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.startedAt
+}
+
+// Close stops the process: stdin is closed first, then SIGTERM and finally
+// SIGKILL are sent to its process group, each after StopTimeout. On Windows
+// the process is killed once StopTimeout passes.
 func (t *StdioTransport) Close() error {
 	t.mutex.Lock()
-	defer t.mutex.Unlock()
-	
-	if !t.connected {
+	if t.cmd == nil || t.closing {
+		t.mutex.Unlock()
 		return nil
 	}
+	t.closing = true
+	t.mutex.Unlock()
 	
-	// Close stdin to signal shutdown to server
-	if t.stdin != nil {
-		t.stdin.Close()
+	// Closing stdin is the MCP stdio shutdown signal
+	t.stdin.Close()
+	
+	if !t.waitExit(t.config.StopTimeout) {
+		t.terminate()
+		if !t.waitExit(t.config.StopTimeout) {
+			t.kill()
+		}
 	}
 	
-	// Give the process time to shutdown gracefully
-	done := make(chan error, 1)
-	go func() {
-		done <- t.cmd.Wait()
-	}()
+	<-t.exited
+	t.stdout.Close()
 	
+	return nil
+}
+
+// waitExit reports whether the process exited within timeout
+func (t *StdioTransport) waitExit(timeout time.Duration) bool {
 	select {
-	case err := <-done:
-		// Process exited gracefully
-		t.connected = false
-		return err
-	case <-time.After(5 * time.Second):
-		// Force kill the process
-		if t.cmd.Process != nil {
-			t.cmd.Process.Signal(syscall.SIGTERM)
-			
-			// Wait a bit more, then force kill
-			select {
-			case <-done:
-			case <-time.After(2 * time.Second):
-				t.cmd.Process.Kill()
-			}
+	case <-t.exited:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// mergeEnv overlays variables on a KEY=VALUE environment list
+func mergeEnv(base []string, overrides map[string]string) []string {
+	if len(overrides) == 0 {
+		return base
+	}
+	
+	env := make([]string, 0, len(base)+len(overrides))
+	for _, kv := range base {
+		key := kv
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			key = kv[:i]
 		}
-		t.connected = false
-		return nil
+		if _, ok := overrides[key]; !ok {
+			env = append(env, kv)
+		}
+	}
+	
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+overrides[key])
 	}
+	
+	return env
 }
 
 // SocketTransport implements MCP transport over Unix domain sockets or TCP
@@ -326,7 +465,7 @@ func (t *InMemoryTransport) Send(message *Message) error {
 	}
 }
 
-// Receive receives a message from the incoming channel
+// Receive blocks until a message arrives on the incoming channel
 func (t *InMemoryTransport) Receive() (*Message, error) {
 	t.mutex.RLock()
 	connected := t.connected
@@ -336,12 +475,11 @@ func (t *InMemoryTransport) Receive() (*Message, error) {
 		return nil, fmt.Errorf("transport not connected")
 	}
 	
-	select {
-	case message := <-t.incoming:
-		return message, nil
-	default:
-		return nil, fmt.Errorf("no messages available")
+	message, ok := <-t.incoming
+	if !ok {
+		return nil, fmt.Errorf("transport closed")
 	}
+	return message, nil
 }
 
 // SendToIncoming sends a message to the incoming channel (for testing)
@@ -412,23 +550,12 @@ func (f *TransportFactory) CreateTransport(config map[string]interface{}) (Trans
 	
 	switch transportType {
 	case "stdio":
-		command, ok := config["command"].(string)
-		if !ok {
-			return nil, fmt.Errorf("stdio transport requires command")
+		stdio, err := f.StdioConfig(config)
+		if err != nil {
+			return nil, err
 		}
 		
-		var args []string
-		if argsInterface, exists := config["args"]; exists {
-			if argsSlice, ok := argsInterface.([]interface{}); ok {
-				for _, arg := range argsSlice {
-					if argStr, ok := arg.(string); ok {
-						args = append(args, argStr)
-					}
-				}
-			}
-		}
-		
-		return NewStdioTransport(command, args...), nil
+		return NewStdioTransportWithConfig(stdio), nil
 		
 	case "unix":
 		path, ok := config["path"].(string)
@@ -458,4 +585,51 @@ func (f *TransportFactory) CreateTransport(config map[string]interface{}) (Trans
 	default:
 		return nil, fmt.Errorf("unsupported transport type: %s", transportType)
 	}
-}
\ No newline at end of file
+}
+
+// StdioConfig builds the process settings for a stdio transport
+// configuration. The command may be a string or a list whose first element is
+// the executable.
+func (f *TransportFactory) StdioConfig(config map[string]interface{}) (StdioConfig, error) {
+	var stdio StdioConfig
+	
+	switch command := config["command"].(type) {
+	case string:
+		stdio.Command = command
+	case []interface{}, []string:
+		parts := stringList(command)
+		if len(parts) > 0 {
+			stdio.Command = parts[0]
+			stdio.Args = parts[1:]
+		}
+	}
+	
+	if stdio.Command == "" {
+		return stdio, fmt.Errorf("stdio transport requires command")
+	}
+	
+	stdio.Args = append(stdio.Args, stringList(config["args"])...)
+	
+	if dir, ok := config["cwd"].(string); ok {
+		stdio.Dir = dir
+	}
+	
+	return stdio, nil
+}
+
+// stringList converts a decoded list value to strings, skipping non-strings
+func stringList(value interface{}) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		var out []string
+		for _, item := range list {
+			if str, ok := item.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
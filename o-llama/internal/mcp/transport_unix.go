@@ -0,0 +1,30 @@
+//go:build !windows
+
+package mcp
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the process in a group of its own
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate asks the process group to exit
+func (t *StdioTransport) terminate() {
+	t.signal(syscall.SIGTERM)
+}
+
+// kill stops the process group
+func (t *StdioTransport) kill() {
+	t.signal(syscall.SIGKILL)
+}
+
+// signal sends sig to the process group, falling back to the process itself
+func (t *StdioTransport) signal(sig syscall.Signal) {
+	if err := syscall.Kill(-t.cmd.Process.Pid, sig); err != nil {
+		t.cmd.Process.Signal(sig)
+	}
+}
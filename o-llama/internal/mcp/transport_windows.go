@@ -0,0 +1,21 @@
+//go:build windows
+
+package mcp
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op: Windows has no process groups to signal
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminate stops the process. Windows can't ask a console process to exit
+// with a signal, so it is killed once closing stdin wasn't enough.
+func (t *StdioTransport) terminate() {
+	t.kill()
+}
+
+// kill stops the process
+func (t *StdioTransport) kill() {
+	t.cmd.Process.Kill()
+}
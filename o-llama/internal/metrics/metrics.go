@@ -0,0 +1,46 @@
+// Package metrics registers the integrated server's Prometheus metrics and
+// serves them in the Prometheus text and OpenMetrics formats
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the metrics served at /metrics
+var Registry = prometheus.NewRegistry()
+
+// Factory registers metrics with Registry
+var Factory = promauto.With(Registry)
+
+var (
+	httpRequests        = Factory.NewCounterVec(prometheus.CounterOpts{Name: "inspector_gadget_http_requests_total", Help: "HTTP requests served."}, []string{"method", "route", "status"})
+	httpRequestDuration = Factory.NewHistogramVec(prometheus.HistogramOpts{Name: "inspector_gadget_http_request_duration_seconds", Help: "Time to serve HTTP requests, including streamed responses.", Buckets: prometheus.DefBuckets}, []string{"method", "route"})
+)
+
+// Middleware records the count and latency of requests by route, alongside
+// the access log
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves Registry, in OpenMetrics when the client accepts it
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/gadgets/:name", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.GET("/metrics", Handler())
+
+	// Registry is shared by the whole package, so only the change is checked
+	requests := httpRequests.WithLabelValues(http.MethodGet, "/api/gadgets/:name", "204")
+	before := testutil.ToFloat64(requests)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/gadgets/net-scan", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(requests))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, w.Body.String(), `inspector_gadget_http_requests_total{method="GET",route="/api/gadgets/:name",status="204"}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "application/openmetrics-text"))
+	assert.True(t, strings.HasSuffix(w.Body.String(), "# EOF\n"))
+}
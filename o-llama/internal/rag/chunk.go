@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Default chunking applied when an index leaves it unset, in characters
+const (
+	DefaultChunkSize    = 1500
+	DefaultChunkOverlap = 200
+)
+
+// chunk is a piece of a file that is embedded and retrieved on its own
+type chunk struct {
+	Text      string
+	StartLine int
+	EndLine   int
+}
+
+// chunkText splits text on line boundaries into chunks of at most size
+// characters, repeating up to overlap characters of trailing lines at the
+// start of the next chunk so that passages spanning a boundary are kept
+// together. Lines longer than size are split.
+func chunkText(text string, size, overlap int) []chunk {
+	type line struct {
+		text string
+		n    int
+	}
+
+	var lines []line
+	for i, l := range strings.Split(text, "\n") {
+		r := []rune(strings.TrimRight(l, "\r"))
+		for len(r) > size {
+			lines = append(lines, line{string(r[:size]), i + 1})
+			r = r[size:]
+		}
+		lines = append(lines, line{string(r), i + 1})
+	}
+
+	var chunks []chunk
+	flush := func(cur []line) {
+		parts := make([]string, len(cur))
+		for i, l := range cur {
+			parts[i] = l.text
+		}
+
+		text := strings.Join(parts, "\n")
+		if strings.TrimSpace(text) != "" {
+			chunks = append(chunks, chunk{Text: text, StartLine: cur[0].n, EndLine: cur[len(cur)-1].n})
+		}
+	}
+
+	var cur []line
+	var length, fresh int
+	for _, l := range lines {
+		n := utf8.RuneCountInString(l.text) + 1
+		if fresh > 0 && length+n > size {
+			flush(cur)
+
+			// carry trailing lines into the next chunk
+			keep, kept := 0, 0
+			for keep < len(cur) {
+				m := utf8.RuneCountInString(cur[len(cur)-1-keep].text) + 1
+				if kept+m > overlap {
+					break
+				}
+				kept += m
+				keep++
+			}
+
+			cur = append([]line(nil), cur[len(cur)-keep:]...)
+			length, fresh = kept, 0
+		}
+
+		cur = append(cur, l)
+		length += n
+		fresh++
+	}
+
+	if fresh > 0 {
+		flush(cur)
+	}
+
+	return chunks
+}
@@ -0,0 +1,281 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"inspector-gadget-os/o-llama/internal/agent"
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/logging"
+)
+
+// errorStatus maps indexer errors to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrIndexNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrIndexExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidIndex):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, ErrOwnerRevoked):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// RegisterRoutes registers the index management endpoints under /rag
+func (ix *Indexer) RegisterRoutes(router *gin.RouterGroup) {
+	indexes := router.Group("/rag/indexes")
+	{
+		indexes.POST("", ix.createHandler)
+		indexes.GET("", ix.listHandler)
+		indexes.GET("/:name", ix.getHandler)
+		indexes.DELETE("/:name", ix.deleteHandler)
+		indexes.POST("/:name/sync", ix.syncHandler)
+	}
+}
+
+func (ix *Indexer) createHandler(c *gin.Context) {
+	claims, err := auth.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var req IndexRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	index, err := ix.Create(c.Request.Context(), claims, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// files are embedded in the background
+	c.JSON(http.StatusAccepted, index)
+}
+
+func (ix *Indexer) listHandler(c *gin.Context) {
+	indexes := ix.List()
+	c.JSON(http.StatusOK, gin.H{
+		"indexes": indexes,
+		"count":   len(indexes),
+	})
+}
+
+func (ix *Indexer) getHandler(c *gin.Context) {
+	index, err := ix.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, index)
+}
+
+func (ix *Indexer) deleteHandler(c *gin.Context) {
+	claims, err := auth.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if err := ix.Delete(c.Request.Context(), claims, c.Param("name")); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted index " + c.Param("name")})
+}
+
+// syncHandler picks up file changes now rather than at the next interval
+func (ix *Indexer) syncHandler(c *gin.Context) {
+	index, err := ix.SyncAsync(c.Param("name"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, index)
+}
+
+// Options is the rag field of a chat request
+type Options struct {
+	Index string `json:"index"`
+	K     int    `json:"k,omitempty"`
+}
+
+// ChatProxy forwards chat requests to the model runtime, answering from
+// indexed files when they ask for it
+type ChatProxy struct {
+	baseURL string
+	client  *http.Client
+	indexer *Indexer
+}
+
+// NewChatProxy creates a proxy for the model runtime at baseURL
+func NewChatProxy(baseURL string, indexer *Indexer) *ChatProxy {
+	return &ChatProxy{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{},
+		indexer: indexer,
+	}
+}
+
+// Chat handles POST /api/chat. The body is the runtime's chat request; with a
+// rag option, chunks relevant to the last user message are injected before it
+// and listed as citations on the final response.
+func (p *ChatProxy) Chat(c *gin.Context) {
+	claims, err := auth.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var citations []Citation
+	if raw, ok := body["rag"]; ok {
+		delete(body, "rag")
+
+		var opts *Options
+		if err := json.Unmarshal(raw, &opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rag option: " + err.Error()})
+			return
+		}
+
+		if opts != nil {
+			citations, err = p.retrieve(c, claims, body, *opts)
+			if err != nil {
+				c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(agent.UserHeader, claims.Username)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("model runtime unavailable: %v", err)})
+		return
+	}
+	defer resp.Body.Close()
+
+	// Streamed responses outlive the server's default write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	for _, key := range []string{"Content-Type", "Retry-After"} {
+		if value := resp.Header.Get(key); value != "" {
+			c.Header(key, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if resp.StatusCode == http.StatusOK && len(citations) > 0 {
+			line = withCitations(line, citations)
+		}
+
+		if _, err := c.Writer.Write(append(line, '\n')); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+	if err := scanner.Err(); err != nil {
+		logging.L().Warnw("rag.chat.stream.error", "user", claims.Username, "error", err.Error())
+	}
+}
+
+// retrieve finds chunks for the last user message of a chat request and
+// injects them into its messages
+func (p *ChatProxy) retrieve(c *gin.Context, claims *auth.Claims, body map[string]json.RawMessage, opts Options) ([]Citation, error) {
+	if opts.Index == "" {
+		return nil, fmt.Errorf("%w: rag requires an index", ErrInvalidIndex)
+	}
+
+	var messages []map[string]interface{}
+	if err := json.Unmarshal(body["messages"], &messages); err != nil {
+		return nil, fmt.Errorf("%w: invalid messages: %v", ErrInvalidIndex, err)
+	}
+
+	at := lastUserMessage(messages)
+	if at < 0 {
+		return nil, fmt.Errorf("%w: rag requires a user message", ErrInvalidIndex)
+	}
+
+	query, _ := messages[at]["content"].(string)
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	citations, err := p.indexer.Retrieve(c.Request.Context(), claims, opts.Index, query, opts.K)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(augment(messages, citations))
+	if err != nil {
+		return nil, err
+	}
+	body["messages"] = data
+
+	return citations, nil
+}
+
+// withCitations adds citations to the final chunk of a chat response,
+// returning other lines unchanged
+func withCitations(line []byte, citations []Citation) []byte {
+	var chunk map[string]json.RawMessage
+	if err := json.Unmarshal(line, &chunk); err != nil {
+		return line
+	}
+
+	var done bool
+	if err := json.Unmarshal(chunk["done"], &done); err != nil || !done {
+		return line
+	}
+
+	data, err := json.Marshal(citations)
+	if err != nil {
+		return line
+	}
+	chunk["citations"] = data
+
+	out, err := json.Marshal(chunk)
+	if err != nil {
+		return line
+	}
+	return out
+}
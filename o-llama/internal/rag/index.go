@@ -0,0 +1,677 @@
+// Package rag indexes text files under the SafeFS base paths into collections
+// of the model runtime and retrieves relevant chunks of them for chat.
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"inspector-gadget-os/o-llama/internal/agent"
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/logging"
+	"inspector-gadget-os/o-llama/internal/safefs"
+)
+
+// Defaults applied when the server configuration leaves them unset
+const (
+	DefaultSyncInterval = time.Minute
+	DefaultTopK         = 4
+
+	// MaxTopK bounds the chunks injected into a single chat request
+	MaxTopK = 20
+
+	// maxIndexFiles bounds the files walked for a single index
+	maxIndexFiles = 10000
+
+	// upsertBatch is the most chunks sent to the runtime at once
+	upsertBatch = 32
+
+	// collectionPrefix namespaces runtime collections owned by indexes
+	collectionPrefix = "rag-"
+)
+
+// Common errors
+var (
+	ErrIndexNotFound    = errors.New("index not found")
+	ErrIndexExists      = errors.New("index already exists")
+	ErrInvalidIndex     = errors.New("invalid index")
+	ErrPermissionDenied = errors.New("insufficient permissions for index")
+	ErrOwnerRevoked     = errors.New("index owner may no longer read files")
+)
+
+var validIndexName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,59}$`)
+
+// Authorizer checks RBAC permissions for authenticated claims
+type Authorizer interface {
+	HasPermission(claims *auth.Claims, object, action string) bool
+}
+
+// RoleSource looks up the current roles of a user
+type RoleSource interface {
+	GetUserRoles(user string) ([]string, error)
+}
+
+// Config holds indexer configuration
+type Config struct {
+	FS           *safefs.SafeFS
+	Store        Store
+	Authorizer   Authorizer
+	Roles        RoleSource
+	DefaultModel string
+	SyncInterval time.Duration
+
+	// StatePath, if set, keeps index definitions and file states across
+	// restarts so that unchanged files aren't embedded again
+	StatePath string
+}
+
+// IndexRequest is the body of POST /api/rag/indexes
+type IndexRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Path         string `json:"path" binding:"required"`
+	Model        string `json:"model,omitempty"`
+	ChunkSize    int    `json:"chunk_size,omitempty"`
+	ChunkOverlap int    `json:"chunk_overlap,omitempty"`
+}
+
+// Index describes an indexed directory
+type Index struct {
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	Model        string    `json:"model"`
+	ChunkSize    int       `json:"chunk_size"`
+	ChunkOverlap int       `json:"chunk_overlap"`
+	Owner        string    `json:"owner"`
+	Collection   string    `json:"collection"`
+	Files        int       `json:"files"`
+	Chunks       int       `json:"chunks"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastSync     time.Time `json:"last_sync,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	Syncing      bool      `json:"syncing"`
+}
+
+// fileState records what was embedded for a file
+type fileState struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Chunks  int       `json:"chunks"`
+}
+
+// index is an Index with the state of its files. syncMu serializes syncs;
+// everything else is guarded by the indexer's mutex.
+type index struct {
+	Index
+	FileStates map[string]fileState `json:"file_states"`
+
+	syncMu sync.Mutex
+}
+
+// Indexer keeps directories indexed and retrieves chunks from them
+type Indexer struct {
+	fs           *safefs.SafeFS
+	store        Store
+	authorizer   Authorizer
+	roles        RoleSource
+	defaultModel string
+	syncInterval time.Duration
+	statePath    string
+
+	mu      sync.RWMutex
+	indexes map[string]*index
+
+	saveMu sync.Mutex
+}
+
+// NewIndexer creates an indexer, restoring indexes saved at StatePath
+func NewIndexer(config Config) (*Indexer, error) {
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = DefaultSyncInterval
+	}
+
+	ix := &Indexer{
+		fs:           config.FS,
+		store:        config.Store,
+		authorizer:   config.Authorizer,
+		roles:        config.Roles,
+		defaultModel: config.DefaultModel,
+		syncInterval: config.SyncInterval,
+		statePath:    config.StatePath,
+		indexes:      make(map[string]*index),
+	}
+
+	if err := ix.load(); err != nil {
+		return nil, fmt.Errorf("failed to load index state: %w", err)
+	}
+
+	return ix, nil
+}
+
+// Create registers an index of req.Path owned by the caller and starts
+// embedding it in the background
+func (ix *Indexer) Create(ctx context.Context, claims *auth.Claims, req IndexRequest) (*Index, error) {
+	if !validIndexName.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: name %q must be letters, digits, '_', '.' and '-'", ErrInvalidIndex, req.Name)
+	}
+
+	if !filepath.IsAbs(req.Path) {
+		return nil, fmt.Errorf("%w: path must be absolute", ErrInvalidIndex)
+	}
+
+	if req.Model == "" {
+		req.Model = ix.defaultModel
+	}
+	if req.Model == "" {
+		return nil, fmt.Errorf("%w: model is required", ErrInvalidIndex)
+	}
+
+	if req.ChunkSize <= 0 {
+		req.ChunkSize = DefaultChunkSize
+	}
+	if req.ChunkOverlap <= 0 {
+		req.ChunkOverlap = DefaultChunkOverlap
+	}
+	if req.ChunkOverlap >= req.ChunkSize/2 {
+		return nil, fmt.Errorf("%w: chunk_overlap must be less than half of chunk_size", ErrInvalidIndex)
+	}
+
+	if !ix.canRead(claims, "") {
+		return nil, ErrPermissionDenied
+	}
+
+	// The root must be a directory SafeFS lets the owner list
+	path := filepath.Clean(req.Path)
+	if _, err := ix.fs.ListDir(path, claims.Username); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIndex, err)
+	}
+
+	ix.mu.Lock()
+	if _, ok := ix.indexes[req.Name]; ok {
+		ix.mu.Unlock()
+		return nil, ErrIndexExists
+	}
+
+	idx := &index{
+		Index: Index{
+			Name:         req.Name,
+			Path:         path,
+			Model:        req.Model,
+			ChunkSize:    req.ChunkSize,
+			ChunkOverlap: req.ChunkOverlap,
+			Owner:        claims.Username,
+			Collection:   collectionPrefix + req.Name,
+			CreatedAt:    time.Now(),
+		},
+		FileStates: make(map[string]fileState),
+	}
+
+	// hold off syncs until the collection exists
+	idx.syncMu.Lock()
+	ix.indexes[req.Name] = idx
+	ix.mu.Unlock()
+
+	// A collection left behind by a lost state file is started over
+	ctx = agent.WithUser(ctx, claims.Username)
+	err := ix.store.DeleteCollection(ctx, idx.Collection)
+	if err == nil {
+		err = ix.store.CreateCollection(ctx, idx.Collection, idx.Model)
+	}
+	idx.syncMu.Unlock()
+	if err != nil {
+		ix.mu.Lock()
+		delete(ix.indexes, req.Name)
+		ix.mu.Unlock()
+		return nil, err
+	}
+
+	ix.save()
+	logging.L().Infow("rag.index.create", "index", idx.Name, "path", idx.Path, "model", idx.Model, "user", claims.Username)
+
+	info, _ := ix.SyncAsync(req.Name)
+	return info, nil
+}
+
+// List returns every index, sorted by name
+func (ix *Indexer) List() []Index {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	indexes := make([]Index, 0, len(ix.indexes))
+	for _, idx := range ix.indexes {
+		indexes = append(indexes, idx.Index)
+	}
+
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes
+}
+
+// Get returns a single index
+func (ix *Indexer) Get(name string) (*Index, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	idx, ok := ix.indexes[name]
+	if !ok {
+		return nil, ErrIndexNotFound
+	}
+
+	info := idx.Index
+	return &info, nil
+}
+
+// Delete removes an index and its collection. Only the owner or a system
+// manager may delete an index.
+func (ix *Indexer) Delete(ctx context.Context, claims *auth.Claims, name string) error {
+	ix.mu.Lock()
+	idx, ok := ix.indexes[name]
+	if !ok {
+		ix.mu.Unlock()
+		return ErrIndexNotFound
+	}
+
+	if claims.Username != idx.Owner && (ix.authorizer == nil || !ix.authorizer.HasPermission(claims, "system", "manage")) {
+		ix.mu.Unlock()
+		return ErrPermissionDenied
+	}
+
+	delete(ix.indexes, name)
+	ix.mu.Unlock()
+
+	ix.save()
+	logging.L().Infow("rag.index.delete", "index", name, "user", claims.Username)
+
+	return ix.store.DeleteCollection(agent.WithUser(ctx, claims.Username), idx.Collection)
+}
+
+// SyncAsync starts syncing an index in the background unless a sync is
+// already running, returning the index as it is now
+func (ix *Indexer) SyncAsync(name string) (*Index, error) {
+	ix.mu.RLock()
+	idx, ok := ix.indexes[name]
+	ix.mu.RUnlock()
+	if !ok {
+		return nil, ErrIndexNotFound
+	}
+
+	if idx.syncMu.TryLock() {
+		ix.setSyncing(idx, true)
+		go func() {
+			defer idx.syncMu.Unlock()
+			ix.sync(context.Background(), idx)
+		}()
+	}
+
+	return ix.Get(name)
+}
+
+// Sync brings an index up to date with its directory, waiting for a
+// running sync to finish first
+func (ix *Indexer) Sync(ctx context.Context, name string) (*Index, error) {
+	ix.mu.RLock()
+	idx, ok := ix.indexes[name]
+	ix.mu.RUnlock()
+	if !ok {
+		return nil, ErrIndexNotFound
+	}
+
+	idx.syncMu.Lock()
+	ix.setSyncing(idx, true)
+	ix.sync(ctx, idx)
+	idx.syncMu.Unlock()
+
+	return ix.Get(name)
+}
+
+// Start syncs every index each interval so that added, changed and removed
+// files are picked up, until ctx is canceled
+func (ix *Indexer) Start(ctx context.Context) {
+	ticker := time.NewTicker(ix.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, info := range ix.List() {
+			ix.SyncAsync(info.Name)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ix *Indexer) setSyncing(idx *index, syncing bool) {
+	ix.mu.Lock()
+	idx.Syncing = syncing
+	ix.mu.Unlock()
+}
+
+// sync embeds new and changed files of idx and removes the chunks of files
+// which are gone. The caller holds idx.syncMu.
+func (ix *Indexer) sync(ctx context.Context, idx *index) {
+	ix.mu.RLock()
+	info := idx.Index
+	states := make(map[string]fileState, len(idx.FileStates))
+	for path, state := range idx.FileStates {
+		states[path] = state
+	}
+	ix.mu.RUnlock()
+
+	start := time.Now()
+	ctx = agent.WithUser(ctx, info.Owner)
+
+	var changed, removed int
+	syncErr := ix.checkOwner(info)
+	if syncErr == nil {
+		var files map[string]os.FileInfo
+		files, syncErr = ix.walk(info)
+		if syncErr == nil {
+			changed, removed, syncErr = ix.apply(ctx, info, files, states)
+		}
+	}
+
+	ix.mu.Lock()
+	// the index may have been deleted while syncing
+	if ix.indexes[info.Name] == idx {
+		idx.FileStates = states
+		idx.Files = len(states)
+		idx.Chunks = 0
+		for _, state := range states {
+			idx.Chunks += state.Chunks
+		}
+		idx.LastSync = time.Now()
+		idx.LastError = ""
+		if syncErr != nil {
+			idx.LastError = syncErr.Error()
+		}
+	}
+	idx.Syncing = false
+	ix.mu.Unlock()
+
+	if changed > 0 || removed > 0 || syncErr != nil {
+		ix.save()
+	}
+
+	if syncErr != nil {
+		logging.L().Warnw("rag.index.sync.error", "index", info.Name, "error", syncErr.Error())
+		return
+	}
+
+	logging.L().Infow("rag.index.sync",
+		"index", info.Name,
+		"changed", changed,
+		"removed", removed,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+}
+
+// walk lists the files under the index root which SafeFS allows reading.
+// Hidden entries and symlinks are skipped.
+func (ix *Indexer) walk(info Index) (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+
+	var visit func(dir string) error
+	visit = func(dir string) error {
+		// only metadata is compared here; reads of changed files are audited
+		entries, err := ix.fs.StatDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") || entry.Mode()&os.ModeSymlink != 0 {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			if entry.IsDir() {
+				if err := visit(path); err != nil {
+					logging.L().Debugw("rag.index.walk.skip", "index", info.Name, "path", path, "error", err.Error())
+				}
+				continue
+			}
+
+			if !entry.Mode().IsRegular() || ix.fs.ValidatePath(path) != nil {
+				continue
+			}
+
+			if len(files) >= maxIndexFiles {
+				return fmt.Errorf("more than %d files under %s", maxIndexFiles, info.Path)
+			}
+			files[path] = entry
+		}
+
+		return nil
+	}
+
+	if err := visit(info.Path); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// apply embeds files whose size or modification time changed and removes
+// files which are gone, updating states as it goes so that progress is kept
+// when the store fails part way
+func (ix *Indexer) apply(ctx context.Context, info Index, files map[string]os.FileInfo, states map[string]fileState) (changed, removed int, err error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var fileErr error
+	for _, path := range paths {
+		file := files[path]
+		state, ok := states[path]
+		if ok && state.Size == file.Size() && state.ModTime.Equal(file.ModTime()) {
+			continue
+		}
+
+		chunks, err := ix.read(info, path)
+		if err != nil {
+			// unreadable files are retried on the next sync
+			logging.L().Warnw("rag.index.file.skip", "index", info.Name, "path", path, "error", err.Error())
+			fileErr = err
+			continue
+		}
+
+		docs := make([]Document, len(chunks))
+		for i, c := range chunks {
+			docs[i] = Document{
+				ID:   chunkID(path, i),
+				Text: c.Text,
+				Metadata: map[string]interface{}{
+					"path":       path,
+					"chunk":      i,
+					"start_line": c.StartLine,
+					"end_line":   c.EndLine,
+				},
+			}
+		}
+
+		for i := 0; i < len(docs); i += upsertBatch {
+			if err := ix.store.Upsert(ctx, info.Collection, docs[i:min(i+upsertBatch, len(docs))]); err != nil {
+				return changed, removed, err
+			}
+		}
+
+		if err := ix.deleteChunks(ctx, info, path, len(chunks), state.Chunks); err != nil {
+			return changed, removed, err
+		}
+
+		states[path] = fileState{ModTime: file.ModTime(), Size: file.Size(), Chunks: len(chunks)}
+		changed++
+	}
+
+	for path, state := range states {
+		if _, ok := files[path]; ok {
+			continue
+		}
+
+		if err := ix.deleteChunks(ctx, info, path, 0, state.Chunks); err != nil {
+			return changed, removed, err
+		}
+
+		delete(states, path)
+		removed++
+	}
+
+	return changed, removed, fileErr
+}
+
+// read reads a file through SafeFS as the index owner and chunks it. Files
+// which aren't UTF-8 text yield no chunks.
+func (ix *Indexer) read(info Index, path string) ([]chunk, error) {
+	data, err := ix.fs.ReadFile(path, info.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if !utf8.Valid(data) {
+		return nil, nil
+	}
+
+	return chunkText(string(data), info.ChunkSize, info.ChunkOverlap), nil
+}
+
+// deleteChunks removes the chunks of path numbered from to below to
+func (ix *Indexer) deleteChunks(ctx context.Context, info Index, path string, from, to int) error {
+	if from >= to {
+		return nil
+	}
+
+	ids := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		ids = append(ids, chunkID(path, i))
+	}
+
+	return ix.store.Delete(ctx, info.Collection, ids)
+}
+
+// chunkID is the document ID of the i-th chunk of a file
+func chunkID(path string, i int) string {
+	sum := sha256.Sum256([]byte(path))
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:8]), i)
+}
+
+// checkOwner fails unless the owner of an index currently exists and may
+// read files. Roles are looked up each time rather than kept with the index,
+// so revoking them stops both syncing and retrieval.
+func (ix *Indexer) checkOwner(info Index) error {
+	if ix.roles == nil {
+		return ErrOwnerRevoked
+	}
+
+	roles, err := ix.roles.GetUserRoles(info.Owner)
+	if err != nil {
+		return fmt.Errorf("failed to look up owner %s: %w", info.Owner, err)
+	}
+
+	if len(roles) == 0 {
+		return fmt.Errorf("%w: %s no longer exists", ErrOwnerRevoked, info.Owner)
+	}
+
+	owner := &auth.Claims{UserID: info.Owner, Username: info.Owner, Roles: roles}
+	if !ix.canRead(owner, "") {
+		return fmt.Errorf("%w: %s", ErrOwnerRevoked, info.Owner)
+	}
+
+	return nil
+}
+
+// canRead reports whether claims may read path through SafeFS. An empty
+// path only checks RBAC.
+func (ix *Indexer) canRead(claims *auth.Claims, path string) bool {
+	if ix.authorizer == nil || !ix.authorizer.HasPermission(claims, "filesystem", "read") {
+		return false
+	}
+
+	return path == "" || ix.fs.ValidatePath(path) == nil
+}
+
+// state is the file format of StatePath
+type state struct {
+	Indexes []*index `json:"indexes"`
+}
+
+func (ix *Indexer) load() error {
+	if ix.statePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(ix.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	for _, idx := range s.Indexes {
+		if idx.FileStates == nil {
+			idx.FileStates = make(map[string]fileState)
+		}
+		idx.Syncing = false
+		ix.indexes[idx.Name] = idx
+	}
+
+	return nil
+}
+
+// save writes the index state, logging failures since the indexes are still
+// usable and are saved again after the next change
+func (ix *Indexer) save() {
+	if ix.statePath == "" {
+		return
+	}
+
+	ix.saveMu.Lock()
+	defer ix.saveMu.Unlock()
+
+	ix.mu.RLock()
+	s := state{Indexes: make([]*index, 0, len(ix.indexes))}
+	for _, idx := range ix.indexes {
+		s.Indexes = append(s.Indexes, idx)
+	}
+	sort.Slice(s.Indexes, func(i, j int) bool { return s.Indexes[i].Name < s.Indexes[j].Name })
+	data, err := json.Marshal(s)
+	ix.mu.RUnlock()
+	if err != nil {
+		logging.L().Errorw("rag.state.save.error", "error", err.Error())
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ix.statePath), 0o755); err != nil {
+		logging.L().Errorw("rag.state.save.error", "error", err.Error())
+		return
+	}
+
+	tmp := ix.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		logging.L().Errorw("rag.state.save.error", "error", err.Error())
+		return
+	}
+
+	if err := os.Rename(tmp, ix.statePath); err != nil {
+		logging.L().Errorw("rag.state.save.error", "error", err.Error())
+	}
+}
@@ -0,0 +1,442 @@
+package rag
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"inspector-gadget-os/o-llama/internal/agent"
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/safefs"
+)
+
+// memoryStore keeps collections in memory, scoring documents by the number
+// of query words they contain
+type memoryStore struct {
+	mu          sync.Mutex
+	collections map[string]map[string]Document
+	upserts     int
+	users       []string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{collections: make(map[string]map[string]Document)}
+}
+
+func (s *memoryStore) CreateCollection(ctx context.Context, name, model string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collections[name] = make(map[string]Document)
+	return nil
+}
+
+func (s *memoryStore) DeleteCollection(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.collections, name)
+	return nil
+}
+
+func (s *memoryStore) Upsert(ctx context.Context, collection string, docs []Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = append(s.users, agent.UserFromContext(ctx))
+	for _, doc := range docs {
+		s.collections[collection][doc.ID] = doc
+		s.upserts++
+	}
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, collection string, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.collections[collection], id)
+	}
+	return nil
+}
+
+func (s *memoryStore) Query(ctx context.Context, collection, text string, k int) ([]Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []Result
+	for _, doc := range s.collections[collection] {
+		var score float32
+		for _, word := range strings.Fields(text) {
+			if strings.Contains(doc.Text, word) {
+				score++
+			}
+		}
+		if score > 0 {
+			results = append(results, Result{Document: doc, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// paths returns the files with chunks in a collection
+func (s *memoryStore) paths(collection string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, doc := range s.collections[collection] {
+		path := doc.Metadata["path"].(string)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// roleAuthorizer grants filesystem read to users and system manage to admins
+type roleAuthorizer struct{}
+
+func (roleAuthorizer) HasPermission(claims *auth.Claims, object, action string) bool {
+	for _, role := range claims.Roles {
+		switch {
+		case role == "admin":
+			return true
+		case role == "user" && object == "filesystem" && action == "read":
+			return true
+		}
+	}
+	return false
+}
+
+// userRoles is the role assignment looked up by the indexer
+type userRoles struct {
+	mu    sync.Mutex
+	roles map[string][]string
+}
+
+func (r *userRoles) GetUserRoles(user string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roles[user], nil
+}
+
+func (r *userRoles) set(user string, roles ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles[user] = roles
+}
+
+var (
+	owner   = &auth.Claims{Username: "alice", Roles: []string{"user"}}
+	other   = &auth.Claims{Username: "bob", Roles: []string{"user"}}
+	guest   = &auth.Claims{Username: "guest", Roles: []string{"guest"}}
+	manager = &auth.Claims{Username: "root", Roles: []string{"admin"}}
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func newTestIndexer(t *testing.T, base string, store Store, statePath string) *Indexer {
+	t.Helper()
+	ix, err := NewIndexer(Config{
+		FS: safefs.NewSafeFS(safefs.Config{
+			BasePaths:   []string{base},
+			MaxFileSize: 1024 * 1024,
+			AllowedExts: []string{".md", ".txt"},
+			DeniedPaths: []string{filepath.Join(base, "notes", "private")},
+		}),
+		Store:        store,
+		Authorizer:   roleAuthorizer{},
+		Roles:        &userRoles{roles: map[string][]string{"alice": {"user"}}},
+		DefaultModel: "embed",
+		StatePath:    statePath,
+	})
+	require.NoError(t, err)
+	return ix
+}
+
+// createIndex creates an index and waits for its first sync
+func createIndex(t *testing.T, ix *Indexer, req IndexRequest) *Index {
+	t.Helper()
+	_, err := ix.Create(context.Background(), owner, req)
+	require.NoError(t, err)
+
+	index, err := ix.Sync(context.Background(), req.Name)
+	require.NoError(t, err)
+	return index
+}
+
+func TestChunkText(t *testing.T) {
+	text := "one\ntwo\nthree\nfour\n\nsix"
+
+	chunks := chunkText(text, 10, 4)
+	require.NotEmpty(t, chunks)
+	assert.Equal(t, chunk{Text: "one\ntwo", StartLine: 1, EndLine: 2}, chunks[0])
+	assert.Equal(t, chunk{Text: "two\nthree", StartLine: 2, EndLine: 3}, chunks[1])
+	assert.Equal(t, 6, chunks[len(chunks)-1].EndLine)
+
+	for _, c := range chunks {
+		assert.LessOrEqual(t, len(c.Text), 10)
+	}
+
+	t.Run("long lines", func(t *testing.T) {
+		chunks := chunkText(strings.Repeat("é", 25), 10, 0)
+		require.Len(t, chunks, 3)
+		for _, c := range chunks {
+			assert.Equal(t, 1, c.StartLine)
+		}
+	})
+
+	t.Run("blank", func(t *testing.T) {
+		assert.Empty(t, chunkText("\n \n", 10, 2))
+	})
+}
+
+func TestIndexerSync(t *testing.T) {
+	base := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "rag.json")
+	root := filepath.Join(base, "notes")
+
+	writeFile(t, filepath.Join(root, "a.md"), "gadget arm extends")
+	writeFile(t, filepath.Join(root, "b.txt"), "penny computer book")
+	writeFile(t, filepath.Join(root, "sub", "c.md"), "brain dog chief")
+	writeFile(t, filepath.Join(root, "binary.bin"), "not allowed")
+	writeFile(t, filepath.Join(root, ".git", "config.md"), "hidden")
+	writeFile(t, filepath.Join(root, "private", "secret.md"), "denied")
+	require.NoError(t, os.Symlink(filepath.Join(root, "a.md"), filepath.Join(root, "link.md")))
+
+	store := newMemoryStore()
+	ix := newTestIndexer(t, base, store, statePath)
+
+	index := createIndex(t, ix, IndexRequest{Name: "notes", Path: root})
+	assert.Empty(t, index.LastError)
+	assert.Equal(t, 3, index.Files)
+	assert.Equal(t, "embed", index.Model)
+	assert.Equal(t, []string{
+		filepath.Join(root, "a.md"),
+		filepath.Join(root, "b.txt"),
+		filepath.Join(root, "sub", "c.md"),
+	}, store.paths(index.Collection))
+	assert.Contains(t, store.users, "alice")
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, req := range []IndexRequest{
+			{Name: "../x", Path: root},
+			{Name: "x", Path: "notes"},
+			{Name: "x", Path: "/etc"},
+			{Name: "x", Path: root, ChunkSize: 100, ChunkOverlap: 60},
+		} {
+			_, err := ix.Create(context.Background(), owner, req)
+			assert.ErrorIs(t, err, ErrInvalidIndex, "%+v", req)
+		}
+
+		_, err := ix.Create(context.Background(), owner, IndexRequest{Name: "notes", Path: root})
+		assert.ErrorIs(t, err, ErrIndexExists)
+
+		_, err = ix.Create(context.Background(), guest, IndexRequest{Name: "x", Path: root})
+		assert.ErrorIs(t, err, ErrPermissionDenied)
+	})
+
+	// unchanged files are not embedded again
+	upserts := store.upserts
+	index, err := ix.Sync(context.Background(), "notes")
+	require.NoError(t, err)
+	assert.Equal(t, upserts, store.upserts)
+
+	writeFile(t, filepath.Join(root, "a.md"), "gadget arm retracts\n\nhat copter")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "a.md"), later, later))
+	require.NoError(t, os.Remove(filepath.Join(root, "b.txt")))
+
+	index, err = ix.Sync(context.Background(), "notes")
+	require.NoError(t, err)
+	assert.Equal(t, 2, index.Files)
+	assert.Equal(t, []string{
+		filepath.Join(root, "a.md"),
+		filepath.Join(root, "sub", "c.md"),
+	}, store.paths(index.Collection))
+
+	citations, err := ix.Retrieve(context.Background(), owner, "notes", "retracts copter", 2)
+	require.NoError(t, err)
+	require.Len(t, citations, 1)
+	assert.Equal(t, filepath.Join(root, "a.md"), citations[0].Path)
+	assert.Equal(t, 1, citations[0].StartLine)
+	assert.Equal(t, 3, citations[0].EndLine)
+
+	t.Run("restore", func(t *testing.T) {
+		data, err := os.ReadFile(statePath)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "roles")
+
+		ix := newTestIndexer(t, base, store, statePath)
+
+		restored, err := ix.Get("notes")
+		require.NoError(t, err)
+		assert.Equal(t, index.Files, restored.Files)
+		assert.Equal(t, index.Chunks, restored.Chunks)
+
+		upserts := store.upserts
+		_, err = ix.Sync(context.Background(), "notes")
+		require.NoError(t, err)
+		assert.Equal(t, upserts, store.upserts)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.ErrorIs(t, ix.Delete(context.Background(), other, "notes"), ErrPermissionDenied)
+		require.NoError(t, ix.Delete(context.Background(), manager, "notes"))
+
+		_, err := ix.Get("notes")
+		assert.ErrorIs(t, err, ErrIndexNotFound)
+		assert.NotContains(t, store.collections, index.Collection)
+	})
+}
+
+func TestRetrieveOnlyReadablePaths(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "notes")
+	writeFile(t, filepath.Join(root, "a.md"), "gadget arm")
+
+	store := newMemoryStore()
+	ix := newTestIndexer(t, base, store, "")
+	index := createIndex(t, ix, IndexRequest{Name: "notes", Path: root})
+
+	// chunks of paths SafeFS no longer allows are never returned
+	store.Upsert(context.Background(), index.Collection, []Document{
+		{ID: "outside", Text: "gadget arm", Metadata: map[string]interface{}{"path": "/etc/gadget.md"}},
+		{ID: "denied", Text: "gadget arm", Metadata: map[string]interface{}{"path": filepath.Join(root, "private", "a.md")}},
+	})
+
+	citations, err := ix.Retrieve(context.Background(), other, "notes", "gadget arm", 10)
+	require.NoError(t, err)
+	require.Len(t, citations, 1)
+	assert.Equal(t, filepath.Join(root, "a.md"), citations[0].Path)
+	assert.Equal(t, 1, citations[0].Source)
+
+	_, err = ix.Retrieve(context.Background(), guest, "notes", "gadget", 0)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	// the owner's current roles are looked up on every sync and retrieval
+	for _, roles := range [][]string{{"guest"}, nil} {
+		ix.roles.(*userRoles).set("alice", roles...)
+
+		upserts := store.upserts
+		writeFile(t, filepath.Join(root, "b.md"), "gadget leg")
+		index, err := ix.Sync(context.Background(), "notes")
+		require.NoError(t, err)
+		assert.Contains(t, index.LastError, ErrOwnerRevoked.Error())
+		assert.Equal(t, upserts, store.upserts)
+
+		_, err = ix.Retrieve(context.Background(), other, "notes", "gadget", 0)
+		assert.ErrorIs(t, err, ErrOwnerRevoked)
+	}
+
+	ix.roles.(*userRoles).set("alice", "user")
+	index, err = ix.Sync(context.Background(), "notes")
+	require.NoError(t, err)
+	assert.Empty(t, index.LastError)
+	assert.Equal(t, 2, index.Files)
+
+	_, err = ix.Retrieve(context.Background(), other, "missing", "gadget", 0)
+	assert.ErrorIs(t, err, ErrIndexNotFound)
+}
+
+func TestChatProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	base := t.TempDir()
+	root := filepath.Join(base, "notes")
+	writeFile(t, filepath.Join(root, "a.md"), "the gadget hat has a copter")
+
+	ix := newTestIndexer(t, base, newMemoryStore(), "")
+	createIndex(t, ix, IndexRequest{Name: "notes", Path: root})
+
+	var received map[string]interface{}
+	runtime := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		assert.Equal(t, "bob", r.Header.Get(agent.UserHeader))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		enc.Encode(map[string]interface{}{"message": map[string]string{"role": "assistant", "content": "It has a copter [1]"}, "done": false})
+		enc.Encode(map[string]interface{}{"done": true, "done_reason": "stop"})
+	}))
+	defer runtime.Close()
+
+	proxy := NewChatProxy(runtime.URL, ix)
+	chat := func(claims *auth.Claims, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_claims", claims)
+		proxy.Chat(c)
+		return w
+	}
+
+	w := chat(other, `{"model":"m","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"what is on the hat"}],"rag":{"index":"notes"}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.NotContains(t, received, "rag")
+	messages := received["messages"].([]interface{})
+	require.Len(t, messages, 3)
+	assert.Equal(t, "be brief", messages[0].(map[string]interface{})["content"])
+	injected := messages[1].(map[string]interface{})
+	assert.Equal(t, "system", injected["role"])
+	assert.Contains(t, injected["content"], "[1] "+filepath.Join(root, "a.md")+" (lines 1-1)")
+	assert.Contains(t, injected["content"], "the gadget hat has a copter")
+	assert.Equal(t, "what is on the hat", messages[2].(map[string]interface{})["content"])
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.Len(t, lines, 2)
+	assert.NotContains(t, lines[0], "citations")
+	citations := lines[1]["citations"].([]interface{})
+	require.Len(t, citations, 1)
+	assert.Equal(t, filepath.Join(root, "a.md"), citations[0].(map[string]interface{})["path"])
+
+	t.Run("without rag", func(t *testing.T) {
+		w := chat(other, `{"model":"m","messages":[{"role":"user","content":"what is on the hat"}]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, received["messages"], 1)
+		assert.NotContains(t, w.Body.String(), "citations")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, chat(other, `{"messages":[{"role":"user","content":"hat"}],"rag":{"index":"missing"}}`).Code)
+		assert.Equal(t, http.StatusForbidden, chat(guest, `{"messages":[{"role":"user","content":"hat"}],"rag":{"index":"notes"}}`).Code)
+		assert.Equal(t, http.StatusBadRequest, chat(other, `{"messages":[{"role":"system","content":"hat"}],"rag":{"index":"notes"}}`).Code)
+		assert.Equal(t, http.StatusBadRequest, chat(other, `{"messages":[],"rag":"notes"}`).Code)
+	})
+}
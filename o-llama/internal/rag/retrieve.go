@@ -0,0 +1,130 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"inspector-gadget-os/o-llama/internal/agent"
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/logging"
+)
+
+// overfetch is how many more chunks than requested are queried, leaving
+// room for chunks the caller may not read
+const overfetch = 4
+
+// Citation is a retrieved chunk, numbered as it is cited in the prompt
+type Citation struct {
+	Source    int     `json:"source"`
+	Path      string  `json:"path"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Score     float32 `json:"score"`
+	Text      string  `json:"-"`
+}
+
+// Retrieve returns up to k chunks of an index most relevant to query. Only
+// chunks of files the caller may read are returned, whoever built the index.
+func (ix *Indexer) Retrieve(ctx context.Context, claims *auth.Claims, name, query string, k int) ([]Citation, error) {
+	if k <= 0 {
+		k = DefaultTopK
+	}
+	if k > MaxTopK {
+		k = MaxTopK
+	}
+
+	info, err := ix.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ix.canRead(claims, "") {
+		return nil, ErrPermissionDenied
+	}
+
+	// chunks are served on the owner's authority as well as the caller's
+	if err := ix.checkOwner(*info); err != nil {
+		return nil, err
+	}
+
+	results, err := ix.store.Query(agent.WithUser(ctx, claims.Username), info.Collection, query, k*overfetch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query index %s: %w", name, err)
+	}
+
+	citations := make([]Citation, 0, k)
+	var filtered int
+	for _, result := range results {
+		path, _ := result.Metadata["path"].(string)
+		if path == "" || !ix.canRead(claims, path) {
+			filtered++
+			continue
+		}
+
+		citations = append(citations, Citation{
+			Source:    len(citations) + 1,
+			Path:      path,
+			StartLine: metadataInt(result.Metadata, "start_line"),
+			EndLine:   metadataInt(result.Metadata, "end_line"),
+			Score:     result.Score,
+			Text:      result.Text,
+		})
+		if len(citations) == k {
+			break
+		}
+	}
+
+	logging.L().Infow("rag.retrieve", "index", name, "user", claims.Username, "results", len(citations), "filtered", filtered)
+	return citations, nil
+}
+
+// metadataInt reads a number from metadata decoded from JSON
+func metadataInt(metadata map[string]interface{}, key string) int {
+	switch v := metadata[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// contextPrompt is the system message carrying retrieved chunks
+func contextPrompt(citations []Citation) string {
+	var b strings.Builder
+	b.WriteString("Answer using the excerpts below from the user's files where they are relevant. ")
+	b.WriteString("Cite each excerpt you use by its number in brackets, for example [1]. ")
+	b.WriteString("Ignore excerpts that do not help answer the question.\n")
+
+	for _, c := range citations {
+		fmt.Fprintf(&b, "\n[%d] %s (lines %d-%d)\n%s\n", c.Source, c.Path, c.StartLine, c.EndLine, c.Text)
+	}
+
+	return b.String()
+}
+
+// augment inserts the retrieved chunks as a system message just before the
+// last user message, leaving any leading system prompt first
+func augment(messages []map[string]interface{}, citations []Citation) []map[string]interface{} {
+	at := lastUserMessage(messages)
+	if at < 0 || len(citations) == 0 {
+		return messages
+	}
+
+	out := make([]map[string]interface{}, 0, len(messages)+1)
+	out = append(out, messages[:at]...)
+	out = append(out, map[string]interface{}{"role": "system", "content": contextPrompt(citations)})
+	return append(out, messages[at:]...)
+}
+
+// lastUserMessage returns the index of the last user message, or -1
+func lastUserMessage(messages []map[string]interface{}) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if role, _ := messages[i]["role"].(string); role == "user" {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,131 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"inspector-gadget-os/o-llama/internal/agent"
+)
+
+// Document is a chunk stored in a runtime collection
+type Document struct {
+	ID       string                 `json:"id"`
+	Text     string                 `json:"text,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Result is a document matching a query, most similar first
+type Result struct {
+	Document
+	Score float32 `json:"score"`
+}
+
+// Store keeps embedded chunks. The model runtime's collections implement it;
+// documents are embedded with the model of their collection.
+type Store interface {
+	CreateCollection(ctx context.Context, name, model string) error
+	DeleteCollection(ctx context.Context, name string) error
+	Upsert(ctx context.Context, collection string, docs []Document) error
+	Delete(ctx context.Context, collection string, ids []string) error
+	Query(ctx context.Context, collection, text string, k int) ([]Result, error)
+}
+
+// errStoreNotFound wraps runtime errors for missing collections or models
+var errStoreNotFound = errors.New("not found")
+
+// RuntimeStore stores chunks in collections of the bundled model runtime
+type RuntimeStore struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewRuntimeStore creates a store backed by the model runtime at baseURL
+func NewRuntimeStore(baseURL string) *RuntimeStore {
+	return &RuntimeStore{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{},
+	}
+}
+
+// CreateCollection creates a collection embedded with model
+func (s *RuntimeStore) CreateCollection(ctx context.Context, name, model string) error {
+	return s.do(ctx, http.MethodPost, "/api/collections", map[string]string{"name": name, "model": model}, nil)
+}
+
+// DeleteCollection removes a collection; missing collections are not an error
+func (s *RuntimeStore) DeleteCollection(ctx context.Context, name string) error {
+	err := s.do(ctx, http.MethodDelete, "/api/collections/"+url.PathEscape(name), nil, nil)
+	if errors.Is(err, errStoreNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Upsert adds docs to a collection, replacing documents with the same ID
+func (s *RuntimeStore) Upsert(ctx context.Context, collection string, docs []Document) error {
+	return s.do(ctx, http.MethodPost, "/api/collections/"+url.PathEscape(collection)+"/documents", map[string]interface{}{"documents": docs}, nil)
+}
+
+// Delete removes documents from a collection
+func (s *RuntimeStore) Delete(ctx context.Context, collection string, ids []string) error {
+	return s.do(ctx, http.MethodDelete, "/api/collections/"+url.PathEscape(collection)+"/documents", map[string]interface{}{"ids": ids}, nil)
+}
+
+// Query returns the k documents of a collection most similar to text
+func (s *RuntimeStore) Query(ctx context.Context, collection, text string, k int) ([]Result, error) {
+	var resp struct {
+		Results []Result `json:"results"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/api/collections/"+url.PathEscape(collection)+"/query", map[string]interface{}{"text": text, "k": k}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// do sends a JSON request to the runtime on behalf of the context's user
+func (s *RuntimeStore) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if user := agent.UserFromContext(ctx); user != "" {
+		req.Header.Set(agent.UserHeader, user)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("model runtime unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("model runtime error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		if resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("%w: %w", errStoreNotFound, err)
+		}
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -183,6 +183,15 @@ func (rm *RBACMiddleware) CheckPermission(c *gin.Context, object, action string)
 		return false
 	}
 
+	return rm.HasPermission(claims, object, action)
+}
+
+// HasPermission checks permissions for already-authenticated claims outside of a request chain
+func (rm *RBACMiddleware) HasPermission(claims *auth.Claims, object, action string) bool {
+	if claims == nil {
+		return false
+	}
+
 	// Check direct user permission
 	allowed, err := rm.casbinManager.CheckUserPermission(claims.Username, object, action)
 	if err == nil && allowed {
@@ -218,6 +218,31 @@ func (fs *SafeFS) ListDir(path, user string) ([]os.FileInfo, error) {
 	return fileInfos, nil
 }
 
+// StatDir lists directory contents with the same checks as ListDir but
+// without logging or auditing, for background scans which only compare file
+// metadata. File contents are still read through ReadFile.
+func (fs *SafeFS) StatDir(path string) ([]os.FileInfo, error) {
+	if err := fs.validatePathForDirectory(path); err != nil {
+		return nil, err
+	}
+	
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	
+	var fileInfos []os.FileInfo
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue // Skip entries we can't stat
+		}
+		fileInfos = append(fileInfos, info)
+	}
+	
+	return fileInfos, nil
+}
+
 // CopyFile safely copies a file with all security checks
 func (fs *SafeFS) CopyFile(srcPath, dstPath, user string) error {
 	// Validate both source and destination paths
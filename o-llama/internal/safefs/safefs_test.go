@@ -127,6 +127,21 @@ func TestFileOperations(t *testing.T) {
 		t.Errorf("Expected 1 file, got %d", len(fileInfos))
 	}
 	
+	// Test unaudited stat of directory
+	logged := len(auditLogger.logs)
+	fileInfos, err = fs.StatDir(tempDir)
+	if err != nil {
+		t.Fatalf("StatDir failed: %v", err)
+	}
+	
+	if len(fileInfos) != 1 || len(auditLogger.logs) != logged {
+		t.Errorf("Expected 1 file without audit entries, got %d files and %d entries", len(fileInfos), len(auditLogger.logs)-logged)
+	}
+	
+	if _, err := fs.StatDir("/etc"); err != ErrPathOutsideBase {
+		t.Errorf("Expected ErrPathOutsideBase, got %v", err)
+	}
+	
 	// Test copy operation
 	copyFile := filepath.Join(tempDir, "copy.txt")
 	err = fs.CopyFile(testFile, copyFile, "testuser")
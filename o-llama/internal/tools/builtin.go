@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"inspector-gadget-os/o-llama/internal/mcp"
+	"inspector-gadget-os/o-llama/internal/safefs"
+)
+
+// Built-in SafeFS tool names
+const (
+	BuiltinRead  = BuiltinNamespace + ".read"
+	BuiltinWrite = BuiltinNamespace + ".write"
+	BuiltinList  = BuiltinNamespace + ".list"
+)
+
+// builtinTools describes the SafeFS operations exposed as tools
+func builtinTools() []Tool {
+	pathSchema := mcp.Schema{
+		Type:        "string",
+		Description: "Absolute path inside an allowed base directory",
+	}
+
+	return []Tool{
+		{
+			Name:        BuiltinRead,
+			Description: "Read a text file from the sandboxed filesystem",
+			InputSchema: mcp.Schema{
+				Type:       "object",
+				Properties: map[string]mcp.Schema{"path": pathSchema},
+				Required:   []string{"path"},
+			},
+			Source:   SourceBuiltin,
+			Target:   "read",
+			Requires: []Requirement{{Object: "filesystem", Action: "read"}},
+		},
+		{
+			Name:        BuiltinWrite,
+			Description: "Write a text file to the sandboxed filesystem, replacing any existing content",
+			InputSchema: mcp.Schema{
+				Type: "object",
+				Properties: map[string]mcp.Schema{
+					"path":    pathSchema,
+					"content": {Type: "string", Description: "Full file content to write"},
+				},
+				Required: []string{"path", "content"},
+			},
+			Source:      SourceBuiltin,
+			Target:      "write",
+			Requires:    []Requirement{{Object: "filesystem", Action: "write"}},
+			Destructive: true,
+		},
+		{
+			Name:        BuiltinList,
+			Description: "List the entries of a directory in the sandboxed filesystem",
+			InputSchema: mcp.Schema{
+				Type:       "object",
+				Properties: map[string]mcp.Schema{"path": pathSchema},
+				Required:   []string{"path"},
+			},
+			Source:   SourceBuiltin,
+			Target:   "list",
+			Requires: []Requirement{{Object: "filesystem", Action: "read"}},
+		},
+	}
+}
+
+// callBuiltin runs a SafeFS operation and normalizes its result
+func callBuiltin(fs *safefs.SafeFS, target, user string, args map[string]interface{}) *mcp.CallToolResponse {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return errorResponse("path argument required")
+	}
+
+	switch target {
+	case "read":
+		data, err := fs.ReadFile(path, user)
+		if err != nil {
+			return errorResponse(err.Error())
+		}
+		return textResponse(string(data))
+
+	case "write":
+		content, ok := args["content"].(string)
+		if !ok {
+			return errorResponse("content argument required")
+		}
+		if err := fs.WriteFile(path, user, []byte(content), 0644); err != nil {
+			return errorResponse(err.Error())
+		}
+		return textResponse(fmt.Sprintf("wrote %d bytes to %s", len(content), path))
+
+	case "list":
+		files, err := fs.ListDir(path, user)
+		if err != nil {
+			return errorResponse(err.Error())
+		}
+
+		entries := make([]map[string]interface{}, 0, len(files))
+		for _, file := range files {
+			entries = append(entries, map[string]interface{}{
+				"name":   file.Name(),
+				"size":   file.Size(),
+				"is_dir": file.IsDir(),
+			})
+		}
+
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return errorResponse(err.Error())
+		}
+		return textResponse(string(data))
+
+	default:
+		return errorResponse("unknown builtin tool: " + target)
+	}
+}
@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/logging"
+	"inspector-gadget-os/o-llama/internal/mcp"
+)
+
+// Execute dispatches a tool call to its backend on behalf of the caller.
+// Unknown tools and RBAC denials are returned as errors; failures inside a
+// backend are normalized into a CallToolResponse with IsError set so they
+// can be reported back to the model.
+func (r *Registry) Execute(ctx context.Context, claims *auth.Claims, name string, arguments map[string]interface{}) (*mcp.CallToolResponse, error) {
+	if claims == nil {
+		return nil, fmt.Errorf("authentication required")
+	}
+
+	tool, err := r.Lookup(ctx, claims, name)
+	if err != nil {
+		logging.L().Warnw("tools.exec.denied", "tool", name, "user", claims.Username, "reason", err.Error())
+		return nil, err
+	}
+
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+
+	start := time.Now()
+	logging.L().Infow("tools.exec.start", "tool", tool.Name, "source", tool.Source, "user", claims.Username)
+
+	var response *mcp.CallToolResponse
+	switch tool.Source {
+	case SourceBuiltin:
+		response = callBuiltin(r.fs, tool.Target, claims.Username, arguments)
+
+	case SourceGadget:
+		response = r.callGadget(ctx, tool.Target, claims.Username, arguments)
+
+	case SourceMCP:
+		response, err = r.mcp.CallTool(ctx, tool.Server, tool.Target, arguments)
+		if err != nil {
+			response = errorResponse(err.Error())
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported tool source: %s", tool.Source)
+	}
+
+	if response == nil {
+		response = errorResponse("tool returned no result")
+	}
+
+	logging.L().Infow("tools.exec.finish",
+		"tool", tool.Name,
+		"source", tool.Source,
+		"user", claims.Username,
+		"is_error", response.IsError,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return response, nil
+}
+
+// callGadget runs a gadget and normalizes its output
+func (r *Registry) callGadget(ctx context.Context, gadgetName, user string, arguments map[string]interface{}) *mcp.CallToolResponse {
+	var args []string
+	if raw, ok := arguments["args"].([]interface{}); ok {
+		for _, arg := range raw {
+			args = append(args, fmt.Sprint(arg))
+		}
+	}
+
+	result, err := r.gadgets.Run(ctx, gadgetName, args, user)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	response := textResponse(result.Output)
+	if !result.Success {
+		response.IsError = true
+		response.Content = append(response.Content, mcp.ContentItem{
+			Type: mcp.ContentTypeText,
+			Text: fmt.Sprintf("exit code %d: %s", result.ExitCode, result.Error),
+		})
+	}
+
+	return response
+}
+
+// textResponse wraps text in a successful tool response
+func textResponse(text string) *mcp.CallToolResponse {
+	return &mcp.CallToolResponse{
+		Content: []mcp.ContentItem{{Type: mcp.ContentTypeText, Text: text}},
+	}
+}
+
+// errorResponse wraps an error message in a failed tool response
+func errorResponse(message string) *mcp.CallToolResponse {
+	return &mcp.CallToolResponse{
+		Content: []mcp.ContentItem{{Type: mcp.ContentTypeText, Text: message}},
+		IsError: true,
+	}
+}
@@ -0,0 +1,374 @@
+// Package tools aggregates MCP tools, gadgets and built-in SafeFS operations
+// into a single catalog that can be handed to a model for tool calling.
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/integration"
+	"inspector-gadget-os/o-llama/internal/logging"
+	"inspector-gadget-os/o-llama/internal/mcp"
+	"inspector-gadget-os/o-llama/internal/safefs"
+)
+
+// Source identifies the backend a tool is dispatched to
+type Source string
+
+const (
+	SourceBuiltin Source = "builtin"
+	SourceGadget  Source = "gadget"
+	SourceMCP     Source = "mcp"
+)
+
+// Namespaces used for non-MCP tools. MCP tools are namespaced by server name.
+const (
+	GadgetNamespace  = "gadget"
+	BuiltinNamespace = "fs"
+)
+
+// Requirement is an RBAC object/action pair a caller needs to use a tool
+type Requirement struct {
+	Object string `json:"object"`
+	Action string `json:"action"`
+}
+
+// Tool is a single entry in the unified catalog
+type Tool struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	InputSchema mcp.Schema    `json:"inputSchema"`
+	Source      Source        `json:"source"`
+	Server      string        `json:"server,omitempty"`
+	Target      string        `json:"target"`
+	Requires    []Requirement `json:"requires,omitempty"`
+	Destructive bool          `json:"destructive"`
+}
+
+// FunctionDefinition is the function-calling shape expected by chat models
+type FunctionDefinition struct {
+	Type     string       `json:"type"`
+	Function FunctionSpec `json:"function"`
+}
+
+// FunctionSpec describes a callable function to a model
+type FunctionSpec struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Parameters  mcp.Schema `json:"parameters"`
+}
+
+// Definition converts the tool into a model-facing function definition
+func (t Tool) Definition() FunctionDefinition {
+	return FunctionDefinition{
+		Type: "function",
+		Function: FunctionSpec{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters:  t.InputSchema,
+		},
+	}
+}
+
+// Authorizer checks RBAC permissions for authenticated claims
+type Authorizer interface {
+	HasPermission(claims *auth.Claims, object, action string) bool
+}
+
+// MCPBackend is the subset of MCPManager used by the registry
+type MCPBackend interface {
+	ListTools(ctx context.Context) (map[string][]mcp.Tool, error)
+	CallTool(ctx context.Context, serverName, toolName string, arguments interface{}) (*mcp.CallToolResponse, error)
+}
+
+// GadgetBackend is the subset of GadgetIntegration used by the registry
+type GadgetBackend interface {
+	List() ([]integration.GadgetInfo, error)
+	Run(ctx context.Context, gadgetName string, args []string, username string) (*integration.GadgetExecuteResponse, error)
+	IsSystemGadget(name string) bool
+}
+
+// DefaultCatalogTTL bounds how long a cached catalog is served. Changes are
+// normally picked up through Invalidate and MCP events; the TTL catches
+// gadgets installed without either.
+const DefaultCatalogTTL = 5 * time.Minute
+
+// Config holds the backends a Registry aggregates. Any backend may be nil.
+type Config struct {
+	MCP        MCPBackend
+	Gadgets    GadgetBackend
+	FS         *safefs.SafeFS
+	Authorizer Authorizer
+	CatalogTTL time.Duration
+
+	// Events, when set, is watched for MCP changes until the registry is
+	// closed
+	Events *mcp.EventHub
+}
+
+// Common errors
+var (
+	ErrToolNotFound     = errors.New("tool not found")
+	ErrPermissionDenied = errors.New("insufficient permissions for tool")
+)
+
+// Registry builds the unified tool catalog and dispatches tool calls
+type Registry struct {
+	mcp        MCPBackend
+	gadgets    GadgetBackend
+	fs         *safefs.SafeFS
+	authorizer Authorizer
+	ttl        time.Duration
+
+	mu         sync.Mutex
+	cached     []Tool
+	cachedAt   time.Time
+	generation uint64
+
+	unsubscribe func()
+}
+
+// NewRegistry creates a new tool registry
+func NewRegistry(config Config) *Registry {
+	if config.CatalogTTL <= 0 {
+		config.CatalogTTL = DefaultCatalogTTL
+	}
+
+	r := &Registry{
+		mcp:        config.MCP,
+		gadgets:    config.Gadgets,
+		fs:         config.FS,
+		authorizer: config.Authorizer,
+		ttl:        config.CatalogTTL,
+	}
+
+	if config.Events != nil {
+		events, unsubscribe := config.Events.Subscribe(32)
+		r.unsubscribe = unsubscribe
+		go r.Watch(events)
+	}
+
+	return r
+}
+
+// Close stops watching MCP events
+func (r *Registry) Close() {
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+}
+
+// Invalidate drops the cached catalog so the next use lists every backend
+// again, e.g. after gadgets are installed or removed
+func (r *Registry) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cached = nil
+	r.generation++
+}
+
+// Watch invalidates the catalog on MCP changes that can add or remove tools.
+// It returns when events is closed.
+func (r *Registry) Watch(events <-chan mcp.ChangeEvent) {
+	for event := range events {
+		switch event.Type {
+		case mcp.EventToolsChanged, mcp.EventServerConnected, mcp.EventServerDisconnected,
+			mcp.EventServerExited, mcp.EventServerCrashLoop:
+			logging.L().Debugw("tools.catalog.invalidate", "server", event.Server, "event", event.Type)
+			r.Invalidate()
+		}
+	}
+}
+
+// Catalog returns every tool the caller is allowed to use, sorted by name.
+// Built-in tools take precedence over gadgets, which take precedence over MCP
+// tools when two backends produce the same namespaced name.
+func (r *Registry) Catalog(ctx context.Context, claims *auth.Claims) ([]Tool, error) {
+	all, err := r.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make([]Tool, 0, len(all))
+	for _, tool := range all {
+		if r.allowed(claims, tool) {
+			tools = append(tools, tool)
+		}
+	}
+
+	return tools, nil
+}
+
+// Lookup resolves a single tool by its namespaced name for the caller
+func (r *Registry) Lookup(ctx context.Context, claims *auth.Claims, name string) (*Tool, error) {
+	all, err := r.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tool := range all {
+		if tool.Name != name {
+			continue
+		}
+		if !r.allowed(claims, tool) {
+			return nil, fmt.Errorf("%w: %s", ErrPermissionDenied, name)
+		}
+		return &tool, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrToolNotFound, name)
+}
+
+// catalog returns the cached catalog, collecting it when it was invalidated
+// or has expired. Backends are listed without holding the lock; a catalog
+// collected across an invalidation is returned but not cached.
+func (r *Registry) catalog(ctx context.Context) ([]Tool, error) {
+	r.mu.Lock()
+	if r.cached != nil && time.Since(r.cachedAt) < r.ttl {
+		tools := r.cached
+		r.mu.Unlock()
+		return tools, nil
+	}
+	generation := r.generation
+	r.mu.Unlock()
+
+	tools, err := r.collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if r.generation == generation {
+		r.cached, r.cachedAt = tools, time.Now()
+	}
+	r.mu.Unlock()
+
+	return tools, nil
+}
+
+// collect gathers tools from all backends and removes duplicate names
+func (r *Registry) collect(ctx context.Context) ([]Tool, error) {
+	var candidates []Tool
+
+	if r.fs != nil {
+		candidates = append(candidates, builtinTools()...)
+	}
+
+	if r.gadgets != nil {
+		gadgets, err := r.gadgets.List()
+		if err != nil {
+			logging.L().Warnw("tools.gadgets.list.error", "error", err.Error())
+		} else {
+			for _, gadget := range gadgets {
+				candidates = append(candidates, r.gadgetTool(gadget))
+			}
+		}
+	}
+
+	if r.mcp != nil {
+		servers, err := r.mcp.ListTools(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list MCP tools: %w", err)
+		}
+
+		names := make([]string, 0, len(servers))
+		for name := range servers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, server := range names {
+			for _, tool := range servers[server] {
+				candidates = append(candidates, mcpTool(server, tool))
+			}
+		}
+	}
+
+	seen := make(map[string]Tool, len(candidates))
+	tools := make([]Tool, 0, len(candidates))
+	for _, tool := range candidates {
+		if existing, dup := seen[tool.Name]; dup {
+			logging.L().Warnw("tools.duplicate",
+				"tool", tool.Name,
+				"kept_source", existing.Source,
+				"dropped_source", tool.Source,
+			)
+			continue
+		}
+		seen[tool.Name] = tool
+		tools = append(tools, tool)
+	}
+
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools, nil
+}
+
+// allowed reports whether the caller satisfies every requirement of a tool
+func (r *Registry) allowed(claims *auth.Claims, tool Tool) bool {
+	if r.authorizer == nil {
+		return false
+	}
+	for _, req := range tool.Requires {
+		if !r.authorizer.HasPermission(claims, req.Object, req.Action) {
+			return false
+		}
+	}
+	return true
+}
+
+// gadgetTool describes a gadget as a catalog entry
+func (r *Registry) gadgetTool(gadget integration.GadgetInfo) Tool {
+	requires := []Requirement{{Object: "gadgets", Action: "execute"}}
+	if r.gadgets.IsSystemGadget(gadget.Name) {
+		requires = append(requires, Requirement{Object: "system", Action: "manage"})
+	}
+
+	description := gadget.Description
+	if description == "" {
+		description = "Run the " + gadget.Name + " gadget"
+	}
+
+	return Tool{
+		Name:        GadgetNamespace + "." + gadget.Name,
+		Description: description,
+		InputSchema: mcp.Schema{
+			Type: "object",
+			Properties: map[string]mcp.Schema{
+				"args": {
+					Type:        "array",
+					Description: "Command-line arguments passed to the gadget",
+					Items:       &mcp.Schema{Type: "string"},
+				},
+			},
+		},
+		Source:      SourceGadget,
+		Target:      gadget.Name,
+		Requires:    requires,
+		Destructive: true, // gadgets run arbitrary binaries
+	}
+}
+
+// mcpTool namespaces an MCP tool by its server name
+func mcpTool(server string, tool mcp.Tool) Tool {
+	schema := tool.InputSchema
+	if schema.Type == "" {
+		schema.Type = "object"
+	}
+
+	return Tool{
+		Name:        server + "." + tool.Name,
+		Description: tool.Description,
+		InputSchema: schema,
+		Source:      SourceMCP,
+		Server:      server,
+		Target:      tool.Name,
+		Requires:    []Requirement{{Object: "ai", Action: "access"}},
+		Destructive: tool.IsDestructive(),
+	}
+}
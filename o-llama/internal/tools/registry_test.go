@@ -0,0 +1,270 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"inspector-gadget-os/o-llama/internal/auth"
+	"inspector-gadget-os/o-llama/internal/integration"
+	"inspector-gadget-os/o-llama/internal/mcp"
+	"inspector-gadget-os/o-llama/internal/safefs"
+)
+
+// fakeAuthorizer grants permissions from a static role table
+type fakeAuthorizer map[string][]Requirement
+
+func (f fakeAuthorizer) HasPermission(claims *auth.Claims, object, action string) bool {
+	if claims == nil {
+		return false
+	}
+	for _, role := range claims.Roles {
+		for _, req := range f[role] {
+			if req.Object == object && req.Action == action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type fakeMCP struct {
+	tools map[string][]mcp.Tool
+	calls []string
+	lists int
+}
+
+func (f *fakeMCP) ListTools(ctx context.Context) (map[string][]mcp.Tool, error) {
+	f.lists++
+	return f.tools, nil
+}
+
+func (f *fakeMCP) CallTool(ctx context.Context, serverName, toolName string, arguments interface{}) (*mcp.CallToolResponse, error) {
+	f.calls = append(f.calls, serverName+"/"+toolName)
+	return textResponse("called " + toolName), nil
+}
+
+type fakeGadgets struct {
+	lastArgs []string
+	extra    []integration.GadgetInfo
+	lists    int
+}
+
+func (f *fakeGadgets) List() ([]integration.GadgetInfo, error) {
+	f.lists++
+	return append([]integration.GadgetInfo{
+		{Name: "echo", Description: "Echo arguments"},
+		{Name: "sysinfo", Description: "System information"},
+	}, f.extra...), nil
+}
+
+func (f *fakeGadgets) Run(ctx context.Context, gadgetName string, args []string, username string) (*integration.GadgetExecuteResponse, error) {
+	f.lastArgs = args
+	if gadgetName == "sysinfo" {
+		return &integration.GadgetExecuteResponse{GadgetName: gadgetName, ExitCode: 2, Error: "boom"}, nil
+	}
+	return &integration.GadgetExecuteResponse{GadgetName: gadgetName, Success: true, Output: "ok"}, nil
+}
+
+func (f *fakeGadgets) IsSystemGadget(name string) bool {
+	return name == "sysinfo"
+}
+
+func newTestRegistry(t *testing.T) (*Registry, *fakeMCP, *fakeGadgets, string) {
+	dir := t.TempDir()
+
+	mcpBackend := &fakeMCP{tools: map[string][]mcp.Tool{
+		"files": {{Name: "search", Description: "Search files"}},
+		// Collides with the built-in fs.read and must be dropped
+		"fs": {{Name: "read", Description: "Shadowing read"}},
+	}}
+	gadgets := &fakeGadgets{}
+
+	authorizer := fakeAuthorizer{
+		"admin": {
+			{"filesystem", "read"}, {"filesystem", "write"},
+			{"gadgets", "execute"}, {"system", "manage"}, {"ai", "access"},
+		},
+		"readonly": {{"filesystem", "read"}},
+	}
+
+	registry := NewRegistry(Config{
+		MCP:        mcpBackend,
+		Gadgets:    gadgets,
+		FS:         safefs.NewSafeFS(safefs.Config{BasePaths: []string{dir}, AllowedExts: []string{".txt"}}),
+		Authorizer: authorizer,
+	})
+
+	return registry, mcpBackend, gadgets, dir
+}
+
+func toolNames(tools []Tool) []string {
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestCatalogMergesAndDeduplicates(t *testing.T) {
+	registry, _, _, _ := newTestRegistry(t)
+
+	tools, err := registry.Catalog(context.Background(), &auth.Claims{Username: "root", Roles: []string{"admin"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"files.search",
+		"fs.list",
+		"fs.read",
+		"fs.write",
+		"gadget.echo",
+		"gadget.sysinfo",
+	}, toolNames(tools))
+
+	for _, tool := range tools {
+		if tool.Name == "fs.read" {
+			assert.Equal(t, SourceBuiltin, tool.Source)
+		}
+		assert.Equal(t, "object", tool.InputSchema.Type)
+	}
+}
+
+func TestCatalogFiltersByRBAC(t *testing.T) {
+	registry, _, _, _ := newTestRegistry(t)
+
+	tools, err := registry.Catalog(context.Background(), &auth.Claims{Username: "viewer", Roles: []string{"readonly"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fs.list", "fs.read"}, toolNames(tools))
+
+	tools, err = registry.Catalog(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, tools)
+}
+
+func TestExecuteDispatchesToBackends(t *testing.T) {
+	registry, mcpBackend, gadgets, dir := newTestRegistry(t)
+	admin := &auth.Claims{Username: "root", Roles: []string{"admin"}}
+	ctx := context.Background()
+
+	path := filepath.Join(dir, "notes.txt")
+	resp, err := registry.Execute(ctx, admin, BuiltinWrite, map[string]interface{}{"path": path, "content": "hello"})
+	require.NoError(t, err)
+	assert.False(t, resp.IsError)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	resp, err = registry.Execute(ctx, admin, BuiltinRead, map[string]interface{}{"path": path})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Content[0].Text)
+
+	resp, err = registry.Execute(ctx, admin, "files.search", map[string]interface{}{"query": "x"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"files/search"}, mcpBackend.calls)
+	assert.Equal(t, "called search", resp.Content[0].Text)
+
+	resp, err = registry.Execute(ctx, admin, "gadget.echo", map[string]interface{}{"args": []interface{}{"a", 1}})
+	require.NoError(t, err)
+	assert.False(t, resp.IsError)
+	assert.Equal(t, []string{"a", "1"}, gadgets.lastArgs)
+
+	resp, err = registry.Execute(ctx, admin, "gadget.sysinfo", nil)
+	require.NoError(t, err)
+	assert.True(t, resp.IsError)
+}
+
+func TestExecuteErrors(t *testing.T) {
+	registry, _, _, dir := newTestRegistry(t)
+	ctx := context.Background()
+	viewer := &auth.Claims{Username: "viewer", Roles: []string{"readonly"}}
+
+	_, err := registry.Execute(ctx, viewer, "missing.tool", nil)
+	assert.ErrorIs(t, err, ErrToolNotFound)
+
+	_, err = registry.Execute(ctx, viewer, BuiltinWrite, map[string]interface{}{"path": filepath.Join(dir, "x.txt"), "content": "x"})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	// SafeFS policy violations are reported as tool errors, not Go errors
+	resp, err := registry.Execute(ctx, viewer, BuiltinRead, map[string]interface{}{"path": "/etc/passwd"})
+	require.NoError(t, err)
+	assert.True(t, resp.IsError)
+}
+
+func TestCatalogIsCachedUntilInvalidated(t *testing.T) {
+	registry, mcpBackend, gadgets, _ := newTestRegistry(t)
+	admin := &auth.Claims{Username: "root", Roles: []string{"admin"}}
+	ctx := context.Background()
+
+	_, err := registry.Catalog(ctx, admin)
+	require.NoError(t, err)
+	_, err = registry.Lookup(ctx, admin, "files.search")
+	require.NoError(t, err)
+	_, err = registry.Execute(ctx, admin, "files.search", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, mcpBackend.lists)
+	assert.Equal(t, 1, gadgets.lists)
+
+	// Gadget changes show up after an explicit refresh
+	gadgets.extra = []integration.GadgetInfo{{Name: "new"}}
+	_, err = registry.Lookup(ctx, admin, "gadget.new")
+	assert.ErrorIs(t, err, ErrToolNotFound)
+
+	registry.Invalidate()
+	_, err = registry.Lookup(ctx, admin, "gadget.new")
+	require.NoError(t, err)
+	assert.Equal(t, 2, gadgets.lists)
+
+	// MCP list changes arrive as events
+	events := make(chan mcp.ChangeEvent, 2)
+	mcpBackend.tools["files"] = append(mcpBackend.tools["files"], mcp.Tool{Name: "index"})
+	events <- mcp.ChangeEvent{Type: mcp.EventResourceUpdated, Server: "files"}
+	events <- mcp.ChangeEvent{Type: mcp.EventToolsChanged, Server: "files"}
+	close(events)
+	registry.Watch(events)
+
+	_, err = registry.Lookup(ctx, admin, "files.index")
+	require.NoError(t, err)
+	assert.Equal(t, 3, mcpBackend.lists)
+}
+
+func TestCatalogExpires(t *testing.T) {
+	registry := NewRegistry(Config{MCP: &fakeMCP{}, Authorizer: fakeAuthorizer{}, CatalogTTL: time.Millisecond})
+	backend := registry.mcp.(*fakeMCP)
+
+	_, err := registry.Catalog(context.Background(), nil)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = registry.Catalog(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, backend.lists)
+}
+
+func TestRegistryWatchesManagerEvents(t *testing.T) {
+	manager := mcp.NewMCPManager(mcp.MCPManagerConfig{Servers: map[string]*mcp.MCPServerConfig{}})
+	registry := NewRegistry(Config{MCP: &fakeMCP{}, Authorizer: fakeAuthorizer{}, Events: manager.Events()})
+	backend := registry.mcp.(*fakeMCP)
+
+	_, err := registry.Catalog(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, manager.Events().Listeners())
+
+	// the subscription outlives the setup that created the registry
+	manager.Events().Publish(mcp.ChangeEvent{Type: mcp.EventServerConnected, Server: "files"})
+	require.Eventually(t, func() bool {
+		registry.mu.Lock()
+		defer registry.mu.Unlock()
+		return registry.cached == nil
+	}, time.Second, time.Millisecond)
+
+	_, err = registry.Catalog(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, backend.lists)
+
+	registry.Close()
+	assert.Equal(t, 0, manager.Events().Listeners())
+}